@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+)
+
+// defaultDetachKeys is the key sequence leaving guvnor attach, as in docker attach
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <process>",
+	Short: "Attach to the input and output of a running process",
+	Long: `Attach the terminal to a running process: what it writes to stdout and stderr
+is shown as written, and lines typed are sent to its stdin, e.g. to use a
+REPL or answer a debugger. Only output written from now on is shown; guvnor
+logs has what came before.
+
+- attach console                        # Type into the console app
+- attach web.2 --no-stdin               # Only watch the output of instance 2
+- attach console --detach-keys ctrl-x   # Another detach sequence
+
+Detach with Ctrl+P Ctrl+Q, Ctrl+C or Ctrl+D; the process keeps running. When
+it exits, attach exits with its exit code.
+
+The process gets input only with stdin: true in its app config. Its stdin is
+a pipe, not a terminal, so REPLs may need to be told they are interactive,
+e.g. python -i or node -i. Container apps cannot be attached to; open a
+shell in them with guvnor exec.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runAttach,
+}
+
+func init() {
+	attachCmd.Flags().String("detach-keys", defaultDetachKeys, "key sequence that detaches: comma-separated ctrl-<letter> or single characters")
+	attachCmd.Flags().Bool("no-stdin", false, "only show the output, do not send input")
+	rootCmd.AddCommand(attachCmd)
+}
+
+func runAttach(cmd *cobra.Command, args []string) {
+	detachKeysFlag, _ := cmd.Flags().GetString("detach-keys")
+	noStdin, _ := cmd.Flags().GetBool("no-stdin")
+	detachKeys, err := parseDetachKeys(detachKeysFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := requireServer("Attaching needs the running server, start it with: guvnor start")
+	if code := attach(server, args[0], detachKeys, detachKeysFlag, noStdin); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// attach attaches the terminal to a process until it exits or the user
+// detaches, and returns the exit code of guvnor attach. It returns instead
+// of exiting so the terminal is restored.
+func attach(server *client.Client, name string, detachKeys []rune, detachKeysFlag string, noStdin bool) int {
+	ctx, cancel := clientContext()
+	defer cancel()
+
+	attachment, err := server.Attach(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describeClientError(err))
+		return 1
+	}
+	// Ctrl+C outside the line editor, or a termination signal, detaches
+	stop := context.AfterFunc(ctx, func() { attachment.Close() })
+	defer stop()
+
+	input := attachment.Stdin && !noStdin
+	var out io.Writer = os.Stdout
+	switch {
+	case input && isTerminal(os.Stdin):
+		// The line editor reads on after the detach keys; closing its stdin
+		// first ends that read, or closing the editor would wait for a key
+		stdin := readline.NewCancelableStdin(os.Stdin)
+		rl, err := readline.NewEx(&readline.Config{
+			Prompt:              "",
+			Stdin:               stdin,
+			InterruptPrompt:     "\n", // Instead of ^C
+			FuncFilterInputRune: detachFilter(detachKeys),
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to read the terminal: %v\n", err)
+			return 1
+		}
+		defer func() {
+			stdin.Close()
+			rl.Close()
+		}()
+		// Output goes through the line editor, so it does not garble the line being typed
+		out = rl.Stdout()
+		fmt.Fprintf(os.Stderr, "Attached to %s, detach with %s\n", name, detachKeysFlag)
+		go func() {
+			for {
+				line, err := rl.Readline()
+				if err != nil {
+					// Detach keys and Ctrl+C interrupt, Ctrl+D ends the input
+					attachment.Close()
+					return
+				}
+				if _, err := attachment.Write([]byte(line + "\n")); err != nil {
+					return
+				}
+			}
+		}()
+	case input:
+		// Piped input is sent as is; attach keeps following the output after it ends
+		go io.Copy(attachment, os.Stdin)
+	default:
+		if !attachment.Stdin && !noStdin {
+			fmt.Fprintf(os.Stderr, "Attached to %s read-only, its app does not set stdin: true (detach with Ctrl+C)\n", name)
+		} else {
+			fmt.Fprintf(os.Stderr, "Attached to %s read-only (detach with Ctrl+C)\n", name)
+		}
+	}
+
+	exitCode, err := attachment.Copy(out)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		return 1
+	case exitCode < 0:
+		fmt.Fprintf(os.Stderr, "\nDetached from %s, it keeps running\n", name)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "\n%s exited with code %d\n", name, exitCode)
+		return exitCode
+	}
+}
+
+// parseDetachKeys parses a detach sequence such as ctrl-p,ctrl-q into the
+// runes the terminal sends for it
+func parseDetachKeys(value string) ([]rune, error) {
+	var keys []rune
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if letter, ok := strings.CutPrefix(strings.ToLower(key), "ctrl-"); ok {
+			if len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+				return nil, fmt.Errorf("invalid detach key %q (use ctrl-<letter> or a single character)", key)
+			}
+			keys = append(keys, rune(letter[0]-'a'+1))
+			continue
+		}
+		runes := []rune(key)
+		if len(runes) != 1 {
+			return nil, fmt.Errorf("invalid detach key %q (use ctrl-<letter> or a single character)", key)
+		}
+		keys = append(keys, runes[0])
+	}
+	return keys, nil
+}
+
+// detachFilter holds back the keys of the detach sequence while they are
+// typed, and turns the complete sequence into an interrupt of the line editor
+func detachFilter(keys []rune) func(rune) (rune, bool) {
+	matched := 0
+	return func(r rune) (rune, bool) {
+		if r != keys[matched] {
+			matched = 0
+		}
+		if r == keys[matched] {
+			matched++
+			if matched == len(keys) {
+				matched = 0
+				return readline.CharInterrupt, true
+			}
+			return r, false
+		}
+		return r, true
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// autoStart starts a missing server without asking
+var autoStart bool
+
+// autoStartTimeout is how long a server started in the background may take to
+// answer on its management API
+const autoStartTimeout = 30 * time.Second
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&autoStart, "auto-start", false, "start the server in the background if it is not running")
+}
+
+// requireServer returns a client for the running server. Without one it
+// offers to start it in the background, or starts it right away with
+// --auto-start, and exits printing hint if that is declined or fails.
+func requireServer(hint string) *client.Client {
+	server, err := findServer()
+	if err == nil {
+		return server
+	}
+	if _, selected, _ := remoteServer(); selected {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUnavailable)
+	}
+
+	if !autoStart {
+		if !isTerminal(os.Stdin) || !confirm("No guvnor server is running. Start it in the background with the current config?") {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "%s (or pass --auto-start)\n", hint)
+			os.Exit(exitUnavailable)
+		}
+	}
+
+	server, err = startBackgroundServer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to start guvnor server: %v\n", err)
+		os.Exit(exitUnavailable)
+	}
+	return server
+}
+
+// findServer returns a client for the running server: the remote server of
+// --host, --context or the current context when one is selected, otherwise
+// the server of the config before the server registry so a server started
+// from it is found. Only a server known to be running, through its PID file
+// or the registry, is waited for; without one it fails at once.
+func findServer() (*client.Client, error) {
+	// Requests to a remote server report why it cannot be reached, e.g. an
+	// untrusted certificate, so it is not pinged first
+	if server, selected, err := remoteServer(); selected {
+		return server, err
+	}
+
+	if cfg, err := loadConfig(); err == nil {
+		if server := waitForConfiguredServer(cfg); server != nil {
+			return withToken(server), nil
+		}
+	}
+	dir, _ := os.Getwd()
+	server, err := client.DetectServer(dir)
+	if err != nil {
+		return nil, err
+	}
+	return withToken(server), nil
+}
+
+// withToken makes a client send the --token, when given, instead of $GUVNOR_TOKEN
+func withToken(c *client.Client) *client.Client {
+	if remote.token != "" {
+		c.WithToken(remote.token)
+	}
+	return c
+}
+
+// configuredServer returns a client for the server of cfg, through its unix
+// socket when it holds it, or nil when it is not running
+func configuredServer(cfg *config.Config) *client.Client {
+	if path := cfg.Server.SocketPath(); path != "" {
+		if server := client.NewSocketClient(path); server.Serves(cfg.Server.HTTPPort) {
+			return server
+		}
+	}
+	if server := client.NewClient(cfg.Server.HTTPPort); server.IsServerRunning() {
+		return server
+	}
+	return nil
+}
+
+// waitForConfiguredServer returns a client for the server of cfg like
+// configuredServer. When its PID file names a running server that does not
+// answer yet, it is asked again briefly.
+func waitForConfiguredServer(cfg *config.Config) *client.Client {
+	server := configuredServer(cfg)
+	if server != nil {
+		return server
+	}
+	if _, err := serverPID(cfg); err != nil {
+		return nil
+	}
+	backoff := client.DefaultRetryPolicy.InitialBackoff
+	for attempt := 1; server == nil && attempt < client.DefaultRetryPolicy.MaxAttempts; attempt++ {
+		time.Sleep(backoff)
+		backoff *= 2
+		server = configuredServer(cfg)
+	}
+	return server
+}
+
+// startBackgroundServer runs "guvnor start" detached from the terminal, logging
+// to the state directory, and waits until its management API answers
+func startBackgroundServer() (*client.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	args := []string{"start"}
+	if configFile != "" {
+		args = append(args, "--config", configFile)
+	}
+	server, pid, err := spawnServer(cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Server running, stop it with: guvnor daemon stop (pid %d)\n", pid)
+	return server, nil
+}
+
+// spawnServer runs guvnor with args detached from the terminal, its output
+// appended to server.log in the state directory, and waits until the
+// management API of cfg answers. It returns a client and the server's PID.
+func spawnServer(cfg *config.Config, args []string) (*client.Client, int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logPath := cfg.Server.StatePath("server.log")
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, 0, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer logFile.Close()
+
+	// Stdin is the null device, so nothing ties the server to the terminal
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return nil, 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	pid := cmd.Process.Pid
+	fmt.Printf("Starting guvnor server in the background (pid %d, log: %s)\n", pid, logPath)
+	deadline := time.After(autoStartTimeout)
+	for {
+		if server := configuredServer(cfg); server != nil {
+			return withToken(server), pid, nil
+		}
+		select {
+		case err := <-exited:
+			if err == nil {
+				err = errors.New("exited")
+			}
+			return nil, 0, fmt.Errorf("server stopped during startup (%v), see %s", err, logPath)
+		case <-deadline:
+			return nil, 0, fmt.Errorf("server did not answer within %s, see %s", autoStartTimeout, logPath)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/cert"
+)
+
+var certExportCmd = &cobra.Command{
+	Use:   "export [domain...]",
+	Short: "Bundle certificates and ACME account keys for another host",
+	Long: `Write the certificates in cert_dir covering the given domains, or all of
+them, to a tar bundle together with the ACME account keys. Install it on the new
+host with "guvnor cert import" so it serves and renews the same certificates
+with the same accounts instead of requesting new ones.
+
+The bundle holds private keys; keep it as safe as the cert_dir itself.`,
+	Example: `  guvnor cert export app.example.com --out bundle.tar
+  guvnor cert export --out all-certs.tar`,
+	Run: runCertExport,
+}
+
+var certImportCmd = &cobra.Command{
+	Use:   "import <bundle.tar>",
+	Short: "Install a bundle written by cert export",
+	Long: `Extract a bundle written by "guvnor cert export" into cert_dir. Files that
+already exist are kept unless --force is given. Use - to read the bundle from
+stdin. Restart a running server afterwards so it serves the imported
+certificates.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runCertImport,
+}
+
+func init() {
+	certExportCmd.Flags().String("out", "", "write the bundle to this file instead of stdout")
+	certImportCmd.Flags().Bool("force", false, "replace certificates and keys that already exist")
+
+	certCmd.AddCommand(certExportCmd)
+	certCmd.AddCommand(certImportCmd)
+}
+
+func runCertExport(cmd *cobra.Command, args []string) {
+	out, _ := cmd.Flags().GetString("out")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if out == "" && isTerminal(os.Stdout) {
+		fmt.Fprintf(os.Stderr, "Error: refusing to write a bundle to the terminal, use --out or redirect stdout\n")
+		os.Exit(1)
+	}
+
+	var bundle bytes.Buffer
+	names, err := cert.Export(cfg.TLS.CertDir, args, &bundle)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		os.Stdout.Write(bundle.Bytes())
+		return
+	}
+	if err := os.WriteFile(out, bundle.Bytes(), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", out, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d files from %s to %s:\n", len(names), cfg.TLS.CertDir, out)
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+}
+
+func runCertImport(cmd *cobra.Command, args []string) {
+	force, _ := cmd.Flags().GetBool("force")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var in io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	imported, skipped, err := cert.Import(cfg.TLS.CertDir, in, force)
+	for _, name := range imported {
+		fmt.Printf("  imported %s\n", name)
+	}
+	for _, name := range skipped {
+		fmt.Printf("  skipped  %s (exists, use --force to replace)\n", name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Imported %d files into %s\n", len(imported), cfg.TLS.CertDir)
+	if len(imported) > 0 {
+		fmt.Println("Restart a running guvnor server to serve the imported certificates.")
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and edit guvnor.yaml",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the configuration the running server uses, secrets redacted",
+	Long: `Print the configuration of the running server as YAML: guvnor.yaml with its
+drop-ins and defaults, or the apps converted from the Procfile. API tokens,
+notification URLs and secret environment variables and headers are redacted.
+
+After editing guvnor.yaml, apply it with: guvnor reload`,
+	Args: cobra.NoArgs,
+	Run:  runConfigShow,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "Set a key in guvnor.yaml, keeping its comments and order",
+	Long: `Set a key in guvnor.yaml. Keys are dotted paths, with apps addressed by name
+or index, and values are parsed as YAML:
+- config set server.http_port 8080
+- config set apps.web.environment.LOG_LEVEL debug
+- config set apps.0.args '["--port", "3000"]'
+- config set -- apps.web.restart_policy.max_retries -1
+
+The edited file is validated before it replaces guvnor.yaml.`,
+	Args: cobra.ExactArgs(2),
+	Run:  runConfigSet,
+}
+
+func init() {
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+func runConfigSet(cmd *cobra.Command, args []string) {
+	key, value := args[0], args[1]
+
+	configPath := "guvnor.yaml"
+	if configFile != "" {
+		configPath = configFile
+	}
+
+	mode := os.FileMode(0644)
+	data, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Failed to read config: %v\n", err)
+		os.Exit(1)
+	}
+	if info, err := os.Stat(configPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	updated, err := config.SetValue(data, key, value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set %s: %v\n", key, err)
+		os.Exit(1)
+	}
+
+	if err := replaceConfig(configPath, updated, mode); err != nil {
+		fmt.Fprintf(os.Stderr, "Not setting %s: %v\n", key, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Set %s in %s\n", key, configPath)
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) {
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+
+	ctx, cancel := clientContext()
+	defer cancel()
+
+	if err := server.GetConfig(ctx, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+}
+
+// replaceConfig loads data from a copy next to path, so relative paths resolve
+// the same, and only replaces path if it is valid
+func replaceConfig(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".guvnor-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if _, err := config.Load(tmp.Name()); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+)
+
+// remote holds the flags selecting a remote server instead of a local one
+var remote struct {
+	host    string
+	token   string
+	context string
+	tls     client.TLSOptions
+}
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "List the connection profiles for remote servers",
+	Long: `Manage named connection profiles (contexts) for guvnor servers on other
+machines, kept in ~/.config/guvnor/contexts.yaml ($GUVNOR_CONTEXTS overrides it).
+Remote servers serve their API over TLS with server.api_remote.
+
+- context                                                  # List contexts, * marks the current one
+- context add prod --host https://prod:9443 --token-env PROD_TOKEN --tls-ca ca.pem
+- context use prod                                         # Commands now manage prod
+- context reset                                            # Back to the servers on this machine
+- context remove prod
+
+Any command also takes --context <name>, or --host with --token and the --tls-*
+flags, to reach a server once:
+
+- status --host https://prod:9443 --token ...`,
+	Args: cobra.NoArgs,
+	Run:  runContextList,
+}
+
+var contextAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add or replace a context from --host, --token and the --tls-* flags",
+	Args:  cobra.ExactArgs(1),
+	Run:   runContextAdd,
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use <name>",
+	Short: "Manage the server of a context from now on",
+	Args:  cobra.ExactArgs(1),
+	Run:   runContextUse,
+}
+
+var contextResetCmd = &cobra.Command{
+	Use:   "reset",
+	Short: "Manage the servers on this machine again",
+	Args:  cobra.NoArgs,
+	Run:   runContextReset,
+}
+
+var contextRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a context",
+	Args:  cobra.ExactArgs(1),
+	Run:   runContextRemove,
+}
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&remote.host, "host", "", "manage the server whose API is at this URL, e.g. https://server:9443")
+	flags.StringVar(&remote.token, "token", "", "management API token (default $"+client.TokenEnv+")")
+	flags.StringVar(&remote.context, "context", "", "manage the server of this context of the contexts file")
+	flags.StringVar(&remote.tls.CAFile, "tls-ca", "", "trust the CA certificates in this PEM file for --host")
+	flags.StringVar(&remote.tls.ServerName, "tls-server-name", "", "name the certificate of --host must be valid for")
+	flags.BoolVar(&remote.tls.InsecureSkipVerify, "tls-insecure", false, "accept any certificate from --host (testing only)")
+	flags.StringVar(&remote.tls.CertFile, "tls-cert", "", "client certificate presented to --host")
+	flags.StringVar(&remote.tls.KeyFile, "tls-key", "", "private key of --tls-cert")
+
+	contextAddCmd.Flags().String("token-env", "", "read the token from this environment variable when connecting, instead of storing it")
+	contextCmd.AddCommand(contextAddCmd, contextUseCmd, contextResetCmd, contextRemoveCmd)
+	rootCmd.AddCommand(contextCmd)
+}
+
+// remoteServer returns a client for the remote server selected by --host,
+// --context or the current context, and false when none is selected
+func remoteServer() (*client.Client, bool, error) {
+	if remote.host != "" {
+		c, err := client.NewRemoteClient(remote.host, remote.token, remote.tls)
+		return c, true, err
+	}
+
+	name := remote.context
+	if name == "" {
+		contexts, err := client.LoadContexts(client.ContextsPath())
+		if err != nil {
+			return nil, true, err
+		}
+		if name = contexts.Current; name == "" {
+			return nil, false, nil
+		}
+	}
+	profile, err := contextProfile(name)
+	if err != nil {
+		return nil, true, err
+	}
+	if remote.token != "" {
+		profile.Token, profile.TokenEnv = remote.token, ""
+	}
+	c, err := profile.Client()
+	return c, true, err
+}
+
+// contextProfile returns the profile of a context
+func contextProfile(name string) (client.Profile, error) {
+	path := client.ContextsPath()
+	contexts, err := client.LoadContexts(path)
+	if err != nil {
+		return client.Profile{}, err
+	}
+	profile, exists := contexts.Get(name)
+	if !exists {
+		return client.Profile{}, fmt.Errorf("context %s is not defined in %s (add it with: guvnor context add %s --host ...)", name, path, name)
+	}
+	return profile, nil
+}
+
+// loadContexts reads the contexts file, exiting on errors
+func loadContexts() (*client.Contexts, string) {
+	path := client.ContextsPath()
+	if path == "" {
+		fmt.Fprintf(os.Stderr, "Error: no home directory for the contexts file, set %s\n", client.ContextsEnv)
+		os.Exit(1)
+	}
+	contexts, err := client.LoadContexts(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return contexts, path
+}
+
+// saveContexts writes the contexts file, exiting on errors
+func saveContexts(contexts *client.Contexts, path string) {
+	if err := contexts.Save(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runContextList(cmd *cobra.Command, args []string) {
+	contexts, path := loadContexts()
+	if len(contexts.Profiles) == 0 {
+		fmt.Printf("No contexts in %s, add one with: guvnor context add <name> --host https://server:9443\n", path)
+		return
+	}
+
+	fmt.Printf("  %-16s %s\n", "NAME", "HOST")
+	for _, profile := range contexts.Profiles {
+		marker := " "
+		if profile.Name == contexts.Current {
+			marker = "*"
+		}
+		fmt.Printf("%s %-16s %s\n", marker, profile.Name, profile.Host)
+	}
+	if contexts.Current == "" {
+		fmt.Println("\nNo current context: commands manage the servers on this machine")
+	}
+}
+
+func runContextAdd(cmd *cobra.Command, args []string) {
+	tokenEnv, _ := cmd.Flags().GetString("token-env")
+	if remote.host == "" {
+		fmt.Fprintf(os.Stderr, "Error: --host is required\n")
+		os.Exit(1)
+	}
+	if remote.token != "" && tokenEnv != "" {
+		fmt.Fprintf(os.Stderr, "Error: pass --token or --token-env, not both\n")
+		os.Exit(1)
+	}
+
+	contexts, path := loadContexts()
+	profile := client.Profile{
+		Name:               args[0],
+		Host:               remote.host,
+		Token:              remote.token,
+		TokenEnv:           tokenEnv,
+		CAFile:             remote.tls.CAFile,
+		ServerName:         remote.tls.ServerName,
+		InsecureSkipVerify: remote.tls.InsecureSkipVerify,
+		CertFile:           remote.tls.CertFile,
+		KeyFile:            remote.tls.KeyFile,
+	}
+	// Checks the host and TLS files; the token may only be set later
+	if _, err := client.NewRemoteClient(profile.Host, "", profile.TLSOptions()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := contexts.Set(profile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	saveContexts(contexts, path)
+	fmt.Printf("Context %s saved in %s, use it with: guvnor context use %s\n", profile.Name, path, profile.Name)
+}
+
+func runContextUse(cmd *cobra.Command, args []string) {
+	contexts, path := loadContexts()
+	profile, exists := contexts.Get(args[0])
+	if !exists {
+		fmt.Fprintf(os.Stderr, "Error: context %s is not defined in %s\n", args[0], path)
+		os.Exit(1)
+	}
+	contexts.Current = profile.Name
+	saveContexts(contexts, path)
+	fmt.Printf("Managing %s (%s)\n", profile.Name, profile.Host)
+}
+
+func runContextReset(cmd *cobra.Command, args []string) {
+	contexts, path := loadContexts()
+	contexts.Current = ""
+	saveContexts(contexts, path)
+	fmt.Println("Managing the servers on this machine")
+}
+
+func runContextRemove(cmd *cobra.Command, args []string) {
+	contexts, path := loadContexts()
+	if !contexts.Remove(args[0]) {
+		fmt.Fprintf(os.Stderr, "Error: context %s is not defined in %s\n", args[0], path)
+		os.Exit(1)
+	}
+	saveContexts(contexts, path)
+	fmt.Printf("Context %s removed\n", args[0])
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/crash"
+)
+
+var crashesCmd = &cobra.Command{
+	Use:   "crashes [app]",
+	Short: "List the crash reports of failed apps",
+	Long: `When an app fails, crash-loops or crashes without a restart policy, the server
+saves a crash report: its last log lines, exit code or signal, environment
+with secrets redacted, restart history and system metrics, in the crashes
+directory of the state directory (server.crash_reports).
+
+- crashes                                 # Every report, newest first
+- crashes web                             # Reports of 'web' and its instances
+- crashes show 20250914-210312-web.2      # One report and its log lines
+
+Reports are read from disk, so this works without a running server.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runCrashes,
+}
+
+var crashesShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a crash report and its log lines",
+	Args:  cobra.ExactArgs(1),
+	Run:   runCrashesShow,
+}
+
+func init() {
+	crashesShowCmd.Flags().Bool("json", false, "print the report as JSON, without the log lines")
+	crashesCmd.AddCommand(crashesShowCmd)
+	rootCmd.AddCommand(crashesCmd)
+}
+
+// crashStore opens the crash report directory of the config
+func crashStore() *crash.Store {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	return crash.NewStore(cfg.Server.CrashDir(), 0)
+}
+
+// crashExit describes how a process exited
+func crashExit(report crash.Report) string {
+	switch {
+	case report.Signal != "":
+		return "signal " + report.Signal
+	case report.ExitCode >= 0:
+		return fmt.Sprintf("code %d", report.ExitCode)
+	}
+	return "unknown"
+}
+
+func runCrashes(cmd *cobra.Command, args []string) {
+	store := crashStore()
+	reports, err := store.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(args) == 1 {
+		matching := reports[:0]
+		for _, report := range reports {
+			if report.App == args[0] || report.Instance == args[0] {
+				matching = append(matching, report)
+			}
+		}
+		reports = matching
+	}
+
+	if len(reports) == 0 {
+		fmt.Printf("No crash reports in %s\n", store.Dir())
+		return
+	}
+	fmt.Printf("%-36s %-15s %-10s %-16s %s\n", "ID", "INSTANCE", "REASON", "EXIT", "TIME")
+	for _, report := range reports {
+		fmt.Printf("%-36s %-15s %-10s %-16s %s\n", report.ID, report.Instance, report.Reason,
+			crashExit(report), report.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("\nShow one with: guvnor crashes show <id>\n")
+}
+
+func runCrashesShow(cmd *cobra.Command, args []string) {
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	store := crashStore()
+	report, err := store.Load(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Printf("Crash report %s\n", report.ID)
+	fmt.Printf("  Instance:  %s (%s)\n", report.Instance, report.App)
+	fmt.Printf("  Time:      %s\n", report.Time.Local().Format(time.RFC3339))
+	fmt.Printf("  Reason:    %s\n", report.Reason)
+	if report.Message != "" {
+		fmt.Printf("             %s\n", report.Message)
+	}
+	fmt.Printf("  Exit:      %s\n", crashExit(report))
+	if report.PID > 0 {
+		fmt.Printf("  PID:       %d\n", report.PID)
+	}
+	if report.Error != "" {
+		fmt.Printf("  Error:     %s\n", report.Error)
+	}
+	if report.CoreDump != "" {
+		fmt.Printf("  Core dump: %s\n", report.CoreDump)
+	}
+	if report.Command != "" {
+		fmt.Printf("  Command:   %s\n", report.Command)
+	}
+	if report.WorkingDir != "" {
+		fmt.Printf("  Directory: %s\n", report.WorkingDir)
+	}
+	fmt.Printf("  Restarts:  %d\n", report.Restarts)
+	for _, at := range report.RestartHistory {
+		fmt.Printf("             %s\n", at.Local().Format(time.RFC3339))
+	}
+	if report.Usage != nil {
+		fmt.Printf("  Usage:     %.1f%% CPU, %s RSS (%s)\n", report.Usage.TreeCPUPercent,
+			formatBytes(report.Usage.TreeRSS), report.Usage.SampledAt.Local().Format(time.RFC3339))
+	}
+
+	system := report.System
+	fmt.Printf("\nSystem: %s (%s/%s, %d CPUs)\n", system.Hostname, system.OS, system.Arch, system.CPUs)
+	if len(system.LoadAverage) == 3 {
+		fmt.Printf("  Load:      %.2f %.2f %.2f\n", system.LoadAverage[0], system.LoadAverage[1], system.LoadAverage[2])
+	}
+	if system.MemoryTotal > 0 {
+		fmt.Printf("  Memory:    %s available of %s\n", formatBytes(system.MemoryAvailable), formatBytes(system.MemoryTotal))
+	}
+
+	if len(report.Environment) > 0 {
+		keys := make([]string, 0, len(report.Environment))
+		for key := range report.Environment {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fmt.Printf("\nEnvironment:\n")
+		for _, key := range keys {
+			fmt.Printf("  %s=%s\n", key, report.Environment[key])
+		}
+	}
+
+	fmt.Printf("\nLast %d log lines:\n", report.LogLines)
+	lines, err := os.ReadFile(store.LogsPath(report.ID))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(lines)
+}
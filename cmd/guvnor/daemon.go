@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// pidFileName is the server's PID file in the state directory
+const pidFileName = "guvnor.pid"
+
+// defaultDaemonStopTimeout is how long daemon stop waits for the server to stop its apps and exit
+const defaultDaemonStopTimeout = time.Minute
+
+// Exit codes of daemon status, as for LSB init scripts
+const (
+	statusDeadWithPIDFile = 1
+	statusNotRunning      = 3
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run the server in the background and control it",
+	Long: `Run the guvnor server of the config in the current directory in the
+background, detached from the terminal, and control it through its PID file,
+guvnor.pid in the state directory. The server log is appended to server.log
+next to it.
+
+- daemon start      # Same as guvnor start --daemon
+- daemon status     # Whether it runs, its PID and log (exits 3 when stopped)
+- daemon stop       # Stop the server and its apps, and wait for it to exit
+- daemon restart    # Stop it and start it again
+
+Any guvnor start writes the PID file, so these work for a server started in
+the foreground too. Under systemd or another supervisor, run guvnor start
+in the foreground instead.`,
+}
+
+var daemonStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the server in the background",
+	Args:  cobra.NoArgs,
+	Run:   runDaemonStart,
+}
+
+var daemonStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show whether the background server is running",
+	Args:  cobra.NoArgs,
+	Run:   runDaemonStatus,
+}
+
+var daemonStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the background server and its apps",
+	Args:  cobra.NoArgs,
+	Run:   runDaemonStop,
+}
+
+var daemonRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Stop the background server and start it again",
+	Args:  cobra.NoArgs,
+	Run:   runDaemonRestart,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{daemonStopCmd, daemonRestartCmd} {
+		cmd.Flags().Duration("timeout", defaultDaemonStopTimeout, "how long to wait for the server to exit")
+	}
+	daemonCmd.AddCommand(daemonStartCmd, daemonStatusCmd, daemonStopCmd, daemonRestartCmd)
+	rootCmd.AddCommand(daemonCmd)
+}
+
+func runDaemonStart(cmd *cobra.Command, args []string) {
+	daemonize(loadDaemonConfig(), []string{"start"})
+}
+
+func runDaemonStatus(cmd *cobra.Command, args []string) {
+	cfg := loadDaemonConfig()
+	pidPath := cfg.Server.StatePath(pidFileName)
+	pid, err := serverPID(cfg)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Println("guvnor is not running")
+		os.Exit(statusNotRunning)
+	case errors.Is(err, errStalePIDFile):
+		fmt.Printf("guvnor is not running, but its PID file %s names pid %d (it crashed or was killed, see %s)\n",
+			pidPath, pid, cfg.Server.StatePath("server.log"))
+		os.Exit(statusDeadWithPIDFile)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("guvnor is running (pid %d)\n", pid)
+	if configuredServer(cfg) != nil {
+		fmt.Printf("  API:  port %d\n", api.GetManagementPort(cfg.Server.HTTPPort))
+	} else {
+		fmt.Println("  API:  not answering (starting up, or stuck)")
+	}
+	fmt.Printf("  Log:  %s\n", cfg.Server.StatePath("server.log"))
+}
+
+func runDaemonStop(cmd *cobra.Command, args []string) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if err := stopDaemon(loadDaemonConfig(), timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func runDaemonRestart(cmd *cobra.Command, args []string) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	cfg := loadDaemonConfig()
+	if err := stopDaemon(cfg, timeout); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	daemonize(cfg, []string{"start"})
+}
+
+// loadDaemonConfig loads the config or exits
+func loadDaemonConfig() *config.Config {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// daemonize runs guvnor with args, a start command, as a background server
+// and returns once its management API answers
+func daemonize(cfg *config.Config, args []string) {
+	if configuredServer(cfg) != nil {
+		fmt.Fprintln(os.Stderr, "Error: guvnor is already running for this config (see: guvnor daemon status)")
+		os.Exit(1)
+	}
+	if configFile != "" {
+		args = append(args, "--config", configFile)
+	}
+	_, pid, err := spawnServer(cfg, args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to start guvnor server: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Server running (pid %d), stop it with: guvnor daemon stop\n", pid)
+}
+
+// daemonArgs returns the arguments guvnor was run with, without --daemon, for
+// the server started in the background
+func daemonArgs() []string {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg == "--daemon" || strings.HasPrefix(arg, "--daemon=") {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// stopDaemon asks the server in the PID file to stop and waits for it to
+// exit. A server that is not running is not an error.
+func stopDaemon(cfg *config.Config, timeout time.Duration) error {
+	pidPath := cfg.Server.StatePath(pidFileName)
+	pid, err := serverPID(cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("guvnor is not running")
+		return nil
+	}
+	if errors.Is(err, errStalePIDFile) {
+		// The PID may belong to another process by now, which is left alone
+		fmt.Printf("guvnor is not running, removing the stale PID file %s\n", pidPath)
+		removePIDFile(pidPath, pid)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Stopping guvnor (pid %d)...\n", pid)
+	if err := terminateServer(cfg, pid); err != nil {
+		return fmt.Errorf("failed to stop pid %d: %w", pid, err)
+	}
+	deadline := time.Now().Add(timeout)
+	for process.Alive(pid) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("pid %d still running after %s, see %s", pid, timeout, cfg.Server.StatePath("server.log"))
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	// A server killed before cleaning up leaves its PID file behind
+	removePIDFile(pidPath, pid)
+	fmt.Println("Stopped")
+	return nil
+}
+
+// errStalePIDFile is returned for a PID file whose server is gone
+var errStalePIDFile = errors.New("stale PID file")
+
+// serverPID returns the PID of the server in the PID file of the state
+// directory. The error is os.ErrNotExist without a PID file, and
+// errStalePIDFile, with the PID, when the PID is not a running guvnor server,
+// such as after a crash or a reboot that gave the PID to another process.
+func serverPID(cfg *config.Config) (int, error) {
+	pid, err := readPIDFile(cfg.Server.StatePath(pidFileName))
+	if err != nil {
+		return 0, err
+	}
+	if !isServer(cfg, pid) {
+		return pid, errStalePIDFile
+	}
+	return pid, nil
+}
+
+// isServer reports whether pid is the guvnor server of cfg: the management
+// API answers with that PID or, when it does not answer, the process runs a
+// guvnor executable
+func isServer(cfg *config.Config, pid int) bool {
+	if !process.Alive(pid) {
+		return false
+	}
+	if server := configuredServer(cfg); server != nil {
+		if answered, ok := server.PID(); ok {
+			return answered == pid
+		}
+	}
+	exe, err := process.Executable(pid)
+	if err != nil {
+		return true // Cannot tell, and the PID is in use
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return true
+	}
+	return sameExecutable(exe, self)
+}
+
+// sameExecutable compares executables by file name, so a server started by
+// an earlier build or through a symlink still counts
+func sameExecutable(a, b string) bool {
+	name := func(path string) string {
+		path = strings.TrimSuffix(path, " (deleted)") // Linux, for a binary replaced since it started
+		return strings.TrimSuffix(strings.ToLower(filepath.Base(path)), ".exe")
+	}
+	return name(a) == name(b)
+}
+
+// writePIDFile records this process as the server of the state directory
+func writePIDFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+}
+
+// readPIDFile returns the PID in a PID file
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
+
+// removePIDFile removes a PID file unless another server has replaced it
+func removePIDFile(path string, pid int) {
+	if current, err := readPIDFile(path); err == nil && current == pid {
+		os.Remove(path)
+	}
+}
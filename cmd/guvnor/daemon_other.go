@@ -0,0 +1,14 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// terminateServer asks the server to stop its apps and exit
+func terminateServer(cfg *config.Config, pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// testDaemonConfig returns a config whose state directory is empty and whose
+// management API, unless apiURL is set, is a port nothing listens on
+func testDaemonConfig(t *testing.T, apiURL string) *config.Config {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Server.StateDir = t.TempDir()
+	cfg.Server.APISocket.Disabled = true
+
+	if apiURL == "" {
+		server := httptest.NewServer(http.NotFoundHandler())
+		apiURL = server.URL
+		server.Close()
+	}
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	cfg.Server.HTTPPort = port - 1000 // The management API listens 1000 above
+	return cfg
+}
+
+func writeTestPIDFile(t *testing.T, cfg *config.Config, pid int) string {
+	t.Helper()
+	path := cfg.Server.StatePath(pidFileName)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// startSleep starts a process that is not guvnor, stopped when the test ends
+func startSleep(t *testing.T) *exec.Cmd {
+	t.Helper()
+	path, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not available")
+	}
+	cmd := exec.Command(path, "30")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	return cmd
+}
+
+func TestReadPIDFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		content string
+		pid     int
+		valid   bool
+	}{
+		{"1234\n", 1234, true},
+		{"  42  ", 42, true},
+		{"", 0, false},
+		{"0\n", 0, false},
+		{"-7\n", 0, false},
+		{"guvnor\n", 0, false},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, fmt.Sprintf("%d.pid", i))
+		os.WriteFile(path, []byte(tt.content), 0644)
+		pid, err := readPIDFile(path)
+		if (err == nil) != tt.valid || pid != tt.pid {
+			t.Errorf("%q: expected pid %d (valid %v), got %d (%v)", tt.content, tt.pid, tt.valid, pid, err)
+		}
+	}
+
+	if _, err := readPIDFile(filepath.Join(dir, "missing.pid")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected os.ErrNotExist for a missing PID file, got %v", err)
+	}
+}
+
+func TestWriteAndRemovePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", pidFileName)
+	if err := writePIDFile(path); err != nil {
+		t.Fatalf("writePIDFile: %v", err)
+	}
+	if pid, err := readPIDFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("Expected our pid %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+
+	// A server started since has replaced the file
+	removePIDFile(path, os.Getpid()+1)
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the PID file of another server to be kept: %v", err)
+	}
+	removePIDFile(path, os.Getpid())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the PID file to be removed, got %v", err)
+	}
+	removePIDFile(path, os.Getpid()) // Already gone
+}
+
+func TestDaemonArgs(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	tests := []struct {
+		args     string
+		expected string
+	}{
+		{"guvnor start --daemon", "start"},
+		{"guvnor start --daemon=true --config prod.yaml", "start --config prod.yaml"},
+		{"guvnor --config prod.yaml start", "--config prod.yaml start"},
+		{"guvnor start --daemonize-hooks", "start --daemonize-hooks"},
+	}
+	for _, tt := range tests {
+		os.Args = strings.Fields(tt.args)
+		if got := strings.Join(daemonArgs(), " "); got != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.args, tt.expected, got)
+		}
+	}
+}
+
+func TestSameExecutable(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"/usr/local/bin/guvnor", "/home/dev/go/bin/guvnor", true},
+		{"/usr/local/bin/guvnor (deleted)", "/usr/local/bin/guvnor", true},
+		{"/mnt/c/Tools/GUVNOR.EXE", "/mnt/c/guvnor/guvnor.exe", true},
+		{"/usr/bin/sleep", "/usr/local/bin/guvnor", false},
+	}
+	for _, tt := range tests {
+		if got := sameExecutable(tt.a, tt.b); got != tt.same {
+			t.Errorf("sameExecutable(%q, %q) = %v, expected %v", tt.a, tt.b, got, tt.same)
+		}
+	}
+}
+
+func TestServerPID(t *testing.T) {
+	t.Run("no PID file", func(t *testing.T) {
+		if _, err := serverPID(testDaemonConfig(t, "")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+	})
+
+	t.Run("exited server", func(t *testing.T) {
+		cfg := testDaemonConfig(t, "")
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		if err := cmd.Run(); err != nil {
+			t.Fatal(err)
+		}
+		writeTestPIDFile(t, cfg, cmd.Process.Pid)
+		if pid, err := serverPID(cfg); !errors.Is(err, errStalePIDFile) || pid != cmd.Process.Pid {
+			t.Errorf("Expected a stale PID file naming %d, got %d (%v)", cmd.Process.Pid, pid, err)
+		}
+	})
+
+	t.Run("PID reused by another program", func(t *testing.T) {
+		cfg := testDaemonConfig(t, "")
+		sleep := startSleep(t)
+		writeTestPIDFile(t, cfg, sleep.Process.Pid)
+		if _, err := serverPID(cfg); !errors.Is(err, errStalePIDFile) {
+			t.Errorf("Expected a stale PID file for sleep, got %v", err)
+		}
+	})
+
+	t.Run("running server", func(t *testing.T) {
+		// The test binary stands in for the guvnor executable
+		cfg := testDaemonConfig(t, "")
+		writeTestPIDFile(t, cfg, os.Getpid())
+		if pid, err := serverPID(cfg); err != nil || pid != os.Getpid() {
+			t.Errorf("Expected pid %d, got %d (%v)", os.Getpid(), pid, err)
+		}
+	})
+
+	t.Run("API answers with another PID", func(t *testing.T) {
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"status": "ok", "pid": "%d"}`, os.Getpid()+1)
+		}))
+		defer api.Close()
+		cfg := testDaemonConfig(t, api.URL)
+		writeTestPIDFile(t, cfg, os.Getpid())
+		if _, err := serverPID(cfg); !errors.Is(err, errStalePIDFile) {
+			t.Errorf("Expected the API's PID to win over the executable, got %v", err)
+		}
+	})
+}
+
+func TestStopDaemonStalePIDFile(t *testing.T) {
+	cfg := testDaemonConfig(t, "")
+	sleep := startSleep(t)
+	path := writeTestPIDFile(t, cfg, sleep.Process.Pid)
+
+	if err := stopDaemon(cfg, time.Second); err != nil {
+		t.Fatalf("stopDaemon: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale PID file to be removed, got %v", err)
+	}
+	if !process.Alive(sleep.Process.Pid) {
+		t.Error("Expected the process now holding the PID to be left alone")
+	}
+}
@@ -0,0 +1,27 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// terminateServer stops the apps through the management API, then kills the
+// server: a detached process has no console to receive Ctrl+Break, and apps
+// outlive a killed server so the next one can adopt them.
+func terminateServer(cfg *config.Config, pid int) error {
+	if server := configuredServer(cfg); server != nil {
+		ctx, cancel := clientContext()
+		defer cancel()
+		if _, err := withToken(server).StopProcesses(ctx, nil); err != nil {
+			return err
+		}
+	}
+	server, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return server.Kill()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy",
+	Short: "Suspend automatic restarts while replacing an app",
+	Long: `Deploy mode suspends restart policies and health-check restarts of an app
+(every instance) while you stop or replace it yourself, so guvnor does not
+restart it behind your back. It ends by itself after a timeout.
+
+- deploy                                  # Apps in deploy mode
+- deploy begin web --timeout 10m          # Suspend restarts of 'web' for 10 minutes
+- deploy end web                          # Resume them now
+
+Processes that crashed during deploy mode and were not started again are
+restarted when it ends.`,
+	Args: cobra.NoArgs,
+	Run:  runDeploys,
+}
+
+var deployBeginCmd = &cobra.Command{
+	Use:   "begin <app>",
+	Short: "Put an app in deploy mode",
+	Args:  cobra.ExactArgs(1),
+	Run:   runDeployBegin,
+}
+
+var deployEndCmd = &cobra.Command{
+	Use:   "end <app>",
+	Short: "Take an app out of deploy mode",
+	Args:  cobra.ExactArgs(1),
+	Run:   runDeployEnd,
+}
+
+func init() {
+	deployBeginCmd.Flags().Duration("timeout", process.DefaultDeployTimeout, "end deploy mode after this long")
+	deployBeginCmd.Flags().String("reason", "", "why the app is in deploy mode, shown in the list")
+	deployCmd.AddCommand(deployBeginCmd)
+	deployCmd.AddCommand(deployEndCmd)
+	rootCmd.AddCommand(deployCmd)
+}
+
+func runDeploys(cmd *cobra.Command, args []string) {
+	ctx, cancel := clientContext()
+	defer cancel()
+	deploys, err := deployClient().Deploys(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to list deploys: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+
+	if len(deploys) == 0 {
+		fmt.Println("No apps in deploy mode")
+		return
+	}
+	fmt.Printf("%-20s %-10s %-10s %s\n", "APP", "SINCE", "ENDS IN", "REASON")
+	for _, deploy := range deploys {
+		fmt.Printf("%-20s %-10s %-10s %s\n", deploy.App, deploy.Since.Format("15:04:05"),
+			time.Until(deploy.Until).Round(time.Second), deploy.Reason)
+	}
+}
+
+func runDeployBegin(cmd *cobra.Command, args []string) {
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	reason, _ := cmd.Flags().GetString("reason")
+
+	ctx, cancel := clientContext()
+	defer cancel()
+	deploy, err := deployClient().BeginDeploy(ctx, args[0], timeout, reason)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to begin deploy mode for %s: %s\n", args[0], describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("%s is in deploy mode until %s, automatic restarts are suspended\n", deploy.App, deploy.Until.Format("15:04:05"))
+	fmt.Printf("End it when done with: guvnor deploy end %s\n", deploy.App)
+}
+
+func runDeployEnd(cmd *cobra.Command, args []string) {
+	ctx, cancel := clientContext()
+	defer cancel()
+	deploy, err := deployClient().EndDeploy(ctx, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to end deploy mode for %s: %s\n", args[0], describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("Deploy mode of %s ended after %s, automatic restarts resumed\n", deploy.App, time.Since(deploy.Since).Round(time.Second))
+}
+
+// deployClient connects to the running server, which keeps deploy mode
+func deployClient() *client.Client {
+	return requireServer("Deploy mode is kept by the server, start it with: guvnor start")
+}
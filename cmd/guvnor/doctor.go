@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/doctor"
+	"github.com/gleicon/guvnor/internal/tlsaudit"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems with this machine and guvnor.yaml",
+	Long: `Check the environment the server of guvnor.yaml runs in, and suggest a fix
+for each problem found:
+
+- http/https port   the ports can be listened on (privileges, another server)
+- dns               public hostnames served over TLS resolve to this machine
+- acme              the ACME directory certificates come from answers
+- clock             the clock agrees with the ACME server's
+- open files        the open file limit leaves room for connections
+- containers        Docker or Podman answers, when apps run in containers
+- server/app pids   PID files left by a server or apps that are gone
+
+The command exits with status 1 when a check fails; warnings point at things
+that work today but are likely to break.`,
+	Args: cobra.NoArgs,
+	Run:  runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().String("resolver", "", "DNS server to resolve hostnames through (default: tls.audit.resolver or "+tlsaudit.DefaultResolver+")")
+	doctorCmd.Flags().Bool("json", false, "print the checks as JSON")
+
+	rootCmd.AddCommand(doctorCmd)
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	resolver, _ := cmd.Flags().GetString("resolver")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	if resolver == "" {
+		resolver = cfg.TLS.Audit.Resolver
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	d := &doctor.Doctor{
+		Config:        cfg,
+		ServerRunning: configuredServer(cfg) != nil,
+		PIDFile:       cfg.Server.StatePath(pidFileName),
+		Resolver:      resolver,
+	}
+	checks := d.Run(ctx)
+
+	if asJSON {
+		data, err := json.MarshalIndent(checks, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode checks: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		printDoctorChecks(checks)
+	}
+
+	if doctor.Failed(checks) {
+		os.Exit(1)
+	}
+}
+
+func printDoctorChecks(checks []doctor.Check) {
+	width := 12
+	for _, check := range checks {
+		width = max(width, len(check.Name))
+	}
+
+	counts := make(map[doctor.Status]int)
+	for _, check := range checks {
+		counts[check.Status]++
+		marker := "\033[32m✓\033[0m"
+		switch check.Status {
+		case doctor.StatusWarn:
+			marker = "\033[33m!\033[0m"
+		case doctor.StatusFail:
+			marker = "\033[31m✗\033[0m"
+		case doctor.StatusSkip:
+			marker = "-"
+		}
+		fmt.Printf("  %s %-*s %s\n", marker, width, check.Name, check.Detail)
+		if check.Fix != "" {
+			fmt.Printf("    %-*s Fix: %s\n", width, "", check.Fix)
+		}
+	}
+
+	switch {
+	case counts[doctor.StatusFail] > 0:
+		fmt.Printf("\n%d failed, %d with warnings: fix the failed checks first\n",
+			counts[doctor.StatusFail], counts[doctor.StatusWarn])
+	case counts[doctor.StatusWarn] > 0:
+		fmt.Printf("\nNo failures, %d with warnings\n", counts[doctor.StatusWarn])
+	default:
+		fmt.Println("\nNo problems found")
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+	"github.com/gleicon/guvnor/internal/procfile"
+	"github.com/gleicon/guvnor/internal/proxy"
+	"github.com/gleicon/guvnor/internal/secrets"
+	"github.com/gleicon/guvnor/internal/server"
+)
+
+// plannedServer returns a server for cfg that is only inspected, never
+// started; its Procfile conversion is not logged
+func plannedServer(cfg *config.Config, pf *procfile.Procfile, only []string) *server.Server {
+	if pf == nil {
+		pf = &procfile.Procfile{}
+	}
+	quiet := logrus.New()
+	quiet.SetLevel(logrus.WarnLevel)
+	srv := server.New(cfg, pf, quiet)
+	if len(only) > 0 {
+		srv.OnlyApps(only...)
+	}
+	return srv
+}
+
+// runDryRun prints what guvnor start would run: the listeners, and for every
+// app its command, environment with secrets redacted, port and route
+func runDryRun(cfg *config.Config, pf *procfile.Procfile, only []string) {
+	srv := plannedServer(cfg, pf, only)
+	apps, err := srv.Apps()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	listeners, err := srv.Listeners()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("Dry run, nothing is started")
+	fmt.Println("\nServer:")
+	for _, listener := range listeners {
+		if !strings.HasPrefix(listener.Name, "app ") {
+			fmt.Printf("  %-22s %s/%s\n", listener.Name, listener.Address, listener.Network)
+		}
+	}
+
+	failed := false
+	for _, app := range apps {
+		fmt.Printf("\n%s:\n", app.Name)
+		if app.Container.Enabled() {
+			image := app.Container.Image
+			if app.Container.Build != "" {
+				image = "built from " + app.Container.Build
+			}
+			fmt.Printf("  %-10s %s\n", "container", image)
+			if app.Shell {
+				fmt.Printf("  %-10s %s\n", "command", quoteArgs([]string{"/bin/sh", "-c", app.CommandLine()}))
+			} else if app.Command != "" {
+				fmt.Printf("  %-10s %s\n", "command", quoteArgs(append([]string{app.Command}, app.Args...)))
+			}
+		} else {
+			fmt.Printf("  %-10s %s\n", "command", quoteArgs(process.Argv(app)))
+		}
+		dir := app.WorkingDir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		fmt.Printf("  %-10s %s\n", "directory", dir)
+		if app.Port > 0 {
+			fmt.Printf("  %-10s %d\n", "port", app.Port)
+		}
+		if route := appRoute(cfg, app); route != "" {
+			fmt.Printf("  %-10s %s\n", "route", route)
+		}
+
+		env, err := process.Environment(app)
+		if err != nil {
+			fmt.Printf("  %-10s %v\n", "env", err)
+			failed = true
+			continue
+		}
+		names := make([]string, 0, len(env))
+		for name := range env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i, name := range names {
+			label := ""
+			if i == 0 {
+				label = "env"
+			}
+			value := env[name]
+			if !secrets.IsReference(value) {
+				value = config.RedactValue(name, value)
+			}
+			fmt.Printf("  %-10s %s=%s\n", label, name, value)
+		}
+	}
+
+	if catchAll := catchAllRoute(cfg.Server.CatchAll); catchAll != "" {
+		fmt.Printf("\nOther hostnames: %s\n", catchAll)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// appRoute describes the hostname the proxy routes to app
+func appRoute(cfg *config.Config, app config.AppConfig) string {
+	host := app.Hostname
+	if host == "" {
+		host = app.Domain
+	}
+	// Hostnames generated for Procfile processes carry the HTTP port
+	host, _, _ = strings.Cut(host, ":")
+	if host == "" {
+		return ""
+	}
+	if app.TLS.Passthrough {
+		return fmt.Sprintf("%s (TLS passthrough) -> 127.0.0.1:%d", host, app.Port)
+	}
+
+	scheme, port := "http", cfg.Server.HTTPPort
+	if cfg.TLS.Enabled {
+		scheme, port = "https", cfg.Server.HTTPSPort
+	}
+	url := scheme + "://" + host
+	if !(scheme == "http" && port == 80) && !(scheme == "https" && port == 443) {
+		url += ":" + strconv.Itoa(port)
+	}
+	if app.Port <= 0 {
+		return url
+	}
+	return fmt.Sprintf("%s -> 127.0.0.1:%d", url, app.Port)
+}
+
+// catchAllRoute describes what requests for hostnames no app serves get
+func catchAllRoute(catchAll config.CatchAllConfig) string {
+	switch catchAll.Action {
+	case config.CatchAllApp:
+		return "served by " + catchAll.App
+	case config.CatchAllRedirect:
+		return "redirected to " + catchAll.URL
+	case config.CatchAllDrop:
+		return "dropped without a response"
+	}
+	return ""
+}
+
+// quoteArgs joins a command line, quoting the words that need it
+func quoteArgs(argv []string) string {
+	words := make([]string, len(argv))
+	for i, word := range argv {
+		words[i] = word
+		if word == "" || strings.ContainsAny(word, " \t\n\"'\\$`") {
+			words[i] = strconv.Quote(word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// validateListeners checks that no two listeners of the server and its apps
+// share a port, and that each can be opened
+func validateListeners(report *validationReport, cfg *config.Config, pf *procfile.Procfile) {
+	listeners, err := plannedServer(cfg, pf, nil).Listeners()
+	if err != nil {
+		report.add("ports", levelError, err.Error(), "")
+		return
+	}
+
+	for i, listener := range listeners {
+		for _, other := range listeners[:i] {
+			if listener.Overlaps(other) {
+				report.add("ports", levelError, fmt.Sprintf("%s and %s both listen on %s/%s",
+					other.Name, listener.Name, listener.Address, listener.Network), "")
+			}
+		}
+	}
+
+	// A running server holds the ports it would open again
+	if configuredServer(cfg) != nil {
+		report.add("ports", levelOK, "Ports held by the running guvnor server, not checked", "")
+		return
+	}
+	free := 0
+	for _, listener := range listeners {
+		err := listener.Check()
+		if err == nil {
+			free++
+			continue
+		}
+		_, portText, _ := net.SplitHostPort(listener.Address)
+		port, _ := strconv.Atoi(portText)
+		fix := ""
+		switch bindErr := (&proxy.BindError{Listener: listener.Name, Port: port, Err: err}); {
+		case bindErr.Privileged():
+			fix = fmt.Sprintf("Port %d is privileged: run guvnor with sudo or grant it cap_net_bind_service", port)
+		case bindErr.InUse():
+			fix = fmt.Sprintf("Another process is listening on port %d, find it with: lsof -i :%d", port, port)
+		}
+		report.add("ports", levelError, fmt.Sprintf("%s cannot listen on %s/%s: %v",
+			listener.Name, listener.Address, listener.Network, err), fix)
+	}
+	if free == len(listeners) {
+		report.add("ports", levelOK, fmt.Sprintf("Ports (%d listeners, all available)", len(listeners)), "")
+	}
+}
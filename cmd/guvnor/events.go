@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+var eventsCmd = &cobra.Command{
+	Use:   "events [app[,app...]]",
+	Short: "Follow process lifecycle events as they happen",
+	Long: `Follow the lifecycle events of the running server: processes starting,
+stopping, crashing and restarting, health checks changing status and
+certificates being renewed, as they happen.
+
+- events                          # Every event
+- events web                      # Events of 'web' and its instances
+- events --type crashed,health    # Only crashes and health changes
+- events --json                   # One JSON object per line, for scripts and jq
+
+Event types: ` + strings.Join(events.Types, ", ") + `.`,
+	Run: runEvents,
+}
+
+func init() {
+	eventsCmd.Flags().StringSlice("type", nil, "only show events of these types (comma-separated)")
+	eventsCmd.Flags().Bool("json", false, "print each event as a JSON object on its own line")
+	rootCmd.AddCommand(eventsCmd)
+}
+
+func runEvents(cmd *cobra.Command, args []string) {
+	types, _ := cmd.Flags().GetStringSlice("type")
+	asJSON, _ := cmd.Flags().GetBool("json")
+	for _, t := range types {
+		if !events.Known(t) {
+			fmt.Fprintf(os.Stderr, "Error: unknown event type %q (use %s)\n", t, strings.Join(events.Types, ", "))
+			os.Exit(1)
+		}
+	}
+	query := client.EventQuery{Types: types}
+	for _, arg := range args {
+		query.Apps = append(query.Apps, logs.SplitProcesses(arg)...)
+	}
+
+	apiClient := requireServer("Make sure guvnor server is running with: guvnor start")
+	ctx, cancel := clientContext()
+	defer cancel()
+
+	if !asJSON {
+		fmt.Printf("=== Following events (Ctrl+C to stop) ===\n")
+	}
+	err := apiClient.StreamEvents(ctx, query, func(event events.Event, dropped int) {
+		if asJSON {
+			data, _ := json.Marshal(event)
+			fmt.Println(string(data))
+			return
+		}
+		if dropped > 0 {
+			fmt.Printf("... %d events skipped, the connection fell behind\n", dropped)
+		}
+		fmt.Printf("%s %-19s %s\n", event.Time.Local().Format(time.TimeOnly), event.Type, event.Message)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error streaming events: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+}
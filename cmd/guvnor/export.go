@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/export"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export guvnor state for external tools",
+	Long: `Export configuration derived from guvnor for third-party tools:
+- export checks --format uptime-kuma          # Uptime Kuma backup JSON
+- export checks --format prometheus-blackbox  # Prometheus blackbox scrape config`,
+}
+
+var exportChecksCmd = &cobra.Command{
+	Use:   "checks",
+	Short: "Export external uptime check definitions for every served hostname",
+	Run:   runExportChecks,
+}
+
+func init() {
+	exportChecksCmd.Flags().String("format", export.FormatUptimeKuma, "output format (uptime-kuma, prometheus-blackbox)")
+	exportChecksCmd.Flags().String("out", "", "write to file instead of stdout")
+	exportChecksCmd.Flags().String("blackbox-address", "127.0.0.1:9115", "blackbox_exporter address for prometheus-blackbox format")
+
+	exportCmd.AddCommand(exportChecksCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+func runExportChecks(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+	blackboxAddr, _ := cmd.Flags().GetString("blackbox-address")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(cfg.Apps) == 0 {
+		fmt.Fprintf(os.Stderr, "No apps configured in guvnor.yaml\n")
+		os.Exit(1)
+	}
+
+	data, err := export.Checks(cfg, format, blackboxAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export checks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if out == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", out, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %d checks to %s\n", len(export.CollectChecks(cfg)), out)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/flags"
+)
+
+var flagsCmd = &cobra.Command{
+	Use:   "flags [app]",
+	Short: "List and change per-app feature flags",
+	Long: `Feature flags are key-value pairs kept by the server for each app.
+Processes get them as FLAG_<KEY> environment variables when they (re)start,
+and can read the current values as JSON from /_guvnor/flags through the proxy, sent
+from this host with the app's hostname.
+
+- flags                               # Flags of every app
+- flags web                           # Flags of one app
+- flags set web new-ui=on beta=1      # Set flags
+- flags unset web beta                # Remove flags
+- flags set web new-ui=off --restart  # Set and restart so the environment updates`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runFlags,
+}
+
+var flagsSetCmd = &cobra.Command{
+	Use:   "set <app> key=value...",
+	Short: "Set feature flags of an app",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   runFlagsSet,
+}
+
+var flagsUnsetCmd = &cobra.Command{
+	Use:   "unset <app> key...",
+	Short: "Remove feature flags of an app",
+	Args:  cobra.MinimumNArgs(2),
+	Run:   runFlagsUnset,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{flagsSetCmd, flagsUnsetCmd} {
+		cmd.Flags().Bool("restart", false, "restart the app so its environment picks up the change")
+		cmd.Flags().Bool("rolling", false, "with --restart, restart without downtime")
+		flagsCmd.AddCommand(cmd)
+	}
+	rootCmd.AddCommand(flagsCmd)
+}
+
+func runFlags(cmd *cobra.Command, args []string) {
+	name := ""
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	ctx, cancel := clientContext()
+	defer cancel()
+	all, err := flagsClient().GetFlags(ctx, name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to get flags: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+
+	apps := make([]string, 0, len(all))
+	for app := range all {
+		apps = append(apps, app)
+	}
+	sort.Strings(apps)
+
+	if len(apps) == 0 || (name != "" && len(all[name]) == 0) {
+		fmt.Println("No feature flags set")
+		return
+	}
+	for _, app := range apps {
+		fmt.Printf("%s:\n", app)
+		printFlags(all[app])
+	}
+}
+
+func runFlagsSet(cmd *cobra.Command, args []string) {
+	set, err := flags.ParseAssignments(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	updateFlags(cmd, args[0], set, nil)
+}
+
+func runFlagsUnset(cmd *cobra.Command, args []string) {
+	updateFlags(cmd, args[0], nil, args[1:])
+}
+
+// updateFlags applies a change, prints the result and restarts the app if asked to
+func updateFlags(cmd *cobra.Command, name string, set map[string]string, unset []string) {
+	restart, _ := cmd.Flags().GetBool("restart")
+	rolling, _ := cmd.Flags().GetBool("rolling")
+
+	ctx, cancel := clientContext()
+	defer cancel()
+	updated, err := flagsClient().UpdateFlags(ctx, name, set, unset)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to update flags: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+
+	fmt.Printf("%s:\n", name)
+	if len(updated) == 0 {
+		fmt.Println("  (no flags)")
+	}
+	printFlags(updated)
+
+	if restart {
+		runServerRestart(name, rolling)
+		return
+	}
+	fmt.Printf("Running processes see the new environment after: guvnor restart %s\n", name)
+}
+
+func printFlags(values map[string]string) {
+	for _, key := range flags.Keys(values) {
+		fmt.Printf("  %-20s %-20s %s\n", key, values[key], flags.EnvName(key))
+	}
+}
+
+// flagsClient connects to the running server, which owns the flag store
+func flagsClient() *client.Client {
+	return requireServer("Feature flags are kept by the server, start it with: guvnor start")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+)
+
+// breakGlass holds the flags of commands that can override a freeze window
+var breakGlass struct {
+	enabled bool
+	reason  string
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{startCmd, restartCmd, reloadCmd, scaleCmd} {
+		cmd.Flags().BoolVar(&breakGlass.enabled, "break-glass", false, "run even during a freeze window (recorded in the audit log)")
+		cmd.Flags().StringVar(&breakGlass.reason, "reason", "", "why the freeze window is overridden, recorded with --break-glass")
+	}
+}
+
+// withBreakGlass makes a client break the glass when asked to
+func withBreakGlass(c *client.Client) *client.Client {
+	if breakGlass.enabled {
+		c.WithBreakGlass(breakGlassReason())
+	}
+	return c
+}
+
+// breakGlassReason returns the --reason, naming the local user for the audit log
+func breakGlassReason() string {
+	reason := breakGlass.reason
+	if reason == "" {
+		reason = "no reason given"
+	}
+	if u, err := user.Current(); err == nil {
+		reason = fmt.Sprintf("%s (by %s)", reason, u.Username)
+	}
+	return reason
+}
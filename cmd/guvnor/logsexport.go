@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+var logsExportCmd = &cobra.Command{
+	Use:   "export [app-name[,app-name...]]",
+	Short: "Export stored logs to a file",
+	Long: `Export the logs the server holds for some apps, or all of them, for incident
+forensics:
+- logs export --from 2h --out incident.ndjson
+- logs export web,api --from 2025-09-14T21:00:00Z --to 2025-09-14T21:30:00Z --format csv --out incident.csv
+- logs export --level error --format text > errors.log
+
+--from and --to take a duration back from now (10m) or an RFC 3339 time. With
+logs.dir set, the export reaches back through the rotated log files; a warning
+tells when --from is earlier than the oldest entry still kept. The export is
+written as the server sends it, without being held in memory, and only
+replaces --out once it is complete.`,
+	Run: runLogsExport,
+}
+
+func init() {
+	logsExportCmd.Flags().String("from", "", "only export entries newer than a duration (2h) or RFC 3339 time")
+	logsExportCmd.Flags().String("to", "", "only export entries older than a duration or RFC 3339 time")
+	logsExportCmd.Flags().String("format", logs.ExportNDJSON, "export format (ndjson, csv, text)")
+	logsExportCmd.Flags().String("out", "", "file to write, standard output by default")
+	logsExportCmd.Flags().StringSlice("exclude", nil, "leave out these apps or instances (comma-separated)")
+	logsExportCmd.Flags().String("level", "", "only export entries at this level or above")
+	logsExportCmd.Flags().String("grep", "", "only export entries whose message matches this regular expression")
+
+	logsCmd.AddCommand(logsExportCmd)
+}
+
+func runLogsExport(cmd *cobra.Command, args []string) {
+	format, _ := cmd.Flags().GetString("format")
+	out, _ := cmd.Flags().GetString("out")
+	query := client.LogQuery{}
+	query.Since, _ = cmd.Flags().GetString("from")
+	query.Until, _ = cmd.Flags().GetString("to")
+	query.Exclude, _ = cmd.Flags().GetStringSlice("exclude")
+	query.Level, _ = cmd.Flags().GetString("level")
+	query.Grep, _ = cmd.Flags().GetString("grep")
+	for _, arg := range args {
+		query.Processes = append(query.Processes, logs.SplitProcesses(arg)...)
+	}
+
+	if logs.ExportContentType(format) == "" {
+		fmt.Fprintf(os.Stderr, "Error: invalid format %q (use ndjson, csv or text)\n", format)
+		os.Exit(1)
+	}
+	filter, err := logs.ParseFilter(query.Level, query.Grep, query.Since, query.Until, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+
+	ctx, cancel := clientContext()
+	defer cancel()
+
+	var w io.Writer = os.Stdout
+	var tmp *os.File
+	if out != "" {
+		if tmp, err = os.CreateTemp(filepath.Dir(out), "."+filepath.Base(out)+".*"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		w = tmp
+	}
+	// fail leaves the previous --out in place
+	fail := func(msg string, a ...interface{}) {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+		fmt.Fprintf(os.Stderr, "Error: "+msg+"\n", a...)
+		os.Exit(1)
+	}
+
+	n, oldest, err := server.ExportLogs(ctx, query, format, w)
+	if err != nil {
+		fail("export failed: %s", describeClientError(err))
+	}
+	if !filter.Since.IsZero() && filter.Since.Before(oldest) {
+		fmt.Fprintf(os.Stderr, "Warning: the oldest stored entry is from %s, entries between --from and then are no longer kept\n",
+			oldest.Local().Format(time.RFC3339))
+		fmt.Fprintln(os.Stderr, "Set logs.dir and its retention in the config to keep more on disk")
+	}
+	if tmp == nil {
+		return
+	}
+	if err := tmp.Sync(); err != nil {
+		fail("%v", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		fail("%v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s of logs to %s\n", formatBytes(uint64(n)), out)
+}
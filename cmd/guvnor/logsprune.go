@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+var logsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove old log files beyond the retention limits",
+	Long: `Remove the oldest rotated files from the log directory (logs.dir) until every
+app and the whole directory are within logs.retention. The files being written
+are never removed. A running server prunes the directory every minute too;
+this command works without one.`,
+	Args: cobra.NoArgs,
+	Run:  runLogsPrune,
+}
+
+func init() {
+	logsPruneCmd.Flags().Bool("dry-run", false, "show the files that would be removed")
+
+	logsCmd.AddCommand(logsPruneCmd)
+}
+
+func runLogsPrune(cmd *cobra.Command, args []string) {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	dir := cfg.Logs.Dir
+	if dir == "" {
+		fmt.Fprintf(os.Stderr, "Error: no log directory, set logs.dir to write app logs to files\n")
+		os.Exit(1)
+	}
+
+	pruned, err := logs.Prune(dir, cfg.Logs.Retention.Policy(), time.Now(), dryRun)
+	var freed int64
+	for _, file := range pruned {
+		freed += file.Size
+		fmt.Printf("  - %-30s %8s  %s\n", filepath.Base(file.Path), formatBytes(uint64(file.Size)), file.Reason)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case len(pruned) == 0:
+		fmt.Printf("Log files in %s are within the retention limits\n", dir)
+	case dryRun:
+		fmt.Printf("Would remove %d files, freeing %s\n", len(pruned), formatBytes(uint64(freed)))
+		return
+	default:
+		fmt.Printf("Removed %d files, freeing %s\n", len(pruned), formatBytes(uint64(freed)))
+	}
+
+	usage, err := logs.Usage(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	apps := make([]string, 0, len(usage))
+	var total int64
+	for app, size := range usage {
+		apps = append(apps, app)
+		total += size
+	}
+	sort.Strings(apps)
+	for _, app := range apps {
+		fmt.Printf("  %-30s %8s\n", app, formatBytes(uint64(usage[app])))
+	}
+	fmt.Printf("  %-30s %8s\n", "total", formatBytes(uint64(total)))
+}
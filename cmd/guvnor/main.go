@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"strings"
@@ -13,6 +16,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/gleicon/guvnor/internal/acmedns"
+	"github.com/gleicon/guvnor/internal/api"
 	"github.com/gleicon/guvnor/internal/cert"
 	"github.com/gleicon/guvnor/internal/client"
 	"github.com/gleicon/guvnor/internal/config"
@@ -21,7 +26,10 @@ import (
 	"github.com/gleicon/guvnor/internal/logs"
 	"github.com/gleicon/guvnor/internal/process"
 	"github.com/gleicon/guvnor/internal/procfile"
+	"github.com/gleicon/guvnor/internal/proxy"
+	"github.com/gleicon/guvnor/internal/registry"
 	"github.com/gleicon/guvnor/internal/server"
+	"github.com/gleicon/guvnor/internal/systemd"
 	"github.com/gleicon/guvnor/internal/common"
 	"github.com/gleicon/guvnor/pkg/logger"
 )
@@ -44,7 +52,7 @@ func main() {
 		} else {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 }
 
@@ -83,13 +91,14 @@ var initCmd = &cobra.Command{
 
 // Server/daemon mode
 var startCmd = &cobra.Command{
-	Use:   "start [app-name]",
-	Short: "Start server and all apps, or specific app",
+	Use:   "start [app-name...]",
+	Short: "Start server and all apps, or specific apps",
 	Long: `Start apps:
 - start             # Start server and all apps
 - start web-app     # Start server and only 'web-app'
-- start --daemon    # Run in daemon mode`,
-	Args: cobra.MaximumNArgs(1),
+- start worker      # With the server running, start its 'worker' app
+- start --daemon    # Run in the background (see guvnor daemon)
+- start --dry-run   # Show the commands, environment, ports and routes, start nothing`,
 	Run:  runStart,
 }
 
@@ -108,30 +117,74 @@ var restartCmd = &cobra.Command{
 	Short: "Restart all processes or specific app",
 	Long: `Restart processes:
 - restart           # Restart all apps
-- restart api-service # Restart only the 'api-service' process`,
+- restart api-service # Restart only the 'api-service' process
+- restart api-service --rolling # Zero-downtime restart via the running server`,
 	Args: cobra.MaximumNArgs(1),
 	Run:  runRestart,
 }
 
+var reloadCmd = &cobra.Command{
+	Use:   "reload [app-name]",
+	Short: "Apply configuration changes, or signal an app to reload",
+	Long: `Without an app, make the running server read guvnor.yaml, its drop-ins and the
+Procfile again and apply what changed: new apps are started, removed apps
+stopped and changed apps restarted. Jobs, TLS apps and apps with an autoscale
+schedule, and changes outside apps, are applied when guvnor restarts.
+
+With an app, send its reload_signal (e.g. SIGHUP) through the running server.
+The process keeps running; use restart to replace it.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runReload,
+}
+
+var resetCmd = &cobra.Command{
+	Use:   "reset <app-name>",
+	Short: "Clear an app's restart counter",
+	Long: `Clear the restart counter and crash history of an app (every instance) or a
+single instance through the running server, so its restart policy starts over.
+Use this after fixing an app that hit max_retries or a crash loop, then restart it.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runReset,
+}
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale <app>=<instances>...",
+	Short: "Change the number of running instances of apps",
+	Long: `Scale apps at runtime through the running server, e.g.:
+- scale web=3            # Run three instances of 'web'
+- scale web=3 worker=2   # Adjust several apps at once
+- scale worker=0         # Stop every instance of 'worker'
+
+New instances get the next free ports and are added to proxy routing once running.
+The change is not written to the configuration file.`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runScale,
+}
+
 var logsCmd = &cobra.Command{
-	Use:   "logs [app-name]",
+	Use:   "logs [app-name[,app-name...]]",
 	Short: "Show app logs",
 	Long: `Show logs from apps:
 - logs               # Show all app logs (interleaved)
 - logs web-app       # Show logs from 'web-app' only
-- logs -f api-service # Follow logs from 'api-service'`,
-	Args: cobra.MaximumNArgs(1),
+- logs -f api-service # Follow logs from 'api-service'
+- logs web,api       # Interleave the logs of 'web' and 'api'
+- logs --exclude worker  # Every app except 'worker'
+- logs --system      # Only guvnor's own messages
+- logs --json       # One JSON object per line, for log shippers and jq (also -o json)
+- logs --yaml       # One YAML document per entry
+- logs --level warn --since 10m   # Warnings and errors of the last 10 minutes
+- logs web --grep 'timeout|refused'  # Entries matching a regular expression
+- logs prune         # Remove old log files beyond logs.retention
+
+An app name also selects its instances (web.2, web.3). Each app name is shown
+in its own color and lines apps wrote to stderr in red. Colors are left out
+with --no-color, when NO_COLOR is set or when the output is not a terminal.
+
+Filters are applied by the server, so only matching entries are transferred.`,
 	Run:  runLogs,
 }
 
-var shellCmd = &cobra.Command{
-	Use:   "shell",
-	Short: "Interactive process management shell",
-	Long: `Interactive shell for managing processes.
-Available commands: status, start, stop, restart, logs, ps, help, quit`,
-	Run: runShell,
-}
-
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate configuration and environment",
@@ -139,7 +192,13 @@ var validateCmd = &cobra.Command{
 - Procfile syntax and processes
 - Environment variables and .env files
 - Configuration consistency
-- Port conflicts and dependencies`,
+- Port conflicts and dependencies
+
+With --strict, the ports of the proxy, the management API and the apps are also
+checked: no two of them may overlap, and each must be free to listen on.
+
+With --json or --yaml the findings are printed for CI. The command exits with
+status 1 when there are errors.`,
 	Run: runValidate,
 }
 
@@ -148,7 +207,11 @@ var statusCmd = &cobra.Command{
 	Short: "Show status of all apps or specific app",
 	Long: `Show app status:
 - status             # Show status of all apps
-- status web-app     # Show detailed status of 'web-app' only`,
+- status web-app     # Show detailed status of 'web-app' only
+- status --json      # Processes and certificates as JSON (or --yaml) for scripts
+
+Exits with 3 when no server is reachable, 4 when the API token is refused and
+5 when the app does not exist.`,
 	Args: cobra.MaximumNArgs(1),
 	Run:  runStatus,
 }
@@ -159,13 +222,20 @@ var certCmd = &cobra.Command{
 	Long: `Manage TLS certificates for your applications:
 - cert info    # Show certificate information
 - cert renew   # Renew expiring certificates
-- cert cleanup # Clean up expired certificates`,
+- cert cleanup # Clean up expired certificates
+- cert dns-setup # Show DNS records for the built-in ACME DNS server
+- cert trust   # Install the local development CA in the system trust store
+- cert export  # Bundle certificates and ACME account keys for another host
+- cert import  # Install a bundle written by cert export`,
 }
 
 var certInfoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Show certificate information",
-	Run:   runCertInfo,
+	Long: `Show the certificates in the certificate directory with their status: valid,
+expiring within 30 days, or expired. With --json or --yaml they are printed for
+scripts. The command exits with status 1 when a certificate has expired.`,
+	Run: runCertInfo,
 }
 
 var certRenewCmd = &cobra.Command{
@@ -180,6 +250,15 @@ var certCleanupCmd = &cobra.Command{
 	Run:   runCertCleanup,
 }
 
+var certDNSSetupCmd = &cobra.Command{
+	Use:   "dns-setup",
+	Short: "Show the DNS records that delegate DNS-01 challenges to guvnor",
+	Long: `Print the records to create at your DNS provider so the built-in ACME DNS
+server (tls.acme_dns) can answer DNS-01 challenges, and check whether the
+_acme-challenge CNAMEs are already in place.`,
+	Run: runCertDNSSetup,
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -189,14 +268,33 @@ func init() {
 	rootCmd.PersistentFlags().Bool("quiet", false, "minimal output")
 
 	// Start command flags
-	startCmd.Flags().BoolVar(&daemon, "daemon", false, "run as daemon")
+	startCmd.Flags().BoolVar(&daemon, "daemon", false, "run in the background, detached from the terminal, logging to server.log in the state directory")
 	startCmd.Flags().String("domain", "", "domain for TLS certificates")
 	startCmd.Flags().String("email", "", "email for Let's Encrypt")
 	startCmd.Flags().Bool("dev", false, "development mode (HTTP only)")
+	startCmd.Flags().Bool("dry-run", false, "print what would be started, with secrets redacted, without starting anything")
+
+	// Validate command flags
+	validateCmd.Flags().Bool("strict", false, "also check the ports are free and no two listeners share one")
+	addOutputFlags(validateCmd)
+	addOutputFlags(statusCmd)
+	addOutputFlags(logsCmd)
+	addOutputFlags(certInfoCmd)
 
 	// Logs command flags
 	logsCmd.Flags().BoolP("follow", "f", false, "follow logs")
 	logsCmd.Flags().IntP("lines", "n", 100, "number of lines to show")
+	logsCmd.Flags().StringP("output", "o", "text", "output format (text, json, yaml)")
+	logsCmd.Flags().String("level", "", "only show entries at this level or above (debug, info, warn, error)")
+	logsCmd.Flags().String("grep", "", "only show entries whose message matches this regular expression")
+	logsCmd.Flags().String("since", "", "only show entries newer than a duration (10m) or RFC 3339 time")
+	logsCmd.Flags().String("until", "", "only show entries older than a duration (1h) or RFC 3339 time")
+	logsCmd.Flags().StringSlice("exclude", nil, "leave out these apps or instances (comma-separated)")
+	logsCmd.Flags().Bool("system", false, "show guvnor's own messages (system and proxy-server), alone or with the named apps")
+	logsCmd.Flags().Bool("no-color", false, "do not color the output (also off when NO_COLOR is set or output is not a terminal)")
+	
+	// Restart command flags
+	restartCmd.Flags().Bool("rolling", false, "start a replacement, wait for it to be healthy, then stop the old process")
 
 	// Init command flags
 	initCmd.Flags().Bool("force", false, "overwrite existing files")
@@ -211,8 +309,10 @@ func init() {
 	rootCmd.AddCommand(startCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(restartCmd)
+	rootCmd.AddCommand(reloadCmd)
+	rootCmd.AddCommand(resetCmd)
+	rootCmd.AddCommand(scaleCmd)
 	rootCmd.AddCommand(logsCmd)
-	rootCmd.AddCommand(shellCmd)
 	rootCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(statusCmd)
 	
@@ -220,6 +320,7 @@ func init() {
 	certCmd.AddCommand(certInfoCmd)
 	certCmd.AddCommand(certRenewCmd)
 	certCmd.AddCommand(certCleanupCmd)
+	certCmd.AddCommand(certDNSSetupCmd)
 	rootCmd.AddCommand(certCmd)
 }
 
@@ -339,7 +440,10 @@ func runInit(cmd *cobra.Command, args []string) {
 }
 
 func runStart(cmd *cobra.Command, args []string) {
-	fmt.Println("Starting Guv'nor server...")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	if !dryRun {
+		fmt.Println("Starting Guv'nor server...")
+	}
 
 	// Load configuration
 	pf, err := loadProcfile()
@@ -354,37 +458,82 @@ func runStart(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	// Create server
-	srv := server.New(cfg, pf, log)
+	if dryRun {
+		runDryRun(cfg, pf, args)
+		return
+	}
 
-	// Handle daemon mode
-	if daemon {
-		fmt.Println("Running as daemon...")
-		// Simple daemonization: detach from terminal
-		if os.Getppid() != 1 {
-			// Fork and exit parent
-			fmt.Println("Forking to background...")
-			os.Exit(0)
+	// With a server already running, the apps are started there
+	if len(args) > 0 {
+		if server := configuredServer(cfg); server != nil {
+			for _, name := range args {
+				runServerStart(server, name)
+			}
+			return
 		}
 	}
 
+	// Daemon mode runs this command again detached, with its output in the log
+	if daemon {
+		daemonize(cfg, daemonArgs())
+		return
+	}
+	if server := configuredServer(cfg); server != nil {
+		fmt.Fprintln(os.Stderr, "Error: guvnor is already running for this config (see: guvnor daemon status)")
+		os.Exit(1)
+	}
+
+	// Read before the apps start, so they do not inherit the variables
+	notifier := systemd.FromEnv()
+
+	// Create server
+	srv := server.New(cfg, pf, log)
+	if len(args) > 0 {
+		srv.OnlyApps(args...)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Stop requests come from signals, or the service manager on Windows
+	shutdown := shutdownRequests()
+
 	// Start server
 	if err := srv.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
+		var bindErr *proxy.BindError
+		if errors.As(err, &bindErr) && bindErr.Hint() != "" {
+			fmt.Fprintf(os.Stderr, "\n%s\n", bindErr.Hint())
+		}
 		os.Exit(1)
 	}
 
 	fmt.Println("Server started successfully")
-	fmt.Printf("Processes: %d\n", len(pf.Processes))
+	if entry, err := registerServer(cfg); err != nil {
+		log.WithError(err).Warn("Failed to register server, clients only find it through its config")
+	} else {
+		defer registry.Unregister(entry)
+	}
+	pidPath := cfg.Server.StatePath(pidFileName)
+	if err := writePIDFile(pidPath); err != nil {
+		log.WithError(err).Warn("Failed to write PID file, guvnor daemon cannot find this server")
+	} else {
+		defer removePIDFile(pidPath, os.Getpid())
+	}
+	status := "Running all apps"
+	if len(args) > 0 {
+		fmt.Printf("Started only %s, start others with: guvnor start <app-name>\n", strings.Join(args, ", "))
+		status = "Running " + strings.Join(args, ", ")
+	} else {
+		fmt.Printf("Processes: %d\n", len(pf.Processes))
+	}
 	fmt.Println("Press Ctrl+C to stop")
+	shutdown.started()
+	notifyReady(ctx, notifier, cfg, status)
 
-	// Wait for shutdown signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	<-sigChan
+	// Wait for shutdown request
+	<-shutdown.requested
+	notifier.Notify(systemd.Stopping)
 
 	fmt.Println("\nShutting down...")
 	cancel()
@@ -395,42 +544,91 @@ func runStart(cmd *cobra.Command, args []string) {
 	}
 
 	fmt.Println("Shutdown complete")
+	shutdown.stopped()
+}
+
+// runServerStart asks the running server to start one of its configured apps
+func runServerStart(server *client.Client, name string) {
+	progress := newJobProgress(fmt.Sprintf("Starting %s", name))
+	
+	ctx, cancel := clientContext()
+	defer cancel()
+	result, err := withBreakGlass(server).StartApp(ctx, name, progress.observe)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to start %s: %s\n", name, describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("%s started: %s\n", name, describeInstances(result.Instances))
+}
+
+// describeInstances lists the instances in an action result with their PIDs and ports
+func describeInstances(instances []api.InstanceResult) string {
+	if len(instances) == 0 {
+		return "no instances running"
+	}
+	parts := make([]string, len(instances))
+	for i, instance := range instances {
+		parts[i] = fmt.Sprintf("%s (PID %d)", instance.Name, instance.PID)
+		if instance.Port > 0 {
+			parts[i] = fmt.Sprintf("%s (PID %d, port %d)", instance.Name, instance.PID, instance.Port)
+		}
+	}
+	return strings.Join(parts, ", ")
 }
 
 func runStop(cmd *cobra.Command, args []string) {
 	var appName string
 	if len(args) > 0 {
 		appName = args[0]
-		fmt.Printf("Stopping app: %s...\n", appName)
-	} else {
-		fmt.Println("Stopping all processes...")
 	}
 
 	// Try to connect to running server via API
-	port, err := client.DetectServerPort()
+	apiClient, err := findServer()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		fmt.Fprintf(os.Stderr, "Make sure guvnor server is running with: guvnor start\n")
 		os.Exit(1)
 	}
-
-	apiClient := client.NewClient(port)
 	
+	ctx, cancel := clientContext()
+	defer cancel()
+	
+	var results []api.InstanceResult
 	if appName != "" {
-		// TODO: Implement app-specific stop via API
-		fmt.Printf("App-specific stop not yet implemented for %s\n", appName)
-		fmt.Println("Use 'guvnor stop' to stop all apps for now")
-		return
+		progress := newJobProgress(fmt.Sprintf("Stopping %s", appName))
+		var result *api.AppResult
+		result, err = apiClient.StopApp(ctx, appName, progress.observe)
+		progress.finish()
+		if result != nil {
+			results = result.Instances
+		}
+		if err != nil && len(results) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: failed to stop %s: %s\n", appName, describeClientError(err))
+			os.Exit(1)
+		}
+	} else {
+		progress := newJobProgress("Stopping all processes")
+		results, err = apiClient.StopProcesses(ctx, progress.observe)
+		progress.finish()
 	}
 	
-	results, err := apiClient.StopProcesses()
-	
 	if len(results) == 0 {
 		fmt.Println("No running processes found")
 		return
 	}
 
-	// Display detailed stop results
+	printStopResults(results)
+	
+	if err != nil {
+		fmt.Printf("\nWarning: Some processes could not be stopped: %v\n", err)
+	} else {
+		fmt.Println("\nAll processes stopped successfully")
+	}
+}
+
+// printStopResults prints a table of the instances a stop request stopped
+func printStopResults(results []api.InstanceResult) {
 	fmt.Printf("\n%-15s %-8s %-10s %-8s %s\n", "PROCESS", "PID", "STATUS", "TIME", "DETAILS")
 	fmt.Printf("%-15s %-8s %-10s %-8s %s\n", "-------", "---", "------", "----", "-------")
 	
@@ -441,13 +639,12 @@ func runStop(cmd *cobra.Command, args []string) {
 		}
 		
 		durationStr := "-"
-		if result.Duration > 0 {
-			durationStr = fmt.Sprintf("%.1fs", result.Duration.Seconds())
+		if result.DurationMS > 0 {
+			durationStr = fmt.Sprintf("%.1fs", float64(result.DurationMS)/1000)
 		}
 		
-		details := ""
-		if result.Error != nil {
-			details = result.Error.Error()
+		details := result.Error
+		if details != "" {
 			if len(details) > 40 {
 				details = details[:37] + "..."
 			}
@@ -471,79 +668,234 @@ func runStop(cmd *cobra.Command, args []string) {
 		fmt.Printf("%-15s %-8s %-18s %-8s %s\n", 
 			result.Name, pidStr, statusDisplay, durationStr, details)
 	}
+}
+
+func runRestart(cmd *cobra.Command, args []string) {
+	rolling, _ := cmd.Flags().GetBool("rolling")
+	if len(args) > 0 {
+		runServerRestart(args[0], rolling)
+		return
+	}
+	if rolling {
+		fmt.Fprintf(os.Stderr, "Error: --rolling requires an app name\n")
+		os.Exit(1)
+	}
 	
+	server := requireServer("Restarting needs a running server: guvnor start")
+	ctx, cancel := clientContext()
+	defer cancel()
+	processes, err := server.GetStatus(ctx)
 	if err != nil {
-		fmt.Printf("\nWarning: Some processes could not be stopped: %v\n", err)
-	} else {
-		fmt.Println("\nAll processes stopped successfully")
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+	
+	// Every running app is restarted by the server, one app at a time
+	apps := runningApps(processes)
+	if len(apps) == 0 {
+		fmt.Println("No running apps to restart")
+		return
+	}
+	for _, app := range apps {
+		runServerRestart(app, false)
 	}
 }
 
-func runRestart(cmd *cobra.Command, args []string) {
-	pm := process.NewManager(log)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// runServerRestart asks the running server to restart an app, optionally without downtime
+func runServerRestart(name string, rolling bool) {
+	server := requireServer("Restarting an app needs a running server: guvnor start")
+	
+	title := fmt.Sprintf("Restarting %s", name)
+	if rolling {
+		title = fmt.Sprintf("Rolling restart of %s (waiting for replacements to become healthy)", name)
+	}
+	progress := newJobProgress(title)
+	
+	ctx, cancel := clientContext()
 	defer cancel()
+	result, err := withBreakGlass(server).Restart(ctx, name, rolling, progress.observe)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: restart of %s failed: %s\n", name, describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("Restarted %s: %s\n", name, describeInstances(result.Instances))
+}
 
-	if len(args) > 0 {
-		fmt.Printf("Restarting process: %s\n", args[0])
-		if err := pm.Restart(ctx, args[0]); err != nil {
-			fmt.Printf("Error restarting %s: %v\n", args[0], err)
-		}
-	} else {
-		fmt.Println("Restarting all processes...")
-		// Stop all then start all
-		runStop(cmd, args)
-		fmt.Println("Starting processes...")
-		runStart(cmd, args)
+func runReload(cmd *cobra.Command, args []string) {
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+	
+	ctx, cancel := clientContext()
+	defer cancel()
+	
+	if len(args) == 0 {
+		runConfigReload(ctx, server)
 		return
 	}
-	fmt.Println("Restart complete")
+	
+	progress := newJobProgress(fmt.Sprintf("Reloading %s", args[0]))
+	err := withBreakGlass(server).Reload(ctx, args[0], progress.observe)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reload of %s failed: %s\n", args[0], describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("Reload signal sent to %s\n", args[0])
 }
 
-func runLogs(cmd *cobra.Command, args []string) {
-	follow := viper.GetBool("follow")
-	lines := viper.GetInt("lines")
-
-	// Try to detect running server and connect via API
-	port, err := client.DetectServerPort()
+// runConfigReload applies the configuration files to the running server
+func runConfigReload(ctx context.Context, server *client.Client) {
+	progress := newJobProgress("Reloading configuration")
+	changes, err := withBreakGlass(server).ReloadConfig(ctx, progress.observe)
+	progress.finish()
+	if changes != nil {
+		describeChanges(changes)
+	}
 	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reloading the configuration failed: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+}
+
+// describeChanges prints what a configuration reload changed
+func describeChanges(changes *config.Changes) {
+	if changes.Empty() {
+		fmt.Println("Configuration unchanged")
+		return
+	}
+	for _, change := range []struct {
+		label string
+		names []string
+	}{
+		{"Added", changes.Added},
+		{"Removed", changes.Removed},
+		{"Changed", changes.Changed},
+		{"Applied when guvnor restarts", append(append([]string{}, changes.Pending...), changes.Sections...)},
+	} {
+		if len(change.names) > 0 {
+			fmt.Printf("%s: %s\n", change.label, strings.Join(change.names, ", "))
+		}
+	}
+}
+
+func runScale(cmd *cobra.Command, args []string) {
+	formation := strings.Join(args, ",")
+	if _, err := api.ParseFormation(formation); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Make sure guvnor server is running with: guvnor start\n")
 		os.Exit(1)
 	}
+	
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+	
+	ctx, cancel := clientContext()
+	defer cancel()
+	
+	progress := newJobProgress(fmt.Sprintf("Scaling %s", strings.Join(args, " ")))
+	err := withBreakGlass(server).Scale(ctx, formation, progress.observe)
+	progress.finish()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: scaling failed: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("Scaled %s\n", strings.Join(args, " "))
+}
 
-	apiClient := client.NewClient(port)
+func runReset(cmd *cobra.Command, args []string) {
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+	
+	ctx, cancel := clientContext()
+	defer cancel()
+	
+	reset, err := server.ResetRestarts(ctx, args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: reset of %s failed: %s\n", args[0], describeClientError(err))
+		os.Exit(1)
+	}
+	fmt.Printf("Restart counter cleared for %s\n", strings.Join(reset, ", "))
+	fmt.Printf("If the app gave up restarting, start it again with: guvnor restart %s\n", args[0])
+}
 
-	processName := ""
-	if len(args) > 0 {
-		processName = args[0]
+func runLogs(cmd *cobra.Command, args []string) {
+	follow := viper.GetBool("follow")
+	lines := viper.GetInt("lines")
+	output := viper.GetString("output")
+	if format := outputFormat(cmd); format != outputText {
+		output = format
+	}
+	if output != outputText && output != outputJSON && output != outputYAML {
+		fmt.Fprintf(os.Stderr, "Error: invalid output format %q (use text, json or yaml)\n", output)
+		os.Exit(exitUsage)
+	}
+	color := !viper.GetBool("no-color") && os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	printEntry := func(entry logs.LogEntry) {
+		switch output {
+		case outputJSON:
+			// One object per line, so followed logs can be read as they come
+			data, _ := json.Marshal(entry)
+			fmt.Println(string(data))
+		case outputYAML:
+			fmt.Println("---")
+			printStructured(outputYAML, entry)
+		default:
+			fmt.Println(logs.Format(entry, color))
+		}
+	}
+	query := client.LogQuery{
+		Exclude: viper.GetStringSlice("exclude"),
+		Level:   viper.GetString("level"),
+		Grep:    viper.GetString("grep"),
+		Since:   viper.GetString("since"),
+		Until:   viper.GetString("until"),
+	}
+	for _, arg := range args {
+		query.Processes = append(query.Processes, logs.SplitProcesses(arg)...)
+	}
+	if viper.GetBool("system") {
+		query.Processes = append(query.Processes, logs.SystemProcesses...)
+	}
+	if _, err := logs.ParseFilter(query.Level, query.Grep, query.Since, query.Until, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
-	if processName != "" {
-		fmt.Printf("Showing logs for app: %s (last %d lines)\n", processName, lines)
-	} else {
-		fmt.Printf("Showing logs for all apps (last %d lines)\n", lines)
+	// Try to detect running server and connect via API
+	apiClient := requireServer("Make sure guvnor server is running with: guvnor start")
+
+	if output == outputText {
+		selection := "all apps"
+		if len(query.Processes) > 0 {
+			selection = strings.Join(query.Processes, ", ")
+		}
+		if len(query.Exclude) > 0 {
+			selection += " except " + strings.Join(query.Exclude, ", ")
+		}
+		fmt.Printf("Showing logs for %s (last %d lines)\n", selection, lines)
 	}
 
+	ctx, cancel := clientContext()
+	defer cancel()
+
 	// Get initial logs
-	entries, err := apiClient.GetLogs(processName, lines)
+	entries, err := apiClient.GetLogs(ctx, lines, query)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get logs: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Failed to get logs: %s\n", describeClientError(err))
+		os.Exit(clientExitCode(err))
 	}
 
 	// Display logs
 	for _, entry := range entries {
-		fmt.Println(logs.FormatEntry(entry))
+		printEntry(entry)
 	}
 
 	// If follow mode, stream new logs
 	if follow {
-		fmt.Printf("\n=== Following logs (Ctrl+C to stop) ===\n")
+		if output == outputText {
+			fmt.Printf("\n=== Following logs (Ctrl+C to stop) ===\n")
+		}
 		
-		err := apiClient.StreamLogs(processName, func(newEntries []logs.LogEntry) {
+		err := apiClient.StreamLogs(ctx, query, func(newEntries []logs.LogEntry) {
 			for _, entry := range newEntries {
-				fmt.Println(logs.FormatEntry(entry))
+				printEntry(entry)
 			}
 		})
 		
@@ -556,97 +908,62 @@ func runLogs(cmd *cobra.Command, args []string) {
 
 
 
-func runShell(cmd *cobra.Command, args []string) {
-	fmt.Println("Guv'nor Interactive Shell")
-	fmt.Println("Type 'help' for commands, 'quit' to exit")
-	fmt.Println()
-
-	// Simple interactive shell
-	for {
-		fmt.Print("guvnor> ")
-		var input string
-		if _, err := fmt.Scanln(&input); err != nil {
-			continue
-		}
-
-		switch strings.TrimSpace(input) {
-		case "help":
-			fmt.Println("Available commands:")
-			fmt.Println("  status  - Show process status")
-			fmt.Println("  start   - Start all processes")
-			fmt.Println("  stop    - Stop all processes")
-			fmt.Println("  restart - Restart all processes")
-			fmt.Println("  logs    - Show recent logs")
-			fmt.Println("  ps      - Show running processes")
-			fmt.Println("  quit    - Exit shell")
-		case "status":
-			runStatus(cmd, args)
-		case "start":
-			runStart(cmd, args)
-		case "stop":
-			runStop(cmd, args)
-		case "restart":
-			runRestart(cmd, args)
-		case "logs":
-			runLogs(cmd, args)
-		case "ps":
-			// Show managed processes instead of shell command
-			runStatus(cmd, args)
-		case "quit", "exit":
-			fmt.Println("Goodbye!")
-			return
-		case "":
-			continue
-		default:
-			fmt.Printf("Unknown command: %s. Type 'help' for available commands.\n", input)
-		}
-	}
-}
-
 func runValidate(cmd *cobra.Command, args []string) {
-	fmt.Println("Validating configuration...")
-
-	errors := 0
-	warnings := 0
+	strict, _ := cmd.Flags().GetBool("strict")
+	format := outputFormat(cmd)
+	report := &validationReport{text: format == outputText}
+	if report.text {
+		fmt.Println("Validating configuration...")
+	}
 
 	// Validate Procfile
-	if pf, err := loadProcfile(); err != nil {
-		fmt.Printf("ERROR: Procfile validation failed: %v\n", err)
-		errors++
+	pf, err := loadProcfile()
+	if err != nil {
+		report.add("procfile", levelError, fmt.Sprintf("Procfile validation failed: %v", err), "")
 	} else {
-		fmt.Printf("OK: Procfile (%d processes)\n", len(pf.Processes))
+		report.add("procfile", levelOK, fmt.Sprintf("Procfile (%d processes)", len(pf.Processes)), "")
 
 		// Check environment warnings
 		envWarnings := pf.ValidateEnvironment()
 		for _, warning := range envWarnings {
-			fmt.Printf("WARNING: %s\n", warning)
-			warnings++
+			report.add("procfile", levelWarning, warning, "")
 		}
 	}
 
 	// Validate config
-	if _, err := loadConfig(); err != nil {
-		fmt.Printf("ERROR: Configuration validation failed: %v\n", err)
-		errors++
+	cfg, err := loadConfig()
+	if err != nil {
+		report.add("config", levelError, fmt.Sprintf("Configuration validation failed: %v", err), "")
 	} else {
-		fmt.Println("OK: Configuration file")
+		report.add("config", levelOK, "Configuration file", "")
+		if strict {
+			validateListeners(report, cfg, pf)
+		}
 	}
 
 	// Validate environment
 	if envConfig, err := env.LoadDotEnv("."); err != nil {
-		fmt.Printf("WARNING: No .env files found\n")
-		warnings++
+		report.add("environment", levelWarning, "No .env files found", "")
 	} else {
-		fmt.Printf("OK: Environment (%d variables from %d files)\n",
-			len(envConfig.Variables), len(envConfig.Files))
+		report.add("environment", levelOK, fmt.Sprintf("Environment (%d variables from %d files)",
+			len(envConfig.Variables), len(envConfig.Files)), "")
+	}
+
+	report.Valid = report.Errors == 0
+	if !report.text {
+		printStructured(format, report)
+		if !report.Valid {
+			os.Exit(exitFailure)
+		}
+		return
 	}
 
-	fmt.Printf("\nValidation complete: %d errors, %d warnings\n", errors, warnings)
+	fmt.Printf("\nValidation complete: %d errors, %d warnings\n", report.Errors, report.Warnings)
 
-	if errors > 0 {
+	if report.Errors > 0 {
 		fmt.Println("Fix errors before running 'guvnor start'")
-		os.Exit(1)
-	} else if warnings > 0 {
+		os.Exit(exitFailure)
+	} else if report.Warnings > 0 {
 		fmt.Println("Consider addressing warnings for production use")
 	} else {
 		fmt.Println("Configuration is valid!")
@@ -654,27 +971,31 @@ func runValidate(cmd *cobra.Command, args []string) {
 }
 
 func runStatus(cmd *cobra.Command, args []string) {
+	format := outputFormat(cmd)
 	var appName string
 	if len(args) > 0 {
 		appName = args[0]
-		fmt.Printf("App Status: %s\n", appName)
-	} else {
-		fmt.Println("App Status (All):")
+	}
+	if format == outputText {
+		if appName != "" {
+			fmt.Printf("App Status: %s\n", appName)
+		} else {
+			fmt.Println("App Status (All):")
+		}
 	}
 
 	// Try to connect to running server via API
-	port, err := client.DetectServerPort()
+	apiClient := requireServer("Make sure guvnor server is running with: guvnor start")
+	ctx, cancel := clientContext()
+	defer cancel()
+	
+	processInfo, err := apiClient.GetStatus(ctx)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Make sure guvnor server is running with: guvnor start\n")
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Failed to get status: %s\n", describeClientError(err))
+		os.Exit(clientExitCode(err))
 	}
-
-	apiClient := client.NewClient(port)
-	processInfo, err := apiClient.GetStatus()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get status: %v\n", err)
-		os.Exit(1)
+	if processInfo == nil {
+		processInfo = []process.ProcessInfo{}
 	}
 	
 	// Filter by app name if specified
@@ -687,57 +1008,33 @@ func runStatus(cmd *cobra.Command, args []string) {
 			}
 		}
 		if len(filtered) == 0 {
-			fmt.Printf("App '%s' not found\n", appName)
-			return
+			fmt.Fprintf(os.Stderr, "App '%s' not found\n", appName)
+			os.Exit(exitNotFound)
 		}
 		processInfo = filtered
 	}
-
-	if len(processInfo) > 0 {
-		fmt.Printf("\n%-15s %-8s %-10s %-8s %-8s %-12s %s\n", 
-			"APP", "PID", "STATUS", "RESTARTS", "PORT", "UPTIME", "COMMAND")
-		fmt.Printf("%-15s %-8s %-10s %-8s %-8s %-12s %s\n", 
-			"---", "---", "------", "--------", "----", "------", "-------")
-
-		for _, info := range processInfo {
-			pidStr := fmt.Sprintf("%d", info.PID)
-			
-			portStr := "-"
-			if info.Port > 0 {
-				portStr = fmt.Sprintf("%d", info.Port)
-			}
-
-			// Calculate uptime
-			uptime := time.Since(info.StartTime).Truncate(time.Second)
-			uptimeStr := formatDuration(uptime)
-
-			// Build command string
-			command := info.Command
-			if len(info.Args) > 0 {
-				command += " " + strings.Join(info.Args, " ")
-			}
-			if len(command) > 35 {
-				command = command[:32] + "..."
-			}
-
-			// Color code status
-			var statusDisplay string
-			switch strings.ToLower(info.Status) {
-			case "running":
-				statusDisplay = "\033[32mrunning\033[0m"  // Green
-			case "starting":
-				statusDisplay = "\033[33mstarting\033[0m" // Yellow
-			case "stopping":
-				statusDisplay = "\033[33mstopping\033[0m" // Yellow
-			case "failed":
-				statusDisplay = "\033[31mfailed\033[0m"   // Red
-			default:
-				statusDisplay = info.Status
+	
+	if format != outputText {
+		hosts, err := apiClient.GetCertificates(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get certificates: %s\n", describeClientError(err))
+			os.Exit(clientExitCode(err))
+		}
+		certificates := []cert.HostCertificate{}
+		for _, host := range hosts {
+			if appName == "" || host.App == appName {
+				certificates = append(certificates, host)
 			}
-
-			fmt.Printf("%-15s %-8s %-18s %-8d %-8s %-12s %s\n", 
-				info.Name, pidStr, statusDisplay, info.Restarts, portStr, uptimeStr, command)
 		}
+		printStructured(format, struct {
+			Processes    []process.ProcessInfo  `json:"processes"`
+			Certificates []cert.HostCertificate `json:"certificates"`
+		}{processInfo, certificates})
+		return
+	}
+
+	if len(processInfo) > 0 {
+		printProcesses(processInfo)
 	} else {
 		// If no processes are running, show Procfile processes
 		pf, err := loadProcfile()
@@ -757,6 +1054,129 @@ func runStatus(cmd *cobra.Command, args []string) {
 			fmt.Printf("%-15s %-8s %-18s %s\n", process.Name, "-", "\033[90mstopped\033[0m", command)
 		}
 	}
+	
+	printCertificateStatus(ctx, apiClient, appName)
+}
+
+// printProcesses prints a table of processes with their resource usage
+func printProcesses(processInfo []process.ProcessInfo) {
+	fmt.Printf("\n%-15s %-8s %-10s %-8s %-8s %-12s %-7s %-9s %-5s %s\n", 
+		"APP", "PID", "STATUS", "RESTARTS", "PORT", "UPTIME", "CPU", "MEM", "FDS", "COMMAND")
+	fmt.Printf("%-15s %-8s %-10s %-8s %-8s %-12s %-7s %-9s %-5s %s\n", 
+		"---", "---", "------", "--------", "----", "------", "---", "---", "---", "-------")
+
+	for _, info := range processInfo {
+		pidStr := fmt.Sprintf("%d", info.PID)
+		
+		portStr := "-"
+		if info.Port > 0 {
+			portStr = fmt.Sprintf("%d", info.Port)
+		}
+
+		// Calculate uptime
+		uptime := time.Since(info.StartTime).Truncate(time.Second)
+		uptimeStr := formatDuration(uptime)
+		
+		// Finished jobs keep their row but have no live process
+		if info.Status == "completed" || info.Status == "failed" {
+			pidStr, uptimeStr = "-", "-"
+		}
+
+		// Resource usage is blank until the server has sampled the process;
+		// CPU and memory cover the process and its children
+		cpuStr, memStr, fdsStr := "-", "-", "-"
+		if info.Usage != nil {
+			cpuStr = fmt.Sprintf("%.1f%%", info.Usage.TreeCPUPercent)
+			memStr = formatBytes(info.Usage.TreeRSS)
+			if info.Usage.OpenFDs >= 0 {
+				fdsStr = fmt.Sprintf("%d", info.Usage.OpenFDs)
+			}
+		}
+
+		// Build command string
+		command := info.Command
+		if len(info.Args) > 0 {
+			command += " " + strings.Join(info.Args, " ")
+		}
+		if len(command) > 35 {
+			command = command[:32] + "..."
+		}
+
+		// Color code status
+		var statusDisplay string
+		switch strings.ToLower(info.Status) {
+		case "running":
+			statusDisplay = "\033[32mrunning\033[0m"  // Green
+		case "starting":
+			statusDisplay = "\033[33mstarting\033[0m" // Yellow
+		case "stopping":
+			statusDisplay = "\033[33mstopping\033[0m" // Yellow
+		case "failed":
+			statusDisplay = "\033[31mfailed\033[0m"   // Red
+		case "crashloop":
+			statusDisplay = "\033[31mcrashloop\033[0m" // Red
+		case "completed":
+			statusDisplay = "\033[32mcompleted\033[0m" // Green
+		default:
+			statusDisplay = info.Status
+		}
+
+		fmt.Printf("%-15s %-8s %-18s %-8d %-8s %-12s %-7s %-9s %-5s %s\n", 
+			info.Name, pidStr, statusDisplay, info.Restarts, portStr, uptimeStr, cpuStr, memStr, fdsStr, command)
+		
+		// Forked children (workers, npm's node) below their parent
+		if info.Usage != nil {
+			for _, child := range info.Usage.Children {
+				fmt.Printf("%-15s %-8d %-10s %-8s %-8s %-12s %-7s %-9s %-5s %s\n", 
+					"  └─", child.PID, "", "", "", "", fmt.Sprintf("%.1f%%", child.CPUPercent), formatBytes(child.RSS), "", child.Command)
+			}
+		}
+	}
+}
+
+// printCertificateStatus lists the certificate of each TLS hostname with the
+// days it has left, colored by how close it is to expiry
+func printCertificateStatus(ctx context.Context, apiClient *client.Client, appName string) {
+	hosts, err := apiClient.GetCertificates(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nFailed to get certificates: %s\n", describeClientError(err))
+		return
+	}
+	
+	var rows []cert.HostCertificate
+	for _, host := range hosts {
+		if appName == "" || host.App == appName {
+			rows = append(rows, host)
+		}
+	}
+	if len(rows) == 0 {
+		return
+	}
+	
+	fmt.Printf("\n%-30s %-15s %-9s %-18s %s\n", "HOSTNAME", "APP", "SOURCE", "EXPIRES", "DAYS")
+	fmt.Printf("%-30s %-15s %-9s %-18s %s\n", "--------", "---", "------", "-------", "----")
+	for _, host := range rows {
+		expires, days := "-", host.Status
+		if !host.NotAfter.IsZero() {
+			expires = host.NotAfter.Local().Format("2006-01-02 15:04")
+			days = fmt.Sprintf("%d", host.DaysRemaining)
+		}
+		
+		// Color code days remaining
+		switch host.Status {
+		case cert.HealthOK:
+			days = "\033[32m" + days + "\033[0m"   // Green
+		case cert.HealthExpiring:
+			days = "\033[33m" + days + "\033[0m"   // Yellow
+		default:
+			days = "\033[31m" + days + "\033[0m"   // Red: expired or missing
+		}
+		
+		fmt.Printf("%-30s %-15s %-9s %-18s %s\n", host.Hostname, host.App, host.Source, expires, days)
+		if host.LastError != "" {
+			fmt.Printf("  └─ %s\n", host.LastError)
+		}
+	}
 }
 
 // Helper functions
@@ -773,7 +1193,19 @@ func formatDuration(d time.Duration) string {
 		return fmt.Sprintf("%dd%dh", int(d.Hours()/24), int(d.Hours())%24)
 	}
 }
-
+// formatBytes renders a byte count with a binary unit, e.g. 12.3M
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
 
 func loadProcfile() (*procfile.Procfile, error) {
 	procfilePath, err := procfile.FindProcfile(".")
@@ -792,17 +1224,10 @@ func loadConfig() (*config.Config, error) {
 }
 
 func createSmartConfig(apps []*discovery.App, minimal bool) *config.Config {
-	cfg := &config.Config{
-		Server: config.ServerConfig{
-			HTTPPort:  8080,
-			HTTPSPort: 8443,
-			LogLevel:  "info",
-		},
-		TLS: config.TLSConfig{
-			Enabled:  false,
-			AutoCert: true,
-		},
-	}
+	cfg := config.Defaults()
+	cfg.Server.HTTPPort = 8080
+	cfg.Server.HTTPSPort = 8443
+	cfg.TLS.Enabled = false
 
 	if !minimal {
 		for _, app := range apps {
@@ -811,6 +1236,7 @@ func createSmartConfig(apps []*discovery.App, minimal bool) *config.Config {
 				Port:    app.Port,
 				Command: app.Command,
 				Args:    app.Args,
+				Shell:   app.Shell,
 			}
 			cfg.Apps = append(cfg.Apps, appCfg)
 		}
@@ -875,7 +1301,10 @@ func updateGitignore(path string) error {
 // Certificate management commands
 
 func runCertInfo(cmd *cobra.Command, args []string) {
-	fmt.Println("Certificate Information:")
+	format := outputFormat(cmd)
+	if format == outputText {
+		fmt.Println("Certificate Information:")
+	}
 	
 	// Load configuration to get certificate directory
 	cfg, err := loadConfig()
@@ -884,7 +1313,21 @@ func runCertInfo(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 	
+	// Certificates with their status, for --json and --yaml
+	type certificate struct {
+		cert.CertInfo
+		Status string `json:"status"`
+	}
+	type certificates struct {
+		TLSEnabled   bool          `json:"tls_enabled"`
+		Certificates []certificate `json:"certificates"`
+	}
+	
 	if !cfg.TLS.Enabled {
+		if format != outputText {
+			printStructured(format, certificates{Certificates: []certificate{}})
+			return
+		}
 		fmt.Println("TLS is not enabled in configuration")
 		return
 	}
@@ -912,6 +1355,23 @@ func runCertInfo(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 	
+	expired := false
+	for _, cert := range certs {
+		expired = expired || cert.IsExpired
+	}
+	
+	if format != outputText {
+		result := certificates{TLSEnabled: true, Certificates: []certificate{}}
+		for _, info := range certs {
+			result.Certificates = append(result.Certificates, certificate{info, certStatus(info)})
+		}
+		printStructured(format, result)
+		if expired {
+			os.Exit(exitFailure)
+		}
+		return
+	}
+	
 	if len(certs) == 0 {
 		fmt.Println("No certificates found")
 		return
@@ -921,21 +1381,28 @@ func runCertInfo(cmd *cobra.Command, args []string) {
 	fmt.Printf("%-30s %-12s %-20s %-20s %s\n", "------", "------", "----------", "---------", "----")
 	
 	for _, cert := range certs {
-		status := "valid"
-		if cert.IsExpired {
-			status = "expired"
-		} else if time.Until(cert.NotAfter) < 30*24*time.Hour {
-			status = "expiring"
-		}
-		
 		fmt.Printf("%-30s %-12s %-20s %-20s %s\n",
 			cert.Domain,
-			status,
+			certStatus(cert),
 			cert.NotBefore.Format("2006-01-02 15:04"),
 			cert.NotAfter.Format("2006-01-02 15:04"),
 			cert.Path,
 		)
 	}
+	if expired {
+		os.Exit(exitFailure)
+	}
+}
+
+// certStatus is valid, expiring within 30 days, or expired
+func certStatus(info cert.CertInfo) string {
+	switch {
+	case info.IsExpired:
+		return "expired"
+	case time.Until(info.NotAfter) < 30*24*time.Hour:
+		return "expiring"
+	}
+	return "valid"
 }
 
 func runCertRenew(cmd *cobra.Command, args []string) {
@@ -952,6 +1419,12 @@ func runCertRenew(cmd *cobra.Command, args []string) {
 		return
 	}
 	
+	acme, err := cfg.TLS.ACMESettings(context.Background(), cfg.SecretResolver())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load ACME settings: %v\n", err)
+		os.Exit(1)
+	}
+	
 	certConfig := &cert.Config{
 		Enabled:    cfg.TLS.Enabled,
 		AutoCert:   cfg.TLS.AutoCert,
@@ -960,6 +1433,7 @@ func runCertRenew(cmd *cobra.Command, args []string) {
 		Domains:    cfg.TLS.Domains,
 		Staging:    cfg.TLS.Staging,
 		ForceHTTPS: cfg.TLS.ForceHTTPS,
+		ACME:       acme,
 	}
 	
 	certMgr, err := cert.New(certConfig, log)
@@ -1016,3 +1490,61 @@ func runCertCleanup(cmd *cobra.Command, args []string) {
 	
 	fmt.Println("Certificate cleanup completed")
 }
+
+func runCertDNSSetup(cmd *cobra.Command, args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	
+	dns := cfg.TLS.ACMEDNS
+	if !dns.Enabled {
+		fmt.Println("The built-in ACME DNS server is not enabled (set tls.acme_dns.enabled)")
+		return
+	}
+	
+	fmt.Printf("Create these records at the DNS provider of your domains:\n\n")
+	fmt.Printf("%-45s %-6s %s\n", "NAME", "TYPE", "VALUE")
+	for _, record := range acmedns.SetupRecords(dns.Zone, dns.Nameserver, dns.Address, dns.Domains) {
+		status := ""
+		if record.Type == "CNAME" {
+			if target, err := net.LookupCNAME(record.Name); err == nil && strings.EqualFold(strings.TrimSuffix(target, "."), record.Value) {
+				status = "  \033[32m✓ in place\033[0m"
+			} else {
+				status = "  \033[33m(not found yet)\033[0m"
+			}
+		}
+		fmt.Printf("%-45s %-6s %s%s\n", record.Name, record.Type, record.Value, status)
+	}
+	
+	fmt.Printf("\nguvnor must be reachable on UDP and TCP %s at the nameserver address.\n", dns.Listen)
+	if dns.Address == "" {
+		fmt.Printf("Set tls.acme_dns.address or create an address record for %s yourself.\n", dns.Nameserver)
+	}
+}
+
+// clientContext returns a context for API calls that is cancelled on Ctrl+C
+func clientContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// describeClientError turns API client errors into a message with a hint for the user
+func describeClientError(err error) string {
+	var statusErr *client.StatusError
+	switch {
+	case errors.Is(err, client.ErrUnreachable):
+		if _, selected, _ := remoteServer(); selected {
+			return fmt.Sprintf("%v (check the server's address and certificate, or pick another context: guvnor context)", err)
+		}
+		return fmt.Sprintf("%v (is the server running? start it with: guvnor start)", err)
+	case errors.Is(err, client.ErrFrozen):
+		return fmt.Sprintf("%v (override with --break-glass --reason \"...\", it is recorded in the audit log)", err)
+	case errors.Is(err, client.ErrUnauthorized):
+		return fmt.Sprintf("%v (the management API refused the request; pass --token or set %s to an api token allowed to do this)", err, client.TokenEnv)
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("guvnor server error: %v", err)
+	default:
+		return err.Error()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/client"
+)
+
+// Exit codes, by class of failure, so scripts can tell them apart
+const (
+	exitFailure      = 1 // The command failed, or what it checked did not pass
+	exitUsage        = 2 // Unknown command, flag or argument
+	exitUnavailable  = 3 // No server running or reachable
+	exitUnauthorized = 4 // The management API refused the token
+	exitNotFound     = 5 // No such app
+)
+
+// Output formats of commands with machine-readable output
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+// addOutputFlags adds --json and --yaml to a command
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("json", false, "print the result as JSON")
+	cmd.Flags().Bool("yaml", false, "print the result as YAML")
+	cmd.MarkFlagsMutuallyExclusive("json", "yaml")
+}
+
+// outputFormat returns the format selected with --json or --yaml
+func outputFormat(cmd *cobra.Command) string {
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		return outputJSON
+	}
+	if asYAML, _ := cmd.Flags().GetBool("yaml"); asYAML {
+		return outputYAML
+	}
+	return outputText
+}
+
+// printStructured prints v as JSON or YAML. Both use the json field names, so
+// the two formats carry the same keys.
+func printStructured(format string, v any) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(v)
+	data := buf.Bytes()
+	if err == nil && format == outputYAML {
+		data, err = jsonToYAML(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode output: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	os.Stdout.Write(data)
+}
+
+// jsonToYAML converts a JSON document to YAML, keeping the order of its keys
+func jsonToYAML(data []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	// JSON reads as flow style YAML with quoted strings; the encoder still
+	// quotes the strings that need it in block style
+	var block func(n *yaml.Node)
+	block = func(n *yaml.Node) {
+		n.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+		for _, child := range n.Content {
+			block(child)
+		}
+	}
+	block(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), encoder.Close()
+}
+
+// clientExitCode returns the exit code for an error of the management API client
+func clientExitCode(err error) int {
+	var statusErr *client.StatusError
+	switch {
+	case errors.Is(err, client.ErrUnreachable):
+		return exitUnavailable
+	case errors.Is(err, client.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+		return exitNotFound
+	default:
+		return exitFailure
+	}
+}
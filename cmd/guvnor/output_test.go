@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/client"
+)
+
+// cliEnv makes the test binary run main, so tests can run guvnor commands
+const cliEnv = "GUVNOR_TEST_CLI"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(cliEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runCLI runs guvnor with args in dir, away from the registry and contexts of
+// the user, and returns its output and exit code
+func runCLI(t *testing.T, dir string, args ...string) (stdout string, code int) {
+	t.Helper()
+	home := t.TempDir()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), cliEnv+"=1", "HOME="+home, "XDG_RUNTIME_DIR=", "XDG_CONFIG_HOME=", "XDG_STATE_HOME=",
+		"GUVNOR_REGISTRY_DIR="+filepath.Join(home, "run"), client.ContextsEnv+"="+filepath.Join(home, "contexts.yaml"),
+		client.TokenEnv+"=", "NO_COLOR=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("guvnor %s: %v", strings.Join(args, " "), err)
+	}
+	if testing.Verbose() && errOut.Len() > 0 {
+		t.Logf("guvnor %s: %s", strings.Join(args, " "), errOut.String())
+	}
+	return out.String(), code
+}
+
+// testProject returns a project directory with a Procfile and a config whose
+// management API is handler, or a port nothing listens on when it is nil
+func testProject(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Procfile"), []byte("web: sleep 600\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testDaemonConfig(t, "")
+	if handler != nil {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+		cfg = testDaemonConfig(t, server.URL)
+	}
+	config := fmt.Sprintf("server:\n  http_port: %d\n  state_dir: %s\n  api_socket:\n    disabled: true\ntls:\n  enabled: false\n",
+		cfg.Server.HTTPPort, cfg.Server.StateDir)
+	if err := os.WriteFile(filepath.Join(dir, "guvnor.yaml"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testAPI answers the management API requests of status and logs for one
+// running app, web
+func testAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/ping":
+		fmt.Fprint(w, `{"status":"ok"}`)
+	case "/api/v1/status":
+		fmt.Fprint(w, `{"processes":[{"name":"web","pid":42,"status":"running","restarts":0,"command":"sleep","args":["600"],"start_time":"2025-09-14T21:00:00Z","port":3000,"app":"web"}],"count":1}`)
+	case "/api/v1/certs":
+		fmt.Fprint(w, `{"hostnames":[{"hostname":"web.example.com","app":"web","source":"acme","days_remaining":60,"status":"valid"}]}`)
+	case "/api/v1/logs":
+		fmt.Fprint(w, `{"logs":[{"timestamp":"2025-09-14T21:00:05Z","level":"info","process":"web","message":"listening","stream":"stdout"},{"timestamp":"2025-09-14T21:00:06Z","level":"error","process":"web","message":"failed: \"db\"","stream":"stderr"}],"count":2}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestClientExitCode(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected int
+	}{
+		{fmt.Errorf("%w: connection refused", client.ErrUnreachable), exitUnavailable},
+		{fmt.Errorf("%w: invalid token", client.ErrUnauthorized), exitUnauthorized},
+		{fmt.Errorf("restart: %w", &client.StatusError{StatusCode: http.StatusNotFound}), exitNotFound},
+		{&client.StatusError{StatusCode: http.StatusInternalServerError}, exitFailure},
+		{errors.New("job failed"), exitFailure},
+	}
+	for _, tt := range tests {
+		if got := clientExitCode(tt.err); got != tt.expected {
+			t.Errorf("%v: expected exit code %d, got %d", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	data, err := jsonToYAML([]byte(`{"zeta": 1, "alpha": {"list": ["a b", "true", ""], "empty": []}, "name": "web: 1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `zeta: 1
+alpha:
+  list:
+    - a b
+    - "true"
+    - ""
+  empty: []
+name: 'web: 1'
+`
+	if string(data) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, data)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	unauthorized := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/ping" {
+			testAPI(w, r)
+			return
+		}
+		http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+	})
+
+	tests := []struct {
+		name     string
+		handler  http.Handler // Management API, nil for no server
+		setup    func(dir string)
+		args     []string
+		expected int
+	}{
+		{"success", http.HandlerFunc(testAPI), nil, []string{"status"}, 0},
+		{"failed validation", nil, func(dir string) { os.Remove(filepath.Join(dir, "Procfile")) }, []string{"validate", "--json"}, exitFailure},
+		{"unknown command", nil, nil, []string{"frobnicate"}, exitUsage},
+		{"unknown flag", nil, nil, []string{"status", "--frobnicate"}, exitUsage},
+		{"invalid argument", nil, nil, []string{"logs", "--output", "xml"}, exitUsage},
+		{"no server", nil, nil, []string{"status"}, exitUnavailable},
+		{"token refused", unauthorized, nil, []string{"status"}, exitUnauthorized},
+		{"no such app", http.HandlerFunc(testAPI), nil, []string{"status", "api"}, exitNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testProject(t, tt.handler)
+			if tt.setup != nil {
+				tt.setup(dir)
+			}
+			if _, code := runCLI(t, dir, tt.args...); code != tt.expected {
+				t.Errorf("guvnor %s: expected exit code %d, got %d", strings.Join(tt.args, " "), tt.expected, code)
+			}
+		})
+	}
+}
+
+// keys returns the sorted keys of the object at path in a decoded document,
+// with / between the levels and any key stepping into the first element of a
+// list
+func keys(t *testing.T, doc map[string]any, path string) []string {
+	t.Helper()
+	var v any = doc
+	for _, part := range strings.Split(path, "/") {
+		if part == "" {
+			continue
+		}
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[part]
+		case []any:
+			if len(node) == 0 {
+				t.Fatalf("%s: %s is empty", path, part)
+			}
+			v = node[0]
+		}
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		t.Fatalf("%s: expected an object, got %T", path, v)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestStructuredOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.Handler
+		args    []string
+		code    int
+		docs    int                 // Documents printed, one per line for JSON logs
+		keys    map[string][]string // Sorted keys at each path, see keys
+	}{
+		{"validate", nil, []string{"validate"}, 0, 1, map[string][]string{
+			"":          {"errors", "results", "valid", "warnings"},
+			"results/0": {"check", "level", "message"},
+		}},
+		{"status", http.HandlerFunc(testAPI), []string{"status"}, 0, 1, map[string][]string{
+			"":               {"certificates", "processes"},
+			"processes/0":    {"app", "args", "command", "name", "pid", "port", "restarts", "start_time", "status"},
+			"certificates/0": {"app", "days_remaining", "hostname", "not_after", "source", "status"},
+		}},
+		{"logs", http.HandlerFunc(testAPI), []string{"logs"}, 0, 2, map[string][]string{
+			"": {"level", "message", "process", "stream", "timestamp"},
+		}},
+		{"cert info", nil, []string{"cert", "info"}, 0, 1, map[string][]string{
+			"": {"certificates", "tls_enabled"},
+		}},
+	}
+	for _, tt := range tests {
+		for _, format := range []string{outputJSON, outputYAML} {
+			t.Run(tt.name+" "+format, func(t *testing.T) {
+				out, code := runCLI(t, testProject(t, tt.handler), append(tt.args, "--"+format)...)
+				if code != tt.code {
+					t.Fatalf("Expected exit code %d, got %d:\n%s", tt.code, code, out)
+				}
+
+				var docs []map[string]any
+				if format == outputJSON {
+					// Logs print an object per line, the others one indented document
+					decoder := json.NewDecoder(strings.NewReader(out))
+					for decoder.More() {
+						var doc map[string]any
+						if err := decoder.Decode(&doc); err != nil {
+							t.Fatalf("Invalid JSON: %v\n%s", err, out)
+						}
+						docs = append(docs, doc)
+					}
+					if tt.docs > 1 && len(strings.Split(strings.TrimSpace(out), "\n")) != tt.docs {
+						t.Errorf("Expected one object per line:\n%s", out)
+					}
+				} else {
+					decoder := yaml.NewDecoder(bufio.NewReader(strings.NewReader(out)))
+					for {
+						var doc map[string]any
+						if err := decoder.Decode(&doc); err != nil {
+							break
+						}
+						if doc != nil {
+							docs = append(docs, doc)
+						}
+					}
+				}
+				if len(docs) != tt.docs {
+					t.Fatalf("Expected %d documents, got %d:\n%s", tt.docs, len(docs), out)
+				}
+				for path, expected := range tt.keys {
+					if got := keys(t, docs[0], path); !reflect.DeepEqual(got, expected) {
+						t.Errorf("%q: expected keys %v, got %v", path, expected, got)
+					}
+				}
+			})
+		}
+	}
+}
+
+// The JSON and YAML documents carry the same values
+func TestStructuredOutputFormatsAgree(t *testing.T) {
+	dir := testProject(t, http.HandlerFunc(testAPI))
+	asJSON, _ := runCLI(t, dir, "status", "--json")
+	asYAML, _ := runCLI(t, dir, "status", "--yaml")
+
+	var fromJSON, fromYAML map[string]any
+	if err := json.Unmarshal([]byte(asJSON), &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal([]byte(asYAML), &fromYAML); err != nil {
+		t.Fatal(err)
+	}
+	// YAML reads times and integers as such; compare through JSON
+	normalized, _ := json.Marshal(fromYAML)
+	json.Unmarshal(normalized, &fromYAML)
+	if !reflect.DeepEqual(fromJSON, fromYAML) {
+		t.Errorf("Expected the same document, got\n%s\nand\n%s", asJSON, asYAML)
+	}
+	if _, code := runCLI(t, dir, "status", "--json", "--yaml"); code != exitUsage {
+		t.Errorf("Expected --json and --yaml together to be a usage error, got %d", code)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/jobs"
+)
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// jobProgress renders the live progress of a server job. On a terminal the
+// per-app steps are redrawn in place with a spinner; otherwise each new
+// message and phase change is printed once so the output stays log friendly.
+type jobProgress struct {
+	title    string
+	out      io.Writer
+	tty      bool
+	frame    int
+	drawn    int               // Lines of the live block currently on screen
+	messages int               // Progress messages already printed
+	phases   map[string]string // Last printed phase per target (non-terminal output)
+}
+
+// newJobProgress creates a progress renderer writing to stdout
+func newJobProgress(title string) *jobProgress {
+	return &jobProgress{
+		title:  title,
+		out:    os.Stdout,
+		tty:    isTerminal(os.Stdout),
+		phases: make(map[string]string),
+	}
+}
+
+// observe is passed to the API client and called with every job update
+func (p *jobProgress) observe(job *client.JobStatus) {
+	if p.tty {
+		p.redraw(job)
+		return
+	}
+
+	if p.frame == 0 {
+		fmt.Fprintln(p.out, p.title)
+	}
+	p.frame++
+
+	for ; p.messages < len(job.Progress); p.messages++ {
+		fmt.Fprintf(p.out, "  %s\n", job.Progress[p.messages])
+	}
+	for _, step := range job.Steps {
+		if p.phases[step.Target] == step.Phase || step.Phase == "pending" {
+			continue
+		}
+		p.phases[step.Target] = step.Phase
+		fmt.Fprintf(p.out, "  %s: %s\n", step.Target, step.Phase)
+	}
+}
+
+// redraw replaces the live block with the current state of the job
+func (p *jobProgress) redraw(job *client.JobStatus) {
+	if p.drawn > 0 {
+		fmt.Fprintf(p.out, "\033[%dA\033[J", p.drawn)
+	}
+
+	// Messages scroll above the live block and are never redrawn
+	for ; p.messages < len(job.Progress); p.messages++ {
+		fmt.Fprintf(p.out, "  %s\n", job.Progress[p.messages])
+	}
+
+	finished := job.Status == jobs.StatusSucceeded || job.Status == jobs.StatusFailed
+	spinner := spinnerFrames[p.frame%len(spinnerFrames)]
+	p.frame++
+
+	var b strings.Builder
+	header := spinner
+	switch job.Status {
+	case jobs.StatusSucceeded:
+		header = "\033[32m✓\033[0m"
+	case jobs.StatusFailed:
+		header = "\033[31m✗\033[0m"
+	}
+	fmt.Fprintf(&b, "%s %s", header, p.title)
+	if len(job.Steps) > 0 {
+		done := 0
+		for _, step := range job.Steps {
+			if step.Done {
+				done++
+			}
+		}
+		fmt.Fprintf(&b, " [%d/%d %d%%]", done, len(job.Steps), job.Percent)
+	}
+	b.WriteString("\n")
+
+	width := 0
+	for _, step := range job.Steps {
+		if len(step.Target) > width {
+			width = len(step.Target)
+		}
+	}
+	for _, step := range job.Steps {
+		marker := spinner
+		switch {
+		case step.Done && (step.Phase == "failed" || step.Phase == "error"):
+			marker = "\033[31m✗\033[0m"
+		case step.Done:
+			marker = "\033[32m✓\033[0m"
+		case step.Phase == "pending" || finished:
+			marker = "\033[90m·\033[0m"
+		}
+		fmt.Fprintf(&b, "  %s %-*s  %s\n", marker, width, step.Target, step.Phase)
+	}
+
+	output := b.String()
+	fmt.Fprint(p.out, output)
+	p.drawn = strings.Count(output, "\n")
+}
+
+// finish leaves the last drawn state on screen
+func (p *jobProgress) finish() {
+	p.drawn = 0
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
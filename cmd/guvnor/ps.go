@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var psCmd = &cobra.Command{
+	Use:   "ps",
+	Short: "Show managed processes, or leftovers with --orphans",
+	Long: `Show the processes guvnor manages, like status.
+
+With --orphans, show processes that were started under guvnor but outlived the
+process they came from, e.g. a daemon forked by a shell wrapper that still holds
+a port. guvnor kills these when it stops all apps; --kill removes them now.`,
+	Args: cobra.NoArgs,
+	Run:  runPs,
+}
+
+func init() {
+	psCmd.Flags().Bool("orphans", false, "show processes left behind by managed processes")
+	psCmd.Flags().Bool("kill", false, "with --orphans, kill the orphaned processes")
+
+	rootCmd.AddCommand(psCmd)
+}
+
+func runPs(cmd *cobra.Command, args []string) {
+	orphans, _ := cmd.Flags().GetBool("orphans")
+	kill, _ := cmd.Flags().GetBool("kill")
+	if !orphans {
+		if kill {
+			fmt.Fprintf(os.Stderr, "Error: --kill requires --orphans\n")
+			os.Exit(1)
+		}
+		runStatus(cmd, args)
+		return
+	}
+
+	server := requireServer("Make sure guvnor server is running with: guvnor start")
+
+	ctx, cancel := clientContext()
+	defer cancel()
+	list, err := server.Orphans(ctx, kill)
+	if err != nil && len(list) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: failed to list orphans: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+
+	if len(list) == 0 {
+		fmt.Println("No orphaned processes")
+		return
+	}
+
+	fmt.Printf("%-8s %-8s %-15s %s\n", "PID", "PPID", "PROCESS", "COMMAND")
+	for _, orphan := range list {
+		fmt.Printf("%-8d %-8d %-15s %s\n", orphan.PID, orphan.PPID, orphan.Process, orphan.Command)
+	}
+
+	if kill {
+		fmt.Printf("\nKilled %d orphaned processes\n", len(list))
+	} else {
+		fmt.Println("\nKill them with: guvnor ps --orphans --kill")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describeClientError(err))
+		os.Exit(1)
+	}
+}
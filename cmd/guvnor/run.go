@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run <app> -- <command> [args...]",
+	Short: "Run a one-off command in an app's environment",
+	Long: `Run a one-off command the way the app's processes run: in its working
+directory, with its .env and env_file files and its environment, ${VAR}
+references and secret:// values resolved. Output goes to the terminal and
+guvnor exits with the command's exit code, so it fits in deploy scripts.
+
+- run web -- rake db:migrate                 # Migrate with the app's DATABASE_URL
+- run web -- python manage.py createsuperuser
+- run worker -- env                          # Show the environment the app gets
+
+Container apps run the command inside the app's running container (web.2
+picks an instance). The command is not managed: it is neither restarted
+nor logged by the server, and the apps are read from the local config.`,
+	Args: cobra.MinimumNArgs(2),
+	Run:  runRun,
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec <app> [-- command [args...]]",
+	Short: "Open a shell in an app's environment or container",
+	Long: `Open an interactive shell with the environment of the app's processes, in
+its working directory: $SHELL for apps run as processes, /bin/sh inside the
+running container of container apps (web.2 picks an instance).
+
+- exec web                 # Shell in the app's environment
+- exec web.2               # Shell in the container of instance 2
+- exec web -- bash -l      # Another shell or command`,
+	Args: cobra.MinimumNArgs(1),
+	Run:  runExec,
+}
+
+func init() {
+	// Flags after the app belong to the command
+	runCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().SetInterspersed(false)
+	rootCmd.AddCommand(runCmd, execCmd)
+}
+
+func runRun(cmd *cobra.Command, args []string) {
+	argv := commandArgs(args[1:])
+	if len(argv) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: no command to run, e.g. guvnor run web -- rake db:migrate")
+		os.Exit(1)
+	}
+	runOneOff(args[0], argv)
+}
+
+func runExec(cmd *cobra.Command, args []string) {
+	argv := commandArgs(args[1:])
+	runOneOff(args[0], argv)
+}
+
+// commandArgs drops the -- separating the app from its command
+func commandArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// runOneOff runs argv, or a shell when empty, for the app or instance name
+// attached to the terminal, and exits with its exit code
+func runOneOff(name string, argv []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	app, found := configuredApp(cfg, process.AppOfInstance(name))
+	if !found {
+		fmt.Fprintf(os.Stderr, "Error: app %s is not in the config\n", name)
+		os.Exit(1)
+	}
+
+	ctx, cancel := clientContext()
+	var command *exec.Cmd
+	if app.Container.Enabled() {
+		if len(argv) == 0 {
+			argv = []string{"/bin/sh"}
+		}
+		tty := isTerminal(os.Stdin) && isTerminal(os.Stdout)
+		command, err = process.ContainerCommand(ctx, cfg.Execution, name, tty, argv)
+	} else {
+		if len(argv) == 0 {
+			argv = []string{userShell()}
+		}
+		command, err = process.Command(ctx, app, cfg.SecretResolver(), argv)
+	}
+	cancel()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Ctrl+C reaches the command through the terminal; guvnor waits for it to
+	// exit instead of dying first. A caught signal is reset on exec, unlike
+	// an ignored one, so the command still gets the default behavior.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	err = command.Run()
+	signal.Stop(interrupts)
+
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		if code := exitErr.ExitCode(); code > 0 {
+			os.Exit(code)
+		}
+		os.Exit(1) // Killed by a signal
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// configuredApp returns the app of the config with the given name
+func configuredApp(cfg *config.Config, name string) (config.AppConfig, bool) {
+	for _, app := range cfg.Apps {
+		if app.Name == name {
+			return app, true
+		}
+	}
+	return config.AppConfig{}, false
+}
+
+// userShell returns the user's login shell
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if shell := os.Getenv("COMSPEC"); shell != "" {
+			return shell
+		}
+		return "cmd"
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/common"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/registry"
+)
+
+var serversCmd = &cobra.Command{
+	Use:   "servers",
+	Short: "List the guvnor servers running for this user",
+	Long: `List the guvnor servers running for this user, from the server registry: a
+runtime info file each server writes while it runs, in $XDG_RUNTIME_DIR/guvnor,
+/var/run/guvnor for root, or ~/.guvnor/run ($GUVNOR_REGISTRY_DIR overrides it).
+
+Other commands talk to the server of the config in the current directory, or,
+when it is not running, to the only registered server or the one started in the
+current directory.`,
+	Args: cobra.NoArgs,
+	Run:  runServers,
+}
+
+func init() {
+	rootCmd.AddCommand(serversCmd)
+}
+
+// registerServer records this server in the registry and returns the path of
+// its entry
+func registerServer(cfg *config.Config) (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	entry := registry.Entry{
+		PID:       os.Getpid(),
+		HTTPPort:  cfg.Server.HTTPPort,
+		APIPort:   api.GetManagementPort(cfg.Server.HTTPPort),
+		Dir:       dir,
+		StartedAt: time.Now(),
+		Version:   version,
+	}
+	if socket := cfg.Server.SocketPath(); socket != "" {
+		entry.Socket, _ = filepath.Abs(socket)
+	}
+	configPath := "guvnor.yaml"
+	if configFile != "" {
+		configPath = configFile
+	}
+	if common.FileExists(configPath) {
+		entry.Config, _ = filepath.Abs(configPath)
+	}
+	return registry.Register(registry.Dir(), entry)
+}
+
+func runServers(cmd *cobra.Command, args []string) {
+	entries, err := registry.List(registry.Dir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No guvnor servers running")
+		return
+	}
+
+	fmt.Printf("%-8s %-6s %-6s %-10s %-8s %s\n", "PID", "HTTP", "API", "UPTIME", "VERSION", "DIRECTORY")
+	for _, entry := range entries {
+		fmt.Printf("%-8d %-6d %-6d %-10s %-8s %s\n", entry.PID, entry.HTTPPort, entry.APIPort,
+			time.Since(entry.StartedAt).Round(time.Second), entry.Version, entry.Dir)
+		if entry.Socket != "" {
+			fmt.Printf("%-8s socket %s\n", "", entry.Socket)
+		}
+		if entry.Config != "" {
+			fmt.Printf("%-8s config %s\n", "", entry.Config)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultServiceName is the service name used without --name
+const defaultServiceName = "guvnor"
+
+// serviceLogFile receives the server log under the service manager, in the project directory
+const serviceLogFile = "guvnor-service.log"
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Run guvnor as a service started at boot",
+	Long: `Manage a service that runs guvnor start for the project in the current
+directory: a Windows service, a launchd job on macOS, or an OpenRC or SysV
+init script on Linux (with systemd, use guvnor systemd install). The service
+starts at boot, is restarted if guvnor crashes, and stops its apps with the
+service. The server log is written to guvnor-service.log in the project
+directory (SysV: server.log in the state directory, as guvnor daemon).
+
+- service install     # Install the service for this project (as Administrator or root)
+- service start       # Start it
+- service stop        # Stop it and its apps
+- service uninstall   # Stop and remove it
+
+On macOS, a user installs a launch agent started at login, root a launch
+daemon started at boot. On Linux the init system is detected; --init picks
+another. Use --name to install several projects side by side.`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the service for the project in the current directory",
+	Args:  cobra.NoArgs,
+	Run:   runServiceInstall,
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the service",
+	Args:  cobra.NoArgs,
+	Run:   runServiceAction("Uninstalled", removeService),
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the service",
+	Args:  cobra.NoArgs,
+	Run:   runServiceAction("Started", startService),
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the service",
+	Args:  cobra.NoArgs,
+	Run:   runServiceAction("Stopped", stopService),
+}
+
+// serviceRunCmd is what the service manager executes
+var serviceRunCmd = &cobra.Command{
+	Use:    "run",
+	Short:  "Run the server under the service manager",
+	Args:   cobra.NoArgs,
+	Hidden: true,
+	Run:    runServiceRun,
+}
+
+func init() {
+	serviceCmd.PersistentFlags().String("name", defaultServiceName, "service name")
+	serviceRunCmd.Flags().String("dir", "", "project directory")
+
+	serviceCmd.AddCommand(serviceInstallCmd)
+	serviceCmd.AddCommand(serviceUninstallCmd)
+	serviceCmd.AddCommand(serviceStartCmd)
+	serviceCmd.AddCommand(serviceStopCmd)
+	serviceCmd.AddCommand(serviceRunCmd)
+	rootCmd.AddCommand(serviceCmd)
+}
+
+func runServiceInstall(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+
+	// Services start in the system directory, so paths are recorded absolute
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get working directory: %v\n", err)
+		os.Exit(1)
+	}
+	var configPath string
+	if configFile != "" {
+		if configPath, err = filepath.Abs(configFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to resolve config path: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Fail now rather than when the service starts
+	if _, err := loadConfig(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := installService(name, dir, configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to install service %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Installed service %s for %s\n", name, dir)
+	fmt.Printf("Start it with: guvnor service start --name %s\n", name)
+}
+
+// runServiceAction runs one of the service manager operations on the named service
+func runServiceAction(done string, action func(name string) error) func(*cobra.Command, []string) {
+	return func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		if err := action(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Service %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s service %s\n", done, name)
+	}
+}
+
+func runServiceRun(cmd *cobra.Command, args []string) {
+	dir, _ := cmd.Flags().GetString("dir")
+	if dir != "" {
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to enter project directory: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Services have no console to log to
+	logFile, err := os.OpenFile(serviceLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	log.SetOutput(logFile)
+	os.Stdout, os.Stderr = logFile, logFile
+
+	runStart(cmd, nil)
+}
+
+// shutdownControl connects runStart to whatever asks the server to stop
+type shutdownControl struct {
+	requested <-chan struct{} // Closed when the server should stop
+	started   func()          // The server is up
+	stopped   func()          // The server has shut down
+}
+
+// signalShutdown stops the server on an interrupt or termination signal
+func signalShutdown() shutdownControl {
+	requested := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		close(requested)
+	}()
+	return shutdownControl{requested: requested, started: func() {}, stopped: func() {}}
+}
@@ -0,0 +1,242 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/initscript"
+)
+
+var (
+	serviceInit  string // --init, detected when empty
+	serviceRunAs string // --run-as
+)
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceInit, "init", "", "init system: launchd, openrc or sysv (detected by default)")
+	serviceInstallCmd.Flags().StringVar(&serviceRunAs, "run-as", "", "user the server runs as (launchd daemons, OpenRC and SysV; default root)")
+}
+
+// shutdownRequests stops the server on signals
+func shutdownRequests() shutdownControl {
+	return signalShutdown()
+}
+
+// initSystem returns the init system services are installed for
+func initSystem() (string, error) {
+	if serviceInit != "" {
+		return serviceInit, nil
+	}
+	switch system := initscript.Detect(); system {
+	case initscript.Systemd:
+		return "", errors.New("this machine runs systemd, install with: guvnor systemd install (or pass --init)")
+	case "":
+		return "", errors.New("no supported init system found, pass --init launchd, openrc or sysv")
+	default:
+		return system, nil
+	}
+}
+
+// serviceFile returns the path of the service's launchd job or init script
+func serviceFile(system, name string) (string, error) {
+	switch system {
+	case initscript.Launchd:
+		label := initscript.Options{Name: name}.Label()
+		if os.Geteuid() == 0 {
+			return filepath.Join("/Library/LaunchDaemons", label+".plist"), nil
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+	case initscript.OpenRC, initscript.SysV:
+		return filepath.Join("/etc/init.d", name), nil
+	}
+	return "", fmt.Errorf("unsupported init system %q (use %s, %s or %s)", system, initscript.Launchd, initscript.OpenRC, initscript.SysV)
+}
+
+// launchdDomain is the launchd domain of the jobs installed by this user
+func launchdDomain() string {
+	if os.Geteuid() == 0 {
+		return "system"
+	}
+	return "gui/" + strconv.Itoa(os.Getuid())
+}
+
+func installService(name, dir, configPath string) error {
+	system, err := initSystem()
+	if err != nil {
+		return err
+	}
+	path, err := serviceFile(system, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("service already exists at %s, uninstall it first", path)
+	}
+	if system == initscript.Launchd && serviceRunAs != "" && os.Geteuid() != 0 {
+		return errors.New("--run-as needs a launch daemon, install as root")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate guvnor binary: %w", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("failed to locate guvnor binary: %w", err)
+	}
+	opts := initscript.Options{
+		Name:       name,
+		Executable: exe,
+		WorkingDir: dir,
+		ConfigPath: configPath,
+		User:       serviceRunAs,
+		Path:       os.Getenv("PATH"), // So the apps find what they find from this shell
+	}
+	if system != initscript.SysV {
+		opts.LogPath = filepath.Join(dir, serviceLogFile)
+	}
+	content, err := initscript.File(system, opts)
+	if err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0755)
+	if system == initscript.Launchd {
+		mode = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		return fmt.Errorf("failed to write %s (run as root): %w", path, err)
+	}
+	fmt.Printf("Wrote %s\n", path)
+
+	// launchd starts jobs at load, at boot or login; init scripts are enabled
+	switch system {
+	case initscript.OpenRC:
+		err = runInitCommand("rc-update", "add", name, "default")
+	case initscript.SysV:
+		err = enableSysV(name)
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func removeService(name string) error {
+	system, err := initSystem()
+	if err != nil {
+		return err
+	}
+	path, err := serviceFile(system, name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service is not installed at %s", path)
+	}
+
+	// A launchd job that is not loaded cannot be booted out
+	if err := stopService(name); err != nil && system != initscript.Launchd {
+		return err
+	}
+	switch system {
+	case initscript.OpenRC:
+		err = runInitCommand("rc-update", "del", name, "default")
+	case initscript.SysV:
+		err = disableSysV(name)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func startService(name string) error {
+	system, err := initSystem()
+	if err != nil {
+		return err
+	}
+	path, err := serviceFile(system, name)
+	if err != nil {
+		return err
+	}
+	switch system {
+	case initscript.Launchd:
+		return runInitCommand("launchctl", "bootstrap", launchdDomain(), path)
+	case initscript.OpenRC:
+		return runInitCommand("rc-service", name, "start")
+	default:
+		return runInitCommand(path, "start")
+	}
+}
+
+func stopService(name string) error {
+	system, err := initSystem()
+	if err != nil {
+		return err
+	}
+	path, err := serviceFile(system, name)
+	if err != nil {
+		return err
+	}
+	switch system {
+	case initscript.Launchd:
+		label := initscript.Options{Name: name}.Label()
+		return runInitCommand("launchctl", "bootout", launchdDomain()+"/"+label)
+	case initscript.OpenRC:
+		return runInitCommand("rc-service", name, "stop")
+	default:
+		return runInitCommand(path, "stop")
+	}
+}
+
+// enableSysV links a SysV init script into the runlevels, with the tool of
+// the distribution
+func enableSysV(name string) error {
+	if _, err := exec.LookPath("update-rc.d"); err == nil {
+		return runInitCommand("update-rc.d", name, "defaults")
+	}
+	if _, err := exec.LookPath("chkconfig"); err == nil {
+		return runInitCommand("chkconfig", "--add", name)
+	}
+	fmt.Printf("Neither update-rc.d nor chkconfig found, link /etc/init.d/%s into the runlevels to start it at boot\n", name)
+	return nil
+}
+
+// disableSysV removes a SysV init script from the runlevels
+func disableSysV(name string) error {
+	if _, err := exec.LookPath("update-rc.d"); err == nil {
+		return runInitCommand("update-rc.d", "-f", name, "remove")
+	}
+	if _, err := exec.LookPath("chkconfig"); err == nil {
+		return runInitCommand("chkconfig", "--del", name)
+	}
+	return nil
+}
+
+// runInitCommand runs a command of the init system, its output on the terminal
+func runInitCommand(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", filepath.Base(name), strings.Join(args, " "), err)
+	}
+	return nil
+}
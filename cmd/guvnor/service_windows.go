@@ -0,0 +1,220 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// serviceWait bounds how long start and stop wait for the service to get there;
+// stopping includes the apps' graceful shutdown
+const serviceWait = 2 * time.Minute
+
+// serviceHandler reports the server's state to the service manager and passes
+// its stop requests on
+type serviceHandler struct {
+	requested chan struct{}
+	started   chan struct{}
+	stopped   chan struct{}
+}
+
+// shutdownRequests stops the server when the service manager asks, when guvnor
+// runs as a service, and on signals otherwise
+func shutdownRequests() shutdownControl {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return signalShutdown()
+	}
+
+	h := &serviceHandler{
+		requested: make(chan struct{}),
+		started:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		// The name is ignored for services running in their own process
+		if err := svc.Run(defaultServiceName, h); err != nil {
+			log.WithError(err).Error("Service manager connection failed")
+		}
+	}()
+
+	return shutdownControl{
+		requested: h.requested,
+		started:   func() { close(h.started) },
+		stopped: func() {
+			close(h.stopped)
+			// Let the service manager see the service stopped before exiting
+			<-finished
+		},
+	}
+}
+
+// Execute implements svc.Handler
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+
+	started := h.started
+	stopping := false
+	for {
+		select {
+		case <-started:
+			started = nil
+			if !stopping {
+				status <- svc.Status{State: svc.Running, Accepts: accepts}
+			}
+		case <-h.stopped:
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				if !stopping {
+					stopping = true
+					status <- svc.Status{State: svc.StopPending}
+					close(h.requested)
+				}
+			}
+		}
+	}
+}
+
+func installService(name, dir, configPath string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate guvnor binary: %w", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf("service already exists, uninstall it first")
+	}
+
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName: fmt.Sprintf("Guv'nor (%s)", name),
+		Description: fmt.Sprintf("Guv'nor process manager for %s", dir),
+		StartType:   mgr.StartAutomatic,
+	}, serviceArgs(name, dir, configPath)...)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	defer s.Close()
+
+	// Restart guvnor after crashes, backing off; the count resets after a day
+	if err := s.SetRecoveryActions(serviceRecoveryActions, uint32((24 * time.Hour).Seconds())); err != nil {
+		s.Delete()
+		return fmt.Errorf("failed to set recovery actions: %w", err)
+	}
+	return nil
+}
+
+// serviceRecoveryActions restart guvnor after it crashed, backing off
+var serviceRecoveryActions = []mgr.RecoveryAction{
+	{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: 30 * time.Second},
+	{Type: mgr.ServiceRestart, Delay: time.Minute},
+}
+
+// serviceArgs returns the arguments the service manager runs guvnor with for
+// the service called name, serving the project in dir
+func serviceArgs(name, dir, configPath string) []string {
+	args := []string{"service", "run", "--name", name, "--dir", dir}
+	if configPath != "" {
+		args = append(args, "--config", configPath)
+	}
+	return args
+}
+
+func removeService(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		if err := controlService(s, svc.Stop, svc.Stopped); err != nil {
+			return err
+		}
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("failed to remove service: %w", err)
+		}
+		return nil
+	})
+}
+
+func startService(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("failed to start service: %w", err)
+		}
+		return waitService(s, svc.Running)
+	})
+}
+
+func stopService(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		return controlService(s, svc.Stop, svc.Stopped)
+	})
+}
+
+// withService opens the named service for fn
+func withService(name string, fn func(s *mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to service manager (run as Administrator): %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service is not installed: %w", err)
+	}
+	defer s.Close()
+	return fn(s)
+}
+
+// controlService sends a control request unless the service is already in the
+// state it leads to, then waits for that state
+func controlService(s *mgr.Service, c svc.Cmd, to svc.State) error {
+	status, err := s.Query()
+	if err != nil {
+		return fmt.Errorf("failed to query service: %w", err)
+	}
+	if status.State == to {
+		return nil
+	}
+	if _, err := s.Control(c); err != nil && err != windows.ERROR_SERVICE_NOT_ACTIVE {
+		return fmt.Errorf("failed to send control request: %w", err)
+	}
+	return waitService(s, to)
+}
+
+// waitService polls the service until it reaches state
+func waitService(s *mgr.Service, state svc.State) error {
+	deadline := time.Now().Add(serviceWait)
+	for {
+		status, err := s.Query()
+		if err != nil {
+			return fmt.Errorf("failed to query service: %w", err)
+		}
+		if status.State == state {
+			return nil
+		}
+		if status.State == svc.Stopped {
+			return fmt.Errorf("service stopped, see %s in the project directory", serviceLogFile)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the service")
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
@@ -0,0 +1,125 @@
+//go:build windows
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+func TestServiceArgs(t *testing.T) {
+	tests := []struct {
+		name, dir, config string
+		expected          string
+	}{
+		{"guvnor", `C:\apps\shop`, "", `service run --name guvnor --dir C:\apps\shop`},
+		{"shop", `C:\Program Files\shop`, `C:\Program Files\shop\guvnor.yaml`, `service run --name shop --dir C:\Program Files\shop --config C:\Program Files\shop\guvnor.yaml`},
+	}
+	for _, tt := range tests {
+		args := serviceArgs(tt.name, tt.dir, tt.config)
+		if got := strings.Join(args, " "); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+
+		// The arguments stay whole and reach service run as the flags it defines
+		cmd, rest, err := rootCmd.Find(args)
+		if err != nil || cmd != serviceRunCmd {
+			t.Fatalf("Expected service run, got %v (%v)", cmd, err)
+		}
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Fatalf("Failed to parse %q: %v", rest, err)
+		}
+		name, _ := cmd.Flags().GetString("name")
+		dir, _ := cmd.Flags().GetString("dir")
+		if name != tt.name || dir != tt.dir || configFile != tt.config {
+			t.Errorf("Expected name %q, dir %q and config %q, got %q, %q and %q", tt.name, tt.dir, tt.config, name, dir, configFile)
+		}
+		configFile = ""
+	}
+}
+
+func TestServiceHandler(t *testing.T) {
+	h := &serviceHandler{
+		requested: make(chan struct{}),
+		started:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	requests := make(chan svc.ChangeRequest)
+	status := make(chan svc.Status, 8)
+	done := make(chan uint32, 1)
+	go func() {
+		_, code := h.Execute(nil, requests, status)
+		done <- code
+	}()
+
+	expect := func(state svc.State) {
+		t.Helper()
+		select {
+		case s := <-status:
+			if s.State != state {
+				t.Fatalf("Expected state %d, got %d", state, s.State)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected state %d, got none", state)
+		}
+	}
+
+	expect(svc.StartPending)
+	close(h.started)
+	expect(svc.Running)
+	requests <- svc.ChangeRequest{Cmd: svc.Interrogate, CurrentStatus: svc.Status{State: svc.Running}}
+	expect(svc.Running)
+
+	// Stop asks the server to shut down once, however often it is sent
+	requests <- svc.ChangeRequest{Cmd: svc.Stop}
+	expect(svc.StopPending)
+	select {
+	case <-h.requested:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the server to be asked to stop")
+	}
+	requests <- svc.ChangeRequest{Cmd: svc.Shutdown}
+	select {
+	case s := <-status:
+		t.Errorf("Expected no further state, got %d", s.State)
+	default:
+	}
+
+	close(h.stopped)
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Execute to return once the server stopped")
+	}
+}
+
+func TestServiceHandlerStopWhileStarting(t *testing.T) {
+	h := &serviceHandler{
+		requested: make(chan struct{}),
+		started:   make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	requests := make(chan svc.ChangeRequest)
+	status := make(chan svc.Status, 8)
+	go h.Execute(nil, requests, status)
+
+	<-status // StartPending
+	requests <- svc.ChangeRequest{Cmd: svc.Stop}
+	if s := <-status; s.State != svc.StopPending {
+		t.Fatalf("Expected StopPending, got %d", s.State)
+	}
+	// A server that finishes starting while stopping is not reported running
+	close(h.started)
+	close(h.stopped)
+	select {
+	case s := <-status:
+		t.Errorf("Expected no further state, got %d", s.State)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
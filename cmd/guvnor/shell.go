@@ -0,0 +1,635 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chzyer/readline"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Interactive process management shell",
+	Long: `Interactive shell for managing the apps of the running server, locally or
+through --host and --context like every other command.
+
+  status [app]         logs [app...] [-n N] [-f]
+  start <app>          events [app...]
+  stop [app]           scale <app>=<n>...
+  restart [app]        reset <app>
+  reload [app]         help, quit
+
+Tab completes commands and app names, arrow keys and Ctrl+R search the
+history, which is kept in ` + "`$XDG_STATE_HOME/guvnor/shell_history`" + ` (or
+$GUVNOR_HISTORY). Ctrl+C stops a running command, Ctrl+D leaves the shell.`,
+	Args: cobra.NoArgs,
+	Run:  runShell,
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
+
+// HistoryEnv overrides where the shell keeps its history; "off" keeps none
+const HistoryEnv = "GUVNOR_HISTORY"
+
+// shellAppsTTL is how long the app names used for completion are reused
+const shellAppsTTL = 10 * time.Second
+
+// shellCommand is a command of the interactive shell
+type shellCommand struct {
+	name  string
+	usage string
+	help  string
+	apps  bool // Arguments are app names, completed with tab
+	run   func(sh *shell, ctx context.Context, args []string) error
+}
+
+// shellCommands are the commands of the shell; help and quit are handled by
+// the shell itself
+var shellCommands = []shellCommand{
+	{"status", "[app]", "Show the processes of every app, or one", true, (*shell).status},
+	{"start", "<app>", "Start an app", true, (*shell).start},
+	{"stop", "[app]", "Stop an app, or every process", true, (*shell).stop},
+	{"restart", "[app] [--rolling]", "Restart an app, or every running app", true, (*shell).restart},
+	{"reload", "[app]", "Reload the configuration, or send an app its reload signal", true, (*shell).reload},
+	{"scale", "<app>=<n>...", "Run n instances of apps", true, (*shell).scale},
+	{"reset", "<app>", "Clear the restart counter of an app", true, (*shell).reset},
+	{"logs", "[app...] [-n N] [-f]", "Show recent logs, filtered by --level, --grep and --since; -f follows them", true, (*shell).logs},
+	{"events", "[app...]", "Follow lifecycle events until Ctrl+C", true, (*shell).events},
+	{"help", "[command]", "Show the commands, or how to use one", false, nil},
+	{"quit", "", "Leave the shell (also exit, or Ctrl+D)", false, nil},
+}
+
+// shellAliases map alternative names to shell commands
+var shellAliases = map[string]string{"ps": "status", "exit": "quit", "?": "help"}
+
+// findShellCommand returns the shell command called name, or one of its aliases
+func findShellCommand(name string) *shellCommand {
+	if alias, ok := shellAliases[name]; ok {
+		name = alias
+	}
+	for i := range shellCommands {
+		if shellCommands[i].name == name {
+			return &shellCommands[i]
+		}
+	}
+	return nil
+}
+
+// errUnknownShellCommand is returned for a line naming no shell command
+var errUnknownShellCommand = errors.New("unknown command")
+
+// parseShellLine splits a command line and finds the command it names,
+// returning it with its arguments; the command is nil for a blank line
+func parseShellLine(line string) (*shellCommand, []string, error) {
+	args, err := splitShellArgs(line)
+	if err != nil || len(args) == 0 {
+		return nil, nil, err
+	}
+	command := findShellCommand(args[0])
+	if command == nil {
+		return nil, nil, fmt.Errorf("%w: %s", errUnknownShellCommand, args[0])
+	}
+	return command, args[1:], nil
+}
+
+// shell is an interactive session with the running server. Every command is
+// a request to the management API, so the shell never stops on an error.
+type shell struct {
+	server *client.Client
+	out    io.Writer
+
+	apps   []string // App names for completion
+	appsAt time.Time
+}
+
+func runShell(cmd *cobra.Command, args []string) {
+	sh := &shell{
+		server: requireServer("The shell manages a running server, start it with: guvnor start"),
+		out:    os.Stdout,
+	}
+
+	historyFile := shellHistoryPath()
+	if historyFile != "" {
+		if err := os.MkdirAll(filepath.Dir(historyFile), 0700); err != nil {
+			historyFile = ""
+		}
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:            shellPrompt(sh.server),
+		HistoryFile:       historyFile,
+		HistorySearchFold: true,
+		AutoComplete:      sh,
+		InterruptPrompt:   "^C",
+		EOFPrompt:         "quit",
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to start the shell: %v\n", err)
+		os.Exit(1)
+	}
+	defer rl.Close()
+
+	fmt.Printf("Guv'nor Interactive Shell, connected to %s\n", describeServer(sh.server))
+	fmt.Println("Type 'help' for commands, 'quit' to exit")
+	fmt.Println()
+
+	for {
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			continue
+		}
+		if err != nil { // io.EOF on Ctrl+D
+			return
+		}
+		if !sh.execute(line) {
+			return
+		}
+	}
+}
+
+// execute runs a command line, returning false when the shell should exit
+func (sh *shell) execute(line string) bool {
+	command, args, err := parseShellLine(line)
+	switch {
+	case errors.Is(err, errUnknownShellCommand):
+		fmt.Fprintf(os.Stderr, "Error: %v. Type 'help' for available commands.\n", err)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	case command == nil:
+	case command.name == "quit":
+		return false
+	case command.name == "help":
+		sh.help(args)
+	default:
+		// Ctrl+C cancels the command rather than leaving the shell
+		ctx, cancel := clientContext()
+		err := command.run(sh, ctx, args)
+		cancel()
+		breakGlass.enabled, breakGlass.reason = false, ""
+		sh.server.WithBreakGlass("")
+		switch {
+		case errors.Is(err, pflag.ErrHelp):
+		case errors.Is(err, context.Canceled):
+			fmt.Fprintln(sh.out)
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Error: %s\n", describeClientError(err))
+		}
+	}
+	return true
+}
+
+// help lists the commands, or describes the ones named
+func (sh *shell) help(names []string) {
+	if len(names) == 0 {
+		fmt.Fprintln(sh.out, "Available commands:")
+	}
+	for _, command := range shellCommands {
+		if len(names) > 0 && !containsCommand(names, command.name) {
+			continue
+		}
+		usage := strings.TrimSpace(command.name + " " + command.usage)
+		fmt.Fprintf(sh.out, "  %-26s %s\n", usage, command.help)
+	}
+}
+
+// containsCommand reports whether names include the command or one of its aliases
+func containsCommand(names []string, command string) bool {
+	for _, name := range names {
+		if found := findShellCommand(name); found != nil && found.name == command {
+			return true
+		}
+	}
+	return false
+}
+
+func (sh *shell) status(ctx context.Context, args []string) error {
+	processes, err := sh.server.GetStatus(ctx)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		var filtered []process.ProcessInfo
+		for _, info := range processes {
+			for _, name := range args {
+				if info.App == name || info.Name == name {
+					filtered = append(filtered, info)
+					break
+				}
+			}
+		}
+		processes = filtered
+	}
+	if len(processes) == 0 {
+		fmt.Fprintln(sh.out, "No processes found")
+		return nil
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].Name < processes[j].Name })
+	printProcesses(processes)
+	return nil
+}
+
+func (sh *shell) start(ctx context.Context, args []string) error {
+	names, err := parseShellFlags("start", args, breakGlassFlags)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("usage: start <app>")
+	}
+	for _, name := range names {
+		progress := newJobProgress(fmt.Sprintf("Starting %s", name))
+		result, err := withBreakGlass(sh.server).StartApp(ctx, name, progress.observe)
+		progress.finish()
+		if err != nil {
+			return fmt.Errorf("failed to start %s: %w", name, err)
+		}
+		fmt.Fprintf(sh.out, "%s started: %s\n", name, describeInstances(result.Instances))
+	}
+	return nil
+}
+
+func (sh *shell) stop(ctx context.Context, args []string) error {
+	var results []api.InstanceResult
+	var err error
+	switch len(args) {
+	case 0:
+		progress := newJobProgress("Stopping all processes")
+		results, err = sh.server.StopProcesses(ctx, progress.observe)
+		progress.finish()
+	case 1:
+		progress := newJobProgress(fmt.Sprintf("Stopping %s", args[0]))
+		var result *api.AppResult
+		result, err = sh.server.StopApp(ctx, args[0], progress.observe)
+		progress.finish()
+		if result != nil {
+			results = result.Instances
+		}
+	default:
+		return fmt.Errorf("usage: stop [app]")
+	}
+	if len(results) == 0 {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(sh.out, "No running processes found")
+		return nil
+	}
+	printStopResults(results)
+	return err
+}
+
+func (sh *shell) restart(ctx context.Context, args []string) error {
+	var rolling bool
+	names, err := parseShellFlags("restart", args, func(flags *pflag.FlagSet) {
+		flags.BoolVar(&rolling, "rolling", false, "replace instances one at a time, waiting for each to become healthy")
+		breakGlassFlags(flags)
+	})
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		if rolling {
+			return fmt.Errorf("--rolling requires an app name")
+		}
+		processes, err := sh.server.GetStatus(ctx)
+		if err != nil {
+			return err
+		}
+		names = runningApps(processes)
+		if len(names) == 0 {
+			fmt.Fprintln(sh.out, "No running apps to restart")
+			return nil
+		}
+	}
+	for _, name := range names {
+		title := fmt.Sprintf("Restarting %s", name)
+		if rolling {
+			title = fmt.Sprintf("Rolling restart of %s (waiting for replacements to become healthy)", name)
+		}
+		progress := newJobProgress(title)
+		result, err := withBreakGlass(sh.server).Restart(ctx, name, rolling, progress.observe)
+		progress.finish()
+		if err != nil {
+			return fmt.Errorf("restart of %s failed: %w", name, err)
+		}
+		fmt.Fprintf(sh.out, "Restarted %s: %s\n", name, describeInstances(result.Instances))
+	}
+	return nil
+}
+
+func (sh *shell) reload(ctx context.Context, args []string) error {
+	names, err := parseShellFlags("reload", args, breakGlassFlags)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		progress := newJobProgress("Reloading configuration")
+		changes, err := withBreakGlass(sh.server).ReloadConfig(ctx, progress.observe)
+		progress.finish()
+		if changes != nil {
+			describeChanges(changes)
+			sh.appsAt = time.Time{}
+		}
+		return err
+	}
+	for _, name := range names {
+		progress := newJobProgress(fmt.Sprintf("Reloading %s", name))
+		err := withBreakGlass(sh.server).Reload(ctx, name, progress.observe)
+		progress.finish()
+		if err != nil {
+			return fmt.Errorf("reload of %s failed: %w", name, err)
+		}
+		fmt.Fprintf(sh.out, "Reload signal sent to %s\n", name)
+	}
+	return nil
+}
+
+func (sh *shell) scale(ctx context.Context, args []string) error {
+	formation, err := parseShellFlags("scale", args, breakGlassFlags)
+	if err != nil {
+		return err
+	}
+	if len(formation) == 0 {
+		return fmt.Errorf("usage: scale <app>=<n>...")
+	}
+	if _, err := api.ParseFormation(strings.Join(formation, ",")); err != nil {
+		return err
+	}
+	progress := newJobProgress(fmt.Sprintf("Scaling %s", strings.Join(formation, " ")))
+	err = withBreakGlass(sh.server).Scale(ctx, strings.Join(formation, ","), progress.observe)
+	progress.finish()
+	if err != nil {
+		return fmt.Errorf("scaling failed: %w", err)
+	}
+	fmt.Fprintf(sh.out, "Scaled %s\n", strings.Join(formation, " "))
+	return nil
+}
+
+func (sh *shell) reset(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: reset <app>")
+	}
+	reset, err := sh.server.ResetRestarts(ctx, args[0])
+	if err != nil {
+		return fmt.Errorf("reset of %s failed: %w", args[0], err)
+	}
+	fmt.Fprintf(sh.out, "Restart counter cleared for %s\n", strings.Join(reset, ", "))
+	return nil
+}
+
+func (sh *shell) logs(ctx context.Context, args []string) error {
+	var lines int
+	var follow bool
+	var query client.LogQuery
+	names, err := parseShellFlags("logs", args, func(flags *pflag.FlagSet) {
+		flags.IntVarP(&lines, "lines", "n", 20, "number of recent lines to show")
+		flags.BoolVarP(&follow, "follow", "f", false, "follow new lines until Ctrl+C")
+		flags.StringVar(&query.Level, "level", "", "only entries at or above this level")
+		flags.StringVar(&query.Grep, "grep", "", "only entries matching this regular expression")
+		flags.StringVar(&query.Since, "since", "", "only entries newer than a duration or time")
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		query.Processes = append(query.Processes, logs.SplitProcesses(name)...)
+	}
+	if _, err := logs.ParseFilter(query.Level, query.Grep, query.Since, "", time.Now()); err != nil {
+		return err
+	}
+
+	color := os.Getenv("NO_COLOR") == "" && isTerminal(os.Stdout)
+	entries, err := sh.server.GetLogs(ctx, lines, query)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fmt.Fprintln(sh.out, logs.Format(entry, color))
+	}
+	if !follow {
+		return nil
+	}
+	fmt.Fprintln(sh.out, "=== Following logs (Ctrl+C to stop) ===")
+	return sh.server.StreamLogs(ctx, query, func(entries []logs.LogEntry) {
+		for _, entry := range entries {
+			fmt.Fprintln(sh.out, logs.Format(entry, color))
+		}
+	})
+}
+
+func (sh *shell) events(ctx context.Context, args []string) error {
+	var query client.EventQuery
+	for _, arg := range args {
+		query.Apps = append(query.Apps, logs.SplitProcesses(arg)...)
+	}
+	fmt.Fprintln(sh.out, "=== Following events (Ctrl+C to stop) ===")
+	return sh.server.StreamEvents(ctx, query, func(event events.Event, dropped int) {
+		if dropped > 0 {
+			fmt.Fprintf(sh.out, "... %d events skipped, the connection fell behind\n", dropped)
+		}
+		fmt.Fprintf(sh.out, "%s %-19s %s\n", event.Time.Local().Format(time.TimeOnly), event.Type, event.Message)
+	})
+}
+
+// Do completes the line up to pos for readline, see completeShellLine
+func (sh *shell) Do(line []rune, pos int) ([][]rune, int) {
+	suffixes, length := completeShellLine(string(line[:pos]), sh.appNames)
+	completions := make([][]rune, len(suffixes))
+	for i, suffix := range suffixes {
+		completions[i] = []rune(suffix)
+	}
+	return completions, length
+}
+
+// completeShellLine completes the command name at the start of text and app
+// names in the arguments of commands taking them, which appNames is only
+// asked for then. It returns what may follow the word being typed and the
+// length of that word in runes.
+func completeShellLine(text string, appNames func() []string) ([]string, int) {
+	fields := strings.Fields(text)
+	word := ""
+	if len(fields) > 0 && !strings.HasSuffix(text, " ") {
+		word = fields[len(fields)-1]
+		fields = fields[:len(fields)-1]
+	}
+
+	var candidates []string
+	if len(fields) == 0 || (len(fields) == 1 && findShellCommand(fields[0]) == findShellCommand("help")) {
+		for _, command := range shellCommands {
+			candidates = append(candidates, command.name)
+		}
+	} else if command := findShellCommand(fields[0]); command != nil && command.apps && !strings.HasPrefix(word, "-") {
+		candidates = appNames()
+		if command.name == "scale" {
+			for i, name := range candidates {
+				candidates[i] = name + "="
+			}
+		}
+	}
+
+	var suffixes []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			suffix := candidate[len(word):]
+			if !strings.HasSuffix(candidate, "=") {
+				suffix += " "
+			}
+			suffixes = append(suffixes, suffix)
+		}
+	}
+	return suffixes, len([]rune(word))
+}
+
+// appNames returns the names of the apps of the server, asking it again once
+// shellAppsTTL has passed so apps registered meanwhile are completed
+func (sh *shell) appNames() []string {
+	if time.Since(sh.appsAt) < shellAppsTTL {
+		return append([]string(nil), sh.apps...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	processes, err := sh.server.GetStatus(ctx)
+	if err != nil {
+		return append([]string(nil), sh.apps...)
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, info := range processes {
+		app := info.App
+		if app == "" {
+			app = info.Name
+		}
+		if !seen[app] {
+			seen[app] = true
+			names = append(names, app)
+		}
+	}
+	sort.Strings(names)
+	sh.apps, sh.appsAt = names, time.Now()
+	return append([]string(nil), names...)
+}
+
+// runningApps returns the sorted names of the apps with a running instance
+func runningApps(processes []process.ProcessInfo) []string {
+	var apps []string
+	seen := make(map[string]bool)
+	for _, info := range processes {
+		app := info.App
+		if app == "" {
+			app = info.Name
+		}
+		if info.Status == string(process.StatusRunning) && !seen[app] {
+			seen[app] = true
+			apps = append(apps, app)
+		}
+	}
+	sort.Strings(apps)
+	return apps
+}
+
+// parseShellFlags parses the flags of a shell command, returning its other arguments
+func parseShellFlags(name string, args []string, define func(*pflag.FlagSet)) ([]string, error) {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.SetOutput(os.Stdout)
+	define(flags)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return flags.Args(), nil
+}
+
+// breakGlassFlags defines --break-glass and --reason, as the commands overriding freeze windows have
+func breakGlassFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&breakGlass.enabled, "break-glass", false, "run even during a freeze window (recorded in the audit log)")
+	flags.StringVar(&breakGlass.reason, "reason", "", "why the freeze window is overridden, recorded with --break-glass")
+}
+
+// splitShellArgs splits a command line into words, keeping what is quoted
+// with ' or " together, e.g. logs --grep "timed out"
+func splitShellArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// shellHistoryPath returns the history file of the shell: $GUVNOR_HISTORY, or
+// guvnor/shell_history in $XDG_STATE_HOME or ~/.local/state; "" keeps none
+func shellHistoryPath() string {
+	if path := os.Getenv(HistoryEnv); path != "" {
+		if path == "off" {
+			return ""
+		}
+		return path
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "guvnor", "shell_history")
+}
+
+// shellPrompt names the server in the prompt when it is a remote one
+func shellPrompt(server *client.Client) string {
+	if _, selected, _ := remoteServer(); selected {
+		if u, err := url.Parse(server.Host()); err == nil {
+			return fmt.Sprintf("guvnor@%s> ", u.Hostname())
+		}
+	}
+	return "guvnor> "
+}
+
+// describeServer names the server the shell talks to
+func describeServer(server *client.Client) string {
+	if socket := server.Socket(); socket != "" {
+		return socket
+	}
+	return server.Host()
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseShellLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		command string // "" for no command
+		args    string // Joined with |
+		err     string
+	}{
+		{"", "", "", ""},
+		{"   \t ", "", "", ""},
+		{"status", "status", "", ""},
+		{"ps web", "status", "web", ""},
+		{"  restart   web  --rolling ", "restart", "web|--rolling", ""},
+		{`logs web --grep "timed out"`, "logs", "web|--grep|timed out", ""},
+		{`logs --grep 'say "hi"'`, "logs", `--grep|say "hi"`, ""},
+		{`logs --grep ""`, "logs", "--grep|", ""},
+		{"exit", "quit", "", ""},
+		{"? scale", "help", "scale", ""},
+		{"deploy web", "", "", "unknown command: deploy"},
+		{`logs --grep "timed out`, "", "", `unterminated " quote`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			command, args, err := parseShellLine(tt.line)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("Expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			name := ""
+			if command != nil {
+				name = command.name
+			}
+			if name != tt.command || strings.Join(args, "|") != tt.args {
+				t.Errorf("Expected %q with %q, got %q with %q", tt.command, tt.args, name, strings.Join(args, "|"))
+			}
+		})
+	}
+
+	if _, _, err := parseShellLine("deploy"); !errors.Is(err, errUnknownShellCommand) {
+		t.Errorf("Expected errUnknownShellCommand, got %v", err)
+	}
+}
+
+func TestCompleteShellLine(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string // Suffixes joined with |
+		length   int
+		asked    bool // Whether app names are needed
+	}{
+		{"", "status |start |stop |restart |reload |scale |reset |logs |events |help |quit ", 0, false},
+		{"st", "atus |art |op ", 2, false},
+		{"  re", "start |load |set ", 2, false},
+		{"help sc", "ale ", 2, false},
+		{"? q", "uit ", 1, false},
+		{"status ", "api |web |worker ", 0, true},
+		{"ps w", "eb |orker ", 1, true},
+		{"logs api w", "eb |orker ", 1, true},
+		{"scale a", "pi=", 1, true},
+		{"restart --ro", "", 4, false},
+		{"help ", "status |start |stop |restart |reload |scale |reset |logs |events |help |quit ", 0, false},
+		{"quit ", "", 0, false},
+		{"deploy w", "", 1, false},
+		{"status x", "", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			asked := false
+			appNames := func() []string {
+				asked = true
+				return []string{"api", "web", "worker"}
+			}
+			suffixes, length := completeShellLine(tt.text, appNames)
+			if got := strings.Join(suffixes, "|"); got != tt.expected || length != tt.length {
+				t.Errorf("Expected %q replacing %d, got %q replacing %d", tt.expected, tt.length, got, length)
+			}
+			if asked != tt.asked {
+				t.Errorf("Expected app names to be asked for: %v, got %v", tt.asked, asked)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/procfile"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Reconcile guvnor.yaml with the Procfile",
+	Long: `Bring the apps in guvnor.yaml in line with the Procfile:
+- processes missing from guvnor.yaml are added
+- apps in both files are left as they are, so overrides in guvnor.yaml survive
+- apps no longer in the Procfile are flagged, and removed with --prune
+
+A diff of guvnor.yaml is shown and confirmed before anything is written.`,
+	Args: cobra.NoArgs,
+	Run:  runSync,
+}
+
+func init() {
+	syncCmd.Flags().Bool("prune", false, "remove apps that are no longer in the Procfile")
+	syncCmd.Flags().Bool("dry-run", false, "show the changes without writing")
+	syncCmd.Flags().BoolP("yes", "y", false, "write without asking for confirmation")
+
+	rootCmd.AddCommand(syncCmd)
+}
+
+func runSync(cmd *cobra.Command, args []string) {
+	prune, _ := cmd.Flags().GetBool("prune")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	pf, err := loadProcfile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to load Procfile: %v\n", err)
+		os.Exit(1)
+	}
+
+	configPath := "guvnor.yaml"
+	if configFile != "" {
+		configPath = configFile
+	}
+	current, err := os.ReadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to read %s: %v\n", configPath, err)
+		fmt.Fprintf(os.Stderr, "Create it with: guvnor init\n")
+		os.Exit(1)
+	}
+
+	updated, changes, err := procfile.Sync(pf, current, prune)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(changes) == 0 {
+		fmt.Printf("%s and the Procfile are in sync\n", configPath)
+		return
+	}
+
+	for _, change := range changes {
+		symbol := map[string]string{procfile.SyncAdded: "+", procfile.SyncRemoved: "-", procfile.SyncOverridden: "~"}[change.Kind]
+		note := ""
+		if change.Kind == procfile.SyncRemoved && !prune {
+			note = " (kept, use --prune to remove)"
+		}
+		fmt.Printf("  %s %-15s %-10s %s%s\n", symbol, change.Name, change.Kind, change.Detail, note)
+	}
+
+	if string(updated) == string(current) {
+		fmt.Printf("\nNothing to write to %s\n", configPath)
+		return
+	}
+
+	fmt.Printf("\n--- %s\n+++ %s (synced)\n", configPath, configPath)
+	fmt.Print(lineDiff(string(current), string(updated), 2))
+
+	if dryRun {
+		fmt.Println("\nDry run, nothing written")
+		return
+	}
+	if !yes && !confirm(fmt.Sprintf("\nWrite %s?", configPath)) {
+		fmt.Println("Aborted")
+		return
+	}
+
+	if err := writeValidatedConfig(configPath, updated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Updated %s\n", configPath)
+}
+
+// writeValidatedConfig replaces a config file after checking the new content loads
+func writeValidatedConfig(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".guvnor-sync-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if _, err := config.Load(tmp.Name()); err != nil {
+		return fmt.Errorf("synced config is invalid, %s left unchanged: %w", path, err)
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on the terminal, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// lineDiff returns the changed lines between a and b prefixed with - and +,
+// with the given number of unchanged context lines around each change
+func lineDiff(a, b string, context int) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i, j = i+1, j+1
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, line{'+', y[j]})
+			j++
+		default:
+			lines = append(lines, line{'-', x[i]})
+			i++
+		}
+	}
+
+	// Keep changed lines and their context, marking skipped stretches
+	var out strings.Builder
+	skipped := false
+	for n, l := range lines {
+		near := false
+		for k := max(0, n-context); k <= min(len(lines)-1, n+context); k++ {
+			if lines[k].op != ' ' {
+				near = true
+				break
+			}
+		}
+		if !near {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out.WriteString("@@\n")
+			skipped = false
+		}
+		out.WriteString(string(l.op) + " " + l.text + "\n")
+	}
+	return out.String()
+}
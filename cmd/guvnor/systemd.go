@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/systemd"
+)
+
+var systemdCmd = &cobra.Command{
+	Use:   "systemd",
+	Short: "Run the guvnor server as a systemd service",
+	Long: `Install a systemd unit running guvnor start for the project in the current
+directory. The unit is Type=notify: systemd considers guvnor started once its
+apps and proxy are up, and with the watchdog restarts a server whose management
+API stops answering. Stopping the unit stops the apps gracefully.
+
+- systemd install                    # /etc/systemd/system/guvnor.service (as root)
+- systemd install --run-as deploy    # Run the server as the deploy user
+- systemd install --user --now       # A user unit, started right away
+- systemd install --apps             # Also guvnor-app@.service: systemctl restart guvnor-app@web
+- systemd install --print            # Only show the units
+- systemd uninstall                  # Stop, disable and remove the units
+
+Use --name to install several projects side by side.`,
+}
+
+var systemdInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install and enable the unit for the project in the current directory",
+	Args:  cobra.NoArgs,
+	Run:   runSystemdInstall,
+}
+
+var systemdUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop, disable and remove the units",
+	Args:  cobra.NoArgs,
+	Run:   runSystemdUninstall,
+}
+
+func init() {
+	systemdCmd.PersistentFlags().String("name", defaultServiceName, "unit name")
+	systemdCmd.PersistentFlags().Bool("user", false, "a unit of the user's service manager (systemctl --user)")
+	systemdInstallCmd.Flags().String("run-as", "", "user the server runs as (system units; default root)")
+	systemdInstallCmd.Flags().Bool("apps", false, "also install a template unit controlling single apps, <name>-app@<app>.service")
+	systemdInstallCmd.Flags().Duration("watchdog", systemd.DefaultWatchdog, "restart the server when its API does not answer for this long (0 disables)")
+	systemdInstallCmd.Flags().Bool("now", false, "start the unit after enabling it")
+	systemdInstallCmd.Flags().Bool("force", false, "overwrite existing unit files")
+	systemdInstallCmd.Flags().Bool("print", false, "print the units instead of installing them")
+
+	systemdCmd.AddCommand(systemdInstallCmd, systemdUninstallCmd)
+	rootCmd.AddCommand(systemdCmd)
+}
+
+func runSystemdInstall(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	userUnit, _ := cmd.Flags().GetBool("user")
+	runAs, _ := cmd.Flags().GetString("run-as")
+	withApps, _ := cmd.Flags().GetBool("apps")
+	watchdog, _ := cmd.Flags().GetDuration("watchdog")
+	now, _ := cmd.Flags().GetBool("now")
+	force, _ := cmd.Flags().GetBool("force")
+	printOnly, _ := cmd.Flags().GetBool("print")
+
+	// Fail now rather than when the unit starts
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
+	opts, err := unitOptions(cfg, name, userUnit, runAs, watchdog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	type unitFile struct{ name, content string }
+	content, err := systemd.ServerUnit(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	units := []unitFile{{opts.ServerUnitName(), content}}
+	if withApps {
+		if content, err = systemd.AppUnit(opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		units = append(units, unitFile{opts.AppUnitName(), content})
+	}
+
+	if printOnly {
+		for i, unit := range units {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", unit.name, unit.content)
+		}
+		return
+	}
+
+	dir, err := unitDir(userUnit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create %s: %v\n", dir, err)
+		os.Exit(1)
+	}
+	for _, unit := range units {
+		path := filepath.Join(dir, unit.name)
+		if _, err := os.Stat(path); err == nil && !force {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists, uninstall it first or pass --force\n", path)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, []byte(unit.content), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+
+	enable := []string{"enable", opts.ServerUnitName()}
+	if now {
+		enable = []string{"enable", "--now", opts.ServerUnitName()}
+	}
+	for _, args := range [][]string{{"daemon-reload"}, enable} {
+		if err := systemctl(userUnit, args...); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	systemctlHint := "systemctl"
+	if userUnit {
+		systemctlHint = "systemctl --user"
+	}
+	if now {
+		fmt.Printf("Started %s, see: %s status %s\n", opts.ServerUnitName(), systemctlHint, name)
+	} else {
+		fmt.Printf("Enabled %s, start it with: %s start %s\n", opts.ServerUnitName(), systemctlHint, name)
+	}
+	if withApps {
+		fmt.Printf("Control single apps with: %s restart %s-app@<app>\n", systemctlHint, name)
+	}
+	if userUnit {
+		fmt.Println("To keep it running after logging out: loginctl enable-linger")
+	}
+}
+
+func runSystemdUninstall(cmd *cobra.Command, args []string) {
+	name, _ := cmd.Flags().GetString("name")
+	userUnit, _ := cmd.Flags().GetBool("user")
+	opts := systemd.UnitOptions{Name: name}
+
+	dir, err := unitDir(userUnit)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	serverPath := filepath.Join(dir, opts.ServerUnitName())
+	if _, err := os.Stat(serverPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s is not installed\n", serverPath)
+		os.Exit(1)
+	}
+
+	// Stopping the server unit stops the app units, which are part of it
+	if err := systemctl(userUnit, "disable", "--now", opts.ServerUnitName()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range []string{serverPath, filepath.Join(dir, opts.AppUnitName())} {
+		if err := os.Remove(path); err == nil {
+			fmt.Printf("Removed %s\n", path)
+		} else if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", path, err)
+			os.Exit(1)
+		}
+	}
+	if err := systemctl(userUnit, "daemon-reload"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Uninstalled %s\n", opts.ServerUnitName())
+}
+
+// unitOptions describes the unit running the server of cfg from the current
+// directory. Units start elsewhere, so paths are recorded absolute.
+func unitOptions(cfg *config.Config, name string, userUnit bool, runAs string, watchdog time.Duration) (systemd.UnitOptions, error) {
+	opts := systemd.UnitOptions{Name: name, User: runAs, UserUnit: userUnit, Watchdog: watchdog}
+	if userUnit && runAs != "" {
+		return opts, fmt.Errorf("--run-as is for system units, user units run as their user")
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return opts, fmt.Errorf("failed to locate guvnor binary: %w", err)
+	}
+	if opts.Executable, err = filepath.EvalSymlinks(exe); err != nil {
+		return opts, fmt.Errorf("failed to locate guvnor binary: %w", err)
+	}
+	if opts.WorkingDir, err = os.Getwd(); err != nil {
+		return opts, fmt.Errorf("failed to get working directory: %w", err)
+	}
+	if configFile != "" {
+		if opts.ConfigPath, err = filepath.Abs(configFile); err != nil {
+			return opts, fmt.Errorf("failed to resolve config path: %w", err)
+		}
+	}
+
+	opts.BindLowPorts = cfg.Server.HTTPPort < 1024 || (cfg.TLS.Enabled && cfg.Server.HTTPSPort < 1024)
+	return opts, nil
+}
+
+// unitDir is where units of the system or the user's service manager are installed
+func unitDir(userUnit bool) (string, error) {
+	if !userUnit {
+		return "/etc/systemd/system", nil
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "systemd", "user"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "systemd", "user"), nil
+}
+
+// systemctl runs systemctl, for the user's service manager with userUnit
+func systemctl(userUnit bool, args ...string) error {
+	if userUnit {
+		args = append([]string{"--user"}, args...)
+	}
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// notifyReady tells systemd the server is up, when it runs as a Type=notify
+// unit, and feeds the watchdog while the management API answers until ctx
+// is done
+func notifyReady(ctx context.Context, notifier *systemd.Notifier, cfg *config.Config, status string) {
+	if err := notifier.Notify(systemd.Ready, "STATUS="+status); err != nil {
+		log.WithError(err).Warn("Failed to notify systemd")
+	}
+	interval := notifier.WatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// Left unfed, systemd restarts the server once the interval passes
+			if configuredServer(cfg) == nil {
+				log.Warn("Management API not answering, not notifying the systemd watchdog")
+				continue
+			}
+			if err := notifier.Notify(systemd.Watchdog); err != nil {
+				log.WithError(err).Warn("Failed to notify the systemd watchdog")
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/tlsaudit"
+)
+
+var tlsCmd = &cobra.Command{
+	Use:   "tls",
+	Short: "Check how hostnames are served over TLS",
+}
+
+var tlsAuditCmd = &cobra.Command{
+	Use:   "audit [hostname...]",
+	Short: "Check HSTS preload readiness of the served hostnames",
+	Long: `Audit each hostname from the outside, the way hstspreload.org does: the name is
+resolved through public DNS and the server is reached at the addresses found there.
+
+Checked for every hostname:
+- certificate   chain and hostname verify against the system roots
+- protocols     TLS 1.2 or later accepted, TLS 1.0/1.1 refused
+- redirect      http:// redirects to https:// on the same host
+- hsts          Strict-Transport-Security with max-age >= 1 year, includeSubDomains and preload
+
+Without arguments, every public hostname in guvnor.yaml is audited. The command
+exits with status 1 when a check fails; warnings only block preload submission.`,
+	Run: runTLSAudit,
+}
+
+func init() {
+	tlsAuditCmd.Flags().String("resolver", "", "DNS server to resolve hostnames through (default: tls.audit.resolver or "+tlsaudit.DefaultResolver+")")
+	tlsAuditCmd.Flags().Bool("json", false, "print the report as JSON")
+
+	tlsCmd.AddCommand(tlsAuditCmd)
+	rootCmd.AddCommand(tlsCmd)
+}
+
+func runTLSAudit(cmd *cobra.Command, args []string) {
+	resolver, _ := cmd.Flags().GetString("resolver")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	hosts := args
+	if len(hosts) == 0 || resolver == "" {
+		cfg, err := loadConfig()
+		if err != nil && len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+			os.Exit(1)
+		}
+		if err == nil {
+			if len(hosts) == 0 {
+				hosts = tlsaudit.Hostnames(cfg)
+			}
+			if resolver == "" {
+				resolver = cfg.TLS.Audit.Resolver
+			}
+		}
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(os.Stderr, "No public hostnames served over TLS in guvnor.yaml, pass them as arguments\n")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(len(hosts))*time.Minute)
+	defer cancel()
+	reports := (&tlsaudit.Auditor{Resolver: resolver}).AuditAll(ctx, hosts)
+
+	failed := false
+	for _, report := range reports {
+		failed = failed || report.Failed()
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for i, report := range reports {
+			if i > 0 {
+				fmt.Println()
+			}
+			printTLSReport(report)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func printTLSReport(report tlsaudit.Report) {
+	fmt.Printf("%s", report.Host)
+	if len(report.Addresses) > 0 {
+		fmt.Printf(" (%s)", strings.Join(report.Addresses, ", "))
+	}
+	fmt.Println()
+
+	for _, check := range report.Checks {
+		marker := "\033[32m✓\033[0m"
+		switch check.Status {
+		case tlsaudit.StatusWarn:
+			marker = "\033[33m!\033[0m"
+		case tlsaudit.StatusFail:
+			marker = "\033[31m✗\033[0m"
+		}
+		fmt.Printf("  %s %-12s %s\n", marker, check.Name, check.Detail)
+	}
+
+	switch {
+	case report.PreloadReady():
+		fmt.Printf("  Ready for preload, submit at https://hstspreload.org/?domain=%s\n", report.Host)
+	case report.Failed():
+		fmt.Println("  Not ready for preload: fix the failed checks first")
+	default:
+		fmt.Println("  Served securely, but not ready for preload yet")
+	}
+}
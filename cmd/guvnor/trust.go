@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/cert"
+)
+
+var certTrustCmd = &cobra.Command{
+	Use:   "trust",
+	Short: "Install the local development CA in the system trust store",
+	Long: `Install the CA that issues certificates for development hostnames such as
+myapp.localhost (tls.local_ca) in the system trust store, so browsers and tools
+accept them. The CA is generated first if it does not exist yet.
+
+Writing to the trust store usually needs administrator rights, e.g. run it with
+sudo. Firefox and some runtimes keep their own trust stores; add the file shown
+by --print to them by hand.`,
+	Run: runCertTrust,
+}
+
+func init() {
+	certTrustCmd.Flags().Bool("print", false, "only print the path of the CA certificate")
+
+	certCmd.AddCommand(certTrustCmd)
+}
+
+func runCertTrust(cmd *cobra.Command, args []string) {
+	printOnly, _ := cmd.Flags().GetBool("print")
+
+	dir := ""
+	if cfg, err := loadConfig(); err == nil {
+		dir = cfg.TLS.LocalCA.Dir
+	}
+	if dir == "" {
+		var err error
+		if dir, err = cert.DefaultLocalCADir(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	ca, err := cert.LoadLocalCA(dir, log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if printOnly {
+		fmt.Println(ca.CertFile())
+		return
+	}
+
+	location, err := cert.Trust(ca.CertFile())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to install %s: %v\n", ca.CertFile(), err)
+		fmt.Fprintf(os.Stderr, "Administrator rights are usually needed, try again with sudo\n")
+		os.Exit(1)
+	}
+	fmt.Printf("Local CA installed in %s\n", location)
+	fmt.Println("Restart your browser to pick it up; Firefox needs the CA imported in its own settings.")
+}
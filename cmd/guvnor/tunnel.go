@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/tunnel"
+)
+
+var tunnelCmd = &cobra.Command{
+	Use:     "tunnel <app>",
+	Aliases: []string{"port-forward"},
+	Short:   "Expose an app of the running server on its public hostname",
+	Long: `Make an app of the server running on this machine reachable from the
+internet on its hostname, e.g. to receive webhooks on a laptop. Point the
+hostname of the app at a machine that is reachable and forward its ports here,
+either with ssh or with a guvnor relay running there:
+
+- tunnel web --ssh demo@relay.example.com        # ssh -R, sshd needs GatewayPorts yes
+- tunnel web --relay relay.example.com           # guvnor tunnel relay on that machine
+
+Only requests for the app's hostname are passed on, and HTTPS connections whose
+SNI names it; other apps of the server stay unreachable through the tunnel.
+Public connections arrive at the guvnor proxy as any other, so the TLS config
+of the app applies: guvnor terminates HTTPS with the app's certificate, gets
+ACME certificates through the tunnel, verifies client certificates, or passes
+TLS through to the app. HTTPS is forwarded only when tls.enabled is set.
+
+The app needs a hostname that resolves to the ssh host or relay, not a local
+one such as web.localhost. The tunnel stays open until Ctrl+C.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runTunnel,
+}
+
+var tunnelRelayCmd = &cobra.Command{
+	Use:   "relay",
+	Short: "Run a relay that guvnor tunnel clients expose apps through",
+	Long: `Run on a machine reachable from the internet to route public HTTP and HTTPS
+connections to the tunnels guvnor tunnel clients open, by Host header and SNI.
+TLS is not terminated here but by the guvnor server behind each tunnel, so the
+relay needs no certificates. Point the hostnames of tunnelled apps at it, e.g.
+with a wildcard record for --domain.
+
+- tunnel relay --domain tunnel.example.com
+- tunnel relay --http :8000 --https "" --listen :7835
+
+Clients authenticate with the token in --relay-token or $` + tunnel.TokenEnv + `.`,
+	Args: cobra.NoArgs,
+	Run:  runTunnelRelay,
+}
+
+func init() {
+	tunnelCmd.PersistentFlags().String("relay-token", "", "token shared by the relay and its clients (default $"+tunnel.TokenEnv+")")
+
+	tunnelCmd.Flags().String("relay", "", "tunnel through the guvnor relay at this host[:port] (default port "+strconv.Itoa(tunnel.DefaultPort)+")")
+	tunnelCmd.Flags().Int("pool", tunnel.DefaultPool, "idle connections kept open to the relay")
+	tunnelCmd.Flags().String("ssh", "", "tunnel through ssh to this destination, e.g. user@host or ssh://user@host:2222")
+	tunnelCmd.Flags().Int("remote-http-port", 80, "port on the ssh host forwarded to the HTTP proxy")
+	tunnelCmd.Flags().Int("remote-https-port", 443, "port on the ssh host forwarded to the HTTPS proxy")
+	tunnelCmd.MarkFlagsMutuallyExclusive("relay", "ssh")
+	tunnelCmd.MarkFlagsOneRequired("relay", "ssh")
+
+	tunnelRelayCmd.Flags().String("listen", ":"+strconv.Itoa(tunnel.DefaultPort), "address tunnel clients connect to")
+	tunnelRelayCmd.Flags().String("http", ":80", "address of public HTTP connections, empty to disable")
+	tunnelRelayCmd.Flags().String("https", ":443", "address of public HTTPS connections, empty to disable")
+	tunnelRelayCmd.Flags().StringSlice("domain", nil, "only let clients claim hostnames under these domains (default: any)")
+
+	tunnelCmd.AddCommand(tunnelRelayCmd)
+	rootCmd.AddCommand(tunnelCmd)
+}
+
+func runTunnel(cmd *cobra.Command, args []string) {
+	relayAddr, _ := cmd.Flags().GetString("relay")
+	sshTarget, _ := cmd.Flags().GetString("ssh")
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	pf, _ := loadProcfile()
+	apps, err := plannedServer(cfg, pf, nil).Apps()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	app, hostname := tunnelApp(apps, args[0])
+
+	if configuredServer(cfg) == nil {
+		fmt.Fprintln(os.Stderr, "Error: no guvnor server is running for this config, start it with: guvnor start")
+		os.Exit(exitUnavailable)
+	}
+
+	httpsPort := 0
+	if cfg.TLS.Enabled {
+		httpsPort = cfg.Server.HTTPSPort
+	}
+	fmt.Printf("Tunnelling %s (%s)\n", app.Name, hostname)
+	fmt.Printf("  %-6s %s\n", "tls", describeTunnelTLS(cfg, app))
+	if cfg.TLS.Enabled && cfg.TLS.ForceHTTPS && cfg.Server.HTTPSPort != 443 {
+		fmt.Printf("  %-6s tls.force_https redirects to port %d, which the tunnel does not expose; use https_port: 443 or turn it off\n",
+			"note", cfg.Server.HTTPSPort)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	proxyHTTP := "127.0.0.1:" + strconv.Itoa(cfg.Server.HTTPPort)
+	proxyHTTPS := ""
+	if httpsPort > 0 {
+		proxyHTTPS = "127.0.0.1:" + strconv.Itoa(httpsPort)
+	}
+
+	if sshTarget != "" {
+		// ssh forwards to local ports serving only this app, not to the proxy
+		tunnelled := &tunnel.App{Hostname: hostname, HTTPAddr: proxyHTTP, HTTPSAddr: proxyHTTPS, Logger: log}
+		localHTTP := listenTunnel()
+		defer localHTTP.Close()
+		go tunnelled.ServeHTTP(localHTTP)
+		localHTTPS := 0
+		if proxyHTTPS != "" {
+			l := listenTunnel()
+			defer l.Close()
+			go tunnelled.ServeTLS(l)
+			localHTTPS = l.Addr().(*net.TCPAddr).Port
+		}
+
+		remoteHTTP, _ := cmd.Flags().GetInt("remote-http-port")
+		remoteHTTPS, _ := cmd.Flags().GetInt("remote-https-port")
+		sshArgs := tunnel.SSHArgs(sshTarget, remoteHTTP, localHTTP.Addr().(*net.TCPAddr).Port, remoteHTTPS, localHTTPS)
+		fmt.Printf("  %-6s ssh %s\n\n", "via", quoteArgs(sshArgs))
+
+		ssh := exec.CommandContext(ctx, "ssh", sshArgs...)
+		ssh.Stdin, ssh.Stdout, ssh.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := ssh.Run(); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "Error: ssh: %v\n", err)
+			fmt.Fprintln(os.Stderr, "Forwarding public ports needs GatewayPorts yes (or clientspecified) in the sshd_config of the host,")
+			fmt.Fprintln(os.Stderr, "and ports below 1024 need root there: pick others with --remote-http-port and --remote-https-port")
+			os.Exit(exitFailure)
+		}
+		return
+	}
+
+	if _, _, err := net.SplitHostPort(relayAddr); err != nil {
+		relayAddr = net.JoinHostPort(relayAddr, strconv.Itoa(tunnel.DefaultPort))
+	}
+	pool, _ := cmd.Flags().GetInt("pool")
+	client := &tunnel.Client{
+		Relay:     relayAddr,
+		Token:     relayToken(cmd),
+		Hostname:  hostname,
+		HTTPAddr:  proxyHTTP,
+		HTTPSAddr: proxyHTTPS,
+		Pool:      pool,
+		Logger:    log,
+	}
+	fmt.Printf("  %-6s %s\n\n", "via", relayAddr)
+
+	if err := client.Run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, tunnel.ErrRefused) {
+			os.Exit(exitUnauthorized)
+		}
+		os.Exit(exitFailure)
+	}
+}
+
+// listenTunnel opens a local port for ssh to forward public connections to
+func listenTunnel() net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to listen for the tunnel: %v\n", err)
+		os.Exit(exitFailure)
+	}
+	return l
+}
+
+// tunnelApp returns the app to tunnel and the public hostname it is served on
+func tunnelApp(apps []config.AppConfig, name string) (config.AppConfig, string) {
+	for _, app := range apps {
+		if app.Name != name {
+			continue
+		}
+		hostname := app.Hostname
+		if hostname == "" {
+			hostname = app.Domain
+		}
+		hostname, _, _ = strings.Cut(hostname, ":")
+		if hostname == "" || cert.IsLocalHostname(hostname) {
+			fmt.Fprintf(os.Stderr, "Error: %s is served on %q, which is not a public hostname\n", app.Name, hostname)
+			fmt.Fprintf(os.Stderr, "Set hostname: in the config of %s to a name that resolves to the ssh host or relay\n", app.Name)
+			os.Exit(exitFailure)
+		}
+		return app, hostname
+	}
+	fmt.Fprintf(os.Stderr, "Error: no app named %s\n", name)
+	os.Exit(exitNotFound)
+	return config.AppConfig{}, ""
+}
+
+// describeTunnelTLS tells how HTTPS requests coming through the tunnel are served
+func describeTunnelTLS(cfg *config.Config, app config.AppConfig) string {
+	if !cfg.TLS.Enabled {
+		return "off, only HTTP is forwarded"
+	}
+	if app.TLS.Passthrough {
+		return "passed through to the app, which terminates it"
+	}
+	if !app.TLS.Enabled {
+		return "not enabled for the app, HTTPS gets the default certificate of the server"
+	}
+
+	description := "terminated by guvnor"
+	switch {
+	case app.TLS.CertFile != "":
+		description += " with " + app.TLS.CertFile
+	case cfg.TLS.AutoCert && app.TLS.AutoCert:
+		description += ", certificate from ACME (HTTP-01 challenges come through the tunnel)"
+	}
+	if app.TLS.ClientAuth.Enabled() {
+		mode := app.TLS.ClientAuth.Mode
+		if mode == "" {
+			mode = config.ClientAuthRequire
+		}
+		description += ", client certificates " + mode
+	}
+	return description
+}
+
+// relayToken returns the token of --relay-token or the environment
+func relayToken(cmd *cobra.Command) string {
+	if token, _ := cmd.Flags().GetString("relay-token"); token != "" {
+		return token
+	}
+	return os.Getenv(tunnel.TokenEnv)
+}
+
+func runTunnelRelay(cmd *cobra.Command, args []string) {
+	listen, _ := cmd.Flags().GetString("listen")
+	httpAddr, _ := cmd.Flags().GetString("http")
+	httpsAddr, _ := cmd.Flags().GetString("https")
+	domains, _ := cmd.Flags().GetStringSlice("domain")
+
+	token := relayToken(cmd)
+	if token == "" {
+		fmt.Fprintf(os.Stderr, "Error: the relay needs a token in --relay-token or $%s, e.g. from: openssl rand -hex 32\n", tunnel.TokenEnv)
+		os.Exit(exitUsage)
+	}
+	relay := tunnel.NewRelay(token, domains, log)
+
+	type endpoint struct {
+		name  string
+		addr  string
+		serve func(net.Listener) error
+	}
+	endpoints := []endpoint{
+		{"tunnel clients", listen, relay.ServeTunnels},
+		{"public HTTP", httpAddr, relay.ServeHTTP},
+		{"public HTTPS", httpsAddr, relay.ServeTLS},
+	}
+	var listeners []net.Listener
+	for _, e := range endpoints {
+		if e.addr == "" {
+			continue
+		}
+		l, err := net.Listen("tcp", e.addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to listen for %s: %v\n", e.name, err)
+			os.Exit(exitFailure)
+		}
+		listeners = append(listeners, l)
+		log.Infof("Relay listening for %s on %s", e.name, l.Addr())
+		go e.serve(l)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-ctx.Done()
+	for _, l := range listeners {
+		l.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+// Levels of validation findings
+const (
+	levelOK      = "ok"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// validationResult is one finding of guvnor validate
+type validationResult struct {
+	Check   string `json:"check"` // procfile, config, ports or environment
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// validationReport collects the findings of guvnor validate, printing them
+// as they come in text mode
+type validationReport struct {
+	Valid    bool               `json:"valid"`
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+	Results  []validationResult `json:"results"`
+
+	text bool
+}
+
+func (r *validationReport) add(check, level, message, fix string) {
+	r.Results = append(r.Results, validationResult{Check: check, Level: level, Message: message, Fix: fix})
+	switch level {
+	case levelError:
+		r.Errors++
+	case levelWarning:
+		r.Warnings++
+	}
+	if !r.text {
+		return
+	}
+
+	prefix := map[string]string{levelOK: "OK", levelWarning: "WARNING", levelError: "ERROR"}[level]
+	fmt.Printf("%s: %s\n", prefix, message)
+	if fix != "" {
+		fmt.Printf("       %s\n", fix)
+	}
+}
@@ -0,0 +1,93 @@
+package guvnortest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// FakeHealthPath is answered by fake apps themselves, following SetHealthy
+const FakeHealthPath = "/health"
+
+// FakeApp is an app served in-process by an http.Handler. guvnor supervises a
+// placeholder process for it, so restarts, scaling of the configured instance
+// and health checks behave as for a real app while the test controls the
+// responses.
+type FakeApp struct {
+	Name     string
+	Port     int
+	Hostname string
+
+	server    *http.Server
+	unhealthy atomic.Bool
+	requests  atomic.Int64
+}
+
+// AddFakeApp registers an app answered by handler on a free port, with health
+// checks against FakeHealthPath every second
+func (h *Harness) AddFakeApp(name string, handler http.Handler) *FakeApp {
+	h.t.Helper()
+	h.mustNotBeStarted()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		h.t.Fatalf("guvnortest: failed to listen for %s: %v", name, err)
+	}
+
+	fake := &FakeApp{Name: name, Port: listener.Addr().(*net.TCPAddr).Port}
+	fake.server = &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == FakeHealthPath {
+			if fake.unhealthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		fake.requests.Add(1)
+		handler.ServeHTTP(w, r)
+	})}
+	go fake.server.Serve(listener)
+	h.fakes = append(h.fakes, fake)
+
+	command, args := idleCommand()
+	app := h.AddApp(App{
+		Name:       name,
+		Command:    command,
+		Args:       args,
+		Port:       fake.Port,
+		HealthPath: FakeHealthPath,
+	})
+	fake.Hostname = app.Hostname
+	return fake
+}
+
+// SetHealthy makes FakeHealthPath answer 200 (true) or 503 (false)
+func (f *FakeApp) SetHealthy(healthy bool) {
+	f.unhealthy.Store(!healthy)
+}
+
+// Requests returns how many requests other than health checks reached the app
+func (f *FakeApp) Requests() int64 {
+	return f.requests.Load()
+}
+
+func (f *FakeApp) close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f.server.Shutdown(ctx)
+}
+
+// idleCommand returns a command that runs until it is stopped, standing in for
+// the process of a fake app
+func idleCommand() (string, []string) {
+	const day = 24 * 60 * 60
+	if runtime.GOOS == "windows" {
+		return "powershell", []string{"-NoProfile", "-Command", "Start-Sleep -Seconds " + strconv.Itoa(day)}
+	}
+	return "sleep", []string{strconv.Itoa(day)}
+}
@@ -0,0 +1,467 @@
+// Package guvnortest runs guvnor in-process for end-to-end tests.
+//
+// A Harness owns a temporary project directory and a configuration with free
+// ports. Register real processes with AddApp or in-process fake apps with
+// AddFakeApp, call Start, then drive requests through the proxy and the
+// management API:
+//
+//	h := guvnortest.New(t)
+//	web := h.AddFakeApp("web", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		fmt.Fprint(w, "hello")
+//	}))
+//	h.Start()
+//	h.WaitHealthy("web")
+//	if status, body := h.Get(web.Hostname, "/"); status != 200 || body != "hello" {
+//		t.Fatalf("unexpected response %d %q", status, body)
+//	}
+//
+// Everything is stopped when the test ends. On failure the server's log is
+// added to the test output.
+package guvnortest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/server"
+)
+
+// DefaultTimeout bounds how long the Wait helpers wait
+var DefaultTimeout = 15 * time.Second
+
+// Harness runs one guvnor server for a test
+type Harness struct {
+	Dir      string // Project directory; guvnor.yaml, state and relative paths live here
+	HTTPPort int    // Port of the proxy
+	APIPort  int    // Port of the management API
+	Socket   string // Unix socket of the management API, unless the path is too long to bind
+
+	t      testing.TB
+	cfg    *config.Config
+	server *server.Server
+	cancel context.CancelFunc
+	fakes  []*FakeApp
+	logs   *syncBuffer
+	client *http.Client
+}
+
+// App is a real process managed by the harness
+type App struct {
+	Name        string
+	Command     string
+	Args        []string
+	Port        int               // Free port picked when 0; the app gets it as $PORT
+	Hostname    string            // Host routed to the app (default: <name>.localhost)
+	Environment map[string]string // Extra environment variables
+	HealthPath  string            // Enables health checks every second when set
+}
+
+// New returns a harness with no apps
+func New(t testing.TB) *Harness {
+	t.Helper()
+	return newHarnessIn(t, t.TempDir(), &config.Config{})
+}
+
+// NewFromYAML returns a harness for a guvnor.yaml, written to the project
+// directory so relative paths resolve against it. The server ports and state
+// directory and API socket are replaced with the harness' own.
+func NewFromYAML(t testing.TB, yaml string) *Harness {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "guvnor.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("guvnortest: failed to write guvnor.yaml: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("guvnortest: invalid guvnor.yaml: %v", err)
+	}
+	return newHarnessIn(t, dir, cfg)
+}
+
+func newHarnessIn(t testing.TB, dir string, cfg *config.Config) *Harness {
+	httpPort := freePortPair(t)
+	cfg.Server.HTTPPort = httpPort
+	cfg.Server.HTTPSPort = freePort(t)
+	cfg.Server.StateDir = filepath.Join(dir, config.DefaultStateDir)
+	cfg.Server.APISocket = config.APISocketConfig{Path: filepath.Join(dir, config.APISocketName)}
+	cfg.TLS.Enabled = false
+
+	return &Harness{
+		Dir:      dir,
+		HTTPPort: httpPort,
+		APIPort:  api.GetManagementPort(httpPort),
+		Socket:   cfg.Server.APISocket.Path,
+		t:        t,
+		cfg:      cfg,
+		logs:     &syncBuffer{},
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AddApp registers a process to be started with the server and returns it with
+// its port and hostname filled in
+func (h *Harness) AddApp(app App) App {
+	h.t.Helper()
+	h.mustNotBeStarted()
+
+	if app.Port == 0 {
+		app.Port = freePort(h.t)
+	}
+	if app.Hostname == "" {
+		app.Hostname = app.Name + ".localhost"
+	}
+
+	appConfig := config.AppConfig{
+		Name:        app.Name,
+		Hostname:    app.Hostname,
+		Port:        app.Port,
+		Command:     app.Command,
+		Args:        app.Args,
+		WorkingDir:  h.Dir,
+		Environment: app.Environment,
+		RestartPolicy: config.RestartPolicy{
+			Enabled:    true,
+			MaxRetries: -1,
+			Backoff:    200 * time.Millisecond,
+		},
+	}
+	if app.HealthPath != "" {
+		appConfig.HealthCheck = config.HealthCheckConfig{
+			Enabled:  true,
+			Path:     app.HealthPath,
+			Interval: time.Second,
+			Timeout:  time.Second,
+			Retries:  3,
+		}
+	}
+	h.cfg.Apps = append(h.cfg.Apps, appConfig)
+	return app
+}
+
+// Start validates the configuration and starts the server and its apps. It
+// returns once the management API answers.
+func (h *Harness) Start() {
+	h.t.Helper()
+	h.mustNotBeStarted()
+
+	if err := h.cfg.Validate(); err != nil {
+		h.t.Fatalf("guvnortest: invalid configuration: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(h.logs)
+	logger.SetLevel(logrus.DebugLevel)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.server = server.New(h.cfg, nil, logger)
+	h.t.Cleanup(h.Stop)
+
+	if err := h.server.Start(ctx); err != nil {
+		h.t.Fatalf("guvnortest: failed to start guvnor: %v\n%s", err, h.logs.String())
+	}
+	h.WaitFor("the management API to answer", func() bool {
+		resp, err := h.client.Get(h.apiURL("/api/v1/ping"))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	})
+}
+
+// Stop stops the server, its apps and the fake apps. It runs automatically
+// when the test ends.
+func (h *Harness) Stop() {
+	if h.server == nil {
+		return
+	}
+	if h.t.Failed() {
+		h.t.Logf("guvnor log:\n%s", h.logs.String())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := h.server.Stop(ctx); err != nil {
+		h.t.Logf("guvnortest: failed to stop guvnor: %v", err)
+	}
+	h.cancel()
+	h.server = nil
+
+	for _, fake := range h.fakes {
+		fake.close()
+	}
+}
+
+// Logs returns what the server logged so far
+func (h *Harness) Logs() string {
+	return h.logs.String()
+}
+
+// Request sends a request for host through the proxy. The test fails if the
+// request cannot be sent; the caller closes the body.
+func (h *Harness) Request(method, host, path string, body io.Reader) *http.Response {
+	h.t.Helper()
+
+	req, err := http.NewRequest(method, fmt.Sprintf("http://127.0.0.1:%d%s", h.HTTPPort, path), body)
+	if err != nil {
+		h.t.Fatalf("guvnortest: invalid request: %v", err)
+	}
+	req.Host = host
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.t.Fatalf("guvnortest: %s %s%s failed: %v", method, host, path, err)
+	}
+	return resp
+}
+
+// Get requests path on host through the proxy and returns the status code and body
+func (h *Harness) Get(host, path string) (int, string) {
+	h.t.Helper()
+
+	resp := h.Request(http.MethodGet, host, path, nil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// API calls the management API, decodes a JSON answer into out unless it is
+// nil, and returns the status code
+func (h *Harness) API(method, path string, out interface{}) int {
+	h.t.Helper()
+
+	req, err := http.NewRequest(method, h.apiURL(path), nil)
+	if err != nil {
+		h.t.Fatalf("guvnortest: invalid request: %v", err)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		h.t.Fatalf("guvnortest: %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			h.t.Fatalf("guvnortest: failed to decode %s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Job is the outcome of a management API job
+type Job struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RunJob posts to a mutating management API endpoint, such as
+// "/api/v1/restart?app=web", and waits for the job it starts to finish
+func (h *Harness) RunJob(path string) Job {
+	h.t.Helper()
+
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	if status := h.API(http.MethodPost, path, &accepted); status != http.StatusAccepted {
+		h.t.Fatalf("guvnortest: POST %s answered %d", path, status)
+	}
+
+	var job Job
+	h.WaitFor("job "+accepted.JobID+" to finish", func() bool {
+		h.API(http.MethodGet, "/api/v1/jobs/"+accepted.JobID, &job)
+		return job.Status == "succeeded" || job.Status == "failed"
+	})
+	return job
+}
+
+// Process is an instance as reported by the management API
+type Process struct {
+	Name   string `json:"name"`
+	App    string `json:"app,omitempty"`
+	PID    int    `json:"pid"`
+	Status string `json:"status"`
+	Port   int    `json:"port"`
+}
+
+// Processes returns the instances of an app, of every app when name is empty
+func (h *Harness) Processes(name string) []Process {
+	h.t.Helper()
+
+	var status struct {
+		Processes []Process `json:"processes"`
+	}
+	h.API(http.MethodGet, "/api/v1/status", &status)
+
+	var processes []Process
+	for _, p := range status.Processes {
+		if name == "" || p.Name == name || p.App == name {
+			processes = append(processes, p)
+		}
+	}
+	return processes
+}
+
+// Kill kills the first instance of an app as if it crashed and returns its pid
+func (h *Harness) Kill(name string) int {
+	h.t.Helper()
+
+	for _, p := range h.Processes(name) {
+		if p.PID == 0 {
+			continue
+		}
+		proc, err := os.FindProcess(p.PID)
+		if err == nil {
+			err = proc.Kill()
+		}
+		if err != nil {
+			h.t.Fatalf("guvnortest: failed to kill %s (pid %d): %v", p.Name, p.PID, err)
+		}
+		return p.PID
+	}
+	h.t.Fatalf("guvnortest: %s has no running instance", name)
+	return 0
+}
+
+// WaitRunning waits until every instance of an app runs, and replaced the
+// process with pid unless it is 0
+func (h *Harness) WaitRunning(name string, previousPID int) {
+	h.t.Helper()
+
+	h.WaitFor(name+" to run", func() bool {
+		processes := h.Processes(name)
+		for _, p := range processes {
+			if p.Status != "running" || p.PID == 0 || p.PID == previousPID {
+				return false
+			}
+		}
+		return len(processes) > 0
+	})
+}
+
+// WaitHealthy waits until the health checks of every instance of an app pass
+func (h *Harness) WaitHealthy(name string) {
+	h.t.Helper()
+	h.waitHealth(name, "healthy")
+}
+
+// WaitUnhealthy waits until a health check of an app's instances fails
+func (h *Harness) WaitUnhealthy(name string) {
+	h.t.Helper()
+	h.waitHealth(name, "unhealthy")
+}
+
+func (h *Harness) waitHealth(name, want string) {
+	h.t.Helper()
+
+	h.WaitFor(name+" to be "+want, func() bool {
+		var health struct {
+			Health map[string]struct {
+				Status string `json:"status"`
+			} `json:"health"`
+		}
+		h.API(http.MethodGet, "/api/v1/health?app="+name, &health)
+		if len(health.Health) == 0 {
+			return false
+		}
+		for _, result := range health.Health {
+			if want == "healthy" && result.Status != want {
+				return false
+			}
+			if want == "unhealthy" && result.Status == want {
+				return true
+			}
+		}
+		return want == "healthy"
+	})
+}
+
+// WaitFor polls condition until it holds, failing the test after DefaultTimeout
+func (h *Harness) WaitFor(what string, condition func() bool) {
+	h.t.Helper()
+
+	deadline := time.Now().Add(DefaultTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("guvnortest: timed out after %s waiting for %s", DefaultTimeout, what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (h *Harness) apiURL(path string) string {
+	return "http://127.0.0.1:" + strconv.Itoa(h.APIPort) + path
+}
+
+func (h *Harness) mustNotBeStarted() {
+	h.t.Helper()
+	if h.server != nil {
+		h.t.Fatal("guvnortest: apps must be added before Start")
+	}
+}
+
+// freePort returns a TCP port nothing listens on
+func freePort(t testing.TB) int {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("guvnortest: no free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// freePortPair returns a free proxy port whose management API port is free too
+func freePortPair(t testing.TB) int {
+	t.Helper()
+
+	for i := 0; i < 50; i++ {
+		port := freePort(t)
+		mgmt := api.GetManagementPort(port)
+		if mgmt > 65535 {
+			continue
+		}
+		if l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(mgmt))); err == nil {
+			l.Close()
+			return port
+		}
+	}
+	t.Fatal("guvnortest: no free pair of proxy and management API ports")
+	return 0
+}
+
+// syncBuffer collects the server log from concurrent writers
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
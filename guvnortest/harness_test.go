@@ -0,0 +1,73 @@
+package guvnortest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gleicon/guvnor/guvnortest"
+	"github.com/gleicon/guvnor/internal/client"
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+func TestHarness_RoutesToFakeApps(t *testing.T) {
+	h := guvnortest.New(t)
+	web := h.AddFakeApp("web", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "web %s", r.URL.Path)
+	}))
+	api := h.AddFakeApp("api", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "api")
+	}))
+	h.Start()
+	h.WaitRunning("web", 0)
+	h.WaitRunning("api", 0)
+
+	if status, body := h.Get(web.Hostname, "/hello"); status != http.StatusOK || body != "web /hello" {
+		t.Errorf("Expected web to answer, got %d %q", status, body)
+	}
+	if status, body := h.Get(api.Hostname, "/"); status != http.StatusOK || body != "api" {
+		t.Errorf("Expected api to answer, got %d %q", status, body)
+	}
+	if web.Requests() != 1 || api.Requests() != 1 {
+		t.Errorf("Expected one request per app, got web=%d api=%d", web.Requests(), api.Requests())
+	}
+}
+
+func TestHarness_FromYAML(t *testing.T) {
+	h := guvnortest.NewFromYAML(t, `
+apps:
+  - name: worker
+    command: sleep
+    args: ["60"]
+    restart_policy:
+      enabled: true
+      backoff: 200ms
+`)
+	h.Start()
+	h.WaitRunning("worker", 0)
+
+	pid := h.Kill("worker")
+	h.WaitRunning("worker", pid)
+}
+
+func TestHarness_APISocket(t *testing.T) {
+	h := guvnortest.New(t)
+	h.AddApp(guvnortest.App{Name: "worker", Command: "sleep", Args: []string{"60"}})
+	h.Start()
+	h.WaitRunning("worker", 0)
+
+	socket := client.NewSocketClient(h.Socket)
+	processes, err := socket.GetStatus(context.Background())
+	if err != nil || len(processes) != 1 {
+		t.Fatalf("Expected the status over the socket, got %v: %v", processes, err)
+	}
+	if !socket.Serves(h.HTTPPort) || socket.Serves(h.HTTPPort+1) {
+		t.Error("Expected the socket to identify its server by port")
+	}
+	info, err := os.Stat(h.Socket)
+	if err != nil || info.Mode().Perm() != config.DefaultAPISocketMode {
+		t.Errorf("Expected a socket only its owner may use, got %v: %v", info, err)
+	}
+}
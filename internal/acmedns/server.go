@@ -0,0 +1,404 @@
+// Package acmedns is a minimal authoritative DNS server for a zone delegated to
+// guvnor. It only answers the records needed for ACME DNS-01 validation: the
+// _acme-challenge name of each certificate domain is CNAMEd into the zone, and
+// guvnor publishes the challenge TXT values there while an order is pending.
+package acmedns
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	challengeTTL = 1    // Challenge values change with every order
+	zoneTTL      = 3600 // NS, SOA and nameserver address records
+	tcpTimeout   = 10 * time.Second
+)
+
+// Server answers DNS queries for the delegated zone
+type Server struct {
+	zone       string
+	nameserver string
+	address    net.IP
+	logger     *logrus.Entry
+
+	mu      sync.RWMutex
+	records map[string][]string // Challenge TXT values by lower-case name
+
+	udp    net.PacketConn
+	tcp    net.Listener
+	closed chan struct{}
+}
+
+// New creates a server for zone. nameserver is the name of this server used in
+// NS and SOA answers; address, if set, is returned for it.
+func New(zone, nameserver, address string, logger *logrus.Logger) *Server {
+	s := &Server{
+		zone:       canonical(zone),
+		nameserver: canonical(nameserver),
+		logger:     logger.WithField("component", "acme-dns"),
+		records:    make(map[string][]string),
+		closed:     make(chan struct{}),
+	}
+	if address != "" {
+		s.address = net.ParseIP(address)
+	}
+	return s
+}
+
+// ChallengeLabel returns the label inside the zone that holds the challenges of
+// domain. A wildcard and its base domain share the same _acme-challenge name.
+func ChallengeLabel(domain string) string {
+	base := strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(domain, ".")), "*.")
+	sum := sha256.Sum256([]byte(base))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ChallengeName returns the name _acme-challenge.<domain> must be CNAMEd to
+func (s *Server) ChallengeName(domain string) string {
+	return ChallengeLabel(domain) + "." + strings.TrimSuffix(s.zone, ".")
+}
+
+// Present publishes a challenge TXT value
+func (s *Server) Present(name, value string) {
+	name = canonical(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.records[name] {
+		if existing == value {
+			return
+		}
+	}
+	s.records[name] = append(s.records[name], value)
+	s.logger.WithField("name", name).Debug("Published challenge record")
+}
+
+// CleanUp removes a challenge TXT value
+func (s *Server) CleanUp(name, value string) {
+	name = canonical(name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	values := s.records[name]
+	for i, existing := range values {
+		if existing == value {
+			values = append(values[:i], values[i+1:]...)
+			break
+		}
+	}
+	if len(values) == 0 {
+		delete(s.records, name)
+		return
+	}
+	s.records[name] = values
+}
+
+// Start listens on addr over UDP and TCP
+func (s *Server) Start(addr string) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+	s.udp, s.tcp = udp, tcp
+
+	go s.serveUDP()
+	go s.serveTCP()
+
+	s.logger.WithFields(logrus.Fields{"addr": addr, "zone": s.zone}).Info("ACME DNS server started")
+	return nil
+}
+
+// Addr returns the UDP address the server listens on
+func (s *Server) Addr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+	return s.udp.LocalAddr()
+}
+
+// Stop closes the listeners
+func (s *Server) Stop() error {
+	select {
+	case <-s.closed:
+		return nil
+	default:
+		close(s.closed)
+	}
+
+	var errs []error
+	if s.udp != nil {
+		errs = append(errs, s.udp.Close())
+	}
+	if s.tcp != nil {
+		errs = append(errs, s.tcp.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.WithError(err).Warn("Failed to read DNS query")
+			continue
+		}
+
+		reply, err := s.answer(buf[:n])
+		if err != nil {
+			s.logger.WithError(err).Debug("Dropping malformed DNS query")
+			continue
+		}
+		if _, err := s.udp.WriteTo(reply, addr); err != nil {
+			s.logger.WithError(err).Debug("Failed to send DNS reply")
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.WithError(err).Warn("Failed to accept DNS connection")
+			continue
+		}
+		go s.handleTCP(conn)
+	}
+}
+
+// handleTCP answers length-prefixed queries until the client closes the connection
+func (s *Server) handleTCP(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpTimeout))
+
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		reply, err := s.answer(query)
+		if err != nil {
+			return
+		}
+		out := make([]byte, 2, 2+len(reply))
+		binary.BigEndian.PutUint16(out, uint16(len(reply)))
+		if _, err := conn.Write(append(out, reply...)); err != nil {
+			return
+		}
+	}
+}
+
+// answer builds the reply to a wire-format query
+func (s *Server) answer(query []byte) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	if header.Response {
+		return nil, fmt.Errorf("not a query")
+	}
+
+	reply := dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		OpCode:           header.OpCode,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            dnsmessage.RCodeSuccess,
+	}
+
+	question, err := parser.Question()
+	if err != nil {
+		reply.RCode = dnsmessage.RCodeFormatError
+		return s.build(reply, nil, nil, nil)
+	}
+
+	name := strings.ToLower(question.Name.String())
+	if header.OpCode != 0 {
+		reply.RCode = dnsmessage.RCodeNotImplemented
+		return s.build(reply, &question, nil, nil)
+	}
+	if name != s.zone && !strings.HasSuffix(name, "."+s.zone) {
+		reply.Authoritative = false
+		reply.RCode = dnsmessage.RCodeRefused
+		return s.build(reply, &question, nil, nil)
+	}
+
+	answers := s.lookup(question, name)
+	var authority []dnsmessage.Resource
+	if len(answers) == 0 {
+		if !s.exists(name) {
+			reply.RCode = dnsmessage.RCodeNameError
+		}
+		authority = []dnsmessage.Resource{s.soa()}
+	}
+
+	return s.build(reply, &question, answers, authority)
+}
+
+// lookup returns the answers for a question inside the zone
+func (s *Server) lookup(q dnsmessage.Question, name string) []dnsmessage.Resource {
+	var answers []dnsmessage.Resource
+	header := func(rtype dnsmessage.Type, ttl uint32) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: q.Name, Type: rtype, Class: dnsmessage.ClassINET, TTL: ttl}
+	}
+
+	switch q.Type {
+	case dnsmessage.TypeTXT:
+		s.mu.RLock()
+		for _, value := range s.records[name] {
+			answers = append(answers, dnsmessage.Resource{
+				Header: header(dnsmessage.TypeTXT, challengeTTL),
+				Body:   &dnsmessage.TXTResource{TXT: []string{value}},
+			})
+		}
+		s.mu.RUnlock()
+	case dnsmessage.TypeSOA:
+		if name == s.zone {
+			answers = append(answers, s.soa())
+		}
+	case dnsmessage.TypeNS:
+		if name == s.zone {
+			answers = append(answers, dnsmessage.Resource{
+				Header: header(dnsmessage.TypeNS, zoneTTL),
+				Body:   &dnsmessage.NSResource{NS: dnsmessage.MustNewName(s.nameserver)},
+			})
+		}
+	case dnsmessage.TypeA:
+		if ip := s.address.To4(); name == s.nameserver && ip != nil {
+			answers = append(answers, dnsmessage.Resource{
+				Header: header(dnsmessage.TypeA, zoneTTL),
+				Body:   &dnsmessage.AResource{A: [4]byte(ip)},
+			})
+		}
+	case dnsmessage.TypeAAAA:
+		if name == s.nameserver && s.address != nil && s.address.To4() == nil {
+			answers = append(answers, dnsmessage.Resource{
+				Header: header(dnsmessage.TypeAAAA, zoneTTL),
+				Body:   &dnsmessage.AAAAResource{AAAA: [16]byte(s.address.To16())},
+			})
+		}
+	}
+
+	return answers
+}
+
+// exists reports whether a name has any record in the zone
+func (s *Server) exists(name string) bool {
+	if name == s.zone || (name == s.nameserver && s.address != nil) {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.records[name]
+	return ok
+}
+
+// soa returns the zone's SOA record
+func (s *Server) soa() dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(s.zone),
+			Type:  dnsmessage.TypeSOA,
+			Class: dnsmessage.ClassINET,
+			TTL:   zoneTTL,
+		},
+		Body: &dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName(s.nameserver),
+			MBox:    dnsmessage.MustNewName("hostmaster." + s.zone),
+			Serial:  uint32(time.Now().Unix()),
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  challengeTTL,
+		},
+	}
+}
+
+// build packs a reply
+func (s *Server) build(header dnsmessage.Header, question *dnsmessage.Question, answers, authority []dnsmessage.Resource) ([]byte, error) {
+	msg := dnsmessage.Message{Header: header, Answers: answers, Authorities: authority}
+	if question != nil {
+		msg.Questions = []dnsmessage.Question{*question}
+	}
+	return msg.Pack()
+}
+
+// Record is a DNS record the operator creates at their existing DNS provider
+type Record struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// SetupRecords returns the records that delegate zone to guvnor and point the
+// _acme-challenge name of every domain into it
+func SetupRecords(zone, nameserver, address string, domains []string) []Record {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	nameserver = strings.TrimSuffix(strings.ToLower(nameserver), ".")
+
+	records := []Record{{Name: zone, Type: "NS", Value: nameserver}}
+	if ip := net.ParseIP(address); ip != nil {
+		rtype := "A"
+		if ip.To4() == nil {
+			rtype = "AAAA"
+		}
+		records = append(records, Record{Name: nameserver, Type: rtype, Value: ip.String()})
+	}
+
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		base := strings.TrimPrefix(strings.ToLower(strings.TrimSuffix(domain, ".")), "*.")
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		records = append(records, Record{
+			Name:  "_acme-challenge." + base,
+			Type:  "CNAME",
+			Value: ChallengeLabel(base) + "." + zone,
+		})
+	}
+	return records
+}
+
+// canonical lower-cases a name and makes it fully qualified
+func canonical(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
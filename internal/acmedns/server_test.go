@@ -0,0 +1,111 @@
+package acmedns
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func query(t *testing.T, addr net.Addr, name string, qtype dnsmessage.Type) *dnsmessage.Message {
+	t.Helper()
+
+	q := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 42, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := q.Pack()
+	if err != nil {
+		t.Fatalf("Failed to pack query: %v", err)
+	}
+
+	conn, err := net.Dial("udp", addr.String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write(packed); err != nil {
+		t.Fatalf("Failed to send query: %v", err)
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+
+	var reply dnsmessage.Message
+	if err := reply.Unpack(buf[:n]); err != nil {
+		t.Fatalf("Failed to unpack reply: %v", err)
+	}
+	if reply.Header.ID != 42 || !reply.Header.Response {
+		t.Fatalf("Unexpected reply header %+v", reply.Header)
+	}
+	return &reply
+}
+
+func TestServer_Answers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	s := New("acme.example.com", "ns.acme.example.com", "203.0.113.10", logger)
+	if err := s.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	defer s.Stop()
+
+	name := s.ChallengeName("*.example.com")
+	if name != s.ChallengeName("example.com") {
+		t.Error("Expected a wildcard and its base domain to share a challenge name")
+	}
+	s.Present(name, "token-a")
+	s.Present(name, "token-b")
+
+	reply := query(t, s.Addr(), name+".", dnsmessage.TypeTXT)
+	if len(reply.Answers) != 2 {
+		t.Fatalf("Expected 2 TXT answers, got %d", len(reply.Answers))
+	}
+	if txt := reply.Answers[0].Body.(*dnsmessage.TXTResource).TXT[0]; txt != "token-a" {
+		t.Errorf("Expected token-a, got %q", txt)
+	}
+
+	s.CleanUp(name, "token-a")
+	s.CleanUp(name, "token-b")
+	if reply := query(t, s.Addr(), name+".", dnsmessage.TypeTXT); reply.RCode != dnsmessage.RCodeNameError || len(reply.Authorities) != 1 {
+		t.Errorf("Expected NXDOMAIN with SOA after cleanup, got %v with %d authority records", reply.RCode, len(reply.Authorities))
+	}
+
+	if reply := query(t, s.Addr(), "acme.example.com.", dnsmessage.TypeNS); len(reply.Answers) != 1 || !reply.Authoritative {
+		t.Errorf("Expected an authoritative NS answer at the apex, got %+v", reply)
+	}
+	if reply := query(t, s.Addr(), "ns.acme.example.com.", dnsmessage.TypeA); len(reply.Answers) != 1 ||
+		reply.Answers[0].Body.(*dnsmessage.AResource).A != [4]byte{203, 0, 113, 10} {
+		t.Errorf("Expected the nameserver address, got %+v", reply.Answers)
+	}
+	if reply := query(t, s.Addr(), "example.org.", dnsmessage.TypeTXT); reply.RCode != dnsmessage.RCodeRefused {
+		t.Errorf("Expected REFUSED outside the zone, got %v", reply.RCode)
+	}
+}
+
+func TestSetupRecords(t *testing.T) {
+	records := SetupRecords("acme.example.com", "ns.acme.example.com", "203.0.113.10", []string{"*.example.com", "example.com", "api.example.org"})
+
+	expected := []Record{
+		{Name: "acme.example.com", Type: "NS", Value: "ns.acme.example.com"},
+		{Name: "ns.acme.example.com", Type: "A", Value: "203.0.113.10"},
+		{Name: "_acme-challenge.example.com", Type: "CNAME", Value: ChallengeLabel("example.com") + ".acme.example.com"},
+		{Name: "_acme-challenge.api.example.org", Type: "CNAME", Value: ChallengeLabel("api.example.org") + ".acme.example.com"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d records, got %+v", len(expected), records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("Record %d: expected %+v, got %+v", i, expected[i], records[i])
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/notify"
+)
+
+func TestParseCondition(t *testing.T) {
+	cond, err := ParseCondition("restarts > 3 in 10m")
+	if err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if cond.Metric != MetricRestarts || cond.Operator != ">" || cond.Threshold != 3 || cond.Window != 10*time.Minute {
+		t.Errorf("Unexpected condition: %+v", cond)
+	}
+
+	cond, err = ParseCondition("p95_latency > 2s")
+	if err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if cond.Threshold != 2 || cond.Window != DefaultWindow {
+		t.Errorf("Unexpected condition: %+v", cond)
+	}
+
+	cond, err = ParseCondition("error_rate > 5% in 1m for 5m")
+	if err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if cond.Threshold != 5 || cond.Window != time.Minute || cond.For != 5*time.Minute {
+		t.Errorf("Unexpected condition: %+v", cond)
+	}
+
+	cond, err = ParseCondition("cert_expires < 7d")
+	if err != nil {
+		t.Fatalf("Failed to parse condition: %v", err)
+	}
+	if cond.Threshold != (7*24*time.Hour).Seconds() || cond.FormatValue((6*24*time.Hour+time.Hour).Seconds()) != "6d" {
+		t.Errorf("Unexpected condition: %+v", cond)
+	}
+
+	for _, expr := range []string{"", "restarts >", "cpu > 3", "restarts ~ 3", "p95_latency > fast", "restarts > 3 during 10m", "restarts > 3 in 5m in 10m", "cert_expires < 7d in 1h"} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+type fakeSource struct {
+	restarts  int
+	errorRate float64
+}
+
+func (f *fakeSource) Restarts(app string, window time.Duration) int { return f.restarts }
+func (f *fakeSource) Requests(app string, window time.Duration) int { return 0 }
+func (f *fakeSource) ErrorRate(app string, window time.Duration) (float64, bool) {
+	return f.errorRate, true
+}
+func (f *fakeSource) LatencyPercentile(app string, q float64, window time.Duration) (time.Duration, bool) {
+	return 0, false
+}
+func (f *fakeSource) CertExpiry(app string) (time.Duration, bool) { return 0, false }
+
+type fakeSink struct {
+	mu   sync.Mutex
+	sent []notify.Notification
+}
+
+func (f *fakeSink) Name() string { return "fake" }
+func (f *fakeSink) Send(ctx context.Context, n notify.Notification) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func TestEngine_Transitions(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cond, _ := ParseCondition("restarts > 3 in 10m")
+	source := &fakeSource{}
+	sink := &fakeSink{}
+
+	engine, err := NewEngine([]Rule{{Name: "crashloop", App: "web", Condition: cond, Notify: []string{"fake"}}},
+		map[string]notify.Sink{"fake": sink}, source, logger)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	ctx := context.Background()
+	engine.Evaluate(ctx)
+	source.restarts = 4
+	engine.Evaluate(ctx)
+	engine.Evaluate(ctx) // still firing, no new notification
+	source.restarts = 0
+	engine.Evaluate(ctx)
+
+	if len(sink.sent) != 2 {
+		t.Fatalf("Expected 2 notifications, got %d", len(sink.sent))
+	}
+	if sink.sent[0].Severity != "critical" || sink.sent[1].Severity != "resolved" {
+		t.Errorf("Unexpected severities: %s, %s", sink.sent[0].Severity, sink.sent[1].Severity)
+	}
+
+	if _, err := NewEngine([]Rule{{Name: "x", Condition: cond, Notify: []string{"missing"}}}, nil, source, logger); err == nil {
+		t.Error("Expected error for unknown sink")
+	}
+}
+
+func TestEngine_For(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cond, _ := ParseCondition("error_rate > 5% for 50ms")
+	source := &fakeSource{errorRate: 10}
+	sink := &fakeSink{}
+	engine, err := NewEngine([]Rule{{Name: "errors", App: "web", Condition: cond, Notify: []string{"fake"}}},
+		map[string]notify.Sink{"fake": sink}, source, logger)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	ctx := context.Background()
+	engine.Evaluate(ctx)
+	if state := engine.States()[0]; state.Firing || !state.Pending {
+		t.Errorf("Expected the rule to be pending, got %+v", state)
+	}
+
+	// A dip below the threshold starts the wait over
+	source.errorRate = 1
+	engine.Evaluate(ctx)
+	source.errorRate = 10
+	engine.Evaluate(ctx)
+	time.Sleep(30 * time.Millisecond)
+	engine.Evaluate(ctx)
+	if len(sink.sent) != 0 {
+		t.Fatalf("Expected no notification before the condition held for 50ms, got %d", len(sink.sent))
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	engine.Evaluate(ctx)
+	if state := engine.States()[0]; !state.Firing || state.Pending || len(sink.sent) != 1 {
+		t.Errorf("Expected the rule to fire once, got %+v and %d notifications", state, len(sink.sent))
+	}
+}
@@ -0,0 +1,221 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/notify"
+)
+
+// Source provides the measurements alert conditions are evaluated against
+type Source interface {
+	Restarts(app string, window time.Duration) int
+	Requests(app string, window time.Duration) int
+	ErrorRate(app string, window time.Duration) (float64, bool)
+	LatencyPercentile(app string, q float64, window time.Duration) (time.Duration, bool)
+	CertExpiry(app string) (time.Duration, bool) // Until the first of the app's certificates expires
+}
+
+// Rule binds a condition to an app and the sinks to notify
+type Rule struct {
+	Name      string
+	App       string
+	Condition *Condition
+	Notify    []string
+}
+
+// State is the evaluation state of a rule
+type State struct {
+	Rule      string    `json:"rule"`
+	App       string    `json:"app"`
+	When      string    `json:"when"`
+	Firing    bool      `json:"firing"`
+	Pending   bool      `json:"pending,omitempty"` // The condition holds, but not yet for as long as required
+	Value     string    `json:"value,omitempty"`
+	Since     time.Time `json:"since,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+	holding   time.Time // When the condition started to hold
+}
+
+// Engine periodically evaluates alert rules and sends notifications on transitions
+type Engine struct {
+	rules    []Rule
+	sinks    map[string]notify.Sink
+	source   Source
+	interval time.Duration
+	states   map[int]*State
+	logger   *logrus.Entry
+	mu       sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewEngine creates a rules engine. Every sink referenced by a rule must exist.
+func NewEngine(rules []Rule, sinks map[string]notify.Sink, source Source, logger *logrus.Logger) (*Engine, error) {
+	for _, rule := range rules {
+		for _, name := range rule.Notify {
+			if _, exists := sinks[name]; !exists {
+				return nil, fmt.Errorf("alert %s: unknown notification sink %q", rule.Name, name)
+			}
+		}
+	}
+
+	return &Engine{
+		rules:    rules,
+		sinks:    sinks,
+		source:   source,
+		interval: 15 * time.Second,
+		states:   make(map[int]*State),
+		logger:   logger.WithField("component", "alert-engine"),
+		stopCh:   make(chan struct{}),
+	}, nil
+}
+
+// Start begins periodic rule evaluation
+func (e *Engine) Start(ctx context.Context) {
+	e.logger.WithField("rules", len(e.rules)).Info("Starting alert engine")
+
+	go func() {
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.stopCh:
+				return
+			case <-ticker.C:
+				e.Evaluate(ctx)
+			}
+		}
+	}()
+}
+
+// Stop stops rule evaluation
+func (e *Engine) Stop() {
+	e.stopOnce.Do(func() {
+		e.logger.Info("Stopping alert engine")
+		close(e.stopCh)
+	})
+}
+
+// Evaluate checks every rule once and notifies on state transitions
+func (e *Engine) Evaluate(ctx context.Context) {
+	now := time.Now()
+
+	for i, rule := range e.rules {
+		value, ok := e.measure(rule)
+		holds := ok && rule.Condition.Compare(value)
+
+		e.mu.Lock()
+		state, exists := e.states[i]
+		if !exists {
+			state = &State{Rule: rule.Name, App: rule.App, When: rule.Condition.String()}
+			e.states[i] = state
+		}
+		if !holds {
+			state.holding = time.Time{}
+		} else if state.holding.IsZero() {
+			state.holding = now
+		}
+		firing := holds && now.Sub(state.holding) >= rule.Condition.For
+		wasFiring := state.Firing
+		state.Firing = firing
+		state.Pending = holds && !firing
+		state.LastCheck = now
+		if ok {
+			state.Value = rule.Condition.FormatValue(value)
+		}
+		if firing != wasFiring {
+			state.Since = now
+		}
+		snapshot := *state
+		e.mu.Unlock()
+
+		switch {
+		case firing && !wasFiring:
+			e.notify(ctx, rule, snapshot, "critical", fmt.Sprintf("Alert %s firing", rule.Name))
+		case !firing && wasFiring:
+			e.notify(ctx, rule, snapshot, "resolved", fmt.Sprintf("Alert %s resolved", rule.Name))
+		}
+	}
+}
+
+// States returns the current state of every rule
+func (e *Engine) States() []State {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	states := make([]State, 0, len(e.rules))
+	for i, rule := range e.rules {
+		if state, exists := e.states[i]; exists {
+			states = append(states, *state)
+		} else {
+			states = append(states, State{Rule: rule.Name, App: rule.App, When: rule.Condition.String()})
+		}
+	}
+	return states
+}
+
+// measure returns the current value of the rule's metric
+func (e *Engine) measure(rule Rule) (float64, bool) {
+	cond := rule.Condition
+
+	switch cond.Metric {
+	case MetricRestarts:
+		return float64(e.source.Restarts(rule.App, cond.Window)), true
+	case MetricRequests:
+		return float64(e.source.Requests(rule.App, cond.Window)), true
+	case MetricErrorRate:
+		return e.source.ErrorRate(rule.App, cond.Window)
+	case MetricP50Latency, MetricP90Latency, MetricP95Latency, MetricP99Latency:
+		d, ok := e.source.LatencyPercentile(rule.App, percentile(cond.Metric), cond.Window)
+		return d.Seconds(), ok
+	case MetricCertExpires:
+		d, ok := e.source.CertExpiry(rule.App)
+		return d.Seconds(), ok
+	}
+	return 0, false
+}
+
+// notify delivers a notification for the rule to all its sinks
+func (e *Engine) notify(ctx context.Context, rule Rule, state State, severity, title string) {
+	logger := e.logger.WithFields(logrus.Fields{
+		"app":   rule.App,
+		"alert": rule.Name,
+		"value": state.Value,
+	})
+
+	if severity == "resolved" {
+		logger.Info("Alert resolved")
+	} else {
+		logger.Warn("Alert firing")
+	}
+
+	n := notify.Notification{
+		Title:     title,
+		Message:   fmt.Sprintf("%s (current: %s)", rule.Condition.String(), state.Value),
+		App:       rule.App,
+		Severity:  severity,
+		Timestamp: state.Since,
+		Fields: map[string]string{
+			"alert": rule.Name,
+			"when":  rule.Condition.String(),
+			"value": state.Value,
+		},
+	}
+
+	for _, name := range rule.Notify {
+		sink := e.sinks[name]
+		sendCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		if err := sink.Send(sendCtx, n); err != nil {
+			logger.WithError(err).WithField("sink", name).Error("Failed to send alert notification")
+		}
+		cancel()
+	}
+}
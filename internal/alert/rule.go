@@ -0,0 +1,178 @@
+package alert
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultWindow is the evaluation window used when a condition has no "in <window>" clause
+const DefaultWindow = 5 * time.Minute
+
+// Metric names supported in alert conditions
+const (
+	MetricRestarts    = "restarts"
+	MetricRequests    = "requests"
+	MetricErrorRate   = "error_rate"
+	MetricP50Latency  = "p50_latency"
+	MetricP90Latency  = "p90_latency"
+	MetricP95Latency  = "p95_latency"
+	MetricP99Latency  = "p99_latency"
+	MetricCertExpires = "cert_expires" // Time until the first certificate of the app expires
+)
+
+// Condition is a parsed alert expression such as "restarts > 3 in 10m"
+type Condition struct {
+	Metric    string
+	Operator  string
+	Threshold float64 // Durations are stored in seconds, percentages as 0-100
+	Window    time.Duration
+	For       time.Duration // How long the condition must hold before the alert fires
+	raw       string
+}
+
+// String returns the original expression
+func (c *Condition) String() string {
+	return c.raw
+}
+
+// ParseCondition parses an expression of the form
+// "<metric> <op> <threshold> [in <window>] [for <duration>]"
+func ParseCondition(expr string) (*Condition, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 3 && len(fields) != 5 && len(fields) != 7 {
+		return nil, fmt.Errorf("invalid alert condition %q: expected \"<metric> <op> <threshold> [in <window>] [for <duration>]\"", expr)
+	}
+
+	cond := &Condition{
+		Metric:   strings.ToLower(fields[0]),
+		Operator: fields[1],
+		Window:   DefaultWindow,
+		raw:      strings.Join(fields, " "),
+	}
+
+	switch cond.Operator {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return nil, fmt.Errorf("invalid alert condition %q: unknown operator %q", expr, cond.Operator)
+	}
+
+	threshold, err := parseThreshold(cond.Metric, fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid alert condition %q: %w", expr, err)
+	}
+	cond.Threshold = threshold
+
+	seen := make(map[string]bool)
+	for i := 3; i < len(fields); i += 2 {
+		clause := strings.ToLower(fields[i])
+		if (clause != "in" && clause != "for") || seen[clause] {
+			return nil, fmt.Errorf("invalid alert condition %q: expected \"in <window>\" or \"for <duration>\" after the threshold", expr)
+		}
+		seen[clause] = true
+		d, err := parseDuration(fields[i+1])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid alert condition %q: invalid %s duration %q", expr, clause, fields[i+1])
+		}
+		if clause == "for" {
+			cond.For = d
+			continue
+		}
+		if cond.Metric == MetricCertExpires {
+			return nil, fmt.Errorf("invalid alert condition %q: %s is not measured over a window", expr, cond.Metric)
+		}
+		cond.Window = d
+	}
+
+	return cond, nil
+}
+
+// parseDuration parses a Go duration, or a number of days such as "7d"
+func parseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// parseThreshold parses the threshold according to the metric's unit
+func parseThreshold(metric, value string) (float64, error) {
+	switch metric {
+	case MetricRestarts, MetricRequests:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("threshold for %s must be a number, got %q", metric, value)
+		}
+		return n, nil
+	case MetricErrorRate:
+		n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("threshold for %s must be a percentage, got %q", metric, value)
+		}
+		return n, nil
+	case MetricP50Latency, MetricP90Latency, MetricP95Latency, MetricP99Latency, MetricCertExpires:
+		d, err := parseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("threshold for %s must be a duration, got %q", metric, value)
+		}
+		return d.Seconds(), nil
+	default:
+		return 0, fmt.Errorf("unknown metric %q", metric)
+	}
+}
+
+// Compare applies the condition's operator to a measured value
+func (c *Condition) Compare(value float64) bool {
+	switch c.Operator {
+	case ">":
+		return value > c.Threshold
+	case ">=":
+		return value >= c.Threshold
+	case "<":
+		return value < c.Threshold
+	case "<=":
+		return value <= c.Threshold
+	case "==":
+		return value == c.Threshold
+	case "!=":
+		return value != c.Threshold
+	}
+	return false
+}
+
+// FormatValue renders a measured value in the metric's unit
+func (c *Condition) FormatValue(value float64) string {
+	switch c.Metric {
+	case MetricErrorRate:
+		return fmt.Sprintf("%.1f%%", value)
+	case MetricP50Latency, MetricP90Latency, MetricP95Latency, MetricP99Latency:
+		return time.Duration(value * float64(time.Second)).Round(time.Millisecond).String()
+	case MetricCertExpires:
+		if days := int(value / 86400); days != 0 {
+			return fmt.Sprintf("%dd", days)
+		}
+		return time.Duration(value * float64(time.Second)).Round(time.Minute).String()
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+// percentile returns the quantile for latency metrics
+func percentile(metric string) float64 {
+	switch metric {
+	case MetricP50Latency:
+		return 0.50
+	case MetricP90Latency:
+		return 0.90
+	case MetricP95Latency:
+		return 0.95
+	case MetricP99Latency:
+		return 0.99
+	}
+	return 0
+}
@@ -0,0 +1,1247 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/audit"
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/jobs"
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+func TestIdempotent(t *testing.T) {
+	s := &Server{idempotency: newIdempotencyCache(time.Minute)}
+
+	var calls int32
+	handler := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte{byte('0' + n)})
+	})
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	first := send("/api/v1/stop", "abc")
+	retry := send("/api/v1/stop", "abc")
+	if calls != 1 {
+		t.Fatalf("Expected handler to run once, ran %d times", calls)
+	}
+	if retry.Code != http.StatusAccepted || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected replayed response, got %d %q", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("Expected replay header")
+	}
+
+	if rec := send("/api/v1/restart?app=web", "abc"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for key reuse on a different request, got %d", rec.Code)
+	}
+
+	send("/api/v1/stop", "")
+	if calls != 2 {
+		t.Errorf("Expected requests without key to always run, ran %d times", calls)
+	}
+}
+
+func TestParseFormation(t *testing.T) {
+	formation, err := ParseFormation("web=3,worker=0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(formation) != 2 || formation[0] != (FormationEntry{App: "web", Instances: 3}) || formation[1] != (FormationEntry{App: "worker", Instances: 0}) {
+		t.Errorf("Unexpected formation %+v", formation)
+	}
+
+	for _, invalid := range []string{"", "web", "=2", "web=-1", "web=x", "web=1,web=2"} {
+		if _, err := ParseFormation(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestHandleStartApp(t *testing.T) {
+	started := make(chan string, 1)
+	s := &Server{jobs: jobs.NewManager(time.Hour, time.Minute)}
+	s.SetStarter(func(ctx context.Context, name string) error {
+		started <- name
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	s.handleStartApp(rec, httptest.NewRequest(http.MethodPost, "/api/v1/start/web", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case name := <-started:
+		if name != "web" {
+			t.Errorf("Expected web to be started, got %q", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start job did not run")
+	}
+
+	for _, path := range []string{"/api/v1/start/", "/api/v1/start/web/1"} {
+		rec := httptest.NewRecorder()
+		s.handleStartApp(rec, httptest.NewRequest(http.MethodPost, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestHandleLogsFilter(t *testing.T) {
+	logManager := logs.NewLogManager(100)
+	logManager.Log("web", "info", "GET /health 200")
+	logManager.Log("web", "warn", "slow request: timeout after 5s")
+	logManager.Log("api", "error", "connection refused")
+	logManager.Log("api", "warn", "retrying")
+	logManager.Log("web.2", "info", "GET / 200")
+	logManager.Log("webhook", "info", "delivered")
+	logManager.Log("system", "info", "Started web")
+	s := &Server{logManager: logManager}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"/api/v1/logs", []string{"GET /health 200", "slow request: timeout after 5s", "connection refused", "retrying", "GET / 200", "delivered", "Started web"}},
+		{"/api/v1/logs?process=web,system", []string{"GET /health 200", "slow request: timeout after 5s", "GET / 200", "Started web"}},
+		{"/api/v1/logs?process=web.2", []string{"GET / 200"}},
+		{"/api/v1/logs?exclude=web,system&level=info", []string{"connection refused", "retrying", "delivered"}},
+		{"/api/v1/logs?process=web&exclude=web.2", []string{"GET /health 200", "slow request: timeout after 5s"}},
+		{"/api/v1/logs?level=warn&lines=2", []string{"connection refused", "retrying"}},
+		{"/api/v1/logs?level=error", []string{"connection refused"}},
+		{"/api/v1/logs?grep=timeout%7Crefused", []string{"slow request: timeout after 5s", "connection refused"}},
+		{"/api/v1/logs?since=1h&level=warn&grep=retry", []string{"retrying"}},
+		{"/api/v1/logs?until=2000-01-01T00:00:00Z", nil},
+		{"/api/v1/logs/web?level=warn", []string{"slow request: timeout after 5s"}},
+		{"/api/v1/logs/web", []string{"GET /health 200", "slow request: timeout after 5s", "GET / 200"}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if strings.HasPrefix(tt.query, "/api/v1/logs/") {
+			s.handleLogsProcess(rec, httptest.NewRequest(http.MethodGet, tt.query, nil))
+		} else {
+			s.handleLogs(rec, httptest.NewRequest(http.MethodGet, tt.query, nil))
+		}
+		var response struct {
+			Logs []logs.LogEntry `json:"logs"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", tt.query, err)
+		}
+		var messages []string
+		for _, entry := range response.Logs {
+			messages = append(messages, entry.Message)
+		}
+		if strings.Join(messages, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.expected, messages)
+		}
+	}
+
+	for _, query := range []string{"/api/v1/logs?level=loud", "/api/v1/logs?grep=(", "/api/v1/logs?since=yesterday", "/api/v1/logs?since=1m&until=1h"} {
+		rec := httptest.NewRecorder()
+		s.handleLogs(rec, httptest.NewRequest(http.MethodGet, query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestHandleLogsExport(t *testing.T) {
+	logManager := logs.NewLogManager(100)
+	logManager.Log("web", "info", "GET / 200")
+	logManager.Add(logs.LogEntry{Timestamp: time.Now(), Level: "error", Process: "web.2", Message: `panic: "boom", exiting`, Stream: logs.Stderr})
+	logManager.Log("api", "error", "connection refused")
+	s := &Server{logManager: logManager}
+
+	rec := httptest.NewRecorder()
+	s.handleLogsExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/export?process=web&format=csv", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Expected a CSV export, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV: %v", err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != "timestamp,level,process,stream,message" {
+		t.Fatalf("Expected a header and 2 rows, got %q", rows)
+	}
+	if rows[2][2] != "web.2" || rows[2][3] != "stderr" || rows[2][4] != `panic: "boom", exiting` {
+		t.Errorf("Unexpected row: %q", rows[2])
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleLogsExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/export?level=error", nil))
+	var entries []logs.LogEntry
+	for decoder := json.NewDecoder(rec.Body); decoder.More(); {
+		var entry logs.LogEntry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Expected NDJSON: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 || entries[1].Process != "api" {
+		t.Errorf("Expected the 2 errors by default as NDJSON, got %+v", entries)
+	}
+	if oldest, err := time.Parse(time.RFC3339Nano, rec.Header().Get(LogsOldestHeader)); err != nil || time.Since(oldest) > time.Minute {
+		t.Errorf("Expected the time of the oldest entry, got %q", rec.Header().Get(LogsOldestHeader))
+	}
+
+	rec = httptest.NewRecorder()
+	s.handleLogsExport(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs/export?format=xml", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown format, got %d", rec.Code)
+	}
+}
+
+func TestLogsWebSocket(t *testing.T) {
+	logManager := logs.NewLogManager(100)
+	s := &Server{logManager: logManager}
+	server := httptest.NewServer(websocket.Server{Handler: s.handleLogsWebSocket, Handshake: checkWebSocketOrigin})
+	defer server.Close()
+
+	endpoint := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/logs/ws?process=web&level=warn"
+	ws, err := websocket.Dial(endpoint, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg logMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "connected" {
+		t.Fatalf("Expected connected message, got %+v: %v", msg, err)
+	}
+
+	logManager.Log("api", "error", "other process")
+	logManager.Log("web", "info", "below level")
+	logManager.Log("web", "error", "pushed")
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatalf("Failed to receive logs: %v", err)
+	}
+	if msg.Type != "logs" || len(msg.Logs) != 1 || msg.Logs[0].Message != "pushed" {
+		t.Errorf("Expected only the matching entry, got %+v", msg)
+	}
+
+	if _, err := websocket.Dial(endpoint, "", "https://evil.example.com"); err == nil {
+		t.Error("Expected a foreign origin to be refused")
+	}
+}
+
+func TestEventsWebSocket(t *testing.T) {
+	bus := events.NewBus(logrus.New())
+	s := &Server{}
+	s.SetEventBus(bus)
+	server := httptest.NewServer(websocket.Server{Handler: s.handleEventsWebSocket, Handshake: checkWebSocketOrigin})
+	defer server.Close()
+
+	endpoint := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/events/ws?app=web&type=crashed,health"
+	ws, err := websocket.Dial(endpoint, "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg eventMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "connected" {
+		t.Fatalf("Expected connected message, got %+v: %v", msg, err)
+	}
+
+	bus.Publish(events.Event{Type: events.Crashed, App: "api", Instance: "api", Message: "other app"})
+	bus.Publish(events.Event{Type: events.Started, App: "web", Instance: "web.2", Message: "other type"})
+	bus.Publish(events.Event{Type: events.CertRenewed, Message: "no app"})
+	bus.Publish(events.Event{Type: events.Crashed, App: "web", Instance: "web.2", Message: "pushed"})
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		t.Fatalf("Failed to receive event: %v", err)
+	}
+	if msg.Type != "event" || msg.Event == nil || msg.Event.Message != "pushed" || msg.Event.Instance != "web.2" {
+		t.Errorf("Expected only the matching event, got %+v", msg)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleEventsStream(rec, httptest.NewRequest(http.MethodGet, "/api/v1/events?type=exploded", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown event type to be refused, got %d", rec.Code)
+	}
+}
+
+func TestAttachWebSocket(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{logger: logger.WithField("component", "api-server"), processManager: process.NewEnhancedManager(logger, 100)}
+	ctx := context.Background()
+	app := config.AppConfig{
+		Name:    "repl",
+		Command: "sh",
+		Args:    []string{"-c", `while read line; do [ "$line" = quit ] && exit 3; echo "got $line"; done`},
+		Stdin:   true,
+	}
+	if err := s.processManager.Start(ctx, app); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer s.processManager.StopAll(ctx)
+
+	server := httptest.NewServer(websocket.Server{Handler: s.handleAttachWebSocket, Handshake: checkWebSocketOrigin})
+	defer server.Close()
+	endpoint := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/attach/"
+	ws, err := websocket.Dial(endpoint+"repl", "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	var msg attachMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "attached" || !msg.Stdin {
+		t.Fatalf("Expected attached message with stdin, got %+v: %v", msg, err)
+	}
+	websocket.JSON.Send(ws, attachMessage{Type: "input", Data: []byte("hello\nquit\n")})
+	var output string
+	for {
+		msg = attachMessage{}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			t.Fatalf("Failed to receive: %v (output %q)", err, output)
+		}
+		if msg.Type != "output" {
+			break
+		}
+		output += string(msg.Data)
+	}
+	if output != "got hello\n" {
+		t.Errorf("Expected the output of the input, got %q", output)
+	}
+	if msg.Type != "exited" || msg.ExitCode == nil || *msg.ExitCode != 3 {
+		t.Errorf("Expected exited message with code 3, got %+v", msg)
+	}
+
+	ws, err = websocket.Dial(endpoint+"missing", "", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer ws.Close()
+	if err := websocket.JSON.Receive(ws, &msg); err != nil || msg.Type != "error" {
+		t.Errorf("Expected an error for a missing process, got %+v: %v", msg, err)
+	}
+}
+
+func TestHandleApp(t *testing.T) {
+	s := &Server{
+		jobs:           jobs.NewManager(time.Hour, time.Minute),
+		processManager: process.NewEnhancedManager(logrus.New(), 100),
+	}
+	s.SetStarter(func(ctx context.Context, name string) error { return nil })
+	s.SetScaler(func(ctx context.Context, name string, instances int) error { return nil })
+	s.SetRemover(func(ctx context.Context, name string) ([]process.StopResult, error) {
+		return []process.StopResult{{Name: name, PID: 42, Status: "error", Error: errors.New("permission denied")}},
+			fmt.Errorf("failed to stop %s", name)
+	})
+
+	run := func(method, target string) jobs.Job {
+		rec := httptest.NewRecorder()
+		s.handleApp(rec, httptest.NewRequest(method, target, nil))
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("%s %s: expected 202, got %d: %s", method, target, rec.Code, rec.Body.String())
+		}
+		var response struct {
+			JobID string `json:"job_id"`
+		}
+		json.NewDecoder(rec.Body).Decode(&response)
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if job, _ := s.jobs.Get(response.JobID); job.Done() {
+				return job
+			}
+		}
+		t.Fatalf("%s %s: job did not finish", method, target)
+		return jobs.Job{}
+	}
+
+	job := run(http.MethodPost, "/api/v1/apps/web/start")
+	result, ok := job.Result.(AppResult)
+	if job.Status != jobs.StatusSucceeded || !ok || result.App != "web" || result.Action != "start" || result.Instances == nil {
+		t.Errorf("Unexpected start job %+v", job)
+	}
+
+	job = run(http.MethodDelete, "/api/v1/apps/web")
+	result, _ = job.Result.(AppResult)
+	if job.Status != jobs.StatusFailed || len(result.Instances) != 1 || result.Instances[0].Error != "permission denied" {
+		t.Errorf("Unexpected remove job %+v", job)
+	}
+
+	for _, tc := range []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodPost, "/api/v1/apps/", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/apps/web/deploy", http.StatusNotFound},
+		{http.MethodGet, "/api/v1/apps/web/start", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/apps/web", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/apps/web/scale?instances=-1", http.StatusBadRequest},
+	} {
+		rec := httptest.NewRecorder()
+		s.handleApp(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.target, tc.status, rec.Code)
+		}
+	}
+}
+
+func TestHandleApps(t *testing.T) {
+	s := &Server{
+		logger:         logrus.New().WithField("component", "api-server"),
+		jobs:           jobs.NewManager(time.Hour, time.Minute),
+		processManager: process.NewEnhancedManager(logrus.New(), 100),
+	}
+	started := make(chan string, 1)
+	s.SetStarter(func(ctx context.Context, name string) error {
+		started <- name
+		return nil
+	})
+	s.SetRegistrar(func(app config.AppConfig) (config.AppConfig, error) {
+		if app.Name == "web" {
+			return config.AppConfig{}, fmt.Errorf("app web %w", config.ErrAppExists)
+		}
+		return app, nil
+	})
+
+	for body, status := range map[string]int{
+		`{"name": "api", "command": "./api"}`:  http.StatusAccepted,
+		`{"name": "web", "command": "./web"}`:  http.StatusConflict,
+		`{"name": "api", "commmand": "./api"}`: http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		s.handleApps(rec, req)
+		if rec.Code != status {
+			t.Errorf("%s: expected %d, got %d: %s", body, status, rec.Code, rec.Body.String())
+		}
+	}
+	select {
+	case name := <-started:
+		if name != "api" {
+			t.Errorf("Expected api to be started, got %q", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Registered app was not started")
+	}
+
+	// Definitions come as JSON or YAML only, never as a form or plain text
+	for _, contentType := range []string{"", "text/plain", "application/x-www-form-urlencoded"} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(`{"name": "sh", "command": "id"}`))
+		req.Header.Set("Content-Type", contentType)
+		s.handleApps(rec, req)
+		if rec.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("%q: expected 415, got %d", contentType, rec.Code)
+		}
+	}
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	// No tokens are configured, so only the origin checks stand in the way
+	s := NewServer(logrus.New(), process.NewEnhancedManager(logrus.New(), 100), logs.NewLogManager(10), 0)
+	registered := make(chan string, 1)
+	s.SetRegistrar(func(app config.AppConfig) (config.AppConfig, error) {
+		registered <- app.Name
+		return app, nil
+	})
+	s.SetStarter(func(ctx context.Context, name string) error { return nil })
+	handler := s.tcpHandler(s.newMux())
+
+	tests := []struct {
+		name        string
+		origin      string
+		contentType string
+		status      int
+	}{
+		{"page of another site", "https://evil.example.com", "text/plain", http.StatusForbidden},
+		{"page of another site sending JSON", "https://evil.example.com", "application/json", http.StatusForbidden},
+		{"opaque origin", "null", "application/json", http.StatusForbidden},
+		{"plain text without origin", "", "text/plain", http.StatusUnsupportedMediaType},
+		{"form from localhost", "http://localhost:3000", "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"local page", "http://127.0.0.1:3000", "application/json", http.StatusAccepted},
+		{"the dashboard", "http://example.com", "application/yaml", http.StatusAccepted},
+		{"CLI", "", "application/json; charset=utf-8", http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/apps", strings.NewReader(`{"name": "sh", "command": "sh", "args": ["-c", "id"]}`))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			select {
+			case <-registered:
+				if tt.status != http.StatusAccepted {
+					t.Error("Expected the app not to be registered")
+				}
+			default:
+				if tt.status == http.StatusAccepted {
+					t.Error("Expected the app to be registered")
+				}
+			}
+		})
+	}
+
+	// Bodiless actions keep working from curl, but not from other sites
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/apps/missing/stop", nil))
+	if rec.Code == http.StatusUnsupportedMediaType || rec.Code == http.StatusForbidden {
+		t.Errorf("Expected a bodiless POST without origin to be served, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/apps/missing/stop", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a bodiless POST from another site to be refused, got %d", rec.Code)
+	}
+}
+
+func TestHandleConfig(t *testing.T) {
+	s := &Server{
+		logger: logrus.New().WithField("component", "api-server"),
+		jobs:   jobs.NewManager(time.Hour, time.Minute),
+	}
+	s.SetConfigSource(func() *config.Config {
+		return &config.Config{
+			Server: config.ServerConfig{HTTPPort: 8080, APITokens: []config.APIToken{{Name: "admin", Token: "admin-token-0123456789"}}},
+			Apps:   []config.AppConfig{{Name: "web", Command: "./web", Environment: map[string]string{"API_KEY": "hunter2"}}},
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	s.handleConfig(rec, httptest.NewRequest(http.MethodGet, "/api/v1/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "hunter2") || strings.Contains(body, "admin-token") {
+		t.Errorf("Secrets not redacted: %s", body)
+	}
+	var document struct {
+		Server struct {
+			HTTPPort int `json:"http_port"`
+		} `json:"server"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil || document.Server.HTTPPort != 8080 {
+		t.Errorf("Expected server.http_port 8080, got %s (%v)", body, err)
+	}
+
+	changes := make(chan config.Changes, 1)
+	s.SetConfigReloader(func(ctx context.Context, report func(string)) (config.Changes, error) {
+		changed := config.Changes{Added: []string{"api"}}
+		changes <- changed
+		return changed, nil
+	})
+	rec = httptest.NewRecorder()
+	s.handleReload(rec, httptest.NewRequest(http.MethodPost, "/api/v1/reload", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Configuration was not reloaded")
+	}
+}
+
+func TestHandleLogsPaging(t *testing.T) {
+	logManager := logs.NewLogManager(100)
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Entries logged at the same time must not be lost or repeated across pages
+	for i, offset := range []int{0, 1, 1, 1, 2, 3, 3} {
+		logManager.Add(logs.LogEntry{Timestamp: at.Add(time.Duration(offset) * time.Second), Level: "info", Process: "web", Message: strconv.Itoa(i)})
+	}
+	s := &Server{logManager: logManager}
+
+	var pages []string
+	cursor := ""
+	for len(pages) < 10 {
+		rec := httptest.NewRecorder()
+		s.handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs?limit=2&fields=message&cursor="+cursor, nil))
+		var response struct {
+			Logs       []map[string]string `json:"logs"`
+			NextCursor string              `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		var page []string
+		for _, entry := range response.Logs {
+			if len(entry) != 1 {
+				t.Errorf("Expected only the message field, got %v", entry)
+			}
+			page = append(page, entry["message"])
+		}
+		pages = append(pages, strings.Join(page, ","))
+		if cursor = response.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if got := strings.Join(pages, "|"); got != "5,6|3,4|1,2|0" {
+		t.Errorf("Expected pages 5,6|3,4|1,2|0, got %s", got)
+	}
+
+	rec := httptest.NewRecorder()
+	s.handleLogs(rec, httptest.NewRequest(http.MethodGet, "/api/v1/logs?limit=2&offset=1", nil))
+	if !strings.Contains(rec.Body.String(), `"message":"4"`) || strings.Contains(rec.Body.String(), `"message":"6"`) {
+		t.Errorf("Expected offset to skip the latest entry: %s", rec.Body.String())
+	}
+	for _, query := range []string{"/api/v1/logs?limit=-1", "/api/v1/logs?fields=msg", "/api/v1/logs?cursor=%25"} {
+		rec := httptest.NewRecorder()
+		s.handleLogs(rec, httptest.NewRequest(http.MethodGet, query, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestPageProcesses(t *testing.T) {
+	started := time.Now()
+	infos := []process.ProcessInfo{
+		{Name: "web.2", Status: "failed", StartTime: started},
+		{Name: "api", Status: "running", StartTime: started.Add(-time.Hour)},
+		{Name: "web", Status: "running", StartTime: started},
+		{Name: "worker", Status: "failed", StartTime: started},
+	}
+
+	var names []string
+	page := pageParams{limit: 3}
+	for {
+		result, next, err := pageProcesses(append([]process.ProcessInfo{}, infos...), page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range result {
+			names = append(names, info.Name)
+		}
+		if next == "" {
+			break
+		}
+		page.cursor = next
+	}
+	if got := strings.Join(names, ","); got != "api,web,web.2,worker" {
+		t.Errorf("Expected every process once in name order, got %s", got)
+	}
+
+	filter := statusFilter{apps: []string{"web"}, statuses: []string{"failed"}}
+	var matched []string
+	for _, info := range infos {
+		if filter.match(info) {
+			matched = append(matched, info.Name)
+		}
+	}
+	if strings.Join(matched, ",") != "web.2" {
+		t.Errorf("Expected only web.2 to match, got %v", matched)
+	}
+	if (statusFilter{since: started.Add(-time.Minute)}).match(infos[1]) {
+		t.Error("Expected a process started before since not to match")
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	s := &Server{logger: logrus.New().WithField("component", "api-server")}
+	var reasons []string
+	s.SetReadiness(func() []string { return reasons })
+
+	reasons = []string{"apps are starting or guvnor is stopping"}
+	rec := httptest.NewRecorder()
+	s.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/api/v1/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "apps are starting") {
+		t.Errorf("Expected 503 with the reason, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	reasons = nil
+	rec = httptest.NewRecorder()
+	s.handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/api/v1/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 once ready, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	s := &Server{
+		logger: logrus.New().WithField("component", "api-server"),
+		jobs:   jobs.NewManager(time.Hour, time.Minute),
+	}
+	s.SetAccessTokens([]config.APIToken{
+		{Name: "admin", Token: "admin-token-0123456789"},
+		{Name: "ci", Token: "ci-token-0123456789", Apps: []string{"web"}, Actions: []string{config.APIActionRestart}},
+		{Name: "frontend", Token: "frontend-token-0123456789", Labels: map[string]string{"team": "frontend"}},
+	}, func(app string) map[string]string {
+		if app == "docs" {
+			return map[string]string{"team": "frontend"}
+		}
+		return nil
+	})
+	handler := s.authorize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		token  string
+		method string
+		target string
+		status int
+	}{
+		{"", http.MethodGet, "/api/v1/ping", http.StatusOK},
+		{"", http.MethodGet, "/api/v1/healthz", http.StatusOK},
+		{"", http.MethodGet, "/api/v1/readyz", http.StatusOK},
+		{"", http.MethodGet, "/api/v1/status", http.StatusUnauthorized},
+		{"wrong-token-0123456789", http.MethodGet, "/api/v1/status", http.StatusUnauthorized},
+		{"admin-token-0123456789", http.MethodPost, "/api/v1/stop", http.StatusOK},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/restart?app=web", http.StatusOK},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/restart?app=web.2", http.StatusOK},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/restart?app=api", http.StatusForbidden},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/stop/web", http.StatusForbidden},
+		{"ci-token-0123456789", http.MethodGet, "/api/v1/logs/web", http.StatusOK},
+		{"ci-token-0123456789", http.MethodGet, "/api/v1/status", http.StatusOK},
+		{"ci-token-0123456789", http.MethodGet, "/api/v1/events?app=web", http.StatusOK},
+		{"ci-token-0123456789", http.MethodGet, "/api/v1/events", http.StatusOK},
+		{"ci-token-0123456789", http.MethodGet, "/api/v1/orphans", http.StatusForbidden},
+		{"frontend-token-0123456789", http.MethodPost, "/api/v1/scale?formation=docs=2", http.StatusOK},
+		{"frontend-token-0123456789", http.MethodPost, "/api/v1/scale?formation=docs=2,web=1", http.StatusForbidden},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/apps/web/restart", http.StatusOK},
+		{"ci-token-0123456789", http.MethodPost, "/api/v1/apps/web/stop", http.StatusForbidden},
+		{"ci-token-0123456789", http.MethodDelete, "/api/v1/apps/web", http.StatusForbidden},
+		{"frontend-token-0123456789", http.MethodDelete, "/api/v1/apps/docs", http.StatusOK},
+		{"frontend-token-0123456789", http.MethodPost, "/api/v1/apps/web/start", http.StatusForbidden},
+		{"frontend-token-0123456789", http.MethodPost, "/api/v1/reload", http.StatusForbidden},
+		{"frontend-token-0123456789", http.MethodGet, "/api/v1/config", http.StatusForbidden},
+		{"admin-token-0123456789", http.MethodPost, "/api/v1/reload", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.token != "" {
+			r.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s with %q: expected %d, got %d", tc.method, tc.target, tc.token, tc.status, rec.Code)
+		}
+	}
+
+	// Jobs can be followed with a token covering their apps
+	job := s.jobs.Submit("restart", "web", func(ctx context.Context, report func(string)) (interface{}, error) { return nil, nil })
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+job.ID, nil)
+	r.Header.Set("Authorization", "Bearer ci-token-0123456789")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the ci token to follow its job, got %d", rec.Code)
+	}
+}
+
+func TestScopedReads(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logManager := logs.NewLogManager(100)
+	s := NewServer(logger, process.NewEnhancedManager(logger, 100), logManager, 0)
+	s.SetAccessTokens([]config.APIToken{
+		{Name: "admin", Token: "admin-token-0123456789"},
+		{Name: "ci", Token: "ci-token-0123456789", Apps: []string{"web"}},
+	}, nil)
+	handler := s.authorize(s.newMux())
+
+	for _, name := range []string{"web", "api"} {
+		if err := s.processManager.Start(context.Background(), config.AppConfig{Name: name, Command: "sleep", Args: []string{"60"}}); err != nil {
+			t.Fatalf("Failed to start %s: %v", name, err)
+		}
+	}
+	t.Cleanup(func() { s.processManager.StopAll(context.Background()) })
+	logManager.Log("web", "info", "web request")
+	logManager.Log("web.2", "info", "web.2 request")
+	logManager.Log("api", "info", "api request")
+	logManager.Log("system", "info", "Started web")
+	s.SetCertHealth(func() []cert.HostCertificate {
+		return []cert.HostCertificate{{Hostname: "web.example.com", App: "web"}, {Hostname: "api.example.com", App: "api"}}
+	})
+	s.SetIssuanceStatus(func() []cert.IssuanceStatus {
+		return []cert.IssuanceStatus{{Hostname: "web.example.com"}, {Hostname: "api.example.com"}}
+	})
+
+	get := func(token, target string, response any) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s with %s: expected 200, got %d: %s", target, token, rec.Code, rec.Body.String())
+		}
+		if err := json.NewDecoder(rec.Body).Decode(response); err != nil {
+			t.Fatalf("GET %s: failed to decode response: %v", target, err)
+		}
+	}
+
+	// The whole server's reads answer the ci token with web only
+	tests := []struct {
+		target string
+		names  func(body []byte) []string
+		admin  string
+		scoped string
+	}{
+		{"/api/v1/status", func(body []byte) []string {
+			var response struct{ Processes []process.ProcessInfo }
+			json.Unmarshal(body, &response)
+			var names []string
+			for _, proc := range response.Processes {
+				names = append(names, proc.Name)
+			}
+			return names
+		}, "api,web", "web"},
+		{"/api/v1/logs", func(body []byte) []string {
+			var response struct{ Logs []logs.LogEntry }
+			json.Unmarshal(body, &response)
+			var names []string
+			for _, entry := range response.Logs {
+				names = append(names, entry.Process)
+			}
+			return names
+		}, "web,web.2,api,system", "web,web.2"},
+		{"/api/v1/certs", func(body []byte) []string {
+			var response struct {
+				Hostnames []cert.HostCertificate
+				Issuance  []cert.IssuanceStatus
+			}
+			json.Unmarshal(body, &response)
+			var names []string
+			for _, host := range response.Hostnames {
+				names = append(names, host.Hostname)
+			}
+			for _, status := range response.Issuance {
+				names = append(names, "issuance "+status.Hostname)
+			}
+			return names
+		}, "web.example.com,api.example.com,issuance web.example.com,issuance api.example.com", "web.example.com,issuance web.example.com"},
+	}
+	for _, tt := range tests {
+		for token, expected := range map[string]string{"admin-token-0123456789": tt.admin, "ci-token-0123456789": tt.scoped} {
+			var body json.RawMessage
+			get(token, tt.target, &body)
+			if got := strings.Join(tt.names(body), ","); got != expected {
+				t.Errorf("GET %s with %s: expected %s, got %s", tt.target, token, expected, got)
+			}
+		}
+	}
+
+	// Asking for another app is still refused rather than filtered
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/logs?process=api", nil)
+	r.Header.Set("Authorization", "Bearer ci-token-0123456789")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for the logs of another app, got %d", rec.Code)
+	}
+}
+
+func TestRequestScopeRoutes(t *testing.T) {
+	s := NewServer(logrus.New(), nil, logs.NewLogManager(10), 0)
+
+	// The action of every write to every route; a new route must be listed
+	// here, so its writes are classified before tokens can reach it
+	post := func(action string) map[string]string { return map[string]string{http.MethodPost: action} }
+	anyWrite := func(action string) map[string]string {
+		return map[string]string{http.MethodPost: action, http.MethodPut: action, http.MethodDelete: action}
+	}
+	writes := map[string]map[string]string{
+		"/api/v1/ping":         nil,
+		"/api/v1/healthz":      nil,
+		"/api/v1/readyz":       nil,
+		"/api/v1/openapi.json": nil,
+		"/api/v1/status":       nil,
+		"/api/v1/logs":         nil,
+		"/api/v1/logs/":        nil,
+		"/api/v1/logs/stream":  nil,
+		"/api/v1/logs/export":  nil,
+		"/api/v1/logs/ws":      nil,
+		"/api/v1/events":       nil,
+		"/api/v1/events/ws":    nil,
+		"/api/v1/attach/":      anyWrite(config.APIActionAttach),
+		"/api/v1/start/":       anyWrite(config.APIActionStart),
+		"/api/v1/stop":         anyWrite(config.APIActionStop),
+		"/api/v1/stop/":        anyWrite(config.APIActionStop),
+		"/api/v1/restart":      anyWrite(config.APIActionRestart),
+		"/api/v1/reload":       anyWrite(config.APIActionReload),
+		"/api/v1/config":       nil,
+		"/api/v1/reset":        anyWrite(config.APIActionReset),
+		"/api/v1/scale":        anyWrite(config.APIActionScale),
+		"/api/v1/flags":        post(config.APIActionFlags),
+		"/api/v1/orphans":      post(config.APIActionOrphans),
+		"/api/v1/deploy":       anyWrite(config.APIActionDeploy),
+		"/api/v1/apps":         post(config.APIActionRegister),
+		"/api/v1/apps/":        {http.MethodDelete: config.APIActionRemove},
+		"/api/v1/health":       nil,
+		"/api/v1/certs":        nil,
+		"/api/v1/jobs":         nil,
+		"/api/v1/jobs/":        nil,
+	}
+
+	for _, route := range s.routes() {
+		expected, listed := writes[route.pattern]
+		if !listed {
+			t.Errorf("Expected the scope of %s to be listed", route.pattern)
+			continue
+		}
+		target := route.pattern
+		if strings.HasSuffix(target, "/") {
+			target += "web"
+		}
+		if action, _ := s.requestScope(httptest.NewRequest(http.MethodGet, target, nil)); action == "" {
+			t.Errorf("Expected GET %s to have an action", target)
+		}
+		for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+			action, _ := s.requestScope(httptest.NewRequest(method, target, nil))
+			if action != expected[method] {
+				t.Errorf("%s %s: expected action %q, got %q", method, target, expected[method], action)
+			}
+		}
+	}
+
+	// Writes without an action are denied to restricted tokens only
+	admin := &config.APIToken{Name: "admin"}
+	ci := &config.APIToken{Name: "ci", Actions: []string{config.APIActionRestart}}
+	web := &config.APIToken{Name: "web", Apps: []string{"web"}}
+	if reason := tokenDenies(admin, "", nil, nil); reason != "" {
+		t.Errorf("Expected an unrestricted token to be allowed, got %q", reason)
+	}
+	for _, token := range []*config.APIToken{ci, web} {
+		if reason := tokenDenies(token, "", []string{"web"}, nil); reason == "" {
+			t.Errorf("Expected token %s to be denied a request without an action", token.Name)
+		}
+	}
+}
+
+func TestEnforceFreeze(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{logger: logger.WithField("component", "api-server")}
+	auditLog := audit.Open(filepath.Join(t.TempDir(), audit.FileName))
+	window := &config.FreezeWindow{Name: "weekend"}
+	s.SetFreezeWindows(func(now time.Time) (*config.FreezeWindow, time.Time) {
+		return window, now.Add(time.Hour)
+	}, auditLog)
+	handler := s.enforceFreeze(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		method     string
+		target     string
+		breakGlass string
+		status     int
+	}{
+		{http.MethodGet, "/api/v1/status", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/stop/web", "", http.StatusOK},
+		{http.MethodPost, "/api/v1/restart?app=web", "", http.StatusLocked},
+		{http.MethodPost, "/api/v1/scale?formation=web=3", "", http.StatusLocked},
+		{http.MethodPost, "/api/v1/restart?app=web", "hotfix for checkout", http.StatusOK},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(tc.method, tc.target, nil)
+		if tc.breakGlass != "" {
+			r.Header.Set(BreakGlassHeader, tc.breakGlass)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != tc.status {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.target, tc.status, rec.Code)
+		}
+	}
+
+	data, err := os.ReadFile(auditLog.Path())
+	if err != nil {
+		t.Fatalf("Expected the override in the audit log: %v", err)
+	}
+	var entry audit.Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("Failed to parse audit log: %v", err)
+	}
+	if entry.Event != audit.EventBreakGlass || entry.Action != config.APIActionRestart || entry.Target != "web" || entry.Reason != "hotfix for checkout" || entry.Window != "weekend" {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+
+	// Outside a freeze window nothing is refused
+	window = nil
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/restart?app=web", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected restart outside freeze windows to pass, got %d", rec.Code)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guvnor.sock")
+	s := NewServer(logrus.New(), nil, logs.NewLogManager(10), 0)
+	s.SetAccessTokens([]config.APIToken{{Name: "admin", Token: "admin-token-0123456789"}}, nil)
+	if err := s.SetSocket(path, 0600, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop(context.Background())
+
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a socket with mode 0600, got %v: %v", info, err)
+	}
+
+	// Requests over the socket need no token
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := httpClient.Get("http://localhost/api/v1/logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the socket to be served without a token, got %d", resp.StatusCode)
+	}
+
+	// A socket in use is left alone, a stale one is replaced
+	if _, err := listenSocket(path, 0600, -1); err == nil || !strings.Contains(err.Error(), "another server") {
+		t.Errorf("Expected the socket in use to be refused, got %v", err)
+	}
+	stale := filepath.Join(t.TempDir(), "stale.sock")
+	listener, err := net.Listen("unix", stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	if listener, err = listenSocket(stale, 0660, -1); err != nil {
+		t.Fatalf("Expected a stale socket to be replaced, got %v", err)
+	}
+	listener.Close()
+	if info, err := os.Stat(stale); err != nil || info.Mode().Perm() != 0660 {
+		t.Errorf("Expected the replaced socket with mode 0660, got %v: %v", info, err)
+	}
+
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed on stop, got %v", err)
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	s := NewServer(logrus.New(), nil, logs.NewLogManager(10), 0)
+	mux := http.NewServeMux()
+	for _, route := range s.routes() {
+		mux.Handle(route.pattern, route.handler)
+	}
+
+	operations, err := Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	documented := make(map[string]bool)
+	for _, op := range operations {
+		if ids[op.ID] {
+			t.Errorf("Expected unique operation IDs, %s is repeated", op.ID)
+		}
+		ids[op.ID] = true
+
+		path := op.Path
+		for strings.Contains(path, "{") {
+			start, end := strings.Index(path, "{"), strings.Index(path, "}")
+			path = path[:start] + "web" + path[end+1:]
+		}
+		_, pattern := mux.Handler(httptest.NewRequest(op.Method, path, nil))
+		if pattern == "" {
+			t.Errorf("Expected a route for %s %s", op.Method, op.Path)
+		}
+		documented[pattern] = true
+	}
+	for _, route := range s.routes() {
+		if !documented[route.pattern] {
+			t.Errorf("Expected %s to be documented in openapi.yaml", route.pattern)
+		}
+	}
+
+	// Served without a token as JSON
+	s.SetAccessTokens([]config.APIToken{{Name: "admin", Token: "admin-token-0123456789"}}, nil)
+	rec := httptest.NewRecorder()
+	s.authorize(mux).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	var document struct {
+		OpenAPI string                 `json:"openapi"`
+		Paths   map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected the document, got %d %q: %v", rec.Code, rec.Body.String(), err)
+	}
+	if document.OpenAPI == "" || document.Paths["/api/v1/status"] == nil {
+		t.Errorf("Expected an OpenAPI document with /api/v1/status, got %+v", document)
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	// The schemas list the JSON keys of the types the API encodes
+	var document struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]interface{} `yaml:"properties"`
+			} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	if err := yaml.Unmarshal(openAPIDocument, &document); err != nil {
+		t.Fatal(err)
+	}
+
+	types := map[string]interface{}{
+		"ProcessInfo":     process.ProcessInfo{},
+		"LogEntry":        logs.LogEntry{},
+		"LogMessage":      logMessage{},
+		"Event":           events.Event{},
+		"EventMessage":    eventMessage{},
+		"AttachMessage":   attachMessage{},
+		"Job":             jobs.Job{},
+		"Step":            jobs.Step{},
+		"AppResult":       AppResult{},
+		"InstanceResult":  InstanceResult{},
+		"Changes":         config.Changes{},
+		"Deploy":          process.Deploy{},
+		"Orphan":          process.Orphan{},
+		"HostCertificate": cert.HostCertificate{},
+	}
+	for name, value := range types {
+		schema, exists := document.Components.Schemas[name]
+		if !exists {
+			t.Errorf("Expected a schema for %s", name)
+			continue
+		}
+		keys := make(map[string]bool)
+		valueType := reflect.TypeOf(value)
+		for i := 0; i < valueType.NumField(); i++ {
+			if key, _, _ := strings.Cut(valueType.Field(i).Tag.Get("json"), ","); key != "" && key != "-" {
+				keys[key] = true
+				if _, documented := schema.Properties[key]; !documented {
+					t.Errorf("Expected %s.%s in the %s schema", valueType.Name(), key, name)
+				}
+			}
+		}
+		for key := range schema.Properties {
+			if !keys[key] {
+				t.Errorf("Expected the %s schema to have no %s, %s has no such field", name, key, valueType.Name())
+			}
+		}
+	}
+}
+
+func TestLegacyPaths(t *testing.T) {
+	handler := legacyPaths(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	tests := []struct {
+		path, served, link string
+	}{
+		{"/api/status", "/api/v1/status", `</api/v1/status>; rel="successor-version"`},
+		{"/api/apps/web/restart", "/api/v1/apps/web/restart", `</api/v1/apps/web/restart>; rel="successor-version"`},
+		{"/api/v1/status", "/api/v1/status", ""},
+		{"/metrics", "/metrics", ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Body.String() != tt.served {
+			t.Errorf("%s: expected %s to be served, got %s", tt.path, tt.served, rec.Body.String())
+		}
+		if link := rec.Header().Get("Link"); link != tt.link {
+			t.Errorf("%s: expected Link %q, got %q", tt.path, tt.link, link)
+		}
+		if deprecated := rec.Header().Get("Deprecation") == "true"; deprecated != (tt.link != "") {
+			t.Errorf("%s: expected deprecated %v, got %v", tt.path, tt.link != "", deprecated)
+		}
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s := NewServer(logrus.New(), nil, logs.NewLogManager(10), 0)
+	s.SetAccessTokens([]config.APIToken{{Name: "admin", Token: "admin-token-0123456789"}}, nil)
+
+	// Off unless enabled
+	rec := httptest.NewRecorder()
+	s.authorize(s.newMux()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected no dashboard unless enabled, got %d", rec.Code)
+	}
+
+	s.EnableDashboard()
+	handler := s.authorize(s.newMux())
+	for path, contentType := range map[string]string{
+		"/ui/":              "text/html",
+		"/ui/dashboard.js":  "text/javascript",
+		"/ui/dashboard.css": "text/css",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), contentType) {
+			t.Errorf("%s: expected %s without a token, got %d %s", path, contentType, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		if rec.Header().Get("Content-Security-Policy") == "" {
+			t.Errorf("%s: expected a Content-Security-Policy", path)
+		}
+	}
+
+	// The data it shows still needs a token
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the API to require a token, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ui/", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected the dashboard to be read-only, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/jobs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// AppResult is the result of the job started by an /api/v1/apps action: the
+// state of every instance of the app once the action finished
+type AppResult struct {
+	App       string           `json:"app"`
+	Action    string           `json:"action"`
+	Instances []InstanceResult `json:"instances"`
+}
+
+// InstanceResult is the state of one instance after an action
+type InstanceResult struct {
+	Name       string `json:"name"`
+	PID        int    `json:"pid,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	Status     string `json:"status"` // The process status, or for stops: stopped, killed, not_running or error
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms,omitempty"` // How long stopping took
+}
+
+// appActions maps the actions of /api/v1/apps/{name}/{action} to API actions
+var appActions = map[string]string{
+	"start":   config.APIActionStart,
+	"stop":    config.APIActionStop,
+	"restart": config.APIActionRestart,
+	"scale":   config.APIActionScale,
+}
+
+// maxAppDefinition bounds the request body of POST /api/v1/apps
+const maxAppDefinition = 1 << 20
+
+// SetRegistrar registers the function adding an app to the server, which
+// returns it with its defaults applied
+func (s *Server) SetRegistrar(fn func(app config.AppConfig) (config.AppConfig, error)) {
+	s.register = fn
+}
+
+// SetRemover registers the function stopping an app and removing it from the server
+func (s *Server) SetRemover(fn func(ctx context.Context, name string) ([]process.StopResult, error)) {
+	s.remove = fn
+}
+
+// appRoute splits /api/v1/apps/{name}/{action} into name and action; action is ""
+// for /api/v1/apps/{name}
+func appRoute(path string) (string, string) {
+	name, action, _ := strings.Cut(strings.TrimPrefix(path, "/api/v1/apps/"), "/")
+	return name, action
+}
+
+// handleApp controls one app: POST /api/v1/apps/{name}/start, stop, restart
+// (?rolling=true for zero downtime) and scale (?instances=N), and DELETE
+// /api/v1/apps/{name} to stop the app and remove it from the server. Every action
+// runs as a job whose result is an AppResult.
+func (s *Server) handleApp(w http.ResponseWriter, r *http.Request) {
+	name, action := appRoute(r.URL.Path)
+	if name == "" || strings.Contains(action, "/") {
+		http.Error(w, "app name is required: /api/v1/apps/{name}/{action}", http.StatusBadRequest)
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.removeApp(w, name)
+		return
+	}
+	if _, known := appActions[action]; !known {
+		http.Error(w, fmt.Sprintf("unknown action %q, expected start, stop, restart or scale", action), http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch action {
+	case "start":
+		if s.start == nil {
+			http.Error(w, "Starting apps not available", http.StatusNotImplemented)
+			return
+		}
+		s.jobAccepted(w, s.jobs.Submit("start", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+			report(fmt.Sprintf("Starting %s", name))
+			jobs.Report(ctx, name, "starting", false)
+			err := s.start(ctx, name)
+			jobs.Report(ctx, name, stepOutcome(err, "started"), true)
+			return s.appResult(name, action), err
+		}))
+	case "stop":
+		s.jobAccepted(w, s.jobs.Submit("stop", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+			report(fmt.Sprintf("Stopping %s", name))
+			results, err := s.processManager.StopWithResults(ctx, name)
+			return stoppedResult(name, action, results), err
+		}))
+	case "restart":
+		rolling := r.URL.Query().Get("rolling") == "true"
+		if rolling && s.rollingRestart == nil {
+			http.Error(w, "Rolling restart not available", http.StatusNotImplemented)
+			return
+		}
+		jobType := "restart"
+		if rolling {
+			jobType = "rolling-restart"
+		}
+		s.jobAccepted(w, s.jobs.Submit(jobType, name, func(ctx context.Context, report func(string)) (interface{}, error) {
+			report(fmt.Sprintf("Restarting %s", name))
+			if rolling {
+				err := s.rollingRestart(ctx, name, report)
+				return s.appResult(name, action), err
+			}
+			err := s.restartInstances(ctx, name)
+			return s.appResult(name, action), err
+		}))
+	case "scale":
+		if s.scale == nil {
+			http.Error(w, "Scaling not available", http.StatusNotImplemented)
+			return
+		}
+		instances, err := strconv.Atoi(r.URL.Query().Get("instances"))
+		if err != nil || instances < 0 {
+			http.Error(w, "instances parameter must be a number of instances, 0 or more", http.StatusBadRequest)
+			return
+		}
+		s.jobAccepted(w, s.jobs.Submit("scale", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+			report(fmt.Sprintf("Scaling %s to %d instances", name, instances))
+			jobs.Report(ctx, name, fmt.Sprintf("scaling to %d", instances), false)
+			err := s.scale(ctx, name, instances)
+			jobs.Report(ctx, name, stepOutcome(err, fmt.Sprintf("%d running", s.processManager.InstanceCount(name))), true)
+			return s.appResult(name, action), err
+		}))
+	}
+}
+
+// handleApps registers the app defined in the request body, in JSON or YAML
+// with the keys of guvnor.yaml, and starts it in a job. Invalid definitions
+// are refused right away; an app that fails to start stays registered.
+func (s *Server) handleApps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.register == nil || s.start == nil {
+		http.Error(w, "Registering apps not available", http.StatusNotImplemented)
+		return
+	}
+	if !readableBody(r.Header.Get("Content-Type")) {
+		unsupportedBody(w)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAppDefinition))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read app definition: %v", err), http.StatusBadRequest)
+		return
+	}
+	app, err := config.ParseApp(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	app, err = s.register(app)
+	if errors.Is(err, config.ErrAppExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.logger.WithFields(logrus.Fields{"app": app.Name, "drop_in": app.Source}).Info("App registered")
+
+	name := app.Name
+	s.jobAccepted(w, s.jobs.Submit("register", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Starting %s", name))
+		jobs.Report(ctx, name, "starting", false)
+		err := s.start(ctx, name)
+		jobs.Report(ctx, name, stepOutcome(err, "started"), true)
+		return s.appResult(name, "register"), err
+	}))
+}
+
+// removeApp stops an app and removes it from the server in a job
+func (s *Server) removeApp(w http.ResponseWriter, name string) {
+	if s.remove == nil {
+		http.Error(w, "Removing apps not available", http.StatusNotImplemented)
+		return
+	}
+	s.jobAccepted(w, s.jobs.Submit("remove", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Removing %s", name))
+		results, err := s.remove(ctx, name)
+		return stoppedResult(name, "remove", results), err
+	}))
+}
+
+// restartInstances restarts every instance of an app one after the other, or a
+// single instance
+func (s *Server) restartInstances(ctx context.Context, name string) error {
+	names := []string{name}
+	if instances := s.processManager.GetInstances(name); len(instances) > 0 {
+		names = make([]string, len(instances))
+		for i, proc := range instances {
+			names[i] = proc.Config.Name
+		}
+	}
+	jobs.Plan(ctx, names...)
+
+	for _, instance := range names {
+		jobs.Report(ctx, instance, "restarting", false)
+		// ctx ends with the job, the process must outlive it
+		err := s.processManager.Restart(context.WithoutCancel(ctx), instance)
+		jobs.Report(ctx, instance, stepOutcome(err, "restarted"), true)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appResult lists the running instances of an app, or the single instance name
+func (s *Server) appResult(name, action string) AppResult {
+	result := AppResult{App: name, Action: action, Instances: []InstanceResult{}}
+	for _, info := range s.processManager.GetRunningProcessInfo() {
+		if info.Name != name && info.App != name {
+			continue
+		}
+		result.Instances = append(result.Instances, InstanceResult{
+			Name:   info.Name,
+			PID:    info.PID,
+			Port:   info.Port,
+			Status: info.Status,
+		})
+	}
+	sort.Slice(result.Instances, func(i, j int) bool {
+		return result.Instances[i].Name < result.Instances[j].Name
+	})
+	return result
+}
+
+// stoppedResult reports what stopping did to each instance
+func stoppedResult(name, action string, results []process.StopResult) AppResult {
+	return AppResult{App: name, Action: action, Instances: instanceResults(results)}
+}
+
+// instanceResults converts stop results, whose errors do not survive JSON
+func instanceResults(results []process.StopResult) []InstanceResult {
+	instances := make([]InstanceResult, len(results))
+	for i, stop := range results {
+		instances[i] = InstanceResult{
+			Name:       stop.Name,
+			PID:        stop.PID,
+			Status:     stop.Status,
+			DurationMS: stop.Duration.Milliseconds(),
+		}
+		if stop.Error != nil {
+			instances[i].Error = stop.Error.Error()
+		}
+	}
+	return instances
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// attachMessage is a message of the attach WebSocket. Output and input carry
+// the bytes as written, base64 encoded in JSON.
+type attachMessage struct {
+	Type     string `json:"type"` // attached, output, exited or error from the server; input from the client
+	Data     []byte `json:"data,omitempty"`
+	Stdin    bool   `json:"stdin,omitempty"`     // attached: whether input reaches the process
+	ExitCode *int   `json:"exit_code,omitempty"` // exited
+	Error    string `json:"error,omitempty"`
+}
+
+// handleAttachWebSocket attaches a client to the stdio of a running process
+// at /api/v1/attach/{process}: its output is sent as written and input
+// messages are written to its stdin. The connection closes when the process
+// exits.
+func (s *Server) handleAttachWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	r := ws.Request()
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/attach/")
+	send := func(msg attachMessage) error {
+		ws.SetWriteDeadline(time.Now().Add(streamKeepalive))
+		return websocket.JSON.Send(ws, msg)
+	}
+	fail := func(format string, args ...interface{}) {
+		send(attachMessage{Type: "error", Error: fmt.Sprintf(format, args...)})
+	}
+
+	proc, exists := s.processManager.GetProcess(name)
+	if !exists {
+		fail("process %s not found", name)
+		return
+	}
+	done := proc.Done()
+	if !proc.IsRunning() || done == nil {
+		fail("process %s is not running", name)
+		return
+	}
+	attachment, err := proc.Attach()
+	if err != nil {
+		fail("%v", err)
+		return
+	}
+	defer attachment.Detach()
+
+	logger := s.logger.WithField("process", name)
+	logger.Info("Client attached")
+	defer logger.Info("Client detached")
+	if send(attachMessage{Type: "attached", Stdin: proc.Stdin()}) != nil {
+		return
+	}
+
+	// Input is written as it arrives; the client detaches by closing the connection
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			var msg attachMessage
+			if websocket.JSON.Receive(ws, &msg) != nil {
+				return
+			}
+			if msg.Type != "input" {
+				continue
+			}
+			if _, err := attachment.Write(msg.Data); err != nil {
+				fail("%v", err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case chunk := <-attachment.Output:
+			if send(attachMessage{Type: "output", Data: chunk}) != nil {
+				return
+			}
+		case <-done:
+			// The output was read to the end before the process was marked exited
+			for drained := false; !drained; {
+				select {
+				case chunk := <-attachment.Output:
+					if send(attachMessage{Type: "output", Data: chunk}) != nil {
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			exitCode := proc.ExitCode()
+			send(attachMessage{Type: "exited", ExitCode: &exitCode})
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// SetAccessTokens restricts the API to the given tokens. labels returns the
+// labels of a configured app, for tokens restricted by label selectors.
+func (s *Server) SetAccessTokens(tokens []config.APIToken, labels func(app string) map[string]string) {
+	s.tokens = tokens
+	s.appLabels = labels
+}
+
+// unauthenticated are the paths answered without a token: probes and the API
+// description, which reveal nothing about the apps
+var unauthenticated = map[string]bool{
+	"/api/v1/ping":         true,
+	"/api/v1/healthz":      true,
+	"/api/v1/readyz":       true,
+	"/api/v1/openapi.json": true,
+}
+
+// filteredReads are the reads of the whole server that answer with the apps
+// the token covers only, so tokens restricted to some apps may make them
+var filteredReads = map[string]bool{
+	"/api/v1/status":      true,
+	"/api/v1/certs":       true,
+	"/api/v1/logs":        true,
+	"/api/v1/logs/stream": true,
+	"/api/v1/logs/ws":     true,
+	"/api/v1/logs/export": true,
+	"/api/v1/events":      true,
+	"/api/v1/events/ws":   true,
+}
+
+// visibleKey is the context key of the apps a request may see
+type visibleKey struct{}
+
+// visibleApps returns which apps a request may see, nil for all of them;
+// filtered reads made with a token restricted to some apps see those only
+func visibleApps(r *http.Request) func(app string) bool {
+	visible, _ := r.Context().Value(visibleKey{}).(func(app string) bool)
+	return visible
+}
+
+// authorize rejects requests without a token allowed to do what they ask. With no
+// tokens configured the API stays open, it only listens on localhost.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(s.tokens) == 0 || unauthenticated[r.URL.Path] || s.dashboardAsset(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := s.token(r)
+		if token == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="guvnor"`)
+			http.Error(w, "Unauthorized: a valid api token is required", http.StatusUnauthorized)
+			return
+		}
+
+		action, apps := s.requestScope(r)
+		if token.Scoped() && action == config.APIActionRead && len(apps) == 0 && filteredReads[r.URL.Path] {
+			visible := func(app string) bool { return tokenAllowsApp(token, app, s.appLabels) }
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), visibleKey{}, visible)))
+			return
+		}
+		if reason := tokenDenies(token, action, apps, s.appLabels); reason != "" {
+			s.logger.WithFields(logrus.Fields{
+				"token":  token.Name,
+				"action": action,
+				"apps":   apps,
+			}).Warn("API request denied")
+			http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// token returns the configured token presented with the request, nil if none matches
+func (s *Server) token(r *http.Request) *config.APIToken {
+	presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || presented == "" {
+		return nil
+	}
+	for i := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(s.tokens[i].Token)) == 1 {
+			return &s.tokens[i]
+		}
+	}
+	return nil
+}
+
+// requestScope returns the action a request performs and the apps it acts on;
+// no apps means it concerns the whole server. Only GET and HEAD requests are
+// reads: any other request no route classifies gets no action, which tokens
+// restricted to some actions or apps are denied.
+func (s *Server) requestScope(r *http.Request) (string, []string) {
+	action, apps := s.routeScope(r)
+	if action == config.APIActionRead && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", apps
+	}
+	return action, apps
+}
+
+// routeScope classifies a request by its route
+func (s *Server) routeScope(r *http.Request) (string, []string) {
+	path := r.URL.Path
+	query := r.URL.Query()
+	post := r.Method == http.MethodPost
+
+	switch {
+	case path == "/api/v1/logs" || path == "/api/v1/logs/stream" || path == "/api/v1/logs/ws" || path == "/api/v1/logs/export":
+		return config.APIActionRead, logs.SplitProcesses(query.Get("process"))
+	case strings.HasPrefix(path, "/api/v1/logs/"):
+		return config.APIActionRead, nonEmpty(strings.TrimPrefix(path, "/api/v1/logs/"))
+	case path == "/api/v1/events" || path == "/api/v1/events/ws":
+		return config.APIActionRead, logs.SplitProcesses(query.Get("app"))
+	case strings.HasPrefix(path, "/api/v1/attach/"):
+		return config.APIActionAttach, nonEmpty(strings.TrimPrefix(path, "/api/v1/attach/"))
+	case strings.HasPrefix(path, "/api/v1/start/"):
+		return config.APIActionStart, nonEmpty(strings.TrimPrefix(path, "/api/v1/start/"))
+	case path == "/api/v1/stop":
+		return config.APIActionStop, nil
+	case strings.HasPrefix(path, "/api/v1/stop/"):
+		return config.APIActionStop, nonEmpty(strings.TrimPrefix(path, "/api/v1/stop/"))
+	case path == "/api/v1/restart":
+		return config.APIActionRestart, nonEmpty(query.Get("app"))
+	case path == "/api/v1/reload":
+		return config.APIActionReload, nonEmpty(query.Get("app"))
+	case path == "/api/v1/reset":
+		return config.APIActionReset, nonEmpty(query.Get("app"))
+	case path == "/api/v1/scale":
+		formation, _ := ParseFormation(query.Get("formation"))
+		apps := make([]string, len(formation))
+		for i, entry := range formation {
+			apps[i] = entry.App
+		}
+		return config.APIActionScale, apps
+	case path == "/api/v1/apps" && post:
+		return config.APIActionRegister, nil
+	case strings.HasPrefix(path, "/api/v1/apps/"):
+		name, action := appRoute(path)
+		if r.Method == http.MethodDelete {
+			return config.APIActionRemove, nonEmpty(name)
+		}
+		if apiAction, known := appActions[action]; known && post {
+			return apiAction, nonEmpty(name)
+		}
+		return config.APIActionRead, nonEmpty(name)
+	case path == "/api/v1/flags":
+		if post {
+			return config.APIActionFlags, nonEmpty(query.Get("app"))
+		}
+		return config.APIActionRead, nonEmpty(query.Get("app"))
+	case path == "/api/v1/deploy":
+		if r.Method != http.MethodGet {
+			return config.APIActionDeploy, nonEmpty(query.Get("app"))
+		}
+		return config.APIActionRead, nonEmpty(query.Get("app"))
+	case path == "/api/v1/health":
+		return config.APIActionRead, nonEmpty(query.Get("app"))
+	case path == "/api/v1/orphans":
+		if post {
+			return config.APIActionOrphans, nil
+		}
+		return config.APIActionRead, nil
+	case strings.HasPrefix(path, "/api/v1/jobs/"):
+		// A job can be followed by whoever may act on its apps
+		if job, exists := s.jobs.Get(strings.TrimPrefix(path, "/api/v1/jobs/")); exists && job.Target != "all" {
+			return config.APIActionRead, strings.Split(job.Target, ",")
+		}
+		return config.APIActionRead, nil
+	default:
+		return config.APIActionRead, nil
+	}
+}
+
+// tokenDenies returns why token may not perform action on apps, or "" if it may
+func tokenDenies(token *config.APIToken, action string, apps []string, labels func(app string) map[string]string) string {
+	// Requests without an action are only open to unrestricted tokens
+	if action == "" {
+		if len(token.Actions) > 0 || token.Scoped() {
+			return fmt.Sprintf("token %s is restricted and the request is not covered by any action", token.Name)
+		}
+		return ""
+	}
+
+	// Reading is always allowed, so a token can follow what it started
+	if len(token.Actions) > 0 && action != config.APIActionRead {
+		allowed := false
+		for _, a := range token.Actions {
+			allowed = allowed || a == action
+		}
+		if !allowed {
+			return fmt.Sprintf("token %s may not %s", token.Name, action)
+		}
+	}
+
+	if !token.Scoped() {
+		return ""
+	}
+	if len(apps) == 0 {
+		return fmt.Sprintf("token %s is restricted to some apps and cannot act on the whole server", token.Name)
+	}
+	for _, name := range apps {
+		if !tokenAllowsApp(token, process.AppOfInstance(name), labels) {
+			return fmt.Sprintf("token %s may not act on %s", token.Name, name)
+		}
+	}
+	return ""
+}
+
+// tokenAllowsApp reports whether a scoped token covers an app by name or labels
+func tokenAllowsApp(token *config.APIToken, app string, labels func(app string) map[string]string) bool {
+	for _, name := range token.Apps {
+		if name == app {
+			return true
+		}
+	}
+	if len(token.Labels) == 0 || labels == nil {
+		return false
+	}
+
+	appLabels := labels(app)
+	for key, value := range token.Labels {
+		if appLabels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// nonEmpty returns name as a list, or nil if it is empty
+func nonEmpty(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return []string{name}
+}
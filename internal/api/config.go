@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// SetConfigSource registers the function returning the running configuration
+func (s *Server) SetConfigSource(fn func() *config.Config) {
+	s.config = fn
+}
+
+// SetConfigReloader registers the function reading the configuration again
+// and applying what changed
+func (s *Server) SetConfigReloader(fn func(ctx context.Context, report func(string)) (config.Changes, error)) {
+	s.reloadConfig = fn
+}
+
+// handleConfig returns the running configuration with its secrets redacted:
+// as JSON with the keys of guvnor.yaml, or as YAML with ?format=yaml
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.config == nil {
+		http.Error(w, "Configuration not available", http.StatusNotImplemented)
+		return
+	}
+
+	// Encoded through YAML so both formats use the keys and durations of guvnor.yaml
+	data, err := yaml.Marshal(s.config().Redacted())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Query().Get("format") == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(data)
+		return
+	}
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode configuration: %v", err), http.StatusInternalServerError)
+		return
+	}
+	s.jsonResponse(w, document)
+}
+
+// reloadConfiguration reads guvnor.yaml and the Procfile again in a job and
+// applies the changes to apps; the job's result is the config.Changes found
+func (s *Server) reloadConfiguration(w http.ResponseWriter) {
+	if s.reloadConfig == nil {
+		http.Error(w, "Reloading the configuration not available", http.StatusNotImplemented)
+		return
+	}
+	s.jobAccepted(w, s.jobs.Submit("reload-config", "all", func(ctx context.Context, report func(string)) (interface{}, error) {
+		report("Reloading configuration")
+		changes, err := s.reloadConfig(ctx, report)
+		if err == nil {
+			s.logger.WithFields(logrus.Fields{
+				"added":   changes.Added,
+				"removed": changes.Removed,
+				"changed": changes.Changed,
+				"pending": changes.Pending,
+			}).Info("Configuration reloaded")
+		}
+		return changes, err
+	}))
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// DashboardPath is where the management API serves the web dashboard
+const DashboardPath = "/ui/"
+
+// dashboardFiles are the page, script and styles of the dashboard
+//
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// EnableDashboard makes the API serve the web dashboard at DashboardPath. The
+// dashboard only holds static files: everything it shows comes from the API,
+// with the token the user enters, so it sees and does what the token allows.
+func (s *Server) EnableDashboard() {
+	s.dashboard = true
+}
+
+// dashboardAsset reports whether path is a file of the dashboard, served
+// without a token since it holds no data
+func (s *Server) dashboardAsset(path string) bool {
+	return s.dashboard && (path+"/" == DashboardPath || strings.HasPrefix(path, DashboardPath))
+}
+
+// dashboardHandler serves the dashboard's files, which may only talk to the
+// API that served them
+func dashboardHandler() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err) // The directory is embedded
+	}
+	fileServer := http.StripPrefix(DashboardPath, http.FileServer(http.FS(files)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
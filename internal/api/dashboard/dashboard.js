@@ -0,0 +1,436 @@
+// The guvnor dashboard. Everything it shows comes from the management API it
+// was served by, with the token the user signed in with, so it sees and does
+// what that token allows.
+"use strict";
+
+const API = "/api/v1";
+const TOKEN_KEY = "guvnor-token";
+const STATUS_INTERVAL = 5000;
+const CERTS_INTERVAL = 60000;
+const RETRY_DELAY = 2000;
+const MAX_LOG_LINES = 500;
+const MAX_EVENTS = 100;
+
+let token = sessionStorage.getItem(TOKEN_KEY) || "";
+let streams = [];      // AbortControllers of the open streams
+let logStream = null;  // AbortController of the log stream, replaced when its filter changes
+let timers = [];
+let logLines = [];
+let runningJobs = new Set(); // Apps with an action in progress
+let refreshQueued = false;
+
+class Unauthorized extends Error {}
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key === "className") node.className = value;
+    else if (key.startsWith("on")) node.addEventListener(key.slice(2), value);
+    else node.setAttribute(key, value);
+  }
+  for (const child of children) {
+    node.append(child instanceof Node ? child : String(child ?? ""));
+  }
+  return node;
+}
+
+function sleep(ms) {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+function idempotencyKey() {
+  const bytes = new Uint8Array(16);
+  crypto.getRandomValues(bytes);
+  return Array.from(bytes, (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+function endpoint(path, query) {
+  const url = new URL(API + path, location.origin);
+  for (const [key, value] of Object.entries(query || {})) {
+    if (value !== "" && value !== undefined && value !== null) url.searchParams.set(key, value);
+  }
+  return url;
+}
+
+function headers(method) {
+  const h = {};
+  if (token) h.Authorization = "Bearer " + token;
+  if (method !== "GET") h["Idempotency-Key"] = idempotencyKey();
+  return h;
+}
+
+async function request(method, path, query, signal) {
+  const resp = await fetch(endpoint(path, query), { method, headers: headers(method), signal });
+  if (resp.status === 401) throw new Unauthorized();
+  if (!resp.ok) {
+    const text = (await resp.text()).trim();
+    const err = new Error(text || resp.status + " " + resp.statusText);
+    err.status = resp.status;
+    throw err;
+  }
+  return resp;
+}
+
+async function getJSON(path, query) {
+  return (await request("GET", path, query)).json();
+}
+
+// follow reads a Server-Sent Events endpoint, passing each message to
+// onMessage, and reconnects until controller is aborted
+async function follow(path, query, controller, onMessage) {
+  while (!controller.signal.aborted) {
+    try {
+      const resp = await request("GET", path, query, controller.signal);
+      setConnection(true);
+      const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+      let buffer = "";
+      for (;;) {
+        const { value, done } = await reader.read();
+        if (done) break;
+        buffer += value;
+        let end;
+        while ((end = buffer.indexOf("\n\n")) >= 0) {
+          const block = buffer.slice(0, end);
+          buffer = buffer.slice(end + 2);
+          const data = block.split("\n")
+            .filter((line) => line.startsWith("data:"))
+            .map((line) => line.slice(5).trimStart())
+            .join("\n");
+          if (!data) continue; // Keepalive
+          try {
+            onMessage(JSON.parse(data));
+          } catch (err) {
+            // Skip messages that are not JSON
+          }
+        }
+      }
+    } catch (err) {
+      if (controller.signal.aborted) return;
+      if (err instanceof Unauthorized) {
+        showSignIn("");
+        return;
+      }
+    }
+    if (controller.signal.aborted) return;
+    setConnection(false);
+    await sleep(RETRY_DELAY);
+  }
+}
+
+function setConnection(live) {
+  const badge = $("connection");
+  badge.textContent = live ? "live" : "reconnecting";
+  badge.className = "badge " + (live ? "ok" : "warn");
+}
+
+function showMessage(text, kind) {
+  const message = $("message");
+  message.textContent = text;
+  message.className = "message " + (kind || "");
+  message.hidden = !text;
+}
+
+function formatDuration(ms) {
+  const seconds = Math.max(0, Math.floor(ms / 1000));
+  if (seconds < 60) return seconds + "s";
+  if (seconds < 3600) return Math.floor(seconds / 60) + "m";
+  if (seconds < 86400) return Math.floor(seconds / 3600) + "h" + String(Math.floor(seconds % 3600 / 60)).padStart(2, "0") + "m";
+  return Math.floor(seconds / 86400) + "d" + Math.floor(seconds % 86400 / 3600) + "h";
+}
+
+function formatBytes(bytes) {
+  if (!bytes) return "";
+  const units = ["B", "K", "M", "G", "T"];
+  let i = 0;
+  while (bytes >= 1024 && i < units.length - 1) {
+    bytes /= 1024;
+    i++;
+  }
+  return bytes.toFixed(i === 0 ? 0 : 1) + units[i];
+}
+
+function statusClass(status) {
+  switch (status) {
+    case "running":
+    case "completed":
+    case "healthy":
+    case "ok":
+      return "ok";
+    case "starting":
+    case "stopping":
+    case "unknown":
+    case "expiring":
+      return "warn";
+    case "stopped":
+      return "muted";
+    default:
+      return "bad";
+  }
+}
+
+// Apps
+
+async function refreshStatus() {
+  let status;
+  try {
+    status = await getJSON("/status");
+  } catch (err) {
+    if (err instanceof Unauthorized) return showSignIn("");
+    if (err.status === 403) {
+      showMessage("This token may not read the whole server: " + err.message, "error");
+    } else {
+      setConnection(false);
+    }
+    return;
+  }
+
+  // Configured apps that are not running get a row too, to start them
+  let configured = [];
+  try {
+    const config = await getJSON("/config");
+    configured = (config.apps || []).map((app) => app.name).filter(Boolean);
+  } catch (err) {
+    // Not available or not allowed: only running apps are listed
+  }
+
+  renderProcesses(status.processes || [], status.health || {}, configured);
+  $("updated").textContent = "updated " + new Date().toLocaleTimeString();
+}
+
+// queueRefresh refreshes the status soon, once for a burst of events
+function queueRefresh() {
+  if (refreshQueued) return;
+  refreshQueued = true;
+  setTimeout(() => {
+    refreshQueued = false;
+    refreshStatus();
+  }, 300);
+}
+
+function renderProcesses(processes, health, configured) {
+  const apps = new Map();
+  for (const name of configured) apps.set(name, []);
+  for (const proc of processes) {
+    const app = proc.app || proc.name;
+    if (!apps.has(app)) apps.set(app, []);
+    apps.get(app).push(proc);
+  }
+
+  const rows = [];
+  for (const [app, procs] of [...apps.entries()].sort((a, b) => a[0].localeCompare(b[0]))) {
+    const running = procs.some((proc) => proc.status === "running");
+    const busy = runningJobs.has(app);
+    const action = (name, enabled) => el("button", {
+      type: "button",
+      onclick: () => runAction(app, name),
+      ...(enabled && !busy ? {} : { disabled: "" }),
+    }, name);
+
+    rows.push(el("tr", { className: "app" },
+      el("td", { colspan: "9" }, app, procs.length ? el("span", { className: "muted" }, "  " + procs.length + " instance" + (procs.length === 1 ? "" : "s")) : el("span", { className: "muted" }, "  not running")),
+      el("td", { className: "actions" }, action("start", !running), " ", action("stop", procs.length > 0), " ", action("restart", procs.length > 0))));
+
+    for (const proc of procs.sort((a, b) => a.name.localeCompare(b.name))) {
+      const check = health[proc.name];
+      const usage = proc.usage || {};
+      const started = proc.start_time ? Date.parse(proc.start_time) : NaN;
+      rows.push(el("tr", {},
+        el("td", {}, proc.name),
+        el("td", { className: statusClass(proc.status) }, proc.status),
+        el("td", { className: check ? statusClass(check.status) : "muted" }, check ? check.status : "-"),
+        el("td", {}, proc.pid || ""),
+        el("td", {}, proc.port || ""),
+        el("td", {}, proc.status === "running" && !isNaN(started) ? formatDuration(Date.now() - started) : ""),
+        el("td", {}, proc.restarts),
+        el("td", {}, usage.cpu_percent !== undefined ? usage.cpu_percent.toFixed(1) + "%" : ""),
+        el("td", {}, formatBytes(usage.rss_bytes)),
+        el("td", {})));
+    }
+  }
+  if (rows.length === 0) {
+    rows.push(el("tr", {}, el("td", { colspan: "10", className: "muted" }, "No apps")));
+  }
+  $("processes").replaceChildren(...rows);
+
+  // Offer every app in the log filter, leaving it alone while the apps are the same
+  const select = $("log-process");
+  const names = [...apps.keys()].sort();
+  if (select.dataset.apps !== names.join(",")) {
+    const selected = select.value;
+    select.dataset.apps = names.join(",");
+    select.replaceChildren(el("option", { value: "" }, "All apps"),
+      ...names.map((app) => el("option", { value: app }, app)));
+    select.value = apps.has(selected) ? selected : "";
+  }
+}
+
+async function runAction(app, action) {
+  runningJobs.add(app);
+  queueRefresh();
+  showMessage(action.charAt(0).toUpperCase() + action.slice(1) + " " + app + "...", "");
+  try {
+    const resp = await request("POST", "/apps/" + encodeURIComponent(app) + "/" + action);
+    const accepted = await resp.json();
+    let job = accepted.job;
+    while (job.status !== "succeeded" && job.status !== "failed") {
+      await sleep(500);
+      job = await getJSON("/jobs/" + encodeURIComponent(accepted.job_id));
+    }
+    if (job.status === "failed") {
+      showMessage(action + " " + app + " failed: " + job.error, "error");
+    } else {
+      showMessage(action + " " + app + ": done", "ok");
+    }
+  } catch (err) {
+    if (err instanceof Unauthorized) return showSignIn("");
+    showMessage(action + " " + app + " failed: " + err.message, "error");
+  } finally {
+    runningJobs.delete(app);
+    queueRefresh();
+  }
+}
+
+// Certificates
+
+async function refreshCertificates() {
+  let certs;
+  try {
+    certs = await getJSON("/certs");
+  } catch (err) {
+    // 501 when the server does not serve TLS
+    $("certificates-section").hidden = true;
+    return;
+  }
+  const hostnames = certs.hostnames || [];
+  $("certificates-section").hidden = hostnames.length === 0;
+  $("certificates").replaceChildren(...hostnames.map((cert) => el("tr", {},
+    el("td", {}, cert.hostname),
+    el("td", {}, cert.app),
+    el("td", {}, cert.source),
+    el("td", {}, cert.not_after && !cert.not_after.startsWith("0001") ? new Date(cert.not_after).toLocaleDateString() : ""),
+    el("td", {}, cert.days_remaining),
+    el("td", { className: statusClass(cert.status), title: cert.last_error || "" }, cert.status))));
+}
+
+// Events
+
+function addEvent(event) {
+  const time = new Date(event.time).toLocaleTimeString();
+  const kind = /crash|fail|expir/.test(event.type) ? "bad" : "";
+  const item = el("li", {}, el("span", { className: "muted" }, time + " "), el("span", { className: kind }, event.type), " " + event.message);
+  const list = $("events");
+  list.prepend(item);
+  while (list.children.length > MAX_EVENTS) list.lastChild.remove();
+}
+
+// Logs
+
+function formatLog(entry) {
+  const time = new Date(entry.timestamp).toLocaleTimeString();
+  return time + " [" + (entry.level || "info").toUpperCase() + "] [" + entry.process + "] " + entry.message;
+}
+
+function addLogs(entries) {
+  logLines.push(...entries.map(formatLog));
+  if (logLines.length > MAX_LOG_LINES) logLines = logLines.slice(-MAX_LOG_LINES);
+  if (!$("log-pause").checked) renderLogs();
+}
+
+function renderLogs() {
+  const pre = $("logs");
+  const atBottom = pre.scrollTop + pre.clientHeight >= pre.scrollHeight - 20;
+  pre.textContent = logLines.join("\n");
+  if (atBottom) pre.scrollTop = pre.scrollHeight;
+}
+
+async function followLogs() {
+  if (logStream) logStream.abort();
+  logStream = new AbortController();
+  streams.push(logStream);
+  const process = $("log-process").value;
+  logLines = [];
+  try {
+    const recent = await getJSON("/logs", { lines: 100, process });
+    addLogs(recent.logs || []);
+  } catch (err) {
+    if (err instanceof Unauthorized) return showSignIn("");
+  }
+  renderLogs();
+  follow("/logs/stream", { process }, logStream, (msg) => {
+    if (msg.type === "logs" && msg.logs) addLogs(msg.logs);
+  });
+}
+
+// Sign in
+
+function stop() {
+  for (const controller of streams) controller.abort();
+  streams = [];
+  logStream = null;
+  for (const timer of timers) clearInterval(timer);
+  timers = [];
+}
+
+function showSignIn(error) {
+  stop();
+  $("dashboard").hidden = true;
+  $("signout").hidden = true;
+  $("signin").hidden = false;
+  $("signin-error").textContent = error;
+  $("connection").textContent = "signed out";
+  $("connection").className = "badge muted";
+  $("token").focus();
+}
+
+async function start() {
+  // A token is only needed once the server has api_tokens
+  try {
+    await getJSON("/status", { limit: 1 });
+  } catch (err) {
+    if (err instanceof Unauthorized) {
+      return showSignIn(token ? "The token was not accepted" : "");
+    }
+  }
+
+  $("signin").hidden = true;
+  $("dashboard").hidden = false;
+  $("signout").hidden = !token;
+  showMessage("", "");
+
+  refreshStatus();
+  refreshCertificates();
+  timers.push(setInterval(refreshStatus, STATUS_INTERVAL));
+  timers.push(setInterval(refreshCertificates, CERTS_INTERVAL));
+
+  const events = new AbortController();
+  streams.push(events);
+  follow("/events", {}, events, (msg) => {
+    if (msg.type !== "event" || !msg.event) return;
+    addEvent(msg.event);
+    queueRefresh();
+  });
+  followLogs();
+}
+
+$("signin").addEventListener("submit", (e) => {
+  e.preventDefault();
+  token = $("token").value.trim();
+  $("token").value = "";
+  sessionStorage.setItem(TOKEN_KEY, token);
+  start();
+});
+
+$("signout").addEventListener("click", () => {
+  token = "";
+  sessionStorage.removeItem(TOKEN_KEY);
+  showSignIn("");
+});
+
+$("log-process").addEventListener("change", followLogs);
+$("log-pause").addEventListener("change", () => {
+  if (!$("log-pause").checked) renderLogs();
+});
+
+start();
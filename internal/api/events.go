@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// eventQueueSize is how many events a stream may fall behind before events
+// to it are dropped
+const eventQueueSize = 256
+
+// eventMessage is a message of the event streams
+type eventMessage struct {
+	Type      string        `json:"type"` // connected or event
+	Event     *events.Event `json:"event,omitempty"`
+	Dropped   int           `json:"dropped,omitempty"` // Events skipped since the last message, the client fell behind
+	Timestamp string        `json:"timestamp"`
+}
+
+// eventFilter selects the events of a stream
+type eventFilter struct {
+	types   []string              // Event types, all when empty
+	apps    []string              // Apps or instances, all when empty
+	visible func(app string) bool // Apps the stream may show, all when nil
+}
+
+// SetEventBus registers the bus behind /api/v1/events
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
+}
+
+// parseEventFilter reads the type and app query parameters
+func parseEventFilter(r *http.Request) (eventFilter, error) {
+	query := r.URL.Query()
+	filter := eventFilter{
+		types:   logs.SplitProcesses(query.Get("type")),
+		apps:    logs.SplitProcesses(query.Get("app")),
+		visible: visibleApps(r),
+	}
+	for _, t := range filter.types {
+		if !events.Known(t) {
+			return eventFilter{}, fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return filter, nil
+}
+
+// match reports whether the filter selects an event. Events of no app, such
+// as certificate renewals, are only selected when no apps are asked for and
+// every app is visible.
+func (f eventFilter) match(e events.Event) bool {
+	if f.visible != nil && (e.App == "" || !f.visible(e.App)) {
+		return false
+	}
+	if len(f.apps) == 0 {
+		return true
+	}
+	selection := logs.Filter{Processes: f.apps}
+	return (e.App != "" && selection.SelectsProcess(e.App)) || (e.Instance != "" && selection.SelectsProcess(e.Instance))
+}
+
+// handleEventsStream streams lifecycle events via Server-Sent Events as they happen
+func (s *Server) handleEventsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.events == nil {
+		http.Error(w, "Events not available", http.StatusNotImplemented)
+		return
+	}
+
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	send := func(msg eventMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	keepalive := func() error {
+		if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	s.followEvents(r.Context(), filter, send, keepalive)
+}
+
+// handleEventsWebSocket streams lifecycle events over a WebSocket, as JSON
+// messages shaped like the Server-Sent Events of handleEventsStream
+func (s *Server) handleEventsWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	r := ws.Request()
+	if s.events == nil {
+		websocket.JSON.Send(ws, map[string]string{"type": "error", "error": "events not available"})
+		return
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		websocket.JSON.Send(ws, map[string]string{"type": "error", "error": err.Error()})
+		return
+	}
+
+	// The client only ever closes the connection; reading notices that
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	send := func(msg eventMessage) error {
+		ws.SetWriteDeadline(time.Now().Add(streamKeepalive))
+		return websocket.JSON.Send(ws, msg)
+	}
+	s.followEvents(ctx, filter, send, nil)
+}
+
+// followEvents sends the events the filter selects until ctx is done or
+// sending fails. keepalive, if set, is called when nothing was sent for a
+// while. Events are dropped, and counted in the next message, while the client
+// is too slow to take them.
+func (s *Server) followEvents(ctx context.Context, filter eventFilter, send func(eventMessage) error, keepalive func() error) {
+	queue := make(chan events.Event, eventQueueSize)
+	dropped := make(chan struct{}, eventQueueSize)
+	unsubscribe := s.events.Subscribe(func(e events.Event) {
+		if !filter.match(e) {
+			return
+		}
+		select {
+		case queue <- e:
+		default:
+			select {
+			case dropped <- struct{}{}:
+			default:
+			}
+		}
+	}, filter.types...)
+	defer unsubscribe()
+
+	if send(eventMessage{Type: "connected", Timestamp: time.Now().Format(time.RFC3339)}) != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if keepalive != nil && keepalive() != nil {
+				return
+			}
+		case e := <-queue:
+			msg := eventMessage{Type: "event", Event: &e, Timestamp: time.Now().Format(time.RFC3339)}
+		count:
+			for {
+				select {
+				case <-dropped:
+					msg.Dropped++
+				default:
+					break count
+				}
+			}
+			if send(msg) != nil {
+				return
+			}
+			ticker.Reset(streamKeepalive)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/audit"
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// BreakGlassHeader overrides a freeze window; its value is the reason recorded
+// in the audit log
+const BreakGlassHeader = "X-Guvnor-Break-Glass"
+
+// frozenActions are refused while a freeze window is in effect
+var frozenActions = map[string]bool{
+	config.APIActionStart:    true,
+	config.APIActionRestart:  true,
+	config.APIActionReload:   true,
+	config.APIActionScale:    true,
+	config.APIActionRegister: true,
+}
+
+// SetFreezeWindows refuses starts, restarts, reloads and scaling while active
+// reports a freeze window, unless the request breaks the glass. Overrides are
+// recorded in auditLog.
+func (s *Server) SetFreezeWindows(active func(now time.Time) (*config.FreezeWindow, time.Time), auditLog *audit.Log) {
+	s.activeFreeze = active
+	s.audit = auditLog
+}
+
+// enforceFreeze rejects frozen actions during a freeze window with 423 Locked
+func (s *Server) enforceFreeze(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.activeFreeze == nil || r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		action, apps := s.requestScope(r)
+		if !frozenActions[action] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		window, until := s.activeFreeze(time.Now())
+		if window == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		reason := r.Header.Get(BreakGlassHeader)
+		if reason == "" {
+			http.Error(w, fmt.Sprintf("Locked: %s is frozen by freeze window %q until %s",
+				action, window.Name, until.Format("Mon Jan 2 15:04 MST")), http.StatusLocked)
+			return
+		}
+
+		entry := audit.Entry{
+			Event:  audit.EventBreakGlass,
+			Action: action,
+			Target: strings.Join(apps, ","),
+			Actor:  s.actor(r),
+			Reason: reason,
+			Window: window.Name,
+		}
+		// An override that leaves no trace is not allowed
+		if err := s.audit.Record(entry); err != nil {
+			s.logger.WithError(err).Error("Failed to record break-glass override")
+			http.Error(w, "Failed to record break-glass override in the audit log", http.StatusInternalServerError)
+			return
+		}
+		s.logger.WithFields(logrus.Fields{
+			"action": action,
+			"apps":   apps,
+			"actor":  entry.Actor,
+			"reason": reason,
+			"window": window.Name,
+		}).Warn("Freeze window overridden")
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// actor names who sent a request: the api token, or the client address
+func (s *Server) actor(r *http.Request) string {
+	if len(s.tokens) > 0 {
+		if token := s.token(r); token != nil {
+			return "token:" + token.Name
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
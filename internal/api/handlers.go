@@ -4,13 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
-
+	"golang.org/x/net/websocket"
+
+	"github.com/gleicon/guvnor/internal/audit"
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/flags"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/jobs"
 	"github.com/gleicon/guvnor/internal/logs"
 	"github.com/gleicon/guvnor/internal/process"
 )
@@ -22,6 +33,29 @@ type Server struct {
 	logManager     *logs.LogManager
 	port           int
 	server         *http.Server
+	jobs           *jobs.Manager
+	idempotency    *idempotencyCache
+	rollingRestart func(ctx context.Context, name string, report func(string)) error
+	scale          func(ctx context.Context, name string, instances int) error
+	start          func(ctx context.Context, name string) error
+	remove         func(ctx context.Context, name string) ([]process.StopResult, error)
+	register       func(app config.AppConfig) (config.AppConfig, error)
+	config         func() *config.Config                                                  // Running configuration, for GET /api/v1/config
+	reloadConfig   func(ctx context.Context, report func(string)) (config.Changes, error) // Applies the configuration read again
+	readiness      func() []string                                                        // Why guvnor is not ready, for /api/v1/readyz
+	events         *events.Bus                                                            // Lifecycle events, for /api/v1/events
+	flags          *flags.Store
+	tokens         []config.APIToken                  // Accepted api tokens, none leaves the API open
+	appLabels      func(app string) map[string]string // Labels of configured apps, for token label selectors
+	health         *health.Checker
+	activeFreeze   func(now time.Time) (*config.FreezeWindow, time.Time)
+	audit          *audit.Log
+	certRenewer    *cert.Renewer
+	issuance       func() []cert.IssuanceStatus
+	certHealth     func() []cert.HostCertificate
+	socket         *apiSocket // Nil unless SetSocket was called
+	remote         *apiRemote // Nil unless SetRemoteListener was called
+	dashboard      bool       // Serve the web dashboard at DashboardPath
 }
 
 // NewServer creates a new management API server
@@ -31,49 +65,174 @@ func NewServer(logger *logrus.Logger, processManager *process.EnhancedManager, l
 		processManager: processManager,
 		logManager:     logManager,
 		port:           port,
+		jobs:           jobs.NewManager(time.Hour, 10*time.Minute),
+		idempotency:    newIdempotencyCache(DefaultIdempotencyWindow),
 	}
 }
 
-// Start starts the management API server
-func (s *Server) Start() error {
+// SetIdempotencyWindow sets how long responses are remembered per Idempotency-Key
+func (s *Server) SetIdempotencyWindow(window time.Duration) {
+	s.idempotency = newIdempotencyCache(window)
+}
+
+// SetRollingRestarter registers the function performing zero-downtime restarts
+func (s *Server) SetRollingRestarter(fn func(ctx context.Context, name string, report func(string)) error) {
+	s.rollingRestart = fn
+}
+
+// SetScaler registers the function changing an app's instance count
+func (s *Server) SetScaler(fn func(ctx context.Context, name string, instances int) error) {
+	s.scale = fn
+}
+
+// SetStarter registers the function starting a configured app by name
+func (s *Server) SetStarter(fn func(ctx context.Context, name string) error) {
+	s.start = fn
+}
+
+// SetFlagStore registers the store behind /api/v1/flags
+func (s *Server) SetFlagStore(store *flags.Store) {
+	s.flags = store
+}
+
+// SetHealthChecker registers the checker behind /api/v1/health
+func (s *Server) SetHealthChecker(checker *health.Checker) {
+	s.health = checker
+}
+
+// SetReadiness registers the function behind /api/v1/readyz, returning why guvnor
+// cannot take traffic yet
+func (s *Server) SetReadiness(fn func() []string) {
+	s.readiness = fn
+}
+
+// SetCertRenewer registers the renewer behind /api/v1/certs
+func (s *Server) SetCertRenewer(renewer *cert.Renewer) {
+	s.certRenewer = renewer
+}
+
+// SetCertHealth registers what reports the certificate of each hostname for
+// /api/v1/certs
+func (s *Server) SetCertHealth(health func() []cert.HostCertificate) {
+	s.certHealth = health
+}
+
+// SetIssuanceStatus registers what reports the hostnames /api/v1/certs lists as
+// waiting to retry a failed certificate request
+func (s *Server) SetIssuanceStatus(status func() []cert.IssuanceStatus) {
+	s.issuance = status
+}
+
+// route is an endpoint of the API; openapi.yaml documents every one
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// routes returns the endpoints of the API, all under BasePath
+func (s *Server) routes() []route {
+	return []route{
+		{"/api/v1/ping", http.HandlerFunc(s.handlePing)},
+		{"/api/v1/healthz", http.HandlerFunc(s.handleHealthz)},
+		{"/api/v1/readyz", http.HandlerFunc(s.handleReadyz)},
+		{"/api/v1/openapi.json", http.HandlerFunc(s.handleOpenAPI)},
+		{"/api/v1/status", http.HandlerFunc(s.handleStatus)},
+		{"/api/v1/logs", http.HandlerFunc(s.handleLogs)},
+		{"/api/v1/logs/", http.HandlerFunc(s.handleLogsProcess)}, // For /api/v1/logs/{process}
+		{"/api/v1/logs/stream", http.HandlerFunc(s.handleLogsStream)},
+		{"/api/v1/logs/export", http.HandlerFunc(s.handleLogsExport)},
+		{"/api/v1/logs/ws", websocket.Server{Handler: s.handleLogsWebSocket, Handshake: checkWebSocketOrigin}},
+		{"/api/v1/events", http.HandlerFunc(s.handleEventsStream)},
+		{"/api/v1/events/ws", websocket.Server{Handler: s.handleEventsWebSocket, Handshake: checkWebSocketOrigin}},
+		{"/api/v1/attach/", websocket.Server{Handler: s.handleAttachWebSocket, Handshake: checkWebSocketOrigin}}, // For /api/v1/attach/{process}
+		{"/api/v1/start/", http.HandlerFunc(s.idempotent(s.handleStartApp))}, // For /api/v1/start/{app}
+		{"/api/v1/stop", http.HandlerFunc(s.idempotent(s.handleStop))},
+		{"/api/v1/stop/", http.HandlerFunc(s.idempotent(s.handleStopApp))}, // For /api/v1/stop/{app}
+		{"/api/v1/restart", http.HandlerFunc(s.idempotent(s.handleRestart))},
+		{"/api/v1/reload", http.HandlerFunc(s.idempotent(s.handleReload))},
+		{"/api/v1/config", http.HandlerFunc(s.handleConfig)},
+		{"/api/v1/reset", http.HandlerFunc(s.idempotent(s.handleReset))},
+		{"/api/v1/scale", http.HandlerFunc(s.idempotent(s.handleScale))},
+		{"/api/v1/flags", http.HandlerFunc(s.idempotent(s.handleFlags))},
+		{"/api/v1/orphans", http.HandlerFunc(s.idempotent(s.handleOrphans))},
+		{"/api/v1/deploy", http.HandlerFunc(s.idempotent(s.handleDeploy))},
+		{"/api/v1/apps", http.HandlerFunc(s.idempotent(s.handleApps))},
+		{"/api/v1/apps/", http.HandlerFunc(s.idempotent(s.handleApp))}, // For /api/v1/apps/{app}[/{action}]
+		{"/api/v1/health", http.HandlerFunc(s.handleHealth)},
+		{"/api/v1/certs", http.HandlerFunc(s.handleCerts)},
+		{"/api/v1/jobs", http.HandlerFunc(s.handleJobs)},
+		{"/api/v1/jobs/", http.HandlerFunc(s.handleJob)}, // For /api/v1/jobs/{id}
+	}
+}
+
+// newMux routes requests to the endpoints of the API and, when enabled, the dashboard
+func (s *Server) newMux() *http.ServeMux {
 	mux := http.NewServeMux()
-	
-	// API routes
-	mux.HandleFunc("/api/ping", s.handlePing)
-	mux.HandleFunc("/api/status", s.handleStatus)
-	mux.HandleFunc("/api/logs", s.handleLogs)
-	mux.HandleFunc("/api/logs/", s.handleLogsProcess) // For /api/logs/{process}
-	mux.HandleFunc("/api/logs/stream", s.handleLogsStream)
-	mux.HandleFunc("/api/stop", s.handleStop)
-	
-	// Add CORS headers for local development
-	corsHandler := func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "http://localhost:*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-			
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-			
-			h.ServeHTTP(w, r)
-		})
+	for _, route := range s.routes() {
+		mux.Handle(route.pattern, route.handler)
 	}
+	if s.dashboard {
+		mux.Handle(DashboardPath, dashboardHandler())
+	}
+	return mux
+}
+
+// tcpHandler guards mux for the TCP and remote listeners, which browsers can
+// reach: requests need a token when tokens are configured and may not come
+// from pages of other sites
+func (s *Server) tcpHandler(mux http.Handler) http.Handler {
+	return legacyPaths(checkOrigin(corsHandler(checkBodyType(s.authorize(s.enforceFreeze(mux))))))
+}
+
+// corsHandler adds CORS headers for local development
+func corsHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key, Authorization, "+BreakGlassHeader)
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
 
+// Start starts the management API server
+func (s *Server) Start() error {
+	mux := s.newMux()
+	handler := s.tcpHandler(mux)
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf("127.0.0.1:%d", s.port),
-		Handler: corsHandler(mux),
+		Handler: handler,
 	}
 
 	s.logger.WithField("port", s.port).Info("Starting management API server")
 	
+	// Listen before returning so a taken port is reported to the caller
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	if s.remote != nil {
+		if err := s.startRemote(handler); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+	
 	go func() {
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
 			s.logger.WithError(err).Error("Management API server error")
 		}
 	}()
+	
+	// Browsers cannot reach the socket and its permissions stand in for tokens
+	if s.socket != nil {
+		s.startSocket(legacyPaths(s.enforceFreeze(mux)))
+	}
 
 	return nil
 }
@@ -85,6 +244,12 @@ func (s *Server) Stop(ctx context.Context) error {
 	}
 
 	s.logger.Info("Stopping management API server")
+	if err := s.stopSocket(ctx); err != nil {
+		s.logger.WithError(err).Warn("Failed to stop management API socket")
+	}
+	if err := s.stopRemote(ctx); err != nil {
+		s.logger.WithError(err).Warn("Failed to stop management API remote listener")
+	}
 	return s.server.Shutdown(ctx)
 }
 
@@ -95,25 +260,120 @@ func (s *Server) handlePing(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.jsonResponse(w, map[string]string{
+		"status": "ok",
+		"time":   time.Now().Format(time.RFC3339),
+		"port":   strconv.Itoa(s.port),      // Tells servers reached over a shared socket apart
+		"pid":    strconv.Itoa(os.Getpid()), // Lets daemon stop check the PID file
+	})
+}
+
+// handleHealthz answers liveness probes: guvnor is alive when its API answers
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	s.jsonResponse(w, map[string]string{
 		"status": "ok",
 		"time":   time.Now().Format(time.RFC3339),
 	})
 }
 
-// handleStatus handles process status requests
+// handleReadyz answers readiness probes: 200 once every configured app was
+// started or attempted and the proxy listeners are bound, 503 with the reasons
+// otherwise
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var reasons []string
+	if s.readiness != nil {
+		reasons = s.readiness()
+	}
+	if len(reasons) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "not_ready",
+			"reasons": reasons,
+			"time":    time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+	s.jsonResponse(w, map[string]string{
+		"status": "ready",
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
+// handleStatus handles process status requests, with the latest health check
+// of each instance under health. Processes are filtered by app, status and
+// since, ordered by name and paged with limit, offset and cursor; fields
+// selects the keys of each process.
 func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	info := s.processManager.GetRunningProcessInfo()
-	s.jsonResponse(w, map[string]interface{}{
-		"processes": info,
+	filter, err := parseStatusFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := parsePage(r)
+	if err == nil {
+		err = checkFields(process.ProcessInfo{}, page.fields)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info := []process.ProcessInfo{}
+	visible := visibleApps(r)
+	for _, proc := range s.processManager.GetRunningProcessInfo() {
+		if filter.match(proc) && (visible == nil || visible(process.AppOfInstance(proc.Name))) {
+			info = append(info, proc)
+		}
+	}
+	total := len(info)
+	info, next, err := pageProcesses(info, page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	processes, err := selectFields(info, page.fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"processes": processes,
 		"count":     len(info),
+		"total":     total,
 		"timestamp": time.Now().Format(time.RFC3339),
-	})
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	if s.health != nil {
+		// Only for the processes of the page
+		results := s.health.GetAllResults()
+		health := make(map[string]interface{}, len(info))
+		for _, proc := range info {
+			if result, exists := results[proc.Name]; exists {
+				health[proc.Name] = result
+			}
+		}
+		response["health"] = health
+	}
+	s.jsonResponse(w, response)
 }
 
 // handleLogs handles log requests
@@ -123,30 +383,72 @@ func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query parameters
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.logsResponse(w, r, filter, r.URL.Query().Get("process"))
+}
+
+// logsResponse answers a log request with the latest entries the filter
+// selects: lines (or limit) of them, default 100, paged back in time with
+// offset and cursor, with the keys given by fields
+func (s *Server) logsResponse(w http.ResponseWriter, r *http.Request, filter logs.Filter, processName string) {
 	lines := 100 // default
 	if l := r.URL.Query().Get("lines"); l != "" {
 		if parsed, err := strconv.Atoi(l); err == nil {
 			lines = parsed
 		}
 	}
+	page, err := parsePage(r)
+	if err == nil {
+		err = checkFields(logs.LogEntry{}, page.fields)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if page.limit > 0 {
+		lines = page.limit
+	}
 
-	process := r.URL.Query().Get("process")
-
-	var entries []logs.LogEntry
-	if process != "" {
-		entries = s.logManager.GetProcessLogs(process, lines)
-	} else {
-		entries = s.logManager.GetAllLogs(lines)
+	entries, next, err := s.pageLogs(filter, lines, page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	selected, err := selectFields(entries, page.fields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	s.jsonResponse(w, map[string]interface{}{
-		"logs":      entries,
+	response := map[string]interface{}{
+		"logs":      selected,
 		"count":     len(entries),
-		"process":   process,
+		"process":   processName,
 		"lines":     lines,
 		"timestamp": time.Now().Format(time.RFC3339),
-	})
+	}
+	if next != "" {
+		response["next_cursor"] = next
+	}
+	s.jsonResponse(w, response)
+}
+
+// parseLogFilter reads the process, exclude, level, grep, since and until
+// query parameters; process and exclude are comma-separated lists
+func parseLogFilter(r *http.Request) (logs.Filter, error) {
+	query := r.URL.Query()
+	filter, err := logs.ParseFilter(query.Get("level"), query.Get("grep"), query.Get("since"), query.Get("until"), time.Now())
+	if err != nil {
+		return logs.Filter{}, err
+	}
+	filter.Processes = logs.SplitProcesses(query.Get("process"))
+	filter.Exclude = logs.SplitProcesses(query.Get("exclude"))
+	filter.Visible = visibleApps(r)
+	return filter, nil
 }
 
 // handleLogsProcess handles log requests for specific processes via URL path
@@ -156,125 +458,503 @@ func (s *Server) handleLogsProcess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract process name from path /api/logs/{process}
-	path := strings.TrimPrefix(r.URL.Path, "/api/logs/")
-	if path == "" || path == "stream" {
+	// Extract process name from path /api/v1/logs/{process}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/logs/")
+	if path == "" || path == "stream" || path == "ws" || path == "export" {
 		http.Error(w, "Process name required", http.StatusBadRequest)
 		return
 	}
 
-	// Parse query parameters
-	lines := 100
-	if l := r.URL.Query().Get("lines"); l != "" {
-		if parsed, err := strconv.Atoi(l); err == nil {
-			lines = parsed
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter.Processes = []string{path}
+	s.logsResponse(w, r, filter, path)
+}
+
+// handleStop handles process stop requests. Stopping runs as a background job.
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job := s.jobs.Submit("stop", "all", func(ctx context.Context, report func(string)) (interface{}, error) {
+		report("Stopping all processes")
+		results, err := s.processManager.StopAllWithResults(ctx)
+		return instanceResults(results), err
+	})
+
+	s.jobAccepted(w, job)
+}
+
+// handleStartApp starts a configured app that is not running
+func (s *Server) handleStartApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.start == nil {
+		http.Error(w, "Starting apps not available", http.StatusNotImplemented)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/start/")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "app name is required: /api/v1/start/{app}", http.StatusBadRequest)
+		return
+	}
+
+	job := s.jobs.Submit("start", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Starting %s", name))
+		jobs.Report(ctx, name, "starting", false)
+		err := s.start(ctx, name)
+		jobs.Report(ctx, name, stepOutcome(err, "started"), true)
+		return nil, err
+	})
+
+	s.jobAccepted(w, job)
+}
+
+// handleStopApp stops every instance of an app, or a single instance
+func (s *Server) handleStopApp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/v1/stop/")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "app name is required: /api/v1/stop/{app}", http.StatusBadRequest)
+		return
+	}
+
+	job := s.jobs.Submit("stop", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Stopping %s", name))
+		results, err := s.processManager.StopWithResults(ctx, name)
+		return instanceResults(results), err
+	})
+
+	s.jobAccepted(w, job)
+}
+
+// handleRestart restarts an app or instance, optionally without downtime
+func (s *Server) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("app")
+	if name == "" {
+		http.Error(w, "app parameter is required", http.StatusBadRequest)
+		return
+	}
+	rolling := r.URL.Query().Get("rolling") == "true"
+	if rolling && s.rollingRestart == nil {
+		http.Error(w, "Rolling restart not available", http.StatusNotImplemented)
+		return
+	}
+
+	jobType := "restart"
+	if rolling {
+		jobType = "rolling-restart"
+	}
+
+	job := s.jobs.Submit(jobType, name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Restarting %s", name))
+		if rolling {
+			return nil, s.rollingRestart(ctx, name, report)
 		}
+		return nil, s.restartInstances(ctx, name)
+	})
+
+	s.jobAccepted(w, job)
+}
+
+// handleReload sends an app's reload signal without restarting it, or without
+// an app parameter reloads the configuration
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	entries := s.logManager.GetProcessLogs(path, lines)
-	s.jsonResponse(w, map[string]interface{}{
-		"logs":      entries,
-		"count":     len(entries),
-		"process":   path,
-		"lines":     lines,
-		"timestamp": time.Now().Format(time.RFC3339),
+	name := r.URL.Query().Get("app")
+	if name == "" {
+		s.reloadConfiguration(w)
+		return
+	}
+
+	job := s.jobs.Submit("reload", name, func(ctx context.Context, report func(string)) (interface{}, error) {
+		report(fmt.Sprintf("Reloading %s", name))
+		jobs.Report(ctx, name, "signalling", false)
+		err := s.processManager.Reload(ctx, name)
+		jobs.Report(ctx, name, stepOutcome(err, "reloaded"), true)
+		return nil, err
 	})
+
+	s.jobAccepted(w, job)
 }
 
-// handleLogsStream handles streaming logs via Server-Sent Events
-func (s *Server) handleLogsStream(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+// handleScale sets the instance count of one or more apps, given as
+// formation=web=3,worker=2
+func (s *Server) handleScale(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.scale == nil {
+		http.Error(w, "Scaling not available", http.StatusNotImplemented)
+		return
+	}
 
-	// Set up Server-Sent Events
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Access-Control-Allow-Origin", "*")
+	formation, err := ParseFormation(r.URL.Query().Get("formation"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	process := r.URL.Query().Get("process")
-	
-	// Get current log count to track new entries
-	var lastCount int
-	if process != "" {
-		lastCount = len(s.logManager.GetProcessLogs(process, 1000))
-	} else {
-		lastCount = len(s.logManager.GetAllLogs(1000))
-	}
-
-	// Send initial data
-	fmt.Fprintf(w, "data: {\"type\":\"connected\",\"timestamp\":\"%s\"}\n\n", time.Now().Format(time.RFC3339))
-	w.(http.Flusher).Flush()
-
-	// Poll for new logs
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-
-	ctx := r.Context()
-	for {
-		select {
-		case <-ctx.Done():
+	names := make([]string, len(formation))
+	for i, entry := range formation {
+		names[i] = entry.App
+	}
+
+	job := s.jobs.Submit("scale", strings.Join(names, ","), func(ctx context.Context, report func(string)) (interface{}, error) {
+		jobs.Plan(ctx, names...)
+
+		var failed []string
+		for _, entry := range formation {
+			report(fmt.Sprintf("Scaling %s to %d instances", entry.App, entry.Instances))
+			jobs.Report(ctx, entry.App, fmt.Sprintf("scaling to %d", entry.Instances), false)
+			if err := s.scale(ctx, entry.App, entry.Instances); err != nil {
+				report(fmt.Sprintf("Failed to scale %s: %v", entry.App, err))
+				jobs.Report(ctx, entry.App, "failed", true)
+				failed = append(failed, entry.App)
+				continue
+			}
+			jobs.Report(ctx, entry.App, fmt.Sprintf("%d running", s.processManager.InstanceCount(entry.App)), true)
+		}
+
+		if len(failed) > 0 {
+			return nil, fmt.Errorf("failed to scale %s", strings.Join(failed, ", "))
+		}
+		return nil, nil
+	})
+
+	s.jobAccepted(w, job)
+}
+
+// handleFlags lists an app's feature flags (all apps without app), or on POST
+// applies set=key=value and unset=key parameters. Running processes see
+// environment changes after their next restart.
+func (s *Server) handleFlags(w http.ResponseWriter, r *http.Request) {
+	if s.flags == nil {
+		http.Error(w, "Feature flags not available", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	name := query.Get("app")
+
+	switch r.Method {
+	case http.MethodGet:
+		if name == "" {
+			s.jsonResponse(w, map[string]interface{}{"flags": s.flags.All()})
 			return
-		case <-ticker.C:
-			var newEntries []logs.LogEntry
-
-			if process != "" {
-				allEntries := s.logManager.GetProcessLogs(process, 1000)
-				if len(allEntries) > lastCount {
-					newEntries = allEntries[lastCount:]
-					lastCount = len(allEntries)
-				}
-			} else {
-				allEntries := s.logManager.GetAllLogs(1000)
-				if len(allEntries) > lastCount {
-					newEntries = allEntries[lastCount:]
-					lastCount = len(allEntries)
+		}
+		s.jsonResponse(w, map[string]interface{}{"app": name, "flags": s.flags.Get(name)})
+	case http.MethodPost:
+		if name == "" {
+			http.Error(w, "app parameter is required", http.StatusBadRequest)
+			return
+		}
+		set, err := flags.ParseAssignments(query["set"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		updated, err := s.flags.Update(name, set, query["unset"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.WithFields(logrus.Fields{"app": name, "set": flags.Keys(set), "unset": query["unset"]}).Info("Feature flags updated")
+		s.jsonResponse(w, map[string]interface{}{"app": name, "flags": updated})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOrphans lists processes left behind by managed processes, or kills them on POST
+func (s *Server) handleOrphans(w http.ResponseWriter, r *http.Request) {
+	var orphans []process.Orphan
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		orphans, err = s.processManager.Orphans()
+	case http.MethodPost:
+		orphans, err = s.processManager.KillOrphans()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil && len(orphans) == 0 {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{"orphans": orphans}
+	if orphans == nil {
+		response["orphans"] = []process.Orphan{}
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	s.jsonResponse(w, response)
+}
+
+// FormationEntry is the desired instance count of one app
+type FormationEntry struct {
+	App       string `json:"app"`
+	Instances int    `json:"instances"`
+}
+
+// ParseFormation parses "web=3,worker=2" into instance counts, keeping the given order
+func ParseFormation(value string) ([]FormationEntry, error) {
+	var formation []FormationEntry
+	seen := make(map[string]bool)
+
+	for _, part := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+		app, count, ok := strings.Cut(part, "=")
+		if !ok || app == "" {
+			return nil, fmt.Errorf("invalid formation %q, expected app=N", part)
+		}
+		instances, err := strconv.Atoi(count)
+		if err != nil || instances < 0 {
+			return nil, fmt.Errorf("invalid instance count %q for %s", count, app)
+		}
+		if seen[app] {
+			return nil, fmt.Errorf("app %s is listed more than once", app)
+		}
+		seen[app] = true
+		formation = append(formation, FormationEntry{App: app, Instances: instances})
+	}
+
+	if len(formation) == 0 {
+		return nil, fmt.Errorf("formation is required, e.g. web=3")
+	}
+	return formation, nil
+}
+
+// handleReset clears an app's restart counter and crash history. It is quick,
+// so it runs inline rather than as a job.
+func (s *Server) handleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("app")
+	if name == "" {
+		http.Error(w, "app parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	reset, err := s.processManager.ResetRestarts(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	s.jsonResponse(w, map[string]interface{}{
+		"reset":     reset,
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// handleDeploy lists the apps in deploy mode, puts an app in deploy mode on POST
+// (with an optional timeout and reason) or takes it out on DELETE
+func (s *Server) handleDeploy(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("app")
+	if r.Method != http.MethodGet && name == "" {
+		http.Error(w, "app parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		deploys := s.processManager.Deploys()
+		if name != "" {
+			filtered := []process.Deploy{}
+			for _, deploy := range deploys {
+				if deploy.App == name {
+					filtered = append(filtered, deploy)
 				}
 			}
+			deploys = filtered
+		}
+		s.jsonResponse(w, map[string]interface{}{"deploys": deploys})
+	case http.MethodPost:
+		var timeout time.Duration
+		if value := query.Get("timeout"); value != "" {
+			var err error
+			if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+				http.Error(w, fmt.Sprintf("invalid timeout %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+		deploy, err := s.processManager.BeginDeploy(name, timeout, query.Get("reason"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		s.jsonResponse(w, map[string]interface{}{"deploy": deploy})
+	case http.MethodDelete:
+		deploy, ended := s.processManager.EndDeploy(name)
+		if !ended {
+			http.Error(w, fmt.Sprintf("%s is not in deploy mode", name), http.StatusNotFound)
+			return
+		}
+		s.jsonResponse(w, map[string]interface{}{"deploy": deploy})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-			if len(newEntries) > 0 {
-				data := map[string]interface{}{
-					"type":      "logs",
-					"logs":      newEntries,
-					"count":     len(newEntries),
-					"timestamp": time.Now().Format(time.RFC3339),
-				}
+// stepOutcome returns the final phase for a job step
+func stepOutcome(err error, success string) string {
+	if err != nil {
+		return "failed"
+	}
+	return success
+}
+
+// handleHealth reports the latest health check of every instance, or of one app's
+// instances with ?app=, including failure streaks and when the status last changed
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.health == nil {
+		http.Error(w, "Health checks not available", http.StatusNotImplemented)
+		return
+	}
 
-				jsonData, _ := json.Marshal(data)
-				fmt.Fprintf(w, "data: %s\n\n", jsonData)
-				w.(http.Flusher).Flush()
+	results := s.health.GetAllResults()
+	if app := r.URL.Query().Get("app"); app != "" {
+		for name := range results {
+			if name != app && process.AppOfInstance(name) != app {
+				delete(results, name)
 			}
 		}
 	}
+	s.jsonResponse(w, map[string]interface{}{
+		"health":    results,
+		"count":     len(results),
+		"timestamp": time.Now().Format(time.RFC3339),
+	})
 }
 
-// handleStop handles process stop requests
-func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handleCerts lists the certificates with when each is due for renewal
+func (s *Server) handleCerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if s.certHealth == nil {
+		http.Error(w, "Certificates not available, tls is disabled", http.StatusNotImplemented)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Tokens restricted to some apps see the hostnames of those apps only
+	visible := visibleApps(r)
+	hostnames := []cert.HostCertificate{}
+	shown := make(map[string]bool)
+	for _, host := range s.certHealth() {
+		if visible == nil || visible(host.App) {
+			hostnames = append(hostnames, host)
+			shown[host.Hostname] = true
+		}
+	}
 
-	results, err := s.processManager.StopAllWithResults(ctx)
-	
 	response := map[string]interface{}{
-		"results":   results,
+		"hostnames":    hostnames,
+		"certificates": []cert.RenewalStatus{},
+		"count":        0,
+		"issuance":     []cert.IssuanceStatus{},
+	}
+	// Renewal is only tracked for ACME certificates
+	if s.certRenewer != nil {
+		certs, nextCheck := s.certRenewer.Status()
+		if visible != nil {
+			certs = slices.DeleteFunc(certs, func(c cert.RenewalStatus) bool { return !shown[c.Domain] })
+		}
+		response["certificates"] = certs
+		response["count"] = len(certs)
+		response["renew_before"] = s.certRenewer.RenewBefore().String()
+		response["next_check"] = nextCheck
+	}
+	if s.issuance != nil {
+		issuance := append([]cert.IssuanceStatus{}, s.issuance()...)
+		if visible != nil {
+			issuance = slices.DeleteFunc(issuance, func(i cert.IssuanceStatus) bool { return !shown[i.Hostname] })
+		}
+		response["issuance"] = issuance
+	}
+	s.jsonResponse(w, response)
+}
+
+// handleJobs lists known background jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list := s.jobs.List()
+	s.jsonResponse(w, map[string]interface{}{
+		"jobs":      list,
+		"count":     len(list),
 		"timestamp": time.Now().Format(time.RFC3339),
+	})
+}
+
+// handleJob reports the progress and result of a single job
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	if err != nil {
-		response["error"] = err.Error()
-		response["success"] = false
-	} else {
-		response["success"] = true
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/")
+	job, exists := s.jobs.Get(id)
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
 	}
 
-	s.jsonResponse(w, response)
+	s.jsonResponse(w, job)
+}
+
+// jobAccepted answers a mutating request with the ID of the job doing the work
+func (s *Server) jobAccepted(w http.ResponseWriter, job jobs.Job) {
+	w.Header().Set("Location", "/api/v1/jobs/"+job.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":    job.ID,
+		"job":       job,
+		"timestamp": time.Now().Format(time.RFC3339),
+	}); err != nil {
+		s.logger.WithError(err).Error("Failed to encode JSON response")
+	}
 }
 
 // jsonResponse sends a JSON response
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long responses are remembered per Idempotency-Key
+const DefaultIdempotencyWindow = 10 * time.Minute
+
+// idempotentResponse is a recorded response replayed for retried requests
+type idempotentResponse struct {
+	request string // Method and URL the key was first used with
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+	done    chan struct{} // Closed once the first request completes
+}
+
+// idempotencyCache remembers responses of mutating requests by Idempotency-Key
+type idempotencyCache struct {
+	entries map[string]*idempotentResponse
+	window  time.Duration
+	mu      sync.Mutex
+}
+
+func newIdempotencyCache(window time.Duration) *idempotencyCache {
+	if window <= 0 {
+		window = DefaultIdempotencyWindow
+	}
+	return &idempotencyCache{entries: make(map[string]*idempotentResponse), window: window}
+}
+
+// recorder captures a response while passing it through to the client
+type recorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent wraps a mutating handler so requests retried with the same Idempotency-Key
+// replay the first response instead of executing the action again
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" || r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			next(w, r)
+			return
+		}
+
+		cache := s.idempotency
+		request := r.Method + " " + r.URL.RequestURI()
+		now := time.Now()
+
+		cache.mu.Lock()
+		for k, entry := range cache.entries {
+			if isClosed(entry.done) && now.After(entry.expires) {
+				delete(cache.entries, k)
+			}
+		}
+		entry, exists := cache.entries[key]
+		if !exists {
+			entry = &idempotentResponse{request: request, done: make(chan struct{})}
+			cache.entries[key] = entry
+		}
+		cache.mu.Unlock()
+
+		if exists {
+			if entry.request != request {
+				http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				return
+			}
+
+			// Wait for the original request if it is still in flight, then replay it
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			for name, values := range entry.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w}
+		next(rec, r)
+
+		cache.mu.Lock()
+		entry.status = rec.status
+		if entry.status == 0 {
+			entry.status = http.StatusOK
+		}
+		entry.header = w.Header().Clone()
+		entry.body = rec.body.Bytes()
+		entry.expires = time.Now().Add(cache.window)
+		cache.mu.Unlock()
+		close(entry.done)
+	}
+}
+
+// isClosed reports whether a channel has been closed
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+const (
+	// streamBatch bounds the entries sent in one stream message
+	streamBatch = 100
+	// streamKeepalive is how often an idle event stream is written to, so
+	// proxies keep it open and a gone client is noticed
+	streamKeepalive = 15 * time.Second
+)
+
+// logMessage is a message of the log streams
+type logMessage struct {
+	Type      string          `json:"type"` // connected or logs
+	Logs      []logs.LogEntry `json:"logs,omitempty"`
+	Count     int             `json:"count,omitempty"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// handleLogsStream streams new log entries via Server-Sent Events as they are logged
+func (s *Server) handleLogsStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Set up Server-Sent Events
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	send := func(msg logMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	keepalive := func() error {
+		if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	s.followLogs(r.Context(), filter, send, keepalive)
+}
+
+// handleLogsWebSocket streams new log entries over a WebSocket, as JSON
+// messages shaped like the Server-Sent Events of handleLogsStream
+func (s *Server) handleLogsWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	r := ws.Request()
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		websocket.JSON.Send(ws, map[string]string{"type": "error", "error": err.Error()})
+		return
+	}
+
+	// The client only ever closes the connection; reading notices that
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		var discard []byte
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	send := func(msg logMessage) error {
+		ws.SetWriteDeadline(time.Now().Add(streamKeepalive))
+		return websocket.JSON.Send(ws, msg)
+	}
+	s.followLogs(ctx, filter, send, nil)
+}
+
+// followLogs sends new entries the filter selects until ctx is done or
+// sending fails. keepalive, if set, is called when nothing was sent for a while.
+func (s *Server) followLogs(ctx context.Context, filter logs.Filter, send func(logMessage) error, keepalive func() error) {
+	entries, unsubscribe := s.logManager.Subscribe(filter.Processes...)
+	defer unsubscribe()
+
+	if send(logMessage{Type: "connected", Timestamp: time.Now().Format(time.RFC3339)}) != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if keepalive != nil && keepalive() != nil {
+				return
+			}
+		case entry := <-entries:
+			// Send what else is already waiting along with it
+			var batch []logs.LogEntry
+			if filter.Match(entry) {
+				batch = append(batch, entry)
+			}
+		drain:
+			for len(batch) < streamBatch {
+				select {
+				case entry := <-entries:
+					if filter.Match(entry) {
+						batch = append(batch, entry)
+					}
+				default:
+					break drain
+				}
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			msg := logMessage{Type: "logs", Logs: batch, Count: len(batch), Timestamp: time.Now().Format(time.RFC3339)}
+			if send(msg) != nil {
+				return
+			}
+			ticker.Reset(streamKeepalive)
+		}
+	}
+}
+
+// checkWebSocketOrigin accepts clients that send no Origin, such as the CLI,
+// and pages served from the API's own host or localhost, so other web pages
+// cannot read logs through the browser
+func checkWebSocketOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	config.Origin = origin
+	if origin == nil || allowedOrigin(origin, r.Host) {
+		return nil
+	}
+	return fmt.Errorf("origin %s is not allowed", origin)
+}
+
+// exportFlushEvery is how many exported entries are written between flushes
+const exportFlushEvery = 500
+
+// LogsOldestHeader tells log exports the time of the oldest stored entry of
+// the processes they select; what the export asks for before it is no longer kept
+const LogsOldestHeader = "X-Guvnor-Logs-Oldest"
+
+// handleLogsExport writes every stored entry the filter selects, oldest
+// first, in the format of the format parameter (ndjson by default). Entries
+// come from the log files in logs.dir, when it is set, and the log buffers,
+// and are written as they are read, so the client can save the export while
+// it is produced.
+func (s *Server) handleLogsExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = logs.ExportNDJSON
+	}
+	if logs.ExportContentType(format) == "" {
+		http.Error(w, fmt.Sprintf("unknown export format %q (use ndjson, csv or text)", format), http.StatusBadRequest)
+		return
+	}
+
+	var dir string
+	if s.config != nil {
+		dir = s.config().Logs.Dir
+	}
+	archive := logs.NewArchive(s.logManager, dir)
+	oldest, err := archive.Oldest(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !oldest.IsZero() {
+		w.Header().Set(LogsOldestHeader, oldest.UTC().Format(time.RFC3339Nano))
+	}
+
+	w.Header().Set("Content-Type", logs.ExportContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="guvnor-logs.%s"`, format))
+	exporter, err := logs.NewExporter(w, format)
+	if err != nil {
+		return
+	}
+	flusher, _ := w.(http.Flusher)
+
+	written, gone := 0, false
+	err = archive.Each(filter, func(entry logs.LogEntry) error {
+		if err := exporter.Write(entry); err != nil {
+			gone = true
+			return err
+		}
+		if written++; written%exportFlushEvery == 0 && exporter.Flush() == nil && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if gone {
+		return
+	}
+	if err != nil {
+		// Abort the response, so the client sees a truncated export rather than a short one
+		s.logger.WithError(err).Warn("Failed to read log files for export")
+		panic(http.ErrAbortHandler)
+	}
+	exporter.Flush()
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIDocument describes every route of the API; the client's operations
+// are generated from it
+//
+//go:embed openapi.yaml
+var openAPIDocument []byte
+
+// Operation is an endpoint of the API as the OpenAPI document describes it
+type Operation struct {
+	ID         string // operationId
+	Method     string // GET, POST or DELETE
+	Path       string // With its {parameters}, e.g. /api/v1/jobs/{id}
+	Summary    string
+	Deprecated bool
+}
+
+// operationMethods are the methods the document may describe, in the order
+// operations of one path are listed
+var operationMethods = []string{"get", "post", "put", "patch", "delete"}
+
+// OpenAPI returns the OpenAPI document of the API as JSON
+func OpenAPI() ([]byte, error) {
+	var document map[string]interface{}
+	if err := yaml.Unmarshal(openAPIDocument, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse the OpenAPI document: %w", err)
+	}
+	return json.Marshal(document)
+}
+
+// Operations returns the operations of the OpenAPI document, ordered by path
+// and method
+func Operations() ([]Operation, error) {
+	var document struct {
+		Paths map[string]map[string]struct {
+			OperationID string `yaml:"operationId"`
+			Summary     string `yaml:"summary"`
+			Deprecated  bool   `yaml:"deprecated"`
+		} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openAPIDocument, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse the OpenAPI document: %w", err)
+	}
+
+	paths := make([]string, 0, len(document.Paths))
+	for path := range document.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var operations []Operation
+	for _, path := range paths {
+		for _, method := range operationMethods {
+			op, exists := document.Paths[path][method]
+			if !exists {
+				continue
+			}
+			if op.OperationID == "" {
+				return nil, fmt.Errorf("%s %s has no operationId", strings.ToUpper(method), path)
+			}
+			operations = append(operations, Operation{
+				ID:         op.OperationID,
+				Method:     strings.ToUpper(method),
+				Path:       path,
+				Summary:    op.Summary,
+				Deprecated: op.Deprecated,
+			})
+		}
+	}
+	return operations, nil
+}
+
+// handleOpenAPI serves the OpenAPI document as JSON
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	document, err := OpenAPI()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(document)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// allowedOrigin reports whether a page from origin may use the API reached
+// at host: pages served from that host, such as the dashboard, and from
+// localhost
+func allowedOrigin(origin *url.URL, host string) bool {
+	if origin.Host == host {
+		return true
+	}
+	ip := net.ParseIP(origin.Hostname())
+	return origin.Hostname() == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// checkOrigin rejects requests sent by web pages of other sites. With no
+// tokens configured the API trusts whoever reaches localhost, which includes
+// any page open in a browser there; clients such as the CLI send no Origin.
+func checkOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Origin"); header != "" {
+			origin, err := url.Parse(header)
+			if err != nil || origin.Host == "" || !allowedOrigin(origin, r.Host) {
+				http.Error(w, fmt.Sprintf("Forbidden: origin %s is not allowed", header), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyTypes are the media types of the request bodies the API reads
+var bodyTypes = map[string]bool{
+	"application/json":   true,
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+}
+
+// checkBodyType refuses mutating requests with a body that is not JSON or
+// YAML, so forms and text/plain requests, which browsers send to any site
+// without asking it first, cannot change anything
+func checkBodyType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		header := r.Header.Get("Content-Type")
+		if header == "" && r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !readableBody(header) {
+			unsupportedBody(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readableBody reports whether a Content-Type header names JSON or YAML
+func readableBody(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	return err == nil && (bodyTypes[mediaType] || strings.HasSuffix(mediaType, "+json"))
+}
+
+func unsupportedBody(w http.ResponseWriter) {
+	http.Error(w, "Unsupported Media Type: send application/json or application/yaml", http.StatusUnsupportedMediaType)
+}
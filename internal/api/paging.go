@@ -0,0 +1,216 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// pageParams are the pagination and field selection parameters of the status
+// and log endpoints
+type pageParams struct {
+	limit  int      // Items per page, 0 for all
+	offset int      // Items skipped before the page
+	cursor string   // next_cursor of the previous page
+	fields []string // Keys kept in each item, all when empty
+}
+
+// parsePage reads the limit, offset, cursor and fields query parameters
+func parsePage(r *http.Request) (pageParams, error) {
+	query := r.URL.Query()
+	var page pageParams
+	for name, value := range map[string]*int{"limit": &page.limit, "offset": &page.offset} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return pageParams{}, fmt.Errorf("%s must be a number, 0 or more", name)
+		}
+		*value = n
+	}
+	page.cursor = query.Get("cursor")
+	page.fields = logs.SplitProcesses(query.Get("fields"))
+	return page, nil
+}
+
+// encodeCursor makes a cursor opaque, so clients pass it back as they got it
+func encodeCursor(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// decodeCursor reverses encodeCursor
+func decodeCursor(cursor string) (string, error) {
+	value, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor")
+	}
+	return string(value), nil
+}
+
+// checkFields refuses fields that are not JSON keys of item, a struct, so a
+// typo does not empty the response
+func checkFields(item interface{}, fields []string) error {
+	t := reflect.TypeOf(item)
+	keys := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	for _, field := range fields {
+		if !keys[field] {
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+	return nil
+}
+
+// selectFields returns items, a list of structs, as JSON objects with only
+// the given keys, or items itself when no fields are given
+func selectFields(items interface{}, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return items, nil
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	selected := make([]map[string]json.RawMessage, len(objects))
+	for i, object := range objects {
+		selected[i] = make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, exists := object[field]; exists {
+				selected[i][field] = value
+			}
+		}
+	}
+	return selected, nil
+}
+
+// statusFilter selects processes for /api/v1/status
+type statusFilter struct {
+	apps     []string  // Apps or instances, all when empty
+	statuses []string  // Process statuses, e.g. running or failed
+	since    time.Time // Started at or after, unless zero
+}
+
+// parseStatusFilter reads the app, status and since query parameters
+func parseStatusFilter(r *http.Request) (statusFilter, error) {
+	query := r.URL.Query()
+	since, err := logs.ParseTime(query.Get("since"), time.Now())
+	if err != nil {
+		return statusFilter{}, fmt.Errorf("invalid since: %w", err)
+	}
+	return statusFilter{
+		apps:     logs.SplitProcesses(query.Get("app")),
+		statuses: logs.SplitProcesses(query.Get("status")),
+		since:    since,
+	}, nil
+}
+
+// match reports whether the filter selects a process
+func (f statusFilter) match(info process.ProcessInfo) bool {
+	if len(f.apps) > 0 && !(logs.Filter{Processes: f.apps}).SelectsProcess(info.Name) {
+		return false
+	}
+	if len(f.statuses) > 0 {
+		found := false
+		for _, status := range f.statuses {
+			found = found || strings.EqualFold(status, info.Status)
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.since.IsZero() || !info.StartTime.Before(f.since)
+}
+
+// pageProcesses sorts processes by name and returns the page asked for, with
+// the cursor of the next page or "" on the last one
+func pageProcesses(infos []process.ProcessInfo, page pageParams) ([]process.ProcessInfo, string, error) {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	if page.cursor != "" {
+		after, err := decodeCursor(page.cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		start := sort.Search(len(infos), func(i int) bool { return infos[i].Name > after })
+		infos = infos[start:]
+	}
+	infos = infos[min(page.offset, len(infos)):]
+	if page.limit == 0 || page.limit >= len(infos) {
+		return infos, "", nil
+	}
+	infos = infos[:page.limit]
+	return infos, encodeCursor(infos[len(infos)-1].Name), nil
+}
+
+// pageLogs returns the page of the latest log entries the filter selects, going
+// back in time from page to page, with the cursor of the next page or "" on the
+// last one. A cursor holds the time of the oldest entry of its page and how
+// many entries logged at that time the page and the ones before it returned.
+func (s *Server) pageLogs(filter logs.Filter, limit int, page pageParams) ([]logs.LogEntry, string, error) {
+	skip := page.offset
+	if page.cursor != "" {
+		value, err := decodeCursor(page.cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		nanos, seen, found := strings.Cut(value, ":")
+		unixNano, err := strconv.ParseInt(nanos, 10, 64)
+		count, countErr := strconv.Atoi(seen)
+		if !found || err != nil || countErr != nil {
+			return nil, "", fmt.Errorf("invalid cursor")
+		}
+		until := time.Unix(0, unixNano)
+		skip += count
+		// Entries up to and including the cursor time, minus those already returned
+		if filter.Until.IsZero() || until.Before(filter.Until) {
+			filter.Until = until.Add(time.Nanosecond)
+		}
+	}
+
+	// One more than the page tells whether there is a next page
+	want := 0
+	if limit > 0 {
+		want = limit + skip + 1
+	}
+	fetched := s.logManager.FindLogs(want, filter)
+	end := max(len(fetched)-skip, 0)
+	start := 0
+	more := false
+	if limit > 0 && end > limit {
+		start = end - limit
+		more = true
+	}
+	entries := fetched[start:end]
+	if !more || len(entries) == 0 {
+		return entries, "", nil
+	}
+
+	oldest := entries[0].Timestamp
+	seen := 0
+	for _, entry := range fetched[start:] {
+		if entry.Timestamp.Equal(oldest) {
+			seen++
+		}
+	}
+	return entries, encodeCursor(fmt.Sprintf("%d:%d", oldest.UnixNano(), seen)), nil
+}
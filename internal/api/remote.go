@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// apiRemote is the TLS listener serving the API to other machines
+type apiRemote struct {
+	addr   string
+	tls    *tls.Config
+	server *http.Server
+}
+
+// SetRemoteListener makes Start also serve the API over TLS on addr, which
+// other machines can reach. Requests there go through the same token checks
+// as on the TCP port, so tokens must be configured.
+func (s *Server) SetRemoteListener(addr string, tlsConfig *tls.Config) {
+	s.remote = &apiRemote{addr: addr, tls: tlsConfig}
+}
+
+// startRemote serves handler on the remote listener
+func (s *Server) startRemote(handler http.Handler) error {
+	if len(s.tokens) == 0 {
+		return fmt.Errorf("serving the management API remotely requires api tokens")
+	}
+	listener, err := net.Listen("tcp", s.remote.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.remote.addr, err)
+	}
+
+	s.remote.server = &http.Server{Handler: handler, TLSConfig: s.remote.tls}
+	s.logger.WithField("addr", s.remote.addr).Info("Serving management API to remote clients over TLS")
+	go func() {
+		if err := s.remote.server.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
+			s.logger.WithError(err).Error("Management API remote listener error")
+		}
+	}()
+	return nil
+}
+
+// stopRemote stops serving remote clients
+func (s *Server) stopRemote(ctx context.Context) error {
+	if s.remote == nil || s.remote.server == nil {
+		return nil
+	}
+	return s.remote.server.Shutdown(ctx)
+}
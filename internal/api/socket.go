@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// apiSocket is where the API is served besides its TCP port
+type apiSocket struct {
+	path   string
+	mode   os.FileMode
+	gid    int // -1 keeps the group of the user running guvnor
+	server *http.Server
+}
+
+// SetSocket makes Start also serve the API on a unix socket at path with the
+// given permissions, owned by group unless it is "". Only the file's
+// permissions decide who may connect, so requests over the socket need no
+// api token.
+func (s *Server) SetSocket(path string, mode os.FileMode, group string) error {
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("failed to look up socket group: %w", err)
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return fmt.Errorf("socket group %s has no numeric ID", group)
+		}
+	}
+	s.socket = &apiSocket{path: path, mode: mode, gid: gid}
+	return nil
+}
+
+// startSocket serves handler on the socket. Failures leave the API on its TCP
+// port only.
+func (s *Server) startSocket(handler http.Handler) {
+	listener, err := listenSocket(s.socket.path, s.socket.mode, s.socket.gid)
+	if err != nil {
+		s.logger.WithError(err).Warn("Management API socket not available, serving TCP only")
+		return
+	}
+
+	s.socket.server = &http.Server{Handler: handler}
+	s.logger.WithField("socket", s.socket.path).Info("Serving management API on unix socket")
+	go func() {
+		if err := s.socket.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.WithError(err).Error("Management API socket error")
+		}
+	}()
+}
+
+// listenSocket listens on a unix socket at path, replacing a stale one left by
+// a server that did not shut down. The socket is bound in a private directory
+// and moved in place once its permissions are set, so it is never reachable
+// with broader ones.
+func listenSocket(path string, mode os.FileMode, gid int) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory %s: %w", dir, err)
+	}
+	private, err := os.MkdirTemp(dir, ".guvnor-sock-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	defer os.RemoveAll(private)
+
+	bound := filepath.Join(private, "api.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: bound, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	listener.SetUnlinkOnClose(false) // Stop removes it from its final path
+	if err := prepareSocket(bound, path, mode, gid); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// prepareSocket sets the permissions of the socket bound at bound and moves it to path
+func prepareSocket(bound, path string, mode os.FileMode, gid int) error {
+	if err := os.Chmod(bound, mode); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	if gid >= 0 {
+		if err := os.Chown(bound, -1, gid); err != nil {
+			return fmt.Errorf("failed to set socket group: %w", err)
+		}
+	}
+	if err := os.Rename(bound, path); err != nil {
+		return fmt.Errorf("failed to move socket to %s: %w", path, err)
+	}
+	return nil
+}
+
+// stopSocket stops serving the socket and removes it
+func (s *Server) stopSocket(ctx context.Context) error {
+	if s.socket == nil || s.socket.server == nil {
+		return nil
+	}
+	err := s.socket.server.Shutdown(ctx)
+	os.Remove(s.socket.path)
+	return err
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BasePath is where the current version of the API is served
+const BasePath = "/api/v1"
+
+// legacyPaths serves the unversioned paths of earlier releases, /api/status
+// and so on, as their BasePath successors so older CLIs and scripts keep
+// working. Responses tell clients where the endpoint moved.
+func legacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, legacy := strings.CutPrefix(r.URL.Path, "/api/")
+		if !legacy || r.URL.Path == BasePath || strings.HasPrefix(r.URL.Path, BasePath+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		successor := BasePath + "/" + rest
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = successor
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = BasePath + strings.TrimPrefix(r.URL.RawPath, "/api")
+		}
+		next.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,75 @@
+// Package audit records privileged operations, such as overriding a deployment
+// freeze, in an append-only JSON lines file
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileName is the audit log's name inside the state directory
+const FileName = "audit.log"
+
+// Events recorded in the audit log
+const (
+	EventBreakGlass = "break_glass" // An operation ran during a freeze window
+)
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"` // Apps acted on, empty for the whole server
+	Actor  string    `json:"actor,omitempty"`  // API token name, or where the request came from
+	Reason string    `json:"reason,omitempty"`
+	Window string    `json:"window,omitempty"` // Freeze window that was overridden
+}
+
+// Log appends entries to a file
+type Log struct {
+	path string
+	mu   sync.Mutex
+}
+
+// Open returns the audit log at path; the file is created on the first entry
+func Open(path string) *Log {
+	return &Log{path: path}
+}
+
+// Path returns the file the log is written to
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends an entry, stamping it with the current time if it has none
+func (l *Log) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
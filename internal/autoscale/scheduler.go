@@ -0,0 +1,180 @@
+package autoscale
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/cron"
+)
+
+// Scaler changes the number of running instances of an app
+type Scaler interface {
+	Scale(ctx context.Context, appConfig config.AppConfig, instances int) error
+}
+
+// entry is a parsed schedule entry
+type entry struct {
+	schedule  *cron.Schedule
+	instances int
+}
+
+// appSchedule holds the parsed schedule of one app
+type appSchedule struct {
+	app      config.AppConfig
+	entries  []entry
+	location *time.Location
+	applied  int // Last instance count applied by the scheduler, -1 if none
+
+	// The entry in effect is found once and then followed as entries fire
+	checked time.Time   // When desired was last called, zero before the first call
+	next    []time.Time // When each entry fires next after checked
+	current int         // Instance count of the entry in effect
+	found   bool        // Whether any entry has fired
+}
+
+// Scheduler applies time-of-day instance counts to apps
+type Scheduler struct {
+	apps     []*appSchedule
+	scaler   Scaler
+	interval time.Duration
+	logger   *logrus.Entry
+	mu       sync.Mutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler creates a scheduler for every app with an autoscale schedule
+func NewScheduler(apps []config.AppConfig, scaler Scaler, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		scaler:   scaler,
+		interval: 30 * time.Second,
+		logger:   logger.WithField("component", "autoscale"),
+		stopCh:   make(chan struct{}),
+	}
+
+	for _, app := range apps {
+		if len(app.Autoscale.Schedule) == 0 {
+			continue
+		}
+
+		sched := &appSchedule{app: app, location: time.Local, applied: -1}
+		if app.Autoscale.Timezone != "" {
+			loc, err := time.LoadLocation(app.Autoscale.Timezone)
+			if err != nil {
+				return nil, err
+			}
+			sched.location = loc
+		}
+
+		for _, e := range app.Autoscale.Schedule {
+			schedule, err := cron.Parse(e.Cron)
+			if err != nil {
+				return nil, err
+			}
+			sched.entries = append(sched.entries, entry{schedule: schedule, instances: e.Instances})
+		}
+
+		s.apps = append(s.apps, sched)
+	}
+
+	return s, nil
+}
+
+// Empty reports whether no app has a schedule
+func (s *Scheduler) Empty() bool {
+	return len(s.apps) == 0
+}
+
+// Start applies the instance counts currently in effect and keeps following the schedule
+func (s *Scheduler) Start(ctx context.Context) {
+	s.logger.WithField("apps", len(s.apps)).Info("Starting autoscale scheduler")
+	s.Apply(ctx, time.Now())
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.stopCh:
+				return
+			case now := <-ticker.C:
+				s.Apply(ctx, now)
+			}
+		}
+	}()
+}
+
+// Stop stops following the schedule
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.logger.Info("Stopping autoscale scheduler")
+		close(s.stopCh)
+	})
+}
+
+// Apply scales every app whose scheduled instance count changed since the last call.
+// Manual scaling in between is left alone until the next schedule entry fires.
+func (s *Scheduler) Apply(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sched := range s.apps {
+		desired, ok := sched.desired(now)
+		if !ok || desired == sched.applied {
+			continue
+		}
+
+		logger := s.logger.WithFields(logrus.Fields{"app": sched.app.Name, "instances": desired})
+		if err := s.scaler.Scale(ctx, sched.app, desired); err != nil {
+			logger.WithError(err).Error("Scheduled scaling failed")
+			continue
+		}
+		logger.Info("Applied scheduled instance count")
+		sched.applied = desired
+	}
+}
+
+// desired returns the instance count of the entry that fired most recently.
+// When entries fire at the same minute the later one in the list wins.
+func (a *appSchedule) desired(now time.Time) (int, bool) {
+	now = now.In(a.location)
+
+	if a.checked.IsZero() || now.Before(a.checked) {
+		// First call, or the clock went back: search for the entry in effect
+		a.current, a.found = 0, false
+		a.next = make([]time.Time, len(a.entries))
+		a.fire(now, func(int) bool { return true })
+	} else {
+		// Only entries that fired since the last call can take over
+		a.fire(now, func(i int) bool { return !a.next[i].IsZero() && !a.next[i].After(now) })
+	}
+	a.checked = now
+
+	return a.current, a.found
+}
+
+// fire makes the latest firing at or before now of the entries picked the one
+// in effect, and finds when they fire next
+func (a *appSchedule) fire(now time.Time, pick func(i int) bool) {
+	var latest time.Time
+	for i, e := range a.entries {
+		if !pick(i) {
+			continue
+		}
+		a.next[i] = e.schedule.Next(now)
+		fired := e.schedule.Prev(now)
+		if fired.IsZero() {
+			continue
+		}
+		if latest.IsZero() || !fired.Before(latest) {
+			latest, a.current, a.found = fired, e.instances, true
+		}
+	}
+}
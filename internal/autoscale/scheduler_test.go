@@ -0,0 +1,105 @@
+package autoscale
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+type fakeScaler struct {
+	calls []int
+}
+
+func (f *fakeScaler) Scale(ctx context.Context, appConfig config.AppConfig, instances int) error {
+	f.calls = append(f.calls, instances)
+	return nil
+}
+
+func TestScheduler_Apply(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	app := config.AppConfig{
+		Name: "web",
+		Autoscale: config.AutoscaleConfig{
+			Timezone: "UTC",
+			Schedule: []config.ScheduleEntry{
+				{Cron: "0 8 * * 1-5", Instances: 4},
+				{Cron: "0 20 * * *", Instances: 1},
+			},
+		},
+	}
+
+	scaler := &fakeScaler{}
+	s, err := NewScheduler([]config.AppConfig{app}, scaler, logger)
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	ctx := context.Background()
+	// Wednesday 2024-01-10
+	s.Apply(ctx, time.Date(2024, 1, 10, 9, 0, 0, 0, time.UTC))
+	s.Apply(ctx, time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)) // unchanged
+	s.Apply(ctx, time.Date(2024, 1, 10, 21, 0, 0, 0, time.UTC))
+	// Saturday morning keeps the evening count
+	s.Apply(ctx, time.Date(2024, 1, 13, 9, 0, 0, 0, time.UTC))
+
+	expected := []int{4, 1}
+	if len(scaler.calls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, scaler.calls)
+	}
+	for i := range expected {
+		if scaler.calls[i] != expected[i] {
+			t.Errorf("Call %d: expected %d instances, got %d", i, expected[i], scaler.calls[i])
+		}
+	}
+}
+
+func TestScheduler_ApplyRareEntries(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	app := config.AppConfig{
+		Name: "shop",
+		Autoscale: config.AutoscaleConfig{
+			Timezone: "UTC",
+			Schedule: []config.ScheduleEntry{
+				{Cron: "0 0 1 1 *", Instances: 2},   // Quiet season from New Year
+				{Cron: "0 0 1 11 *", Instances: 6},  // Holiday season
+				{Cron: "0 0 1 */3 *", Instances: 4}, // Quarterly sale days
+			},
+		},
+	}
+
+	scaler := &fakeScaler{}
+	s, err := NewScheduler([]config.AppConfig{app}, scaler, logger)
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	ctx := context.Background()
+	for _, now := range []time.Time{
+		time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC),  // Quarterly entry of January 1st, listed last
+		time.Date(2024, 4, 1, 0, 0, 30, 0, time.UTC),   // Quarterly entry fires again, no change
+		time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC), // Holiday season, after a jump of months
+		time.Date(2025, 1, 1, 0, 1, 0, 0, time.UTC),    // New Year and the quarter at once
+		time.Date(2024, 12, 24, 0, 0, 0, 0, time.UTC),  // Clock set back
+	} {
+		s.Apply(ctx, now)
+	}
+
+	expected := []int{4, 6, 4, 6}
+	if len(scaler.calls) != len(expected) {
+		t.Fatalf("Expected calls %v, got %v", expected, scaler.calls)
+	}
+	for i := range expected {
+		if scaler.calls[i] != expected[i] {
+			t.Errorf("Call %d: expected %d instances, got %d", i, expected[i], scaler.calls[i])
+		}
+	}
+}
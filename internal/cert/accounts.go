@@ -0,0 +1,60 @@
+package cert
+
+import (
+	"context"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// autocert caches the ACME account key under these names
+const (
+	accountKeyName       = "acme_account+key"
+	legacyAccountKeyName = "acme_account.key"
+)
+
+// accountCache keeps the account key of an additional ACME account next to
+// the default one, so managers with different emails can share a cert dir.
+// Certificates are cached by domain and need no mapping.
+type accountCache struct {
+	autocert.Cache
+	keyName string
+}
+
+// AccountCache returns a cache storing the ACME account key of email under
+// its own name; other entries go to cache unchanged
+func AccountCache(cache autocert.Cache, email string) autocert.Cache {
+	return &accountCache{Cache: cache, keyName: AccountKeyName(email)}
+}
+
+// AccountKeyName returns the cache name of the account key of email. It ends
+// in +key so certificate scans skip it.
+func AccountKeyName(email string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, strings.ToLower(email))
+	return "acme_account-" + name + "+key"
+}
+
+func (c *accountCache) key(name string) string {
+	if name == accountKeyName || name == legacyAccountKeyName {
+		return c.keyName
+	}
+	return name
+}
+
+func (c *accountCache) Get(ctx context.Context, name string) ([]byte, error) {
+	return c.Cache.Get(ctx, c.key(name))
+}
+
+func (c *accountCache) Put(ctx context.Context, name string, data []byte) error {
+	return c.Cache.Put(ctx, c.key(name), data)
+}
+
+func (c *accountCache) Delete(ctx context.Context, name string) error {
+	return c.Cache.Delete(ctx, c.key(name))
+}
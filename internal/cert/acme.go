@@ -0,0 +1,107 @@
+package cert
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+)
+
+// ACMEDirectories are the ACME CAs that can be chosen by name instead of URL
+var ACMEDirectories = map[string]string{
+	"letsencrypt":         "https://acme-v02.api.letsencrypt.org/directory",
+	"letsencrypt-staging": "https://acme-staging-v02.api.letsencrypt.org/directory",
+	"zerossl":             "https://acme.zerossl.com/v2/DV90",
+	"buypass":             "https://api.buypass.com/acme/directory",
+	"buypass-staging":     "https://api.test4.buypass.no/acme/directory",
+	"google":              "https://dv.acme-v02.api.pki.goog/directory",
+	"google-staging":      "https://dv.acme-v02.test-api.pki.goog/directory",
+}
+
+// ACME selects the CA certificates are requested from and the account
+// binding it requires
+type ACME struct {
+	DirectoryURL string // URL or name from ACMEDirectories; empty for Let's Encrypt
+	Staging      bool   // Let's Encrypt staging, when DirectoryURL is empty
+	EABKeyID     string // External account binding key id, for CAs such as ZeroSSL and Google
+	EABHMACKey   string // External account binding MAC key, base64url encoded as CAs hand it out
+	RootCA       string // PEM file trusted for the HTTPS certificate of a private ACME server
+}
+
+// ResolveDirectory returns the directory URL for a URL or a name from ACMEDirectories
+func ResolveDirectory(directory string) (string, error) {
+	if u, exists := ACMEDirectories[strings.ToLower(directory)]; exists {
+		return u, nil
+	}
+	u, err := url.Parse(directory)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		names := make([]string, 0, len(ACMEDirectories))
+		for name := range ACMEDirectories {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("invalid ACME directory %q, expected a URL or one of %s", directory, strings.Join(names, ", "))
+	}
+	return directory, nil
+}
+
+// Directory returns the ACME directory URL
+func (a ACME) Directory() string {
+	if a.DirectoryURL == "" {
+		return directoryURL(a.Staging)
+	}
+	if u, err := ResolveDirectory(a.DirectoryURL); err == nil {
+		return u
+	}
+	return a.DirectoryURL
+}
+
+// ExternalAccountBinding returns the binding to register accounts with, or nil
+// when none is configured
+func (a ACME) ExternalAccountBinding() (*acme.ExternalAccountBinding, error) {
+	if a.EABKeyID == "" && a.EABHMACKey == "" {
+		return nil, nil
+	}
+	if a.EABKeyID == "" || a.EABHMACKey == "" {
+		return nil, fmt.Errorf("external account binding requires both a key id and an hmac key")
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(a.EABHMACKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid external account binding hmac key, expected base64url: %w", err)
+	}
+	return &acme.ExternalAccountBinding{KID: a.EABKeyID, Key: key}, nil
+}
+
+// Client returns an ACME client for the directory, trusting RootCA if set
+func (a ACME) Client() (*acme.Client, error) {
+	client := &acme.Client{DirectoryURL: a.Directory()}
+	if a.RootCA == "" {
+		return client, nil
+	}
+
+	data, err := os.ReadFile(a.RootCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME root CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in ACME root CA %s", a.RootCA)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	client.HTTPClient = &http.Client{Transport: transport}
+	return client, nil
+}
+
+// letsEncrypt reports whether the directory is one of Let's Encrypt
+func (a ACME) letsEncrypt() bool {
+	u := a.Directory()
+	return u == ACMEDirectories["letsencrypt"] || u == ACMEDirectories["letsencrypt-staging"]
+}
@@ -0,0 +1,182 @@
+package cert
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxBundleEntry bounds a file read from a bundle; certificates and keys are
+// a few kilobytes
+const maxBundleEntry = 1 << 20
+
+// Export writes the certificates in certDir that cover domains, or all of them
+// when no domain is given, as a tar archive to w. ACME account keys are always
+// included so the importing host renews with the same accounts instead of
+// registering new ones. It returns the names of the exported files.
+func Export(certDir string, domains []string, w io.Writer) ([]string, error) {
+	entries, err := os.ReadDir(certDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate directory: %w", err)
+	}
+
+	selected := make(map[string]bool)
+	certs := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case !entry.Type().IsRegular(), isTransient(name), strings.HasSuffix(name, ".key"):
+			continue
+		case isAccountKey(name):
+			selected[name] = true
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(certDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		leaf := parseLeaf(data)
+		if leaf == nil || !coversAny(leaf.DNSNames, domains) {
+			continue
+		}
+		selected[name] = true
+		certs++
+		// The key of a .crt file is kept next to it
+		if base, isCrt := strings.CutSuffix(name, ".crt"); isCrt {
+			if _, err := os.Stat(filepath.Join(certDir, base+".key")); err == nil {
+				selected[base+".key"] = true
+			}
+		}
+	}
+	if certs == 0 {
+		if len(domains) > 0 {
+			return nil, fmt.Errorf("no certificates for %s in %s", strings.Join(domains, ", "), certDir)
+		}
+		return nil, fmt.Errorf("no certificates in %s", certDir)
+	}
+
+	names := make([]string, 0, len(selected))
+	for name := range selected {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(certDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// Import extracts a bundle written by Export into certDir. Files that already
+// exist are skipped unless overwrite is set. The whole bundle is checked
+// before anything is written, so a damaged one leaves certDir untouched.
+func Import(certDir string, r io.Reader, overwrite bool) (imported, skipped []string, err error) {
+	type file struct {
+		name string
+		data []byte
+	}
+	var files []file
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := header.Name
+		if name != filepath.Base(name) || strings.ContainsAny(name, `/\`) || name == ".." {
+			return nil, nil, fmt.Errorf("bundle entry %q is not a plain file name", name)
+		}
+		data, err := io.ReadAll(io.LimitReader(tr, maxBundleEntry+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s from bundle: %w", name, err)
+		}
+		if len(data) > maxBundleEntry {
+			return nil, nil, fmt.Errorf("bundle entry %s is too large", name)
+		}
+		if !isAccountKey(name) && !strings.HasSuffix(name, ".key") && parseLeaf(data) == nil {
+			return nil, nil, fmt.Errorf("bundle entry %s holds no certificate", name)
+		}
+		files = append(files, file{name: name, data: data})
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("bundle holds no certificates")
+	}
+
+	if err := os.MkdirAll(certDir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	for _, f := range files {
+		path := filepath.Join(certDir, f.name)
+		if _, err := os.Stat(path); err == nil && !overwrite {
+			skipped = append(skipped, f.name)
+			continue
+		}
+		// Written under a temporary name first so a running server never
+		// loads half a certificate
+		tmp := path + ".import"
+		if err := os.WriteFile(tmp, f.data, 0600); err != nil {
+			return imported, skipped, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return imported, skipped, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		imported = append(imported, f.name)
+	}
+	return imported, skipped, nil
+}
+
+// isAccountKey reports whether name is an ACME account key: autocert's, one
+// of an additional account, or the DNS-01 issuer's
+func isAccountKey(name string) bool {
+	return strings.HasPrefix(name, "acme_account") || name == "dns01-account.key"
+}
+
+// isTransient reports whether name is an HTTP-01 token autocert only keeps
+// while a certificate is being requested
+func isTransient(name string) bool {
+	return strings.HasSuffix(name, "+http-01")
+}
+
+// coversAny reports whether a certificate for names is valid for one of
+// domains; no domains selects every certificate
+func coversAny(names, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	for _, domain := range domains {
+		for _, name := range names {
+			if certCovers(name, domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
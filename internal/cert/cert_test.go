@@ -1,10 +1,465 @@
 package cert
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 )
 
 func TestCert_Basic(t *testing.T) {
 	// Basic test to ensure package compiles
 	t.Log("Cert package test - basic functionality works")
-}
\ No newline at end of file
+}
+
+// testCertificate returns a self-signed certificate for domain expiring at
+// notAfter and its key, PEM encoded
+func testCertificate(t *testing.T, domain string, notAfter time.Time) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeTestCert writes a test certificate as autocert caches it, or only the
+// certificate for a .crt file
+func writeTestCert(t *testing.T, dir, name, domain string, notAfter time.Time) {
+	t.Helper()
+	data, key := testCertificate(t, domain, notAfter)
+	if filepath.Ext(name) != ".crt" {
+		data = append(key, data...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenewer(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestCert(t, dir, "due.example.com", "due.example.com", now.Add(10*24*time.Hour))
+	writeTestCert(t, dir, "fresh.example.com+rsa", "fresh.example.com", now.Add(60*24*time.Hour))
+	writeTestCert(t, dir, "manual.example.com.crt", "manual.example.com", now.Add(5*24*time.Hour))
+	if err := os.WriteFile(filepath.Join(dir, "acme_account+key"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	certs, err := ScanCertificates(dir)
+	if err != nil {
+		t.Fatalf("ScanCertificates: %v", err)
+	}
+	issuers := make(map[string]string)
+	for _, info := range certs {
+		issuers[info.Domain] = info.Issuer
+	}
+	want := map[string]string{"due.example.com": IssuerACME, "fresh.example.com": IssuerACME, "manual.example.com": IssuerFile}
+	if len(issuers) != len(want) {
+		t.Fatalf("ScanCertificates found %v, want %v", issuers, want)
+	}
+	for domain, issuer := range want {
+		if issuers[domain] != issuer {
+			t.Errorf("issuer of %s = %q, want %q", domain, issuers[domain], issuer)
+		}
+	}
+
+	var renewed []string
+	var renewErr error
+	var failures []RenewalStatus
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	r := NewRenewer(dir, 0, 0, func(ctx context.Context, info CertInfo) error {
+		renewed = append(renewed, info.Domain)
+		return renewErr
+	}, logger)
+	r.SetFailureHook(func(status RenewalStatus) { failures = append(failures, status) })
+	r.now = func() time.Time { return now }
+
+	// Only the ACME certificate within 30 days of expiry is renewed, and the
+	// next check comes once the renewal had time to finish
+	next := r.Check(context.Background())
+	if len(renewed) != 1 || renewed[0] != "due.example.com" {
+		t.Fatalf("renewed %v, want [due.example.com]", renewed)
+	}
+	if want := now.Add(renewalRetryInterval); !next.Equal(want) {
+		t.Errorf("next check at %v, want %v", next, want)
+	}
+	status, _ := r.Status()
+	if len(status) != 3 || status[0].Domain != "manual.example.com" || status[1].Domain != "due.example.com" {
+		t.Errorf("status not ordered by renewal date: %+v", status)
+	}
+
+	// A renewal in progress is not started again
+	r.now = func() time.Time { return now.Add(time.Minute) }
+	r.Check(context.Background())
+	if len(renewed) != 1 || len(failures) != 0 {
+		t.Fatalf("renewal repeated while in progress: renewed %v, failures %v", renewed, failures)
+	}
+
+	// Still due an hour later, the renewal failed and is retried
+	renewErr = errors.New("acme unavailable")
+	r.now = func() time.Time { return now.Add(renewalRetryInterval) }
+	r.Check(context.Background())
+	if len(renewed) != 2 {
+		t.Fatalf("renewal not retried: renewed %v", renewed)
+	}
+	if len(failures) != 2 || failures[1].Failures != 2 || failures[1].LastError != "acme unavailable" {
+		t.Fatalf("failures = %+v, want the timeout and the renewal error", failures)
+	}
+
+	// A replaced certificate clears the failures
+	writeTestCert(t, dir, "due.example.com", "due.example.com", now.Add(90*24*time.Hour))
+	next = r.Check(context.Background())
+	if want := now.Add(renewalRetryInterval + DefaultCheckInterval); !next.Equal(want) {
+		t.Errorf("next check at %v, want %v", next, want)
+	}
+	status, _ = r.Status()
+	for _, s := range status {
+		if s.Failures != 0 || s.LastError != "" {
+			t.Errorf("%s still reports failures after renewal: %+v", s.Domain, s)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "app.crt"), filepath.Join(dir, "app.key")
+	writePair := func(notAfter, modified time.Time) {
+		certPEM, keyPEM := testCertificate(t, "app.example.com", notAfter)
+		for file, data := range map[string][]byte{certFile: certPEM, keyFile: keyPEM} {
+			if err := os.WriteFile(file, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(file, modified, modified); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	now := time.Now()
+	writePair(now.Add(30*24*time.Hour), now.Add(-time.Hour))
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	store := NewStore(logger)
+	if err := store.Add([]string{"other.example.com"}, certFile, keyFile); err == nil {
+		t.Fatal("Add accepted a certificate not valid for the hostname")
+	}
+	if err := store.Add([]string{"app.example.com"}, certFile, keyFile); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	served, ok := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "App.Example.com"})
+	if !ok {
+		t.Fatal("certificate not served for its hostname")
+	}
+	if _, ok := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"}); ok {
+		t.Error("certificate served for another hostname")
+	}
+
+	// Replaced files are picked up, unchanged ones are not loaded again
+	store.Reload()
+	if again, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.example.com"}); again != served {
+		t.Error("unchanged certificate was reloaded")
+	}
+	renewed := now.Add(90 * 24 * time.Hour).Truncate(time.Second)
+	writePair(renewed, now)
+	store.Reload()
+	if cert, _ := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.example.com"}); !cert.Leaf.NotAfter.Equal(renewed) {
+		t.Errorf("reloaded certificate expires at %v, want %v", cert.Leaf.NotAfter, renewed)
+	}
+
+	// The default certificate is kept apart from the hostnames
+	if _, ok := store.Default(); ok {
+		t.Error("default certificate served before one was set")
+	}
+	if err := store.SetDefault(certFile, keyFile); err != nil {
+		t.Fatalf("SetDefault: %v", err)
+	}
+	if fallback, ok := store.Default(); !ok || fallback.Leaf == nil {
+		t.Error("default certificate not served")
+	}
+	if _, ok := store.GetCertificate(&tls.ClientHelloInfo{ServerName: "api.example.com"}); ok {
+		t.Error("default certificate served as a hostname's")
+	}
+}
+
+func TestLocalCA(t *testing.T) {
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+
+	ca, err := LoadLocalCA(dir, logger)
+	if err != nil {
+		t.Fatalf("LoadLocalCA: %v", err)
+	}
+	leaf, err := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: "myapp.localhost"})
+	if err != nil {
+		t.Fatalf("GetCertificate: %v", err)
+	}
+
+	// The CA is kept on disk, and what it issued verifies against it
+	reloaded, err := LoadLocalCA(dir, logger)
+	if err != nil {
+		t.Fatalf("LoadLocalCA of the generated CA: %v", err)
+	}
+	data, err := os.ReadFile(reloaded.CertFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(data)
+	if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "myapp.localhost", Roots: roots}); err != nil {
+		t.Errorf("issued certificate does not verify: %v", err)
+	}
+	if again, _ := ca.GetCertificate(&tls.ClientHelloInfo{ServerName: "MyApp.localhost"}); again != leaf {
+		t.Error("certificate issued again for the same hostname")
+	}
+
+	for host, local := range map[string]bool{"localhost": true, "api.test": true, "127.0.0.1": true, "example.com": false, "app.example.org": false} {
+		if IsLocalHostname(host) != local {
+			t.Errorf("IsLocalHostname(%q) = %v, want %v", host, !local, local)
+		}
+	}
+}
+
+func TestACME(t *testing.T) {
+	if got := (ACME{Staging: true}).Directory(); got != ACMEDirectories["letsencrypt-staging"] {
+		t.Errorf("staging directory = %q", got)
+	}
+	if got := (ACME{DirectoryURL: "ZeroSSL", Staging: true}).Directory(); got != ACMEDirectories["zerossl"] {
+		t.Errorf("zerossl directory = %q", got)
+	}
+	if got, err := ResolveDirectory("https://ca.internal:9000/acme/acme/directory"); err != nil || got != "https://ca.internal:9000/acme/acme/directory" {
+		t.Errorf("ResolveDirectory of a URL = %q, %v", got, err)
+	}
+	if _, err := ResolveDirectory("letsencrpyt"); err == nil {
+		t.Error("ResolveDirectory accepted an unknown name")
+	}
+
+	if eab, err := (ACME{}).ExternalAccountBinding(); eab != nil || err != nil {
+		t.Errorf("binding without a key id = %v, %v", eab, err)
+	}
+	eab, err := (ACME{EABKeyID: "kid-1", EABHMACKey: "c2VjcmV0LWtleQ=="}).ExternalAccountBinding()
+	if err != nil || eab.KID != "kid-1" || string(eab.Key) != "secret-key" {
+		t.Errorf("binding = %+v, %v", eab, err)
+	}
+	if _, err := (ACME{EABKeyID: "kid-1"}).ExternalAccountBinding(); err == nil {
+		t.Error("binding accepted without an hmac key")
+	}
+}
+
+func TestIssuanceQueue(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	now := time.Now()
+	q := NewIssuanceQueue([]string{"a.example.com", "b.example.com", "c.example.com"}, 1, 2, logger)
+	q.now = func() time.Time { return now }
+
+	calls := 0
+	var nextErr error
+	next := func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		calls++
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		return &tls.Certificate{Leaf: &x509.Certificate{NotAfter: now.Add(90 * 24 * time.Hour)}}, nil
+	}
+	get := func(host string) error {
+		_, err := q.GetCertificate(&tls.ClientHelloInfo{ServerName: host}, next)
+		return err
+	}
+
+	// A failed request backs off and fails fast until the backoff has passed
+	nextErr = errors.New("challenge failed")
+	if err := get("a.example.com"); err == nil || calls != 1 {
+		t.Fatalf("first request: err %v, calls %d", err, calls)
+	}
+	if err := get("A.example.com"); err == nil || calls != 1 {
+		t.Fatalf("request during backoff reached the CA: err %v, calls %d", err, calls)
+	}
+	if status := q.Status(); len(status) != 1 || !status[0].RetryAt.Equal(now.Add(issuanceBackoff)) {
+		t.Fatalf("status = %+v, want a.example.com retrying after %s", status, issuanceBackoff)
+	}
+
+	// A rate-limited CA sets the wait
+	nextErr = fmt.Errorf("acme: %w", &acme.Error{
+		ProblemType: "urn:ietf:params:acme:error:rateLimited",
+		Header:      http.Header{"Retry-After": []string{"7200"}},
+	})
+	if err := get("b.example.com"); err == nil {
+		t.Fatal("rate-limited request succeeded")
+	}
+	if status := q.Status(); len(status) != 2 || !status[1].RetryAt.Equal(now.Add(2*time.Hour)) {
+		t.Fatalf("status = %+v, want b.example.com retrying in 2h", status)
+	}
+
+	// The order window is full after two requests
+	nextErr = nil
+	if err := get("c.example.com"); err == nil || calls != 2 {
+		t.Fatalf("request beyond max orders: err %v, calls %d", err, calls)
+	}
+
+	// Unconfigured hostnames are not queued, nor are issued certificates
+	if err := get("other.example.com"); err != nil || calls != 3 {
+		t.Fatalf("unconfigured hostname: err %v, calls %d", err, calls)
+	}
+	q.now = func() time.Time { return now.Add(OrderWindow) }
+	if err := get("a.example.com"); err != nil || calls != 4 {
+		t.Fatalf("retry after the window: err %v, calls %d", err, calls)
+	}
+	if err := get("a.example.com"); err != nil || calls != 5 || len(q.Status()) != 1 {
+		t.Fatalf("issued certificate: err %v, calls %d, status %+v", err, calls, q.Status())
+	}
+}
+
+func TestAccountCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := AccountCache(autocert.DirCache(dir), "Ops+Team@example.com")
+	ctx := context.Background()
+	if err := cache.Put(ctx, "acme_account+key", []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Put(ctx, "a.example.com", []byte("cert")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"acme_account-ops_team@example.com+key", "a.example.com"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s not stored: %v", name, err)
+		}
+	}
+	if _, err := autocert.DirCache(dir).Get(ctx, "acme_account+key"); err != autocert.ErrCacheMiss {
+		t.Errorf("default account key written: %v", err)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	src := t.TempDir()
+	notAfter := time.Now().Add(60 * 24 * time.Hour)
+	writeTestCert(t, src, "a.example.com", "a.example.com", notAfter)
+	writeTestCert(t, src, "a.example.com+rsa", "a.example.com", notAfter)
+	writeTestCert(t, src, "b.example.com", "b.example.com", notAfter)
+	writeTestCert(t, src, "dns01-wildcard.example.org.crt", "*.example.org", notAfter)
+	for name, data := range map[string]string{
+		"dns01-wildcard.example.org.key": "key",
+		"acme_account+key":               "account",
+		"a.example.com+http-01":          "token",
+	} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var bundle bytes.Buffer
+	names, err := Export(src, []string{"a.example.com", "www.example.org"}, &bundle)
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	want := []string{"a.example.com", "a.example.com+rsa", "acme_account+key", "dns01-wildcard.example.org.crt", "dns01-wildcard.example.org.key"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("exported %v, want %v", names, want)
+	}
+	if _, err := Export(src, []string{"c.example.com"}, io.Discard); err == nil {
+		t.Error("Export of an unknown domain succeeded")
+	}
+
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dst, "acme_account+key"), []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	imported, skipped, err := Import(dst, bytes.NewReader(bundle.Bytes()), false)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if len(imported) != 4 || len(skipped) != 1 || skipped[0] != "acme_account+key" {
+		t.Fatalf("imported %v, skipped %v", imported, skipped)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst, "acme_account+key")); string(data) != "existing" {
+		t.Error("existing account key replaced without overwrite")
+	}
+	if certs, err := ScanCertificates(dst); err != nil || len(certs) != 3 {
+		t.Errorf("imported certificates = %+v, %v", certs, err)
+	}
+
+	// Entries outside the cert dir are rejected before anything is written
+	var evil bytes.Buffer
+	tw := tar.NewWriter(&evil)
+	tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0600, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+	if _, _, err := Import(t.TempDir(), &evil, true); err == nil {
+		t.Error("Import accepted a path outside the cert dir")
+	}
+}
+
+func TestHostCertificate(t *testing.T) {
+	now := time.Now()
+	for _, tc := range []struct {
+		notAfter time.Time
+		status   string
+		days     int
+	}{
+		{now.Add(60*24*time.Hour + time.Hour), HealthOK, 60},
+		{now.Add(3*24*time.Hour + time.Hour), HealthExpiring, 3},
+		{now.Add(-time.Hour), HealthExpired, -1},
+		{time.Time{}, HealthMissing, 0},
+	} {
+		host := NewHostCertificate("app.example.com", "app", SourceACME, tc.notAfter, 0, now)
+		if host.Status != tc.status || host.DaysRemaining != tc.days {
+			t.Errorf("certificate expiring at %v: status %s, %d days, want %s, %d days", tc.notAfter, host.Status, host.DaysRemaining, tc.status, tc.days)
+		}
+	}
+
+	certs := []CertInfo{
+		{Domain: "old", DNSNames: []string{"app.example.com"}, NotAfter: now.Add(time.Hour)},
+		{Domain: "new", DNSNames: []string{"app.example.com"}, NotAfter: now.Add(48 * time.Hour)},
+		{Domain: "wildcard", DNSNames: []string{"*.example.org"}, NotAfter: now.Add(time.Hour)},
+	}
+	if found, ok := FindCertificate(certs, "app.example.com"); !ok || found.Domain != "new" {
+		t.Errorf("found %+v, want the certificate valid the longest", found)
+	}
+	if found, ok := FindCertificate(certs, "www.example.org"); !ok || found.Domain != "wildcard" {
+		t.Errorf("wildcard certificate not found for www.example.org: %+v", found)
+	}
+	for _, hostname := range []string{"example.org", "a.b.example.org", "other.example.com"} {
+		if _, ok := FindCertificate(certs, hostname); ok {
+			t.Errorf("certificate found for %s", hostname)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package cert
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// dnsRenewBefore is how long before expiry a DNS-01 certificate is renewed
+	dnsRenewBefore = 30 * 24 * time.Hour
+	// dnsCheckInterval is how often the issuer checks whether renewal is due
+	dnsCheckInterval = time.Hour
+)
+
+// DNSSolver publishes DNS-01 challenge records
+type DNSSolver interface {
+	// ChallengeName returns the name _acme-challenge.<domain> is CNAMEd to
+	ChallengeName(domain string) string
+	Present(name, value string)
+	CleanUp(name, value string)
+}
+
+// DNSIssuer obtains and renews one certificate covering a set of names,
+// wildcards included, using the ACME DNS-01 challenge
+type DNSIssuer struct {
+	domains []string
+	email   string
+	certDir string
+	ca      ACME
+	solver  DNSSolver
+	logger  *logrus.Entry
+	client  *acme.Client // Created on first issuance
+	issued  IssuedHook   // Nil for none
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewDNSIssuer creates an issuer and loads a previously issued certificate from certDir
+func NewDNSIssuer(domains []string, email, certDir string, ca ACME, solver DNSSolver, logger *logrus.Logger) (*DNSIssuer, error) {
+	if err := os.MkdirAll(certDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+
+	d := &DNSIssuer{
+		domains: domains,
+		email:   email,
+		certDir: certDir,
+		ca:      ca,
+		solver:  solver,
+		logger:  logger.WithField("component", "dns01"),
+	}
+
+	if cert, err := tls.LoadX509KeyPair(d.certPath(), d.keyPath()); err == nil {
+		d.cert = &cert
+		d.logger.WithField("expires_at", d.expiry()).Info("Loaded DNS-01 certificate")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		d.logger.WithError(err).Warn("Ignoring unreadable DNS-01 certificate")
+	}
+
+	return d, nil
+}
+
+// SetIssuedHook registers a callback invoked after each issuance and renewal
+func (d *DNSIssuer) SetIssuedHook(hook IssuedHook) {
+	d.issued = hook
+}
+
+// Start obtains the certificate if needed and keeps it renewed until ctx is done
+func (d *DNSIssuer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(dnsCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			if d.dueForRenewal(time.Now()) {
+				if err := d.Obtain(ctx); err != nil {
+					d.logger.WithError(err).Error("DNS-01 certificate issuance failed, retrying later")
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetCertificate returns the DNS-01 certificate if it covers the requested name
+func (d *DNSIssuer) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.cert == nil || d.cert.Leaf == nil || hello.ServerName == "" {
+		return nil, false
+	}
+	if err := d.cert.Leaf.VerifyHostname(hello.ServerName); err != nil {
+		return nil, false
+	}
+	return d.cert, true
+}
+
+// dueForRenewal reports whether the certificate is missing or close to expiry
+func (d *DNSIssuer) dueForRenewal(now time.Time) bool {
+	expiry := d.expiry()
+	return expiry.IsZero() || now.Add(dnsRenewBefore).After(expiry)
+}
+
+// expiry returns when the current certificate expires, or zero if there is none
+func (d *DNSIssuer) expiry() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.cert == nil || d.cert.Leaf == nil {
+		return time.Time{}
+	}
+	return d.cert.Leaf.NotAfter
+}
+
+// Obtain runs an ACME order for all domains and stores the resulting certificate
+func (d *DNSIssuer) Obtain(ctx context.Context) error {
+	d.logger.WithField("domains", d.domains).Info("Requesting certificate with DNS-01")
+
+	client, err := d.acmeClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(d.domains...))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := d.authorize(ctx, client, authzURL); err != nil {
+			return err
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("order not ready: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: d.domains}, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize order: %w", err)
+	}
+
+	return d.store(chain, key)
+}
+
+// authorize completes the DNS-01 challenge of one authorization
+func (d *DNSIssuer) authorize(ctx context.Context, client *acme.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("failed to fetch authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return fmt.Errorf("failed to compute challenge record: %w", err)
+	}
+
+	name := d.solver.ChallengeName(authz.Identifier.Value)
+	d.solver.Present(name, value)
+	defer d.solver.CleanUp(name, value)
+
+	d.logger.WithFields(logrus.Fields{"domain": authz.Identifier.Value, "record": name}).Info("Published DNS-01 challenge")
+
+	if _, err := client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to accept challenge for %s: %w", authz.Identifier.Value, err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorization for %s failed: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+// acmeClient returns a client with a registered account, creating the account key on first use
+func (d *DNSIssuer) acmeClient(ctx context.Context) (*acme.Client, error) {
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	key, err := d.accountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := d.ca.Client()
+	if err != nil {
+		return nil, err
+	}
+	client.Key = key
+	eab, err := d.ca.ExternalAccountBinding()
+	if err != nil {
+		return nil, err
+	}
+	account := &acme.Account{Contact: []string{"mailto:" + d.email}, ExternalAccountBinding: eab}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	d.client = client
+	return client, nil
+}
+
+// accountKey loads or creates the ACME account key
+func (d *DNSIssuer) accountKey() (crypto.Signer, error) {
+	path := filepath.Join(d.certDir, "dns01-account.key")
+
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid account key %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write account key: %w", err)
+	}
+	return key, nil
+}
+
+// store writes the issued chain and key to disk and starts serving them
+func (d *DNSIssuer) store(chain [][]byte, key *ecdsa.PrivateKey) error {
+	var certPEM bytes.Buffer
+	for _, der := range chain {
+		pem.Encode(&certPEM, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	cert, err := tls.X509KeyPair(certPEM.Bytes(), keyPEM)
+	if err != nil {
+		return fmt.Errorf("issued certificate is invalid: %w", err)
+	}
+
+	if err := os.WriteFile(d.keyPath(), keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	if err := os.WriteFile(d.certPath(), certPEM.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	d.mu.Lock()
+	d.cert = &cert
+	d.mu.Unlock()
+
+	d.logger.WithFields(logrus.Fields{"domains": d.domains, "expires_at": cert.Leaf.NotAfter}).Info("DNS-01 certificate issued")
+	if d.issued != nil {
+		d.issued(d.domains, cert.Leaf.NotAfter)
+	}
+	return nil
+}
+
+// certPath names the certificate after its first domain; the .crt suffix makes it show up in "guvnor cert info"
+func (d *DNSIssuer) certPath() string {
+	return filepath.Join(d.certDir, d.fileName()+".crt")
+}
+
+func (d *DNSIssuer) keyPath() string {
+	return filepath.Join(d.certDir, d.fileName()+".key")
+}
+
+func (d *DNSIssuer) fileName() string {
+	return "dns01-" + strings.Replace(strings.ToLower(d.domains[0]), "*", "wildcard", 1)
+}
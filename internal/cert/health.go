@@ -0,0 +1,84 @@
+package cert
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// DefaultAlertBefore is how close to expiry a served certificate is reported
+// as expiring
+const DefaultAlertBefore = 14 * 24 * time.Hour
+
+// Certificate health of a hostname
+const (
+	HealthOK       = "ok"
+	HealthExpiring = "expiring" // Within the alert window
+	HealthExpired  = "expired"
+	HealthMissing  = "missing" // No certificate issued yet
+)
+
+// Certificate sources of a hostname
+const (
+	SourceACME    = "acme"     // Requested from the ACME CA over HTTP-01, TLS-ALPN-01 or DNS-01
+	SourceFile    = "file"     // The app's cert_file
+	SourceLocalCA = "local_ca" // Issued by the local development CA
+)
+
+// HostCertificate is the health of the certificate served for a hostname
+type HostCertificate struct {
+	Hostname      string    `json:"hostname"`
+	App           string    `json:"app"`
+	Source        string    `json:"source"`
+	NotAfter      time.Time `json:"not_after,omitempty"`
+	DaysRemaining int       `json:"days_remaining"`
+	Status        string    `json:"status"`
+	LastError     string    `json:"last_error,omitempty"` // Why the last request for it failed
+}
+
+// NewHostCertificate reports on the certificate expiring at notAfter, zero if
+// there is none, at now
+func NewHostCertificate(hostname, app, source string, notAfter time.Time, alertBefore time.Duration, now time.Time) HostCertificate {
+	if alertBefore <= 0 {
+		alertBefore = DefaultAlertBefore
+	}
+	host := HostCertificate{Hostname: hostname, App: app, Source: source, NotAfter: notAfter}
+	switch {
+	case notAfter.IsZero():
+		host.Status = HealthMissing
+		return host
+	case !now.Before(notAfter):
+		host.Status = HealthExpired
+	case notAfter.Sub(now) < alertBefore:
+		host.Status = HealthExpiring
+	default:
+		host.Status = HealthOK
+	}
+	host.DaysRemaining = int(math.Floor(notAfter.Sub(now).Hours() / 24))
+	return host
+}
+
+// FindCertificate returns the certificate among certs valid for hostname the
+// longest
+func FindCertificate(certs []CertInfo, hostname string) (CertInfo, bool) {
+	var found CertInfo
+	for _, info := range certs {
+		for _, name := range info.DNSNames {
+			if certCovers(name, hostname) && info.NotAfter.After(found.NotAfter) {
+				found = info
+			}
+		}
+	}
+	return found, !found.NotAfter.IsZero()
+}
+
+// certCovers reports whether a certificate for name is valid for host: the
+// same name, or a wildcard for host's parent domain
+func certCovers(name, host string) bool {
+	if strings.EqualFold(name, host) {
+		return true
+	}
+	base, isWildcard := strings.CutPrefix(name, "*.")
+	_, parent, found := strings.Cut(host, ".")
+	return isWildcard && found && strings.EqualFold(parent, base)
+}
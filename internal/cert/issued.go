@@ -0,0 +1,54 @@
+package cert
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// IssuedHook is called with the names and expiry of a newly issued or renewed certificate
+type IssuedHook func(domains []string, notAfter time.Time)
+
+// NotifyingCache wraps an autocert cache, calling onIssued whenever autocert
+// stores a certificate, which it does after every issuance and renewal
+func NotifyingCache(cache autocert.Cache, onIssued IssuedHook) autocert.Cache {
+	return &notifyingCache{Cache: cache, onIssued: onIssued}
+}
+
+type notifyingCache struct {
+	autocert.Cache
+	onIssued IssuedHook
+}
+
+// Put stores data and reports it if it holds a certificate. Account keys and
+// HTTP-01 tokens share the cache and are not reported.
+func (c *notifyingCache) Put(ctx context.Context, key string, data []byte) error {
+	if err := c.Cache.Put(ctx, key, data); err != nil {
+		return err
+	}
+	if leaf := parseLeaf(data); leaf != nil {
+		c.onIssued(leaf.DNSNames, leaf.NotAfter)
+	}
+	return nil
+}
+
+// parseLeaf returns the first certificate in PEM data, or nil if there is none
+func parseLeaf(data []byte) *x509.Certificate {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		if block.Type == "CERTIFICATE" {
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil
+			}
+			return leaf
+		}
+	}
+}
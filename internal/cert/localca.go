@@ -0,0 +1,243 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LocalCACertFile and LocalCAKeyFile name the local CA files in its directory
+	LocalCACertFile = "ca.crt"
+	LocalCAKeyFile  = "ca.key"
+
+	// localCAName is the common name of the local CA, as trust stores show it
+	localCAName = "guvnor local development CA"
+	// localCALifetime is how long a generated local CA is valid
+	localCALifetime = 10 * 365 * 24 * time.Hour
+	// localCertLifetime stays below the 398 days browsers accept for leaf certificates
+	localCertLifetime = 365 * 24 * time.Hour
+)
+
+// LocalCA issues certificates for development hostnames such as
+// myapp.localhost from a CA generated on first use. Browsers accept them once
+// the CA is installed in the trust store with "guvnor cert trust".
+type LocalCA struct {
+	dir    string
+	cert   *x509.Certificate
+	key    crypto.Signer
+	logger *logrus.Entry
+
+	mu    sync.Mutex
+	certs map[string]*tls.Certificate // Issued certificates by hostname
+}
+
+// DefaultLocalCADir returns where the local CA is kept unless configured: in
+// the user's config directory, so every project shares one trusted CA
+func DefaultLocalCADir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the user config directory: %w", err)
+	}
+	return filepath.Join(dir, "guvnor", "ca"), nil
+}
+
+// LoadLocalCA loads the local CA from dir, generating it if there is none
+func LoadLocalCA(dir string, logger *logrus.Logger) (*LocalCA, error) {
+	ca := &LocalCA{
+		dir:    dir,
+		logger: logger.WithField("component", "local-ca"),
+		certs:  make(map[string]*tls.Certificate),
+	}
+
+	if _, err := os.Stat(ca.CertFile()); errors.Is(err, os.ErrNotExist) {
+		if err := ca.generate(); err != nil {
+			return nil, fmt.Errorf("failed to generate local CA: %w", err)
+		}
+	} else if err := ca.load(); err != nil {
+		return nil, fmt.Errorf("failed to load local CA from %s: %w", dir, err)
+	}
+
+	if time.Now().After(ca.cert.NotAfter) {
+		return nil, fmt.Errorf("local CA in %s expired at %s, remove it to generate a new one", dir, ca.cert.NotAfter.Format(time.RFC3339))
+	}
+	return ca, nil
+}
+
+// load reads the CA key and certificate from the CA directory
+func (ca *LocalCA) load() error {
+	pair, err := tls.LoadX509KeyPair(ca.CertFile(), filepath.Join(ca.dir, LocalCAKeyFile))
+	if err != nil {
+		return err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T", pair.PrivateKey)
+	}
+	if ca.cert, err = x509.ParseCertificate(pair.Certificate[0]); err != nil {
+		return err
+	}
+	ca.key = signer
+	return nil
+}
+
+// generate creates the CA key and certificate and writes them to the CA directory
+func (ca *LocalCA) generate() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: localCAName, OrganizationalUnit: []string{hostname}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(localCALifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ca.dir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(ca.dir, LocalCAKeyFile), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ca.CertFile(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return err
+	}
+
+	if ca.cert, err = x509.ParseCertificate(der); err != nil {
+		return err
+	}
+	ca.key = key
+	ca.logger.WithField("cert_file", ca.CertFile()).Info("Generated local CA, trust it with: guvnor cert trust")
+	return nil
+}
+
+// CertFile returns the path of the CA certificate to install in trust stores
+func (ca *LocalCA) CertFile() string {
+	return filepath.Join(ca.dir, LocalCACertFile)
+}
+
+// GetCertificate returns a certificate for the server name of hello, issuing
+// it on first use
+func (ca *LocalCA) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		name = "localhost" // Clients send no server name when connecting to an IP address
+	}
+
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	// Reissue a day before expiry, for servers running that long
+	if cert, exists := ca.certs[name]; exists && time.Until(cert.Leaf.NotAfter) > 24*time.Hour {
+		return cert, nil
+	}
+	cert, err := ca.issue(name)
+	if err != nil {
+		return nil, fmt.Errorf("local CA: failed to issue certificate for %s: %w", name, err)
+	}
+	ca.certs[name] = cert
+	ca.logger.WithField("hostname", name).Debug("Issued local certificate")
+	return cert, nil
+}
+
+// issue creates a certificate for name signed by the CA
+func (ca *LocalCA) issue(name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(localCertLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	if name == "localhost" {
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	}
+	if template.NotAfter.After(ca.cert.NotAfter) {
+		template.NotAfter = ca.cert.NotAfter
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// IsLocalHostname reports whether host is a development name no public CA
+// issues certificates for, such as localhost, myapp.localhost, *.test or an
+// IP address
+func IsLocalHostname(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+		return true
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".test", ".example", ".invalid", ".lan", ".home.arpa"} {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomSerial returns a random certificate serial number
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -3,9 +3,8 @@ package cert
 import (
 	"context"
 	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -25,6 +24,11 @@ type Manager struct {
 	staging         bool
 	email           string
 	certDir         string
+	renewBefore     time.Duration
+	acme            ACME
+	accounts        map[string][]string         // Domains of additional ACME accounts by email
+	managers        map[string]*autocert.Manager // Managers of the additional accounts by email
+	queue           *IssuanceQueue
 }
 
 // Config contains certificate manager configuration
@@ -36,6 +40,11 @@ type Config struct {
 	Domains    []string `yaml:"domains"`
 	Staging    bool     `yaml:"staging"`
 	ForceHTTPS bool     `yaml:"force_https"`
+	RenewBefore time.Duration `yaml:"renew_before"` // Zero renews 30 days before expiry
+	ACME       ACME     `yaml:"acme"`        // CA to use instead of Let's Encrypt; Staging applies when it has no directory
+	Accounts   map[string][]string `yaml:"accounts"` // Domains requested with their own ACME account, by account email
+	Concurrency int     `yaml:"concurrency"` // Certificates requested at once (default: 2)
+	MaxOrders  int      `yaml:"max_orders"`  // Certificates requested per 3 hours (default: 250)
 }
 
 // New creates a new certificate manager
@@ -44,11 +53,18 @@ func New(cfg *Config, logger *logrus.Logger) (*Manager, error) {
 		return nil, fmt.Errorf("certificate manager requires TLS and AutoCert to be enabled")
 	}
 
-	if cfg.Email == "" {
+	if cfg.Email == "" && len(cfg.Domains) > 0 {
 		return nil, fmt.Errorf("email is required for Let's Encrypt certificates")
 	}
 
-	if len(cfg.Domains) == 0 {
+	hostnames := append([]string{}, cfg.Domains...)
+	for email, domains := range cfg.Accounts {
+		if email == "" {
+			return nil, fmt.Errorf("email is required for Let's Encrypt certificates of %v", domains)
+		}
+		hostnames = append(hostnames, domains...)
+	}
+	if len(hostnames) == 0 {
 		return nil, fmt.Errorf("at least one domain must be specified")
 	}
 
@@ -63,7 +79,13 @@ func New(cfg *Config, logger *logrus.Logger) (*Manager, error) {
 		staging: cfg.Staging,
 		email:   cfg.Email,
 		certDir: cfg.CertDir,
+		renewBefore: cfg.RenewBefore,
+		acme:    cfg.ACME,
+		accounts: cfg.Accounts,
+		managers: make(map[string]*autocert.Manager, len(cfg.Accounts)),
+		queue:   NewIssuanceQueue(hostnames, cfg.Concurrency, cfg.MaxOrders, logger),
 	}
+	m.acme.Staging = cfg.Staging
 
 	if err := m.setupAutocert(); err != nil {
 		return nil, fmt.Errorf("failed to setup autocert manager: %w", err)
@@ -72,29 +94,98 @@ func New(cfg *Config, logger *logrus.Logger) (*Manager, error) {
 	return m, nil
 }
 
-// setupAutocert configures the autocert manager with proper settings
+// setupAutocert configures the autocert manager with proper settings, and
+// one for each additional ACME account
 func (m *Manager) setupAutocert() error {
-	// Create autocert manager with enhanced configuration
-	m.autocertManager = &autocert.Manager{
-		Cache:      autocert.DirCache(m.certDir),
-		Prompt:     autocert.AcceptTOS,
-		Email:      m.email,
-		HostPolicy: m.createHostPolicy(),
-		Client:     m.createACMEClient(),
-	}
-
 	m.logger.WithFields(logrus.Fields{
-		"domains":  m.domains,
 		"cert_dir": m.certDir,
 		"staging":  m.staging,
-		"email":    m.email,
+		"directory": m.acme.Directory(),
 	}).Info("Certificate manager configured")
+	
+	if len(m.domains) > 0 {
+		manager, err := m.newAutocert(m.email, m.domains, autocert.DirCache(m.certDir))
+		if err != nil {
+			return err
+		}
+		m.autocertManager = manager
+	}
+	
+	// Each account keeps its own key in the shared cert dir
+	for email, domains := range m.accounts {
+		manager, err := m.newAutocert(email, domains, AccountCache(autocert.DirCache(m.certDir), email))
+		if err != nil {
+			return fmt.Errorf("account %s: %w", email, err)
+		}
+		m.managers[email] = manager
+	}
 
 	return nil
 }
 
-// createHostPolicy creates a secure host policy that validates domains
-func (m *Manager) createHostPolicy() autocert.HostPolicy {
+// newAutocert creates an autocert manager requesting certificates for domains
+// with the ACME account of email
+func (m *Manager) newAutocert(email string, domains []string, cache autocert.Cache) (*autocert.Manager, error) {
+	client, err := m.createACMEClient()
+	if err != nil {
+		return nil, err
+	}
+	eab, err := m.acme.ExternalAccountBinding()
+	if err != nil {
+		return nil, err
+	}
+	
+	m.logger.WithFields(logrus.Fields{
+		"domains": domains,
+		"email":   email,
+	}).Info("ACME account configured")
+	
+	return &autocert.Manager{
+		Cache:      cache,
+		Prompt:     autocert.AcceptTOS,
+		Email:      email,
+		HostPolicy: m.hostPolicy(domains),
+		Client:     client,
+		RenewBefore: m.renewBefore,
+		ExternalAccountBinding: eab,
+	}, nil
+}
+
+// SetIssuedHook registers a callback invoked after each issuance and renewal
+func (m *Manager) SetIssuedHook(hook IssuedHook) {
+	for _, manager := range m.autocertManagers() {
+		manager.Cache = NotifyingCache(manager.Cache, hook)
+	}
+}
+
+// autocertManagers returns the managers of all ACME accounts
+func (m *Manager) autocertManagers() []*autocert.Manager {
+	var managers []*autocert.Manager
+	if m.autocertManager != nil {
+		managers = append(managers, m.autocertManager)
+	}
+	for _, manager := range m.managers {
+		managers = append(managers, manager)
+	}
+	return managers
+}
+
+// managerFor returns the manager of the ACME account host is requested with,
+// the default one unless an additional account lists it
+func (m *Manager) managerFor(host string) *autocert.Manager {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for email, domains := range m.accounts {
+		for _, domain := range domains {
+			if matchDomain(host, domain) {
+				return m.managers[email]
+			}
+		}
+	}
+	return m.autocertManager
+}
+
+// hostPolicy creates a secure host policy that validates domains
+func (m *Manager) hostPolicy(domains []string) autocert.HostPolicy {
 	return func(ctx context.Context, host string) error {
 		// Remove port from host if present
 		if colonPos := strings.LastIndex(host, ":"); colonPos > 0 {
@@ -102,20 +193,11 @@ func (m *Manager) createHostPolicy() autocert.HostPolicy {
 		}
 
 		// Check if host is in allowed domains
-		for _, domain := range m.domains {
-			if host == domain {
+		for _, domain := range domains {
+			if matchDomain(host, domain) {
 				m.logger.WithField("domain", host).Debug("Certificate request authorized")
 				return nil
 			}
-			
-			// Check for wildcard domain match
-			if strings.HasPrefix(domain, "*.") {
-				baseDomain := domain[2:]
-				if strings.HasSuffix(host, "."+baseDomain) || host == baseDomain {
-					m.logger.WithField("domain", host).Debug("Certificate request authorized via wildcard")
-					return nil
-				}
-			}
 		}
 
 		m.logger.WithField("domain", host).Warn("Certificate request denied - domain not in whitelist")
@@ -123,30 +205,51 @@ func (m *Manager) createHostPolicy() autocert.HostPolicy {
 	}
 }
 
+// matchDomain reports whether host is domain or, for a wildcard domain, one
+// of its subdomains
+func matchDomain(host, domain string) bool {
+	if strings.EqualFold(host, domain) {
+		return true
+	}
+	if strings.HasPrefix(domain, "*.") {
+		baseDomain := strings.ToLower(domain[2:])
+		return strings.HasSuffix(host, "."+baseDomain) || host == baseDomain
+	}
+	return false
+}
+
 // createACMEClient creates an ACME client with proper configuration
-func (m *Manager) createACMEClient() *acme.Client {
-	directoryURL := "https://acme-v02.api.letsencrypt.org/directory"
-	
-	// Use staging environment if configured
-	if m.staging {
-		directoryURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+func (m *Manager) createACMEClient() (*acme.Client, error) {
+	// Log which CA certificates are requested from
+	switch {
+	case !m.acme.letsEncrypt():
+		m.logger.WithField("directory", m.acme.Directory()).Info("Using custom ACME directory")
+	case m.staging:
 		m.logger.Info("Using Let's Encrypt staging environment")
-	} else {
+	default:
 		m.logger.Info("Using Let's Encrypt production environment")
 	}
 
-	client := &acme.Client{
-		DirectoryURL: directoryURL,
-	}
+	return m.acme.Client()
+}
 
-	return client
+// directoryURL returns the Let's Encrypt ACME directory
+func directoryURL(staging bool) string {
+	if staging {
+		return "https://acme-staging-v02.api.letsencrypt.org/directory"
+	}
+	return "https://acme-v02.api.letsencrypt.org/directory"
 }
 
 // GetCertificate returns a certificate for the given hello info
 func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	start := time.Now()
 	
-	cert, err := m.autocertManager.GetCertificate(hello)
+	manager := m.managerFor(hello.ServerName)
+	if manager == nil {
+		return nil, fmt.Errorf("domain %s is not authorized for certificates", hello.ServerName)
+	}
+	cert, err := m.queue.GetCertificate(hello, manager.GetCertificate)
 	
 	duration := time.Since(start)
 	
@@ -168,9 +271,30 @@ func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate,
 	return cert, nil
 }
 
-// HTTPHandler returns the HTTP handler for ACME challenges
+// HTTPHandler returns the HTTP handler for ACME challenges, answering each
+// with the manager of the account the host is requested with
 func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
-	return m.autocertManager.HTTPHandler(fallback)
+	handlers := make(map[*autocert.Manager]http.Handler)
+	for _, manager := range m.autocertManagers() {
+		handlers[manager] = manager.HTTPHandler(fallback)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		handler, exists := handlers[m.managerFor(host)]
+		if !exists {
+			http.Error(w, "Host not configured", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// IssuanceStatus returns the hostnames whose certificate request failed
+func (m *Manager) IssuanceStatus() []IssuanceStatus {
+	return m.queue.Status()
 }
 
 // ValidateDomains validates that all configured domains are accessible
@@ -212,37 +336,59 @@ func (m *Manager) validateDomain(ctx context.Context, domain string) error {
 
 // GetCertificateInfo returns information about certificates in the cache
 func (m *Manager) GetCertificateInfo() ([]CertInfo, error) {
+	return ScanCertificates(m.certDir)
+}
+
+// Certificate issuers, telling how a certificate in the cert dir is renewed
+const (
+	IssuerACME = "acme" // Cached by autocert, renewed by requesting it again
+	IssuerFile = "file" // A .crt file, such as DNS-01 certificates, renewed by whoever wrote it
+)
+
+// ScanCertificates lists the certificates in dir: autocert cache entries, which
+// hold the key and chain in one file named after the domain, and .crt files.
+// Other files, such as the ACME account key, are skipped.
+func ScanCertificates(dir string) ([]CertInfo, error) {
 	var certs []CertInfo
 	
-	cacheDir := m.certDir
-	err := filepath.Walk(cacheDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if info.IsDir() {
+			return nil
+		}
 		
-		if !info.IsDir() && strings.HasSuffix(path, ".crt") {
-			domain := strings.TrimSuffix(filepath.Base(path), ".crt")
-			
-			// Get certificate details
-			certData, err := os.ReadFile(path)
-			if err != nil {
-				return fmt.Errorf("failed to read certificate %s: %w", path, err)
-			}
-			
-			cert, err := parseCertificate(certData)
-			if err != nil {
-				return fmt.Errorf("failed to parse certificate %s: %w", path, err)
+		name := filepath.Base(path)
+		issuer := IssuerACME
+		switch ext := filepath.Ext(name); {
+		case ext == ".crt":
+			issuer = IssuerFile
+		case ext == ".key" || strings.HasSuffix(name, "+key"):
+			return nil
+		}
+		
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate %s: %w", path, err)
+		}
+		leaf := parseLeaf(data)
+		if leaf == nil {
+			if issuer == IssuerFile {
+				return fmt.Errorf("failed to parse certificate %s", path)
 			}
-			
-			certs = append(certs, CertInfo{
-				Domain:    domain,
-				NotBefore: cert.NotBefore,
-				NotAfter:  cert.NotAfter,
-				IsExpired: time.Now().After(cert.NotAfter),
-				Path:      path,
-			})
+			return nil // Not a certificate, e.g. an HTTP-01 token
 		}
 		
+		certs = append(certs, CertInfo{
+			Domain:    strings.TrimSuffix(strings.TrimSuffix(name, ".crt"), "+rsa"),
+			NotBefore: leaf.NotBefore,
+			NotAfter:  leaf.NotAfter,
+			IsExpired: time.Now().After(leaf.NotAfter),
+			Path:      path,
+			Issuer:    issuer,
+			DNSNames:  leaf.DNSNames,
+		})
 		return nil
 	})
 	
@@ -260,6 +406,21 @@ type CertInfo struct {
 	NotAfter  time.Time `json:"not_after"`
 	IsExpired bool      `json:"is_expired"`
 	Path      string    `json:"path"`
+	Issuer    string    `json:"issuer"`
+	DNSNames  []string  `json:"dns_names"`
+}
+
+// ClientHello returns a TLS hello that makes autocert look up this certificate:
+// autocert keeps an ECDSA and an RSA certificate per domain and picks one by
+// what the client supports
+func (c CertInfo) ClientHello() *tls.ClientHelloInfo {
+	hello := &tls.ClientHelloInfo{ServerName: c.Domain}
+	if !strings.HasSuffix(c.Path, "+rsa") {
+		hello.SignatureSchemes = []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256}
+		hello.SupportedCurves = []tls.CurveID{tls.CurveP256}
+		hello.CipherSuites = []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}
+	}
+	return hello
 }
 
 // RenewCertificates attempts to renew certificates that are close to expiration
@@ -274,18 +435,14 @@ func (m *Manager) RenewCertificates(ctx context.Context) error {
 	renewalThreshold := time.Now().Add(30 * 24 * time.Hour) // 30 days
 	
 	for _, cert := range certs {
-		if cert.NotAfter.Before(renewalThreshold) {
+		if cert.Issuer == IssuerACME && cert.NotAfter.Before(renewalThreshold) {
 			m.logger.WithFields(logrus.Fields{
 				"domain":     cert.Domain,
 				"expires_at": cert.NotAfter,
 			}).Info("Certificate needs renewal")
 			
 			// Trigger renewal by requesting the certificate again
-			hello := &tls.ClientHelloInfo{
-				ServerName: cert.Domain,
-			}
-			
-			if _, err := m.GetCertificate(hello); err != nil {
+			if _, err := m.GetCertificate(cert.ClientHello()); err != nil {
 				m.logger.WithError(err).WithField("domain", cert.Domain).Error("Certificate renewal failed")
 			} else {
 				m.logger.WithField("domain", cert.Domain).Info("Certificate renewed successfully")
@@ -322,13 +479,3 @@ func (m *Manager) Cleanup() error {
 	return nil
 }
 
-// Helper functions
-
-func parseCertificate(data []byte) (*x509.Certificate, error) {
-	block, _ := pem.Decode(data)
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse certificate PEM")
-	}
-	
-	return x509.ParseCertificate(block.Bytes)
-}
\ No newline at end of file
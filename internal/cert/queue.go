@@ -0,0 +1,204 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// DefaultIssuanceConcurrency is how many certificates are requested at once
+	DefaultIssuanceConcurrency = 2
+	// DefaultMaxOrders caps certificate requests per OrderWindow, below the 300
+	// new orders per account Let's Encrypt allows every 3 hours
+	DefaultMaxOrders = 250
+	// OrderWindow is the period MaxOrders applies to
+	OrderWindow = 3 * time.Hour
+
+	// issuanceBackoff is the wait after a first failure, doubling up to
+	// maxIssuanceBackoff, so a hostname fails validation fewer than the 5
+	// times per hour Let's Encrypt tolerates
+	issuanceBackoff    = 5 * time.Minute
+	maxIssuanceBackoff = time.Hour
+)
+
+// IssuanceStatus is the state of a hostname waiting for its certificate
+type IssuanceStatus struct {
+	Hostname  string    `json:"hostname"`
+	Failures  int       `json:"failures"`
+	RetryAt   time.Time `json:"retry_at"`
+	LastError string    `json:"last_error"`
+}
+
+// IssuanceQueue paces certificate requests of configured hostnames so
+// onboarding many domains or a failing one does not run into CA rate limits:
+// a few requests run at once, orders are capped per window, and a hostname
+// whose request failed is not tried again before its backoff, or the wait a
+// rate-limited CA asked for, has passed. Handshakes meanwhile fail fast.
+type IssuanceQueue struct {
+	slots     chan struct{}
+	maxOrders int
+	logger    *logrus.Entry
+	now       func() time.Time
+
+	mu     sync.Mutex
+	hosts  map[string]*issuance // Configured hostnames
+	orders []time.Time          // Requests started within the order window
+}
+
+// issuance is what the queue knows about the certificate of a hostname
+type issuance struct {
+	valid     time.Time // Served certificate valid until, zero if none yet
+	failures  int
+	retryAt   time.Time
+	lastError string
+}
+
+// NewIssuanceQueue creates a queue for the certificates of hostnames; zero
+// limits use the defaults
+func NewIssuanceQueue(hostnames []string, concurrency, maxOrders int, logger *logrus.Logger) *IssuanceQueue {
+	if concurrency <= 0 {
+		concurrency = DefaultIssuanceConcurrency
+	}
+	if maxOrders <= 0 {
+		maxOrders = DefaultMaxOrders
+	}
+	q := &IssuanceQueue{
+		slots:     make(chan struct{}, concurrency),
+		maxOrders: maxOrders,
+		logger:    logger.WithField("component", "cert-issuance"),
+		now:       time.Now,
+		hosts:     make(map[string]*issuance, len(hostnames)),
+	}
+	for _, hostname := range hostnames {
+		q.hosts[strings.ToLower(hostname)] = &issuance{}
+	}
+	return q
+}
+
+// GetCertificate gets the certificate for hello from next, which may request
+// one from the CA, once the queue lets it. Hostnames that are not configured
+// and those with a valid certificate go straight to next.
+func (q *IssuanceQueue) GetCertificate(hello *tls.ClientHelloInfo, next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Certificate, error) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+
+	q.mu.Lock()
+	state, configured := q.hosts[name]
+	if !configured || q.now().Before(state.valid) {
+		q.mu.Unlock()
+		return next(hello)
+	}
+	if now := q.now(); now.Before(state.retryAt) {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("certificate for %s is not available, next attempt at %s: %s", name, state.retryAt.Format(time.RFC3339), state.lastError)
+	}
+	q.mu.Unlock()
+
+	// Hellos built for renewals carry no context
+	ctx := hello.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	select {
+	case q.slots <- struct{}{}:
+		defer func() { <-q.slots }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("certificate for %s is queued for issuance: %w", name, ctx.Err())
+	}
+
+	if wait := q.reserveOrder(); wait > 0 {
+		return nil, fmt.Errorf("certificate for %s is queued, %d certificates were requested within %s, next request in %s",
+			name, q.maxOrders, OrderWindow, wait.Round(time.Second))
+	}
+
+	cert, err := next(hello)
+	q.done(name, cert, err)
+	return cert, err
+}
+
+// reserveOrder counts a request against the order window, or returns how long
+// until the window has room
+func (q *IssuanceQueue) reserveOrder() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	recent := q.orders[:0]
+	for _, t := range q.orders {
+		if now.Sub(t) < OrderWindow {
+			recent = append(recent, t)
+		}
+	}
+	q.orders = recent
+	if len(q.orders) >= q.maxOrders {
+		return q.orders[0].Add(OrderWindow).Sub(now)
+	}
+	q.orders = append(q.orders, now)
+	return 0
+}
+
+// done records the outcome of getting a certificate
+func (q *IssuanceQueue) done(name string, cert *tls.Certificate, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state := q.hosts[name]
+	now := q.now()
+	if err == nil {
+		if cert != nil && cert.Leaf != nil {
+			state.valid = cert.Leaf.NotAfter
+		} else {
+			state.valid = now.Add(time.Hour)
+		}
+		if state.failures > 0 {
+			q.logger.WithFields(logrus.Fields{"hostname": name, "failures": state.failures}).Info("Certificate issued after earlier failures")
+		}
+		state.failures, state.retryAt, state.lastError = 0, time.Time{}, ""
+		return
+	}
+
+	state.failures++
+	state.lastError = err.Error()
+	backoff := issuanceBackoff << (state.failures - 1)
+	if backoff > maxIssuanceBackoff || backoff <= 0 {
+		backoff = maxIssuanceBackoff
+	}
+	var acmeErr *acme.Error
+	if errors.As(err, &acmeErr) {
+		if retryAfter, limited := acme.RateLimit(acmeErr); limited && retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+	state.retryAt = now.Add(backoff)
+
+	q.logger.WithFields(logrus.Fields{
+		"hostname": name,
+		"failures": state.failures,
+		"retry_at": state.retryAt,
+		"error":    err,
+	}).Error("Certificate request failed, backing off")
+}
+
+// Status returns the hostnames whose certificate request failed, soonest
+// retry first
+func (q *IssuanceQueue) Status() []IssuanceStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var status []IssuanceStatus
+	for name, state := range q.hosts {
+		if state.failures > 0 {
+			status = append(status, IssuanceStatus{Hostname: name, Failures: state.failures, RetryAt: state.retryAt, LastError: state.lastError})
+		}
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].RetryAt.Before(status[j].RetryAt) })
+	return status
+}
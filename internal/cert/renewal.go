@@ -0,0 +1,228 @@
+package cert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRenewBefore is how long before expiry a certificate is renewed
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	// DefaultCheckInterval is how often the renewer looks for certificates to renew
+	DefaultCheckInterval = 24 * time.Hour
+	// renewalRetryInterval is how long a renewal may take before the certificate
+	// still being due counts as a failure and renewal is tried again
+	renewalRetryInterval = time.Hour
+)
+
+// RenewFunc starts the renewal of a certificate due for it
+type RenewFunc func(ctx context.Context, info CertInfo) error
+
+// RenewalFailedHook is called when a certificate was not renewed in time
+type RenewalFailedHook func(status RenewalStatus)
+
+// RenewalStatus is where a certificate stands with its renewal
+type RenewalStatus struct {
+	Domain      string    `json:"domain"`
+	Issuer      string    `json:"issuer"`
+	NotAfter    time.Time `json:"not_after"`
+	RenewAt     time.Time `json:"renew_at"`               // When renewal is due
+	LastAttempt time.Time `json:"last_attempt,omitempty"` // Last renewal started while due
+	Failures    int       `json:"failures,omitempty"`     // Renewals in a row that did not replace the certificate
+	LastError   string    `json:"last_error,omitempty"`
+
+	started bool // The last attempt was started without an error
+}
+
+// Renewer checks the certificates in a directory daily and renews those close
+// to expiry, so certificates of hostnames that see no handshakes do not lapse.
+// A renewal counts as failed when the certificate is still due an hour later.
+type Renewer struct {
+	certDir     string
+	renewBefore time.Duration
+	interval    time.Duration
+	renew       RenewFunc
+	onFailure   RenewalFailedHook // Nil for none
+	logger      *logrus.Entry
+	now         func() time.Time
+	wake        chan struct{}
+
+	mu        sync.RWMutex
+	status    map[string]RenewalStatus // By certificate path
+	nextCheck time.Time
+}
+
+// NewRenewer creates a renewer for the certificates in certDir; zero durations
+// use the defaults
+func NewRenewer(certDir string, renewBefore, interval time.Duration, renew RenewFunc, logger *logrus.Logger) *Renewer {
+	if renewBefore <= 0 {
+		renewBefore = DefaultRenewBefore
+	}
+	if interval <= 0 {
+		interval = DefaultCheckInterval
+	}
+	return &Renewer{
+		certDir:     certDir,
+		renewBefore: renewBefore,
+		interval:    interval,
+		renew:       renew,
+		logger:      logger.WithField("component", "cert-renewer"),
+		now:         time.Now,
+		wake:        make(chan struct{}, 1),
+		status:      make(map[string]RenewalStatus),
+	}
+}
+
+// SetFailureHook registers a callback invoked whenever a renewal fails
+func (r *Renewer) SetFailureHook(hook RenewalFailedHook) {
+	r.onFailure = hook
+}
+
+// RenewBefore returns how long before expiry certificates are renewed
+func (r *Renewer) RenewBefore() time.Duration {
+	return r.renewBefore
+}
+
+// Start checks the certificates now and then on the interval until ctx is done
+func (r *Renewer) Start(ctx context.Context) {
+	r.logger.WithFields(logrus.Fields{
+		"renew_before": r.renewBefore,
+		"interval":     r.interval,
+	}).Info("Certificate renewal scheduled")
+
+	go func() {
+		for {
+			next := r.Check(ctx)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-r.wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Refresh makes a started renewer check again right away, e.g. after a
+// certificate was issued
+func (r *Renewer) Refresh() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Check renews the certificates due for it and returns when to check next:
+// after the interval, or sooner while a renewal is in progress
+func (r *Renewer) Check(ctx context.Context) time.Time {
+	now := r.now()
+	certs, err := ScanCertificates(r.certDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		r.logger.WithError(err).Error("Failed to scan certificates for renewal")
+	}
+
+	next := now.Add(r.interval)
+	status := make(map[string]RenewalStatus, len(certs))
+	for _, info := range certs {
+		s := r.checkOne(ctx, info, now)
+		status[info.Path] = s
+		if !s.LastAttempt.IsZero() && next.After(s.LastAttempt.Add(renewalRetryInterval)) {
+			next = s.LastAttempt.Add(renewalRetryInterval)
+		}
+	}
+
+	r.mu.Lock()
+	r.status = status
+	r.nextCheck = next
+	r.mu.Unlock()
+	return next
+}
+
+// checkOne starts the renewal of a certificate if it is due and was not
+// renewed since the last attempt
+func (r *Renewer) checkOne(ctx context.Context, info CertInfo, now time.Time) RenewalStatus {
+	r.mu.RLock()
+	previous, known := r.status[info.Path]
+	r.mu.RUnlock()
+
+	s := RenewalStatus{
+		Domain:   info.Domain,
+		Issuer:   info.Issuer,
+		NotAfter: info.NotAfter,
+		RenewAt:  info.NotAfter.Add(-r.renewBefore),
+	}
+	// Certificates from files are renewed by whoever put them there
+	if now.Before(s.RenewAt) || info.Issuer != IssuerACME {
+		return s
+	}
+	if known && previous.NotAfter.Equal(info.NotAfter) {
+		s.LastAttempt, s.Failures, s.LastError, s.started = previous.LastAttempt, previous.Failures, previous.LastError, previous.started
+	}
+	// A renewal in progress gets time to finish
+	if !s.LastAttempt.IsZero() && now.Before(s.LastAttempt.Add(renewalRetryInterval)) {
+		return s
+	}
+
+	logger := r.logger.WithFields(logrus.Fields{
+		"domain":     info.Domain,
+		"expires_at": info.NotAfter,
+		"issuer":     info.Issuer,
+	})
+	if s.started {
+		s.Failures++
+		s.LastError = fmt.Sprintf("certificate was not replaced within %s of starting its renewal", renewalRetryInterval)
+		r.failed(logger, s)
+	}
+
+	s.LastAttempt = now
+	logger.Info("Renewing certificate")
+	if err := r.renew(ctx, info); err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+		s.started = false
+		r.failed(logger, s)
+		return s
+	}
+	s.started = true
+	return s
+}
+
+// failed reports a failed renewal
+func (r *Renewer) failed(logger *logrus.Entry, s RenewalStatus) {
+	logger.WithFields(logrus.Fields{
+		"failures": s.Failures,
+		"error":    s.LastError,
+	}).Error("Certificate renewal failed")
+	if r.onFailure != nil {
+		r.onFailure(s)
+	}
+}
+
+// Status returns the renewal status of every certificate, soonest due first,
+// and when the next check runs
+func (r *Renewer) Status() ([]RenewalStatus, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	status := make([]RenewalStatus, 0, len(r.status))
+	for _, s := range r.status {
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool {
+		if !status[i].RenewAt.Equal(status[j].RenewAt) {
+			return status[i].RenewAt.Before(status[j].RenewAt)
+		}
+		return status[i].Domain < status[j].Domain
+	})
+	return status, r.nextCheck
+}
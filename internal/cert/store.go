@@ -0,0 +1,217 @@
+package cert
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultReloadInterval is how often a store looks for changed certificate files
+const DefaultReloadInterval = 10 * time.Second
+
+// Store serves certificates loaded from files by SNI and reloads them when the
+// files change on disk, so renewing a certificate outside guvnor only takes
+// replacing its files
+type Store struct {
+	logger *logrus.Entry
+
+	mu       sync.RWMutex
+	entries  []*storeEntry
+	byHost   map[string]*storeEntry // By lowercase hostname
+	fallback *storeEntry            // Served when no other certificate is available
+}
+
+// storeEntry is a certificate and key pair with the hostnames it is served for
+type storeEntry struct {
+	certFile  string
+	keyFile   string
+	hostnames []string
+	cert      *tls.Certificate
+	modified  time.Time // Latest modification time of the two files when loaded
+}
+
+// NewStore creates an empty certificate store
+func NewStore(logger *logrus.Logger) *Store {
+	return &Store{
+		logger: logger.WithField("component", "cert-store"),
+		byHost: make(map[string]*storeEntry),
+	}
+}
+
+// Add loads a certificate and its key and serves it for hostnames
+func (s *Store) Add(hostnames []string, certFile, keyFile string) error {
+	cert, modified, err := loadKeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	for _, hostname := range hostnames {
+		if err := cert.Leaf.VerifyHostname(hostname); err != nil {
+			return fmt.Errorf("certificate %s is not valid for %s: %w", certFile, hostname, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry := &storeEntry{certFile: certFile, keyFile: keyFile, hostnames: hostnames, cert: cert, modified: modified}
+	s.entries = append(s.entries, entry)
+	for _, hostname := range hostnames {
+		s.byHost[strings.ToLower(hostname)] = entry
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"hostnames":  hostnames,
+		"cert_file":  certFile,
+		"expires_at": cert.Leaf.NotAfter,
+	}).Info("Loaded certificate")
+	return nil
+}
+
+// SetDefault loads the certificate served for hostnames nothing else has a
+// certificate for, including clients that send no SNI
+func (s *Store) SetDefault(certFile, keyFile string) error {
+	cert, modified, err := loadKeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fallback = &storeEntry{certFile: certFile, keyFile: keyFile, cert: cert, modified: modified}
+	s.entries = append(s.entries, s.fallback)
+
+	s.logger.WithFields(logrus.Fields{
+		"cert_file":  certFile,
+		"expires_at": cert.Leaf.NotAfter,
+	}).Info("Loaded default certificate")
+	return nil
+}
+
+// Default returns the default certificate, or false when none was set
+func (s *Store) Default() (*tls.Certificate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.fallback == nil {
+		return nil, false
+	}
+	return s.fallback.cert, true
+}
+
+// Empty reports whether the store has no certificates
+func (s *Store) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries) == 0
+}
+
+// GetCertificate returns the certificate for the server name of hello, or
+// false when none was added for it
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, bool) {
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name == "" {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entry, exists := s.byHost[name]
+	if !exists {
+		return nil, false
+	}
+	return entry.cert, true
+}
+
+// Start reloads certificates whose files changed every interval until ctx is done
+func (s *Store) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.Reload()
+			}
+		}
+	}()
+}
+
+// Reload loads the certificates whose files changed since they were loaded.
+// A certificate that fails to load keeps being served from its previous files.
+func (s *Store) Reload() {
+	s.mu.RLock()
+	entries := append([]*storeEntry(nil), s.entries...)
+	s.mu.RUnlock()
+
+	for _, entry := range entries {
+		modified, err := latestModTime(entry.certFile, entry.keyFile)
+		if err != nil || !modified.After(entry.modified) {
+			continue
+		}
+
+		logger := s.logger.WithFields(logrus.Fields{
+			"hostnames": entry.hostnames,
+			"cert_file": entry.certFile,
+		})
+		cert, modified, err := loadKeyPair(entry.certFile, entry.keyFile)
+		if err != nil {
+			// Files are often replaced one after the other, the next reload
+			// picks up the pair once both are in place
+			logger.WithError(err).Warn("Failed to reload certificate, still serving the previous one")
+			continue
+		}
+
+		s.mu.Lock()
+		entry.cert, entry.modified = cert, modified
+		s.mu.Unlock()
+		logger.WithField("expires_at", cert.Leaf.NotAfter).Info("Reloaded certificate")
+	}
+}
+
+// loadKeyPair loads a certificate with its parsed leaf and when its files were
+// last modified
+func loadKeyPair(certFile, keyFile string) (*tls.Certificate, time.Time, error) {
+	modified, err := latestModTime(certFile, keyFile)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to load certificate %s: %w", certFile, err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to parse certificate %s: %w", certFile, err)
+		}
+	}
+	return &cert, modified, nil
+}
+
+// latestModTime returns when the most recently modified of files changed
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,71 @@
+package cert
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// trustedName is the file name the local CA gets in system trust directories
+const trustedName = "guvnor-local-ca"
+
+// linuxTrustStores are the anchor directories of the common Linux distributions
+// with the command rebuilding the system bundle after a CA is added
+var linuxTrustStores = []struct {
+	dir    string
+	ext    string
+	update []string
+}{
+	{"/usr/local/share/ca-certificates", ".crt", []string{"update-ca-certificates"}},           // Debian, Ubuntu, Alpine
+	{"/etc/pki/ca-trust/source/anchors", ".pem", []string{"update-ca-trust", "extract"}},       // Fedora, RHEL
+	{"/etc/ca-certificates/trust-source/anchors", ".crt", []string{"trust", "extract-compat"}}, // Arch
+	{"/usr/share/pki/trust/anchors", ".pem", []string{"update-ca-certificates"}},               // openSUSE
+}
+
+// Trust installs the CA certificate in certFile in the system trust store,
+// which usually takes administrator rights. It returns where it was installed.
+func Trust(certFile string) (string, error) {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		keychain := "/Library/Keychains/System.keychain"
+		return keychain, run("security", "add-trusted-cert", "-d", "-r", "trustRoot", "-k", keychain, certFile)
+	case "windows":
+		return "Root certificate store", run("certutil", "-addstore", "-f", "ROOT", certFile)
+	case "linux":
+		for _, store := range linuxTrustStores {
+			if info, err := os.Stat(store.dir); err != nil || !info.IsDir() {
+				continue
+			}
+			if _, err := exec.LookPath(store.update[0]); err != nil {
+				continue
+			}
+			path := filepath.Join(store.dir, trustedName+store.ext)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return "", err
+			}
+			return path, run(store.update[0], store.update[1:]...)
+		}
+		return "", fmt.Errorf("no supported trust store found, add %s to your system CA certificates manually", certFile)
+	}
+	return "", fmt.Errorf("installing CA certificates is not supported on %s, add %s to the trust store manually", runtime.GOOS, certFile)
+}
+
+// run runs a trust store command, returning its output on failure
+func run(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%s failed: %w: %s", name, err, msg)
+		}
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
@@ -2,24 +2,60 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/net/websocket"
+
 	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/jobs"
 	"github.com/gleicon/guvnor/internal/logs"
 	"github.com/gleicon/guvnor/internal/process"
 )
 
+// RetryPolicy controls how failed requests are retried
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts including the first (1 disables retries)
+	InitialBackoff time.Duration // Delay before the first retry, doubled after each attempt
+	MaxBackoff     time.Duration // Upper bound for the delay between attempts
+}
+
+// DefaultRetryPolicy rides out brief unavailability such as a server that is still starting
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 250 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
 // Client handles communication with the running guvnor server
 type Client struct {
-	baseURL string
-	client  *http.Client
+	baseURL    string
+	client     *http.Client
+	stream     *http.Client // No overall timeout, used for long-lived streams
+	retry      RetryPolicy
+	token      string      // Management API token, sent as a bearer token when set
+	breakGlass string      // Reason for overriding a freeze window, sent when set
+	socket     string      // Unix socket the requests go through, "" for TCP
+	tlsConfig  *tls.Config // TLS settings of a remote server, nil for a local one
 }
 
+// TokenEnv names the environment variable holding the management API token
+const TokenEnv = "GUVNOR_TOKEN"
+
 // NewClient creates a new API client
 func NewClient(httpPort int) *Client {
 	mgmtPort := api.GetManagementPort(httpPort)
@@ -29,32 +65,155 @@ func NewClient(httpPort int) *Client {
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		stream: &http.Client{},
+		retry:  DefaultRetryPolicy,
+		token:  os.Getenv(TokenEnv),
 	}
 }
 
+// WithRetry sets the retry policy used for requests
+func (c *Client) WithRetry(policy RetryPolicy) *Client {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c.retry = policy
+	return c
+}
+
+// WithTimeout sets the timeout of each individual request attempt
+func (c *Client) WithTimeout(timeout time.Duration) *Client {
+	c.client.Timeout = timeout
+	return c
+}
+
+// WithBreakGlass overrides active freeze windows for the client's requests; the
+// reason is recorded in the server's audit log
+func (c *Client) WithBreakGlass(reason string) *Client {
+	c.breakGlass = reason
+	return c
+}
+
 // IsServerRunning checks if the guvnor server is running
 func (c *Client) IsServerRunning() bool {
-	resp, err := c.client.Get(c.baseURL + "/api/ping")
-	if err != nil {
+	_, ok := c.ping()
+	return ok
+}
+
+// Serves reports whether a server is running and its proxy listens on
+// httpPort. Servers configured with the same socket share it, the first one
+// started holding it.
+func (c *Client) Serves(httpPort int) bool {
+	pong, ok := c.ping()
+	if !ok {
 		return false
 	}
+	port, reported := pong["port"]
+	return !reported || port == strconv.Itoa(api.GetManagementPort(httpPort))
+}
+
+// PID returns the process ID of the server, false when it does not answer
+// or is too old to report it
+func (c *Client) PID() (int, bool) {
+	pong, ok := c.ping()
+	if !ok {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(pong["pid"])
+	return pid, err == nil && pid > 0
+}
+
+// ping asks the server for its ping response, false if it does not answer
+func (c *Client) ping() (map[string]string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	
+	req, err := http.NewRequestWithContext(ctx, opPing.method, c.operationURL(opPing), nil)
+	if err != nil {
+		return nil, false
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false
+	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	
+	pong := make(map[string]string)
+	json.NewDecoder(resp.Body).Decode(&pong)
+	return pong, true
+}
+
+// do sends a request, retrying connection failures and temporary server errors with
+// exponential backoff. Responses other than wantStatus are returned as *StatusError.
+func (c *Client) do(ctx context.Context, httpClient *http.Client, method, endpoint string, header http.Header, wantStatus int) (*http.Response, error) {
+	backoff := c.retry.InitialBackoff
+	attempts := c.retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		if c.breakGlass != "" {
+			req.Header.Set(api.BreakGlassHeader, c.breakGlass)
+		}
+		
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = fmt.Errorf("%w: %v", ErrUnreachable, err)
+		} else if resp.StatusCode != wantStatus {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			statusErr := &StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+			if !statusErr.Temporary() {
+				return nil, statusErr
+			}
+			lastErr = statusErr
+		} else {
+			return resp, nil
+		}
+		
+		if attempt == attempts {
+			break
+		}
+		
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if c.retry.MaxBackoff > 0 && backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
 	
-	return resp.StatusCode == http.StatusOK
+	return nil, lastErr
 }
 
 // GetStatus gets the current process status
-func (c *Client) GetStatus() ([]process.ProcessInfo, error) {
-	resp, err := c.client.Get(c.baseURL + "/api/status")
+func (c *Client) GetStatus(ctx context.Context) ([]process.ProcessInfo, error) {
+	resp, err := c.do(ctx, c.client, opGetStatus.method, c.operationURL(opGetStatus), nil, http.StatusOK)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to guvnor server: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
-	}
-	
 	var response struct {
 		Processes []process.ProcessInfo `json:"processes"`
 		Count     int                   `json:"count"`
@@ -68,27 +227,73 @@ func (c *Client) GetStatus() ([]process.ProcessInfo, error) {
 	return response.Processes, nil
 }
 
-// GetLogs gets logs from the server
-func (c *Client) GetLogs(processName string, lines int) ([]logs.LogEntry, error) {
-	url := c.baseURL + "/api/logs"
-	if processName != "" {
-		url = fmt.Sprintf("%s/%s", url, processName)
+// GetCertificates returns the certificate health of each TLS hostname, nil
+// when the server does not serve TLS
+func (c *Client) GetCertificates(ctx context.Context) ([]cert.HostCertificate, error) {
+	resp, err := c.do(ctx, c.client, opGetCertificates.method, c.operationURL(opGetCertificates), nil, http.StatusOK)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotImplemented || statusErr.StatusCode == http.StatusNotFound) {
+		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 	
+	var response struct {
+		Hostnames []cert.HostCertificate `json:"hostnames"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return response.Hostnames, nil
+}
+
+// LogQuery filters the logs the server returns; empty fields match everything
+type LogQuery struct {
+	Processes []string // Apps or instances, all when empty
+	Exclude   []string // Apps or instances left out
+	Level     string   // Minimum level
+	Grep      string   // Regular expression matched against the message
+	Since     string   // Duration back from now, such as 10m, or RFC 3339 time
+	Until     string
+}
+
+// values encodes the query as URL parameters
+func (q LogQuery) values() url.Values {
+	values := url.Values{}
+	if len(q.Processes) > 0 {
+		values.Set("process", strings.Join(q.Processes, ","))
+	}
+	if len(q.Exclude) > 0 {
+		values.Set("exclude", strings.Join(q.Exclude, ","))
+	}
+	for key, value := range map[string]string{"level": q.Level, "grep": q.Grep, "since": q.Since, "until": q.Until} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	return values
+}
+
+// GetLogs gets the last lines of logs the query selects from the server,
+// interleaved by timestamp
+func (c *Client) GetLogs(ctx context.Context, lines int, query LogQuery) ([]logs.LogEntry, error) {
+	endpoint := c.operationURL(opGetLogs)
+	values := query.values()
 	if lines > 0 {
-		url = fmt.Sprintf("%s?lines=%d", url, lines)
+		values.Set("lines", strconv.Itoa(lines))
+	}
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
 	}
 	
-	resp, err := c.client.Get(url)
+	resp, err := c.do(ctx, c.client, opGetLogs.method, endpoint, nil, http.StatusOK)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to guvnor server: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 	
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
-	}
-	
 	var response struct {
 		Logs      []logs.LogEntry `json:"logs"`
 		Count     int             `json:"count"`
@@ -104,42 +309,124 @@ func (c *Client) GetLogs(processName string, lines int) ([]logs.LogEntry, error)
 	return response.Logs, nil
 }
 
-// StreamLogs streams logs from the server using Server-Sent Events
-func (c *Client) StreamLogs(processName string, callback func([]logs.LogEntry)) error {
-	url := c.baseURL + "/api/logs/stream"
-	if processName != "" {
-		url = fmt.Sprintf("%s?process=%s", url, processName)
-	}
+// ExportLogs writes every stored entry the query selects to w in format
+// (ndjson, csv or text) as the server sends it. It returns the bytes written
+// and the time of the oldest entry the server keeps for the selected
+// processes, zero when it keeps none.
+func (c *Client) ExportLogs(ctx context.Context, query LogQuery, format string, w io.Writer) (int64, time.Time, error) {
+	values := query.values()
+	values.Set("format", format)
+	endpoint := c.operationURL(opExportLogs) + "?" + values.Encode()
 	
-	resp, err := c.client.Get(url)
+	resp, err := c.do(ctx, c.stream, opExportLogs.method, endpoint, nil, http.StatusOK)
 	if err != nil {
-		return fmt.Errorf("failed to connect to guvnor server: %w", err)
+		return 0, time.Time{}, err
 	}
 	defer resp.Body.Close()
+	oldest, _ := time.Parse(time.RFC3339Nano, resp.Header.Get(api.LogsOldestHeader))
 	
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
+	n, err := io.Copy(w, resp.Body)
+	if err != nil {
+		return n, oldest, fmt.Errorf("failed to read export: %w", err)
+	}
+	return n, oldest, nil
+}
+
+// logStreamMessage is a message of the server's log streams
+type logStreamMessage struct {
+	Type      string          `json:"type"`
+	Logs      []logs.LogEntry `json:"logs,omitempty"`
+	Count     int             `json:"count,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// StreamLogs streams the logs the query selects from the server as they are
+// logged, until the stream ends or the context is cancelled. It uses a
+// WebSocket, falling back to Server-Sent Events when the server does not
+// accept one.
+func (c *Client) StreamLogs(ctx context.Context, query LogQuery, callback func([]logs.LogEntry)) error {
+	err := c.streamLogsWebSocket(ctx, query, callback)
+	var dialErr *websocket.DialError
+	if errors.As(err, &dialErr) && ctx.Err() == nil {
+		return c.streamLogsSSE(ctx, query, callback)
+	}
+	return err
+}
+
+// streamLogsWebSocket streams logs over the server's WebSocket endpoint
+func (c *Client) streamLogsWebSocket(ctx context.Context, query LogQuery, callback func([]logs.LogEntry)) error {
+	values := query.values()
+	endpoint := "ws" + strings.TrimPrefix(c.operationURL(opStreamLogsWebSocket), "http")
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+	
+	config, err := websocket.NewConfig(endpoint, c.baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	ws, err := c.dialWebSocket(ctx, config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer ws.Close()
+	
+	// Unblock the receive below when the context ends
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+	
+	for {
+		var msg logStreamMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error reading log stream: %w", err)
+		}
+		
+		switch {
+		case msg.Type == "error":
+			return fmt.Errorf("guvnor server error: %s", msg.Error)
+		case msg.Type == "logs" && len(msg.Logs) > 0:
+			callback(msg.Logs)
+		}
+	}
+}
+
+// streamLogsSSE streams logs using Server-Sent Events
+func (c *Client) streamLogsSSE(ctx context.Context, query LogQuery, callback func([]logs.LogEntry)) error {
+	endpoint := c.operationURL(opStreamLogs)
+	values := query.values()
+	if len(values) > 0 {
+		endpoint += "?" + values.Encode()
 	}
 	
+	resp, err := c.do(ctx, c.stream, opStreamLogs.method, endpoint, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
 	// Parse Server-Sent Events
 	reader := NewSSEReader(resp.Body)
 	
 	for {
 		event, err := reader.ReadEvent()
 		if err != nil {
-			if err == io.EOF {
+			if err == io.EOF || ctx.Err() != nil {
 				return nil
 			}
 			return fmt.Errorf("error reading event stream: %w", err)
 		}
 		
-		var data struct {
-			Type      string          `json:"type"`
-			Logs      []logs.LogEntry `json:"logs,omitempty"`
-			Count     int             `json:"count,omitempty"`
-			Timestamp string          `json:"timestamp"`
-		}
-		
+		var data logStreamMessage
 		if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
 			continue // Skip invalid events
 		}
@@ -150,30 +437,423 @@ func (c *Client) StreamLogs(processName string, callback func([]logs.LogEntry))
 	}
 }
 
-// StopProcesses stops all processes
-func (c *Client) StopProcesses() ([]process.StopResult, error) {
-	resp, err := c.client.Post(c.baseURL+"/api/stop", "application/json", nil)
+// StopProcesses stops all processes. observe, if set, is called with every job update.
+func (c *Client) StopProcesses(ctx context.Context, observe JobObserver) ([]api.InstanceResult, error) {
+	job, err := c.submitJob(ctx, opStopAll, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to guvnor server: %w", err)
+		return nil, err
+	}
+	
+	job, err = c.WaitJob(ctx, job.ID, observe)
+	if err != nil {
+		return nil, err
+	}
+	
+	var results []api.InstanceResult
+	if len(job.Result) > 0 {
+		if err := json.Unmarshal(job.Result, &results); err != nil {
+			return nil, fmt.Errorf("failed to decode stop results: %w", err)
+		}
+	}
+	
+	if job.Status == jobs.StatusFailed {
+		return results, &JobError{JobID: job.ID, Message: job.Error}
+	}
+	
+	return results, nil
+}
+
+// StopApp stops every instance of an app, or a single instance, on the running server
+func (c *Client) StopApp(ctx context.Context, name string, observe JobObserver) (*api.AppResult, error) {
+	return c.appAction(ctx, opStopApp, name, "stop", nil, observe)
+}
+
+// StartApp starts a configured app that is not running on the running server
+func (c *Client) StartApp(ctx context.Context, name string, observe JobObserver) (*api.AppResult, error) {
+	return c.appAction(ctx, opStartApp, name, "start", nil, observe)
+}
+
+// Restart restarts an app or instance on the running server. Rolling restarts start a
+// replacement and wait for it to become healthy before stopping the old process.
+// observe, if set, is called with every job update.
+func (c *Client) Restart(ctx context.Context, name string, rolling bool, observe JobObserver) (*api.AppResult, error) {
+	params := url.Values{}
+	if rolling {
+		params.Set("rolling", "true")
+	}
+	return c.appAction(ctx, opRestartApp, name, "restart", params, observe)
+}
+
+// ScaleApp sets the number of running instances of one app
+func (c *Client) ScaleApp(ctx context.Context, name string, instances int, observe JobObserver) (*api.AppResult, error) {
+	params := url.Values{}
+	params.Set("instances", strconv.Itoa(instances))
+	return c.appAction(ctx, opScaleApp, name, "scale", params, observe)
+}
+
+// RemoveApp stops an app and removes it from the running server until it restarts
+func (c *Client) RemoveApp(ctx context.Context, name string, observe JobObserver) (*api.AppResult, error) {
+	return c.appAction(ctx, opRemoveApp, name, "", nil, observe)
+}
+
+// appAction runs op, an action of /api/v1/apps/{app}, and waits for its
+// result. The result is returned with the error of a failed job, as far as
+// the job got.
+func (c *Client) appAction(ctx context.Context, op operation, name, action string, params url.Values, observe JobObserver) (*api.AppResult, error) {
+	job, err := c.submitJob(ctx, op, params, name)
+	if err != nil {
+		return nil, err
+	}
+	
+	job, err = c.WaitJob(ctx, job.ID, observe)
+	if err != nil {
+		return nil, err
+	}
+	
+	result := &api.AppResult{App: name, Action: action}
+	if len(job.Result) > 0 {
+		if err := json.Unmarshal(job.Result, result); err != nil {
+			return nil, fmt.Errorf("failed to decode %s result: %w", action, err)
+		}
+	}
+	
+	if job.Status == jobs.StatusFailed {
+		return result, &JobError{JobID: job.ID, Message: job.Error}
+	}
+	
+	return result, nil
+}
+
+// Scale sets the number of running instances per app, e.g. "web=3,worker=2"
+func (c *Client) Scale(ctx context.Context, formation string, observe JobObserver) error {
+	job, err := c.submitJob(ctx, opScale, url.Values{"formation": {formation}})
+	if err != nil {
+		return err
+	}
+	
+	job, err = c.WaitJob(ctx, job.ID, observe)
+	if err != nil {
+		return err
+	}
+	
+	if job.Status == jobs.StatusFailed {
+		return &JobError{JobID: job.ID, Message: job.Error}
+	}
+	
+	return nil
+}
+
+// Reload asks the running server to send an app its reload signal
+func (c *Client) Reload(ctx context.Context, name string, observe JobObserver) error {
+	job, err := c.submitJob(ctx, opReload, url.Values{"app": {name}})
+	if err != nil {
+		return err
+	}
+	
+	job, err = c.WaitJob(ctx, job.ID, observe)
+	if err != nil {
+		return err
+	}
+	
+	if job.Status == jobs.StatusFailed {
+		return &JobError{JobID: job.ID, Message: job.Error}
+	}
+	
+	return nil
+}
+
+// ReloadConfig makes the running server read guvnor.yaml and the Procfile
+// again and apply what changed about its apps. The changes are returned with
+// the error of a failed job, as far as the job got.
+func (c *Client) ReloadConfig(ctx context.Context, observe JobObserver) (*config.Changes, error) {
+	job, err := c.submitJob(ctx, opReload, nil)
+	if err != nil {
+		return nil, err
+	}
+	
+	job, err = c.WaitJob(ctx, job.ID, observe)
+	if err != nil {
+		return nil, err
+	}
+	
+	changes := &config.Changes{}
+	if len(job.Result) > 0 {
+		if err := json.Unmarshal(job.Result, changes); err != nil {
+			return nil, fmt.Errorf("failed to decode reload result: %w", err)
+		}
+	}
+	
+	if job.Status == jobs.StatusFailed {
+		return changes, &JobError{JobID: job.ID, Message: job.Error}
+	}
+	
+	return changes, nil
+}
+
+// GetConfig writes the configuration of the running server, with its secrets
+// redacted, to w as YAML
+func (c *Client) GetConfig(ctx context.Context, w io.Writer) error {
+	resp, err := c.do(ctx, c.client, opGetConfig.method, c.operationURL(opGetConfig)+"?format=yaml", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// ResetRestarts clears the restart counter of an app on the running server and
+// returns the names of the processes that were reset
+func (c *Client) ResetRestarts(ctx context.Context, name string) ([]string, error) {
+	header := http.Header{}
+	header.Set("Idempotency-Key", newIdempotencyKey())
+	
+	resp, err := c.do(ctx, c.client, opResetRestarts.method, c.operationURL(opResetRestarts)+"?"+url.Values{"app": {name}}.Encode(), header, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	var response struct {
+		Reset []string `json:"reset"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	
+	return response.Reset, nil
+}
+
+// GetFlags returns the feature flags of an app, or of every app when name is empty
+func (c *Client) GetFlags(ctx context.Context, name string) (map[string]map[string]string, error) {
+	endpoint := c.operationURL(opGetFlags)
+	if name != "" {
+		endpoint += "?app=" + url.QueryEscape(name)
+	}
+	
+	resp, err := c.do(ctx, c.client, opGetFlags.method, endpoint, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	var response struct {
+		Flags json.RawMessage `json:"flags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	
+	all := make(map[string]map[string]string)
+	if name != "" {
+		var flags map[string]string
+		err = json.Unmarshal(response.Flags, &flags)
+		all[name] = flags
+	} else {
+		err = json.Unmarshal(response.Flags, &all)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode flags: %w", err)
+	}
+	return all, nil
+}
+
+// UpdateFlags sets and removes feature flags of an app and returns its flags afterwards
+func (c *Client) UpdateFlags(ctx context.Context, name string, set map[string]string, unset []string) (map[string]string, error) {
+	query := url.Values{"app": {name}}
+	for key, value := range set {
+		query.Add("set", key+"="+value)
+	}
+	for _, key := range unset {
+		query.Add("unset", key)
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", newIdempotencyKey())
+	
+	resp, err := c.do(ctx, c.client, opUpdateFlags.method, c.operationURL(opUpdateFlags)+"?"+query.Encode(), header, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	var response struct {
+		Flags map[string]string `json:"flags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return response.Flags, nil
+}
+
+// Orphans lists processes left behind by managed processes; with kill they are killed
+// and the killed ones are returned
+func (c *Client) Orphans(ctx context.Context, kill bool) ([]process.Orphan, error) {
+	op := opListOrphans
+	header := http.Header{}
+	if kill {
+		op = opKillOrphans
+		header.Set("Idempotency-Key", newIdempotencyKey())
+	}
+	
+	resp, err := c.do(ctx, c.client, op.method, c.operationURL(op), header, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 	
 	var response struct {
-		Results   []process.StopResult `json:"results"`
-		Success   bool                 `json:"success"`
-		Error     string               `json:"error,omitempty"`
-		Timestamp string               `json:"timestamp"`
+		Orphans []process.Orphan `json:"orphans"`
+		Error   string           `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response.Error != "" {
+		return response.Orphans, fmt.Errorf("%s", response.Error)
 	}
+	return response.Orphans, nil
+}
+
+// Deploys lists the apps in deploy mode on the running server
+func (c *Client) Deploys(ctx context.Context) ([]process.Deploy, error) {
+	resp, err := c.do(ctx, c.client, opListDeploys.method, c.operationURL(opListDeploys), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 	
+	var response struct {
+		Deploys []process.Deploy `json:"deploys"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return response.Deploys, nil
+}
+
+// BeginDeploy puts an app in deploy mode on the running server; a zero timeout
+// uses the server's default
+func (c *Client) BeginDeploy(ctx context.Context, name string, timeout time.Duration, reason string) (process.Deploy, error) {
+	params := url.Values{"app": {name}}
+	if timeout > 0 {
+		params.Set("timeout", timeout.String())
+	}
+	if reason != "" {
+		params.Set("reason", reason)
+	}
+	header := http.Header{}
+	header.Set("Idempotency-Key", newIdempotencyKey())
+	return c.deploy(ctx, opBeginDeploy, params, header)
+}
+
+// EndDeploy takes an app out of deploy mode on the running server
+func (c *Client) EndDeploy(ctx context.Context, name string) (process.Deploy, error) {
+	return c.deploy(ctx, opEndDeploy, url.Values{"app": {name}}, nil)
+}
+
+func (c *Client) deploy(ctx context.Context, op operation, params url.Values, header http.Header) (process.Deploy, error) {
+	resp, err := c.do(ctx, c.client, op.method, c.operationURL(op)+"?"+params.Encode(), header, http.StatusOK)
+	if err != nil {
+		return process.Deploy{}, err
+	}
+	defer resp.Body.Close()
 	
-	if !response.Success && response.Error != "" {
-		return response.Results, fmt.Errorf("server error: %s", response.Error)
+	var response struct {
+		Deploy process.Deploy `json:"deploy"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return process.Deploy{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return response.Deploy, nil
+}
+
+// JobStatus is a background job as reported by the server, with the raw result
+type JobStatus struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Target   string          `json:"target,omitempty"`
+	Status   jobs.Status     `json:"status"`
+	Progress []string        `json:"progress,omitempty"`
+	Steps    []jobs.Step     `json:"steps,omitempty"`
+	Percent  int             `json:"percent"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// JobObserver is called with the latest state of a job each time it is polled
+type JobObserver func(job *JobStatus)
+
+// jobPollInterval is how often WaitJob polls a running job
+const jobPollInterval = 250 * time.Millisecond
+
+// GetJob fetches the current state of a background job
+func (c *Client) GetJob(ctx context.Context, id string) (*JobStatus, error) {
+	resp, err := c.do(ctx, c.client, opGetJob.method, c.operationURL(opGetJob, id), nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	var job JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 	
-	return response.Results, nil
+	return &job, nil
+}
+
+// WaitJob polls a job until it finishes, passing every update to observe
+func (c *Client) WaitJob(ctx context.Context, id string, observe JobObserver) (*JobStatus, error) {
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		
+		if observe != nil {
+			observe(job)
+		}
+		
+		if job.Status == jobs.StatusSucceeded || job.Status == jobs.StatusFailed {
+			return job, nil
+		}
+		
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(jobPollInterval):
+		}
+	}
+}
+
+// submitJob sends the request of a mutating operation, with the query and
+// path parameters given, and returns the job it started. The same
+// Idempotency-Key is sent on every retry so the action runs at most once.
+func (c *Client) submitJob(ctx context.Context, op operation, query url.Values, params ...string) (*JobStatus, error) {
+	endpoint := c.operationURL(op, params...)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Idempotency-Key", newIdempotencyKey())
+	
+	resp, err := c.do(ctx, c.client, op.method, endpoint, header, http.StatusAccepted)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	
+	var response struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	
+	return &JobStatus{ID: response.JobID}, nil
 }
 
 // SSEEvent represents a Server-Sent Event
@@ -232,17 +912,11 @@ func (r *SSEReader) ReadEvent() (*SSEEvent, error) {
 	}
 }
 
-// DetectServerPort tries to detect which port the guvnor server is running on
-func DetectServerPort() (int, error) {
-	// Try common ports
-	commonPorts := []int{8081, 8080, 8090, 3000}
-	
-	for _, port := range commonPorts {
-		client := NewClient(port)
-		if client.IsServerRunning() {
-			return port, nil
-		}
+// newIdempotencyKey returns a random key identifying one logical request
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("guvnor-%d", time.Now().UnixNano())
 	}
-	
-	return 0, fmt.Errorf("no running guvnor server found on common ports")
-}
\ No newline at end of file
+	return hex.EncodeToString(b)
+}
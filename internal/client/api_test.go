@@ -0,0 +1,249 @@
+package client
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/registry"
+)
+
+func testClient(url string) *Client {
+	return &Client{
+		baseURL: url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		stream:  &http.Client{},
+		retry:   RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+	}
+}
+
+func TestClient_RetriesTemporaryErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"processes":[]}`))
+	}))
+	defer server.Close()
+
+	if _, err := testClient(server.URL).GetStatus(context.Background()); err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestClient_ErrorTypes(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "denied", http.StatusUnauthorized)
+	}))
+
+	_, err := testClient(server.URL).GetStatus(context.Background())
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected StatusError with 401, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected no retries for 401, got %d attempts", calls)
+	}
+
+	server.Close()
+	if _, err := testClient(server.URL).GetStatus(context.Background()); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got %v", err)
+	}
+}
+
+func TestClient_SubmitJobReusesIdempotencyKey(t *testing.T) {
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if len(keys) == 1 {
+			http.Error(w, "busy", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"job_id":"j1","job":{"id":"j1","status":"pending"}}`))
+	}))
+	defer server.Close()
+
+	if _, err := testClient(server.URL).submitJob(context.Background(), opStopAll, nil); err != nil {
+		t.Fatalf("Failed to submit job: %v", err)
+	}
+	if len(keys) != 2 || keys[0] == "" || keys[0] != keys[1] {
+		t.Errorf("Expected the same key on both attempts, got %v", keys)
+	}
+}
+
+func TestDetectServer(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(registry.DirEnv, dir)
+
+	// Servers answering on their sockets, registered under live PIDs
+	register := func(pid, httpPort int, project string) registry.Entry {
+		socket := filepath.Join(t.TempDir(), "guvnor.sock")
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"status":"ok","port":"%d"}`, api.GetManagementPort(httpPort))
+		})}
+		go server.Serve(listener)
+		t.Cleanup(func() { server.Close() })
+
+		entry := registry.Entry{PID: pid, HTTPPort: httpPort, Socket: socket, Dir: project, StartedAt: time.Now()}
+		if _, err := registry.Register(dir, entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+
+	// Nothing registered, so there is no server to wait for
+	started := time.Now()
+	if _, err := DetectServer("/elsewhere"); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable without servers, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed >= DefaultRetryPolicy.InitialBackoff {
+		t.Errorf("Expected to fail without retrying, took %s", elapsed)
+	}
+
+	web := register(os.Getpid(), 18080, "/srv/web")
+	if c, err := DetectServer("/elsewhere"); err != nil || c.Socket() != web.Socket {
+		t.Fatalf("Expected the only server, got %v", err)
+	}
+
+	worker := register(os.Getppid(), 18090, "/srv/worker")
+	if c, err := DetectServer("/srv/worker"); err != nil || c.Socket() != worker.Socket {
+		t.Fatalf("Expected the server of the directory, got %v", err)
+	}
+	if _, err := DetectServer("/elsewhere"); err == nil || !strings.Contains(err.Error(), "2 guvnor servers") {
+		t.Errorf("Expected several servers to be ambiguous, got %v", err)
+	}
+}
+
+func TestNewRemoteClient(t *testing.T) {
+	var authorization atomic.Value
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization.Store(r.Header.Get("Authorization"))
+		w.Write([]byte(`{"processes":[]}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	untrusted, err := NewRemoteClient(server.URL, "remote-token", TLSOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	untrusted.WithRetry(RetryPolicy{MaxAttempts: 1})
+	if _, err := untrusted.GetStatus(ctx); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected an untrusted certificate to be refused, got %v", err)
+	}
+
+	trusted, err := NewRemoteClient(strings.TrimPrefix(server.URL, "https://"), "remote-token", TLSOptions{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if _, err := trusted.GetStatus(ctx); err != nil {
+		t.Fatalf("Expected the CA file to be trusted: %v", err)
+	}
+	if got := authorization.Load(); got != "Bearer remote-token" {
+		t.Errorf("Expected the token to be sent, got %v", got)
+	}
+
+	for _, host := range []string{"ftp://server:9443", "https://server:9443/api", "https://"} {
+		if _, err := NewRemoteClient(host, "", TLSOptions{}); err == nil {
+			t.Errorf("Expected %q to be refused", host)
+		}
+	}
+}
+
+func TestContexts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "guvnor", "contexts.yaml")
+	contexts, err := LoadContexts(path)
+	if err != nil || len(contexts.Profiles) != 0 {
+		t.Fatalf("Expected a missing file to hold no contexts, got %+v: %v", contexts, err)
+	}
+
+	if err := contexts.Set(Profile{Name: "prod", Host: "https://prod:9443", TokenEnv: "PROD_TOKEN"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := contexts.Set(Profile{Name: "staging", Host: "staging:9443", Token: "staging-token"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := contexts.Set(Profile{Name: "broken", Host: "ftp://nowhere"}); err == nil {
+		t.Error("Expected an invalid host to be refused")
+	}
+	contexts.Current = "prod"
+	if err := contexts.Save(path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the contexts file to be private, got %v: %v", info.Mode(), err)
+	}
+
+	loaded, err := LoadContexts(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	prod, exists := loaded.Get("prod")
+	if loaded.Current != "prod" || !exists || prod.TokenEnv != "PROD_TOKEN" {
+		t.Errorf("Unexpected contexts after a round trip: %+v", loaded)
+	}
+	t.Setenv("PROD_TOKEN", "")
+	if _, err := prod.Client(); err == nil {
+		t.Error("Expected a missing token_env variable to be reported")
+	}
+	t.Setenv("PROD_TOKEN", "prod-token")
+	if c, err := prod.Client(); err != nil || c.token != "prod-token" || c.Host() != "https://prod:9443" {
+		t.Errorf("Expected a client for prod with its token, got %+v: %v", c, err)
+	}
+
+	if !loaded.Remove("prod") || loaded.Current != "" {
+		t.Errorf("Expected removing the current context to reset it, got %+v", loaded)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	// operations_gen.go must match the server's OpenAPI document
+	documented, err := api.Operations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documented) != len(operations) {
+		t.Fatalf("Expected %d operations, operations_gen.go has %d: run go generate ./internal/client", len(documented), len(operations))
+	}
+	for i, op := range documented {
+		if generated := operations[i]; generated.id != op.ID || generated.method != op.Method || generated.path != op.Path {
+			t.Errorf("Expected %s %s %s, operations_gen.go has %+v: run go generate ./internal/client", op.ID, op.Method, op.Path, generated)
+		}
+	}
+
+	c := testClient("http://127.0.0.1:9080")
+	if got := c.operationURL(opGetJob, "a/b"); got != "http://127.0.0.1:9080/api/v1/jobs/a%2Fb" {
+		t.Errorf("Expected the path parameter escaped, got %s", got)
+	}
+}
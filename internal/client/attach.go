@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/net/websocket"
+)
+
+// attachMessage is a message of the server's attach WebSocket
+type attachMessage struct {
+	Type     string `json:"type"`
+	Data     []byte `json:"data,omitempty"`
+	Stdin    bool   `json:"stdin,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Attachment is a connection to the stdio of a process on the server
+type Attachment struct {
+	Stdin bool // Whether input written to the attachment reaches the process
+
+	ws     *websocket.Conn
+	closed atomic.Bool
+}
+
+// Attach connects to the stdin, stdout and stderr of a running process. Only
+// output written from now on is received.
+func (c *Client) Attach(ctx context.Context, process string) (*Attachment, error) {
+	endpoint := "ws" + strings.TrimPrefix(c.operationURL(opAttachWebSocket, process), "http")
+	config, err := websocket.NewConfig(endpoint, c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	ws, err := c.dialWebSocket(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to %s: %w", process, err)
+	}
+
+	var msg attachMessage
+	if err := websocket.JSON.Receive(ws, &msg); err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("failed to attach to %s: %w", process, err)
+	}
+	if msg.Type != "attached" {
+		ws.Close()
+		return nil, fmt.Errorf("guvnor server error: %s", msg.Error)
+	}
+	return &Attachment{Stdin: msg.Stdin, ws: ws}, nil
+}
+
+// Write sends input to the stdin of the process
+func (a *Attachment) Write(p []byte) (int, error) {
+	if err := websocket.JSON.Send(a.ws, attachMessage{Type: "input", Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Copy writes the output of the process to w until it exits, and returns its
+// exit code. After Close it returns -1 and no error.
+func (a *Attachment) Copy(w io.Writer) (int, error) {
+	for {
+		var msg attachMessage
+		if err := websocket.JSON.Receive(a.ws, &msg); err != nil {
+			if a.closed.Load() {
+				return -1, nil
+			}
+			if err == io.EOF {
+				return -1, fmt.Errorf("connection to the server closed")
+			}
+			return -1, fmt.Errorf("error reading from the process: %w", err)
+		}
+		switch msg.Type {
+		case "output":
+			if _, err := w.Write(msg.Data); err != nil {
+				return -1, err
+			}
+		case "exited":
+			if msg.ExitCode == nil {
+				return -1, nil
+			}
+			return *msg.ExitCode, nil
+		case "error":
+			return -1, fmt.Errorf("guvnor server error: %s", msg.Error)
+		}
+	}
+}
+
+// Close detaches from the process, which keeps running
+func (a *Attachment) Close() error {
+	a.closed.Store(true)
+	return a.ws.Close()
+}
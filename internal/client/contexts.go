@@ -0,0 +1,153 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ContextsEnv names the environment variable overriding the path of the
+// contexts file
+const ContextsEnv = "GUVNOR_CONTEXTS"
+
+// Profile is a named connection to a remote server, a context of the CLI
+type Profile struct {
+	Name               string `yaml:"name"`
+	Host               string `yaml:"host"`                           // URL of the management API, e.g. https://server:9443
+	Token              string `yaml:"token,omitempty"`                // API token sent to the server
+	TokenEnv           string `yaml:"token_env,omitempty"`            // Environment variable holding the token, instead of token
+	CAFile             string `yaml:"ca_file,omitempty"`              // Trusted besides the system roots
+	ServerName         string `yaml:"server_name,omitempty"`          // Name the server certificate must be valid for
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // Accept any server certificate
+	CertFile           string `yaml:"cert_file,omitempty"`            // Client certificate
+	KeyFile            string `yaml:"key_file,omitempty"`             // Its private key
+}
+
+// TLSOptions returns how the profile verifies its server
+func (p Profile) TLSOptions() TLSOptions {
+	return TLSOptions{
+		CAFile:             p.CAFile,
+		ServerName:         p.ServerName,
+		InsecureSkipVerify: p.InsecureSkipVerify,
+		CertFile:           p.CertFile,
+		KeyFile:            p.KeyFile,
+	}
+}
+
+// Client returns an API client for the profile's server. Its token comes from
+// token_env, then token, then GUVNOR_TOKEN.
+func (p Profile) Client() (*Client, error) {
+	token := p.Token
+	if p.TokenEnv != "" {
+		token = os.Getenv(p.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("context %s: %s is not set", p.Name, p.TokenEnv)
+		}
+	}
+	c, err := NewRemoteClient(p.Host, token, p.TLSOptions())
+	if err != nil {
+		return nil, fmt.Errorf("context %s: %w", p.Name, err)
+	}
+	return c, nil
+}
+
+// Contexts are the connection profiles of the contexts file
+type Contexts struct {
+	Current  string    `yaml:"current,omitempty"` // Profile used when none is named, local servers when ""
+	Profiles []Profile `yaml:"contexts,omitempty"`
+}
+
+// ContextsPath returns the path of the contexts file: $GUVNOR_CONTEXTS, or
+// guvnor/contexts.yaml in $XDG_CONFIG_HOME or ~/.config
+func ContextsPath() string {
+	if path := os.Getenv(ContextsEnv); path != "" {
+		return path
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "guvnor", "contexts.yaml")
+}
+
+// LoadContexts reads the contexts file at path; a missing file holds none
+func LoadContexts(path string) (*Contexts, error) {
+	contexts := &Contexts{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return contexts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contexts: %w", err)
+	}
+	if err := yaml.Unmarshal(data, contexts); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return contexts, nil
+}
+
+// Save writes the contexts to path, readable only by the user since profiles
+// may hold tokens
+func (c *Contexts) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create contexts directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write contexts: %w", err)
+	}
+	return os.Chmod(path, 0600)
+}
+
+// Get returns the profile with a name
+func (c *Contexts) Get(name string) (Profile, bool) {
+	for _, profile := range c.Profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Set adds a profile, replacing the one with its name
+func (c *Contexts) Set(profile Profile) error {
+	if profile.Name == "" {
+		return fmt.Errorf("a context needs a name")
+	}
+	if _, err := ParseHost(profile.Host); err != nil {
+		return err
+	}
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == profile.Name {
+			c.Profiles[i] = profile
+			return nil
+		}
+	}
+	c.Profiles = append(c.Profiles, profile)
+	return nil
+}
+
+// Remove deletes the profile with a name, and stops using it by default,
+// reporting whether it existed
+func (c *Contexts) Remove(name string) bool {
+	for i, profile := range c.Profiles {
+		if profile.Name == name {
+			c.Profiles = append(c.Profiles[:i], c.Profiles[i+1:]...)
+			if c.Current == name {
+				c.Current = ""
+			}
+			return true
+		}
+	}
+	return false
+}
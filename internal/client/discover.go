@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/registry"
+)
+
+// Connect returns a client for a registered server, through its socket when
+// it answers there, or nil when the server does not answer
+func Connect(entry registry.Entry) *Client {
+	if entry.Socket != "" {
+		if c := NewSocketClient(entry.Socket); c.Serves(entry.HTTPPort) {
+			return c
+		}
+	}
+	if c := NewClient(entry.HTTPPort); c.IsServerRunning() {
+		return c
+	}
+	return nil
+}
+
+// DetectServer finds a running guvnor server in the server registry. With
+// several running, the one started in dir is chosen. When a registered server
+// is running but does not answer yet, the registry is read again briefly so
+// it is found once it does; with none registered it fails at once.
+func DetectServer(dir string) (*Client, error) {
+	backoff := DefaultRetryPolicy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		entries, err := registry.List(registry.Dir())
+		if err != nil {
+			return nil, err
+		}
+
+		var running []registry.Entry
+		var clients []*Client
+		for _, entry := range entries {
+			if c := Connect(entry); c != nil {
+				running = append(running, entry)
+				clients = append(clients, c)
+			}
+		}
+		if len(clients) == 1 {
+			return clients[0], nil
+		}
+		if len(clients) > 1 {
+			var dirs []string
+			for i, entry := range running {
+				if entry.Dir == dir {
+					return clients[i], nil
+				}
+				dirs = append(dirs, fmt.Sprintf("%s (port %d)", entry.Dir, entry.HTTPPort))
+			}
+			return nil, fmt.Errorf("%d guvnor servers are running, in %s: run from the directory of one or pass its --config",
+				len(clients), strings.Join(dirs, ", "))
+		}
+
+		if len(entries) == 0 || attempt >= DefaultRetryPolicy.MaxAttempts {
+			return nil, fmt.Errorf("%w: no running guvnor server found in %s", ErrUnreachable, registry.Dir())
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
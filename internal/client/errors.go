@@ -0,0 +1,60 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnreachable is returned when no connection to the guvnor server could be made
+var ErrUnreachable = errors.New("guvnor server unreachable")
+
+// ErrUnauthorized is matched by errors for requests the server refused (401/403)
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrFrozen is matched by errors for requests refused during a freeze window (423)
+var ErrFrozen = errors.New("refused during freeze window")
+
+// StatusError is returned when the server answers with an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Is lets errors.Is(err, ErrUnauthorized) match 401 and 403 responses, and
+// errors.Is(err, ErrFrozen) match 423 responses
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrFrozen:
+		return e.StatusCode == http.StatusLocked
+	}
+	return false
+}
+
+// Temporary reports whether the request may succeed if retried
+func (e *StatusError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// JobError is returned when a background job finished unsuccessfully
+type JobError struct {
+	JobID   string
+	Message string
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/gleicon/guvnor/internal/events"
+)
+
+// EventQuery selects the events StreamEvents returns
+type EventQuery struct {
+	Types []string // Event types, all when empty
+	Apps  []string // Apps or instances, all when empty
+}
+
+// values returns the query parameters of q
+func (q EventQuery) values() url.Values {
+	values := url.Values{}
+	if len(q.Types) > 0 {
+		values.Set("type", strings.Join(q.Types, ","))
+	}
+	if len(q.Apps) > 0 {
+		values.Set("app", strings.Join(q.Apps, ","))
+	}
+	return values
+}
+
+// eventStreamMessage is a message of the server's event streams
+type eventStreamMessage struct {
+	Type    string        `json:"type"`
+	Event   *events.Event `json:"event,omitempty"`
+	Dropped int           `json:"dropped,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// StreamEvents streams the lifecycle events the query selects as they
+// happen, until the stream ends or the context is cancelled. dropped is how
+// many events the server skipped before this one because the client fell
+// behind. It uses a WebSocket, falling back to Server-Sent Events when the
+// server does not accept one.
+func (c *Client) StreamEvents(ctx context.Context, query EventQuery, callback func(event events.Event, dropped int)) error {
+	err := c.streamEventsWebSocket(ctx, query, callback)
+	var dialErr *websocket.DialError
+	if errors.As(err, &dialErr) && ctx.Err() == nil {
+		return c.streamEventsSSE(ctx, query, callback)
+	}
+	return err
+}
+
+// streamEventsWebSocket streams events over the server's WebSocket endpoint
+func (c *Client) streamEventsWebSocket(ctx context.Context, query EventQuery, callback func(events.Event, int)) error {
+	endpoint := "ws" + strings.TrimPrefix(c.operationURL(opStreamEventsWebSocket), "http")
+	if values := query.values(); len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	config, err := websocket.NewConfig(endpoint, c.baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	ws, err := c.dialWebSocket(ctx, config)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer ws.Close()
+
+	// Unblock the receive below when the context ends
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	for {
+		var msg eventStreamMessage
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error reading event stream: %w", err)
+		}
+		if err := deliverEvent(msg, callback); err != nil {
+			return err
+		}
+	}
+}
+
+// streamEventsSSE streams events using Server-Sent Events
+func (c *Client) streamEventsSSE(ctx context.Context, query EventQuery, callback func(events.Event, int)) error {
+	endpoint := c.operationURL(opStreamEvents)
+	if values := query.values(); len(values) > 0 {
+		endpoint += "?" + values.Encode()
+	}
+
+	resp, err := c.do(ctx, c.stream, opStreamEvents.method, endpoint, nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	reader := NewSSEReader(resp.Body)
+	for {
+		event, err := reader.ReadEvent()
+		if err != nil {
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error reading event stream: %w", err)
+		}
+
+		var msg eventStreamMessage
+		if err := json.Unmarshal([]byte(event.Data), &msg); err != nil {
+			continue // Skip invalid events
+		}
+		if err := deliverEvent(msg, callback); err != nil {
+			return err
+		}
+	}
+}
+
+// deliverEvent hands the event of a stream message to callback
+func deliverEvent(msg eventStreamMessage, callback func(events.Event, int)) error {
+	switch {
+	case msg.Type == "error":
+		return fmt.Errorf("guvnor server error: %s", msg.Error)
+	case msg.Type == "event" && msg.Event != nil:
+		callback(*msg.Event, msg.Dropped)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Command gen writes operations_gen.go, the operations of the management API
+// the client calls, from the OpenAPI document of internal/api. Run it with
+// go generate ./internal/client after changing the document.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/gleicon/guvnor/internal/api"
+)
+
+const output = "operations_gen.go"
+
+var source = template.Must(template.New(output).Funcs(template.FuncMap{"name": name}).Parse(`// Code generated by go run ./gen from internal/api/openapi.yaml; DO NOT EDIT.
+
+package client
+
+// Operations of the management API, by operationId
+var (
+{{- range .}}
+	{{name .ID}} = operation{id: {{printf "%q" .ID}}, method: {{printf "%q" .Method}}, path: {{printf "%q" .Path}}} // {{if .Deprecated}}Deprecated: {{end}}{{.Summary}}
+{{- end}}
+)
+
+// operations lists every operation of the OpenAPI document
+var operations = []operation{
+{{- range .}}
+	{{name .ID}},
+{{- end}}
+}
+`))
+
+// name returns the variable of an operation, e.g. opGetStatus for getStatus
+func name(id string) string {
+	return "op" + strings.ToUpper(id[:1]) + id[1:]
+}
+
+func main() {
+	operations, err := api.Operations()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.Execute(&buf, operations); err != nil {
+		log.Fatal(err)
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(fmt.Errorf("generated code does not compile: %w", err))
+	}
+	if err := os.WriteFile(output, code, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
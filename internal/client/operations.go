@@ -0,0 +1,32 @@
+package client
+
+import (
+	"net/url"
+	"strings"
+)
+
+//go:generate go run ./gen
+
+// operation is an endpoint of the management API. The client's operations are
+// generated into operations_gen.go from the OpenAPI document the server
+// serves, so the CLI cannot call a path the server does not have.
+type operation struct {
+	id     string
+	method string
+	path   string // With {parameters}
+}
+
+// operationURL returns the URL of op on the client's server, its path
+// parameters filled in order with params
+func (c *Client) operationURL(op operation, params ...string) string {
+	path := op.path
+	for _, param := range params {
+		start := strings.Index(path, "{")
+		end := strings.Index(path, "}")
+		if start < 0 || end < start {
+			break
+		}
+		path = path[:start] + url.PathEscape(param) + path[end+1:]
+	}
+	return c.baseURL + path
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TLSOptions controls how the certificate of a remote server is verified
+type TLSOptions struct {
+	CAFile             string // PEM certificates trusted besides the system roots, e.g. a private CA
+	ServerName         string // Name the certificate must be valid for, when it differs from the host
+	InsecureSkipVerify bool   // Accept any certificate; only for testing
+	CertFile           string // Client certificate, for servers verifying them
+	KeyFile            string // Its private key
+}
+
+// config returns the TLS settings of the options
+func (o TLSOptions) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify,
+	}
+	if o.CAFile != "" {
+		data, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+// NewRemoteClient creates an API client for the server at host, the URL of
+// its management API such as https://server:9443. A host without a scheme
+// uses https. token, or GUVNOR_TOKEN when it is "", is sent with every request.
+func NewRemoteClient(host, token string, options TLSOptions) (*Client, error) {
+	baseURL, err := ParseHost(host)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := options.config()
+	if err != nil {
+		return nil, err
+	}
+	if token == "" {
+		token = os.Getenv(TokenEnv)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		baseURL: baseURL,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+		stream:    &http.Client{Transport: transport},
+		retry:     DefaultRetryPolicy,
+		token:     token,
+		tlsConfig: tlsConfig,
+	}, nil
+}
+
+// ParseHost returns the base URL of the management API at host, adding https
+// when it has no scheme
+func ParseHost(host string) (string, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid host %q (use https://host:port)", host)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("invalid host %q: the scheme must be https or http", host)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return "", fmt.Errorf("invalid host %q: give the server without a path", host)
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+// WithToken sets the management API token sent with the client's requests
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+// Host returns the URL of the server the client talks to
+func (c *Client) Host() string {
+	return c.baseURL
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// NewSocketClient creates an API client talking to the server over its unix
+// socket at path
+func NewSocketClient(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{
+		baseURL: "http://localhost",
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   30 * time.Second,
+		},
+		stream: &http.Client{Transport: transport},
+		retry:  DefaultRetryPolicy,
+		token:  os.Getenv(TokenEnv),
+		socket: path,
+	}
+}
+
+// Socket returns the unix socket of the client, "" when it uses TCP
+func (c *Client) Socket() string {
+	return c.socket
+}
+
+// dialWebSocket opens a WebSocket connection, through the unix socket when
+// the client has one
+func (c *Client) dialWebSocket(ctx context.Context, wsConfig *websocket.Config) (*websocket.Conn, error) {
+	if c.socket == "" {
+		wsConfig.TlsConfig = c.tlsConfig
+		return wsConfig.DialContext(ctx)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.socket)
+	if err == nil {
+		var ws *websocket.Conn
+		if ws, err = websocket.NewClient(wsConfig, conn); err == nil {
+			return ws, nil
+		}
+		conn.Close()
+	}
+	return nil, &websocket.DialError{Config: wsConfig, Err: err}
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/discovery"
 )
 
 func TestConfig_LoadFromFile(t *testing.T) {
@@ -87,4 +93,789 @@ func TestConfig_Validate(t *testing.T) {
 	if err != nil {
 		t.Errorf("Valid config should not return error: %v", err)
 	}
-}
\ No newline at end of file
+}
+func TestConfig_LoadResolvesWorkingDirs(t *testing.T) {
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "gateway")
+	if err := os.Mkdir(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project dir: %v", err)
+	}
+
+	configYAML := `
+tls:
+  enabled: false
+apps:
+  - name: gateway
+    command: ./gateway
+    port: 3000
+  - name: billing
+    command: ./billing
+    port: 3001
+    working_dir: ../billing-service
+    env_file: ../billing-service/.env.staging
+  - name: absolute
+    command: ./absolute
+    port: 3002
+    working_dir: /srv/absolute
+    env_file: [/srv/absolute/.env.prod, secrets.env]
+`
+	configPath := filepath.Join(projectDir, "guvnor.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	want := []string{"", filepath.Join(root, "billing-service"), "/srv/absolute"}
+	for i, app := range cfg.Apps {
+		if app.WorkingDir != want[i] {
+			t.Errorf("App %s: expected working_dir %q, got %q", app.Name, want[i], app.WorkingDir)
+		}
+	}
+
+	// env_file takes a path or a list, relative to guvnor.yaml
+	if got := cfg.Apps[1].EnvFile; len(got) != 1 || got[0] != filepath.Join(root, "billing-service", ".env.staging") {
+		t.Errorf("Expected billing's env_file to be resolved, got %q", got)
+	}
+	if got := cfg.Apps[2].EnvFile; len(got) != 2 || got[0] != "/srv/absolute/.env.prod" || got[1] != filepath.Join(projectDir, "secrets.env") {
+		t.Errorf("Expected absolute's env_file list to be resolved, got %q", got)
+	}
+}
+
+func TestHealthCheck_Probes(t *testing.T) {
+	healthCheck := HealthCheckConfig{
+		Enabled:   true,
+		Path:      "/health",
+		Interval:  30 * time.Second,
+		Timeout:   5 * time.Second,
+		Retries:   3,
+		Startup:   &ProbeConfig{Path: "/started", Interval: time.Second, FailureThreshold: 60},
+		Readiness: &ProbeConfig{Path: "/ready", SuccessThreshold: 2},
+	}
+
+	liveness, ok := healthCheck.Probe(ProbeLiveness)
+	if !ok || liveness.Path != "/health" || liveness.FailureThreshold != 3 || liveness.SuccessThreshold != 1 {
+		t.Errorf("Expected liveness to default to the health check, got %+v", liveness)
+	}
+	startup, _ := healthCheck.Probe(ProbeStartup)
+	if startup.Path != "/started" || startup.Interval != time.Second || startup.Timeout != 5*time.Second || startup.FailureThreshold != 60 {
+		t.Errorf("Unexpected startup probe: %+v", startup)
+	}
+	readiness, _ := healthCheck.Probe(ProbeReadiness)
+	if readiness.Path != "/ready" || readiness.Interval != 30*time.Second || readiness.SuccessThreshold != 2 {
+		t.Errorf("Unexpected readiness probe: %+v", readiness)
+	}
+
+	healthCheck.Readiness = nil
+	if _, ok := healthCheck.Probe(ProbeReadiness); ok {
+		t.Error("Expected readiness probe to be off unless configured")
+	}
+	healthCheck.Enabled = false
+	if _, ok := healthCheck.Probe(ProbeLiveness); ok {
+		t.Error("Expected no probes with health checks disabled")
+	}
+
+	invalid := &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, Apps: []AppConfig{{
+		Name: "web", Command: "./web",
+		HealthCheck: HealthCheckConfig{Liveness: &ProbeConfig{SuccessThreshold: 2}},
+	}}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected validation to reject a liveness success_threshold above 1")
+	}
+}
+
+func TestConfig_SPAPreset(t *testing.T) {
+	projectDir := t.TempDir()
+	configYAML := `
+tls:
+  enabled: false
+apps:
+  - name: shop
+    command: ./api
+    port: 3000
+    preset: spa-api
+    spa:
+      root: web/dist
+`
+	configPath := filepath.Join(projectDir, "guvnor.yaml")
+	if err := os.WriteFile(configPath, []byte(configYAML), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	spa := cfg.Apps[0].SPA
+	if spa.Root != filepath.Join(projectDir, "web/dist") || spa.APIPrefix != DefaultAPIPrefix {
+		t.Errorf("Unexpected spa settings: %+v", spa)
+	}
+
+	invalid := []AppConfig{
+		{Name: "noroot", Command: "./api", Preset: PresetSPAAPI},
+		{Name: "nopreset", Command: "./api", SPA: SPAConfig{Root: "dist"}},
+		{Name: "prefix", Command: "./api", Preset: PresetSPAAPI, SPA: SPAConfig{Root: "dist", APIPrefix: "api"}},
+		{Name: "unknown", Command: "./api", Preset: "static"},
+	}
+	for _, app := range invalid {
+		cfg := &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, Apps: []AppConfig{app}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("App %s: expected validation to fail", app.Name)
+		}
+	}
+}
+
+func TestConfig_APITokens(t *testing.T) {
+	base := func(tokens ...APIToken) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, APITokens: tokens},
+			Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+		}
+	}
+
+	valid := base(
+		APIToken{Name: "admin", Token: "admin-token-0123456789"},
+		APIToken{Name: "ci", Token: "ci-token-0123456789", Apps: []string{"web"}, Actions: []string{APIActionRestart}},
+	)
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected tokens to be valid: %v", err)
+	}
+
+	invalid := map[string]*Config{
+		"short":     base(APIToken{Name: "short", Token: "secret"}),
+		"app":       base(APIToken{Name: "ci", Token: "ci-token-0123456789", Apps: []string{"api"}}),
+		"action":    base(APIToken{Name: "ci", Token: "ci-token-0123456789", Actions: []string{"shutdown"}}),
+		"duplicate": base(APIToken{Name: "a", Token: "same-token-0123456789"}, APIToken{Name: "b", Token: "same-token-0123456789"}),
+	}
+	for name, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_APIRemote(t *testing.T) {
+	base := func(remote APIRemoteConfig, tokens ...APIToken) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, APITokens: tokens, APIRemote: remote},
+			Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+		}
+	}
+	admin := APIToken{Name: "admin", Token: "admin-token-0123456789"}
+
+	valid := base(APIRemoteConfig{Listen: ":9443", CertFile: "api.crt", KeyFile: "api.key"}, admin)
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected api_remote to be valid: %v", err)
+	}
+
+	invalid := map[string]*Config{
+		"no tokens":  base(APIRemoteConfig{Listen: ":9443", CertFile: "api.crt", KeyFile: "api.key"}),
+		"no cert":    base(APIRemoteConfig{Listen: ":9443"}, admin),
+		"no port":    base(APIRemoteConfig{Listen: "0.0.0.0", CertFile: "api.crt", KeyFile: "api.key"}, admin),
+		"no address": base(APIRemoteConfig{CertFile: "api.crt", KeyFile: "api.key"}, admin),
+	}
+	for name, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_FreezeWindows(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, FreezeWindows: []FreezeWindow{
+			{From: "Fri 16:00", To: "Mon 08:00", Timezone: "UTC"},
+		}},
+		Apps: []AppConfig{{Name: "web", Command: "./web"}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid freeze window: %v", err)
+	}
+	if name := cfg.Server.FreezeWindows[0].Name; name != "Fri 16:00 to Mon 08:00" {
+		t.Errorf("Expected a default name, got %q", name)
+	}
+
+	saturday := time.Date(2025, 9, 13, 12, 0, 0, 0, time.UTC)
+	if window, until := cfg.Server.ActiveFreeze(saturday); window == nil || !until.Equal(time.Date(2025, 9, 15, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the weekend freeze to be active until Monday, got %v until %s", window, until)
+	}
+	if window, _ := cfg.Server.ActiveFreeze(saturday.Add(72 * time.Hour)); window != nil {
+		t.Errorf("Expected no freeze on Tuesday, got %s", window.Name)
+	}
+
+	cfg.Server.FreezeWindows[0].To = "08:00"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected mixed window formats to be rejected")
+	}
+}
+
+func TestConfig_MarshalRoundTrip(t *testing.T) {
+	apps := []*discovery.App{{
+		Name:        "web",
+		Port:        3000,
+		Command:     "node",
+		Args:        []string{"server.js"},
+		HealthCheck: "/health",
+		Env:         map[string]string{"PORT": "$PORT", "NODE_ENV": "development", "API_URL": "http://localhost", "DEBUG": "1"},
+	}}
+	want := CreateSmart(apps)
+
+	first, err := generateCommentedYAML(want)
+	if err != nil {
+		t.Fatalf("Failed to generate config: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := generateCommentedYAML(want); string(again) != string(first) {
+			t.Fatalf("Expected identical output on every run, got:\n%s\nthen:\n%s", first, again)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "guvnor.yaml")
+	if err := os.WriteFile(path, first, 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load generated config: %v\n%s", err, first)
+	}
+	if err := want.Validate(); err != nil {
+		t.Fatalf("Generated config is invalid: %v", err)
+	}
+	want.Path = path
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the generated config to load back unchanged:\n%s", first)
+	}
+}
+
+func TestConfig_SetValue(t *testing.T) {
+	original := `# Header
+server:
+  http_port: 8080 # dev port
+apps:
+  - name: web
+    command: ./web
+    environment:
+      B: "2"
+      A: "1"
+`
+	data, err := SetValue([]byte(original), "apps.web.environment.C", "3")
+	if err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	if data, err = SetValue(data, "server.http_port", "9090"); err != nil {
+		t.Fatalf("Failed to set value: %v", err)
+	}
+	want := `# Header
+server:
+  http_port: 9090 # dev port
+apps:
+  - name: web
+    command: ./web
+    environment:
+      B: "2"
+      A: "1"
+      C: "3"
+`
+	if string(data) != want {
+		t.Errorf("Expected comments and order to be kept, got:\n%s", data)
+	}
+
+	for _, path := range []string{"server.htp_port", "apps.api.port", "server.http_port.x"} {
+		if _, err := SetValue([]byte(original), path, "1"); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestConfig_EventNotifications(t *testing.T) {
+	base := func(rule EventNotification) *Config {
+		return &Config{
+			Server:        ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+			Apps:          []AppConfig{{Name: "web", Command: "./web"}},
+			Notifications: map[string]NotificationConfig{"ops": {Type: "slack", URL: "https://hooks.slack.com/x"}},
+			Events:        []EventNotification{rule},
+		}
+	}
+
+	if err := base(EventNotification{Types: []string{"crashloop", "health"}, Apps: []string{"web"}, Notify: []string{"ops"}}).Validate(); err != nil {
+		t.Fatalf("Expected valid event notification: %v", err)
+	}
+	invalid := map[string]EventNotification{
+		"type":   {Types: []string{"exploded"}, Notify: []string{"ops"}},
+		"app":    {Apps: []string{"api"}, Notify: []string{"ops"}},
+		"notify": {Types: []string{"crashed"}},
+		"sink":   {Notify: []string{"pager"}},
+	}
+	for name, rule := range invalid {
+		if err := base(rule).Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_Alerts(t *testing.T) {
+	base := func(rule AlertConfig) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+			Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+			Notifications: map[string]NotificationConfig{
+				"ops":  {Type: "slack", URL: "https://hooks.slack.com/x"},
+				"mail": {Type: "email", URL: "smtp://mail.example.com:587", From: "guvnor@example.com", To: []string{"ops@example.com"}},
+			},
+			Alerts: []AlertConfig{rule},
+		}
+	}
+
+	cfg := base(AlertConfig{When: "error_rate > 5% for 5m", Notify: "ops,mail"})
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid alert: %v", err)
+	}
+	if cfg.Alerts[0].Name != "alert-1" {
+		t.Errorf("Expected a default name, got %q", cfg.Alerts[0].Name)
+	}
+	if err := base(AlertConfig{App: "web", When: "cert_expires < 7d", Notify: "mail"}).Validate(); err != nil {
+		t.Errorf("Expected valid alert: %v", err)
+	}
+
+	invalid := map[string]AlertConfig{
+		"condition": {When: "cpu > 3", Notify: "ops"},
+		"notify":    {When: "restarts > 3 in 10m"},
+		"sink":      {When: "restarts > 3 in 10m", Notify: "pager"},
+		"app":       {App: "api", When: "restarts > 3 in 10m", Notify: "ops"},
+	}
+	for name, rule := range invalid {
+		if err := base(rule).Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+
+	cfg = base(AlertConfig{When: "restarts > 3", Notify: "mail"})
+	cfg.Notifications["mail"] = NotificationConfig{Type: "email", URL: "smtp://mail.example.com"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an email sink without recipients to fail validation")
+	}
+}
+
+func TestConfig_SecretReferences(t *testing.T) {
+	base := func(env map[string]string, providers map[string]SecretProvider) *Config {
+		return &Config{
+			Server:  ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+			Apps:    []AppConfig{{Name: "web", Command: "./web", Environment: env}},
+			Secrets: providers,
+		}
+	}
+	vault := map[string]SecretProvider{"vault": {Command: []string{"vault", "kv", "get", "-field=value", "{path}"}}}
+
+	valid := base(map[string]string{
+		"DB_PASSWORD": "secret://file/run/secrets/db",
+		"API_KEY":     "secret://vault/prod/api",
+		"TOKEN":       "secret://${TOKEN_PROVIDER}/token",
+	}, vault)
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected valid secret references: %v", err)
+	}
+
+	invalid := map[string]*Config{
+		"unknown provider": base(map[string]string{"API_KEY": "secret://vault/prod/api"}, nil),
+		"missing path":     base(map[string]string{"API_KEY": "secret://vault"}, vault),
+		"no command":       base(nil, map[string]SecretProvider{"vault": {}}),
+		"builtin":          base(nil, map[string]SecretProvider{"file": {Command: []string{"cat"}}}),
+	}
+	for name, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_Priorities(t *testing.T) {
+	base := func(app AppConfig) *Config {
+		app.Name, app.Command = "worker", "./worker"
+		return &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, Apps: []AppConfig{app}}
+	}
+
+	valid := []AppConfig{
+		{Nice: 10, IONice: "best-effort:7", OOMScoreAdj: 500},
+		{Nice: -20, IONice: "realtime", OOMScoreAdj: -1000},
+		{IONice: "idle"},
+	}
+	for _, app := range valid {
+		if err := base(app).Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", app, err)
+		}
+	}
+
+	invalid := map[string]AppConfig{
+		"nice range":     {Nice: 20},
+		"ionice class":   {IONice: "low"},
+		"ionice level":   {IONice: "best-effort:8"},
+		"idle level":     {IONice: "idle:3"},
+		"oom range":      {OOMScoreAdj: 1001},
+		"container nice": {Nice: 5, Container: ContainerConfig{Image: "nginx"}},
+	}
+	for name, app := range invalid {
+		if err := base(app).Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_Sandbox(t *testing.T) {
+	base := func(app AppConfig) *Config {
+		app.Name, app.Command = "worker", "./worker"
+		return &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, Apps: []AppConfig{app}}
+	}
+
+	valid := base(AppConfig{WorkingDir: "/srv/worker", Sandbox: SandboxConfig{
+		ReadOnly:         true,
+		Writable:         []string{"tmp", "var/uploads"},
+		Seccomp:          SeccompDefault,
+		DropCapabilities: true,
+		Capabilities:     []string{"NET_BIND_SERVICE", "cap_chown"},
+	}})
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected valid sandbox: %v", err)
+	}
+
+	invalid := map[string]AppConfig{
+		"read_only without working_dir": {Sandbox: SandboxConfig{ReadOnly: true}},
+		"writable outside":              {WorkingDir: "/srv/worker", Sandbox: SandboxConfig{ReadOnly: true, Writable: []string{"../etc"}}},
+		"writable without read_only":    {WorkingDir: "/srv/worker", Sandbox: SandboxConfig{Writable: []string{"tmp"}}},
+		"unknown seccomp profile":       {Sandbox: SandboxConfig{Seccomp: "strict"}},
+		"unknown capability":            {Sandbox: SandboxConfig{DropCapabilities: true, Capabilities: []string{"FLY"}}},
+		"container":                     {Sandbox: SandboxConfig{NoNewPrivileges: true}, Container: ContainerConfig{Image: "nginx"}},
+	}
+	for name, app := range invalid {
+		if err := base(app).Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_SlowStart(t *testing.T) {
+	base := func(slowStart SlowStartConfig) *Config {
+		app := AppConfig{Name: "web", Command: "./web", SlowStart: slowStart}
+		return &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, Apps: []AppConfig{app}}
+	}
+
+	cfg := base(SlowStartConfig{HealthyChecks: 3})
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected valid slow_start: %v", err)
+	}
+	if cfg.Apps[0].SlowStart.Interval != time.Second {
+		t.Errorf("Expected the interval to default to 1s, got %s", cfg.Apps[0].SlowStart.Interval)
+	}
+
+	invalid := map[string]SlowStartConfig{
+		"negative healthy_checks": {HealthyChecks: -1},
+		"negative duration":       {Duration: -time.Second},
+		"negative interval":       {HealthyChecks: 3, Interval: -time.Second},
+	}
+	for name, slowStart := range invalid {
+		if err := base(slowStart).Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+}
+
+func TestConfig_TLSPolicy(t *testing.T) {
+	tlsConfig, err := TLSConfig{CipherProfile: CipherProfileIntermediate, ALPN: []string{"http/1.1"}}.ServerTLSConfig()
+	if err != nil {
+		t.Fatalf("Expected valid policy: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 || len(tlsConfig.CipherSuites) == 0 || len(tlsConfig.NextProtos) != 1 {
+		t.Errorf("Unexpected intermediate policy: %+v", tlsConfig)
+	}
+	if tlsConfig, _ := (TLSConfig{CipherProfile: CipherProfileModern}).ServerTLSConfig(); tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected modern profile to require TLS 1.3, got %x", tlsConfig.MinVersion)
+	}
+
+	invalid := map[string]TLSConfig{
+		"unknown version":      {MinVersion: "1.1"},
+		"max below min":        {MinVersion: "1.3", MaxVersion: "1.2"},
+		"modern with 1.2":      {MinVersion: "1.2", CipherProfile: CipherProfileModern},
+		"unknown profile":      {CipherProfile: "old"},
+		"preload short":        {HSTS: HSTSConfig{Enabled: true, Preload: true, IncludeSubDomains: true, MaxAge: time.Hour}},
+		"preload without subs": {HSTS: HSTSConfig{Enabled: true, Preload: true}},
+	}
+	for name, policy := range invalid {
+		cfg := &Config{Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443}, TLS: policy}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected validation to fail", name)
+		}
+	}
+
+	hsts := HSTSConfig{Enabled: true, IncludeSubDomains: true}
+	if got := hsts.Header(); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Unexpected HSTS header %q", got)
+	}
+	if got := (HSTSConfig{MaxAge: time.Hour}).Header(); got != "" {
+		t.Errorf("Expected no header when disabled, got %q", got)
+	}
+}
+
+func TestConfig_CatchAll(t *testing.T) {
+	base := func(catchAll CatchAllConfig) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, CatchAll: catchAll},
+			Apps:   []AppConfig{{Name: "parked", Command: "./parked", Hostname: "parked.example.com"}},
+		}
+	}
+
+	for _, catchAll := range []CatchAllConfig{{}, {Action: CatchAllDrop}, {Action: CatchAllRedirect, URL: "https://example.com/"}, {Action: CatchAllApp, App: "parked"}} {
+		if err := base(catchAll).Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", catchAll, err)
+		}
+	}
+	for _, catchAll := range []CatchAllConfig{{Action: "444"}, {Action: CatchAllRedirect, URL: "/elsewhere"}, {Action: CatchAllApp, App: "missing"}} {
+		if err := base(catchAll).Validate(); err == nil {
+			t.Errorf("Expected %+v to fail validation", catchAll)
+		}
+	}
+}
+
+func TestConfig_AccessLog(t *testing.T) {
+	base := func(accessLog AccessLogConfig) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, AccessLog: accessLog},
+			Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+		}
+	}
+
+	for _, accessLog := range []AccessLogConfig{{}, {Path: "logs/access.log"}, {Path: "access.log", Format: AccessLogCommon, MaxSizeMB: 10, RotateEvery: 24 * time.Hour, MaxBackups: 30}} {
+		if err := base(accessLog).Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", accessLog, err)
+		}
+	}
+	for _, accessLog := range []AccessLogConfig{{Format: AccessLogJSON}, {Path: "access.log", Format: "xml"}, {Path: "access.log", MaxSizeMB: -1}, {Path: "access.log", RotateEvery: time.Second}} {
+		if err := base(accessLog).Validate(); err == nil {
+			t.Errorf("Expected %+v to fail validation", accessLog)
+		}
+	}
+}
+
+func TestConfig_LogRetention(t *testing.T) {
+	policy := LogRetentionConfig{MaxTotalMB: 50, Apps: map[string]int{"worker": 0}}.Policy()
+	if policy.MaxTotal != 50<<20 || policy.MaxApp != DefaultLogMaxAppMB<<20 || policy.Apps["worker"] != 0 {
+		t.Errorf("Unexpected retention policy: %+v", policy)
+	}
+	if size := (LogRetentionConfig{}).FileSize(); size != DefaultLogFileSizeMB<<20 {
+		t.Errorf("Expected default file size, got %d", size)
+	}
+
+	cfg := &Config{
+		Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+		Logs:   LogsConfig{Dir: "logs", Retention: LogRetentionConfig{MaxAppMB: -1}},
+		Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative limit to fail validation")
+	}
+}
+
+func TestConfig_CrashReports(t *testing.T) {
+	server := ServerConfig{StateDir: "/var/lib/guvnor"}
+	if dir := server.CrashDir(); dir != "/var/lib/guvnor/crashes" {
+		t.Errorf("Unexpected crash directory %s", dir)
+	}
+	if lines, keep := server.CrashReports.Lines(), server.CrashReports.Kept(); lines != DefaultCrashLogLines || keep != DefaultCrashKeep {
+		t.Errorf("Unexpected defaults: %d lines, %d kept", lines, keep)
+	}
+
+	cfg := &Config{
+		Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443, CrashReports: CrashReportsConfig{Keep: -1}},
+		Apps:   []AppConfig{{Name: "web", Command: "./web"}},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected a negative keep to fail validation")
+	}
+}
+
+func TestConfig_LogSinks(t *testing.T) {
+	base := func(sink LogSinkConfig) *Config {
+		return &Config{
+			Server: ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+			Apps:   []AppConfig{{Name: "web", Command: "./web", Port: 3000}},
+			Logs:   LogsConfig{Sinks: map[string]LogSinkConfig{"remote": sink}},
+		}
+	}
+
+	for _, sink := range []LogSinkConfig{{Type: "syslog"}, {Type: "syslog", Address: "tcp://logs.example.com:601", Facility: "local3"}, {Type: "journald"}, {Type: "loki", URL: "http://loki:3100/loki/api/v1/push"}} {
+		if err := base(sink).Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", sink, err)
+		}
+	}
+	for _, sink := range []LogSinkConfig{{Type: "splunk"}, {Type: "syslog", Address: "http://logs.example.com"}, {Type: "syslog", Facility: "local8"}, {Type: "loki"}, {Type: "journald", Buffer: -1}} {
+		if err := base(sink).Validate(); err == nil {
+			t.Errorf("Expected %+v to fail validation", sink)
+		}
+	}
+}
+
+func TestConfig_StatsD(t *testing.T) {
+	base := func(statsd StatsDConfig) *Config {
+		return &Config{
+			Server:  ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+			Apps:    []AppConfig{{Name: "web", Command: "./web", Port: 3000}},
+			Metrics: MetricsConfig{StatsD: statsd},
+		}
+	}
+
+	for _, statsd := range []StatsDConfig{{}, {Address: "127.0.0.1:8125"}, {Address: "statsd:8125", Flavor: "statsd", Interval: time.Minute}} {
+		if err := base(statsd).Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", statsd, err)
+		}
+	}
+	for _, statsd := range []StatsDConfig{{Address: "statsd"}, {Address: "127.0.0.1:8125", Flavor: "graphite"}, {Address: "127.0.0.1:8125", Interval: -time.Second}} {
+		if err := base(statsd).Validate(); err == nil {
+			t.Errorf("Expected %+v to fail validation", statsd)
+		}
+	}
+}
+
+func TestConfig_DropIns(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "guvnor.yaml")
+	if err := os.WriteFile(configPath, []byte("server:\n  http_port: 8080\napps:\n  - name: web\n    command: ./web\n    port: 3000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	app, err := ParseApp([]byte(`{"name": "api", "command": "./api", "working_dir": "api", "restart_policy": {"backoff": "2s"}}`))
+	if err != nil {
+		t.Fatalf("ParseApp failed: %v", err)
+	}
+	if _, err := ParseApp([]byte(`{"name": "api", "comand": "./api"}`)); err == nil {
+		t.Error("Expected an unknown key to be refused")
+	}
+
+	for _, invalid := range []AppConfig{
+		{Name: "web", Command: "./web"},
+		{Name: "../api", Command: "./api"},
+		{Name: "api", Command: "./api", Port: 3000},
+	} {
+		if _, err := cfg.PrepareApp(invalid); err == nil {
+			t.Errorf("Expected %+v to be refused", invalid)
+		}
+	}
+	prepared, err := cfg.PrepareApp(app)
+	if err != nil {
+		t.Fatalf("PrepareApp failed: %v", err)
+	}
+	if prepared.WorkingDir != filepath.Join(dir, "api") || prepared.Hostname != "api.localhost" || prepared.Port == 0 || prepared.RestartPolicy.MaxRetries != 3 {
+		t.Errorf("Unexpected prepared app %+v", prepared)
+	}
+	if len(cfg.Apps) != 1 {
+		t.Errorf("PrepareApp changed the configuration: %+v", cfg.Apps)
+	}
+
+	saved, err := cfg.WriteDropIn(prepared)
+	if err != nil {
+		t.Fatalf("WriteDropIn failed: %v", err)
+	}
+	if saved.Source != filepath.Join(dir, DropInDirName, "api.yaml") {
+		t.Errorf("Unexpected drop-in %s", saved.Source)
+	}
+
+	reloaded, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load with drop-in failed: %v", err)
+	}
+	if len(reloaded.Apps) != 2 || reloaded.FileApps() != 1 || reloaded.Apps[1].Name != "api" || reloaded.Apps[1].Port != prepared.Port ||
+		reloaded.Apps[1].RestartPolicy.Backoff != 2*time.Second || reloaded.Apps[1].Source != saved.Source {
+		t.Errorf("Unexpected apps after reload %+v", reloaded.Apps)
+	}
+}
+
+func TestConfig_Diff(t *testing.T) {
+	running := &Config{
+		Server: ServerConfig{HTTPPort: 8080},
+		Apps: []AppConfig{
+			{Name: "web", Command: "./web", Port: 3000},
+			{Name: "worker", Command: "./worker"},
+			{Name: "api", Command: "./api", Port: 4000, Source: "conf.d/api.yaml"},
+		},
+	}
+	next := &Config{
+		Server: ServerConfig{HTTPPort: 9090},
+		Apps: []AppConfig{
+			{Name: "web", Command: "./web", Port: 3001},
+			{Name: "api", Command: "./api", Port: 4000},
+			{Name: "docs", Command: "./docs"},
+		},
+	}
+
+	changes := running.Diff(next)
+	want := Changes{Added: []string{"docs"}, Removed: []string{"worker"}, Changed: []string{"web"}, Sections: []string{"server"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Expected %+v, got %+v", want, changes)
+	}
+	if !running.Diff(running).Empty() {
+		t.Error("Expected no changes against itself")
+	}
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{APITokens: []APIToken{{Name: "ci", Token: "ci-token-0123456789"}}},
+		Apps: []AppConfig{{
+			Name: "web",
+			Environment: map[string]string{
+				"SESSION_SECRET": "hunter2",
+				"DATABASE_URL":   "postgres://app:hunter2@db/app",
+				"STRIPE_KEY":     "secret://vault/stripe",
+				"PORT":           "3000",
+			},
+		}},
+		Notifications: map[string]NotificationConfig{"ops": {Type: "slack", URL: "https://hooks.slack.com/services/T0/B0/hunter2"}},
+	}
+
+	redacted := cfg.Redacted()
+	env := redacted.Apps[0].Environment
+	for key, want := range map[string]string{
+		"SESSION_SECRET": Redacted,
+		"DATABASE_URL":   "postgres://app:" + Redacted + "@db/app",
+		"STRIPE_KEY":     "secret://vault/stripe",
+		"PORT":           "3000",
+	} {
+		if env[key] != want {
+			t.Errorf("%s: expected %q, got %q", key, want, env[key])
+		}
+	}
+	if redacted.Server.APITokens[0].Token != Redacted {
+		t.Errorf("Expected the api token redacted, got %q", redacted.Server.APITokens[0].Token)
+	}
+	if url := redacted.Notifications["ops"].URL; url != "https://hooks.slack.com/"+Redacted {
+		t.Errorf("Expected the webhook path redacted, got %q", url)
+	}
+	if cfg.Apps[0].Environment["SESSION_SECRET"] != "hunter2" || cfg.Server.APITokens[0].Token != "ci-token-0123456789" {
+		t.Error("Redacted changed the configuration it copied")
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for _, name := range []string{"TERM", "sigint", " SIGKILL "} {
+		if _, err := ParseSignal(name); err != nil {
+			t.Errorf("Expected %q to be supported everywhere: %v", name, err)
+		}
+	}
+	if _, err := ParseSignal("STOP"); err == nil {
+		t.Error("Expected STOP to be rejected")
+	}
+
+	// Validation accepts exactly what processes can be sent on this platform
+	cfg := &Config{Server: ServerConfig{HTTPPort: 8080, HTTPSPort: 8443}, Apps: []AppConfig{{Name: "web", Command: "web", StopSignal: "SIGQUIT"}}}
+	err := cfg.Validate()
+	if runtime.GOOS == "windows" && err == nil {
+		t.Error("Expected SIGQUIT to be rejected on Windows")
+	}
+	if runtime.GOOS != "windows" && err != nil {
+		t.Errorf("Expected SIGQUIT to be accepted: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Changes lists how a configuration differs from the one running
+type Changes struct {
+	Added    []string `json:"added,omitempty"`    // Apps only in the new configuration
+	Removed  []string `json:"removed,omitempty"`  // Apps only in the running configuration
+	Changed  []string `json:"changed,omitempty"`  // Apps defined differently
+	Sections []string `json:"sections,omitempty"` // Other top-level keys that differ, e.g. server or tls
+	Pending  []string `json:"pending,omitempty"`  // Apps whose changes wait for guvnor to restart
+}
+
+// Empty reports whether nothing changed
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 && len(c.Sections) == 0
+}
+
+// Diff compares the configuration next with c: apps by name, in the order of
+// the configuration they are in, and the other top-level keys as a whole
+func (c *Config) Diff(next *Config) Changes {
+	var changes Changes
+
+	running := make(map[string]AppConfig, len(c.Apps))
+	for _, app := range c.Apps {
+		running[app.Name] = app
+	}
+	defined := make(map[string]bool, len(next.Apps))
+	for _, app := range next.Apps {
+		defined[app.Name] = true
+		current, exists := running[app.Name]
+		switch {
+		case !exists:
+			changes.Added = append(changes.Added, app.Name)
+		case !sameApp(current, app):
+			changes.Changed = append(changes.Changed, app.Name)
+		}
+	}
+	for _, app := range c.Apps {
+		if !defined[app.Name] {
+			changes.Removed = append(changes.Removed, app.Name)
+		}
+	}
+
+	current, updated := reflect.ValueOf(*c), reflect.ValueOf(*next)
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if key == "-" || key == "apps" {
+			continue
+		}
+		if !reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			changes.Sections = append(changes.Sections, key)
+		}
+	}
+	return changes
+}
+
+// sameApp reports whether two apps are defined alike, wherever they were loaded from
+func sameApp(a, b AppConfig) bool {
+	a.Source, b.Source = "", ""
+	return reflect.DeepEqual(a, b)
+}
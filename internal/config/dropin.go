@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DropInDirName is the directory next to the configuration file holding app
+// drop-ins: one YAML file per app, loaded after the apps of the file
+const DropInDirName = "conf.d"
+
+// ErrAppExists is returned when an app is added under a name already in use
+var ErrAppExists = errors.New("already exists")
+
+// dropInName matches the app names that can be stored as drop-ins
+var dropInName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// DropInDir returns the drop-in directory of the configuration
+func (c *Config) DropInDir() string {
+	return filepath.Join(filepath.Dir(c.Path), DropInDirName)
+}
+
+// FileApps returns the number of apps defined in the configuration file
+// itself rather than in drop-ins
+func (c *Config) FileApps() int {
+	count := 0
+	for _, app := range c.Apps {
+		if app.Source == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// loadDropIns reads the apps of the *.yaml files in dir, in file name order
+func loadDropIns(dir string) ([]AppConfig, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var apps []AppConfig
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read drop-in: %w", err)
+		}
+		var app AppConfig
+		if err := yaml.Unmarshal(data, &app); err != nil {
+			return nil, fmt.Errorf("failed to parse drop-in %s: %w", file, err)
+		}
+		app.Source = file
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
+
+// ParseApp reads an app definition in YAML or JSON, with the keys of an app
+// in the configuration file. Unknown keys are refused.
+func ParseApp(data []byte) (AppConfig, error) {
+	var app AppConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&app); err != nil {
+		return AppConfig{}, fmt.Errorf("invalid app definition: %w", err)
+	}
+	return app, nil
+}
+
+// PrepareApp checks that app can be added to the configured apps and returns
+// it as Load would: with relative paths resolved against the configuration
+// file and defaults applied
+func (c *Config) PrepareApp(app AppConfig) (AppConfig, error) {
+	if !dropInName.MatchString(app.Name) {
+		return AppConfig{}, fmt.Errorf("invalid app name %q: use letters, digits, - and _", app.Name)
+	}
+	for _, configured := range c.Apps {
+		if configured.Name == app.Name {
+			return AppConfig{}, fmt.Errorf("app %s %w", app.Name, ErrAppExists)
+		}
+	}
+
+	// Validated as part of a copy, so it is checked against the other apps
+	candidate := *c
+	candidate.Apps = append(append([]AppConfig{}, c.Apps...), app)
+	if err := candidate.resolvePaths(filepath.Dir(c.Path)); err != nil {
+		return AppConfig{}, err
+	}
+	if err := candidate.Validate(); err != nil {
+		return AppConfig{}, err
+	}
+	return candidate.Apps[len(candidate.Apps)-1], nil
+}
+
+// WriteDropIn saves app to the drop-in directory and returns it with its Source set
+func (c *Config) WriteDropIn(app AppConfig) (AppConfig, error) {
+	data, err := yaml.Marshal(app)
+	if err != nil {
+		return AppConfig{}, err
+	}
+	dir := c.DropInDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return AppConfig{}, fmt.Errorf("failed to create drop-in directory: %w", err)
+	}
+
+	// Written aside and renamed so a crash never leaves half a drop-in
+	path := filepath.Join(dir, app.Name+".yaml")
+	tmp, err := os.CreateTemp(dir, "."+app.Name+"-*")
+	if err != nil {
+		return AppConfig{}, fmt.Errorf("failed to write drop-in: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return AppConfig{}, fmt.Errorf("failed to write drop-in: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return AppConfig{}, fmt.Errorf("failed to write drop-in: %w", err)
+	}
+
+	app.Source = path
+	return app, nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/secrets"
+)
+
+// Redacted replaces the values of secrets
+const Redacted = "REDACTED"
+
+// sensitiveNames are parts of variable and header names whose values are redacted
+var sensitiveNames = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH", "PRIVATE", "COOKIE", "SESSION"}
+
+// SensitiveName reports whether the name of a variable or header suggests
+// its value is a secret
+func SensitiveName(name string) bool {
+	name = strings.ToUpper(name)
+	for _, sensitive := range sensitiveNames {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactValue returns the value of a variable or header with a secret name
+// replaced, and the password of a URL value removed
+func RedactValue(name, value string) string {
+	if SensitiveName(name) {
+		return Redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), Redacted)
+			return u.String()
+		}
+	}
+	return value
+}
+
+// redactMap redacts the values of a map of variables or headers. secret://
+// references are kept: they name a secret without revealing it.
+func redactMap(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(values))
+	for name, value := range values {
+		if secrets.IsReference(value) {
+			redacted[name] = value
+			continue
+		}
+		redacted[name] = RedactValue(name, value)
+	}
+	return redacted
+}
+
+// redactSecret replaces a value that is a secret unless it is a secret:// reference
+func redactSecret(value string) string {
+	if value == "" || secrets.IsReference(value) {
+		return value
+	}
+	return Redacted
+}
+
+// redactURL keeps the scheme and host of a URL whose path or query may hold a
+// token, as webhook URLs do
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return redactSecret(value)
+	}
+	if u.Path == "" && u.RawQuery == "" && u.User == nil {
+		return value
+	}
+	return u.Scheme + "://" + u.Host + "/" + Redacted
+}
+
+// Redacted returns a copy of the configuration safe to show: API tokens,
+// debug tokens, ACME account keys, notification URLs and the values of secret
+// environment variables and headers are replaced
+func (c *Config) Redacted() *Config {
+	redacted := *c
+
+	if c.Server.APITokens != nil {
+		redacted.Server.APITokens = make([]APIToken, len(c.Server.APITokens))
+		for i, token := range c.Server.APITokens {
+			token.Token = redactSecret(token.Token)
+			redacted.Server.APITokens[i] = token
+		}
+	}
+	redacted.TLS.ACME.EAB.HMACKey = redactSecret(c.TLS.ACME.EAB.HMACKey)
+
+	redacted.Apps = make([]AppConfig, len(c.Apps))
+	for i, app := range c.Apps {
+		app.Environment = redactMap(app.Environment)
+		app.HealthCheck.Headers = redactMap(app.HealthCheck.Headers)
+		if app.HealthCheck.Webhook != "" {
+			app.HealthCheck.Webhook = redactURL(app.HealthCheck.Webhook)
+		}
+		app.Debug.Token = redactSecret(app.Debug.Token)
+		redacted.Apps[i] = app
+	}
+
+	if c.Notifications != nil {
+		redacted.Notifications = make(map[string]NotificationConfig, len(c.Notifications))
+		for name, sink := range c.Notifications {
+			sink.URL = redactURL(sink.URL)
+			sink.Headers = redactMap(sink.Headers)
+			redacted.Notifications[name] = sink
+		}
+	}
+	if c.Logs.Sinks != nil {
+		redacted.Logs.Sinks = make(map[string]LogSinkConfig, len(c.Logs.Sinks))
+		for name, sink := range c.Logs.Sinks {
+			sink.URL = RedactValue("url", sink.URL)
+			sink.Headers = redactMap(sink.Headers)
+			redacted.Logs.Sinks[name] = sink
+		}
+	}
+	return &redacted
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+	"syscall"
+)
+
+// signals maps the names usable in stop_signal and reload_signal to the signals they send
+var signals = map[string]os.Signal{
+	"TERM":  syscall.SIGTERM,
+	"INT":   syscall.SIGINT,
+	"QUIT":  syscall.SIGQUIT,
+	"HUP":   syscall.SIGHUP,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+	"KILL":  syscall.SIGKILL,
+}
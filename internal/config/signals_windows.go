@@ -0,0 +1,13 @@
+//go:build windows
+
+package config
+
+import "os"
+
+// signals maps the names usable in stop_signal and reload_signal to the
+// signals they send; Windows only delivers interrupts (CTRL_BREAK) and kills
+var signals = map[string]os.Signal{
+	"TERM": os.Interrupt,
+	"INT":  os.Interrupt,
+	"KILL": os.Kill,
+}
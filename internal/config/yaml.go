@@ -0,0 +1,279 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Comment annotates the key at a path in generated YAML. Paths are dotted
+// keys, with list items addressed by index: "server.http_port",
+// "apps.0.hostname". The empty path is the document itself, where Head is a
+// header and Foot trails the file.
+type Comment struct {
+	Head string // Lines above the key
+	Line string // After the value on the same line
+	Foot string // Lines below the value
+}
+
+// Marshal encodes config as YAML in schema order, attaching comments. Keys
+// left at their zero value are omitted unless loading the file would default
+// them to something else, or they carry a comment, so the output stays short
+// and loads back to the same configuration.
+func Marshal(config *Config, comments map[string]Comment) ([]byte, error) {
+	var root, defaults yaml.Node
+	if err := root.Encode(config); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := defaults.Encode(Defaults()); err != nil {
+		return nil, fmt.Errorf("failed to encode defaults: %w", err)
+	}
+	prune(&root, &defaults, "", comments)
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{&root}}
+	for path, comment := range comments {
+		if path == "" {
+			doc.HeadComment, doc.FootComment = comment.Head, comment.Foot
+			continue
+		}
+		key, value := lookup(&root, path)
+		if key == nil {
+			return nil, fmt.Errorf("comment on unknown key %q", path)
+		}
+		key.HeadComment = comment.Head
+		value.LineComment = comment.Line
+		value.FootComment = comment.Foot
+	}
+	return encode(doc)
+}
+
+// SetValue sets the key at path in a YAML document to value, parsed as YAML,
+// keeping the order and comments of everything else. Besides indexes, list
+// items can be addressed by name ("apps.web.port"). Missing keys are created
+// if the schema has them.
+func SetValue(data []byte, path, value string) ([]byte, error) {
+	segments := strings.Split(path, ".")
+	target, err := schemaType(reflect.TypeOf(Config{}), segments)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+		return nil, fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	replacement := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	if len(parsed.Content) > 0 {
+		replacement = parsed.Content[0]
+	}
+	// Keep "3" a string where the schema wants one, e.g. in environment
+	if target.Kind() == reflect.String && replacement.Kind == yaml.ScalarNode {
+		replacement.Tag = "!!str"
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+
+	node := doc.Content[0]
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch node.Kind {
+		case yaml.MappingNode:
+			var found *yaml.Node
+			for j := 0; j+1 < len(node.Content); j += 2 {
+				if node.Content[j].Value == segment {
+					found = node.Content[j+1]
+					if last {
+						// The old value's comment still describes the key
+						replacement.LineComment = found.LineComment
+						node.Content[j+1] = replacement
+					}
+					break
+				}
+			}
+			if found == nil {
+				found = &yaml.Node{Kind: yaml.MappingNode}
+				if last {
+					found = replacement
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: segment}, found)
+			}
+			node = found
+		case yaml.SequenceNode:
+			item := sequenceItem(node, segment)
+			if item < 0 {
+				return nil, fmt.Errorf("%s has no item %q", strings.Join(segments[:i], "."), segment)
+			}
+			if last {
+				node.Content[item] = replacement
+			}
+			node = node.Content[item]
+		default:
+			return nil, fmt.Errorf("%s is not a section", strings.Join(segments[:i], "."))
+		}
+	}
+	return encode(&doc)
+}
+
+func encode(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// prune drops zero-valued mapping keys whose default, if any, is zero too
+func prune(node, defaults *yaml.Node, path string, comments map[string]Comment) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinPath(path, key.Value)
+			_, defaultValue := lookup(defaults, key.Value)
+			prune(value, defaultValue, keyPath, comments)
+			if _, commented := comments[keyPath]; !commented && isZero(value) && (defaultValue == nil || isZero(defaultValue)) {
+				continue
+			}
+			content = append(content, key, value)
+		}
+		node.Content = content
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			prune(item, nil, joinPath(path, strconv.Itoa(i)), comments)
+		}
+	}
+}
+
+func isZero(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		return len(node.Content) == 0
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!null":
+			return true
+		case "!!str":
+			return node.Value == "" || node.Value == "0s"
+		case "!!int", "!!float":
+			return node.Value == "0"
+		case "!!bool":
+			return node.Value == "false"
+		}
+	}
+	return false
+}
+
+// lookup finds the key and value nodes at a dotted path below node
+func lookup(node *yaml.Node, path string) (*yaml.Node, *yaml.Node) {
+	if node == nil {
+		return nil, nil
+	}
+	var key *yaml.Node
+	for _, segment := range strings.Split(path, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var value *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == segment {
+					key, value = node.Content[i], node.Content[i+1]
+					break
+				}
+			}
+			if value == nil {
+				return nil, nil
+			}
+			node = value
+		case yaml.SequenceNode:
+			item := sequenceItem(node, segment)
+			if item < 0 {
+				return nil, nil
+			}
+			key, node = node.Content[item], node.Content[item]
+		default:
+			return nil, nil
+		}
+	}
+	return key, node
+}
+
+// sequenceItem finds a list item by index, or by the value of its name key
+func sequenceItem(node *yaml.Node, segment string) int {
+	if index, err := strconv.Atoi(segment); err == nil {
+		if index >= 0 && index < len(node.Content) {
+			return index
+		}
+		return -1
+	}
+	for i, item := range node.Content {
+		if _, name := lookup(item, "name"); name != nil && name.Value == segment {
+			return i
+		}
+	}
+	return -1
+}
+
+// schemaType resolves a dotted path against the yaml tags of t
+func schemaType(t reflect.Type, segments []string) (reflect.Type, error) {
+	for i, segment := range segments {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			if t == reflect.TypeOf(time.Time{}) {
+				return nil, fmt.Errorf("unknown config key %q", strings.Join(segments, "."))
+			}
+			field, ok := yamlField(t, segment)
+			if !ok {
+				return nil, fmt.Errorf("unknown config key %q", strings.Join(segments[:i+1], "."))
+			}
+			t = field
+		case reflect.Map, reflect.Slice:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("%s is not a section", strings.Join(segments[:i], "."))
+		}
+	}
+	return t, nil
+}
+
+func yamlField(t reflect.Type, name string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(field.Name)
+		}
+		if tag == name {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,213 @@
+// Package crash saves diagnostic bundles of apps that failed: their last log
+// lines, how they exited, their environment with secrets redacted, their
+// restart history and system metrics, so failures can be looked into after
+// the process and its logs are gone.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+	"github.com/gleicon/guvnor/internal/secrets"
+)
+
+// Files of a bundle
+const (
+	ReportFile = "report.json"
+	LogsFile   = "logs.txt"
+)
+
+// Redacted replaces the values of sensitive variables
+const Redacted = config.Redacted
+
+// Report describes a failure
+type Report struct {
+	ID             string            `json:"id"`
+	App            string            `json:"app"`
+	Instance       string            `json:"instance"`
+	Time           time.Time         `json:"time"`
+	Reason         string            `json:"reason"` // The event giving up on the app: failed or crashloop
+	Message        string            `json:"message,omitempty"`
+	PID            int               `json:"pid,omitempty"`
+	ExitCode       int               `json:"exit_code"`
+	Signal         string            `json:"signal,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	CoreDump       string            `json:"core_dump,omitempty"`
+	Command        string            `json:"command,omitempty"`
+	WorkingDir     string            `json:"working_dir,omitempty"`
+	Restarts       int               `json:"restarts"`
+	RestartHistory []time.Time       `json:"restart_history,omitempty"` // Restarts within the crash-loop window
+	Environment    map[string]string `json:"environment,omitempty"`
+	Usage          *process.Usage    `json:"usage,omitempty"` // Last sample before the exit
+	System         System            `json:"system"`
+	LogLines       int               `json:"log_lines"`
+}
+
+// SignalOf returns the signal named by a process exit error such as
+// "signal: killed", or "" when the process exited by itself
+func SignalOf(exitError string) string {
+	signal, found := strings.CutPrefix(exitError, "signal: ")
+	if !found {
+		return ""
+	}
+	return strings.TrimSuffix(signal, " (core dumped)")
+}
+
+// Redact returns a copy of env without secrets: the values of variables whose
+// names suggest one, of variables configured as secret:// references, and the
+// passwords of URLs
+func Redact(env, configured map[string]string) map[string]string {
+	redacted := make(map[string]string, len(env))
+	for key, value := range env {
+		if secrets.IsReference(configured[key]) {
+			redacted[key] = Redacted
+			continue
+		}
+		redacted[key] = config.RedactValue(key, value)
+	}
+	return redacted
+}
+
+// Store keeps bundles in a directory, each in a subdirectory named by its ID
+type Store struct {
+	dir  string
+	keep int
+}
+
+// NewStore returns a store in dir keeping the keep latest bundles, or all of
+// them when keep is 0
+func NewStore(dir string, keep int) *Store {
+	return &Store{dir: dir, keep: keep}
+}
+
+// Dir returns the directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes a bundle of the report and the log lines, setting the report's
+// ID, then removes the oldest bundles beyond the limit
+func (s *Store) Save(report *Report, entries []logs.LogEntry) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create crash report directory %s: %w", s.dir, err)
+	}
+
+	base := report.Time.UTC().Format("20060102-150405") + "-" + report.Instance
+	id, dir := base, ""
+	for n := 2; ; n++ {
+		dir = filepath.Join(s.dir, id)
+		err := os.Mkdir(dir, 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to create crash report %s: %w", dir, err)
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	report.ID = id
+	report.LogLines = len(entries)
+
+	var lines strings.Builder
+	for _, entry := range entries {
+		lines.WriteString(logs.Format(entry, false))
+		lines.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, LogsFile), []byte(lines.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write crash report logs: %w", err)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode crash report: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, ReportFile), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write crash report: %w", err)
+	}
+
+	return s.prune()
+}
+
+// prune removes the oldest bundles beyond the limit
+func (s *Store) prune() error {
+	if s.keep <= 0 {
+		return nil
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+	for len(ids) > s.keep {
+		if err := os.RemoveAll(filepath.Join(s.dir, ids[0])); err != nil {
+			return fmt.Errorf("failed to remove crash report %s: %w", ids[0], err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// ids returns the IDs of the bundles, oldest first since IDs start with the time
+func (s *Store) ids() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read crash reports: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			ids = append(ids, entry.Name())
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// List returns the reports of the bundles, newest first. Bundles that cannot
+// be read are left out.
+func (s *Store) List() ([]Report, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]Report, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		if report, err := s.Load(ids[i]); err == nil {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+// Load returns the report of a bundle
+func (s *Store) Load(id string) (Report, error) {
+	var report Report
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return report, fmt.Errorf("invalid crash report ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, id, ReportFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, fmt.Errorf("crash report %s not found", id)
+		}
+		return report, fmt.Errorf("failed to read crash report %s: %w", id, err)
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return report, fmt.Errorf("failed to parse crash report %s: %w", id, err)
+	}
+	return report, nil
+}
+
+// LogsPath returns the path of the log lines of a bundle
+func (s *Store) LogsPath(id string) string {
+	return filepath.Join(s.dir, id, LogsFile)
+}
@@ -0,0 +1,95 @@
+package crash
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+func TestRedact(t *testing.T) {
+	env := map[string]string{
+		"PORT":         "8080",
+		"API_TOKEN":    "abc",
+		"db_password":  "hunter2",
+		"DATABASE_URL": "postgres://app:hunter2@db:5432/app",
+		"STRIPE":       "sk_live_123",
+		"HOME_URL":     "https://example.com/",
+	}
+	redacted := Redact(env, map[string]string{"STRIPE": "secret://vault/stripe", "PORT": "8080"})
+
+	expected := map[string]string{
+		"PORT":         "8080",
+		"API_TOKEN":    Redacted,
+		"db_password":  Redacted,
+		"DATABASE_URL": "postgres://app:" + Redacted + "@db:5432/app",
+		"STRIPE":       Redacted,
+		"HOME_URL":     "https://example.com/",
+	}
+	for key, value := range expected {
+		if redacted[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, redacted[key])
+		}
+	}
+	if env["API_TOKEN"] != "abc" {
+		t.Error("Redact changed its input")
+	}
+}
+
+func TestSignalOf(t *testing.T) {
+	for exitError, signal := range map[string]string{
+		"signal: killed": "killed",
+		"signal: segmentation fault (core dumped)": "segmentation fault",
+		"exit status 1": "",
+	} {
+		if got := SignalOf(exitError); got != signal {
+			t.Errorf("SignalOf(%q) = %q, expected %q", exitError, got, signal)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(t.TempDir(), 2)
+	start := time.Date(2025, 9, 14, 21, 3, 12, 0, time.UTC)
+	entries := []logs.LogEntry{
+		{Timestamp: start, Level: "info", Process: "web", Message: "listening"},
+		{Timestamp: start, Level: "error", Process: "web", Message: "panic: nil map"},
+	}
+
+	var ids []string
+	for i, at := range []time.Time{start, start, start.Add(time.Minute)} {
+		report := &Report{App: "web", Instance: "web", Time: at, Reason: "failed", ExitCode: i}
+		if err := store.Save(report, entries); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		ids = append(ids, report.ID)
+	}
+	if ids[0] != "20250914-210312-web" || ids[1] != "20250914-210312-web-2" {
+		t.Errorf("Unexpected IDs %v", ids)
+	}
+
+	// Only the two latest are kept
+	reports, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(reports) != 2 || reports[0].ID != ids[2] || reports[1].ID != ids[1] {
+		t.Fatalf("Unexpected reports %+v", reports)
+	}
+	if reports[0].ExitCode != 2 || reports[0].LogLines != 2 {
+		t.Errorf("Unexpected report %+v", reports[0])
+	}
+	lines, err := os.ReadFile(store.LogsPath(ids[2]))
+	if err != nil || !strings.Contains(string(lines), "panic: nil map") {
+		t.Errorf("Unexpected log lines %q: %v", lines, err)
+	}
+
+	if _, err := store.Load(ids[0]); err == nil {
+		t.Error("Expected the oldest report to be removed")
+	}
+	if _, err := store.Load("../" + ids[2]); err == nil {
+		t.Error("Expected a path outside the store to be refused")
+	}
+}
@@ -0,0 +1,26 @@
+package crash
+
+import (
+	"os"
+	"runtime"
+)
+
+// System describes the host at the time of a failure
+type System struct {
+	Hostname        string    `json:"hostname,omitempty"`
+	OS              string    `json:"os"`
+	Arch            string    `json:"arch"`
+	CPUs            int       `json:"cpus"`
+	LoadAverage     []float64 `json:"load_average,omitempty"` // Over 1, 5 and 15 minutes
+	MemoryTotal     uint64    `json:"memory_total_bytes,omitempty"`
+	MemoryAvailable uint64    `json:"memory_available_bytes,omitempty"`
+}
+
+// ReadSystem returns the metrics of the host; those the platform does not
+// report are left empty
+func ReadSystem() System {
+	system := System{OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU()}
+	system.Hostname, _ = os.Hostname()
+	readPlatformSystem(&system)
+	return system
+}
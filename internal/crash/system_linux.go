@@ -0,0 +1,46 @@
+package crash
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readPlatformSystem reads the load average and memory from /proc
+func readPlatformSystem(system *System) {
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		for i := 0; i < 3 && i < len(fields); i++ {
+			load, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				break
+			}
+			system.LoadAverage = append(system.LoadAverage, load)
+		}
+	}
+
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines look like "MemTotal:       16318412 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			system.MemoryTotal = kb * 1024
+		case "MemAvailable:":
+			system.MemoryAvailable = kb * 1024
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package crash
+
+// readPlatformSystem has nothing to add on this platform
+func readPlatformSystem(system *System) {}
@@ -0,0 +1,248 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed standard five-field cron expression
+// (minute hour day-of-month month day-of-week)
+type Schedule struct {
+	minutes  uint64 // bits 0-59
+	hours    uint64 // bits 0-23
+	days     uint64 // bits 1-31
+	months   uint64 // bits 1-12
+	weekdays uint64 // bits 0-6 (Sunday = 0)
+	domStar  bool   // Day-of-month field was "*"
+	dowStar  bool   // Day-of-week field was "*"
+	raw      string
+}
+
+// field describes the valid range and aliases of a cron field
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	dayField    = field{name: "day-of-month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	weekdayField = field{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// descriptors maps predefined schedules to their five-field equivalent
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression such as "*/5 * * * *", "0 8 * * 1-5" or "@daily"
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if descriptor, exists := descriptors[strings.ToLower(spec)]; exists {
+		spec = descriptor
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{raw: strings.TrimSpace(expr)}
+	var err error
+
+	if s.minutes, err = parseField(fields[0], minuteField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if s.hours, err = parseField(fields[1], hourField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if s.days, err = parseField(fields[2], dayField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if s.months, err = parseField(fields[3], monthField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+	if s.weekdays, err = parseField(fields[4], weekdayField); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+	}
+
+	// Sunday may be written as 7
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+		s.weekdays &^= 1 << 7
+	}
+
+	s.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	s.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bitset
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(value, ",") {
+		if part == "" {
+			return 0, fmt.Errorf("empty %s value", f.name)
+		}
+
+		rangePart, step := part, 1
+		if idx := strings.Index(part, "/"); idx != -1 {
+			n, err := strconv.Atoi(part[idx+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, part[idx+1:])
+			}
+			rangePart, step = part[:idx], n
+		}
+
+		start, end := f.min, f.max
+		if rangePart != "*" {
+			if idx := strings.Index(rangePart, "-"); idx != -1 {
+				var err error
+				if start, err = f.value(rangePart[:idx]); err != nil {
+					return 0, err
+				}
+				if end, err = f.value(rangePart[idx+1:]); err != nil {
+					return 0, err
+				}
+			} else {
+				var err error
+				if start, err = f.value(rangePart); err != nil {
+					return 0, err
+				}
+				end = start
+				if step > 1 {
+					end = f.max
+				}
+			}
+		}
+
+		if start > end {
+			return 0, fmt.Errorf("invalid %s range %q", f.name, rangePart)
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+// value parses a single number or name within the field's range
+func (f field) value(s string) (int, error) {
+	if n, exists := f.names[strings.ToLower(s)]; exists {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q", f.name, s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("%s value %d out of range %d-%d", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// String returns the original expression
+func (s *Schedule) String() string {
+	return s.raw
+}
+
+// Matches reports whether the schedule fires at the given minute
+func (s *Schedule) Matches(t time.Time) bool {
+	return s.minutes&(1<<uint(t.Minute())) != 0 &&
+		s.hours&(1<<uint(t.Hour())) != 0 &&
+		s.months&(1<<uint(t.Month())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches applies cron's day-of-month / day-of-week OR semantics
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.days&(1<<uint(t.Day())) != 0
+	dow := s.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after t at which the schedule fires.
+// It returns the zero time if no match exists within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// Prev returns the latest time at or before t at which the schedule fired.
+// It returns the zero time if no match exists within the five years before t.
+func (s *Schedule) Prev(t time.Time) time.Time {
+	t = t.Truncate(time.Minute)
+	limit := t.AddDate(-5, 0, 0)
+
+	// Skip back to the last minute of the previous month, day or hour that
+	// does not match, as Next skips forward to the first
+	for t.After(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(-time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
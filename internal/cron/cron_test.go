@@ -0,0 +1,64 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	base := time.Date(2025, time.March, 14, 10, 7, 30, 0, time.UTC) // Friday
+
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"*/5 * * * *", time.Date(2025, time.March, 14, 10, 10, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2025, time.March, 17, 8, 0, 0, 0, time.UTC)},
+		{"0 20 * * *", time.Date(2025, time.March, 14, 20, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * sun", time.Date(2025, time.March, 16, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.expr, tt.expected, got)
+		}
+	}
+}
+
+func TestSchedule_Prev(t *testing.T) {
+	now := time.Date(2025, time.March, 16, 12, 0, 30, 0, time.UTC) // Sunday
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"0 8 * * 1-5", time.Date(2025, time.March, 14, 8, 0, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2025, time.March, 16, 12, 0, 0, 0, time.UTC)},
+		{"30 23 * * *", time.Date(2025, time.March, 15, 23, 30, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 6 1 7 *", time.Date(2024, time.July, 1, 6, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Prev(now); !got.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.expr, tt.expected, got)
+		}
+	}
+}
@@ -18,6 +18,7 @@ type App struct {
 	Port        int               `json:"port" yaml:"port"`
 	Command     string            `json:"command" yaml:"command"`
 	Args        []string          `json:"args" yaml:"args"`
+	Shell       bool              `json:"shell,omitempty" yaml:"shell,omitempty"` // Command is a line for the shell
 	Env         map[string]string `json:"env" yaml:"env"`
 	HealthCheck string            `json:"health_check" yaml:"health_check"`
 	Domain      string            `json:"domain,omitempty" yaml:"domain,omitempty"`
@@ -0,0 +1,450 @@
+// Package doctor diagnoses the environment guvnor runs in: whether it can
+// listen on its ports, whether its hostnames point at this machine and its
+// ACME CA is reachable, and limits, container runtime, leftover PID files
+// and clock skew that break things later on.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+	"github.com/gleicon/guvnor/internal/proxy"
+	"github.com/gleicon/guvnor/internal/tlsaudit"
+)
+
+const (
+	// MinOpenFiles is the open file limit below which a busy proxy runs out of descriptors
+	MinOpenFiles = 4096
+
+	// clockWarning and clockFailure are the clock skews reported; certificates
+	// and ACME requests are checked against the time, to the minute or so
+	clockWarning = 10 * time.Second
+	clockFailure = 5 * time.Minute
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn" // Works, but likely to cause trouble
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip" // Does not apply to this config or machine
+)
+
+// Check is one diagnosed property of the environment
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"` // What to do about a warning or failure
+}
+
+// Failed reports whether any check failed
+func Failed(checks []Check) bool {
+	for _, check := range checks {
+		if check.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// Doctor checks the environment of the server of a config
+type Doctor struct {
+	Config        *config.Config
+	ServerRunning bool          // The server of Config answers, so it holds its ports
+	PIDFile       string        // The server's PID file
+	Resolver      string        // DNS server hostnames are resolved through (default: tlsaudit.DefaultResolver)
+	Timeout       time.Duration // Per network check (default: 10s)
+
+	// Overridable in tests
+	lookup        func(ctx context.Context, host string) ([]string, error)
+	localAddrs    func() ([]net.Addr, error)
+	listen        func(port int) error
+	openFileLimit func() (uint64, error)
+	caTime        func(ctx context.Context) (time.Time, time.Duration, error)
+	pidDir        string
+}
+
+// Run runs every check
+func (d *Doctor) Run(ctx context.Context) []Check {
+	checks := d.checkPorts()
+	checks = append(checks, d.checkDNS(ctx)...)
+	checks = append(checks, d.checkCA(ctx)...)
+	checks = append(checks,
+		d.checkOpenFiles(),
+		d.checkContainers(ctx),
+		d.checkServerPIDFile(),
+		d.checkAppPIDFiles(),
+	)
+	return checks
+}
+
+func (d *Doctor) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return 10 * time.Second
+}
+
+// checkPorts checks the proxy can listen on its ports
+func (d *Doctor) checkPorts() []Check {
+	ports := []struct {
+		name string
+		port int
+	}{{"HTTP", d.Config.Server.HTTPPort}}
+	if d.Config.TLS.Enabled {
+		ports = append(ports, struct {
+			name string
+			port int
+		}{"HTTPS", d.Config.Server.HTTPSPort})
+	}
+
+	var checks []Check
+	for _, p := range ports {
+		check := Check{Name: strings.ToLower(p.name) + " port"}
+		if d.ServerRunning {
+			check.Status, check.Detail = StatusPass, fmt.Sprintf("port %d is served by the running guvnor server", p.port)
+			checks = append(checks, check)
+			continue
+		}
+		listen := d.listen
+		if listen == nil {
+			listen = listenPort
+		}
+		if err := listen(p.port); err != nil {
+			bindErr := &proxy.BindError{Listener: p.name, Port: p.port, Err: err}
+			check.Status, check.Detail, check.Fix = StatusFail, bindErr.Error(), bindErr.Hint()
+		} else {
+			check.Status, check.Detail = StatusPass, fmt.Sprintf("port %d can be listened on", p.port)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func listenPort(port int) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
+
+// checkDNS checks the public hostnames served over TLS resolve to this
+// machine, which HTTP-01 challenges need
+func (d *Doctor) checkDNS(ctx context.Context) []Check {
+	hosts := tlsaudit.Hostnames(d.Config)
+	if len(hosts) == 0 {
+		return []Check{{Name: "dns", Status: StatusSkip, Detail: "no public hostnames served over TLS"}}
+	}
+
+	local, err := d.addresses()
+	if err != nil {
+		return []Check{{Name: "dns", Status: StatusWarn, Detail: fmt.Sprintf("failed to list the addresses of this machine: %v", err)}}
+	}
+	var checks []Check
+	for _, host := range hosts {
+		check := Check{Name: "dns " + host}
+		addrs, err := d.resolve(ctx, host)
+		switch {
+		case err != nil:
+			check.Status, check.Detail = StatusFail, err.Error()
+			check.Fix = fmt.Sprintf("Create an A (or AAAA) record for %s pointing at this server's public address", host)
+		case containsAny(local, addrs):
+			check.Status, check.Detail = StatusPass, fmt.Sprintf("%s, this machine", strings.Join(addrs, ", "))
+		default:
+			check.Status = StatusWarn
+			check.Detail = fmt.Sprintf("%s, not an address of this machine", strings.Join(addrs, ", "))
+			check.Fix = fmt.Sprintf("Point %s at this server, unless it is reached through NAT or a load balancer "+
+				"forwarding ports 80 and 443 here", host)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (d *Doctor) resolve(ctx context.Context, host string) ([]string, error) {
+	if d.lookup != nil {
+		return d.lookup(ctx, host)
+	}
+
+	server := d.Resolver
+	if server == "" {
+		server = tlsaudit.DefaultResolver
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout())
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s through %s: %w", host, server, err)
+	}
+	return addrs, nil
+}
+
+// addresses returns the IP addresses of this machine's interfaces
+func (d *Doctor) addresses() (map[string]bool, error) {
+	list := d.localAddrs
+	if list == nil {
+		list = net.InterfaceAddrs
+	}
+	addrs, err := list()
+	if err != nil {
+		return nil, err
+	}
+	local := make(map[string]bool)
+	for _, addr := range addrs {
+		if prefix, ok := addr.(*net.IPNet); ok {
+			local[prefix.IP.String()] = true
+		}
+	}
+	return local, nil
+}
+
+func containsAny(set map[string]bool, values []string) bool {
+	for _, value := range values {
+		if ip := net.ParseIP(value); ip != nil && set[ip.String()] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCA checks the ACME directory answers, and compares the clock to the
+// time it reports
+func (d *Doctor) checkCA(ctx context.Context) []Check {
+	acmeCheck := Check{Name: "acme"}
+	settings, err := d.Config.TLS.ACMESettings(ctx, d.Config.SecretResolver())
+	if err != nil {
+		acmeCheck.Status, acmeCheck.Detail = StatusFail, err.Error()
+		return []Check{acmeCheck, {Name: "clock", Status: StatusSkip, Detail: "no ACME directory to compare with"}}
+	}
+	directory := settings.Directory()
+
+	caTime := d.caTime
+	if caTime == nil {
+		caTime = func(ctx context.Context) (time.Time, time.Duration, error) {
+			return d.fetchCATime(ctx, settings)
+		}
+	}
+	remote, skew, err := caTime(ctx)
+
+	switch {
+	case len(tlsaudit.Hostnames(d.Config)) == 0:
+		acmeCheck.Status, acmeCheck.Detail = StatusSkip, "no certificates requested from an ACME CA"
+	case err != nil:
+		acmeCheck.Status, acmeCheck.Detail = StatusFail, err.Error()
+		acmeCheck.Fix = fmt.Sprintf("Allow outgoing HTTPS to %s (set HTTPS_PROXY when a proxy is required), "+
+			"or use DNS-01 through tls.acme_dns when this machine cannot be reached", hostOf(directory))
+	default:
+		acmeCheck.Status, acmeCheck.Detail = StatusPass, directory+" answers"
+	}
+
+	clockCheck := Check{Name: "clock"}
+	switch magnitude := skew.Abs(); {
+	case err != nil && acmeCheck.Status == StatusSkip:
+		clockCheck.Status, clockCheck.Detail = StatusSkip, fmt.Sprintf("could not compare with %s: %v", hostOf(directory), err)
+	case err != nil:
+		clockCheck.Status, clockCheck.Detail = StatusWarn, "could not compare with "+hostOf(directory)
+		clockCheck.Fix = "See the acme check"
+	case magnitude < clockWarning:
+		clockCheck.Status, clockCheck.Detail = StatusPass, fmt.Sprintf("within %s of %s", clockWarning, hostOf(directory))
+	default:
+		clockCheck.Status = StatusWarn
+		if magnitude >= clockFailure {
+			clockCheck.Status = StatusFail
+		}
+		direction := "ahead of"
+		if skew < 0 {
+			direction = "behind"
+		}
+		clockCheck.Detail = fmt.Sprintf("%s %s %s (%s)", magnitude.Round(time.Second), direction,
+			hostOf(directory), remote.UTC().Format(time.RFC1123))
+		clockCheck.Fix = "Keep the clock in sync with NTP: sudo timedatectl set-ntp true on Linux, " +
+			"Set time automatically in the date settings on macOS and Windows"
+	}
+	return []Check{acmeCheck, clockCheck}
+}
+
+// fetchCATime requests the ACME directory and returns the time in its Date
+// header, and how far the clock is off from it
+func (d *Doctor) fetchCATime(ctx context.Context, settings cert.ACME) (time.Time, time.Duration, error) {
+	acmeClient, err := settings.Client()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	client := &http.Client{Timeout: d.timeout()}
+	if acmeClient.HTTPClient != nil {
+		client.Transport = acmeClient.HTTPClient.Transport
+	}
+	directory := settings.Directory()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, directory, nil)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	sent := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("cannot reach the ACME directory: %w", err)
+	}
+	resp.Body.Close()
+	received := time.Now()
+	if resp.StatusCode != http.StatusOK {
+		return time.Time{}, 0, fmt.Errorf("ACME directory %s answered %s", directory, resp.Status)
+	}
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("ACME directory %s sent no usable Date header", directory)
+	}
+	// The header has second precision and was written around the middle of the request
+	local := sent.Add(received.Sub(sent) / 2)
+	return remote, local.Sub(remote).Truncate(time.Second), nil
+}
+
+func hostOf(rawURL string) string {
+	if rest, ok := strings.CutPrefix(rawURL, "https://"); ok {
+		rawURL = rest
+	}
+	host, _, _ := strings.Cut(rawURL, "/")
+	return host
+}
+
+// checkOpenFiles checks the open file limit leaves room for proxied connections
+func (d *Doctor) checkOpenFiles() Check {
+	check := Check{Name: "open files"}
+	limitFn := d.openFileLimit
+	if limitFn == nil {
+		limitFn = openFileLimit
+	}
+	limit, err := limitFn()
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		check.Status, check.Detail = StatusSkip, "no open file limit on this platform"
+	case err != nil:
+		check.Status, check.Detail = StatusWarn, fmt.Sprintf("failed to read the open file limit: %v", err)
+	case limit < MinOpenFiles:
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("limit is %d; every proxied connection holds two descriptors", limit)
+		check.Fix = fmt.Sprintf("Raise the hard limit to at least %d: ulimit -Hn 65536 before guvnor start, "+
+			"LimitNOFILE=65536 in a systemd unit, or nofile in /etc/security/limits.conf", MinOpenFiles)
+	default:
+		check.Status, check.Detail = StatusPass, fmt.Sprintf("limit is %d", limit)
+	}
+	return check
+}
+
+// checkContainers checks a container runtime answers when apps need one
+func (d *Doctor) checkContainers(ctx context.Context) Check {
+	check := Check{Name: "containers"}
+	var apps []string
+	for _, app := range d.Config.Apps {
+		if app.Container.Enabled() {
+			apps = append(apps, app.Name)
+		}
+	}
+	if len(apps) == 0 {
+		check.Status, check.Detail = StatusSkip, "no container apps"
+		return check
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.timeout())
+	defer cancel()
+	name, err := process.DetectContainerRuntime(ctx, d.Config.Execution)
+	if err != nil {
+		check.Status, check.Detail = StatusFail, err.Error()
+		check.Fix = fmt.Sprintf("Container apps (%s) need a runtime: install and start Docker or Podman "+
+			"(sudo systemctl start docker), add your user to the docker group, or set execution.socket", strings.Join(apps, ", "))
+		return check
+	}
+	check.Status, check.Detail = StatusPass, name+" answers"
+	return check
+}
+
+// checkServerPIDFile checks the server's PID file names the running server
+func (d *Doctor) checkServerPIDFile() Check {
+	check := Check{Name: "server pid"}
+	pid, err := readPID(d.PIDFile)
+	switch {
+	case d.PIDFile == "" || errors.Is(err, os.ErrNotExist):
+		check.Status, check.Detail = StatusPass, "no server PID file"
+		if d.ServerRunning {
+			check.Status, check.Detail = StatusWarn, "the server runs, but without a PID file"
+			check.Fix = "Restart it with a current guvnor, so guvnor daemon can find it"
+		}
+	case err != nil:
+		check.Status, check.Detail = StatusWarn, err.Error()
+		check.Fix = "Remove " + d.PIDFile
+	case !process.Alive(pid):
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("%s names pid %d, which is not running (guvnor crashed or was killed)", d.PIDFile, pid)
+		check.Fix = "Remove it with: guvnor daemon stop"
+	case !d.ServerRunning:
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("%s names pid %d, but no server answers for this config", d.PIDFile, pid)
+		check.Fix = "See guvnor daemon status and the server log; if the pid is not guvnor, remove " + d.PIDFile
+	default:
+		check.Status, check.Detail = StatusPass, fmt.Sprintf("pid %d is the running server", pid)
+	}
+	return check
+}
+
+// checkAppPIDFiles checks for PID files of apps that are gone, left by a
+// server that did not stop them
+func (d *Doctor) checkAppPIDFiles() Check {
+	check := Check{Name: "app pids"}
+	dir := d.pidDir
+	if dir == "" {
+		dir = process.PIDDir()
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.pid"))
+	var stale []string
+	for _, file := range files {
+		if pid, err := readPID(file); err != nil || !process.Alive(pid) {
+			stale = append(stale, strings.TrimSuffix(filepath.Base(file), ".pid"))
+		}
+	}
+	switch {
+	case len(stale) == 0:
+		check.Status, check.Detail = StatusPass, fmt.Sprintf("%d PID files in %s, all running", len(files), dir)
+	case d.ServerRunning:
+		check.Status, check.Detail = StatusPass, fmt.Sprintf("%d of %d PID files in %s belong to exited processes", len(stale), len(files), dir)
+	default:
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("PID files of exited processes in %s: %s", dir, strings.Join(stale, ", "))
+		check.Fix = "guvnor start forgets them; they only matter when a PID is reused by another program"
+	}
+	return check
+}
+
+func readPID(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
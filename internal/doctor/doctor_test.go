@@ -0,0 +1,128 @@
+package doctor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+func testDoctor(t *testing.T, cfg *config.Config) *Doctor {
+	t.Helper()
+	return &Doctor{
+		Config:  cfg,
+		PIDFile: filepath.Join(t.TempDir(), "guvnor.pid"),
+		lookup: func(ctx context.Context, host string) ([]string, error) {
+			switch host {
+			case "here.example.com":
+				return []string{"192.0.2.10"}, nil
+			case "elsewhere.example.com":
+				return []string{"198.51.100.7"}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+		localAddrs: func() ([]net.Addr, error) {
+			return []net.Addr{&net.IPNet{IP: net.ParseIP("192.0.2.10"), Mask: net.CIDRMask(24, 32)}}, nil
+		},
+		listen:        func(port int) error { return nil },
+		openFileLimit: func() (uint64, error) { return 1 << 20, nil },
+		caTime: func(ctx context.Context) (time.Time, time.Duration, error) {
+			return time.Now(), 0, nil
+		},
+		pidDir: t.TempDir(),
+	}
+}
+
+func statuses(checks []Check) map[string]Status {
+	result := make(map[string]Status)
+	for _, check := range checks {
+		result[check.Name] = check.Status
+	}
+	return result
+}
+
+func TestRun(t *testing.T) {
+	cfg := &config.Config{
+		Server: config.ServerConfig{HTTPPort: 80, HTTPSPort: 443},
+		TLS:    config.TLSConfig{Enabled: true},
+		Apps: []config.AppConfig{
+			{Name: "here", Hostname: "here.example.com"},
+			{Name: "elsewhere", Hostname: "elsewhere.example.com"},
+			{Name: "missing", Hostname: "missing.example.com"},
+			{Name: "local", Hostname: "app.localhost"},
+		},
+	}
+	d := testDoctor(t, cfg)
+
+	checks := d.Run(context.Background())
+	want := map[string]Status{
+		"http port":                 StatusPass,
+		"https port":                StatusPass,
+		"dns here.example.com":      StatusPass,
+		"dns elsewhere.example.com": StatusWarn,
+		"dns missing.example.com":   StatusFail,
+		"acme":                      StatusPass,
+		"clock":                     StatusPass,
+		"open files":                StatusPass,
+		"containers":                StatusSkip,
+		"server pid":                StatusPass,
+		"app pids":                  StatusPass,
+	}
+	got := statuses(checks)
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("Expected %s to %s, got %q", name, status, got[name])
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Expected %d checks, got %+v", len(want), checks)
+	}
+	if !Failed(checks) {
+		t.Error("Expected the missing DNS record to fail the run")
+	}
+	for _, check := range checks {
+		if check.Status != StatusPass && check.Status != StatusSkip && check.Fix == "" {
+			t.Errorf("Expected a fix for %s", check.Name)
+		}
+	}
+}
+
+func TestRunFindsProblems(t *testing.T) {
+	cfg := &config.Config{Server: config.ServerConfig{HTTPPort: 80}}
+	d := testDoctor(t, cfg)
+	d.listen = func(port int) error {
+		return &net.OpError{Op: "listen", Net: "tcp", Err: os.NewSyscallError("bind", syscall.EACCES)}
+	}
+	d.openFileLimit = func() (uint64, error) { return 1024, nil }
+	d.caTime = func(ctx context.Context) (time.Time, time.Duration, error) {
+		return time.Now().Add(-time.Hour), time.Hour, nil
+	}
+
+	// A PID file of a process that is gone, from a server killed with -9
+	dead := strconv.Itoa(1 << 22)
+	os.WriteFile(d.PIDFile, []byte(dead), 0644)
+	os.WriteFile(filepath.Join(d.pidDir, "web.pid"), []byte(dead), 0644)
+
+	got := statuses(d.Run(context.Background()))
+	want := map[string]Status{
+		"http port":  StatusFail,
+		"dns":        StatusSkip,
+		"acme":       StatusSkip,
+		"clock":      StatusFail,
+		"open files": StatusWarn,
+		"server pid": StatusWarn,
+		"app pids":   StatusWarn,
+	}
+	for name, status := range want {
+		if got[name] != status {
+			t.Errorf("Expected %s to %s, got %q", name, status, got[name])
+		}
+	}
+}
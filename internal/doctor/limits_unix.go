@@ -0,0 +1,15 @@
+//go:build !windows
+
+package doctor
+
+import "syscall"
+
+// openFileLimit returns the hard limit on open files, which the Go runtime
+// raises the soft limit to at startup
+func openFileLimit() (uint64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, err
+	}
+	return uint64(limit.Max), nil
+}
@@ -0,0 +1,8 @@
+package doctor
+
+import "errors"
+
+// openFileLimit is not limited on Windows beyond available memory
+func openFileLimit() (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -46,12 +46,29 @@ func LoadDotEnv(baseDir string) (*EnvConfig, error) {
 
 // loadEnvFile loads a single .env file
 func loadEnvFile(path string, config *EnvConfig) error {
-	file, err := os.Open(path)
+	variables, err := ReadFile(path)
 	if err != nil {
 		return err
 	}
+	
+	for key, value := range variables {
+		// Only set if not already defined (precedence: OS env > .env files)
+		if _, exists := os.LookupEnv(key); !exists {
+			config.Variables[key] = value
+		}
+	}
+	return nil
+}
+
+// ReadFile parses the KEY=value lines of a .env file
+func ReadFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 	
+	variables := make(map[string]string)
 	scanner := bufio.NewScanner(file)
 	lineNum := 0
 	
@@ -67,22 +84,17 @@ func loadEnvFile(path string, config *EnvConfig) error {
 		// Parse key=value format
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid format at line %d: %s", lineNum, line)
+			return nil, fmt.Errorf("invalid format at line %d of %s: %s", lineNum, path, line)
 		}
 		
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 		
 		// Remove quotes if present
-		value = removeQuotes(value)
-		
-		// Only set if not already defined (precedence: OS env > .env files)
-		if _, exists := os.LookupEnv(key); !exists {
-			config.Variables[key] = value
-		}
+		variables[key] = removeQuotes(value)
 	}
 	
-	return scanner.Err()
+	return variables, scanner.Err()
 }
 
 // ApplyEnv applies environment variables to the current process
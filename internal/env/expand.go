@@ -0,0 +1,64 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expand replaces ${NAME} references in value with what lookup returns for
+// NAME, and ${NAME:-default} with default when NAME is unset or empty. $${
+// stands for a literal ${; a $ not followed by { is kept as is, so values
+// such as passwords containing $ need no escaping. Referencing an unset
+// variable without a default is an error.
+func Expand(value string, lookup func(name string) (string, bool)) (string, error) {
+	if !strings.Contains(value, "${") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if strings.HasPrefix(value[i:], "$${") {
+			b.WriteString("${")
+			i += 2
+			continue
+		}
+		if !strings.HasPrefix(value[i:], "${") {
+			b.WriteByte(value[i])
+			continue
+		}
+
+		end := strings.IndexByte(value[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", value)
+		}
+		ref := value[i+2 : i+end]
+		name, fallback, hasFallback := strings.Cut(ref, ":-")
+		if !validName(name) {
+			return "", fmt.Errorf("invalid variable name %q in %q", name, value)
+		}
+
+		v, ok := lookup(name)
+		switch {
+		case hasFallback && v == "":
+			v = fallback
+		case !ok:
+			return "", fmt.Errorf("${%s} is not set", name)
+		}
+		b.WriteString(v)
+		i += end
+	}
+	return b.String(), nil
+}
+
+// validName reports whether name is a valid environment variable name
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+// Package events carries lifecycle events between guvnor's subsystems: process
+// starts, stops, crashes and restarts, health transitions and certificate
+// renewals. Publishers never block on subscribers.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Event types
+const (
+	Started           = "started"             // A process started, including after a restart
+	Stopped           = "stopped"             // A process was stopped on request
+	Crashed           = "crashed"             // A process exited with an error while it should be running
+	Restarted         = "restarted"           // A process was restarted after a crash, on request or by a rolling restart
+	CrashLoop         = "crashloop"           // A process crashed too often within its crash-loop window and is not restarted
+	Failed            = "failed"              // A process crashed after using up max_retries and is not restarted
+	Health            = "health"              // An instance moved between healthy and unhealthy
+	CertRenewed       = "cert_renewed"        // A certificate was issued or renewed
+	CertRenewalFailed = "cert_renewal_failed" // A certificate due for renewal was not renewed
+	CertExpiring      = "cert_expiring"       // A served certificate is close to expiry or has expired
+)
+
+// Types lists every event type
+var Types = []string{Started, Stopped, Crashed, Restarted, CrashLoop, Failed, Health, CertRenewed, CertRenewalFailed, CertExpiring}
+
+// queueSize is how many events a slow subscriber may fall behind before
+// events to it are dropped
+const queueSize = 256
+
+// Event is something that happened to an app, an instance or a certificate
+type Event struct {
+	Type     string            `json:"type"`
+	App      string            `json:"app,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Message  string            `json:"message"`
+	Time     time.Time         `json:"time"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// Handler receives the events of a subscription
+type Handler func(Event)
+
+// Bus fans events out to subscribers
+type Bus struct {
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	logger        *logrus.Entry
+}
+
+// subscription delivers events to one handler, in order, from its own goroutine
+type subscription struct {
+	types  map[string]bool // Nil for all types
+	queue  chan Event
+	closed bool
+}
+
+// NewBus creates an event bus
+func NewBus(logger *logrus.Logger) *Bus {
+	return &Bus{
+		subscriptions: make(map[*subscription]struct{}),
+		logger:        logger.WithField("component", "events"),
+	}
+}
+
+// Subscribe calls handler with every event of the given types, or of all types
+// when none are given, and returns a function ending the subscription. Handlers
+// run one event at a time, so a slow handler only delays its own events.
+func (b *Bus) Subscribe(handler Handler, types ...string) func() {
+	sub := &subscription{queue: make(chan Event, queueSize)}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscriptions[sub] = struct{}{}
+	b.mu.Unlock()
+
+	go func() {
+		for event := range sub.queue {
+			handler(event)
+		}
+	}()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if !sub.closed {
+			sub.closed = true
+			delete(b.subscriptions, sub)
+			close(sub.queue)
+		}
+	}
+}
+
+// Publish hands event to its subscribers, dropping it for those that fell too
+// far behind
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if sub.types != nil && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.queue <- event:
+		default:
+			b.logger.WithFields(logrus.Fields{"type": event.Type, "app": event.App}).Warn("Subscriber is not keeping up, dropping event")
+		}
+	}
+}
+
+// Known reports whether eventType is one of Types
+func Known(eventType string) bool {
+	for _, t := range Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
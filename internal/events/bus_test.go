@@ -0,0 +1,52 @@
+package events
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestBus_SubscribeByType(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	bus := NewBus(logger)
+
+	crashes := make(chan Event, 10)
+	unsubscribe := bus.Subscribe(func(e Event) { crashes <- e }, Crashed, CrashLoop)
+	all := make(chan Event, 10)
+	bus.Subscribe(func(e Event) { all <- e })
+
+	bus.Publish(Event{Type: Started, App: "web"})
+	bus.Publish(Event{Type: Crashed, App: "web", Fields: map[string]string{"exit_code": "1"}})
+
+	receive := func(events chan Event) Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("Timed out waiting for an event")
+			return Event{}
+		}
+	}
+
+	if e := receive(crashes); e.Type != Crashed || e.Fields["exit_code"] != "1" || e.Time.IsZero() {
+		t.Errorf("Expected the crash with a timestamp, got %+v", e)
+	}
+	if first, second := receive(all), receive(all); first.Type != Started || second.Type != Crashed {
+		t.Errorf("Expected all events in order, got %s then %s", first.Type, second.Type)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(Event{Type: CrashLoop, App: "web"})
+	select {
+	case e, ok := <-crashes:
+		if ok {
+			t.Errorf("Expected no events after unsubscribing, got %s", e.Type)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,172 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// Supported check export formats
+const (
+	FormatUptimeKuma         = "uptime-kuma"
+	FormatPrometheusBlackbox = "prometheus-blackbox"
+)
+
+// Check describes an externally probed endpoint for one served hostname
+type Check struct {
+	App      string
+	Hostname string
+	URL      string
+	Interval int // Seconds
+}
+
+// CollectChecks builds one check per hostname served by guvnor
+func CollectChecks(cfg *config.Config) []Check {
+	var checks []Check
+
+	for _, app := range cfg.Apps {
+		hostname := app.Hostname
+		if hostname == "" {
+			hostname = app.Domain
+		}
+		if hostname == "" {
+			continue
+		}
+
+		scheme := "http"
+		port := cfg.Server.HTTPPort
+		if cfg.TLS.Enabled && (app.TLS.Enabled || cfg.TLS.ForceHTTPS) {
+			scheme = "https"
+			port = cfg.Server.HTTPSPort
+		}
+
+		host := hostname
+		if (scheme == "http" && port != 80) || (scheme == "https" && port != 443) {
+			host = fmt.Sprintf("%s:%d", hostname, port)
+		}
+
+		path := "/"
+		if app.HealthCheck.Enabled && app.HealthCheck.Path != "" {
+			path = app.HealthCheck.Path
+		}
+
+		interval := int(app.HealthCheck.Interval.Seconds())
+		if interval <= 0 {
+			interval = 60
+		}
+
+		checks = append(checks, Check{
+			App:      app.Name,
+			Hostname: hostname,
+			URL:      fmt.Sprintf("%s://%s%s", scheme, host, path),
+			Interval: interval,
+		})
+	}
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Hostname < checks[j].Hostname })
+	return checks
+}
+
+// Checks renders check definitions in the requested format
+func Checks(cfg *config.Config, format string, blackboxAddr string) ([]byte, error) {
+	checks := CollectChecks(cfg)
+
+	switch strings.ToLower(format) {
+	case FormatUptimeKuma:
+		return uptimeKuma(checks)
+	case FormatPrometheusBlackbox:
+		return prometheusBlackbox(checks, blackboxAddr)
+	default:
+		return nil, fmt.Errorf("unknown format %q (supported: %s, %s)", format, FormatUptimeKuma, FormatPrometheusBlackbox)
+	}
+}
+
+// uptimeKuma renders an Uptime Kuma backup document importable via Settings > Backup
+func uptimeKuma(checks []Check) ([]byte, error) {
+	monitors := make([]map[string]interface{}, 0, len(checks))
+	for i, check := range checks {
+		monitors = append(monitors, map[string]interface{}{
+			"id":                   i + 1,
+			"name":                 fmt.Sprintf("%s (%s)", check.App, check.Hostname),
+			"type":                 "http",
+			"url":                  check.URL,
+			"method":               "GET",
+			"interval":             check.Interval,
+			"retryInterval":        check.Interval,
+			"maxretries":           1,
+			"active":               true,
+			"accepted_statuscodes": []string{"200-299"},
+			"description":          "Managed by guvnor export checks",
+		})
+	}
+
+	doc := map[string]interface{}{
+		"version":          "1.23.0",
+		"notificationList": []interface{}{},
+		"monitorList":      monitors,
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// prometheusBlackbox renders a Prometheus scrape config probing every hostname via blackbox_exporter
+func prometheusBlackbox(checks []Check, blackboxAddr string) ([]byte, error) {
+	if blackboxAddr == "" {
+		blackboxAddr = "127.0.0.1:9115"
+	}
+
+	type staticConfig struct {
+		Targets []string          `yaml:"targets"`
+		Labels  map[string]string `yaml:"labels"`
+	}
+	type relabelConfig struct {
+		SourceLabels []string `yaml:"source_labels,omitempty"`
+		TargetLabel  string   `yaml:"target_label"`
+		Replacement  string   `yaml:"replacement,omitempty"`
+	}
+	type scrapeConfig struct {
+		JobName        string              `yaml:"job_name"`
+		MetricsPath    string              `yaml:"metrics_path"`
+		Params         map[string][]string `yaml:"params"`
+		StaticConfigs  []staticConfig      `yaml:"static_configs"`
+		RelabelConfigs []relabelConfig     `yaml:"relabel_configs"`
+	}
+
+	job := scrapeConfig{
+		JobName:     "guvnor-blackbox",
+		MetricsPath: "/probe",
+		Params:      map[string][]string{"module": {"http_2xx"}},
+		RelabelConfigs: []relabelConfig{
+			{SourceLabels: []string{"__address__"}, TargetLabel: "__param_target"},
+			{SourceLabels: []string{"__param_target"}, TargetLabel: "instance"},
+			{TargetLabel: "__address__", Replacement: blackboxAddr},
+		},
+	}
+
+	for _, check := range checks {
+		job.StaticConfigs = append(job.StaticConfigs, staticConfig{
+			Targets: []string{check.URL},
+			Labels: map[string]string{
+				"app":      check.App,
+				"hostname": check.Hostname,
+			},
+		})
+	}
+
+	doc := map[string]interface{}{
+		"scrape_configs": []scrapeConfig{job},
+	}
+
+	data, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal blackbox config: %w", err)
+	}
+
+	header := "# Prometheus scrape config generated by guvnor export checks\n"
+	return append([]byte(header), data...), nil
+}
@@ -0,0 +1,185 @@
+package export
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// testChecksConfig serves apps on the usual ports, with TLS enabled for those asking
+func testChecksConfig(apps ...config.AppConfig) *config.Config {
+	cfg := &config.Config{Apps: apps}
+	cfg.Server.HTTPPort = 80
+	cfg.Server.HTTPSPort = 443
+	cfg.TLS.Enabled = true
+	return cfg
+}
+
+func TestCollectChecks(t *testing.T) {
+	health := config.HealthCheckConfig{Enabled: true, Path: "/healthz", Interval: 15 * time.Second}
+	tls := config.AppTLSConfig{Enabled: true}
+
+	tests := []struct {
+		name     string
+		app      config.AppConfig
+		edit     func(cfg *config.Config)
+		expected []Check
+	}{
+		{"plain HTTP", config.AppConfig{Name: "web", Hostname: "web.example.com"}, nil,
+			[]Check{{"web", "web.example.com", "http://web.example.com/", 60}}},
+		{"deprecated domain", config.AppConfig{Name: "web", Domain: "old.example.com"}, nil,
+			[]Check{{"web", "old.example.com", "http://old.example.com/", 60}}},
+		{"hostname over domain", config.AppConfig{Name: "web", Hostname: "new.example.com", Domain: "old.example.com"}, nil,
+			[]Check{{"web", "new.example.com", "http://new.example.com/", 60}}},
+		{"no hostname", config.AppConfig{Name: "worker"}, nil, nil},
+		{"app TLS", config.AppConfig{Name: "web", Hostname: "web.example.com", TLS: tls}, nil,
+			[]Check{{"web", "web.example.com", "https://web.example.com/", 60}}},
+		{"app TLS without server TLS", config.AppConfig{Name: "web", Hostname: "web.example.com", TLS: tls},
+			func(cfg *config.Config) { cfg.TLS.Enabled = false },
+			[]Check{{"web", "web.example.com", "http://web.example.com/", 60}}},
+		{"forced HTTPS", config.AppConfig{Name: "web", Hostname: "web.example.com"},
+			func(cfg *config.Config) { cfg.TLS.ForceHTTPS = true },
+			[]Check{{"web", "web.example.com", "https://web.example.com/", 60}}},
+		{"other HTTP port", config.AppConfig{Name: "web", Hostname: "web.example.com"},
+			func(cfg *config.Config) { cfg.Server.HTTPPort = 8080 },
+			[]Check{{"web", "web.example.com", "http://web.example.com:8080/", 60}}},
+		{"other HTTPS port", config.AppConfig{Name: "web", Hostname: "web.example.com", TLS: tls},
+			func(cfg *config.Config) { cfg.Server.HTTPPort, cfg.Server.HTTPSPort = 8080, 8443 },
+			[]Check{{"web", "web.example.com", "https://web.example.com:8443/", 60}}},
+		{"HTTPS on port 80", config.AppConfig{Name: "web", Hostname: "web.example.com", TLS: tls},
+			func(cfg *config.Config) { cfg.Server.HTTPSPort = 80 },
+			[]Check{{"web", "web.example.com", "https://web.example.com:80/", 60}}},
+		{"health check", config.AppConfig{Name: "web", Hostname: "web.example.com", HealthCheck: health}, nil,
+			[]Check{{"web", "web.example.com", "http://web.example.com/healthz", 15}}},
+		{"disabled health check", config.AppConfig{Name: "web", Hostname: "web.example.com",
+			HealthCheck: config.HealthCheckConfig{Path: "/healthz", Interval: 15 * time.Second}}, nil,
+			[]Check{{"web", "web.example.com", "http://web.example.com/", 15}}},
+		{"health check without path", config.AppConfig{Name: "web", Hostname: "web.example.com",
+			HealthCheck: config.HealthCheckConfig{Enabled: true, Interval: 15 * time.Second}}, nil,
+			[]Check{{"web", "web.example.com", "http://web.example.com/", 15}}},
+		{"sub-second interval", config.AppConfig{Name: "web", Hostname: "web.example.com",
+			HealthCheck: config.HealthCheckConfig{Enabled: true, Interval: 500 * time.Millisecond}}, nil,
+			[]Check{{"web", "web.example.com", "http://web.example.com/", 60}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testChecksConfig(tt.app)
+			if tt.edit != nil {
+				tt.edit(cfg)
+			}
+			if got := CollectChecks(cfg); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+
+	// Checks are sorted by hostname, whatever the order of the apps
+	cfg := testChecksConfig(
+		config.AppConfig{Name: "web", Hostname: "www.example.com"},
+		config.AppConfig{Name: "worker"},
+		config.AppConfig{Name: "api", Hostname: "api.example.com"})
+	var hostnames []string
+	for _, check := range CollectChecks(cfg) {
+		hostnames = append(hostnames, check.Hostname)
+	}
+	if got := strings.Join(hostnames, ","); got != "api.example.com,www.example.com" {
+		t.Errorf("Expected checks sorted by hostname, got %s", got)
+	}
+}
+
+func TestChecks(t *testing.T) {
+	cfg := testChecksConfig(
+		config.AppConfig{Name: "web", Hostname: "www.example.com", TLS: config.AppTLSConfig{Enabled: true}},
+		config.AppConfig{Name: "api", Hostname: "api.example.com",
+			HealthCheck: config.HealthCheckConfig{Enabled: true, Path: "/health", Interval: 30 * time.Second}})
+
+	t.Run(FormatUptimeKuma, func(t *testing.T) {
+		data, err := Checks(cfg, "Uptime-Kuma", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Version          string           `json:"version"`
+			NotificationList []any            `json:"notificationList"`
+			MonitorList      []map[string]any `json:"monitorList"`
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+		if doc.Version == "" || doc.NotificationList == nil || len(doc.MonitorList) != 2 {
+			t.Fatalf("Expected a backup with two monitors, got %s", data)
+		}
+		api := doc.MonitorList[0]
+		expected := map[string]any{
+			"id": 1.0, "name": "api (api.example.com)", "type": "http", "url": "http://api.example.com/health",
+			"method": "GET", "interval": 30.0, "retryInterval": 30.0, "maxretries": 1.0, "active": true,
+			"accepted_statuscodes": []any{"200-299"}, "description": "Managed by guvnor export checks",
+		}
+		if !reflect.DeepEqual(api, expected) {
+			t.Errorf("Expected %v, got %v", expected, api)
+		}
+		if web := doc.MonitorList[1]; web["id"] != 2.0 || web["url"] != "https://www.example.com/" || web["interval"] != 60.0 {
+			t.Errorf("Expected the web monitor second, got %v", web)
+		}
+	})
+
+	t.Run(FormatPrometheusBlackbox, func(t *testing.T) {
+		for _, addr := range []string{"", "blackbox:9115"} {
+			data, err := Checks(cfg, FormatPrometheusBlackbox, addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), "# Prometheus scrape config") {
+				t.Errorf("Expected a header comment, got %s", data)
+			}
+			var doc struct {
+				ScrapeConfigs []struct {
+					JobName       string              `yaml:"job_name"`
+					MetricsPath   string              `yaml:"metrics_path"`
+					Params        map[string][]string `yaml:"params"`
+					StaticConfigs []struct {
+						Targets []string          `yaml:"targets"`
+						Labels  map[string]string `yaml:"labels"`
+					} `yaml:"static_configs"`
+					RelabelConfigs []struct {
+						SourceLabels []string `yaml:"source_labels"`
+						TargetLabel  string   `yaml:"target_label"`
+						Replacement  string   `yaml:"replacement"`
+					} `yaml:"relabel_configs"`
+				} `yaml:"scrape_configs"`
+			}
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("Invalid YAML: %v", err)
+			}
+			if len(doc.ScrapeConfigs) != 1 {
+				t.Fatalf("Expected one scrape config, got %s", data)
+			}
+			job := doc.ScrapeConfigs[0]
+			if job.JobName != "guvnor-blackbox" || job.MetricsPath != "/probe" || !reflect.DeepEqual(job.Params["module"], []string{"http_2xx"}) {
+				t.Errorf("Expected a blackbox probe job, got %+v", job)
+			}
+			if len(job.StaticConfigs) != 2 || job.StaticConfigs[0].Targets[0] != "http://api.example.com/health" ||
+				!reflect.DeepEqual(job.StaticConfigs[1].Labels, map[string]string{"app": "web", "hostname": "www.example.com"}) {
+				t.Errorf("Expected a target per check, got %+v", job.StaticConfigs)
+			}
+			expected := addr
+			if expected == "" {
+				expected = "127.0.0.1:9115"
+			}
+			last := job.RelabelConfigs[len(job.RelabelConfigs)-1]
+			if last.TargetLabel != "__address__" || last.Replacement != expected {
+				t.Errorf("Expected probes sent to %s, got %+v", expected, last)
+			}
+		}
+	})
+
+	if _, err := Checks(cfg, "nagios", ""); err == nil || !strings.Contains(err.Error(), FormatUptimeKuma) {
+		t.Errorf("Expected an unknown format to list the supported ones, got %v", err)
+	}
+}
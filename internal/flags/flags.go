@@ -0,0 +1,168 @@
+package flags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// EnvPrefix starts the environment variable each flag is exposed as
+const EnvPrefix = "FLAG_"
+
+// validKey restricts flag names to what maps cleanly onto environment variables
+var validKey = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Store keeps per-app feature flags in a JSON file
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	flags map[string]map[string]string // app -> key -> value
+}
+
+// Open loads the store at path; a missing file is an empty store
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, flags: make(map[string]map[string]string)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read flags: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.flags); err != nil {
+		return nil, fmt.Errorf("failed to parse flags %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns a copy of an app's flags
+func (s *Store) Get(app string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flags := make(map[string]string, len(s.flags[app]))
+	for key, value := range s.flags[app] {
+		flags[key] = value
+	}
+	return flags
+}
+
+// All returns a copy of the flags of every app that has any
+func (s *Store) All() map[string]map[string]string {
+	s.mu.RLock()
+	apps := make([]string, 0, len(s.flags))
+	for app := range s.flags {
+		apps = append(apps, app)
+	}
+	s.mu.RUnlock()
+
+	all := make(map[string]map[string]string, len(apps))
+	for _, app := range apps {
+		all[app] = s.Get(app)
+	}
+	return all
+}
+
+// Update sets and removes flags of an app and saves the store. It returns the
+// app's flags afterwards.
+func (s *Store) Update(app string, set map[string]string, unset []string) (map[string]string, error) {
+	for key := range set {
+		if !validKey.MatchString(key) {
+			return nil, fmt.Errorf("invalid flag name %q (use letters, digits, _ . -)", key)
+		}
+	}
+
+	s.mu.Lock()
+	flags := s.flags[app]
+	if flags == nil {
+		flags = make(map[string]string)
+	}
+	for key, value := range set {
+		flags[key] = value
+	}
+	for _, key := range unset {
+		delete(flags, key)
+	}
+	if len(flags) == 0 {
+		delete(s.flags, app)
+	} else {
+		s.flags[app] = flags
+	}
+	err := s.save()
+	s.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(app), nil
+}
+
+// Environment returns an app's flags as FLAG_<NAME> environment variables
+func (s *Store) Environment(app string) map[string]string {
+	flags := s.Get(app)
+	env := make(map[string]string, len(flags))
+	for key, value := range flags {
+		env[EnvName(key)] = value
+	}
+	return env
+}
+
+// EnvName is the environment variable a flag is exposed as: dark-mode becomes FLAG_DARK_MODE
+func EnvName(key string) string {
+	return EnvPrefix + strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, strings.ToUpper(key))
+}
+
+// ParseAssignments parses key=value arguments
+func ParseAssignments(args []string) (map[string]string, error) {
+	set := make(map[string]string, len(args))
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid flag %q, expected key=value", arg)
+		}
+		set[key] = value
+	}
+	return set, nil
+}
+
+// Keys returns the sorted names of a flag set
+func Keys(flags map[string]string) []string {
+	keys := make([]string, 0, len(flags))
+	for key := range flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// save writes the store atomically; the caller holds s.mu
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(s.flags, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create flags directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write flags: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write flags: %w", err)
+	}
+	return nil
+}
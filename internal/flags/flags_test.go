@@ -0,0 +1,41 @@
+package flags
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "flags.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if _, err := store.Update("web", map[string]string{"new-ui": "on", "beta": "1"}, nil); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	flags, err := store.Update("web", nil, []string{"beta"})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if len(flags) != 1 || flags["new-ui"] != "on" {
+		t.Errorf("Unexpected flags %v", flags)
+	}
+	if _, err := store.Update("web", map[string]string{"bad key": "x"}, nil); err == nil {
+		t.Error("Expected invalid flag name to be refused")
+	}
+
+	// Flags survive reopening the store
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	env := reopened.Environment("web")
+	if len(env) != 1 || env["FLAG_NEW_UI"] != "on" {
+		t.Errorf("Unexpected environment %v", env)
+	}
+	if len(reopened.All()) != 1 {
+		t.Errorf("Expected one app with flags, got %v", reopened.All())
+	}
+}
@@ -0,0 +1,158 @@
+// Package freeze decides whether a deployment freeze window is in effect
+package freeze
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// kind tells how often a window recurs
+type kind int
+
+const (
+	once   kind = iota // Between two dates
+	daily              // Between two times of day
+	weekly             // Between two times of the week, e.g. Fri 16:00 to Mon 08:00
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+)
+
+// Window is a recurring or one-off period during which changes are frozen
+type Window struct {
+	kind     kind
+	from, to int       // Minute of the day or week for recurring windows
+	start    time.Time // Bounds of one-off windows
+	end      time.Time
+	loc      *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// dateLayouts are accepted for one-off windows
+var dateLayouts = []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"}
+
+// Parse parses a window between from and to, both written as "Fri 16:00"
+// (weekly), "16:00" (daily) or "2025-12-24 00:00" (once). Times are in timezone,
+// an IANA name, or local time when it is empty.
+func Parse(from, to, timezone string) (*Window, error) {
+	loc := time.Local
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+	}
+
+	w := &Window{loc: loc}
+	fromKind, err := w.parsePoint(from, true)
+	if err != nil {
+		return nil, err
+	}
+	toKind, err := w.parsePoint(to, false)
+	if err != nil {
+		return nil, err
+	}
+	if fromKind != toKind {
+		return nil, fmt.Errorf("from %q and to %q must use the same format", from, to)
+	}
+	w.kind = fromKind
+
+	if w.kind == once {
+		if !w.end.After(w.start) {
+			return nil, fmt.Errorf("window from %q to %q ends before it starts", from, to)
+		}
+	} else if w.from == w.to {
+		return nil, fmt.Errorf("window from %q to %q is empty", from, to)
+	}
+	return w, nil
+}
+
+// parsePoint parses one end of the window into w and returns its kind
+func (w *Window) parsePoint(value string, start bool) (kind, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("freeze window needs both from and to")
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, value, w.loc); err == nil {
+			if start {
+				w.start = t
+			} else {
+				w.end = t
+			}
+			return once, nil
+		}
+	}
+
+	minute, k := 0, daily
+	clock := value
+	if day, rest, found := strings.Cut(value, " "); found {
+		weekday, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+		if !ok {
+			return 0, fmt.Errorf("invalid weekday in %q", value)
+		}
+		minute, k, clock = int(weekday)*minutesPerDay, weekly, strings.TrimSpace(rest)
+	}
+
+	hours, minutes, found := strings.Cut(clock, ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !found || errH != nil || errM != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q, use \"Fri 16:00\", \"16:00\" or \"2025-12-24 00:00\"", value)
+	}
+	minute += h*60 + m
+
+	if start {
+		w.from = minute
+	} else {
+		w.to = minute
+	}
+	return k, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w *Window) Contains(t time.Time) bool {
+	if w.kind == once {
+		return !t.Before(w.start) && t.Before(w.end)
+	}
+
+	m := w.minute(t)
+	if w.from < w.to {
+		return m >= w.from && m < w.to
+	}
+	// The window wraps around the end of the day or week
+	return m >= w.from || m < w.to
+}
+
+// End returns when the occurrence of the window containing t ends
+func (w *Window) End(t time.Time) time.Time {
+	if w.kind == once {
+		return w.end
+	}
+
+	period := minutesPerDay
+	if w.kind == weekly {
+		period = minutesPerWeek
+	}
+	remaining := (w.to - w.minute(t) + period) % period
+	return t.In(w.loc).Truncate(time.Minute).Add(time.Duration(remaining) * time.Minute)
+}
+
+// minute returns the minute of the day or week of t in the window's timezone
+func (w *Window) minute(t time.Time) int {
+	t = t.In(w.loc)
+	minute := t.Hour()*60 + t.Minute()
+	if w.kind == weekly {
+		minute += int(t.Weekday()) * minutesPerDay
+	}
+	return minute
+}
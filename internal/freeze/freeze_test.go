@@ -0,0 +1,64 @@
+package freeze
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow_Weekly(t *testing.T) {
+	w, err := Parse("Fri 16:00", "Mon 08:00", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+
+	// 2025-09-12 is a Friday
+	cases := map[string]bool{
+		"2025-09-12T15:59:00Z": false,
+		"2025-09-12T16:00:00Z": true,
+		"2025-09-13T12:00:00Z": true, // Saturday
+		"2025-09-15T07:59:00Z": true, // Monday morning
+		"2025-09-15T08:00:00Z": false,
+		"2025-09-17T12:00:00Z": false, // Wednesday
+	}
+	for value, want := range cases {
+		at, _ := time.Parse(time.RFC3339, value)
+		if got := w.Contains(at); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", value, got, want)
+		}
+	}
+
+	at, _ := time.Parse(time.RFC3339, "2025-09-13T12:30:00Z")
+	if end := w.End(at); !end.Equal(time.Date(2025, 9, 15, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the window to end Monday 08:00, got %s", end)
+	}
+}
+
+func TestWindow_DailyAndOnce(t *testing.T) {
+	nightly, err := Parse("22:00", "06:00", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse daily window: %v", err)
+	}
+	if !nightly.Contains(time.Date(2025, 9, 12, 23, 0, 0, 0, time.UTC)) || nightly.Contains(time.Date(2025, 9, 12, 12, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected result for the nightly window")
+	}
+
+	holidays, err := Parse("2025-12-24", "2026-01-02 09:00", "UTC")
+	if err != nil {
+		t.Fatalf("Failed to parse one-off window: %v", err)
+	}
+	if !holidays.Contains(time.Date(2025, 12, 31, 12, 0, 0, 0, time.UTC)) || holidays.Contains(time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Error("Unexpected result for the one-off window")
+	}
+
+	for _, invalid := range [][2]string{
+		{"Fri 16:00", "08:00"},
+		{"Fri 25:00", "Mon 08:00"},
+		{"Someday 16:00", "Mon 08:00"},
+		{"2026-01-02", "2025-12-24"},
+		{"16:00", "16:00"},
+	} {
+		if _, err := Parse(invalid[0], invalid[1], "UTC"); err == nil {
+			t.Errorf("Expected %s to %s to be rejected", invalid[0], invalid[1])
+		}
+	}
+}
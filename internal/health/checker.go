@@ -2,8 +2,12 @@ package health
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
+	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -30,6 +34,12 @@ type Result struct {
 	Error      string        `json:"error,omitempty"`
 	Timestamp  time.Time     `json:"timestamp"`
 	Duration   time.Duration `json:"duration"`
+	// Streak of the liveness check, which restarts the app at FailureThreshold failures
+	ConsecutiveSuccesses int `json:"consecutive_successes"`
+	ConsecutiveFailures  int `json:"consecutive_failures"`
+	FailureThreshold     int `json:"failure_threshold,omitempty"`
+	// When the status last changed, e.g. from healthy to unhealthy
+	LastTransition time.Time `json:"last_transition,omitempty"`
 }
 
 // Checker manages health checks for all applications
@@ -39,17 +49,54 @@ type Checker struct {
 	logger         *logrus.Entry
 	mu             sync.RWMutex
 	client         *http.Client
+	insecureClient *http.Client // Used for https checks with tls_skip_verify
+	onTransition   TransitionHook
+	probes         map[string]*probeState // Per instance, reset whenever it restarts
+	watched        map[string]*watch      // Running probes by "instance/kind"
 }
 
+// watch is a running probe loop
+type watch struct {
+	cancel      context.CancelFunc
+	healthCheck config.HealthCheckConfig // Checks restart when an instance is replaced with a different one
+}
+
+// probeState tracks the probes of one process instance since it started
+type probeState struct {
+	startedAt time.Time
+	started   bool // Startup probe passed, or there is none
+	ready     bool
+	successes map[string]int // Consecutive successes by probe kind
+	failures  map[string]int // Consecutive failures by probe kind
+}
+
+// probeKinds are started in this order
+var probeKinds = []string{config.ProbeStartup, config.ProbeReadiness, config.ProbeLiveness}
+
+// resyncInterval is how often the checker compares its probes with the process
+// table, in case it missed an event
+const resyncInterval = 30 * time.Second
+
+// TransitionHook is called when an app moves between healthy and unhealthy
+type TransitionHook func(appName string, previous, current Result)
+
 // NewChecker creates a new health checker
 func NewChecker(processManager *process.Manager, logger *logrus.Logger) *Checker {
 	return &Checker{
 		processManager: processManager,
 		results:        make(map[string]*Result),
+		probes:         make(map[string]*probeState),
+		watched:        make(map[string]*watch),
 		logger:         logger.WithField("component", "health-checker"),
 		client: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		insecureClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
 	}
 }
 
@@ -57,15 +104,111 @@ func NewChecker(processManager *process.Manager, logger *logrus.Logger) *Checker
 func (c *Checker) Start(ctx context.Context) {
 	c.logger.Info("Starting health checker")
 	
-	processes := c.processManager.ListProcesses()
+	// Subscribe first, so no instance starts unnoticed between the two
+	events, unsubscribe := c.processManager.Subscribe()
+	c.watchProcesses(ctx)
+	
+	// Follow instances started and removed later, e.g. through the API or by scaling
+	go func() {
+		defer unsubscribe()
+		ticker := time.NewTicker(resyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-events:
+				switch event.Type {
+				case process.EventAdded:
+					c.watch(ctx, event.Name, event.Process.Config.HealthCheck)
+				case process.EventRemoved:
+					c.unwatch(event.Name)
+				}
+			case <-ticker.C:
+				c.watchProcesses(ctx)
+			}
+		}
+	}()
+}
+
+// watchProcesses starts the probes of processes not probed yet
+func (c *Checker) watchProcesses(ctx context.Context) {
+	for appName, proc := range c.processManager.ListProcesses() {
+		c.watch(ctx, appName, proc.Config.HealthCheck)
+	}
+}
+
+// watch runs the enabled probes of an instance, restarting those already
+// running if its health check configuration changed
+func (c *Checker) watch(ctx context.Context, appName string, healthCheck config.HealthCheckConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	
-	for appName, proc := range processes {
-		if proc.Config.HealthCheck.Enabled {
-			go c.checkApp(ctx, appName, proc.Config.HealthCheck)
+	for _, kind := range probeKinds {
+		key := appName + "/" + kind
+		probe, enabled := healthCheck.Probe(kind)
+		if running := c.watched[key]; running != nil {
+			if enabled && reflect.DeepEqual(running.healthCheck, healthCheck) {
+				continue
+			}
+			running.cancel()
+			delete(c.watched, key)
+		}
+		if !enabled {
+			continue
 		}
+		
+		probeCtx, cancel := context.WithCancel(ctx)
+		w := &watch{cancel: cancel, healthCheck: healthCheck}
+		c.watched[key] = w
+		go c.checkApp(probeCtx, w, appName, kind, healthCheck, probe)
 	}
 }
 
+// unwatch stops the probes of an instance removed from the process table and
+// forgets its results
+func (c *Checker) unwatch(appName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	for _, kind := range probeKinds {
+		if running := c.watched[appName+"/"+kind]; running != nil {
+			running.cancel()
+			delete(c.watched, appName+"/"+kind)
+		}
+	}
+	delete(c.probes, appName)
+	delete(c.results, appName)
+}
+
+// SetTransitionHook registers a callback invoked on healthy/unhealthy transitions
+func (c *Checker) SetTransitionHook(hook TransitionHook) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	c.onTransition = hook
+}
+
+// storeResult records a result and fires the transition hook when the status flips
+func (c *Checker) storeResult(appName string, result *Result) *Result {
+	c.mu.Lock()
+	previous := c.results[appName]
+	if previous == nil || previous.Status != result.Status {
+		result.LastTransition = result.Timestamp
+	} else {
+		result.LastTransition = previous.LastTransition
+	}
+	c.results[appName] = result
+	hook := c.onTransition
+	c.mu.Unlock()
+	
+	if hook != nil && previous != nil && previous.Status != StatusUnknown && previous.Status != result.Status {
+		go hook(appName, *previous, *result)
+	}
+	
+	return previous
+}
+
 // GetResult returns the latest health check result for an app
 func (c *Checker) GetResult(appName string) (*Result, bool) {
 	c.mu.RLock()
@@ -105,7 +248,15 @@ func (c *Checker) CheckApp(appName string, healthCheck config.HealthCheckConfig,
 	}
 	
 	// Build health check URL
-	url := fmt.Sprintf("http://localhost:%d%s", port, healthCheck.Path)
+	scheme := healthCheck.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	address := healthCheck.Address
+	if address == "" {
+		address = "localhost"
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(address, strconv.Itoa(port)), healthCheck.Path)
 	
 	// Create request with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), healthCheck.Timeout)
@@ -122,9 +273,19 @@ func (c *Checker) CheckApp(appName string, healthCheck config.HealthCheckConfig,
 	// Add health check headers
 	req.Header.Set("User-Agent", "guvnor-healthcheck/1.0")
 	req.Header.Set("Accept", "application/json,text/plain,*/*")
+	for key, value := range healthCheck.Headers {
+		req.Header.Set(key, value)
+	}
+	if healthCheck.Host != "" {
+		req.Host = healthCheck.Host
+	}
 	
 	// Perform request
-	resp, err := c.client.Do(req)
+	client := c.client
+	if scheme == "https" && healthCheck.TLSSkipVerify {
+		client = c.insecureClient
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		result.Status = StatusUnhealthy
 		result.Error = fmt.Sprintf("request failed: %v", err)
@@ -154,19 +315,31 @@ func (c *Checker) CheckApp(appName string, healthCheck config.HealthCheckConfig,
 	return result
 }
 
-// checkApp runs continuous health checks for an application
-func (c *Checker) checkApp(ctx context.Context, appName string, healthCheck config.HealthCheckConfig) {
-	logger := c.logger.WithField("app", appName)
-	logger.WithField("interval", healthCheck.Interval).Info("Starting health checks")
+// checkApp runs one kind of probe for an application until it is removed or ctx ends
+func (c *Checker) checkApp(ctx context.Context, w *watch, appName, kind string, healthCheck config.HealthCheckConfig, probe config.ProbeConfig) {
+	logger := c.logger.WithFields(logrus.Fields{"app": appName, "probe": kind})
+	logger.WithField("interval", probe.Interval).Info("Starting health checks")
+	
+	defer func() {
+		c.mu.Lock()
+		// A replacement loop may have taken the key already
+		if c.watched[appName+"/"+kind] == w {
+			delete(c.watched, appName+"/"+kind)
+		}
+		c.mu.Unlock()
+		w.cancel()
+	}()
 	
-	ticker := time.NewTicker(healthCheck.Interval)
+	ticker := time.NewTicker(probe.Interval)
 	defer ticker.Stop()
 	
-	// Perform initial check after a short delay to let the app start
-	select {
-	case <-ctx.Done():
-		return
-	case <-time.After(5 * time.Second):
+	// Without a startup probe, give the app a moment before judging its liveness
+	if _, startup := healthCheck.Probe(config.ProbeStartup); kind == config.ProbeLiveness && !startup {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
 	}
 	
 	for {
@@ -175,112 +348,210 @@ func (c *Checker) checkApp(ctx context.Context, appName string, healthCheck conf
 			logger.Info("Stopping health checks")
 			return
 		case <-ticker.C:
-			c.performCheck(ctx, appName, healthCheck)
+			if !c.performCheck(ctx, appName, kind, healthCheck, probe) {
+				logger.Info("Process removed, stopping health checks")
+				return
+			}
 		}
 	}
 }
 
-// performCheck performs a health check and handles the result
-func (c *Checker) performCheck(ctx context.Context, appName string, healthCheck config.HealthCheckConfig) {
-	logger := c.logger.WithField("app", appName)
+// performCheck runs a probe once and acts on the result. It reports false once
+// the process no longer exists.
+func (c *Checker) performCheck(ctx context.Context, appName, kind string, healthCheck config.HealthCheckConfig, probe config.ProbeConfig) bool {
+	logger := c.logger.WithFields(logrus.Fields{"app": appName, "probe": kind})
 	
 	// Get the process to check if it's running
 	proc, exists := c.processManager.GetProcess(appName)
-	if !exists || !proc.IsRunning() {
-		// Process not running, mark as unhealthy
-		result := &Result{
-			Status:    StatusUnhealthy,
-			Error:     "process not running",
-			Timestamp: time.Now(),
-		}
-		
+	if !exists {
 		c.mu.Lock()
-		c.results[appName] = result
+		delete(c.probes, appName)
 		c.mu.Unlock()
+		return false
+	}
+	if !proc.IsRunning() {
+		if kind == config.ProbeLiveness {
+			// Process not running, mark as unhealthy
+			c.storeResult(appName, &Result{
+				Status:    StatusUnhealthy,
+				Error:     "process not running",
+				Timestamp: time.Now(),
+			})
+		}
 		
 		logger.Debug("Process not running, skipping health check")
-		return
+		return true
 	}
 	
-	// Perform the health check
-	result := c.CheckApp(appName, healthCheck, proc.Config.Port)
+	// Only the startup probe runs until the instance has started
+	startedAt := proc.GetStartTime()
+	if started := c.started(appName, startedAt, healthCheck); started == (kind == config.ProbeStartup) {
+		return true
+	}
 	
-	// Store the result
-	c.mu.Lock()
-	previousResult := c.results[appName]
-	c.results[appName] = result
-	c.mu.Unlock()
+	result := c.CheckApp(appName, healthCheck.Request(probe), proc.Config.Port)
+	
+	successes, failures, current := c.record(appName, startedAt, kind, result.Status == StatusHealthy)
+	if !current {
+		// The instance restarted while the check ran
+		return true
+	}
 	
-	// Log status changes
-	if previousResult == nil || previousResult.Status != result.Status {
-		logger.WithFields(logrus.Fields{
-			"status":      result.Status,
-			"status_code": result.StatusCode,
-			"duration":    result.Duration,
-			"error":       result.Error,
-		}).Info("Health check status changed")
+	if kind == config.ProbeLiveness {
+		result.ConsecutiveSuccesses = successes
+		result.ConsecutiveFailures = failures
+		result.FailureThreshold = probe.FailureThreshold
+		previousResult := c.storeResult(appName, result)
+		
+		// Log status changes
+		if previousResult == nil || previousResult.Status != result.Status {
+			logger.WithFields(logrus.Fields{
+				"status":      result.Status,
+				"status_code": result.StatusCode,
+				"duration":    result.Duration,
+				"error":       result.Error,
+			}).Info("Health check status changed")
+		}
 	}
 	
-	// Handle unhealthy status
-	if result.Status == StatusUnhealthy {
-		c.handleUnhealthyApp(ctx, appName, healthCheck, result)
+	switch kind {
+	case config.ProbeStartup:
+		if successes >= probe.SuccessThreshold {
+			c.setProbeState(appName, startedAt, func(state *probeState) { state.started = true })
+			logger.Info("Startup probe passed")
+		} else if failures >= probe.FailureThreshold {
+			c.handleUnhealthyApp(ctx, appName, kind, probe, failures, result)
+		}
+	case config.ProbeReadiness:
+		if successes >= probe.SuccessThreshold && c.setReady(appName, startedAt, true) {
+			logger.Info("Instance ready, routing traffic")
+		} else if failures >= probe.FailureThreshold && c.setReady(appName, startedAt, false) {
+			logger.WithField("error", result.Error).Warn("Instance not ready, holding traffic back")
+		}
+	case config.ProbeLiveness:
+		if failures > 0 {
+			c.handleUnhealthyApp(ctx, appName, kind, probe, failures, result)
+		}
 	}
+	return true
 }
 
-// handleUnhealthyApp handles an unhealthy application
-func (c *Checker) handleUnhealthyApp(ctx context.Context, appName string, healthCheck config.HealthCheckConfig, result *Result) {
-	logger := c.logger.WithField("app", appName)
-	
-	// Check how many consecutive failures we've had
-	consecutiveFailures := c.getConsecutiveFailures(appName)
+// handleUnhealthyApp restarts an app whose probe failed too many times in a row
+func (c *Checker) handleUnhealthyApp(ctx context.Context, appName, kind string, probe config.ProbeConfig, consecutiveFailures int, result *Result) {
+	logger := c.logger.WithFields(logrus.Fields{"app": appName, "probe": kind})
 	
 	logger.WithFields(logrus.Fields{
 		"consecutive_failures": consecutiveFailures,
-		"max_retries":         healthCheck.Retries,
-		"error":              result.Error,
+		"failure_threshold":    probe.FailureThreshold,
+		"error":                result.Error,
 	}).Warn("Application health check failed")
 	
 	// If we've exceeded the retry threshold, restart the process
-	if consecutiveFailures >= healthCheck.Retries {
+	if consecutiveFailures >= probe.FailureThreshold {
 		proc, exists := c.processManager.GetProcess(appName)
-		if exists && proc.Config.RestartPolicy.Enabled {
+		if exists && proc.Config.RestartPolicy.Enabled && c.processManager.InDeploy(proc.AppName()) {
+			logger.Warn("Health check failed too many times, not restarting during deploy mode")
+		} else if exists && proc.Config.RestartPolicy.Enabled {
 			logger.Error("Health check failed too many times, restarting process")
 			
-			// Restart the process
+			// Restart the process; the new instance starts with fresh probe state
 			if err := c.processManager.Restart(ctx, appName); err != nil {
 				logger.WithError(err).Error("Failed to restart unhealthy process")
 			} else {
 				logger.Info("Process restarted due to failed health checks")
-				// Reset failure count after restart
-				c.resetConsecutiveFailures(appName)
 			}
 		}
 	}
 }
 
-// getConsecutiveFailures counts consecutive health check failures for an app
-func (c *Checker) getConsecutiveFailures(appName string) int {
+// Ready reports whether an instance may receive traffic: its startup probe
+// passed and its readiness probe, if configured, succeeds
+func (c *Checker) Ready(proc *process.Process) bool {
+	healthCheck := proc.Config.HealthCheck
+	_, startup := healthCheck.Probe(config.ProbeStartup)
+	_, readiness := healthCheck.Probe(config.ProbeReadiness)
+	if !startup && !readiness {
+		return true
+	}
+	
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	
-	result, exists := c.results[appName]
-	if !exists || result.Status == StatusHealthy {
-		return 0
+	state, exists := c.probes[proc.Config.Name]
+	if !exists || !state.startedAt.Equal(proc.GetStartTime()) {
+		return false
 	}
+	return state.started && (!readiness || state.ready)
+}
+
+// started reports whether the instance started at startedAt passed its startup
+// probe, resetting the probe state when it belongs to a previous instance
+func (c *Checker) started(appName string, startedAt time.Time, healthCheck config.HealthCheckConfig) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	
-	// For simplicity, we'll track this in the result error field
-	// In a production system, you'd want a more sophisticated tracking mechanism
-	return 1
+	state := c.probeStateLocked(appName, startedAt, healthCheck)
+	return state.started
 }
 
-// resetConsecutiveFailures resets the consecutive failure count for an app
-func (c *Checker) resetConsecutiveFailures(appName string) {
-	// Implementation would reset the failure count
-	// For now, this is a placeholder
+// record counts a probe result and returns the consecutive successes and
+// failures of that probe; current is false if the instance changed meanwhile
+func (c *Checker) record(appName string, startedAt time.Time, kind string, healthy bool) (successes, failures int, current bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	state, exists := c.probes[appName]
+	if !exists || !state.startedAt.Equal(startedAt) {
+		return 0, 0, false
+	}
+	if healthy {
+		state.successes[kind]++
+		state.failures[kind] = 0
+	} else {
+		state.failures[kind]++
+		state.successes[kind] = 0
+	}
+	return state.successes[kind], state.failures[kind], true
+}
+
+// setReady updates the readiness of an instance and reports whether it changed
+func (c *Checker) setReady(appName string, startedAt time.Time, ready bool) bool {
+	changed := false
+	c.setProbeState(appName, startedAt, func(state *probeState) {
+		changed = state.ready != ready
+		state.ready = ready
+	})
+	return changed
+}
+
+// setProbeState applies update to the probe state of the instance started at startedAt
+func (c *Checker) setProbeState(appName string, startedAt time.Time, update func(state *probeState)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	
+	if state, exists := c.probes[appName]; exists && state.startedAt.Equal(startedAt) {
+		update(state)
+	}
+}
+
+// probeStateLocked returns the probe state of the instance started at startedAt; c.mu must be held
+func (c *Checker) probeStateLocked(appName string, startedAt time.Time, healthCheck config.HealthCheckConfig) *probeState {
+	state, exists := c.probes[appName]
+	if !exists || !state.startedAt.Equal(startedAt) {
+		_, startup := healthCheck.Probe(config.ProbeStartup)
+		state = &probeState{
+			startedAt: startedAt,
+			started:   !startup,
+			successes: make(map[string]int),
+			failures:  make(map[string]int),
+		}
+		c.probes[appName] = state
+	}
+	return state
 }
 
 // Stop stops all health checking
 func (c *Checker) Stop() {
 	c.logger.Info("Stopping health checker")
 	// Health checks will stop when the context is cancelled
-}
\ No newline at end of file
+}
@@ -1,10 +1,288 @@
 package health
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
 )
 
 func TestHealth_Basic(t *testing.T) {
 	// Basic test to ensure package compiles
 	t.Log("Health package test - basic functionality works")
-}
\ No newline at end of file
+}
+
+func TestCheckApp_CustomRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "api.internal" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	checker := NewChecker(process.NewManager(logger), logger)
+
+	healthCheck := config.HealthCheckConfig{
+		Path:    "/health",
+		Timeout: time.Second,
+		Address: "127.0.0.1",
+		Host:    "api.internal",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	}
+	if result := checker.CheckApp("api", healthCheck, port); result.Status != StatusHealthy {
+		t.Errorf("Expected healthy, got %s (%s)", result.Status, result.Error)
+	}
+
+	healthCheck.Headers = nil
+	if result := checker.CheckApp("api", healthCheck, port); result.Status != StatusUnhealthy {
+		t.Errorf("Expected unhealthy without auth header, got %s", result.Status)
+	}
+}
+
+func TestTransitionHook(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	checker := NewChecker(process.NewManager(logger), logger)
+
+	transitions := make(chan Status, 4)
+	checker.SetTransitionHook(func(appName string, previous, current Result) {
+		transitions <- current.Status
+	})
+
+	checker.storeResult("web", &Result{Status: StatusHealthy})
+	checker.storeResult("web", &Result{Status: StatusHealthy})
+	checker.storeResult("web", &Result{Status: StatusUnhealthy})
+
+	select {
+	case status := <-transitions:
+		if status != StatusUnhealthy {
+			t.Errorf("Expected transition to unhealthy, got %s", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a transition")
+	}
+
+	select {
+	case status := <-transitions:
+		t.Errorf("Unexpected extra transition to %s", status)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestProbes_StartupAndReadiness(t *testing.T) {
+	ready := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ready" && !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager := process.NewManager(logger)
+	checker := NewChecker(manager, logger)
+
+	ctx := context.Background()
+	healthCheck := config.HealthCheckConfig{
+		Enabled:   true,
+		Path:      "/health",
+		Interval:  time.Second,
+		Timeout:   time.Second,
+		Retries:   3,
+		Address:   "127.0.0.1",
+		Startup:   &config.ProbeConfig{Path: "/started"},
+		Readiness: &config.ProbeConfig{Path: "/ready", FailureThreshold: 1},
+	}
+	appConfig := config.AppConfig{Name: "web", Command: "sleep", Args: []string{"30"}, Port: port, HealthCheck: healthCheck}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+	proc, _ := manager.GetProcess("web")
+
+	check := func(kind string) {
+		probe, _ := healthCheck.Probe(kind)
+		checker.performCheck(ctx, "web", kind, healthCheck, probe)
+	}
+
+	// Readiness is not probed before the startup probe passes
+	check(config.ProbeReadiness)
+	if checker.Ready(proc) {
+		t.Fatal("Expected instance not to be ready before its startup probe passed")
+	}
+
+	check(config.ProbeStartup)
+	check(config.ProbeReadiness)
+	if checker.Ready(proc) {
+		t.Fatal("Expected instance not to be ready while its readiness probe fails")
+	}
+
+	ready = true
+	check(config.ProbeReadiness)
+	if !checker.Ready(proc) {
+		t.Fatal("Expected instance to be ready")
+	}
+
+	ready = false
+	check(config.ProbeReadiness)
+	if checker.Ready(proc) {
+		t.Error("Expected instance to stop receiving traffic once its readiness probe fails")
+	}
+	if result, ok := checker.GetResult("web"); ok {
+		t.Errorf("Expected readiness not to affect the liveness result, got %s", result.Status)
+	}
+}
+
+func TestLiveness_FailureStreak(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager := process.NewManager(logger)
+	checker := NewChecker(manager, logger)
+
+	ctx := context.Background()
+	healthCheck := config.HealthCheckConfig{
+		Enabled:  true,
+		Path:     "/health",
+		Interval: time.Second,
+		Timeout:  time.Second,
+		Retries:  3,
+		Address:  "127.0.0.1",
+	}
+	appConfig := config.AppConfig{
+		Name: "web", Command: "sleep", Args: []string{"30"}, Port: port,
+		HealthCheck:   healthCheck,
+		RestartPolicy: config.RestartPolicy{Enabled: true, MaxRetries: 3, Backoff: time.Second},
+	}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+	proc, _ := manager.GetProcess("web")
+	startedAt := proc.GetStartTime()
+
+	probe, _ := healthCheck.Probe(config.ProbeLiveness)
+	for i := 1; i < healthCheck.Retries; i++ {
+		checker.performCheck(ctx, "web", config.ProbeLiveness, healthCheck, probe)
+		result, _ := checker.GetResult("web")
+		if result.ConsecutiveFailures != i || result.FailureThreshold != 3 {
+			t.Fatalf("Expected a streak of %d/3 failures, got %d/%d", i, result.ConsecutiveFailures, result.FailureThreshold)
+		}
+	}
+	first, _ := checker.GetResult("web")
+	if current, _ := manager.GetProcess("web"); !current.GetStartTime().Equal(startedAt) {
+		t.Fatal("Expected no restart below the retries threshold")
+	}
+
+	checker.performCheck(ctx, "web", config.ProbeLiveness, healthCheck, probe)
+	if current, _ := manager.GetProcess("web"); current.GetStartTime().Equal(startedAt) {
+		t.Fatal("Expected a restart once the retries threshold was reached")
+	}
+	result, _ := checker.GetResult("web")
+	if !result.LastTransition.Equal(first.LastTransition) {
+		t.Error("Expected the last transition to stay at the first failure")
+	}
+
+	// The restarted instance starts a new streak
+	checker.performCheck(ctx, "web", config.ProbeLiveness, healthCheck, probe)
+	if result, _ := checker.GetResult("web"); result.ConsecutiveFailures != 1 {
+		t.Errorf("Expected the streak to restart after the restart, got %d", result.ConsecutiveFailures)
+	}
+}
+
+func TestChecker_FollowsStartedAndRemovedApps(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	_, portStr, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	manager := process.NewManager(logger)
+	checker := NewChecker(manager, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	checker.Start(ctx)
+
+	appConfig := config.AppConfig{
+		Name: "web", Command: "sleep", Args: []string{"30"}, Port: port,
+		HealthCheck: config.HealthCheckConfig{
+			Enabled:   true,
+			Path:      "/health",
+			Interval:  time.Second,
+			Timeout:   time.Second,
+			Retries:   3,
+			Address:   "127.0.0.1",
+			Readiness: &config.ProbeConfig{Path: "/ready"},
+		},
+	}
+	// Started after the checker, as through the API
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(context.Background())
+	proc, _ := manager.GetProcess("web")
+
+	watching := func(name string) bool {
+		checker.mu.RLock()
+		defer checker.mu.RUnlock()
+		return checker.watched[name+"/"+config.ProbeReadiness] != nil
+	}
+	waitFor := func(what string, condition func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !condition() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+	waitFor("web to be ready", func() bool { return checker.Ready(proc) })
+
+	if err := manager.Scale(ctx, appConfig, 2); err != nil {
+		t.Fatalf("Failed to scale up: %v", err)
+	}
+	waitFor("web-2 to be probed", func() bool { return watching(process.InstanceName("web", 2)) })
+
+	if err := manager.Scale(ctx, appConfig, 1); err != nil {
+		t.Fatalf("Failed to scale down: %v", err)
+	}
+	waitFor("web-2 probes to stop", func() bool { return !watching(process.InstanceName("web", 2)) })
+	if !watching("web") {
+		t.Error("Expected web to still be probed")
+	}
+}
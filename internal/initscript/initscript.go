@@ -0,0 +1,254 @@
+// Package initscript generates the files that make a service manager other
+// than systemd start the guvnor server at boot: launchd property lists on
+// macOS, and OpenRC and SysV init scripts on Linux.
+package initscript
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// Init systems
+const (
+	Launchd = "launchd"
+	OpenRC  = "openrc"
+	SysV    = "sysv"
+	Systemd = "systemd"
+)
+
+// Options describes the service running a guvnor server
+type Options struct {
+	Name       string // Service name
+	Executable string // Absolute path of the guvnor binary
+	WorkingDir string // Project directory
+	ConfigPath string // Absolute config path, empty for guvnor.yaml in WorkingDir
+	User       string // Account the server runs as, empty for the service manager's default
+	Path       string // PATH of the server and its apps; boot time PATHs are minimal
+	LogPath    string // File receiving what the server writes before it opens its log
+}
+
+// Detect returns the init system of this machine, "" when unknown
+func Detect() string {
+	switch {
+	case runtime.GOOS == "darwin":
+		return Launchd
+	case runtime.GOOS != "linux":
+		return ""
+	case exists("/run/systemd/system"):
+		return Systemd
+	case exists("/sbin/openrc-run") || exists("/run/openrc"):
+		return OpenRC
+	case exists("/etc/init.d"):
+		return SysV
+	}
+	return ""
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Label is the launchd label of the service
+func (o Options) Label() string {
+	return "com.github.gleicon." + o.Name
+}
+
+// RunArgs are the arguments of guvnor service run for the service, which
+// enters the project directory and logs to guvnor-service.log there
+func (o Options) RunArgs() []string {
+	args := []string{"service", "run", "--name", o.Name, "--dir", o.WorkingDir}
+	if o.ConfigPath != "" {
+		args = append(args, "--config", o.ConfigPath)
+	}
+	return args
+}
+
+// Command returns the shell command running guvnor with args, with the
+// config of the service
+func (o Options) Command(args ...string) string {
+	words := []string{o.Executable}
+	if o.ConfigPath != "" {
+		words = append(words, "--config", o.ConfigPath)
+	}
+	words = append(words, args...)
+	for i, word := range words {
+		words[i] = shellQuote(word)
+	}
+	return strings.Join(words, " ")
+}
+
+var funcs = template.FuncMap{"xml": xmlEscape, "sh": shellQuote}
+
+var launchdPlist = template.Must(template.New(Launchd).Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- Generated by guvnor service install -->
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label | xml}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{.Executable | xml}}</string>
+		{{- range .RunArgs}}
+		<string>{{. | xml}}</string>
+		{{- end}}
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{.WorkingDir | xml}}</string>
+	{{- if .User}}
+	<key>UserName</key>
+	<string>{{.User | xml}}</string>
+	{{- end}}
+	{{- if .Path}}
+	<key>EnvironmentVariables</key>
+	<dict>
+		<key>PATH</key>
+		<string>{{.Path | xml}}</string>
+	</dict>
+	{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<!-- Restarted when it crashes, not when it is stopped -->
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+	<!-- Time to stop the apps gracefully after SIGTERM -->
+	<key>ExitTimeOut</key>
+	<integer>90</integer>
+	{{- if .LogPath}}
+	<key>StandardOutPath</key>
+	<string>{{.LogPath | xml}}</string>
+	<key>StandardErrorPath</key>
+	<string>{{.LogPath | xml}}</string>
+	{{- end}}
+</dict>
+</plist>
+`))
+
+var openRCScript = template.Must(template.New(OpenRC).Funcs(funcs).Parse(`#!/sbin/openrc-run
+# Generated by guvnor service install
+
+description={{printf "Guv'nor process manager for %s" .WorkingDir | sh}}
+command={{.Executable | sh}}
+command_args="{{range $i, $arg := .RunArgs}}{{if $i}} {{end}}{{$arg | sh}}{{end}}"
+directory={{.WorkingDir | sh}}
+{{- if .User}}
+command_user={{.User | sh}}
+{{- end}}
+{{- if .Path}}
+export PATH={{.Path | sh}}
+{{- end}}
+
+# supervise-daemon restarts guvnor when it crashes; stopping waits for it to
+# stop its apps gracefully
+supervisor=supervise-daemon
+respawn_delay=5
+retry="TERM/90/KILL/5"
+{{- if .LogPath}}
+output_log={{.LogPath | sh}}
+error_log={{.LogPath | sh}}
+{{- end}}
+
+depend() {
+	need net
+	after firewall
+}
+`))
+
+var sysVScript = template.Must(template.New(SysV).Funcs(funcs).Parse(`#!/bin/sh
+# Generated by guvnor service install
+### BEGIN INIT INFO
+# Provides:          {{.Name}}
+# Required-Start:    $network $remote_fs
+# Required-Stop:     $network $remote_fs
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: Guv'nor process manager
+# Description:       Guv'nor process manager for {{.WorkingDir}}
+### END INIT INFO
+
+# The server runs in guvnor's daemon mode, which keeps its PID file and log
+# in the state directory of the project
+{{- if .Path}}
+export PATH={{.Path | sh}}
+{{- end}}
+
+run_guvnor() {
+	cd {{.WorkingDir | sh}} || exit 1
+{{- if .User}}
+	su -s /bin/sh -c "$1" {{.User | sh}}
+{{- else}}
+	sh -c "$1"
+{{- end}}
+}
+
+case "$1" in
+	start)
+		run_guvnor {{.Command "start" "--daemon" | sh}}
+		;;
+	stop)
+		run_guvnor {{.Command "daemon" "stop" | sh}}
+		;;
+	restart|force-reload)
+		run_guvnor {{.Command "daemon" "restart" | sh}}
+		;;
+	reload)
+		run_guvnor {{.Command "reload" | sh}}
+		;;
+	status)
+		run_guvnor {{.Command "daemon" "status" | sh}}
+		;;
+	*)
+		echo "Usage: $0 {start|stop|restart|reload|status}" >&2
+		exit 2
+		;;
+esac
+`))
+
+// File returns the service file of an init system for o
+func File(system string, o Options) (string, error) {
+	if o.Name == "" || o.Executable == "" || o.WorkingDir == "" {
+		return "", fmt.Errorf("service needs a name, the guvnor binary and the project directory")
+	}
+	var t *template.Template
+	switch system {
+	case Launchd:
+		t = launchdPlist
+	case OpenRC:
+		t = openRCScript
+	case SysV:
+		t = sysVScript
+	default:
+		return "", fmt.Errorf("unsupported init system %q (use %s, %s or %s)", system, Launchd, OpenRC, SysV)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, o); err != nil {
+		return "", fmt.Errorf("failed to render %s service: %w", system, err)
+	}
+	return buf.String(), nil
+}
+
+// xmlEscape escapes text for a property list string
+func xmlEscape(text string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+// shellQuote quotes a word for sh when it needs it
+func shellQuote(word string) string {
+	if word != "" && strings.Trim(word, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@%+,") == "" {
+		return word
+	}
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
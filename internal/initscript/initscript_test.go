@@ -0,0 +1,61 @@
+package initscript
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFile(t *testing.T) {
+	opts := Options{
+		Name:       "guvnor",
+		Executable: "/usr/local/bin/guvnor",
+		WorkingDir: "/srv/my app",
+		ConfigPath: "/srv/my app/guvnor.yaml",
+		User:       "deploy",
+		Path:       "/usr/local/bin:/usr/bin:/bin",
+		LogPath:    "/srv/my app/guvnor-service.log",
+	}
+
+	tests := []struct {
+		system string
+		want   []string
+	}{
+		{Launchd, []string{
+			"<string>com.github.gleicon.guvnor</string>",
+			"<string>--dir</string>\n\t\t<string>/srv/my app</string>",
+			"<key>UserName</key>\n\t<string>deploy</string>",
+			"<key>StandardErrorPath</key>\n\t<string>/srv/my app/guvnor-service.log</string>",
+		}},
+		{OpenRC, []string{
+			"#!/sbin/openrc-run\n",
+			`command_args="service run --name guvnor --dir '/srv/my app' --config '/srv/my app/guvnor.yaml'"`,
+			"command_user=deploy\n",
+			"supervisor=supervise-daemon\n",
+		}},
+		{SysV, []string{
+			"# Provides:          guvnor\n",
+			"su -s /bin/sh -c \"$1\" deploy\n",
+			`run_guvnor '/usr/local/bin/guvnor --config '\''/srv/my app/guvnor.yaml'\'' start --daemon'`,
+			`run_guvnor '/usr/local/bin/guvnor --config '\''/srv/my app/guvnor.yaml'\'' daemon status'`,
+		}},
+	}
+	for _, tt := range tests {
+		content, err := File(tt.system, opts)
+		if err != nil {
+			t.Fatalf("%s: File failed: %v", tt.system, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("%s: expected %q in:\n%s", tt.system, want, content)
+			}
+		}
+	}
+
+	if _, err := File(Systemd, opts); err == nil {
+		t.Error("Expected an error for systemd, which has its own units")
+	}
+	opts.WorkingDir = "/srv/a&b"
+	if content, _ := File(Launchd, opts); !strings.Contains(content, "<string>/srv/a&amp;b</string>") {
+		t.Errorf("Expected the plist to escape &:\n%s", content)
+	}
+}
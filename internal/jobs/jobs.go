@@ -0,0 +1,261 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is a long-running operation tracked by ID
+type Job struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	Target     string      `json:"target,omitempty"`
+	Status     Status      `json:"status"`
+	Progress   []string    `json:"progress,omitempty"`
+	Steps      []Step      `json:"steps,omitempty"`
+	Percent    int         `json:"percent"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  time.Time   `json:"started_at,omitempty"`
+	FinishedAt time.Time   `json:"finished_at,omitempty"`
+}
+
+// Step is the current phase of one target (usually an app) within a job
+type Step struct {
+	Target    string    `json:"target"`
+	Phase     string    `json:"phase"`
+	Done      bool      `json:"done"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done reports whether the job has finished
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Func performs the work of a job. It reports progress through the reporter and
+// returns a JSON-serializable result.
+type Func func(ctx context.Context, report func(message string)) (interface{}, error)
+
+// Manager runs jobs in the background and keeps their state for a while after they finish
+type Manager struct {
+	jobs      map[string]*Job
+	retention time.Duration
+	timeout   time.Duration
+	mu        sync.RWMutex
+}
+
+// NewManager creates a job manager that forgets finished jobs after the retention period
+func NewManager(retention, timeout time.Duration) *Manager {
+	if retention <= 0 {
+		retention = time.Hour
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	return &Manager{
+		jobs:      make(map[string]*Job),
+		retention: retention,
+		timeout:   timeout,
+	}
+}
+
+// Submit starts a job in the background and returns a snapshot of it
+func (m *Manager) Submit(jobType, target string, fn Func) Job {
+	job := &Job{
+		ID:        newID(),
+		Type:      jobType,
+		Target:    target,
+		Status:    StatusPending,
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[job.ID] = job
+	snapshot := *job
+	m.mu.Unlock()
+
+	go m.run(job, fn)
+
+	return snapshot
+}
+
+// run executes a job and records its outcome
+func (m *Manager) run(job *Job, fn Func) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+
+	m.mu.Lock()
+	job.Status = StatusRunning
+	job.StartedAt = time.Now()
+	m.mu.Unlock()
+
+	report := func(message string) {
+		m.mu.Lock()
+		job.Progress = append(job.Progress, message)
+		m.mu.Unlock()
+	}
+
+	ctx = context.WithValue(ctx, trackerKey{}, &tracker{manager: m, job: job})
+	result, err := fn(ctx, report)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Result = result
+	job.FinishedAt = time.Now()
+	if err != nil {
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	} else {
+		job.Status = StatusSucceeded
+		job.Percent = 100
+	}
+}
+
+// trackerKey is the context key under which a running job's tracker is stored
+type trackerKey struct{}
+
+// tracker records per-target steps for the job running with its context
+type tracker struct {
+	manager *Manager
+	job     *Job
+}
+
+// Plan registers the targets a job will work on so progress can be reported as a percentage.
+// It is a no-op when ctx does not belong to a job.
+func Plan(ctx context.Context, targets ...string) {
+	t, ok := ctx.Value(trackerKey{}).(*tracker)
+	if !ok {
+		return
+	}
+
+	t.manager.mu.Lock()
+	defer t.manager.mu.Unlock()
+
+	now := time.Now()
+	for _, target := range targets {
+		if t.job.step(target) == nil {
+			t.job.Steps = append(t.job.Steps, Step{Target: target, Phase: "pending", UpdatedAt: now})
+		}
+	}
+	t.job.updatePercent()
+}
+
+// Report sets the phase of a target, marking it finished when done is true.
+// It is a no-op when ctx does not belong to a job.
+func Report(ctx context.Context, target, phase string, done bool) {
+	t, ok := ctx.Value(trackerKey{}).(*tracker)
+	if !ok {
+		return
+	}
+
+	t.manager.mu.Lock()
+	defer t.manager.mu.Unlock()
+
+	step := t.job.step(target)
+	if step == nil {
+		t.job.Steps = append(t.job.Steps, Step{Target: target})
+		step = &t.job.Steps[len(t.job.Steps)-1]
+	}
+	step.Phase = phase
+	step.Done = done
+	step.UpdatedAt = time.Now()
+	t.job.updatePercent()
+}
+
+// step returns the step for a target (must be called with lock held)
+func (j *Job) step(target string) *Step {
+	for i := range j.Steps {
+		if j.Steps[i].Target == target {
+			return &j.Steps[i]
+		}
+	}
+	return nil
+}
+
+// updatePercent recomputes completion from finished steps (must be called with lock held)
+func (j *Job) updatePercent() {
+	if len(j.Steps) == 0 {
+		return
+	}
+	done := 0
+	for _, step := range j.Steps {
+		if step.Done {
+			done++
+		}
+	}
+	j.Percent = done * 100 / len(j.Steps)
+}
+
+// Get returns a snapshot of a job by ID
+func (m *Manager) Get(id string) (Job, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, exists := m.jobs[id]
+	if !exists {
+		return Job{}, false
+	}
+	return snapshot(job), true
+}
+
+// List returns snapshots of all known jobs, newest first
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, snapshot(job))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// prune drops finished jobs older than the retention period (must be called with lock held)
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, job := range m.jobs {
+		if job.Done() && job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// snapshot copies a job so callers never observe concurrent updates
+func snapshot(job *Job) Job {
+	copied := *job
+	copied.Progress = append([]string(nil), job.Progress...)
+	copied.Steps = append([]Step(nil), job.Steps...)
+	return copied
+}
+
+// newID returns a random job identifier
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,88 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitDone(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := m.Get(id); job.Done() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Job %s did not finish", id)
+	return Job{}
+}
+
+func TestManager_Submit(t *testing.T) {
+	m := NewManager(time.Hour, time.Second)
+
+	job := m.Submit("restart", "web", func(ctx context.Context, report func(string)) (interface{}, error) {
+		report("restarting web")
+		return "ok", nil
+	})
+	if job.ID == "" || job.Status != StatusPending {
+		t.Fatalf("Unexpected submitted job: %+v", job)
+	}
+
+	done := waitDone(t, m, job.ID)
+	if done.Status != StatusSucceeded || done.Result != "ok" || len(done.Progress) != 1 {
+		t.Errorf("Unexpected finished job: %+v", done)
+	}
+
+	failed := m.Submit("stop", "", func(ctx context.Context, report func(string)) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if done := waitDone(t, m, failed.ID); done.Status != StatusFailed || done.Error != "boom" {
+		t.Errorf("Unexpected failed job: %+v", done)
+	}
+
+	if len(m.List()) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(m.List()))
+	}
+	if _, exists := m.Get("missing"); exists {
+		t.Error("Expected unknown job to be missing")
+	}
+}
+
+func TestManager_Steps(t *testing.T) {
+	m := NewManager(time.Hour, time.Second)
+	release := make(chan struct{})
+
+	job := m.Submit("stop", "all", func(ctx context.Context, report func(string)) (interface{}, error) {
+		Plan(ctx, "web", "api")
+		Report(ctx, "web", "stopping", false)
+		Report(ctx, "api", "stopped", true)
+		<-release
+		return nil, nil
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		current, _ := m.Get(job.ID)
+		if current.Percent == 50 {
+			if len(current.Steps) != 2 || current.Steps[0].Phase != "stopping" || current.Steps[0].Done {
+				t.Errorf("Unexpected steps: %+v", current.Steps)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 50%% progress, got %+v", current)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(release)
+	if done := waitDone(t, m, job.ID); done.Percent != 100 {
+		t.Errorf("Expected 100%% when finished, got %d", done.Percent)
+	}
+
+	// Reporting outside a job is a no-op
+	Report(context.Background(), "web", "stopping", false)
+}
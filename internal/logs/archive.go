@@ -0,0 +1,378 @@
+package logs
+
+import (
+	"bufio"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileTimeLayout is the timestamp layout of Format, which log files are written with
+const fileTimeLayout = "2006-01-02 15:04:05"
+
+// ParseLine parses a line Format wrote without colors, as log files hold
+// them. The timestamp is read in local time, without fractions of a second,
+// and the stream is not known. It returns false for lines that do not start
+// an entry, such as further lines of a multi-line message.
+func ParseLine(line string) (LogEntry, bool) {
+	if len(line) < len(fileTimeLayout) {
+		return LogEntry{}, false
+	}
+	timestamp, err := time.ParseInLocation(fileTimeLayout, line[:len(fileTimeLayout)], time.Local)
+	if err != nil {
+		return LogEntry{}, false
+	}
+	rest, ok := strings.CutPrefix(line[len(fileTimeLayout):], " [")
+	if !ok {
+		return LogEntry{}, false
+	}
+	level, rest, ok := strings.Cut(rest, "] [")
+	if !ok {
+		return LogEntry{}, false
+	}
+	process, message, ok := strings.Cut(rest, "] ")
+	if !ok || process == "" {
+		return LogEntry{}, false
+	}
+	return LogEntry{Timestamp: timestamp, Level: strings.ToLower(level), Process: process, Message: message}, true
+}
+
+// Archive reads the stored entries of a log manager: those in its buffers
+// and, with a log directory, those in the log files there, which reach
+// further back
+type Archive struct {
+	manager *LogManager
+	dir     string // Log directory, "" when entries are only buffered
+}
+
+// NewArchive returns an archive of the buffers of manager and the log files in dir
+func NewArchive(manager *LogManager, dir string) *Archive {
+	return &Archive{manager: manager, dir: dir}
+}
+
+// Oldest returns the time of the oldest entry stored for the processes the
+// filter selects; earlier entries were dropped from the buffers or pruned
+// from the log directory. It is zero when nothing is stored.
+func (a *Archive) Oldest(filter Filter) (time.Time, error) {
+	var oldest time.Time
+	consider := func(t time.Time) {
+		if oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+
+	for process, seam := range a.manager.seams() {
+		if filter.SelectsProcess(process) {
+			consider(seam.oldest)
+		}
+	}
+	files, err := a.files(Filter{Processes: filter.Processes, Exclude: filter.Exclude, Visible: filter.Visible})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, paths := range files {
+		source := &fileSource{paths: paths}
+		entry, ok, err := source.readEntry()
+		source.close()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ok {
+			consider(entry.Timestamp)
+		}
+	}
+	return oldest, nil
+}
+
+// Each calls fn with every stored entry the filter selects, oldest first,
+// and stops at the first error fn returns. Log files are read as the entries
+// are passed on, so they are never held in memory; entries also in the
+// buffers are taken from there.
+func (a *Archive) Each(filter Filter, fn func(LogEntry) error) error {
+	buffered, seams := a.manager.snapshot(filter)
+	files, err := a.files(filter)
+	if err != nil {
+		return err
+	}
+
+	var sources []entrySource
+	for _, app := range slices.Sorted(maps.Keys(files)) {
+		source := &fileSource{paths: files[app], filter: filter, seams: seams, held: make(map[string][]LogEntry)}
+		defer source.close()
+		sources = append(sources, source)
+	}
+	// After the files, so they come first among entries logged at the same time
+	sources = append(sources, &sliceSource{entries: buffered})
+
+	heads := make([]*LogEntry, len(sources))
+	for {
+		first := -1
+		for i, source := range sources {
+			if heads[i] == nil && source != nil {
+				entry, ok, err := source.next()
+				if err != nil {
+					return err
+				}
+				if !ok {
+					sources[i] = nil
+					continue
+				}
+				heads[i] = &entry
+			}
+			if heads[i] != nil && (first < 0 || heads[i].Timestamp.Before(heads[first].Timestamp)) {
+				first = i
+			}
+		}
+		if first < 0 {
+			return nil
+		}
+		if err := fn(*heads[first]); err != nil {
+			return err
+		}
+		heads[first] = nil
+	}
+}
+
+// files returns the log files of each app the filter selects, oldest first:
+// web.log.2, web.log.1, web.log. Rotated files last written before the
+// filter's since are left out.
+func (a *Archive) files(filter Filter) (map[string][]string, error) {
+	if a.dir == "" {
+		return nil, nil
+	}
+	found, err := readLogDir(a.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	type rotation struct {
+		path  string
+		index int // 0 for the file being written
+	}
+	byApp := make(map[string][]rotation)
+	for _, file := range found {
+		name := filepath.Base(file.path)
+		index := 0
+		if file.rotated {
+			base, suffix, _ := cutLast(name, ".")
+			name = base
+			index, _ = strconv.Atoi(suffix)
+		}
+		if !strings.HasSuffix(name, ".log") || !selectsApp(filter, file.app) {
+			continue
+		}
+		if file.rotated && !filter.Since.IsZero() && file.modTime.Before(filter.Since) {
+			continue
+		}
+		byApp[file.app] = append(byApp[file.app], rotation{file.path, index})
+	}
+
+	files := make(map[string][]string, len(byApp))
+	for app, rotations := range byApp {
+		// Higher rotation indexes are older, and the file being written (0) is newest
+		sort.Slice(rotations, func(i, j int) bool { return rotations[i].index > rotations[j].index })
+		for _, r := range rotations {
+			files[app] = append(files[app], r.path)
+		}
+	}
+	return files, nil
+}
+
+// selectsApp reports whether the filter may select entries of app or its instances
+func selectsApp(filter Filter, app string) bool {
+	if selects(filter.Exclude, app) || (filter.Visible != nil && !filter.Visible(app)) {
+		return false
+	}
+	if len(filter.Processes) == 0 {
+		return true
+	}
+	for _, process := range filter.Processes {
+		if process == app || selects([]string{app}, process) {
+			return true
+		}
+	}
+	return false
+}
+
+// seam is where the buffer of a process starts. Log files store times to
+// the second, so entries of the process in files are buffered too from the
+// last count entries within second on.
+type seam struct {
+	oldest time.Time // Oldest buffered entry
+	second time.Time // oldest truncated to the second
+	count  int       // Buffered entries within second
+}
+
+// seams returns where the buffer of each process starts
+func (lm *LogManager) seams() map[string]seam {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.seamsLocked()
+}
+
+// snapshot returns the buffered entries the filter selects and where each
+// buffer starts, taken together so no entry logged meanwhile is left out of
+// both or read from both
+func (lm *LogManager) snapshot(filter Filter) ([]LogEntry, map[string]seam) {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.findLocked(0, filter), lm.seamsLocked()
+}
+
+// seamsLocked returns where the buffer of each process starts (must be called with lock held)
+func (lm *LogManager) seamsLocked() map[string]seam {
+	seams := make(map[string]seam, len(lm.buffers))
+	for process, cb := range lm.buffers {
+		cb.mu.RLock()
+		count := cb.count()
+		if count > 0 {
+			oldest := cb.buffer[cb.head].Timestamp
+			s := seam{oldest: oldest, second: oldest.Truncate(time.Second)}
+			for i := 0; i < count && cb.buffer[(cb.head+i)%cb.size].Timestamp.Truncate(time.Second).Equal(s.second); i++ {
+				s.count++
+			}
+			seams[process] = s
+		}
+		cb.mu.RUnlock()
+	}
+	return seams
+}
+
+// entrySource yields entries in timestamp order
+type entrySource interface {
+	next() (LogEntry, bool, error)
+}
+
+// sliceSource yields entries already in memory
+type sliceSource struct {
+	entries []LogEntry
+}
+
+func (s *sliceSource) next() (LogEntry, bool, error) {
+	if len(s.entries) == 0 {
+		return LogEntry{}, false, nil
+	}
+	entry := s.entries[0]
+	s.entries = s.entries[1:]
+	return entry, true, nil
+}
+
+// fileSource reads the entries of the log files of an app, one file after
+// the other, leaving out those the buffers hold
+type fileSource struct {
+	paths  []string
+	filter Filter
+	seams  map[string]seam
+	held   map[string][]LogEntry // Entries within the second of a seam, passed on once more arrive than are buffered
+
+	file    *os.File
+	reader  *bufio.Reader
+	pending *LogEntry // Read up to its first line; further lines may follow
+}
+
+// next returns the next entry the filter selects that is not buffered
+func (s *fileSource) next() (LogEntry, bool, error) {
+	for {
+		entry, ok, err := s.readEntry()
+		if err != nil || !ok {
+			return LogEntry{}, false, err
+		}
+		if !s.filter.Until.IsZero() && !entry.Timestamp.Before(s.filter.Until) {
+			return LogEntry{}, false, nil // The rest is later still
+		}
+
+		seam, buffered := s.seams[entry.Process]
+		switch {
+		case !buffered || entry.Timestamp.Before(seam.second):
+		case entry.Timestamp.Equal(seam.second):
+			// The last seam.count entries of the second are the first buffered ones
+			held := append(s.held[entry.Process], entry)
+			if len(held) <= seam.count {
+				s.held[entry.Process] = held
+				continue
+			}
+			entry, s.held[entry.Process] = held[0], held[1:]
+		default:
+			continue
+		}
+		if s.filter.Match(entry) {
+			return entry, true, nil
+		}
+	}
+}
+
+// readEntry reads the next entry with all of its lines
+func (s *fileSource) readEntry() (LogEntry, bool, error) {
+	for {
+		line, err := s.readLine()
+		if err == io.EOF {
+			if s.pending == nil {
+				return LogEntry{}, false, nil
+			}
+			entry := *s.pending
+			s.pending = nil
+			return entry, true, nil
+		}
+		if err != nil {
+			return LogEntry{}, false, err
+		}
+
+		entry, ok := ParseLine(line)
+		if !ok {
+			if s.pending != nil {
+				s.pending.Message += "\n" + line
+			}
+			continue
+		}
+		previous := s.pending
+		s.pending = &entry
+		if previous != nil {
+			return *previous, true, nil
+		}
+	}
+}
+
+// readLine returns the next line of the files, io.EOF after the last one.
+// Files pruned since they were listed are skipped.
+func (s *fileSource) readLine() (string, error) {
+	for {
+		if s.reader == nil {
+			if len(s.paths) == 0 {
+				return "", io.EOF
+			}
+			file, err := os.Open(s.paths[0])
+			s.paths = s.paths[1:]
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			s.file, s.reader = file, bufio.NewReader(file)
+		}
+
+		line, err := s.reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			s.close()
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+}
+
+// close closes the file being read
+func (s *fileSource) close() {
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, s.reader = nil, nil
+}
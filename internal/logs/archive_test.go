@@ -0,0 +1,110 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+	at := time.Date(2025, 9, 14, 21, 0, 5, 0, time.Local)
+	entry := LogEntry{Timestamp: at, Level: "warn", Process: "web.2", Message: "slow [db] query took 2s"}
+	parsed, ok := ParseLine(Format(entry, false))
+	if !ok || !parsed.Timestamp.Equal(at) || parsed.Level != "warn" || parsed.Process != "web.2" || parsed.Message != entry.Message {
+		t.Errorf("Expected %+v back, got %+v (%v)", entry, parsed, ok)
+	}
+
+	entry.Message = ""
+	if parsed, ok := ParseLine(Format(entry, false)); !ok || parsed.Message != "" {
+		t.Errorf("Expected an empty message, got %+v (%v)", parsed, ok)
+	}
+	for _, line := range []string{"", "    at main.go:12", "2025-09-14 21:00:05 no brackets", "2025-09-14 21:00:05 [INFO] []"} {
+		if _, ok := ParseLine(line); ok {
+			t.Errorf("Expected %q not to start an entry", line)
+		}
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Now().Truncate(time.Second).Add(-time.Hour)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	write := func(name string, entries ...LogEntry) {
+		var lines []string
+		for _, entry := range entries {
+			lines = append(lines, Format(entry, false)+"\n")
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "")), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The buffer of web holds its last two entries, which the files also hold
+	// to the second
+	four := LogEntry{Timestamp: at(3*time.Second + 100*time.Millisecond), Level: "info", Process: "web", Message: "four", Stream: Stdout}
+	five := LogEntry{Timestamp: at(3*time.Second + 200*time.Millisecond), Level: "info", Process: "web", Message: "five", Stream: Stdout}
+	six := LogEntry{Timestamp: at(4*time.Second + 100*time.Millisecond), Level: "error", Process: "web", Message: "six", Stream: Stderr}
+	write("web.log.1",
+		LogEntry{Timestamp: at(0), Level: "info", Process: "web", Message: "one"},
+		LogEntry{Timestamp: at(time.Second), Level: "info", Process: "web.2", Message: "two"})
+	write("web.log",
+		LogEntry{Timestamp: at(2 * time.Second), Level: "info", Process: "web", Message: "three\ncontinued"},
+		four, five, six)
+	write("notes.txt", LogEntry{Timestamp: at(0), Level: "info", Process: "notes", Message: "not a log file"})
+
+	manager := NewLogManager(2)
+	for _, entry := range []LogEntry{four, five, six} {
+		manager.Add(entry)
+	}
+	manager.Add(LogEntry{Timestamp: at(5 * time.Second), Level: "info", Process: "api", Message: "seven"})
+	archive := NewArchive(manager, dir)
+
+	collect := func(filter Filter) []string {
+		var messages []string
+		err := archive.Each(filter, func(entry LogEntry) error {
+			messages = append(messages, entry.Message)
+			if entry.Message == "five" && entry.Stream != Stdout {
+				t.Errorf("Expected buffered entries to come from the buffer, got %+v", entry)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Each failed: %v", err)
+		}
+		return messages
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected string
+	}{
+		{"everything", Filter{}, "one,two,three\ncontinued,four,five,six,seven"},
+		{"one instance", Filter{Processes: []string{"web.2"}}, "two"},
+		{"excluded app", Filter{Exclude: []string{"web"}}, "seven"},
+		{"time range", Filter{Since: at(time.Second), Until: at(4 * time.Second)}, "two,three\ncontinued,four,five"},
+		{"level", Filter{Level: "error"}, "six"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(collect(tt.filter), ","); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	oldest, err := archive.Oldest(Filter{})
+	if err != nil || !oldest.Equal(t0) {
+		t.Errorf("Expected the oldest entry at %s, got %s (%v)", t0, oldest, err)
+	}
+	if oldest, _ := archive.Oldest(Filter{Processes: []string{"api"}}); !oldest.Equal(at(5 * time.Second)) {
+		t.Errorf("Expected the oldest api entry from the buffer, got %s", oldest)
+	}
+
+	// Without a log directory only the buffers are read
+	if oldest, _ := NewArchive(manager, "").Oldest(Filter{}); !oldest.Equal(five.Timestamp) {
+		t.Errorf("Expected the oldest buffered entry, got %s", oldest)
+	}
+}
@@ -2,6 +2,9 @@ package logs
 
 import (
 	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,8 +16,15 @@ type LogEntry struct {
 	Level     string    `json:"level"`
 	Process   string    `json:"process"`
 	Message   string    `json:"message"`
+	Stream    string    `json:"stream,omitempty"` // stdout or stderr for process output, empty for guvnor's own messages
 }
 
+// Output streams of process output entries
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
 // CircularBuffer implements a thread-safe circular buffer for log entries
 type CircularBuffer struct {
 	buffer []LogEntry
@@ -114,6 +124,29 @@ func (cb *CircularBuffer) GetAll() []LogEntry {
 	return entries
 }
 
+// Find returns the last n entries the filter selects, oldest first; all of
+// them when n is not positive
+func (cb *CircularBuffer) Find(n int, filter Filter) []LogEntry {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+	
+	var entries []LogEntry
+	count := cb.count()
+	// Walk back from the newest entry, so only the matches are copied
+	for i := count - 1; i >= 0 && (n <= 0 || len(entries) < n); i-- {
+		entry := cb.buffer[(cb.head+i)%cb.size]
+		if !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since) {
+			break
+		}
+		if filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	
+	slices.Reverse(entries)
+	return entries
+}
+
 // count returns the number of entries in the buffer (must be called with lock held)
 func (cb *CircularBuffer) count() int {
 	if cb.full {
@@ -132,11 +165,23 @@ func (cb *CircularBuffer) Clear() {
 	cb.full = false
 }
 
-// FormatEntry formats a log entry for display
+// FormatEntry formats a log entry for display on a terminal
 func FormatEntry(entry LogEntry) string {
+	return Format(entry, true)
+}
+
+// Format formats a log entry for display, with ANSI colors only when color
+// is set, so output piped to files or other tools stays plain. Each process
+// name gets its own color, so interleaved processes are told apart, and
+// process output written to stderr is shown in red.
+func Format(entry LogEntry, color bool) string {
 	timestamp := entry.Timestamp.Format("2006-01-02 15:04:05")
 	level := strings.ToUpper(entry.Level)
 	
+	if !color {
+		return fmt.Sprintf("%s [%s] [%s] %s", timestamp, level, entry.Process, entry.Message)
+	}
+	
 	// Color coding for levels (ANSI colors)
 	var colorCode string
 	switch strings.ToLower(entry.Level) {
@@ -154,21 +199,52 @@ func FormatEntry(entry LogEntry) string {
 	
 	resetColor := "\033[0m"
 	
-	return fmt.Sprintf("%s [%s%s%s] [%s] %s",
+	message := entry.Message
+	if entry.Stream == Stderr {
+		message = "\033[31m" + message + resetColor
+	}
+	
+	return fmt.Sprintf("%s [%s%s%s] [%s%s%s] %s",
 		timestamp,
 		colorCode,
 		level,
 		resetColor,
+		processColor(entry.Process),
 		entry.Process,
-		entry.Message,
+		resetColor,
+		message,
 	)
 }
 
+// processColors are the colors process names are shown in; red is left for stderr
+var processColors = []string{
+	"[36m", // Cyan
+	"[33m", // Yellow
+	"[32m", // Green
+	"[35m", // Magenta
+	"[34m", // Blue
+	"[96m", // Bright cyan
+	"[93m", // Bright yellow
+	"[92m", // Bright green
+	"[95m", // Bright magenta
+	"[94m", // Bright blue
+}
+
+// processColor picks the color of a process name from a hash of the name, so
+// a process keeps its color across runs of the logs command
+func processColor(process string) string {
+	h := fnv.New32a()
+	h.Write([]byte(process))
+	return processColors[h.Sum32()%uint32(len(processColors))]
+}
+
 // LogManager manages logs for all processes
 type LogManager struct {
 	buffers map[string]*CircularBuffer
 	mu      sync.RWMutex
 	capacity int
+	hooks   []func(LogEntry) // Called with every new entry, e.g. to ship it elsewhere
+	subscribers map[*subscription]struct{} // Followers of new entries, e.g. guvnor logs -f
 }
 
 // NewLogManager creates a new log manager
@@ -181,21 +257,40 @@ func NewLogManager(capacity int) *LogManager {
 
 // Log adds a log entry for a specific process
 func (lm *LogManager) Log(process, level, message string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	
-	if _, exists := lm.buffers[process]; !exists {
-		lm.buffers[process] = NewCircularBuffer(lm.capacity)
-	}
-	
-	entry := LogEntry{
+	lm.Add(LogEntry{
 		Timestamp: time.Now(),
 		Level:     level,
 		Process:   process,
 		Message:   message,
+	})
+}
+
+// Add adds an entry that carries its own timestamp and stream, such as a
+// line of process output
+func (lm *LogManager) Add(entry LogEntry) {
+	lm.mu.Lock()
+	
+	if _, exists := lm.buffers[entry.Process]; !exists {
+		lm.buffers[entry.Process] = NewCircularBuffer(lm.capacity)
+	}
+	
+	lm.buffers[entry.Process].Add(entry)
+	lm.publish(entry)
+	hooks := lm.hooks
+	lm.mu.Unlock()
+	
+	for _, hook := range hooks {
+		hook(entry)
 	}
+}
+
+// AddHook calls hook with every entry logged from now on. Hooks run on the
+// logging goroutine and must not block.
+func (lm *LogManager) AddHook(hook func(LogEntry)) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
 	
-	lm.buffers[process].Add(entry)
+	lm.hooks = append(lm.hooks, hook)
 }
 
 // GetProcessLogs returns the last n log entries for a specific process
@@ -215,22 +310,17 @@ func (lm *LogManager) GetAllLogs(n int) []LogEntry {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 	
-	var allEntries []LogEntry
-	
-	// Collect all entries from all processes
-	for _, buffer := range lm.buffers {
-		entries := buffer.GetAll()
-		allEntries = append(allEntries, entries...)
-	}
-	
-	// Sort by timestamp (bubble sort for simplicity, could use sort.Slice)
-	for i := 0; i < len(allEntries)-1; i++ {
-		for j := 0; j < len(allEntries)-i-1; j++ {
-			if allEntries[j].Timestamp.After(allEntries[j+1].Timestamp) {
-				allEntries[j], allEntries[j+1] = allEntries[j+1], allEntries[j]
-			}
+	// Each buffer is in time order, so merging them keeps it; with n set,
+	// each holds at most n of the last n entries overall
+	runs := make([][]LogEntry, 0, len(lm.buffers))
+	for _, process := range lm.sortedProcesses() {
+		if n > 0 {
+			runs = append(runs, lm.buffers[process].GetLast(n))
+		} else {
+			runs = append(runs, lm.buffers[process].GetAll())
 		}
 	}
+	allEntries := mergeByTime(runs)
 	
 	// Return last n entries
 	if n > 0 && n < len(allEntries) {
@@ -240,6 +330,37 @@ func (lm *LogManager) GetAllLogs(n int) []LogEntry {
 	return allEntries
 }
 
+// FindLogs returns the last n entries the filter selects, from the processes
+// it selects interleaved by timestamp
+func (lm *LogManager) FindLogs(n int, filter Filter) []LogEntry {
+	lm.mu.RLock()
+	defer lm.mu.RUnlock()
+	return lm.findLocked(n, filter)
+}
+
+// findLocked is FindLogs (must be called with lock held)
+func (lm *LogManager) findLocked(n int, filter Filter) []LogEntry {
+	// Each buffer holds at most n of the last n matches overall
+	var runs [][]LogEntry
+	for _, process := range lm.sortedProcesses() {
+		if filter.SelectsProcess(process) {
+			runs = append(runs, lm.buffers[process].Find(n, filter))
+		}
+	}
+	entries := mergeByTime(runs)
+	if n > 0 && n < len(entries) {
+		return entries[len(entries)-n:]
+	}
+	return entries
+}
+
+// sortedProcesses returns the names of the buffers in order, so entries
+// logged at the same time always come out in the same order (must be called
+// with lock held)
+func (lm *LogManager) sortedProcesses() []string {
+	return slices.Sorted(maps.Keys(lm.buffers))
+}
+
 // GetProcessNames returns all process names that have logs
 func (lm *LogManager) GetProcessNames() []string {
 	lm.mu.RLock()
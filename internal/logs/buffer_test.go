@@ -0,0 +1,92 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetAllLogs(t *testing.T) {
+	lm := NewLogManager(3)
+	start := time.Now()
+	add := func(process string, offset int, message string) {
+		lm.Add(LogEntry{Timestamp: start.Add(time.Duration(offset) * time.Millisecond), Level: "info", Process: process, Message: message})
+	}
+	add("web", 1, "w1")
+	add("api", 2, "a2")
+	add("web", 3, "w3")
+	add("worker", 3, "k3")
+	add("api", 3, "a3")
+	add("web", 5, "w5")
+	add("api", 6, "a6")
+	add("api", 7, "a7") // Pushes a2 out of api's buffer
+
+	messages := func(entries []LogEntry) string {
+		var all []string
+		for _, entry := range entries {
+			all = append(all, entry.Message)
+		}
+		return strings.Join(all, ",")
+	}
+
+	// Entries logged at the same time come out by process name
+	if got := messages(lm.GetAllLogs(0)); got != "w1,a3,w3,k3,w5,a6,a7" {
+		t.Errorf("Unexpected order: %s", got)
+	}
+	if got := messages(lm.GetAllLogs(3)); got != "w5,a6,a7" {
+		t.Errorf("Unexpected last entries: %s", got)
+	}
+	if got := messages(lm.FindLogs(2, Filter{Exclude: []string{"api"}})); got != "k3,w5" {
+		t.Errorf("Unexpected filtered entries: %s", got)
+	}
+	if got := NewLogManager(3).GetAllLogs(0); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty list without logs, got %v", got)
+	}
+}
+
+// benchmarkLogManager fills the buffers of apps apps with size entries each,
+// interleaved in time as concurrent apps log
+func benchmarkLogManager(apps, size int) *LogManager {
+	lm := NewLogManager(size)
+	start := time.Now()
+	for i := 0; i < size; i++ {
+		for app := 0; app < apps; app++ {
+			lm.Add(LogEntry{
+				Timestamp: start.Add(time.Duration(i*apps+app) * time.Microsecond),
+				Level:     "info",
+				Process:   fmt.Sprintf("app-%d", app),
+				Message:   "GET /health 200",
+			})
+		}
+	}
+	return lm
+}
+
+func BenchmarkGetAllLogs(b *testing.B) {
+	for _, apps := range []int{1, 10, 50} {
+		lm := benchmarkLogManager(apps, 1000)
+		b.Run(fmt.Sprintf("apps=%d/all", apps), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lm.GetAllLogs(0)
+			}
+		})
+		b.Run(fmt.Sprintf("apps=%d/last100", apps), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				lm.GetAllLogs(100)
+			}
+		})
+	}
+}
+
+func BenchmarkFindLogs(b *testing.B) {
+	lm := benchmarkLogManager(50, 1000)
+	filter, err := ParseFilter("", "health", "", "", time.Now())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lm.FindLogs(100, filter)
+	}
+}
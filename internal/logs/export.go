@@ -0,0 +1,78 @@
+package logs
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Export formats
+const (
+	ExportNDJSON = "ndjson" // One JSON entry per line
+	ExportCSV    = "csv"    // timestamp, level, process, stream and message columns
+	ExportText   = "text"   // As guvnor logs shows entries, without colors
+)
+
+// exportContentTypes maps export formats to their media types
+var exportContentTypes = map[string]string{
+	ExportNDJSON: "application/x-ndjson",
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportText:   "text/plain; charset=utf-8",
+}
+
+// ExportContentType returns the media type of an export format
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// Exporter writes entries one at a time in an export format, so exports of
+// any size pass through without being held in memory
+type Exporter struct {
+	format string
+	w      io.Writer
+	json   *json.Encoder
+	csv    *csv.Writer
+}
+
+// NewExporter returns an exporter writing format to w. CSV output starts
+// with a header row.
+func NewExporter(w io.Writer, format string) (*Exporter, error) {
+	e := &Exporter{format: format, w: w}
+	switch format {
+	case ExportNDJSON:
+		e.json = json.NewEncoder(w)
+	case ExportCSV:
+		e.csv = csv.NewWriter(w)
+		if err := e.csv.Write([]string{"timestamp", "level", "process", "stream", "message"}); err != nil {
+			return nil, err
+		}
+	case ExportText:
+	default:
+		return nil, fmt.Errorf("unknown export format %q (use ndjson, csv or text)", format)
+	}
+	return e, nil
+}
+
+// Write writes one entry
+func (e *Exporter) Write(entry LogEntry) error {
+	switch e.format {
+	case ExportNDJSON:
+		return e.json.Encode(entry)
+	case ExportCSV:
+		return e.csv.Write([]string{entry.Timestamp.Format(time.RFC3339Nano), entry.Level, entry.Process, entry.Stream, entry.Message})
+	default:
+		_, err := fmt.Fprintln(e.w, Format(entry, false))
+		return err
+	}
+}
+
+// Flush writes out what the exporter buffers
+func (e *Exporter) Flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package logs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// levelRanks orders log levels by severity; unknown levels rank as info
+var levelRanks = map[string]int{
+	"trace":   0,
+	"debug":   1,
+	"info":    2,
+	"warn":    3,
+	"warning": 3,
+	"error":   4,
+	"fatal":   5,
+	"panic":   5,
+}
+
+// SystemProcesses are the names guvnor logs its own messages under
+var SystemProcesses = []string{"system", "proxy-server"}
+
+// Filter selects log entries; the zero value matches every entry
+type Filter struct {
+	Processes []string       // Apps or instances to show, all when empty; an app includes its instances (web.2)
+	Exclude   []string       // Apps or instances left out
+	Level     string         // Minimum level, e.g. warn also matches error
+	Grep      *regexp.Regexp // Matched against the message
+	Since     time.Time      // Entries logged at or after, unless zero
+	Until     time.Time      // Entries logged before, unless zero
+
+	// Visible limits the entries to the apps it accepts, whatever the other
+	// fields select, e.g. those an API token covers; nil shows every app
+	Visible func(app string) bool
+}
+
+// ParseFilter builds a filter from the level, grep, since and until options
+// of the logs command and API. since and until are durations back from now,
+// such as 10m, or RFC 3339 times.
+func ParseFilter(level, grep, since, until string, now time.Time) (Filter, error) {
+	var filter Filter
+	var err error
+
+	if level != "" {
+		if _, known := levelRanks[strings.ToLower(level)]; !known {
+			return Filter{}, fmt.Errorf("unknown log level %q (use debug, info, warn or error)", level)
+		}
+		filter.Level = strings.ToLower(level)
+	}
+	if grep != "" {
+		if filter.Grep, err = regexp.Compile(grep); err != nil {
+			return Filter{}, fmt.Errorf("invalid grep pattern: %w", err)
+		}
+	}
+	if filter.Since, err = ParseTime(since, now); err != nil {
+		return Filter{}, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.Until, err = ParseTime(until, now); err != nil {
+		return Filter{}, fmt.Errorf("invalid until: %w", err)
+	}
+	if !filter.Since.IsZero() && !filter.Until.IsZero() && !filter.Since.Before(filter.Until) {
+		return Filter{}, fmt.Errorf("since must be before until")
+	}
+	return filter, nil
+}
+
+// ParseTime parses a duration back from now, such as 10m, or an RFC 3339 time;
+// "" is the zero time
+func ParseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("%q is negative", value)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration such as 10m nor an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+// IsZero reports whether the filter matches every entry
+func (f Filter) IsZero() bool {
+	return len(f.Processes) == 0 && len(f.Exclude) == 0 && f.Level == "" && f.Grep == nil && f.Since.IsZero() && f.Until.IsZero() &&
+		f.Visible == nil
+}
+
+// SelectsProcess reports whether the filter shows entries of process
+func (f Filter) SelectsProcess(process string) bool {
+	if f.Visible != nil && !f.Visible(appOf(process)) {
+		return false
+	}
+	if len(f.Processes) > 0 && !selects(f.Processes, process) {
+		return false
+	}
+	return !selects(f.Exclude, process)
+}
+
+// Match reports whether the filter selects entry
+func (f Filter) Match(entry LogEntry) bool {
+	if !f.SelectsProcess(entry.Process) {
+		return false
+	}
+	if f.Level != "" && levelRank(entry.Level) < levelRank(f.Level) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Timestamp.Before(f.Until) {
+		return false
+	}
+	return f.Grep == nil || f.Grep.MatchString(entry.Message)
+}
+
+func levelRank(level string) int {
+	if rank, known := levelRanks[strings.ToLower(level)]; known {
+		return rank
+	}
+	return levelRanks["info"]
+}
+
+// SplitProcesses splits a comma-separated list of process names, such as
+// web,api, dropping empty names
+func SplitProcesses(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// appOf returns the app of an instance such as web.2, else process itself
+func appOf(process string) string {
+	if app, instance, ok := cutLast(process, "."); ok && instance != "" && strings.Trim(instance, "0123456789") == "" {
+		return app
+	}
+	return process
+}
+
+// selects reports whether process is one of names or an instance of one,
+// such as web.2 of web
+func selects(names []string, process string) bool {
+	for _, name := range names {
+		if process == name {
+			return true
+		}
+		if instance, ok := strings.CutPrefix(process, name+"."); ok && instance != "" && strings.Trim(instance, "0123456789") == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package logs
+
+import "container/heap"
+
+// mergeByTime merges runs of entries, each in timestamp order, into one
+// timestamp ordered slice in O(n log k) for k runs. Entries with the same
+// timestamp keep the order of their runs.
+func mergeByTime(runs [][]LogEntry) []LogEntry {
+	total := 0
+	h := make(runHeap, 0, len(runs))
+	for i, run := range runs {
+		total += len(run)
+		if len(run) > 0 {
+			h = append(h, runCursor{run: run, index: i})
+		}
+	}
+
+	merged := make([]LogEntry, 0, total)
+	switch len(h) {
+	case 0:
+		return merged
+	case 1:
+		return append(merged, h[0].run...)
+	}
+
+	heap.Init(&h)
+	for len(h) > 0 {
+		cursor := &h[0]
+		merged = append(merged, cursor.run[0])
+		if cursor.run = cursor.run[1:]; len(cursor.run) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return merged
+}
+
+// runCursor is the unmerged rest of a run
+type runCursor struct {
+	run   []LogEntry
+	index int // Position of the run, breaking timestamp ties
+}
+
+// runHeap orders runs by their next entry
+type runHeap []runCursor
+
+func (h runHeap) Len() int { return len(h) }
+
+func (h runHeap) Less(i, j int) bool {
+	a, b := h[i].run[0].Timestamp, h[j].run[0].Timestamp
+	if a.Equal(b) {
+		return h[i].index < h[j].index
+	}
+	return a.Before(b)
+}
+
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *runHeap) Push(x any) { *h = append(*h, x.(runCursor)) }
+
+func (h *runHeap) Pop() any {
+	old := *h
+	cursor := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return cursor
+}
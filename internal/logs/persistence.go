@@ -38,6 +38,12 @@ func (plm *PersistentLogManager) Log(process, level, message string) {
 	plm.saveToFile()
 }
 
+// Add adds an entry and persists it
+func (plm *PersistentLogManager) Add(entry LogEntry) {
+	plm.LogManager.Add(entry)
+	plm.saveToFile()
+}
+
 // saveToFile saves current logs to file
 func (plm *PersistentLogManager) saveToFile() {
 	// Get all logs from all processes
@@ -74,7 +80,7 @@ func (plm *PersistentLogManager) loadFromFile() {
 	// Add logs back to buffers
 	for _, entry := range logs {
 		// Skip saving to file during load to avoid recursion
-		plm.LogManager.Log(entry.Process, entry.Level, entry.Message)
+		plm.LogManager.Add(entry)
 	}
 }
 
@@ -0,0 +1,169 @@
+package logs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Retention limits the disk space taken by a directory of log files. Only
+// rotated files (web.log.1, web.log.2) are removed, never the files being
+// written, so a limit below the size of the current files is not reached.
+type Retention struct {
+	MaxTotal int64            // Bytes of all files together, no limit when 0
+	MaxApp   int64            // Bytes of the files of one app, no limit when 0
+	Apps     map[string]int64 // MaxApp of single apps
+	MaxAge   time.Duration    // Rotated files last written longer ago are removed, no limit when 0
+}
+
+// Pruned is a rotated log file removed to meet a retention limit
+type Pruned struct {
+	Path   string
+	App    string
+	Size   int64
+	Reason string
+}
+
+// logFile is a file found in a log directory
+type logFile struct {
+	path    string
+	app     string
+	size    int64
+	modTime time.Time
+	rotated bool
+}
+
+// Prune removes rotated log files from dir, oldest first, until the files of
+// every app and all files together are within the retention limits. With
+// dryRun set it only reports what it would remove.
+func Prune(dir string, retention Retention, now time.Time, dryRun bool) ([]Pruned, error) {
+	files, err := readLogDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []Pruned
+	removed := make(map[string]bool)
+	remove := func(file logFile, reason string) error {
+		if !dryRun {
+			if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file.path, err)
+			}
+		}
+		removed[file.path] = true
+		pruned = append(pruned, Pruned{Path: file.path, App: file.app, Size: file.size, Reason: reason})
+		return nil
+	}
+
+	// Oldest first, so limits are met by removing the oldest files
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	if retention.MaxAge > 0 {
+		for _, file := range files {
+			if file.rotated && now.Sub(file.modTime) > retention.MaxAge {
+				if err := remove(file, fmt.Sprintf("older than %s", retention.MaxAge)); err != nil {
+					return pruned, err
+				}
+			}
+		}
+	}
+
+	usage := make(map[string]int64)
+	var total int64
+	for _, file := range files {
+		if !removed[file.path] {
+			usage[file.app] += file.size
+			total += file.size
+		}
+	}
+
+	for _, file := range files {
+		limit, exists := retention.Apps[file.app]
+		if !exists {
+			limit = retention.MaxApp
+		}
+		if removed[file.path] || !file.rotated || limit <= 0 || usage[file.app] <= limit {
+			continue
+		}
+		if err := remove(file, "over the limit of "+file.app); err != nil {
+			return pruned, err
+		}
+		usage[file.app] -= file.size
+		total -= file.size
+	}
+
+	for _, file := range files {
+		if retention.MaxTotal <= 0 || total <= retention.MaxTotal {
+			break
+		}
+		if removed[file.path] || !file.rotated {
+			continue
+		}
+		if err := remove(file, "over the total limit"); err != nil {
+			return pruned, err
+		}
+		total -= file.size
+	}
+	return pruned, nil
+}
+
+// Usage returns the bytes taken by the log files of each app in dir
+func Usage(dir string) (map[string]int64, error) {
+	files, err := readLogDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	usage := make(map[string]int64)
+	for _, file := range files {
+		usage[file.app] += file.size
+	}
+	return usage, nil
+}
+
+// readLogDir lists the regular files of dir, with the app each belongs to:
+// web.log and its rotations web.log.1, web.log.2 belong to web
+func readLogDir(dir string) ([]logFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	var files []logFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name, rotated := entry.Name(), false
+		if base, suffix, found := cutLast(name, "."); found {
+			if _, err := strconv.Atoi(suffix); err == nil {
+				name, rotated = base, true
+			}
+		}
+		files = append(files, logFile{
+			path:    filepath.Join(dir, entry.Name()),
+			app:     strings.TrimSuffix(name, ".log"),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			rotated: rotated,
+		})
+	}
+	return files, nil
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
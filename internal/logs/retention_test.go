@@ -0,0 +1,90 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFile(t *testing.T) {
+	// Writes that would overflow the file start a new one, keeping two backups
+	path := filepath.Join(t.TempDir(), "logs", "web.log")
+	file, err := OpenRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	file.Close()
+
+	expected := map[string]string{path: "four\nfive\n", path + ".1": "three\n", path + ".2": "one\ntwo\n"}
+	for name, content := range expected {
+		data, err := os.ReadFile(name)
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to hold %q, got %q (%v)", filepath.Base(name), content, data, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only two backups to be kept")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		os.Chtimes(path, now.Add(-age), now.Add(-age))
+	}
+	write("web.log", 50, 0)
+	write("web.log.1", 50, time.Hour)
+	write("web.log.2", 50, 2*time.Hour)
+	write("api.log", 10, 0)
+	write("api.log.1", 10, 3*time.Hour)
+	write("api.log.2", 10, 72*time.Hour)
+	write("worker.log", 200, 0)
+	write("worker.log.1", 30, 4*time.Hour)
+
+	retention := Retention{MaxApp: 120, Apps: map[string]int64{"worker": 0}, MaxTotal: 320, MaxAge: 48 * time.Hour}
+
+	// A dry run reports the files without removing them
+	pruned, err := Prune(dir, retention, now, true)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	var names []string
+	for _, file := range pruned {
+		names = append(names, filepath.Base(file.Path))
+	}
+	// api.log.2 is too old, web.log.2 puts web over its limit and worker.log.1,
+	// although worker has no limit of its own, is the oldest rotated file left
+	// while all files take more than 320 bytes
+	if got := strings.Join(names, ","); got != "api.log.2,web.log.2,worker.log.1" {
+		t.Errorf("Unexpected files to prune: %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web.log.2")); err != nil {
+		t.Errorf("Expected a dry run to keep the files: %v", err)
+	}
+
+	if _, err := Prune(dir, retention, now, false); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	usage, err := Usage(dir)
+	if err != nil {
+		t.Fatalf("Usage failed: %v", err)
+	}
+	if usage["web"] != 100 || usage["api"] != 20 || usage["worker"] != 200 {
+		t.Errorf("Unexpected usage after pruning: %v", usage)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web.log")); err != nil {
+		t.Errorf("Expected the current file to be kept: %v", err)
+	}
+}
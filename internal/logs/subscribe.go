@@ -0,0 +1,49 @@
+package logs
+
+// subscriberBuffer is how far a subscriber may fall behind before entries
+// are dropped for it
+const subscriberBuffer = 256
+
+// subscription receives new entries of some processes
+type subscription struct {
+	entries   chan LogEntry
+	processes []string // Empty for every process
+}
+
+// Subscribe returns a channel receiving each entry logged from now on by the
+// given apps or instances, or by every process when none are given, and a
+// function ending the subscription. Entries are dropped rather than block
+// logging when the subscriber falls behind.
+func (lm *LogManager) Subscribe(processes ...string) (<-chan LogEntry, func()) {
+	sub := &subscription{entries: make(chan LogEntry, subscriberBuffer), processes: processes}
+
+	lm.mu.Lock()
+	if lm.subscribers == nil {
+		lm.subscribers = make(map[*subscription]struct{})
+	}
+	lm.subscribers[sub] = struct{}{}
+	lm.mu.Unlock()
+
+	return sub.entries, func() {
+		lm.mu.Lock()
+		defer lm.mu.Unlock()
+		if _, exists := lm.subscribers[sub]; exists {
+			delete(lm.subscribers, sub)
+			close(sub.entries)
+		}
+	}
+}
+
+// publish sends an entry to its subscribers without blocking; the caller
+// holds lm.mu
+func (lm *LogManager) publish(entry LogEntry) {
+	for sub := range lm.subscribers {
+		if len(sub.processes) > 0 && !selects(sub.processes, entry.Process) {
+			continue
+		}
+		select {
+		case sub.entries <- entry:
+		default:
+		}
+	}
+}
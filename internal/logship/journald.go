@@ -0,0 +1,101 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// DefaultJournaldSocket is where journald receives native protocol messages
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+// journaldSink sends entries to the local journal over its native protocol,
+// with the process name in GUVNOR_PROCESS for journalctl GUVNOR_PROCESS=web
+type journaldSink struct {
+	name   string
+	socket string
+	tag    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newJournaldSink(name string, cfg Config) *journaldSink {
+	socket := cfg.Address
+	if socket == "" {
+		socket = DefaultJournaldSocket
+	}
+	return &journaldSink{name: name, socket: socket, tag: cfg.Tag}
+}
+
+func (s *journaldSink) Name() string {
+	return s.name
+}
+
+func (s *journaldSink) Write(ctx context.Context, entries []logs.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "unixgram", s.socket)
+		if err != nil {
+			return fmt.Errorf("failed to connect to journald at %s: %w", s.socket, err)
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, entry := range entries {
+		if _, err := s.conn.Write(s.message(entry)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to write to journald: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *journaldSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// message encodes an entry as journal fields. Values with newlines use the
+// binary form: the name, a newline, the little-endian 64-bit length and the value.
+func (s *journaldSink) message(entry logs.LogEntry) []byte {
+	var b bytes.Buffer
+	field := func(name, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", name, value)
+			return
+		}
+		b.WriteString(name)
+		b.WriteByte('\n')
+		binary.Write(&b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+
+	field("MESSAGE", strings.TrimRight(entry.Message, "\n"))
+	field("PRIORITY", strconv.Itoa(severity(entry.Level)))
+	field("SYSLOG_IDENTIFIER", s.tag)
+	field("GUVNOR_PROCESS", entry.Process)
+	field("GUVNOR_TIMESTAMP", strconv.FormatInt(entry.Timestamp.UnixMicro(), 10))
+	return b.Bytes()
+}
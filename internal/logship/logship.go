@@ -0,0 +1,247 @@
+// Package logship forwards process and access logs to external systems:
+// a syslog server, the local journald or a Grafana Loki push API. Entries are
+// buffered while a sink is unreachable and sent again once it recovers.
+package logship
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// Sink types
+const (
+	Syslog   = "syslog"
+	Journald = "journald"
+	Loki     = "loki"
+)
+
+// Defaults for sinks that do not set them
+const (
+	DefaultBuffer  = 10000
+	DefaultTimeout = 10 * time.Second
+	DefaultTag     = "guvnor"
+)
+
+const (
+	batchSize     = 500              // Entries sent in one write
+	flushInterval = time.Second      // How long entries wait for a batch to fill
+	maxBackoff    = 30 * time.Second // Longest wait between retries of a failing sink
+)
+
+// Sink writes batches of log entries to an external system
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, entries []logs.LogEntry) error
+	Close() error
+}
+
+// Config contains sink configuration
+type Config struct {
+	Type     string            // syslog, journald or loki
+	Address  string            // syslog: udp://, tcp://, tls:// or unix:// address; journald: socket path
+	URL      string            // loki: push API URL
+	Facility string            // syslog: facility name, daemon by default
+	Tag      string            // syslog app name, journald identifier and loki job label
+	Labels   map[string]string // loki: extra stream labels
+	Headers  map[string]string // loki: request headers, e.g. Authorization or X-Scope-OrgID
+	Timeout  time.Duration
+}
+
+// New creates a sink from configuration. Sinks connect on their first write,
+// so an unreachable endpoint does not fail the start.
+func New(name string, cfg Config) (Sink, error) {
+	if cfg.Tag == "" {
+		cfg.Tag = DefaultTag
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	switch strings.ToLower(cfg.Type) {
+	case Syslog:
+		return newSyslogSink(name, cfg)
+	case Journald:
+		return newJournaldSink(name, cfg), nil
+	case Loki:
+		return newLokiSink(name, cfg)
+	default:
+		return nil, fmt.Errorf("log sink %s: unknown type %q (use syslog, journald or loki)", name, cfg.Type)
+	}
+}
+
+// permanentError marks a write the sink rejected for good, so retrying the
+// same entries cannot succeed
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Shipper sends log entries to a sink in the background. Entries queue up to
+// the buffer size while the sink fails, and the oldest are dropped beyond it.
+type Shipper struct {
+	sink    Sink
+	buffer  int
+	timeout time.Duration
+	queue   chan logs.LogEntry
+	logger  *logrus.Entry
+
+	mu      sync.Mutex
+	dropped int // Entries lost since the sink last accepted a write
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewShipper creates a shipper for sink keeping up to buffer entries, or
+// DefaultBuffer when buffer is not positive
+func NewShipper(sink Sink, buffer int, timeout time.Duration, logger *logrus.Logger) *Shipper {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Shipper{
+		sink:    sink,
+		buffer:  buffer,
+		timeout: timeout,
+		queue:   make(chan logs.LogEntry, min(buffer, 1024)),
+		logger:  logger.WithField("component", "log-shipper").WithField("sink", sink.Name()),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Ship queues an entry without blocking the caller
+func (s *Shipper) Ship(entry logs.LogEntry) {
+	select {
+	case s.queue <- entry:
+	default:
+		s.drop(1)
+	}
+}
+
+// Start sends queued entries until Stop is called, so entries logged while
+// the server shuts down are still shipped
+func (s *Shipper) Start() {
+	go s.run()
+}
+
+// Stop sends what is still queued, giving up when ctx is done, and closes the sink
+func (s *Shipper) Stop(ctx context.Context) {
+	s.stopOnce.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+	}
+}
+
+// Dropped returns how many entries were lost since the sink last accepted a write
+func (s *Shipper) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+func (s *Shipper) drop(n int) {
+	s.mu.Lock()
+	s.dropped += n
+	s.mu.Unlock()
+}
+
+func (s *Shipper) run() {
+	defer close(s.done)
+	defer s.sink.Close()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var pending []logs.LogEntry
+	var retryAt time.Time
+	failures := 0
+
+	add := func(entry logs.LogEntry) {
+		pending = append(pending, entry)
+		if over := len(pending) - s.buffer; over > 0 {
+			pending = pending[over:]
+			s.drop(over)
+		}
+	}
+
+	// flush writes pending entries in batches until they are sent or the
+	// sink fails, after which it waits out a backoff before trying again
+	flush := func(force bool) {
+		for len(pending) > 0 && (force || !time.Now().Before(retryAt)) {
+			n := min(len(pending), batchSize)
+			writeCtx, cancel := context.WithTimeout(context.Background(), s.timeout)
+			err := s.sink.Write(writeCtx, pending[:n])
+			cancel()
+
+			var permanent *permanentError
+			switch {
+			case errors.As(err, &permanent):
+				s.logger.WithError(err).WithField("entries", n).Error("Log sink rejected entries, dropping them")
+				s.drop(n)
+			case err != nil:
+				failures++
+				backoff := min(time.Second<<min(failures-1, 5), maxBackoff)
+				retryAt = time.Now().Add(backoff)
+				if failures == 1 {
+					s.logger.WithError(err).Warn("Log sink unavailable, buffering entries")
+				}
+				return
+			default:
+				if failures > 0 {
+					s.logger.WithField("dropped", s.Dropped()).Info("Log sink recovered")
+				}
+				failures = 0
+				s.mu.Lock()
+				s.dropped = 0
+				s.mu.Unlock()
+			}
+			pending = pending[n:]
+		}
+	}
+
+	for {
+		select {
+		case entry := <-s.queue:
+			add(entry)
+			if len(pending) >= batchSize {
+				flush(false)
+			}
+		case <-ticker.C:
+			flush(false)
+		case <-s.stop:
+			for drained := false; !drained; {
+				select {
+				case entry := <-s.queue:
+					add(entry)
+				default:
+					drained = true
+				}
+			}
+			// A sink that is down would only delay the shutdown
+			if failures == 0 {
+				flush(true)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// fakeSink records written entries and fails the first failures writes
+type fakeSink struct {
+	mu       sync.Mutex
+	failures int
+	written  []logs.LogEntry
+}
+
+func (f *fakeSink) Name() string { return "fake" }
+
+func (f *fakeSink) Write(ctx context.Context, entries []logs.LogEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("unavailable")
+	}
+	f.written = append(f.written, entries...)
+	return nil
+}
+
+func (f *fakeSink) Close() error { return nil }
+
+func (f *fakeSink) messages() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var messages []string
+	for _, entry := range f.written {
+		messages = append(messages, entry.Message)
+	}
+	return messages
+}
+
+func TestShipper(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	// Entries beyond the buffer are dropped, the rest are sent on stop
+	sink := &fakeSink{}
+	shipper := NewShipper(sink, 2, time.Second, logger)
+	for _, message := range []string{"a", "b", "c"} {
+		shipper.Ship(logs.LogEntry{Process: "web", Level: "info", Message: message})
+	}
+	if shipper.Dropped() != 1 {
+		t.Errorf("Expected 1 dropped entry, got %d", shipper.Dropped())
+	}
+	shipper.Start()
+	shipper.Stop(context.Background())
+	if got := strings.Join(sink.messages(), ","); got != "a,b" {
+		t.Errorf("Expected a,b to be shipped, got %q", got)
+	}
+
+	// A failing sink keeps the entries and receives them once it recovers
+	sink = &fakeSink{failures: 1}
+	shipper = NewShipper(sink, 0, time.Second, logger)
+	shipper.Start()
+	defer shipper.Stop(context.Background())
+	shipper.Ship(logs.LogEntry{Process: "web", Level: "info", Message: "retried"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.messages()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := sink.messages(); len(got) != 1 || got[0] != "retried" {
+		t.Errorf("Expected the entry to be shipped after a retry, got %v", got)
+	}
+}
+
+func TestLokiSink(t *testing.T) {
+	status := http.StatusNoContent
+	var body struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	var tenant string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant = r.Header.Get("X-Scope-OrgID")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := New("loki", Config{Type: Loki, URL: server.URL, Labels: map[string]string{"env": "prod"}, Headers: map[string]string{"X-Scope-OrgID": "team"}})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	now := time.Unix(1700000000, 5)
+	entries := []logs.LogEntry{
+		{Timestamp: now, Process: "web", Level: "info", Message: "one"},
+		{Timestamp: now, Process: "api", Level: "error", Message: "two"},
+		{Timestamp: now, Process: "web", Level: "info", Message: "three"},
+	}
+	if err := sink.Write(context.Background(), entries); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if tenant != "team" {
+		t.Errorf("Expected configured headers to be sent, got tenant %q", tenant)
+	}
+	if len(body.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %+v", body.Streams)
+	}
+	web := body.Streams[0]
+	if web.Stream["job"] != "guvnor" || web.Stream["process"] != "web" || web.Stream["level"] != "info" || web.Stream["env"] != "prod" {
+		t.Errorf("Unexpected labels: %v", web.Stream)
+	}
+	if len(web.Values) != 2 || web.Values[0] != [2]string{"1700000000000000005", "one"} || web.Values[1][1] != "three" {
+		t.Errorf("Unexpected values: %v", web.Values)
+	}
+
+	var permanent *permanentError
+	status = http.StatusBadRequest
+	if err := sink.Write(context.Background(), entries); !errors.As(err, &permanent) {
+		t.Errorf("Expected a rejected push not to be retried, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := sink.Write(context.Background(), entries); err == nil || errors.As(err, &permanent) {
+		t.Errorf("Expected an unavailable Loki to be retried, got %v", err)
+	}
+
+	if _, err := New("loki", Config{Type: Loki, URL: "loki:3100"}); err == nil {
+		t.Error("Expected error for a URL without scheme")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	sink, err := New("syslog", Config{Type: Syslog, Address: conn.LocalAddr().String(), Facility: "local0"})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	defer sink.Close()
+
+	entry := logs.LogEntry{Timestamp: time.Now(), Process: "web app", Level: "error", Message: "boom"}
+	if err := sink.Write(context.Background(), []logs.LogEntry{entry}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	msg := string(buf[:n])
+	// local0 (16) * 8 + error (3)
+	if !strings.HasPrefix(msg, "<131>1 ") || !strings.Contains(msg, " guvnor ") || !strings.HasSuffix(msg, " web_app - boom") {
+		t.Errorf("Unexpected syslog message: %q", msg)
+	}
+
+	tcp := &syslogSink{network: "tcp", facility: 3, tag: "guvnor", hostname: "host"}
+	length, msg, _ := strings.Cut(string(tcp.frame(entry)), " ")
+	if length != strconv.Itoa(len(msg)) || !strings.HasPrefix(msg, "<27>1 ") {
+		t.Errorf("Expected an octet counted frame, got %q %q", length, msg)
+	}
+
+	for _, address := range []string{"ftp://host:21", "tcp://host", "unix://"} {
+		if _, _, err := ParseAddress(address); err == nil {
+			t.Errorf("Expected error for address %q", address)
+		}
+	}
+	if _, err := ParseFacility("local9"); err == nil {
+		t.Error("Expected error for unknown facility")
+	}
+}
+
+func TestJournaldMessage(t *testing.T) {
+	sink := newJournaldSink("journal", Config{Tag: "guvnor"})
+	msg := sink.message(logs.LogEntry{Timestamp: time.Now(), Process: "web", Level: "warn", Message: "line one\nline two"})
+
+	var length [8]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len("line one\nline two")))
+	if !bytes.HasPrefix(msg, append([]byte("MESSAGE\n"), length[:]...)) {
+		t.Errorf("Expected a multiline message in the binary form, got %q", msg)
+	}
+	for _, field := range []string{"PRIORITY=4\n", "SYSLOG_IDENTIFIER=guvnor\n", "GUVNOR_PROCESS=web\n"} {
+		if !bytes.Contains(msg, []byte(field)) {
+			t.Errorf("Expected %q in %q", field, msg)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// lokiSink pushes entries to the Loki push API, in one stream per process
+// and level labelled job, process and level plus the configured labels
+type lokiSink struct {
+	name    string
+	url     string
+	labels  map[string]string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newLokiSink(name string, cfg Config) (*lokiSink, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("log sink %s: url must be an http(s) URL of the Loki push API", name)
+	}
+
+	labels := map[string]string{"job": cfg.Tag}
+	for key, value := range cfg.Labels {
+		labels[key] = value
+	}
+	return &lokiSink{
+		name:    name,
+		url:     cfg.URL,
+		labels:  labels,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+func (s *lokiSink) Name() string {
+	return s.name
+}
+
+// lokiStream is a set of entries sharing labels in a push request
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func (s *lokiSink) Write(ctx context.Context, entries []logs.LogEntry) error {
+	body, err := json.Marshal(map[string][]*lokiStream{"streams": s.streams(entries)})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode log entries: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "guvnor-logship/1.0")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push logs to Loki: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("loki returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	// Other client errors, such as entries too old or too large, fail again on retry
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+func (s *lokiSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// streams groups entries by process and level, keeping their order
+func (s *lokiSink) streams(entries []logs.LogEntry) []*lokiStream {
+	var streams []*lokiStream
+	index := make(map[[2]string]*lokiStream)
+	for _, entry := range entries {
+		key := [2]string{entry.Process, strings.ToLower(entry.Level)}
+		stream, exists := index[key]
+		if !exists {
+			labels := make(map[string]string, len(s.labels)+2)
+			for name, value := range s.labels {
+				labels[name] = value
+			}
+			labels["process"], labels["level"] = key[0], key[1]
+			stream = &lokiStream{Stream: labels}
+			index[key] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(entry.Timestamp.UnixNano(), 10), entry.Message})
+	}
+	return streams
+}
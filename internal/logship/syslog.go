@@ -0,0 +1,208 @@
+package logship
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// DefaultSyslogAddress is the local syslog socket used when a syslog sink sets no address
+const DefaultSyslogAddress = "unix:///dev/log"
+
+// facilities are the syslog facility codes by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseFacility returns the code of a syslog facility name, daemon when empty
+func ParseFacility(name string) (int, error) {
+	if name == "" {
+		return facilities["daemon"], nil
+	}
+	code, ok := facilities[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %q", name)
+	}
+	return code, nil
+}
+
+// ParseAddress splits a syslog address into its network and address. Plain
+// host:port addresses use UDP.
+func ParseAddress(address string) (network, addr string, err error) {
+	if address == "" {
+		address = DefaultSyslogAddress
+	}
+	if !strings.Contains(address, "://") {
+		address = "udp://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid syslog address %q: %w", address, err)
+	}
+
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			return "", "", fmt.Errorf("invalid syslog address %q: %w", address, err)
+		}
+		return u.Scheme, u.Host, nil
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("invalid syslog address %q: socket path is required", address)
+		}
+		return u.Scheme, u.Path, nil
+	default:
+		return "", "", fmt.Errorf("invalid syslog address %q (use udp://, tcp://, tls:// or unix://)", address)
+	}
+}
+
+// syslogSink sends entries as RFC 5424 messages to a remote server, or in the
+// traditional RFC 3164 format understood by local syslog sockets
+type syslogSink struct {
+	name     string
+	network  string
+	addr     string
+	facility int
+	tag      string
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn // Nil until the first write and after a failed one
+}
+
+func newSyslogSink(name string, cfg Config) (*syslogSink, error) {
+	network, addr, err := ParseAddress(cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("log sink %s: %w", name, err)
+	}
+	facility, err := ParseFacility(cfg.Facility)
+	if err != nil {
+		return nil, fmt.Errorf("log sink %s: %w", name, err)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{name: name, network: network, addr: addr, facility: facility, tag: cfg.Tag, hostname: hostname}, nil
+}
+
+func (s *syslogSink) Name() string {
+	return s.name
+}
+
+func (s *syslogSink) Write(ctx context.Context, entries []logs.LogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog at %s: %w", s.addr, err)
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, entry := range entries {
+		if _, err := s.conn.Write(s.frame(entry)); err != nil {
+			s.conn.Close()
+			s.conn = nil
+			return fmt.Errorf("failed to write to syslog at %s: %w", s.addr, err)
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	switch s.network {
+	case "tls":
+		return (&tls.Dialer{NetDialer: &dialer}).DialContext(ctx, "tcp", s.addr)
+	case "unix":
+		// Local syslog daemons listen on datagram sockets, some on stream ones
+		conn, err := dialer.DialContext(ctx, "unixgram", s.addr)
+		if err != nil {
+			conn, err = dialer.DialContext(ctx, "unix", s.addr)
+		}
+		return conn, err
+	default:
+		return dialer.DialContext(ctx, s.network, s.addr)
+	}
+}
+
+// frame formats an entry as one syslog message. Stream transports use
+// octet counting (RFC 6587) so messages may contain newlines.
+func (s *syslogSink) frame(entry logs.LogEntry) []byte {
+	priority := s.facility*8 + severity(entry.Level)
+	message := strings.TrimRight(entry.Message, "\n")
+
+	if s.network == "unix" {
+		return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s: %s", priority, entry.Timestamp.Format(time.Stamp), s.tag, os.Getpid(), entry.Process, message))
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", priority, entry.Timestamp.Format(time.RFC3339Nano),
+		s.hostname, headerField(s.tag, 48), os.Getpid(), headerField(entry.Process, 32), message)
+	if s.network == "udp" {
+		return []byte(msg)
+	}
+	return []byte(strconv.Itoa(len(msg)) + " " + msg)
+}
+
+// severity maps a log level to a syslog severity
+func severity(level string) int {
+	switch strings.ToLower(level) {
+	case "panic", "fatal":
+		return 2
+	case "error":
+		return 3
+	case "warn", "warning":
+		return 4
+	case "debug", "trace":
+		return 7
+	default:
+		return 6
+	}
+}
+
+// headerField makes value a valid RFC 5424 header field: printable ASCII
+// without spaces, at most max characters, or "-" when empty
+func headerField(value string, max int) string {
+	field := strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, value)
+	if len(field) > max {
+		field = field[:max]
+	}
+	if field == "" {
+		return "-"
+	}
+	return field
+}
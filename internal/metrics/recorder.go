@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxSamplesPerApp bounds memory used by request samples for a single app
+const maxSamplesPerApp = 10000
+
+// requestSample is a single proxied request observation
+type requestSample struct {
+	at       time.Time
+	status   int
+	duration time.Duration
+}
+
+// appSeries holds the recent observations for one app
+type appSeries struct {
+	requests []requestSample
+	restarts []time.Time
+}
+
+// Recorder keeps a sliding window of per-app request and restart observations
+type Recorder struct {
+	series    map[string]*appSeries
+	retention time.Duration
+	sinks     []Sink // Also receive every observation, e.g. a statsd client
+	mu        sync.RWMutex
+}
+
+// NewRecorder creates a recorder that keeps observations for the given retention
+func NewRecorder(retention time.Duration) *Recorder {
+	if retention <= 0 {
+		retention = time.Hour
+	}
+
+	return &Recorder{
+		series:    make(map[string]*appSeries),
+		retention: retention,
+	}
+}
+
+// getSeries returns the series for an app, creating it if needed (must be called with lock held)
+func (r *Recorder) getSeries(app string) *appSeries {
+	s, exists := r.series[app]
+	if !exists {
+		s = &appSeries{}
+		r.series[app] = s
+	}
+	return s
+}
+
+// AddSink forwards the observations recorded from now on to sink
+func (r *Recorder) AddSink(sink Sink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sinks = append(r.sinks, sink)
+}
+
+// RecordRequest records a proxied request for an app
+func (r *Recorder) RecordRequest(app string, status int, duration time.Duration) {
+	for _, sink := range r.recordRequest(app, status, duration) {
+		sink.RecordRequest(app, status, duration)
+	}
+}
+
+// recordRequest adds a request sample, returning the sinks to forward it to
+func (r *Recorder) recordRequest(app string, status int, duration time.Duration) []Sink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	s := r.getSeries(app)
+	s.requests = append(s.requests, requestSample{at: now, status: status, duration: duration})
+
+	// Drop samples outside the retention window by reslicing; append moves the
+	// rest to a new array once the old one is used up
+	cutoff := now.Add(-r.retention)
+	drop := sort.Search(len(s.requests), func(i int) bool {
+		return !s.requests[i].at.Before(cutoff)
+	})
+	s.requests = s.requests[drop:]
+
+	// Trim to the size bound in batches, so a busy app does not copy the
+	// samples on every request; readers only look at the newest ones
+	if len(s.requests) >= 2*maxSamplesPerApp {
+		s.requests = append([]requestSample(nil), s.requests[len(s.requests)-maxSamplesPerApp:]...)
+	}
+	return r.sinks
+}
+
+// RecordRestart records a process restart for an app
+func (r *Recorder) RecordRestart(app string) {
+	for _, sink := range r.recordRestart(app) {
+		sink.RecordRestart(app)
+	}
+}
+
+// recordRestart adds a restart, returning the sinks to forward it to
+func (r *Recorder) recordRestart(app string) []Sink {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	s := r.getSeries(app)
+	s.restarts = append(s.restarts, now)
+
+	cutoff := now.Add(-r.retention)
+	drop := 0
+	for drop < len(s.restarts) && s.restarts[drop].Before(cutoff) {
+		drop++
+	}
+	if drop > 0 {
+		s.restarts = append([]time.Time(nil), s.restarts[drop:]...)
+	}
+	return r.sinks
+}
+
+// Restarts returns the number of restarts recorded for an app within the window
+func (r *Recorder) Restarts(app string, window time.Duration) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, exists := r.series[app]
+	if !exists {
+		return 0
+	}
+
+	cutoff := time.Now().Add(-window)
+	count := 0
+	for _, at := range s.restarts {
+		if !at.Before(cutoff) {
+			count++
+		}
+	}
+	return count
+}
+
+// Requests returns the number of requests recorded for an app within the window
+func (r *Recorder) Requests(app string, window time.Duration) int {
+	return len(r.requestsSince(app, window))
+}
+
+// ErrorRate returns the percentage (0-100) of 5xx responses within the window.
+// The second return value is false when there were no requests.
+func (r *Recorder) ErrorRate(app string, window time.Duration) (float64, bool) {
+	samples := r.requestsSince(app, window)
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	errors := 0
+	for _, sample := range samples {
+		if sample.status >= 500 {
+			errors++
+		}
+	}
+	return float64(errors) * 100 / float64(len(samples)), true
+}
+
+// LatencyPercentile returns the q-th percentile (0-1) of request durations within the window.
+// The second return value is false when there were no requests.
+func (r *Recorder) LatencyPercentile(app string, q float64, window time.Duration) (time.Duration, bool) {
+	samples := r.requestsSince(app, window)
+	if len(samples) == 0 {
+		return 0, false
+	}
+
+	durations := make([]time.Duration, len(samples))
+	for i, sample := range samples {
+		durations[i] = sample.duration
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	idx := int(q*float64(len(durations))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(durations) {
+		idx = len(durations) - 1
+	}
+	return durations[idx], true
+}
+
+// requestsSince returns a copy of request samples within the window
+func (r *Recorder) requestsSince(app string, window time.Duration) []requestSample {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, exists := r.series[app]
+	if !exists {
+		return nil
+	}
+
+	cutoff := time.Now().Add(-window)
+	start := sort.Search(len(s.requests), func(i int) bool {
+		return !s.requests[i].at.Before(cutoff)
+	})
+	if bound := len(s.requests) - maxSamplesPerApp; start < bound {
+		start = bound
+	}
+
+	samples := make([]requestSample, len(s.requests)-start)
+	copy(samples, s.requests[start:])
+	return samples
+}
@@ -0,0 +1,283 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatsD flavors
+const (
+	DogStatsD = "dogstatsd" // Tags appended as |#key:value, understood by the Datadog agent
+	StatsD    = "statsd"    // Plain statsd: tag values are folded into the metric name
+)
+
+// StatsD defaults
+const (
+	DefaultStatsDPrefix = "guvnor."
+	statsdQueue         = 4096
+	statsdFlushInterval = time.Second
+	// Keeps a packet within the MTU of a typical network, the size the
+	// Datadog agent and statsd recommend for UDP
+	maxPacketSize = 1432
+)
+
+// StatsDConfig configures a statsd client
+type StatsDConfig struct {
+	Address string            // host:port the UDP packets are sent to
+	Prefix  string            // Prepended to every metric name, DefaultStatsDPrefix when ""
+	Flavor  string            // DogStatsD (default) or StatsD
+	Tags    map[string]string // Added to every metric; only sent by DogStatsD
+}
+
+// Sink receives every observation of a Recorder as it is recorded
+type Sink interface {
+	RecordRequest(app string, status int, duration time.Duration)
+	RecordRestart(app string)
+}
+
+// StatsDClient sends metrics over UDP to a statsd server or Datadog agent.
+// Metrics are queued without blocking the caller and sent in batches; they
+// are dropped when the queue is full, as statsd itself loses packets.
+type StatsDClient struct {
+	conn    net.Conn
+	prefix  string
+	dog     bool
+	tags    []string // Global tags, formatted as key:value
+	queue   chan string
+	logger  *logrus.Entry
+	dropped int
+	mu      sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewStatsD creates a client sending to cfg.Address. UDP is connectionless,
+// so an agent that is not running is not an error.
+func NewStatsD(cfg StatsDConfig, logger *logrus.Logger) (*StatsDClient, error) {
+	switch cfg.Flavor {
+	case "":
+		cfg.Flavor = DogStatsD
+	case DogStatsD, StatsD:
+	default:
+		return nil, fmt.Errorf("unknown statsd flavor %q (use dogstatsd or statsd)", cfg.Flavor)
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultStatsDPrefix
+	}
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve statsd address %s: %w", cfg.Address, err)
+	}
+
+	tags := make([]string, 0, len(cfg.Tags))
+	for key, value := range cfg.Tags {
+		tags = append(tags, sanitizeTag(key)+":"+sanitizeTag(value))
+	}
+	sort.Strings(tags)
+
+	return &StatsDClient{
+		conn:   conn,
+		prefix: cfg.Prefix,
+		dog:    cfg.Flavor == DogStatsD,
+		tags:   tags,
+		queue:  make(chan string, statsdQueue),
+		logger: logger.WithField("component", "statsd").WithField("address", cfg.Address),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start sends queued metrics until Stop is called
+func (c *StatsDClient) Start() {
+	go c.run()
+}
+
+// Stop sends what is still queued and closes the connection, giving up when ctx is done
+func (c *StatsDClient) Stop(ctx context.Context) {
+	c.stopOnce.Do(func() { close(c.stop) })
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+	}
+}
+
+// Count adds value to a counter. tags are key, value pairs.
+func (c *StatsDClient) Count(name string, value int64, tags ...string) {
+	c.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+// Timing records a duration in milliseconds
+func (c *StatsDClient) Timing(name string, d time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', -1, 64), "ms", tags)
+}
+
+// Gauge sets a gauge to value
+func (c *StatsDClient) Gauge(name string, value float64, tags ...string) {
+	c.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// RecordRequest emits the requests counter and request.duration timer of a proxied request
+func (c *StatsDClient) RecordRequest(app string, status int, duration time.Duration) {
+	code := strconv.Itoa(status)
+	class := code[:1] + "xx"
+	c.Count("requests", 1, "app", app, "status", code, "status_class", class)
+	c.Timing("request.duration", duration, "app", app, "status_class", class)
+}
+
+// RecordRestart emits the restarts counter
+func (c *StatsDClient) RecordRestart(app string) {
+	c.Count("restarts", 1, "app", app)
+}
+
+// Dropped returns how many metrics were lost to a full queue since they were
+// last reported in the log
+func (c *StatsDClient) Dropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// send queues a metric line without blocking the caller
+func (c *StatsDClient) send(name, value, kind string, tags []string) {
+	select {
+	case c.queue <- c.format(name, value, kind, tags):
+	default:
+		c.mu.Lock()
+		c.dropped++
+		c.mu.Unlock()
+	}
+}
+
+// format returns the statsd line of a metric
+func (c *StatsDClient) format(name, value, kind string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(c.prefix)
+	b.WriteString(sanitizeName(name))
+	if !c.dog {
+		// Plain statsd has no tags, so the values become name segments,
+		// e.g. guvnor.requests.web.200.2xx
+		for i := 1; i < len(tags); i += 2 {
+			b.WriteByte('.')
+			b.WriteString(strings.ReplaceAll(sanitizeName(tags[i]), ".", "_"))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if c.dog && (len(tags) > 1 || len(c.tags) > 0) {
+		b.WriteString("|#")
+		first := true
+		for i := 0; i+1 < len(tags); i += 2 {
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			b.WriteString(sanitizeTag(tags[i]) + ":" + sanitizeTag(tags[i+1]))
+		}
+		for _, tag := range c.tags {
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			b.WriteString(tag)
+		}
+	}
+	return b.String()
+}
+
+func (c *StatsDClient) run() {
+	defer close(c.done)
+	defer c.conn.Close()
+
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	packet := make([]byte, 0, maxPacketSize)
+	failing := false
+	flush := func() {
+		if len(packet) == 0 {
+			return
+		}
+		_, err := c.conn.Write(packet)
+		packet = packet[:0]
+		switch {
+		case err != nil && !failing:
+			// An agent that is not listening makes writes fail with
+			// connection refused; report it once until it is back
+			c.logger.WithError(err).Warn("Failed to send metrics")
+			failing = true
+		case err == nil && failing:
+			c.logger.Info("Sending metrics again")
+			failing = false
+		}
+	}
+	add := func(line string) {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacketSize {
+			flush()
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+
+	for {
+		select {
+		case line := <-c.queue:
+			add(line)
+		case <-ticker.C:
+			flush()
+			c.mu.Lock()
+			dropped := c.dropped
+			c.dropped = 0
+			c.mu.Unlock()
+			if dropped > 0 {
+				c.logger.WithField("dropped", dropped).Warn("Metrics queue full, dropped metrics")
+			}
+		case <-c.stop:
+			for drained := false; !drained; {
+				select {
+				case line := <-c.queue:
+					add(line)
+				default:
+					drained = true
+				}
+			}
+			flush()
+			return
+		}
+	}
+}
+
+// sanitizeName replaces the characters with a meaning in the statsd protocol
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// sanitizeTag replaces the characters that separate DogStatsD tags
+func sanitizeTag(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// receive returns the lines of the packets sent to conn until the client stops
+func receive(t *testing.T, conn net.PacketConn, client *StatsDClient) []string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.Stop(ctx)
+
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		if n > maxPacketSize {
+			t.Errorf("Packet of %d bytes exceeds %d", n, maxPacketSize)
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	return lines
+}
+
+func newTestStatsD(t *testing.T, cfg StatsDConfig) (*StatsDClient, net.PacketConn) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg.Address = conn.LocalAddr().String()
+	client, err := NewStatsD(cfg, logger)
+	if err != nil {
+		t.Fatalf("NewStatsD failed: %v", err)
+	}
+	client.Start()
+	return client, conn
+}
+
+func TestStatsD_DogStatsD(t *testing.T) {
+	client, conn := newTestStatsD(t, StatsDConfig{Tags: map[string]string{"env": "prod", "dc": "eu"}})
+
+	recorder := NewRecorder(time.Hour)
+	recorder.AddSink(client)
+	recorder.RecordRequest("web", 502, 1500*time.Microsecond)
+	recorder.RecordRestart("web")
+	client.Gauge("health.healthy", 1, "app", "web", "instance", "web-2")
+
+	lines := receive(t, conn, client)
+	want := []string{
+		"guvnor.requests:1|c|#app:web,status:502,status_class:5xx,dc:eu,env:prod",
+		"guvnor.request.duration:1.5|ms|#app:web,status_class:5xx,dc:eu,env:prod",
+		"guvnor.restarts:1|c|#app:web,dc:eu,env:prod",
+		"guvnor.health.healthy:1|g|#app:web,instance:web-2,dc:eu,env:prod",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(lines, "\n"))
+	}
+	if recorder.Requests("web", time.Hour) != 1 || recorder.Restarts("web", time.Hour) != 1 {
+		t.Error("Expected the recorder to keep its own samples")
+	}
+}
+
+func TestStatsD_Plain(t *testing.T) {
+	client, conn := newTestStatsD(t, StatsDConfig{Flavor: StatsD, Prefix: "edge.", Tags: map[string]string{"env": "prod"}})
+
+	client.RecordRequest("api.v2", 200, 20*time.Millisecond)
+	client.Gauge("instances", 3, "app", "api.v2")
+
+	lines := receive(t, conn, client)
+	sort.Strings(lines)
+	want := []string{
+		"edge.instances.api_v2:3|g",
+		"edge.request.duration.api_v2.2xx:20|ms",
+		"edge.requests.api_v2.200.2xx:1|c",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+func TestStatsD_Batching(t *testing.T) {
+	client, conn := newTestStatsD(t, StatsDConfig{})
+
+	for i := 0; i < 200; i++ {
+		client.Count("requests", 1, "app", "web")
+	}
+	if lines := receive(t, conn, client); len(lines) != 200 {
+		t.Errorf("Expected 200 metrics, got %d", len(lines))
+	}
+
+	if _, err := NewStatsD(StatsDConfig{Address: "127.0.0.1:8125", Flavor: "graphite"}, logrus.New()); err == nil {
+		t.Error("Expected an unknown flavor to be rejected")
+	}
+}
@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emailSink mails the notification as plain text through an SMTP server
+type emailSink struct {
+	name    string
+	server  *url.URL // smtp://[user:password@]host[:port], or smtps:// for TLS from the start
+	from    string
+	to      []string
+	timeout time.Duration
+}
+
+func newEmailSink(name string, cfg Config, timeout time.Duration) (*emailSink, error) {
+	server, err := url.Parse(cfg.URL)
+	if err != nil || (server.Scheme != "smtp" && server.Scheme != "smtps") || server.Hostname() == "" {
+		return nil, fmt.Errorf("notification sink %s: url must be smtp://host:port or smtps://host:port", name)
+	}
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("notification sink %s: email requires from and to", name)
+	}
+	return &emailSink{name: name, server: server, from: cfg.From, to: cfg.To, timeout: timeout}, nil
+}
+
+func (s *emailSink) Name() string {
+	return s.name
+}
+
+func (s *emailSink) Send(ctx context.Context, n Notification) error {
+	host := s.server.Hostname()
+	port := s.server.Port()
+	if port == "" {
+		port = "587"
+		if s.server.Scheme == "smtps" {
+			port = "465"
+		}
+	}
+	addr := net.JoinHostPort(host, port)
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var conn net.Conn
+	var err error
+	if s.server.Scheme == "smtps" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	deadline := time.Now().Add(s.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to talk to %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.server.Scheme == "smtp" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("failed to start TLS with %s: %w", addr, err)
+		}
+	}
+	if user := s.server.User; user != nil {
+		password, _ := user.Password()
+		// PlainAuth refuses to send the password over a connection without TLS,
+		// unless the server is on localhost
+		if err := client.Auth(smtp.PlainAuth("", user.Username(), password, host)); err != nil {
+			return fmt.Errorf("failed to authenticate with %s: %w", addr, err)
+		}
+	}
+
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("server rejected sender %s: %w", s.from, err)
+	}
+	for _, to := range s.to {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("server rejected recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("server rejected message: %w", err)
+	}
+	return client.Quit()
+}
+
+// message renders the headers and body of the email
+func (s *emailSink) message(n Notification) []byte {
+	// Header values must stay on one line
+	oneLine := strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+	timestamp := n.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", oneLine.Replace(s.from))
+	fmt.Fprintf(&b, "To: %s\r\n", oneLine.Replace(strings.Join(s.to, ", ")))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[guvnor] "+oneLine.Replace(n.Title)))
+	fmt.Fprintf(&b, "Date: %s\r\n", timestamp.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+
+	b.WriteString(n.Message + "\r\n\r\n")
+	if n.App != "" {
+		fmt.Fprintf(&b, "app: %s\r\n", n.App)
+	}
+	if n.Severity != "" {
+		fmt.Fprintf(&b, "severity: %s\r\n", n.Severity)
+	}
+	fmt.Fprintf(&b, "time: %s\r\n", timestamp.Format(time.RFC3339))
+	keys := make([]string, 0, len(n.Fields))
+	for key := range n.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, n.Fields[key])
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPSink_Template(t *testing.T) {
+	var method, contentType, body, title string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, contentType, body, title = r.Method, r.Header.Get("Content-Type"), string(data), r.Header.Get("Title")
+	}))
+	defer srv.Close()
+
+	sink, err := New("ntfy", Config{
+		Type:     "http",
+		URL:      srv.URL,
+		Method:   "put",
+		Headers:  map[string]string{"Title": "guvnor"},
+		Template: "{{.Title}}: {{.Message}} (exit {{index .Fields \"exit_code\"}})",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+
+	n := Notification{Title: "web crashed", Message: "web exited with code 3", Timestamp: time.Now(), Fields: map[string]string{"exit_code": "3"}}
+	if err := sink.Send(context.Background(), n); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if method != http.MethodPut || title != "guvnor" || contentType != "text/plain; charset=utf-8" {
+		t.Errorf("Expected a PUT with the configured header, got %s %q %q", method, title, contentType)
+	}
+	if body != "web crashed: web exited with code 3 (exit 3)" {
+		t.Errorf("Expected the rendered template, got %q", body)
+	}
+
+	if _, err := New("bad", Config{Type: "http", URL: srv.URL, Template: "{{.Title"}); err == nil {
+		t.Error("Expected an invalid template to be rejected")
+	}
+}
+
+func TestEmailSink(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A minimal SMTP server recording the envelope and message
+	var commands []string
+	var message strings.Builder
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 mail.test ESMTP\r\n")
+		for data := false; ; {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if data {
+				if line == ".\r\n" {
+					data = false
+					fmt.Fprint(conn, "250 queued\r\n")
+				} else {
+					message.WriteString(line)
+				}
+				continue
+			}
+			command := strings.TrimSpace(line)
+			commands = append(commands, command)
+			switch {
+			case strings.HasPrefix(command, "DATA"):
+				data = true
+				fmt.Fprint(conn, "354 go ahead\r\n")
+			case strings.HasPrefix(command, "QUIT"):
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "250 ok\r\n")
+			}
+		}
+	}()
+
+	sink, err := New("mail", Config{Type: "email", URL: "smtp://" + ln.Addr().String(), From: "guvnor@example.com", To: []string{"ops@example.com", "dev@example.com"}})
+	if err != nil {
+		t.Fatalf("Failed to create sink: %v", err)
+	}
+	n := Notification{Title: "Alert web-errors firing\r\nBcc: x@example.com", Message: "error_rate > 5% for 5m (current: 12.0%)", App: "web", Severity: "critical", Timestamp: time.Now(), Fields: map[string]string{"alert": "web-errors"}}
+	if err := sink.Send(context.Background(), n); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	<-done
+
+	envelope := strings.Join(commands[1:], "\n")
+	if envelope != "MAIL FROM:<guvnor@example.com>\nRCPT TO:<ops@example.com>\nRCPT TO:<dev@example.com>\nDATA\nQUIT" {
+		t.Errorf("Unexpected SMTP commands:\n%s", envelope)
+	}
+	for _, want := range []string{"Subject: [guvnor] Alert web-errors firing Bcc: x@example.com\r\n", "To: ops@example.com, dev@example.com\r\n", "\r\nerror_rate > 5% for 5m (current: 12.0%)\r\n", "app: web\r\n", "alert: web-errors\r\n"} {
+		if !strings.Contains(message.String(), want) {
+			t.Errorf("Expected the message to contain %q:\n%s", want, message.String())
+		}
+	}
+
+	for _, cfg := range []Config{{Type: "email", URL: "https://mail.example.com", From: "a@example.com", To: []string{"b@example.com"}}, {Type: "email", URL: "smtp://mail.example.com"}} {
+		if _, err := New("bad", cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// attachQueue is how many output chunks an attached client may fall behind
+// before chunks to it are dropped
+const attachQueue = 256
+
+// ErrNoStdin is returned when writing to a process whose stdin is not kept open
+var ErrNoStdin = errors.New("stdin is not kept open for this process (set stdin: true on the app)")
+
+// console multiplexes the stdio of a process between the clients attached to
+// it. It outlives restarts, so clients stay attached while the process is
+// replaced.
+type console struct {
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+	stdin   io.WriteCloser // Of the latest run, nil unless the app keeps stdin open; closed once it exits
+}
+
+// Write sends a chunk of output to every attached client without blocking
+// the process
+func (c *console) Write(data []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.clients) == 0 {
+		return len(data), nil
+	}
+	chunk := append([]byte(nil), data...)
+	for client := range c.clients {
+		select {
+		case client <- chunk:
+		default:
+		}
+	}
+	return len(data), nil
+}
+
+// tee returns a writer sending the output written to w to the attached clients too
+func (c *console) tee(w io.Writer) io.Writer {
+	if w == nil {
+		return c
+	}
+	return io.MultiWriter(w, c)
+}
+
+// setStdin sets the stdin pipe of the process just started
+func (c *console) setStdin(stdin io.WriteCloser) {
+	c.mu.Lock()
+	c.stdin = stdin
+	c.mu.Unlock()
+}
+
+// Attachment is a client attached to the stdio of a process
+type Attachment struct {
+	// Output receives what the process writes to stdout and stderr, as
+	// written. Chunks are dropped while the client falls behind.
+	Output <-chan []byte
+
+	process *Process
+	output  chan []byte
+	once    sync.Once
+}
+
+// Attach attaches a client to the stdin, stdout and stderr of the process.
+// Only output written from now on is received; the log buffer has the rest.
+func (p *Process) Attach() (*Attachment, error) {
+	p.mu.RLock()
+	mode, adopted := p.executionMode, p.adopted
+	p.mu.RUnlock()
+	if mode == ModeContainer {
+		return nil, fmt.Errorf("cannot attach to container %s, open a shell in it with: guvnor exec %s", p.Config.Name, p.Config.Name)
+	}
+	if adopted {
+		return nil, fmt.Errorf("process %s was started by a previous guvnor, its stdio is only available after a restart", p.Config.Name)
+	}
+
+	output := make(chan []byte, attachQueue)
+	p.console.mu.Lock()
+	if p.console.clients == nil {
+		p.console.clients = make(map[chan []byte]struct{})
+	}
+	p.console.clients[output] = struct{}{}
+	p.console.mu.Unlock()
+	return &Attachment{Output: output, process: p, output: output}, nil
+}
+
+// Stdin reports whether the process keeps its stdin open for writing
+func (p *Process) Stdin() bool {
+	return p.Config.Stdin
+}
+
+// Write writes to the stdin of the process; it blocks while the process does
+// not read
+func (a *Attachment) Write(data []byte) (int, error) {
+	if !a.process.Stdin() {
+		return 0, ErrNoStdin
+	}
+	console := &a.process.console
+	console.mu.Lock()
+	stdin := console.stdin
+	console.mu.Unlock()
+	if stdin == nil {
+		return 0, fmt.Errorf("process %s is not running", a.process.Config.Name)
+	}
+	n, err := stdin.Write(data)
+	if errors.Is(err, os.ErrClosed) || errors.Is(err, syscall.EPIPE) {
+		// The process exited, or closed its stdin
+		return n, fmt.Errorf("process %s is not reading stdin", a.process.Config.Name)
+	}
+	return n, err
+}
+
+// Detach stops sending output to the client and closes Output
+func (a *Attachment) Detach() {
+	a.once.Do(func() {
+		console := &a.process.console
+		console.mu.Lock()
+		delete(console.clients, a.output)
+		console.mu.Unlock()
+		close(a.output)
+	})
+}
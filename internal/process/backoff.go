@@ -0,0 +1,85 @@
+package process
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// defaultCrashLoopWindow is used when a restart policy has no crash-loop window
+const defaultCrashLoopWindow = 10 * time.Minute
+
+// restartDelay returns how long to wait before restarting after a crash. With
+// max_backoff set the delay grows by backoff_multiplier (default 2) for every
+// restart within the crash-loop window, up to the cap. Jitter spreads the delay
+// by ±jitter using rnd (0-1).
+func restartDelay(policy config.RestartPolicy, recent int, rnd float64) time.Duration {
+	delay := policy.Backoff
+	if policy.MaxBackoff > policy.Backoff {
+		multiplier := policy.Multiplier
+		if multiplier < 1 {
+			multiplier = 2
+		}
+		for i := 0; i < recent && delay < policy.MaxBackoff; i++ {
+			delay = time.Duration(float64(delay) * multiplier)
+		}
+		if delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+
+	if policy.Jitter > 0 {
+		delay = time.Duration(float64(delay) * (1 + policy.Jitter*(2*rnd-1)))
+	}
+	return delay
+}
+
+// nextRestart records a crash and decides whether and when to restart. It returns
+// false once max_retries is used up or the crash-loop limit is hit, in which case
+// the process is left failed or crash-looping.
+func (p *Process) nextRestart(now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	policy := p.Config.RestartPolicy
+	window := policy.CrashLoop.Window
+	if window <= 0 {
+		window = defaultCrashLoopWindow
+	}
+
+	// Keep only restarts within the crash-loop window
+	cutoff := now.Add(-window)
+	recent := p.restartTimes[:0]
+	for _, at := range p.restartTimes {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	p.restartTimes = recent
+
+	if policy.CrashLoop.MaxRestarts > 0 && len(recent) >= policy.CrashLoop.MaxRestarts {
+		p.status = StatusCrashLoop
+		return 0, false
+	}
+	if policy.MaxRetries >= 0 && p.restarts >= policy.MaxRetries {
+		p.status = StatusFailed
+		return 0, false
+	}
+
+	delay := restartDelay(policy, len(recent), rand.Float64())
+	p.restarts++
+	p.restartTimes = append(p.restartTimes, now)
+	p.status = StatusStopped
+	return delay, true
+}
+
+// ResetRestarts clears the restart counter and crash history so the restart
+// policy starts over, e.g. after fixing an app that was crash-looping
+func (p *Process) ResetRestarts() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.restarts = 0
+	p.restartTimes = nil
+}
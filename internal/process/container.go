@@ -0,0 +1,347 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// containerName is the runtime name of a process's container
+func containerName(name string) string {
+	return "guvnor-" + name
+}
+
+// prepareImage pulls or builds the image the process runs and returns its name
+func (p *Process) prepareImage(ctx context.Context) (string, error) {
+	cfg := p.Config.Container
+	progress := func(line string) { p.logger.Debug(line) }
+
+	if cfg.Build != "" {
+		image := cfg.Image
+		if image == "" {
+			image = "guvnor/" + strings.ToLower(p.AppName()) + ":latest"
+		}
+		dir := p.hostPath(cfg.Build)
+		p.logger.WithFields(logrus.Fields{"context": dir, "image": image}).Info("Building image")
+		if err := p.runtime.buildImage(ctx, dir, cfg.Dockerfile, image, progress); err != nil {
+			return "", fmt.Errorf("failed to build image %s: %w", image, err)
+		}
+		return image, nil
+	}
+
+	image := cfg.Image
+	if image == "" {
+		image = selectBaseImage(p.Config.Command)
+	}
+	exists, err := p.runtime.imageExists(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		p.logger.WithField("image", image).Info("Pulling image")
+		if err := p.runtime.pullImage(ctx, image, progress); err != nil {
+			return "", fmt.Errorf("failed to pull image %s: %w", image, err)
+		}
+	}
+	return image, nil
+}
+
+// startContainer creates and starts the process's container; the caller holds p.mu
+func (p *Process) startContainer(ctx context.Context, image string) error {
+	name := containerName(p.Config.Name)
+
+	// A container left behind by a previous guvnor run would block the name
+	if err := p.runtime.removeContainer(ctx, name); err != nil {
+		p.logger.WithError(err).Warn("Failed to remove stale container")
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"mode":      "container",
+		"image":     image,
+		"command":   p.Config.Command,
+		"args":      p.Config.Args,
+		"container": name,
+		"port":      p.Config.Port,
+	}).Info("Starting container")
+
+	id, err := p.runtime.createContainer(ctx, name, p.containerSpec(image))
+	if err != nil {
+		p.status = StatusFailed
+		return fmt.Errorf("failed to create container: %w", err)
+	}
+	if err := p.runtime.startContainer(ctx, id); err != nil {
+		p.runtime.removeContainer(context.Background(), id)
+		p.status = StatusFailed
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+
+	p.containerID = id
+	p.pid, _ = p.runtime.containerPID(ctx, id)
+	p.status = StatusRunning
+	p.exitCode.Store(-1)
+
+	var outputs []*lineWriter
+	if p.onOutput != nil {
+		name := p.Config.Name
+		outputs = []*lineWriter{
+			newLineWriter(func(line string, at time.Time) { p.onOutput(name, "stdout", line, at) }),
+			newLineWriter(func(line string, at time.Time) { p.onOutput(name, "stderr", line, at) }),
+		}
+	}
+
+	// Monitor the container in a goroutine
+	p.exited = make(chan struct{})
+	go p.monitorContainer(ctx, id, p.exited, outputs)
+
+	p.logger.WithField("container_id", id[:12]).Info("Container started successfully")
+
+	return nil
+}
+
+// containerSpec describes the container of this process
+func (p *Process) containerSpec(image string) containerSpec {
+	cfg := p.Config.Container
+	spec := containerSpec{
+		Image:  image,
+		Labels: map[string]string{"guvnor.app": p.AppName(), "guvnor.process": p.Config.Name},
+	}
+	if p.Config.Shell {
+		// Images are Linux, whatever the host runs
+		spec.Cmd = []string{"/bin/sh", "-c", p.Config.CommandLine()}
+	} else if p.Config.Command != "" {
+		spec.Cmd = append([]string{p.Config.Command}, p.Config.Args...)
+	}
+	for key, value := range p.environment() {
+		spec.Env = append(spec.Env, key+"="+value)
+	}
+
+	hostConfig := map[string]interface{}{}
+	if p.Config.Port > 0 {
+		port := fmt.Sprintf("%d/tcp", p.Config.Port)
+		spec.ExposedPorts = map[string]struct{}{port: {}}
+		hostConfig["PortBindings"] = map[string]interface{}{
+			port: []map[string]string{{"HostPort": strconv.Itoa(p.Config.Port)}},
+		}
+	}
+
+	binds := make([]string, 0, len(cfg.Volumes))
+	for _, volume := range cfg.Volumes {
+		host, rest, _ := strings.Cut(volume, ":")
+		if strings.HasPrefix(host, ".") {
+			host = p.hostPath(host)
+		}
+		binds = append(binds, host+":"+rest)
+	}
+	if !cfg.Enabled() && p.Config.WorkingDir != "" {
+		// Guessed images get the app directory, as there is nothing else to run
+		binds = append(binds, p.hostPath(p.Config.WorkingDir)+":/app")
+		spec.WorkingDir = "/app"
+	}
+	if len(binds) > 0 {
+		hostConfig["Binds"] = binds
+	}
+
+	if cfg.Network != "" {
+		hostConfig["NetworkMode"] = cfg.Network
+	}
+	if ulimits := containerUlimits(p.Config.Limits); len(ulimits) > 0 {
+		hostConfig["Ulimits"] = ulimits
+	}
+	if p.Config.OOMScoreAdj != 0 {
+		hostConfig["OomScoreAdj"] = p.Config.OOMScoreAdj
+	}
+
+	// host_config is passed as-is and wins over the settings above
+	for key, value := range cfg.HostConfig {
+		hostConfig[key] = value
+	}
+	spec.HostConfig = hostConfig
+
+	return spec
+}
+
+// hostPath resolves a host path against the app's working directory
+func (p *Process) hostPath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	base := p.Config.WorkingDir
+	if base == "" {
+		base, _ = os.Getwd()
+	}
+	if abs, err := filepath.Abs(filepath.Join(base, path)); err == nil {
+		return abs
+	}
+	return path
+}
+
+// selectBaseImage guesses an image from the command when none is configured
+func selectBaseImage(command string) string {
+	switch command {
+	case "python", "python3":
+		return "python:3.11-slim"
+	case "node", "npm":
+		return "node:18-slim"
+	case "go":
+		return "golang:1.21-alpine"
+	default:
+		return "alpine:latest"
+	}
+}
+
+// stopContainer stops the container and waits for the monitor to remove it; the caller holds p.mu
+func (p *Process) stopContainer(ctx context.Context) error {
+	if p.containerID == "" {
+		p.status = StatusStopped
+		return nil
+	}
+
+	// The runtime sends the stop signal and kills the container after the timeout
+	if err := p.runtime.stopContainer(ctx, p.containerID, p.Config.StopSignal, p.stopTimeout()); err != nil {
+		p.logger.WithError(err).Warn("Failed to stop container gracefully, forcing kill")
+		if err := p.runtime.killContainer(ctx, p.containerID, ""); err != nil {
+			p.logger.WithError(err).Error("Failed to force kill container")
+		}
+	}
+
+	if p.exited != nil {
+		select {
+		case <-p.exited:
+		case <-time.After(5 * time.Second):
+			p.logger.Warn("Timed out waiting for container removal")
+		}
+	}
+
+	p.status = StatusStopped
+	p.containerID = ""
+	p.pid = 0
+	p.logger.Info("Container stopped")
+
+	return nil
+}
+
+// monitorContainer waits for the container to exit, removes it and handles restarts
+func (p *Process) monitorContainer(ctx context.Context, id string, exited chan struct{}, outputs []*lineWriter) {
+	defer func() {
+		p.mu.Lock()
+		if p.status == StatusRunning {
+			p.status = StatusStopped
+		}
+		p.mu.Unlock()
+	}()
+
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		if len(outputs) == 2 {
+			if err := p.runtime.followLogs(ctx, id, outputs[0], outputs[1]); err != nil {
+				p.logger.WithError(err).Debug("Container log stream ended")
+			}
+		}
+	}()
+
+	exitCode, err := p.runtime.waitContainer(ctx, id)
+	if err != nil {
+		exitCode = 1
+	}
+
+	// The log stream ends shortly after the container
+	select {
+	case <-logsDone:
+	case <-time.After(2 * time.Second):
+	}
+	for _, w := range outputs {
+		w.Flush()
+	}
+
+	// ctx may already be cancelled on shutdown, the container must go regardless
+	if rmErr := p.runtime.removeContainer(context.Background(), id); rmErr != nil {
+		p.logger.WithError(rmErr).Warn("Failed to remove container")
+	}
+
+	p.exitCode.Store(int64(exitCode))
+	close(exited)
+
+	p.mu.Lock()
+	wasRunning := p.status == StatusRunning
+	p.mu.Unlock()
+
+	if wasRunning {
+		if err != nil {
+			p.logger.WithError(err).Error("Container monitoring error")
+		}
+
+		if exitCode == 0 {
+			p.logger.Info("Container exited normally")
+		} else {
+			p.logger.WithField("exit_code", exitCode).Error("Container exited with error")
+			p.emit(EventCrashed, map[string]string{"exit_code": strconv.Itoa(exitCode)})
+		}
+
+		p.mu.Lock()
+		p.containerID = ""
+		p.pid = 0
+		p.mu.Unlock()
+
+		// Handle restart if enabled and not a normal exit
+		if p.Config.RestartPolicy.Enabled && exitCode != 0 {
+			delay, ok := p.nextRestart(time.Now())
+			if !ok {
+				p.logGaveUp()
+				return
+			}
+			p.notifyRestart()
+
+			p.logger.WithFields(logrus.Fields{
+				"restarts":    p.GetRestartCount(),
+				"max_retries": p.Config.RestartPolicy.MaxRetries,
+				"delay":       delay,
+			}).Info("Scheduling container restart")
+
+			// Wait before restarting
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			if err := p.Start(ctx); err != nil {
+				p.logger.WithError(err).Error("Failed to restart container")
+			} else {
+				p.emit(EventRestarted, map[string]string{"restarts": strconv.Itoa(p.GetRestartCount())})
+			}
+		} else {
+			p.mu.Lock()
+			p.status = finalStatus(p.Config, exitCode)
+			p.mu.Unlock()
+		}
+	}
+}
+
+// containerUlimits converts the configured limits to HostConfig ulimits
+func containerUlimits(limits config.LimitsConfig) []map[string]interface{} {
+	var ulimits []map[string]interface{}
+	for _, limit := range []struct{ name, value string }{{"core", limits.Core}, {"nofile", limits.NoFile}} {
+		if limit.value == "" {
+			continue
+		}
+		n, err := config.ParseLimit(limit.value)
+		if err != nil {
+			continue
+		}
+		value := int64(-1)
+		if n != config.Unlimited {
+			value = int64(n)
+		}
+		ulimits = append(ulimits, map[string]interface{}{"Name": limit.name, "Soft": value, "Hard": value})
+	}
+	return ulimits
+}
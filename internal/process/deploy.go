@@ -0,0 +1,182 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultDeployTimeout is how long deploy mode lasts when no timeout is given
+const DefaultDeployTimeout = 15 * time.Minute
+
+// Deploy is an app in deploy mode
+type Deploy struct {
+	App    string    `json:"app"`
+	Since  time.Time `json:"since"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// deployMode is the state of an app in deploy mode
+type deployMode struct {
+	Deploy
+	done  chan struct{} // Closed when deploy mode ends
+	timer *time.Timer   // Ends deploy mode at Until
+}
+
+// BeginDeploy puts an app in deploy mode for timeout, so operators can stop and
+// replace its processes without guvnor fighting them: crashed processes are not
+// restarted and failing health checks do not restart the app. Deploy mode ends
+// after timeout or with EndDeploy; processes that crashed meanwhile and were not
+// started again are restarted then. Beginning it again extends the timeout.
+func (m *Manager) BeginDeploy(app string, timeout time.Duration, reason string) (Deploy, error) {
+	app, err := m.deployApp(app)
+	if err != nil {
+		return Deploy{}, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultDeployTimeout
+	}
+
+	m.deployMu.Lock()
+	defer m.deployMu.Unlock()
+
+	now := time.Now()
+	deploy, exists := m.deploys[app]
+	if exists {
+		deploy.timer.Stop()
+	} else {
+		deploy = &deployMode{Deploy: Deploy{App: app, Since: now}, done: make(chan struct{})}
+		m.deploys[app] = deploy
+	}
+	deploy.Until = now.Add(timeout)
+	deploy.Reason = reason
+	deploy.timer = time.AfterFunc(timeout, func() { m.endDeploy(app, deploy, true) })
+
+	m.logger.WithFields(logrus.Fields{
+		"app":    app,
+		"until":  deploy.Until.Format(time.RFC3339),
+		"reason": reason,
+	}).Info("Deploy mode started, automatic restarts suspended")
+	return deploy.Deploy, nil
+}
+
+// EndDeploy takes an app out of deploy mode, resuming automatic restarts
+func (m *Manager) EndDeploy(app string) (Deploy, bool) {
+	if name, err := m.deployApp(app); err == nil {
+		app = name
+	}
+	m.deployMu.Lock()
+	deploy, exists := m.deploys[app]
+	m.deployMu.Unlock()
+	if !exists {
+		return Deploy{}, false
+	}
+	return deploy.Deploy, m.endDeploy(app, deploy, false)
+}
+
+// deployApp returns the app whose instances deploy mode covers when given the
+// app or one of its instances
+func (m *Manager) deployApp(name string) (string, error) {
+	if len(m.GetInstances(name)) > 0 {
+		return name, nil
+	}
+	proc, exists := m.GetProcess(name)
+	if !exists {
+		return "", fmt.Errorf("process %s not found", name)
+	}
+	return proc.AppName(), nil
+}
+
+// endDeploy ends deploy and reports whether it was still in effect
+func (m *Manager) endDeploy(app string, deploy *deployMode, expired bool) bool {
+	m.deployMu.Lock()
+	// A timer firing while BeginDeploy extended the deadline is ignored
+	if m.deploys[app] != deploy || expired && time.Now().Before(deploy.Until) {
+		m.deployMu.Unlock()
+		return false
+	}
+	delete(m.deploys, app)
+	deploy.timer.Stop()
+	m.deployMu.Unlock()
+
+	close(deploy.done)
+	if expired {
+		m.logger.WithField("app", app).Warn("Deploy mode timed out, automatic restarts resumed")
+	} else {
+		m.logger.WithField("app", app).Info("Deploy mode ended, automatic restarts resumed")
+	}
+	return true
+}
+
+// Deploys lists the apps in deploy mode
+func (m *Manager) Deploys() []Deploy {
+	m.deployMu.Lock()
+	defer m.deployMu.Unlock()
+
+	deploys := make([]Deploy, 0, len(m.deploys))
+	for _, deploy := range m.deploys {
+		deploys = append(deploys, deploy.Deploy)
+	}
+	sort.Slice(deploys, func(i, j int) bool { return deploys[i].App < deploys[j].App })
+	return deploys
+}
+
+// InDeploy reports whether an app is in deploy mode
+func (m *Manager) InDeploy(app string) bool {
+	return m.deployDone(app) != nil
+}
+
+// deployDone returns a channel closed when the deploy mode of app ends, or nil
+// if the app is not in deploy mode
+func (m *Manager) deployDone(app string) <-chan struct{} {
+	m.deployMu.Lock()
+	defer m.deployMu.Unlock()
+	if deploy, exists := m.deploys[app]; exists {
+		return deploy.done
+	}
+	return nil
+}
+
+// manages reports whether proc is the process the manager holds under its
+// name, rather than one replaced or removed
+func (m *Manager) manages(proc *Process) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.processes[proc.Config.Name] == proc
+}
+
+// waitDeploy holds back the restart of a crashed process while its app is in
+// deploy mode. It reports whether the restart should go ahead: not if ctx is
+// done, or if the process was started, replaced or removed meanwhile.
+func (p *Process) waitDeploy(ctx context.Context, cmd *exec.Cmd) bool {
+	if p.deployDone == nil {
+		return true
+	}
+	done := p.deployDone(p.AppName())
+	if done == nil {
+		return true
+	}
+
+	p.mu.Lock()
+	p.status = StatusStopped
+	p.mu.Unlock()
+	p.logger.Info("App is in deploy mode, restarting when it ends unless the process is started again")
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-done:
+	}
+
+	if !p.managed(p) {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cmd == cmd && p.status == StatusStopped
+}
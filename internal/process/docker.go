@@ -0,0 +1,438 @@
+package process
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// defaultDockerHost is the Docker Engine API socket used when DOCKER_HOST is unset
+const defaultDockerHost = "unix:///var/run/docker.sock"
+
+// dockerClient is a minimal Docker Engine API client. Podman serves the same
+// API, so it drives both runtimes.
+type dockerClient struct {
+	name    string // Runtime name used in errors
+	host    string // unix:// or tcp:// address of the API, for the CLI
+	http    *http.Client
+	baseURL string
+}
+
+// newDockerClient creates a client for DOCKER_HOST (unix:// or tcp://)
+func newDockerClient() (*dockerClient, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = defaultDockerHost
+	}
+	return newAPIClient("docker", host)
+}
+
+// newPodmanClient creates a client for the Podman API socket: CONTAINER_HOST,
+// the rootless user socket, or the system socket when running as root
+func newPodmanClient() (*dockerClient, error) {
+	host := os.Getenv("CONTAINER_HOST")
+	if host == "" {
+		host = "unix:///run/podman/podman.sock"
+		if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Getuid() != 0 {
+			host = "unix://" + filepath.Join(dir, "podman", "podman.sock")
+		}
+	}
+	return newAPIClient("podman", host)
+}
+
+// newAPIClient creates a client for a unix:// or tcp:// Docker-compatible API
+func newAPIClient(name, host string) (*dockerClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s host %q: %w", name, host, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &dockerClient{name: name, host: host, http: &http.Client{Transport: transport}, baseURL: "http://" + name}, nil
+	case "tcp", "http":
+		return &dockerClient{name: name, host: host, http: &http.Client{}, baseURL: "http://" + u.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported %s host scheme %q", name, u.Scheme)
+	}
+}
+
+// runtimeName implements containerRuntime
+func (d *dockerClient) runtimeName() string {
+	return d.name
+}
+
+// containerSpec is the body of a container create request
+type containerSpec struct {
+	Image        string                 `json:"Image"`
+	Cmd          []string               `json:"Cmd,omitempty"`
+	Env          []string               `json:"Env,omitempty"`
+	ExposedPorts map[string]struct{}    `json:"ExposedPorts,omitempty"`
+	WorkingDir   string                 `json:"WorkingDir,omitempty"`
+	Labels       map[string]string      `json:"Labels,omitempty"`
+	HostConfig   map[string]interface{} `json:"HostConfig"`
+}
+
+// dockerError is the error body returned by the API
+type dockerError struct {
+	Message string `json:"message"`
+}
+
+// request sends an API request and fails unless the status is one of ok
+func (d *dockerClient) request(ctx context.Context, method, path string, body io.Reader, contentType string, ok ...int) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s API request failed: %w", d.name, err)
+	}
+	for _, code := range ok {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+
+	var apiErr dockerError
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return nil, fmt.Errorf("%s: %s (HTTP %d)", d.name, apiErr.Message, resp.StatusCode)
+}
+
+// call sends a request whose response body is not needed
+func (d *dockerClient) call(ctx context.Context, method, path string, body interface{}, ok ...int) error {
+	var reader io.Reader
+	contentType := ""
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader, contentType = bytes.NewReader(data), "application/json"
+	}
+
+	resp, err := d.request(ctx, method, path, reader, contentType, ok...)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// execCommand runs argv in a container through the docker or podman CLI,
+// pointed at the daemon this client talks to; attaching a terminal to a
+// hijacked API connection is left to the CLI
+func (d *dockerClient) execCommand(id string, tty bool, argv []string) (*exec.Cmd, error) {
+	binary, err := exec.LookPath(d.name)
+	if err != nil {
+		return nil, fmt.Errorf("%s CLI not found: %w", d.name, err)
+	}
+	args := []string{"--host", d.host}
+	if d.name == config.RuntimePodman {
+		args = []string{"--url", d.host}
+	}
+	return exec.Command(binary, append(append(args, execArgs(id, tty)...), argv...)...), nil
+}
+
+// ping checks that the daemon is reachable
+func (d *dockerClient) ping(ctx context.Context) error {
+	return d.call(ctx, http.MethodGet, "/_ping", nil, http.StatusOK)
+}
+
+// imageExists reports whether an image is present locally
+func (d *dockerClient) imageExists(ctx context.Context, image string) (bool, error) {
+	resp, err := d.request(ctx, http.MethodGet, "/images/"+image+"/json", nil, "", http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// pullImage pulls an image, reporting progress lines to progress
+func (d *dockerClient) pullImage(ctx context.Context, image string, progress func(string)) error {
+	resp, err := d.request(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image), nil, "", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readJSONStream(resp.Body, progress)
+}
+
+// buildImage builds the image tag from a context directory
+func (d *dockerClient) buildImage(ctx context.Context, contextDir, dockerfile, tag string, progress func(string)) error {
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeBuildContext(pw, contextDir))
+	}()
+	defer pr.Close()
+
+	query := url.Values{"t": {tag}, "dockerfile": {filepath.ToSlash(dockerfile)}, "rm": {"1"}}
+	resp, err := d.request(ctx, http.MethodPost, "/build?"+query.Encode(), pr, "application/x-tar", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readJSONStream(resp.Body, progress)
+}
+
+// createContainer creates a container and returns its ID
+func (d *dockerClient) createContainer(ctx context.Context, name string, spec containerSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := d.request(ctx, http.MethodPost, "/containers/create?name="+url.QueryEscape(name), bytes.NewReader(data), "application/json", http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode create response: %w", err)
+	}
+	return created.ID, nil
+}
+
+func (d *dockerClient) startContainer(ctx context.Context, id string) error {
+	return d.call(ctx, http.MethodPost, "/containers/"+id+"/start", nil, http.StatusNoContent, http.StatusNotModified)
+}
+
+// waitContainer blocks until the container exits and returns its exit code
+func (d *dockerClient) waitContainer(ctx context.Context, id string) (int, error) {
+	resp, err := d.request(ctx, http.MethodPost, "/containers/"+id+"/wait", nil, "", http.StatusOK)
+	if err != nil {
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return -1, fmt.Errorf("failed to decode wait response: %w", err)
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return result.StatusCode, fmt.Errorf("%s: %s", d.name, result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+// stopContainer sends signal (the image's stop signal if empty) and kills the container after timeout
+func (d *dockerClient) stopContainer(ctx context.Context, id, signal string, timeout time.Duration) error {
+	query := url.Values{"t": {fmt.Sprint(int(timeout.Seconds()))}}
+	if signal != "" {
+		query.Set("signal", signal)
+	}
+	return d.call(ctx, http.MethodPost, "/containers/"+id+"/stop?"+query.Encode(), nil, http.StatusNoContent, http.StatusNotModified)
+}
+
+func (d *dockerClient) killContainer(ctx context.Context, id, signal string) error {
+	path := "/containers/" + id + "/kill"
+	if signal != "" {
+		path += "?signal=" + url.QueryEscape(signal)
+	}
+	return d.call(ctx, http.MethodPost, path, nil, http.StatusNoContent)
+}
+
+// removeContainer force-removes a container; a missing container is not an error
+func (d *dockerClient) removeContainer(ctx context.Context, id string) error {
+	return d.call(ctx, http.MethodDelete, "/containers/"+id+"?force=true", nil, http.StatusNoContent, http.StatusNotFound)
+}
+
+// containerPID returns the host PID of the container's main process
+func (d *dockerClient) containerPID(ctx context.Context, id string) (int, error) {
+	resp, err := d.request(ctx, http.MethodGet, "/containers/"+id+"/json", nil, "", http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var info struct {
+		State struct {
+			Pid int `json:"Pid"`
+		} `json:"State"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return 0, err
+	}
+	return info.State.Pid, nil
+}
+
+// followLogs copies the container's stdout and stderr until it exits
+func (d *dockerClient) followLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	resp, err := d.request(ctx, http.MethodGet, "/containers/"+id+"/logs?follow=1&stdout=1&stderr=1", nil, "", http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return demuxLogs(resp.Body, stdout, stderr)
+}
+
+// demuxLogs splits a multiplexed log stream: each frame has an 8-byte header
+// holding the stream (1 stdout, 2 stderr) and the payload size
+func demuxLogs(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		w := stdout
+		if header[0] == 2 {
+			w = stderr
+		}
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
+
+// readJSONStream reads the progress messages of a pull or build and returns the first error
+func readJSONStream(r io.Reader, progress func(string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Stream string `json:"stream"`
+			Status string `json:"status"`
+			Error  string `json:"error"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		if msg.Error != "" {
+			return fmt.Errorf("docker: %s", strings.TrimSpace(msg.Error))
+		}
+		if line := strings.TrimSpace(msg.Stream + msg.Status); line != "" && progress != nil {
+			progress(line)
+		}
+	}
+	return scanner.Err()
+}
+
+// writeBuildContext tars a build context directory, skipping .git and paths
+// matched by .dockerignore
+func writeBuildContext(w io.Writer, dir string) error {
+	ignore := readDockerignore(dir)
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ".git" || ignored(rel, ignore) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive build context: %w", err)
+	}
+	return tw.Close()
+}
+
+// readDockerignore returns the patterns of a .dockerignore file
+func readDockerignore(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if err != nil {
+		return nil
+	}
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "!") {
+			patterns = append(patterns, strings.Trim(filepath.ToSlash(line), "/"))
+		}
+	}
+	return patterns
+}
+
+// ignored reports whether rel or one of its parent directories matches a pattern
+func ignored(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		for p := rel; p != "."; p = filepath.ToSlash(filepath.Dir(p)) {
+			if ok, _ := filepath.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/jobs"
 	"github.com/gleicon/guvnor/internal/logs"
 )
 
@@ -32,11 +33,22 @@ type EnhancedManager struct {
 
 // NewEnhancedManager creates a new enhanced process manager
 func NewEnhancedManager(logger *logrus.Logger, logCapacity int) *EnhancedManager {
-	return &EnhancedManager{
+	em := &EnhancedManager{
 		Manager:    NewManager(logger),
 		logManager: logs.NewLogManager(logCapacity),
 		stopping:   make(map[string]bool),
 	}
+	em.SetOutputHook(em.logOutput)
+	return em
+}
+
+// logOutput records a line of process output in the log buffer
+func (em *EnhancedManager) logOutput(name, stream, line string, at time.Time) {
+	level := "info"
+	if stream == logs.Stderr {
+		level = "warn"
+	}
+	em.logManager.Add(logs.LogEntry{Timestamp: at, Level: level, Process: name, Message: line, Stream: stream})
 }
 
 // GetLogManager returns the log manager
@@ -68,21 +80,14 @@ func (em *EnhancedManager) StopAllWithResults(ctx context.Context) ([]StopResult
 	}
 	
 	em.logManager.Log("system", "info", fmt.Sprintf("Stopping %d processes: %v", len(processes), processNames))
+	jobs.Plan(ctx, processNames...)
+	results := em.stopProcesses(ctx, processes)
 	
-	results := make([]StopResult, len(processes))
-	var wg sync.WaitGroup
-	
-	// Stop processes concurrently
-	for i, proc := range processes {
-		wg.Add(1)
-		go func(idx int, p *Process) {
-			defer wg.Done()
-			results[idx] = em.stopProcessWithResult(ctx, p)
-		}(i, proc)
+	// Children that escaped their process group (setsid, double forks) are found by marker
+	if orphans := em.reapOrphans(); len(orphans) > 0 {
+		em.logManager.Log("system", "warn", fmt.Sprintf("Killed %d orphaned processes left behind by stopped apps", len(orphans)))
 	}
 	
-	wg.Wait()
-	
 	// Count results
 	var errors []error
 	stopped := 0
@@ -114,6 +119,55 @@ func (em *EnhancedManager) StopAllWithResults(ctx context.Context) ([]StopResult
 	return results, combinedError
 }
 
+// StopWithResults stops every instance of an app (or a single instance) and
+// returns detailed results
+func (em *EnhancedManager) StopWithResults(ctx context.Context, name string) ([]StopResult, error) {
+	targets := em.GetInstances(name)
+	if len(targets) == 0 {
+		proc, exists := em.GetProcess(name)
+		if !exists {
+			return nil, fmt.Errorf("process %s not found", name)
+		}
+		targets = []*Process{proc}
+	}
+	
+	names := make([]string, len(targets))
+	for i, proc := range targets {
+		names[i] = proc.Config.Name
+	}
+	em.logManager.Log(name, "info", fmt.Sprintf("Stopping %v", names))
+	jobs.Plan(ctx, names...)
+	results := em.stopProcesses(ctx, targets)
+	
+	var errors []error
+	for _, result := range results {
+		if result.Status == "error" {
+			errors = append(errors, result.Error)
+		}
+	}
+	if len(errors) > 0 {
+		return results, fmt.Errorf("failed to stop %s: %v", name, errors)
+	}
+	return results, nil
+}
+
+// stopProcesses stops processes concurrently
+func (em *EnhancedManager) stopProcesses(ctx context.Context, processes []*Process) []StopResult {
+	results := make([]StopResult, len(processes))
+	var wg sync.WaitGroup
+	
+	for i, proc := range processes {
+		wg.Add(1)
+		go func(idx int, p *Process) {
+			defer wg.Done()
+			results[idx] = em.stopProcessWithResult(ctx, p)
+		}(i, proc)
+	}
+	
+	wg.Wait()
+	return results
+}
+
 // stopProcessWithResult stops a single process and returns detailed result
 func (em *EnhancedManager) stopProcessWithResult(ctx context.Context, proc *Process) StopResult {
 	start := time.Now()
@@ -141,6 +195,10 @@ func (em *EnhancedManager) stopProcessWithResult(ctx context.Context, proc *Proc
 	}()
 	
 	em.logManager.Log(proc.Config.Name, "info", fmt.Sprintf("Stopping process (PID: %d)", result.PID))
+	jobs.Report(ctx, proc.Config.Name, "stopping", false)
+	defer func() {
+		jobs.Report(ctx, proc.Config.Name, result.Status, true)
+	}()
 	
 	if err := proc.Stop(ctx); err != nil {
 		result.Status = "error"
@@ -172,7 +230,6 @@ func (em *EnhancedManager) StartWithLogging(ctx context.Context, appConfig confi
 		return err
 	}
 	
-	// Get the started process and attach log capture
 	proc, exists := em.GetProcess(appConfig.Name)
 	if exists && proc.IsRunning() {
 		em.logManager.Log(appConfig.Name, "info", fmt.Sprintf("Process started successfully (PID: %d, Port: %d)", proc.GetPID(), appConfig.Port))
@@ -181,29 +238,28 @@ func (em *EnhancedManager) StartWithLogging(ctx context.Context, appConfig confi
 		if appConfig.WorkingDir != "" {
 			em.logManager.Log(appConfig.Name, "debug", fmt.Sprintf("Working directory: %s", appConfig.WorkingDir))
 		}
-		
-		// Start capturing process output
-		go em.captureProcessOutput(proc)
 	}
 	
 	return nil
 }
 
-// captureProcessOutput captures stdout/stderr from a process and logs it
-func (em *EnhancedManager) captureProcessOutput(proc *Process) {
-	if proc.cmd == nil {
-		return
-	}
+// Scale adjusts the number of instances of an app with enhanced logging
+func (em *EnhancedManager) Scale(ctx context.Context, appConfig config.AppConfig, instances int) error {
+	before := em.InstanceCount(appConfig.Name)
+	em.logManager.Log(appConfig.Name, "info", fmt.Sprintf("Scaling from %d to %d instances", before, instances))
 	
-	// Note: For proper output capture, we'd need to modify the process creation
-	// to set up pipes. For now, we'll simulate log capture by monitoring the process
-	// and logging status changes.
+	if err := em.Manager.Scale(ctx, appConfig, instances); err != nil {
+		em.logManager.Log(appConfig.Name, "error", fmt.Sprintf("Failed to scale: %v", err))
+		return err
+	}
 	
-	// Log process start
-	em.logManager.Log(proc.Config.Name, "info", fmt.Sprintf("Process output capture started for PID %d", proc.GetPID()))
+	for _, proc := range em.GetInstances(appConfig.Name) {
+		if proc.IsRunning() {
+			em.logManager.Log(proc.Config.Name, "info", fmt.Sprintf("Instance running (PID: %d, Port: %d)", proc.GetPID(), proc.Config.Port))
+		}
+	}
 	
-	// In a real implementation, you'd set up cmd.Stdout and cmd.Stderr pipes
-	// before calling cmd.Start() in the original process creation code
+	return nil
 }
 
 // Additional utility methods for enhanced process management
@@ -229,7 +285,12 @@ func (em *EnhancedManager) GetRunningProcessInfo() []ProcessInfo {
 	var info []ProcessInfo
 	
 	for name, proc := range em.processes {
-		if proc.IsRunning() {
+		// Jobs are listed after they exit so their last result stays visible
+		if proc.IsRunning() || proc.Config.IsJob() {
+			var usage *Usage
+			if sample, ok := proc.GetUsage(); ok {
+				usage = &sample
+			}
 			info = append(info, ProcessInfo{
 				Name:      name,
 				PID:       proc.GetPID(),
@@ -239,6 +300,10 @@ func (em *EnhancedManager) GetRunningProcessInfo() []ProcessInfo {
 				Args:      proc.Config.Args,
 				StartTime: proc.lastStart,
 				Port:      proc.Config.Port,
+				App:       proc.AppName(),
+				Instance:  proc.Instance(),
+				Usage:     usage,
+				CoreDump:  proc.CoreDump(),
 			})
 		}
 	}
@@ -256,4 +321,8 @@ type ProcessInfo struct {
 	Args      []string   `json:"args"`
 	StartTime time.Time  `json:"start_time"`
 	Port      int        `json:"port"`
+	App       string     `json:"app,omitempty"`
+	Instance  int        `json:"instance,omitempty"`
+	Usage     *Usage     `json:"usage,omitempty"` // Nil until the process has been sampled
+	CoreDump  string     `json:"core_dump,omitempty"` // Core file of the last crash
 }
\ No newline at end of file
@@ -0,0 +1,75 @@
+package process
+
+// Process table events
+const (
+	EventAdded   = "added"   // A process took a name, replacing any earlier one
+	EventRemoved = "removed" // A process was dropped from the table, e.g. by scaling down
+)
+
+// Process lifecycle events
+const (
+	EventStarted   = "started"   // Started, including after a restart
+	EventStopped   = "stopped"   // Stopped on request
+	EventCrashed   = "crashed"   // Exited with an error while it should be running
+	EventRestarted = "restarted" // Restarted after a crash, on request or by a rolling restart
+	EventCrashLoop = "crashloop" // Crashed too often within the crash-loop window, not restarted
+	EventFailed    = "failed"    // Crashed after using up max_retries, not restarted
+)
+
+// eventBuffer is how many events a slow subscriber may fall behind before
+// events to it are dropped
+const eventBuffer = 64
+
+// Event reports a change to the process table or to the lifecycle of a process
+type Event struct {
+	Type    string
+	Name    string
+	Process *Process
+	Fields  map[string]string // Details such as the exit code of a crash
+}
+
+// Subscribe returns a channel receiving process table and lifecycle events, and
+// a function ending the subscription. Events are dropped rather than block the
+// manager when the subscriber falls behind, so subscribers should resync with
+// ListProcesses now and then.
+func (m *Manager) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, eventBuffer)
+
+	m.eventsMu.Lock()
+	if m.subscribers == nil {
+		m.subscribers = make(map[chan Event]struct{})
+	}
+	m.subscribers[events] = struct{}{}
+	m.eventsMu.Unlock()
+
+	return events, func() {
+		m.eventsMu.Lock()
+		defer m.eventsMu.Unlock()
+		if _, exists := m.subscribers[events]; exists {
+			delete(m.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// publish sends an event to every subscriber without blocking
+func (m *Manager) publish(eventType string, proc *Process, fields map[string]string) {
+	event := Event{Type: eventType, Name: proc.Config.Name, Process: proc, Fields: fields}
+
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	for events := range m.subscribers {
+		select {
+		case events <- event:
+		default:
+			m.logger.WithField("event", eventType).WithField("process", event.Name).Warn("Subscriber is not keeping up, dropping process event")
+		}
+	}
+}
+
+// emit publishes a lifecycle event of the process, if it belongs to a manager
+func (p *Process) emit(eventType string, fields map[string]string) {
+	if p.onEvent != nil {
+		p.onEvent(eventType, p, fields)
+	}
+}
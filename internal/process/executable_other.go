@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package process
+
+import (
+	"errors"
+	"fmt"
+)
+
+// processExecutable cannot tell on this platform
+func processExecutable(pid int) (string, error) {
+	return "", fmt.Errorf("reading the executable of a process: %w", errors.ErrUnsupported)
+}
@@ -0,0 +1,99 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/jobs"
+)
+
+// DefaultHookTimeout bounds a lifecycle hook without an explicit timeout
+const DefaultHookTimeout = 60 * time.Second
+
+// Lifecycle hook names
+const (
+	HookPreStart  = "pre_start"
+	HookPostStart = "post_start"
+	HookPreStop   = "pre_stop"
+	HookPostStop  = "post_stop"
+)
+
+// hook returns the configuration of a lifecycle hook
+func (p *Process) hook(name string) config.HookConfig {
+	switch name {
+	case HookPreStart:
+		return p.Config.Hooks.PreStart
+	case HookPostStart:
+		return p.Config.Hooks.PostStart
+	case HookPreStop:
+		return p.Config.Hooks.PreStop
+	case HookPostStop:
+		return p.Config.Hooks.PostStop
+	}
+	return config.HookConfig{}
+}
+
+// runHook runs a lifecycle hook if one is configured. The error is only
+// returned when the hook is set to abort the transition; other failures are logged.
+func (p *Process) runHook(ctx context.Context, name string, pid int) error {
+	hook := p.hook(name)
+	if hook.Command == "" {
+		return nil
+	}
+
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	jobs.Report(ctx, p.Config.Name, fmt.Sprintf("running %s hook", name), false)
+	logger := p.logger.WithField("hook", name)
+	logger.WithField("command", hook.Command).Info("Running lifecycle hook")
+
+	shell, args := platformShell(hook.Command)
+	cmd := exec.CommandContext(hookCtx, shell, args...)
+	cmd.Dir = p.Config.WorkingDir
+	cmd.Env = p.processEnv()
+	cmd.Env = append(cmd.Env, markerEnv(p.Config.Name)...)
+	cmd.Env = append(cmd.Env, "GUVNOR_APP="+p.AppName(), "GUVNOR_HOOK="+name)
+	if pid > 0 {
+		cmd.Env = append(cmd.Env, "GUVNOR_PID="+strconv.Itoa(pid))
+	}
+	cmd.WaitDelay = time.Second
+
+	var outputs []*lineWriter
+	if p.onOutput != nil {
+		prefix := fmt.Sprintf("[%s] ", name)
+		stdout := newLineWriter(func(line string, at time.Time) { p.onOutput(p.Config.Name, "stdout", prefix+line, at) })
+		stderr := newLineWriter(func(line string, at time.Time) { p.onOutput(p.Config.Name, "stderr", prefix+line, at) })
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		outputs = []*lineWriter{stdout, stderr}
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	for _, w := range outputs {
+		w.Flush()
+	}
+	if hookCtx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	logger = logger.WithField("duration", time.Since(start).Round(time.Millisecond))
+	if err == nil {
+		logger.Info("Lifecycle hook succeeded")
+		return nil
+	}
+	if !hook.AbortOnFailure {
+		logger.WithError(err).Warn("Lifecycle hook failed, continuing")
+		return nil
+	}
+	logger.WithError(err).Error("Lifecycle hook failed, aborting")
+	return fmt.Errorf("%s hook failed: %w", name, err)
+}
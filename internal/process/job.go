@@ -0,0 +1,42 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// RunJob runs a one-shot or scheduled app to completion and returns its exit code.
+// The job is never restarted or health checked, and its output goes to the log
+// buffer like any other process. It fails if a previous run is still going.
+func (em *EnhancedManager) RunJob(ctx context.Context, appConfig config.AppConfig) (int, error) {
+	appConfig.RestartPolicy.Enabled = false
+	appConfig.HealthCheck.Enabled = false
+
+	started := time.Now()
+	if err := em.StartWithLogging(ctx, appConfig); err != nil {
+		return -1, err
+	}
+
+	proc, exists := em.GetProcess(appConfig.Name)
+	if !exists || proc.Done() == nil {
+		return -1, fmt.Errorf("job %s did not start", appConfig.Name)
+	}
+
+	select {
+	case <-proc.Done():
+	case <-ctx.Done():
+		return -1, ctx.Err()
+	}
+
+	exitCode := proc.ExitCode()
+	duration := time.Since(started).Round(time.Millisecond)
+	if exitCode != 0 {
+		em.logManager.Log(appConfig.Name, "error", fmt.Sprintf("Job failed with exit code %d after %s", exitCode, duration))
+		return exitCode, fmt.Errorf("job %s exited with code %d", appConfig.Name, exitCode)
+	}
+	em.logManager.Log(appConfig.Name, "info", fmt.Sprintf("Job completed in %s", duration))
+	return 0, nil
+}
@@ -0,0 +1,182 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// limitResource is a resource limit guvnor can set on an app's processes
+type limitResource int
+
+const (
+	limitCore limitResource = iota
+	limitNoFile
+)
+
+func (r limitResource) String() string {
+	if r == limitCore {
+		return "core"
+	}
+	return "nofile"
+}
+
+// applyLimits sets the configured resource limits on a started process. They
+// are applied right after start, so children forked before that keep the old limits.
+func applyLimits(pid int, limits config.LimitsConfig) error {
+	var errs []error
+	for resource, value := range map[limitResource]string{limitCore: limits.Core, limitNoFile: limits.NoFile} {
+		if value == "" {
+			continue
+		}
+		n, err := config.ParseLimit(value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := setPlatformLimit(pid, resource, n); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set %s limit: %w", resource, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// collectCoreDump finds the core file left by a crashed process and, with
+// limits.core_dir set, moves it there. It returns the core's path, or "" if
+// the kernel did not write one where guvnor can find it.
+func (p *Process) collectCoreDump(cmd *exec.Cmd, at time.Time) string {
+	pattern, usesPID := corePattern()
+	if strings.HasPrefix(pattern, "|") {
+		p.logger.WithField("handler", strings.Fields(pattern[1:])[0]).Info("Core dump passed to the system crash handler (see coredumpctl)")
+		return ""
+	}
+
+	pid := cmd.Process.Pid
+	hostname, _ := os.Hostname()
+	// Args[0] rather than Path, which is guvnor itself for sandboxed apps
+	glob := expandCorePattern(pattern, pid, filepath.Base(cmd.Args[0]), hostname, usesPID)
+	if !filepath.IsAbs(glob) {
+		dir := cmd.Dir
+		if dir == "" {
+			dir, _ = os.Getwd()
+		}
+		glob = filepath.Join(dir, glob)
+	}
+
+	path := newestFile(glob)
+	if path == "" {
+		p.logger.WithField("pattern", glob).Warn("Process dumped core but the core file was not found")
+		return ""
+	}
+
+	coreDir := p.Config.Limits.CoreDir
+	if coreDir == "" {
+		return path
+	}
+	if err := os.MkdirAll(coreDir, 0750); err != nil {
+		p.logger.WithError(err).Warn("Failed to create core dump directory")
+		return path
+	}
+	dest := filepath.Join(coreDir, fmt.Sprintf("%s-%d-%s.core", p.Config.Name, pid, at.Format("20060102-150405")))
+	if err := moveFile(path, dest); err != nil {
+		p.logger.WithError(err).WithFields(logrus.Fields{"core": path, "core_dir": coreDir}).Warn("Failed to move core dump")
+		return path
+	}
+	return dest
+}
+
+// expandCorePattern turns a kernel core_pattern into a glob matching the core
+// of one process. Specifiers guvnor cannot know, such as the dump time, match anything.
+func expandCorePattern(pattern string, pid int, executable, hostname string, usesPID bool) string {
+	comm := executable
+	if len(comm) > 15 {
+		comm = comm[:15] // The kernel truncates the command name to 15 bytes
+	}
+
+	var b strings.Builder
+	hasPID := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' || i == len(pattern)-1 {
+			b.WriteByte(pattern[i])
+			continue
+		}
+		i++
+		switch pattern[i] {
+		case '%':
+			b.WriteByte('%')
+		case 'p', 'P':
+			b.WriteString(strconv.Itoa(pid))
+			hasPID = true
+		case 'e':
+			b.WriteString(comm)
+		case 'h':
+			b.WriteString(hostname)
+		default:
+			b.WriteByte('*')
+		}
+	}
+
+	if usesPID && !hasPID {
+		b.WriteString("." + strconv.Itoa(pid))
+	}
+	return b.String()
+}
+
+// newestFile returns the most recently modified file matching glob
+func newestFile(glob string) string {
+	matches, _ := filepath.Glob(glob)
+	type file struct {
+		path    string
+		modTime time.Time
+	}
+	var files []file
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+			files = append(files, file{match, info.ModTime()})
+		}
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	return files[0].path
+}
+
+// moveFile renames src to dst, copying when they are on different filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
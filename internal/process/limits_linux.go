@@ -0,0 +1,42 @@
+//go:build linux
+
+package process
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// setPlatformLimit sets soft and hard limit of a running process with prlimit(2).
+// The hard limit is only raised when needed, which requires CAP_SYS_RESOURCE.
+func setPlatformLimit(pid int, resource limitResource, value uint64) error {
+	res := unix.RLIMIT_CORE
+	if resource == limitNoFile {
+		res = unix.RLIMIT_NOFILE
+	}
+
+	var current unix.Rlimit
+	if err := unix.Prlimit(pid, res, nil, &current); err != nil {
+		return err
+	}
+	limit := unix.Rlimit{Cur: value, Max: current.Max}
+	if value > current.Max {
+		limit.Max = value
+	}
+	return unix.Prlimit(pid, res, &limit, nil)
+}
+
+// corePattern returns the kernel core_pattern and whether core_uses_pid is set
+func corePattern() (string, bool) {
+	pattern := "core"
+	if data, err := os.ReadFile("/proc/sys/kernel/core_pattern"); err == nil {
+		pattern = strings.TrimSpace(string(data))
+	}
+	usesPID := false
+	if data, err := os.ReadFile("/proc/sys/kernel/core_uses_pid"); err == nil {
+		usesPID = strings.TrimSpace(string(data)) == "1"
+	}
+	return pattern, usesPID
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// setPlatformLimit is not supported: there is no portable way to change the
+// limits of another running process
+func setPlatformLimit(pid int, resource limitResource, value uint64) error {
+	return fmt.Errorf("resource limits are not supported on %s", runtime.GOOS)
+}
+
+// corePattern returns the traditional core file name
+func corePattern() (string, bool) {
+	if runtime.GOOS == "darwin" {
+		return "/cores/core.%P", false
+	}
+	return "core", false
+}
@@ -3,18 +3,21 @@ package process
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/env"
+	"github.com/gleicon/guvnor/internal/secrets"
 )
 
 // Process represents a managed application process
@@ -31,17 +34,44 @@ type Process struct {
 	status        ProcessStatus
 	executionMode ExecutionMode
 	containerID   string // For container mode
+	runtime       containerRuntime // Container runtime, nil if unavailable
+	runtimeErr    error             // Why no runtime is available
+	onRestart     func(name string) // Called whenever the process is restarted
+	exited        chan struct{}     // Closed by the monitor when the process exits
+	app           string            // App this process is an instance of
+	instance      int               // 1-based instance number within the app
+	usage         Usage             // Latest resource usage sample
+	usageCPU      time.Duration     // CPU time at the latest sample
+	usageAt       time.Time         // When the latest sample was taken
+	usagePID      int               // PID the latest sample belongs to
+	usageChildCPU map[int]time.Duration // CPU time of each descendant at the latest sample
+	restartTimes  []time.Time       // Recent crash restarts, for backoff and crash-loop detection
+	onOutput      OutputHook        // Receives stdout/stderr lines, nil to discard output
+	extraEnv      EnvHook           // Extra environment read at each start, nil for none
+	dotEnv        *env.EnvConfig    // Read from .env and env_file files at each start
+	secrets       *secrets.Resolver // Looks up secret:// references in the environment
+	resolvedEnv   map[string]string // The app's environment with references resolved at the last start
+	exitCode      atomic.Int64      // Exit code of the last run, -1 while running or unknown
+	coreDump      string            // Core file of the last crash, if one was found
+	adopted       bool              // Left running by a previous guvnor and taken over
+	socket        *os.File          // Listening socket passed with socket_activation, kept across restarts
+	onEvent       func(eventType string, proc *Process, fields map[string]string) // Publishes lifecycle events
+	deployDone    func(app string) <-chan struct{} // Non-nil while the app is in deploy mode
+	managed       func(p *Process) bool            // Reports whether the manager still holds this process
+	console       console                          // Stdio of the clients attached with Attach
 }
 
 // ProcessStatus represents the current status of a process
 type ProcessStatus string
 
 const (
-	StatusStopped  ProcessStatus = "stopped"
-	StatusStarting ProcessStatus = "starting"
-	StatusRunning  ProcessStatus = "running"
-	StatusStopping ProcessStatus = "stopping"
-	StatusFailed   ProcessStatus = "failed"
+	StatusStopped   ProcessStatus = "stopped"
+	StatusStarting  ProcessStatus = "starting"
+	StatusRunning   ProcessStatus = "running"
+	StatusStopping  ProcessStatus = "stopping"
+	StatusFailed    ProcessStatus = "failed"
+	StatusCrashLoop ProcessStatus = "crashloop" // Restarted too often within the crash-loop window
+	StatusCompleted ProcessStatus = "completed" // Job exited successfully
 )
 
 // ExecutionMode defines how processes should be executed
@@ -49,45 +79,63 @@ type ExecutionMode string
 
 const (
 	ModeProcess   ExecutionMode = "process"   // Fork/exec processes directly
-	ModeContainer ExecutionMode = "container" // Run in Docker containers
+	ModeContainer ExecutionMode = "container" // Run in containers
 )
 
+// EnvHook returns extra environment variables for the processes of an app
+type EnvHook func(app string) map[string]string
+
 // Manager manages multiple application processes
 type Manager struct {
 	processes       map[string]*Process
 	logger          *logrus.Entry
 	mu              sync.RWMutex
 	executionMode   ExecutionMode
-	dockerAvailable bool
+	runtime         containerRuntime // Nil if no container runtime is available
+	runtimeErr      error            // Why no runtime is available
 	pidDir          string // Directory for PID files
+	restartHook     func(name string)
+	outputHook      OutputHook
+	envHook         EnvHook
+	secrets         *secrets.Resolver
+	eventsMu        sync.Mutex
+	subscribers     map[chan Event]struct{} // See Subscribe
+	deployMu        sync.Mutex
+	deploys         map[string]*deployMode // Apps in deploy mode, see BeginDeploy
+}
+
+// PIDDir is where the PID and state files of the processes are kept
+func PIDDir() string {
+	return filepath.Join(os.TempDir(), "guvnor", "pids")
 }
 
 // NewManager creates a new process manager
 func NewManager(logger *logrus.Logger) *Manager {
-	pidDir := filepath.Join(os.TempDir(), "guvnor", "pids")
+	pidDir := PIDDir()
 	os.MkdirAll(pidDir, 0755) // Create PID directory
 	
 	m := &Manager{
 		processes:       make(map[string]*Process),
+		deploys:         make(map[string]*deployMode),
 		logger:          logger.WithField("component", "process-manager"),
 		executionMode:   ModeProcess, // Default to process mode
-		dockerAvailable: false,
 		pidDir:          pidDir,
+		secrets:         secrets.NewResolver(),
 	}
 	
-	// Check if Docker is available
-	m.detectDocker()
+	// Check if a container runtime is available
+	m.detectRuntime(config.ExecutionConfig{})
 	
-	// Load existing processes from PID files
-	m.loadFromPidFiles()
+	// Take over processes left running by a previous guvnor
+	m.loadState()
 	
 	return m
 }
 
 // SetExecutionMode sets the execution mode for new processes
 func (m *Manager) SetExecutionMode(mode ExecutionMode) error {
-	if mode == ModeContainer && !m.dockerAvailable {
-		return fmt.Errorf("container mode requested but Docker is not available")
+	if mode == ModeContainer && m.runtime == nil {
+		return fmt.Errorf("container mode requested but no container runtime is available: %w", m.runtimeErr)
 	}
 	
 	m.mu.Lock()
@@ -98,44 +146,135 @@ func (m *Manager) SetExecutionMode(mode ExecutionMode) error {
 	return nil
 }
 
-// detectDocker checks if Docker is available
-func (m *Manager) detectDocker() {
-	cmd := exec.Command("docker", "version")
-	if err := cmd.Run(); err == nil {
-		m.dockerAvailable = true
-		m.logger.Info("Docker detected and available for container mode")
-	} else {
-		m.logger.Debug("Docker not available, using process mode only")
+// SetRestartHook registers a callback invoked whenever a managed process restarts
+func (m *Manager) SetRestartHook(hook func(name string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.restartHook = hook
+	for _, proc := range m.processes {
+		proc.mu.Lock()
+		proc.onRestart = hook
+		proc.mu.Unlock()
+	}
+}
+
+// SetOutputHook registers a callback receiving the output of processes started from now on
+func (m *Manager) SetOutputHook(hook OutputHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outputHook = hook
+}
+
+// SetContainerRuntime selects the runtime used by container apps started from now on
+func (m *Manager) SetContainerRuntime(cfg config.ExecutionConfig) error {
+	if m.detectRuntime(cfg) {
+		return nil
+	}
+	return m.runtimeErr
+}
+
+// SetEnvHook registers a callback adding environment variables to processes started
+// from now on; it is called at every start, so new values apply on restart
+func (m *Manager) SetEnvHook(hook EnvHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.envHook = hook
+	for _, proc := range m.processes {
+		proc.extraEnv = hook
+	}
+}
+
+// SetSecrets sets the resolver looking up secret:// references in the
+// environment of processes started from now on
+func (m *Manager) SetSecrets(resolver *secrets.Resolver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.secrets = resolver
+	for _, proc := range m.processes {
+		proc.secrets = resolver
 	}
 }
 
+// detectRuntime looks for a responding container runtime and reports whether one was found
+func (m *Manager) detectRuntime(cfg config.ExecutionConfig) bool {
+	runtime, err := detectContainerRuntime(context.Background(), cfg)
+	
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	
+	m.runtime, m.runtimeErr = runtime, err
+	if err != nil {
+		m.logger.WithError(err).Debug("No container runtime available, using process mode only")
+		return false
+	}
+	m.logger.WithField("runtime", runtime.runtimeName()).Info("Container runtime detected and available for container mode")
+	return true
+}
+
 // Start starts a process for the given app configuration
 func (m *Manager) Start(ctx context.Context, appConfig config.AppConfig) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	
 	// Check if process already exists
 	if proc, exists := m.processes[appConfig.Name]; exists {
-		if proc.IsRunning() {
+		if proc.isAdopted() && proc.IsRunning() {
+			m.mu.Unlock()
+			if proc.readopt(appConfig) {
+				return nil
+			}
+			proc.logger.Info("Configuration changed since the previous run, replacing recovered process")
+			if err := proc.Stop(ctx); err != nil {
+				return fmt.Errorf("failed to stop recovered process %s: %w", appConfig.Name, err)
+			}
+			m.mu.Lock()
+		}
+		if proc.IsRunning() || proc.GetStatus() == StatusStarting {
+			m.mu.Unlock()
 			return fmt.Errorf("process %s is already running", appConfig.Name)
 		}
 		// Remove existing stopped process
 		delete(m.processes, appConfig.Name)
 	}
 	
-	// Create new process
+	// Create new process, marked as starting so a concurrent Start is refused
+	proc := m.newProcess(appConfig)
+	proc.status = StatusStarting
+	m.processes[appConfig.Name] = proc
+	m.mu.Unlock()
+	m.publish(EventAdded, proc, nil)
+	
+	// Lifecycle hooks may take a while, so the manager is not locked meanwhile
+	return proc.startClaimed(ctx)
+}
+
+// newProcess creates a stopped process for the given app configuration
+func (m *Manager) newProcess(appConfig config.AppConfig) *Process {
 	proc := &Process{
 		Config:        appConfig,
 		logger:        m.logger.WithField("app", appConfig.Name),
 		status:        StatusStopped,
 		executionMode: m.executionMode,
+		runtime:       m.runtime,
+		runtimeErr:    m.runtimeErr,
 		pidFile:       filepath.Join(m.pidDir, appConfig.Name+".pid"),
+		onRestart:     m.restartHook,
+		onOutput:      m.outputHook,
+		extraEnv:      m.envHook,
+		secrets:       m.secrets,
+		onEvent:       m.publish,
+		deployDone:    m.deployDone,
+		managed:       m.manages,
 	}
-	
-	m.processes[appConfig.Name] = proc
-	
-	// Start the process
-	return proc.Start(ctx)
+	if appConfig.Container.Enabled() {
+		proc.executionMode = ModeContainer
+	}
+	proc.exitCode.Store(-1)
+	proc.app, proc.instance = parseInstanceName(appConfig.Name)
+	return proc
 }
 
 // Stop stops a process by name
@@ -161,9 +300,50 @@ func (m *Manager) Restart(ctx context.Context, name string) error {
 		return fmt.Errorf("process %s not found", name)
 	}
 	
+	proc.notifyRestart()
 	return proc.Restart(ctx)
 }
 
+// Reload signals every instance of an app (or a single instance) to reload its configuration
+func (m *Manager) Reload(ctx context.Context, name string) error {
+	targets := m.GetInstances(name)
+	if len(targets) == 0 {
+		proc, exists := m.GetProcess(name)
+		if !exists {
+			return fmt.Errorf("process %s not found", name)
+		}
+		targets = []*Process{proc}
+	}
+	
+	for _, proc := range targets {
+		if err := proc.Reload(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetRestarts clears the restart counter of every instance of an app (or a single
+// instance) and returns the names of the processes that were reset
+func (m *Manager) ResetRestarts(name string) ([]string, error) {
+	targets := m.GetInstances(name)
+	if len(targets) == 0 {
+		proc, exists := m.GetProcess(name)
+		if !exists {
+			return nil, fmt.Errorf("process %s not found", name)
+		}
+		targets = []*Process{proc}
+	}
+	
+	names := make([]string, 0, len(targets))
+	for _, proc := range targets {
+		proc.ResetRestarts()
+		names = append(names, proc.Config.Name)
+	}
+	m.logger.WithField("processes", names).Info("Restart counters reset")
+	return names, nil
+}
+
 // StopAll stops all managed processes
 func (m *Manager) StopAll(ctx context.Context) error {
 	m.mu.RLock()
@@ -180,6 +360,9 @@ func (m *Manager) StopAll(ctx context.Context) error {
 		}
 	}
 	
+	// Children that escaped their process group (setsid, double forks) are found by marker
+	m.reapOrphans()
+	
 	if len(errors) > 0 {
 		return fmt.Errorf("failed to stop some processes: %v", errors)
 	}
@@ -209,30 +392,223 @@ func (m *Manager) ListProcesses() map[string]*Process {
 	return result
 }
 
-// Start starts the process
+// Start starts the process, running the pre_start and post_start hooks around it
 func (p *Process) Start(ctx context.Context) error {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	
 	if p.status == StatusRunning || p.status == StatusStarting {
+		p.mu.Unlock()
 		return fmt.Errorf("process is already running or starting")
 	}
-	
 	p.status = StatusStarting
+	p.mu.Unlock()
+	
+	return p.startClaimed(ctx)
+}
+
+// startClaimed starts a process already marked as starting by the caller.
+// Hooks run without holding the lock so status stays readable meanwhile.
+func (p *Process) startClaimed(ctx context.Context) error {
+	if err := p.loadDotEnv(); err != nil {
+		p.mu.Lock()
+		p.status = StatusFailed
+		p.mu.Unlock()
+		return err
+	}
+	
+	if err := p.resolveEnvironment(ctx); err != nil {
+		p.mu.Lock()
+		p.status = StatusFailed
+		p.mu.Unlock()
+		return err
+	}
+	
+	if err := p.runHook(ctx, HookPreStart, 0); err != nil {
+		p.mu.Lock()
+		p.status = StatusFailed
+		p.mu.Unlock()
+		return err
+	}
+	
+	if err := p.launch(ctx); err != nil {
+		return err
+	}
+	
+	if err := p.runHook(ctx, HookPostStart, p.GetPID()); err != nil {
+		p.halt(ctx)
+		p.mu.Lock()
+		p.status = StatusFailed
+		p.mu.Unlock()
+		return err
+	}
+	
+	p.emit(EventStarted, map[string]string{"pid": strconv.Itoa(p.GetPID())})
+	return nil
+}
+
+// launch starts the process or container
+func (p *Process) launch(ctx context.Context) error {
+	// Pulling or building an image can take minutes, so it happens before locking
+	var image string
+	if p.executionMode == ModeContainer {
+		var err error
+		if p.runtime == nil {
+			err = fmt.Errorf("container mode requested but no container runtime is available: %w", p.runtimeErr)
+		} else {
+			image, err = p.prepareImage(ctx)
+		}
+		if err != nil {
+			p.mu.Lock()
+			p.status = StatusFailed
+			p.mu.Unlock()
+			return err
+		}
+	}
+	
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
 	p.lastStart = time.Now()
 	
 	switch p.executionMode {
 	case ModeContainer:
-		return p.startContainer(ctx)
+		return p.startContainer(ctx, image)
 	default:
 		return p.startProcess(ctx)
 	}
 }
 
+// loadDotEnv reads the .env files in the app's working directory, or in the
+// directory guvnor runs in, so apps from other project directories get their
+// own environment. The app's env_file entries follow in order; unlike the
+// .env files they also override guvnor's own environment.
+func (p *Process) loadDotEnv() error {
+	dir := p.Config.WorkingDir
+	if dir == "" {
+		dir = "."
+	}
+	
+	dotEnv, err := env.LoadDotEnv(dir)
+	if err != nil {
+		return fmt.Errorf("failed to load .env files of %s: %w", p.Config.Name, err)
+	}
+	for _, file := range p.Config.EnvFile {
+		variables, err := env.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to load env_file of %s: %w", p.Config.Name, err)
+		}
+		for key, value := range variables {
+			dotEnv.Variables[key] = value
+		}
+		dotEnv.Files = append(dotEnv.Files, file)
+	}
+	if len(dotEnv.Files) > 0 {
+		p.logger.WithField("files", dotEnv.Files).Debug("Loaded .env files")
+	}
+	
+	p.mu.Lock()
+	p.dotEnv = dotEnv
+	p.mu.Unlock()
+	return nil
+}
+
+// resolveEnvironment expands ${VAR} references in the app's environment from
+// the .env files and guvnor's own environment, then looks up secret://
+// values. It runs at every start, so changed variables and rotated secrets
+// apply on restart.
+func (p *Process) resolveEnvironment(ctx context.Context) error {
+	resolved, err := p.expandEnvironment()
+	if err != nil {
+		return err
+	}
+	for key, value := range resolved {
+		if secrets.IsReference(value) {
+			resolver := p.secrets
+			if resolver == nil {
+				resolver = secrets.NewResolver()
+			}
+			if resolved[key], err = resolver.Resolve(ctx, value); err != nil {
+				return fmt.Errorf("failed to resolve %s of %s: %w", key, p.Config.Name, err)
+			}
+		}
+	}
+	
+	p.mu.Lock()
+	p.resolvedEnv = resolved
+	p.mu.Unlock()
+	return nil
+}
+
+// expandEnvironment returns the app's environment with ${VAR} references
+// expanded from the .env files and guvnor's own environment
+func (p *Process) expandEnvironment() (map[string]string, error) {
+	lookup := func(name string) (string, bool) {
+		if p.dotEnv != nil {
+			if value, exists := p.dotEnv.Variables[name]; exists {
+				return value, true
+			}
+		}
+		return os.LookupEnv(name)
+	}
+	
+	expanded := make(map[string]string, len(p.Config.Environment))
+	for key, value := range p.Config.Environment {
+		var err error
+		if expanded[key], err = env.Expand(value, lookup); err != nil {
+			return nil, fmt.Errorf("failed to expand %s of %s: %w", key, p.Config.Name, err)
+		}
+	}
+	return expanded, nil
+}
+
+// environment returns the variables set on the process: the working directory's
+// .env files, overridden by the hook's, overridden by the app's environment
+func (p *Process) environment() map[string]string {
+	env := make(map[string]string)
+	if p.dotEnv != nil {
+		for key, value := range p.dotEnv.Variables {
+			env[key] = value
+		}
+	}
+	for key, value := range p.overrides() {
+		env[key] = value
+	}
+	return env
+}
+
+// overrides returns the variables taking precedence over the .env files: the
+// hook's, overridden by the app's environment
+func (p *Process) overrides() map[string]string {
+	env := make(map[string]string, len(p.Config.Environment))
+	if p.extraEnv != nil {
+		for key, value := range p.extraEnv(p.AppName()) {
+			env[key] = value
+		}
+	}
+	appEnv := p.resolvedEnv
+	if appEnv == nil {
+		appEnv = p.Config.Environment
+	}
+	for key, value := range appEnv {
+		env[key] = value
+	}
+	return env
+}
+
+// processEnv returns the whole environment of the process and its hooks:
+// guvnor's own with environment() applied on top
+func (p *Process) processEnv() []string {
+	dotEnv := p.dotEnv
+	if dotEnv == nil {
+		dotEnv = &env.EnvConfig{}
+	}
+	return dotEnv.GetEnvForProcess(p.overrides())
+}
+
 // startProcess starts the process using native Go
 func (p *Process) startProcess(ctx context.Context) error {
 	// Create command
-	cmd := exec.CommandContext(ctx, p.Config.Command, p.Config.Args...)
+	argv := Argv(p.Config)
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
 	
 	// Set working directory
 	if p.Config.WorkingDir != "" {
@@ -240,18 +616,56 @@ func (p *Process) startProcess(ctx context.Context) error {
 	}
 	
 	// Set environment variables
-	cmd.Env = os.Environ()
-	for key, value := range p.Config.Environment {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	cmd.Env = p.processEnv()
+	// Inherited by children, so leftovers can be traced to this process
+	cmd.Env = append(cmd.Env, markerEnv(p.Config.Name)...)
+	
+	// Hand over the listening socket instead of letting the app bind the port
+	if p.Config.SocketActivation {
+		if err := p.passSocket(cmd); err != nil {
+			p.status = StatusFailed
+			return err
+		}
+	}
+	
+	// Run through the sandbox helper when the app asks for isolation
+	if err := sandbox(cmd, p.Config); err != nil {
+		p.status = StatusFailed
+		return fmt.Errorf("failed to set up sandbox: %w", err)
 	}
 	
 	// Cross-platform process group setup
 	setProcAttributes(cmd)
 	
+	// Capture output line by line; WaitDelay keeps orphaned grandchildren holding
+	// the pipes from blocking Wait forever
+	var outputs []*lineWriter
+	if p.onOutput != nil {
+		name := p.Config.Name
+		stdout := newLineWriter(func(line string, at time.Time) { p.onOutput(name, "stdout", line, at) })
+		stderr := newLineWriter(func(line string, at time.Time) { p.onOutput(name, "stderr", line, at) })
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		outputs = []*lineWriter{stdout, stderr}
+	}
+	// Attached clients get the output as written, prompts without a newline included
+	cmd.Stdout, cmd.Stderr = p.console.tee(cmd.Stdout), p.console.tee(cmd.Stderr)
+	cmd.WaitDelay = 2 * time.Second
+	var stdin io.WriteCloser
+	if p.Config.Stdin {
+		pipe, err := cmd.StdinPipe()
+		if err != nil {
+			p.status = StatusFailed
+			return fmt.Errorf("failed to open stdin: %w", err)
+		}
+		stdin = pipe
+	}
+	
 	p.logger.WithFields(logrus.Fields{
 		"mode":        "process",
 		"command":     p.Config.Command,
 		"args":        p.Config.Args,
+		"shell":       p.Config.Shell,
+		"sandbox":     p.Config.Sandbox.Enabled(),
 		"working_dir": p.Config.WorkingDir,
 		"port":        p.Config.Port,
 	}).Info("Starting process")
@@ -265,96 +679,64 @@ func (p *Process) startProcess(ctx context.Context) error {
 	p.cmd = cmd
 	p.process = cmd.Process
 	p.pid = cmd.Process.Pid
+	p.console.setStdin(stdin)
 	p.status = StatusRunning
+	p.exitCode.Store(-1)
+	
+	if err := trackProcess(p.pid); err != nil {
+		p.logger.WithError(err).Warn("Failed to track process tree")
+	}
+	
+	if err := applyLimits(p.pid, p.Config.Limits); err != nil {
+		p.logger.WithError(err).Warn("Failed to apply resource limits")
+	}
+	if err := applyPriority(p.pid, p.Config); err != nil {
+		p.logger.WithError(err).Warn("Failed to apply scheduling priority")
+	}
 	
 	// Write PID file
 	if err := p.writePidFile(); err != nil {
 		p.logger.WithError(err).Warn("Failed to write PID file")
 	}
 	
-	// Monitor the process in a goroutine
-	go p.monitor(ctx)
+	// Monitor the process in a goroutine; it is the only caller of cmd.Wait
+	p.exited = make(chan struct{})
+	go p.monitor(ctx, cmd, p.exited, outputs)
 	
 	p.logger.WithField("pid", p.pid).Info("Process started successfully")
 	
 	return nil
 }
 
-// startContainer starts the process in a Docker container
-func (p *Process) startContainer(ctx context.Context) error {
-	// Build Docker command
-	containerName := fmt.Sprintf("guvnor-%s", p.Config.Name)
-	
-	args := []string{
-		"run", "--rm", "--detach",
-		"--name", containerName,
-		"--publish", fmt.Sprintf("%d:%d", p.Config.Port, p.Config.Port),
+// Stop stops the process gracefully, running the pre_stop and post_stop hooks around it
+func (p *Process) Stop(ctx context.Context) error {
+	if err := p.stop(ctx); err != nil {
+		return err
 	}
-	
-	// Add environment variables
-	for key, value := range p.Config.Environment {
-		args = append(args, "--env", fmt.Sprintf("%s=%s", key, value))
+	p.closeSocket()
+	return nil
+}
+
+// stop stops the process with its hooks, keeping the socket of socket_activation
+func (p *Process) stop(ctx context.Context) error {
+	if p.GetStatus() != StatusRunning {
+		return nil // Already stopped
 	}
 	
-	// Mount working directory
-	if p.Config.WorkingDir != "" {
-		args = append(args, "--volume", fmt.Sprintf("%s:/app", p.Config.WorkingDir))
-		args = append(args, "--workdir", "/app")
+	if err := p.runHook(ctx, HookPreStop, p.GetPID()); err != nil {
+		return err
 	}
-	
-	// Use a simple base image with the runtime
-	image := selectBaseImage(p.Config.Command)
-	args = append(args, image)
-	
-	// Add the command and args
-	args = append(args, p.Config.Command)
-	args = append(args, p.Config.Args...)
-	
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	
-	p.logger.WithFields(logrus.Fields{
-		"mode":      "container",
-		"image":     image,
-		"command":   p.Config.Command,
-		"args":      p.Config.Args,
-		"container": containerName,
-		"port":      p.Config.Port,
-	}).Info("Starting container")
-	
-	// Start the container
-	output, err := cmd.Output()
-	if err != nil {
-		p.status = StatusFailed
-		return fmt.Errorf("failed to start container: %w", err)
+	if err := p.halt(ctx); err != nil {
+		return err
 	}
+	p.runHook(ctx, HookPostStop, 0)
 	
-	p.containerID = string(output[:12]) // Docker returns the container ID
-	p.status = StatusRunning
-	
-	// Monitor the container in a goroutine
-	go p.monitorContainer(ctx)
-	
-	p.logger.WithField("container_id", p.containerID).Info("Container started successfully")
-	
+	p.emit(EventStopped, nil)
 	return nil
 }
 
-// selectBaseImage selects an appropriate Docker base image based on the command
-func selectBaseImage(command string) string {
-	switch command {
-	case "python", "python3":
-		return "python:3.11-slim"
-	case "node", "npm":
-		return "node:18-slim"
-	case "go":
-		return "golang:1.21-alpine"
-	default:
-		return "alpine:latest"
-	}
-}
-
-// Stop stops the process gracefully
-func (p *Process) Stop(ctx context.Context) error {
+// halt stops the process without running hooks
+func (p *Process) halt(ctx context.Context) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	
@@ -383,24 +765,42 @@ func (p *Process) stopProcess(ctx context.Context) error {
 	
 	p.logger.WithField("pid", p.pid).Info("Stopping process")
 	
-	// Try graceful shutdown first (SIGTERM)
-	if err := p.process.Signal(getTermSignal()); err != nil {
-		p.logger.WithError(err).Warn("Failed to send termination signal")
-		// Process might already be dead, try to clean up
-		p.status = StatusStopped
-		p.cleanupPidFile()
+	// Try graceful shutdown first (SIGTERM unless stop_signal is set)
+	stopSignal := getTermSignal()
+	if p.Config.StopSignal != "" {
+		sig, err := parseSignal(p.Config.StopSignal)
+		if err != nil {
+			p.logger.WithError(err).Warn("Invalid stop signal, using default")
+		} else {
+			stopSignal = sig
+		}
+	}
+	stopTimeout := p.stopTimeout()
+	deadline := time.Now().Add(stopTimeout)
+	
+	// Children (e.g. npm's node or gunicorn's workers) get the signal too, and
+	// are killed if they outlive the main process past the stop timeout
+	children := treePIDs(p.pid)
+	
+	if err := signalTree(p.process, p.pid, stopSignal); err != nil {
+		p.logger.WithError(err).Warn("Failed to send termination signal, killing process tree")
+		p.forceKill()
+		p.killLeftovers(children, time.Now())
 		return nil
 	}
 	
 	// Wait for graceful shutdown with timeout
+	// The fields are read first, a forced kill clears them while this waits
 	done := make(chan error, 1)
+	exited, cmd, process := p.exited, p.cmd, p.process
 	go func() {
-		if p.cmd != nil {
-			done <- p.cmd.Wait()
+		if cmd != nil && exited != nil {
+			<-exited
+			done <- nil
 		} else {
 			// Wait for process to exit by checking if it's still alive
-			for i := 0; i < 100; i++ { // 10 seconds total
-				if err := p.process.Signal(syscall.Signal(0)); err != nil {
+			for deadline := time.Now().Add(stopTimeout); time.Now().Before(deadline); {
+				if err := process.Signal(syscall.Signal(0)); err != nil {
 					done <- nil // Process is dead
 					return
 				}
@@ -426,11 +826,13 @@ func (p *Process) stopProcess(ctx context.Context) error {
 		} else {
 			p.logger.Info("Process stopped gracefully")
 		}
+		p.killLeftovers(children, deadline)
 		return nil
-	case <-time.After(10 * time.Second):
+	case <-time.After(stopTimeout):
 		// Timeout, force kill
 		p.logger.Warn("Process didn't stop gracefully, forcing kill")
 		p.forceKill()
+		p.killLeftovers(children, time.Now())
 		p.status = StatusStopped
 		p.process = nil
 		p.cmd = nil
@@ -439,31 +841,45 @@ func (p *Process) stopProcess(ctx context.Context) error {
 	}
 }
 
-// stopContainer stops a Docker container
-func (p *Process) stopContainer(ctx context.Context) error {
-	if p.containerID == "" {
-		p.status = StatusStopped
-		return nil
+// stopTimeout returns how long to wait for a graceful stop before killing
+func (p *Process) stopTimeout() time.Duration {
+	if p.Config.StopTimeout > 0 {
+		return p.Config.StopTimeout
 	}
+	return 10 * time.Second
+}
+
+// Reload sends the configured reload signal without restarting the process
+func (p *Process) Reload(ctx context.Context) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	
-	containerName := fmt.Sprintf("guvnor-%s", p.Config.Name)
+	if p.Config.ReloadSignal == "" {
+		return fmt.Errorf("no reload_signal configured for %s", p.Config.Name)
+	}
+	if p.status != StatusRunning {
+		return fmt.Errorf("process %s is not running", p.Config.Name)
+	}
 	
-	// Try graceful stop first
-	stopCmd := exec.CommandContext(ctx, "docker", "stop", containerName)
-	if err := stopCmd.Run(); err != nil {
-		p.logger.WithError(err).Warn("Failed to stop container gracefully, forcing kill")
-		
-		// Force kill if graceful stop failed
-		killCmd := exec.CommandContext(ctx, "docker", "kill", containerName)
-		if err := killCmd.Run(); err != nil {
-			p.logger.WithError(err).Error("Failed to force kill container")
+	p.logger.WithField("signal", p.Config.ReloadSignal).Info("Reloading process")
+	
+	if p.executionMode == ModeContainer {
+		if err := p.runtime.killContainer(ctx, p.containerID, p.Config.ReloadSignal); err != nil {
+			return fmt.Errorf("failed to signal container %s: %w", containerName(p.Config.Name), err)
 		}
+		return nil
 	}
 	
-	p.status = StatusStopped
-	p.containerID = ""
-	p.logger.Info("Container stopped")
-	
+	sig, err := parseSignal(p.Config.ReloadSignal)
+	if err != nil {
+		return err
+	}
+	if p.process == nil {
+		return fmt.Errorf("process %s has no PID", p.Config.Name)
+	}
+	if err := p.process.Signal(sig); err != nil {
+		return fmt.Errorf("failed to send %s to %s: %w", p.Config.ReloadSignal, p.Config.Name, err)
+	}
 	return nil
 }
 
@@ -471,14 +887,18 @@ func (p *Process) stopContainer(ctx context.Context) error {
 func (p *Process) Restart(ctx context.Context) error {
 	p.logger.Info("Restarting process")
 	
-	if err := p.Stop(ctx); err != nil {
+	if err := p.stop(ctx); err != nil {
 		p.logger.WithError(err).Warn("Error stopping process during restart")
 	}
 	
 	// Wait a bit before restarting
 	time.Sleep(1 * time.Second)
 	
-	return p.Start(ctx)
+	if err := p.Start(ctx); err != nil {
+		return err
+	}
+	p.emit(EventRestarted, nil)
+	return nil
 }
 
 // IsRunning returns true if the process is currently running using native Go
@@ -493,9 +913,9 @@ func (p *Process) IsRunning() bool {
 	// Double-check with native Go process check
 	if p.process != nil {
 		// Use signal 0 to check if process exists (cross-platform)
+		// The monitor records the exit; changing the status here would
+		// race with it and keep a crashed process from being restarted
 		if err := p.process.Signal(syscall.Signal(0)); err != nil {
-			// Process is dead, update status
-			p.status = StatusStopped
 			return false
 		}
 	}
@@ -519,6 +939,50 @@ func (p *Process) GetRestartCount() int {
 	return p.restarts
 }
 
+// GetStartTime returns when the process was last started
+func (p *Process) GetStartTime() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	return p.lastStart
+}
+
+// Done returns a channel closed when the current run exits, or nil if never started
+func (p *Process) Done() <-chan struct{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	return p.exited
+}
+
+// CoreDump returns the path of the core file written by the last crash, or ""
+func (p *Process) CoreDump() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.coreDump
+}
+
+// Environment returns the variables set on the process on top of guvnor's own
+// environment, with references resolved as of its last start
+func (p *Process) Environment() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.environment()
+}
+
+// RestartHistory returns when the process was restarted after crashing within
+// the crash-loop window
+func (p *Process) RestartHistory() []time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]time.Time(nil), p.restartTimes...)
+}
+
+// ExitCode returns the exit code of the last run, or -1 while running or unknown
+func (p *Process) ExitCode() int {
+	return int(p.exitCode.Load())
+}
+
 // GetPID returns the process ID if running
 func (p *Process) GetPID() int {
 	p.mu.RLock()
@@ -527,134 +991,148 @@ func (p *Process) GetPID() int {
 	if p.cmd != nil && p.cmd.Process != nil {
 		return p.cmd.Process.Pid
 	}
+	if p.containerID != "" {
+		return p.pid // Host PID of the container's main process
+	}
+	if p.process != nil {
+		return p.pid // Recovered process started by a previous guvnor
+	}
 	
 	return 0
 }
 
 // monitor monitors the process and handles restarts
-func (p *Process) monitor(ctx context.Context) {
+func (p *Process) monitor(ctx context.Context, cmd *exec.Cmd, exited chan struct{}, outputs []*lineWriter) {
 	defer func() {
 		p.mu.Lock()
-		if p.status == StatusRunning {
+		// A restart below replaced cmd, its process is the one running now
+		if p.status == StatusRunning && p.cmd == cmd {
 			p.status = StatusStopped
 		}
 		p.mu.Unlock()
 	}()
 	
-	err := p.cmd.Wait()
+	err := cmd.Wait()
+	for _, w := range outputs {
+		w.Flush()
+	}
+	exitCode := cmd.ProcessState.ExitCode()
+	p.exitCode.Store(int64(exitCode))
+	close(exited)
 	
 	p.mu.Lock()
-	exitCode := p.cmd.ProcessState.ExitCode()
 	wasRunning := p.status == StatusRunning
 	p.mu.Unlock()
 	
+	if wasRunning {
+		// Children left behind by a crash would hold ports and block the restart
+		if killPlatformGroup(cmd.Process.Pid) {
+			p.logger.Warn("Killed processes left behind in the process group")
+		}
+	}
+	releaseProcess(cmd.Process.Pid)
+	
 	if wasRunning {
 		if err != nil {
-			p.logger.WithFields(logrus.Fields{
+			fields := logrus.Fields{
 				"error":     err,
 				"exit_code": exitCode,
-			}).Error("Process exited with error")
+			}
+			if platformCoreDumped(cmd.ProcessState) {
+				coreDump := p.collectCoreDump(cmd, time.Now())
+				p.mu.Lock()
+				p.coreDump = coreDump
+				p.mu.Unlock()
+				fields["core_dump"] = coreDump
+			}
+			p.logger.WithFields(fields).Error("Process exited with error")
+			
+			details := map[string]string{"exit_code": strconv.Itoa(exitCode), "error": err.Error()}
+			if coreDump := p.CoreDump(); coreDump != "" {
+				details["core_dump"] = coreDump
+			}
+			p.emit(EventCrashed, details)
 		} else {
 			p.logger.Info("Process exited normally")
 		}
 		
 		// Handle restart if enabled and not a normal exit
-		if p.Config.RestartPolicy.Enabled && exitCode != 0 && p.restarts < p.Config.RestartPolicy.MaxRetries {
-			p.mu.Lock()
-			p.restarts++
-			p.status = StatusStopped
-			p.mu.Unlock()
+		if p.Config.RestartPolicy.Enabled && exitCode != 0 {
+			if !p.waitDeploy(ctx, cmd) {
+				return
+			}
+			delay, ok := p.nextRestart(time.Now())
+			if !ok {
+				p.logGaveUp()
+				return
+			}
+			p.notifyRestart()
 			
 			p.logger.WithFields(logrus.Fields{
-				"restarts":    p.restarts,
+				"restarts":    p.GetRestartCount(),
 				"max_retries": p.Config.RestartPolicy.MaxRetries,
+				"delay":       delay,
 			}).Info("Scheduling process restart")
 			
 			// Wait before restarting
 			select {
 			case <-ctx.Done():
 				return
-			case <-time.After(p.Config.RestartPolicy.Backoff):
+			case <-time.After(delay):
 			}
 			
 			if err := p.Start(ctx); err != nil {
 				p.logger.WithError(err).Error("Failed to restart process")
+			} else {
+				p.emit(EventRestarted, map[string]string{"restarts": strconv.Itoa(p.GetRestartCount())})
 			}
 		} else {
 			p.mu.Lock()
-			p.status = StatusFailed
+			p.status = finalStatus(p.Config, exitCode)
 			p.mu.Unlock()
 		}
 	}
 }
 
-// monitorContainer monitors a Docker container and handles restarts
-func (p *Process) monitorContainer(ctx context.Context) {
-	defer func() {
-		p.mu.Lock()
-		if p.status == StatusRunning {
-			p.status = StatusStopped
-		}
-		p.mu.Unlock()
-	}()
-	
-	containerName := fmt.Sprintf("guvnor-%s", p.Config.Name)
-	
-	// Wait for container to finish
-	waitCmd := exec.CommandContext(ctx, "docker", "wait", containerName)
-	output, err := waitCmd.Output()
-	
-	p.mu.Lock()
-	wasRunning := p.status == StatusRunning
-	p.mu.Unlock()
-	
-	if wasRunning {
-		var exitCode int
-		if err != nil {
-			p.logger.WithError(err).Error("Container monitoring error")
-			exitCode = 1
-		} else {
-			// Docker wait returns the exit code as string
-			if len(output) > 0 {
-				exitCode = int(output[0] - '0') // Simple conversion for single digit
-			}
-		}
-		
-		if exitCode == 0 {
-			p.logger.Info("Container exited normally")
-		} else {
-			p.logger.WithField("exit_code", exitCode).Error("Container exited with error")
-		}
-		
-		// Handle restart if enabled and not a normal exit
-		if p.Config.RestartPolicy.Enabled && exitCode != 0 && p.restarts < p.Config.RestartPolicy.MaxRetries {
-			p.mu.Lock()
-			p.restarts++
-			p.status = StatusStopped
-			p.containerID = ""
-			p.mu.Unlock()
-			
-			p.logger.WithFields(logrus.Fields{
-				"restarts":    p.restarts,
-				"max_retries": p.Config.RestartPolicy.MaxRetries,
-			}).Info("Scheduling container restart")
-			
-			// Wait before restarting
-			select {
-			case <-ctx.Done():
-				return
-			case <-time.After(p.Config.RestartPolicy.Backoff):
-			}
-			
-			if err := p.Start(ctx); err != nil {
-				p.logger.WithError(err).Error("Failed to restart container")
-			}
-		} else {
-			p.mu.Lock()
-			p.status = StatusFailed
-			p.containerID = ""
-			p.mu.Unlock()
+// finalStatus is the status of a process that exited and is not restarted
+func finalStatus(appConfig config.AppConfig, exitCode int) ProcessStatus {
+	if appConfig.IsJob() && exitCode == 0 {
+		return StatusCompleted
+	}
+	return StatusFailed
+}
+
+// logGaveUp explains why a crashed process is not restarted again
+func (p *Process) logGaveUp() {
+	restarts := strconv.Itoa(p.GetRestartCount())
+	if p.GetStatus() == StatusCrashLoop {
+		window := p.Config.RestartPolicy.CrashLoop.Window
+		if window <= 0 {
+			window = defaultCrashLoopWindow
 		}
+		p.logger.WithFields(logrus.Fields{
+			"max_restarts": p.Config.RestartPolicy.CrashLoop.MaxRestarts,
+			"window":       p.Config.RestartPolicy.CrashLoop.Window,
+		}).Error("Crash loop detected, not restarting (clear with: guvnor reset)")
+		p.emit(EventCrashLoop, map[string]string{
+			"restarts":     restarts,
+			"max_restarts": strconv.Itoa(p.Config.RestartPolicy.CrashLoop.MaxRestarts),
+			"window":       window.String(),
+		})
+		return
+	}
+	p.logger.WithField("restarts", p.GetRestartCount()).Error("Restart limit reached, not restarting (clear with: guvnor reset)")
+	p.emit(EventFailed, map[string]string{"restarts": restarts})
+}
+
+// notifyRestart invokes the restart hook if one is registered
+func (p *Process) notifyRestart() {
+	p.mu.RLock()
+	hook := p.onRestart
+	p.mu.RUnlock()
+
+	if hook != nil {
+		hook(p.AppName())
 	}
 }
 
@@ -666,8 +1144,12 @@ func (p *Process) forceKill() {
 	
 	p.logger.WithField("pid", p.pid).Warn("Force killing process")
 	
+	// Children that left the process group are killed one by one
+	children := treePIDs(p.pid)
+	
 	// Use cross-platform process kill
 	killProcess(p.process, p.pid)
+	p.killLeftovers(children, time.Now())
 	
 	p.status = StatusStopped
 	p.process = nil
@@ -684,64 +1166,17 @@ func (p *Process) writePidFile() error {
 	}
 	
 	pidStr := strconv.Itoa(p.pid)
-	return os.WriteFile(p.pidFile, []byte(pidStr), 0644)
+	if err := os.WriteFile(p.pidFile, []byte(pidStr), 0644); err != nil {
+		return err
+	}
+	return p.writeState()
 }
 
 // cleanupPidFile removes the PID file
 func (p *Process) cleanupPidFile() {
 	if p.pidFile != "" {
 		os.Remove(p.pidFile)
-	}
-}
-
-// loadFromPidFiles loads existing processes from PID files
-func (m *Manager) loadFromPidFiles() {
-	if m.pidDir == "" {
-		return
-	}
-	
-	files, err := filepath.Glob(filepath.Join(m.pidDir, "*.pid"))
-	if err != nil {
-		m.logger.WithError(err).Warn("Failed to scan PID directory")
-		return
-	}
-	
-	for _, file := range files {
-		name := strings.TrimSuffix(filepath.Base(file), ".pid")
-		
-		pidData, err := os.ReadFile(file)
-		if err != nil {
-			continue
-		}
-		
-		pid, err := strconv.Atoi(strings.TrimSpace(string(pidData)))
-		if err != nil {
-			os.Remove(file) // Remove invalid PID file
-			continue
-		}
-		
-		// Check if process is still running
-		if process, err := os.FindProcess(pid); err == nil {
-			if err := process.Signal(syscall.Signal(0)); err == nil {
-				// Process is running, add to manager
-				proc := &Process{
-					Config: config.AppConfig{Name: name},
-					process: process,
-					pid:     pid,
-					pidFile: file,
-					status:  StatusRunning,
-					logger:  m.logger.WithField("app", name),
-				}
-				m.processes[name] = proc
-				m.logger.WithFields(logrus.Fields{
-					"process": name,
-					"pid":     pid,
-				}).Info("Recovered running process")
-			} else {
-				// Process is dead, remove PID file
-				os.Remove(file)
-			}
-		}
+		os.Remove(p.statePath())
 	}
 }
 
@@ -761,6 +1196,26 @@ func getTermSignal() os.Signal {
 	return getPlatformTermSignal()
 }
 
+// parseSignal resolves a signal name for the platform
+func parseSignal(name string) (os.Signal, error) {
+	return config.ParseSignal(name)
+}
+
+// signalTree sends a signal to a process and its children in a cross-platform way
+func signalTree(process *os.Process, pid int, sig os.Signal) error {
+	return signalPlatformTree(process, pid, sig)
+}
+
+// trackProcess prepares a started process so its whole tree can be stopped
+func trackProcess(pid int) error {
+	return trackPlatformProcess(pid)
+}
+
+// releaseProcess frees what trackProcess set up once the process has exited
+func releaseProcess(pid int) {
+	releasePlatformProcess(pid)
+}
+
 // killProcess kills a process in a cross-platform way
 func killProcess(process *os.Process, pid int) {
 	killPlatformProcess(process, pid)
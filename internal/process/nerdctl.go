@@ -0,0 +1,316 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nerdctlClient runs containers on containerd through the nerdctl CLI, as
+// containerd itself has no Docker-style API
+type nerdctlClient struct {
+	binary    string
+	address   string // containerd socket, nerdctl's default if empty
+	namespace string // containerd namespace, nerdctl's default if empty
+}
+
+// newNerdctlClient locates nerdctl on PATH
+func newNerdctlClient(address, namespace string) (*nerdctlClient, error) {
+	binary, err := exec.LookPath("nerdctl")
+	if err != nil {
+		return nil, fmt.Errorf("nerdctl not found: %w", err)
+	}
+	return &nerdctlClient{binary: binary, address: address, namespace: namespace}, nil
+}
+
+// runtimeName implements containerRuntime
+func (n *nerdctlClient) runtimeName() string {
+	return "containerd"
+}
+
+// command builds a nerdctl invocation with the global flags
+func (n *nerdctlClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	var global []string
+	if n.address != "" {
+		global = append(global, "--address", n.address)
+	}
+	if n.namespace != "" {
+		global = append(global, "--namespace", n.namespace)
+	}
+	return exec.CommandContext(ctx, n.binary, append(global, args...)...)
+}
+
+// run runs nerdctl and returns its trimmed stdout
+func (n *nerdctlClient) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := n.command(ctx, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("containerd: nerdctl %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("containerd: nerdctl %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// stream runs nerdctl and reports each output line to progress
+func (n *nerdctlClient) stream(ctx context.Context, progress func(string), args ...string) error {
+	pr, pw := io.Pipe()
+	cmd := n.command(ctx, args...)
+	cmd.Stdout, cmd.Stderr = pw, pw
+
+	done := make(chan struct{})
+	var tail []string
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if progress != nil {
+				progress(line)
+			}
+			// Keep the last lines for the error message
+			tail = append(tail, line)
+			if len(tail) > 5 {
+				tail = tail[1:]
+			}
+		}
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Run()
+	pw.Close()
+	<-done
+	if err != nil {
+		return fmt.Errorf("containerd: nerdctl %s: %w: %s", args[0], err, strings.Join(tail, "; "))
+	}
+	return nil
+}
+
+func (n *nerdctlClient) execCommand(id string, tty bool, argv []string) (*exec.Cmd, error) {
+	return n.command(context.Background(), append(execArgs(id, tty), argv...)...), nil
+}
+
+func (n *nerdctlClient) ping(ctx context.Context) error {
+	_, err := n.run(ctx, "version")
+	return err
+}
+
+func (n *nerdctlClient) imageExists(ctx context.Context, image string) (bool, error) {
+	err := n.command(ctx, "image", "inspect", image).Run()
+	if _, ok := err.(*exec.ExitError); ok {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (n *nerdctlClient) pullImage(ctx context.Context, image string, progress func(string)) error {
+	return n.stream(ctx, progress, "pull", image)
+}
+
+// buildImage needs buildkitd running next to containerd
+func (n *nerdctlClient) buildImage(ctx context.Context, contextDir, dockerfile, tag string, progress func(string)) error {
+	args := []string{"build", "-t", tag}
+	if dockerfile != "" {
+		args = append(args, "-f", dockerfile)
+	}
+	return n.stream(ctx, progress, append(args, contextDir)...)
+}
+
+func (n *nerdctlClient) createContainer(ctx context.Context, name string, spec containerSpec) (string, error) {
+	args, err := nerdctlCreateArgs(name, spec)
+	if err != nil {
+		return "", err
+	}
+	return n.run(ctx, args...)
+}
+
+func (n *nerdctlClient) startContainer(ctx context.Context, id string) error {
+	_, err := n.run(ctx, "start", id)
+	return err
+}
+
+func (n *nerdctlClient) waitContainer(ctx context.Context, id string) (int, error) {
+	out, err := n.run(ctx, "wait", id)
+	if err != nil {
+		return -1, err
+	}
+	code, err := strconv.Atoi(out)
+	if err != nil {
+		return -1, fmt.Errorf("containerd: unexpected wait output %q", out)
+	}
+	return code, nil
+}
+
+func (n *nerdctlClient) stopContainer(ctx context.Context, id, signal string, timeout time.Duration) error {
+	args := []string{"stop", "-t", strconv.Itoa(int(timeout.Seconds()))}
+	if signal != "" {
+		args = append(args, "--signal", signal)
+	}
+	_, err := n.run(ctx, append(args, id)...)
+	return err
+}
+
+func (n *nerdctlClient) killContainer(ctx context.Context, id, signal string) error {
+	args := []string{"kill"}
+	if signal != "" {
+		args = append(args, "--signal", signal)
+	}
+	_, err := n.run(ctx, append(args, id)...)
+	return err
+}
+
+func (n *nerdctlClient) removeContainer(ctx context.Context, id string) error {
+	_, err := n.run(ctx, "rm", "-f", id)
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "no such container") {
+		return nil
+	}
+	return err
+}
+
+func (n *nerdctlClient) containerPID(ctx context.Context, id string) (int, error) {
+	out, err := n.run(ctx, "inspect", "--format", "{{.State.Pid}}", id)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+func (n *nerdctlClient) followLogs(ctx context.Context, id string, stdout, stderr io.Writer) error {
+	cmd := n.command(ctx, "logs", "--follow", id)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	return cmd.Run()
+}
+
+// nerdctlCreateArgs translates a Docker API create request into nerdctl flags.
+// HostConfig fields without a nerdctl flag are refused rather than dropped.
+func nerdctlCreateArgs(name string, spec containerSpec) ([]string, error) {
+	args := []string{"create", "--name", name}
+	if spec.WorkingDir != "" {
+		args = append(args, "--workdir", spec.WorkingDir)
+	}
+	for _, env := range spec.Env {
+		args = append(args, "--env", env)
+	}
+	for _, key := range sortedKeys(spec.Labels) {
+		args = append(args, "--label", key+"="+spec.Labels[key])
+	}
+
+	for _, key := range sortedKeys(spec.HostConfig) {
+		value := spec.HostConfig[key]
+		switch key {
+		case "PortBindings":
+			bindings, _ := value.(map[string]interface{})
+			for _, port := range sortedKeys(bindings) {
+				for _, hostPort := range hostPorts(bindings[port]) {
+					args = append(args, "--publish", hostPort+":"+port)
+				}
+			}
+		case "Binds":
+			for _, bind := range stringList(value) {
+				args = append(args, "--volume", bind)
+			}
+		case "NetworkMode":
+			args = append(args, "--network", fmt.Sprint(value))
+		case "Ulimits":
+			for _, ulimit := range ulimitList(value) {
+				args = append(args, "--ulimit", ulimit)
+			}
+		case "Memory":
+			args = append(args, "--memory", fmt.Sprint(value))
+		case "OomScoreAdj":
+			args = append(args, "--oom-score-adj", fmt.Sprint(value))
+		case "NanoCpus":
+			nano, _ := strconv.ParseFloat(fmt.Sprint(value), 64)
+			args = append(args, "--cpus", strconv.FormatFloat(nano/1e9, 'f', -1, 64))
+		case "Privileged":
+			if value == true {
+				args = append(args, "--privileged")
+			}
+		case "CapAdd", "CapDrop":
+			flag := "--cap-add"
+			if key == "CapDrop" {
+				flag = "--cap-drop"
+			}
+			for _, capability := range stringList(value) {
+				args = append(args, flag, capability)
+			}
+		default:
+			return nil, fmt.Errorf("host_config %s is not supported by the containerd runtime", key)
+		}
+	}
+
+	args = append(args, spec.Image)
+	return append(args, spec.Cmd...), nil
+}
+
+// hostPorts extracts HostPort values from a PortBindings entry
+func hostPorts(value interface{}) []string {
+	var ports []string
+	switch bindings := value.(type) {
+	case []map[string]string:
+		for _, b := range bindings {
+			ports = append(ports, b["HostPort"])
+		}
+	case []interface{}:
+		for _, b := range bindings {
+			if m, ok := b.(map[string]interface{}); ok {
+				ports = append(ports, fmt.Sprint(m["HostPort"]))
+			}
+		}
+	}
+	return ports
+}
+
+// ulimitList formats Ulimits entries as name=soft:hard
+func ulimitList(value interface{}) []string {
+	var entries []map[string]interface{}
+	switch v := value.(type) {
+	case []map[string]interface{}:
+		entries = v
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				entries = append(entries, m)
+			}
+		}
+	}
+
+	var ulimits []string
+	for _, u := range entries {
+		ulimits = append(ulimits, fmt.Sprintf("%v=%v:%v", u["Name"], u["Soft"], u["Hard"]))
+	}
+	return ulimits
+}
+
+// stringList converts a []string or a YAML list to strings
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
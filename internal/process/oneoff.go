@@ -0,0 +1,81 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/secrets"
+)
+
+// Command returns a command running argv the way a process of app is run: in
+// its working directory, with its .env and env_file files and its environment,
+// references resolved as at start. The command is not managed, so it is
+// neither restarted nor does its output go to the log buffer.
+func Command(ctx context.Context, app config.AppConfig, resolver *secrets.Resolver, argv []string) (*exec.Cmd, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("no command to run")
+	}
+	p := &Process{
+		Config:  app,
+		logger:  logrus.StandardLogger().WithField("component", "process-manager").WithField("app", app.Name),
+		secrets: resolver,
+	}
+	if err := p.loadDotEnv(); err != nil {
+		return nil, err
+	}
+	if err := p.resolveEnvironment(ctx); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Dir = app.WorkingDir
+	cmd.Env = p.processEnv()
+	return cmd, nil
+}
+
+// Argv returns the command and arguments a process of app is started with,
+// through the platform's shell for shell apps
+func Argv(app config.AppConfig) []string {
+	if app.Shell {
+		shell, args := platformShell(app.CommandLine())
+		return append([]string{shell}, args...)
+	}
+	return append([]string{app.Command}, app.Args...)
+}
+
+// Environment returns the variables a process of app gets on top of guvnor's
+// own environment: its .env and env_file files, overridden by its environment
+// with ${VAR} references expanded. secret:// references are not looked up.
+func Environment(app config.AppConfig) (map[string]string, error) {
+	p := &Process{
+		Config: app,
+		logger: logrus.StandardLogger().WithField("component", "process-manager").WithField("app", app.Name),
+	}
+	if err := p.loadDotEnv(); err != nil {
+		return nil, err
+	}
+	expanded, err := p.expandEnvironment()
+	if err != nil {
+		return nil, err
+	}
+	p.resolvedEnv = expanded
+	return p.environment(), nil
+}
+
+// ContainerCommand returns a command running argv inside the running
+// container of a container-mode process, through the CLI of the runtime
+// execution selects. name is the process name, e.g. web or web.2.
+func ContainerCommand(ctx context.Context, execution config.ExecutionConfig, name string, tty bool, argv []string) (*exec.Cmd, error) {
+	if len(argv) == 0 {
+		return nil, fmt.Errorf("no command to run")
+	}
+	runtime, err := detectContainerRuntime(ctx, execution)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.execCommand(containerName(name), tty, argv)
+}
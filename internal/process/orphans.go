@@ -0,0 +1,139 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Variables guvnor sets on every process it starts. Children inherit them, so
+// leftovers can be traced back to their app after being reparented.
+const (
+	markerProcessEnv    = "GUVNOR_PROCESS"
+	markerSupervisorEnv = "GUVNOR_SUPERVISOR"
+)
+
+// supervisorID tells apart the processes of guvnor servers run from different
+// directories, so one never reaps another's processes
+var supervisorID = func() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "unknown"
+	}
+	return dir
+}()
+
+// processMarker is the marker found in a process's environment
+type processMarker struct {
+	process    string
+	supervisor string
+}
+
+// parseMarker finds the marker among KEY=VALUE entries
+func parseMarker(env []string) (processMarker, bool) {
+	var marker processMarker
+	for _, entry := range env {
+		key, value, _ := strings.Cut(entry, "=")
+		switch key {
+		case markerProcessEnv:
+			marker.process = value
+		case markerSupervisorEnv:
+			marker.supervisor = value
+		}
+	}
+	return marker, marker.process != "" && marker.supervisor != ""
+}
+
+// markerEnv returns the marker variables for a process
+func markerEnv(name string) []string {
+	return []string{markerProcessEnv + "=" + name, markerSupervisorEnv + "=" + supervisorID}
+}
+
+// Orphan is a process started under guvnor that outlived the process it came from
+type Orphan struct {
+	PID     int    `json:"pid"`
+	PPID    int    `json:"ppid"`
+	Process string `json:"process"` // Managed process it was started by
+	Command string `json:"command"`
+}
+
+// Orphans lists processes carrying this server's marker that are neither
+// managed processes nor their descendants, nor descendants of guvnor itself
+func (m *Manager) Orphans() ([]Orphan, error) {
+	entries, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	markers := processMarkers(entries)
+
+	self := os.Getpid()
+	owned := map[int]bool{self: true}
+	roots := []int{self}
+	for _, proc := range m.ListProcesses() {
+		if pid := proc.GetPID(); pid > 0 && proc.IsRunning() {
+			roots = append(roots, pid)
+		}
+	}
+	for _, root := range roots {
+		owned[root] = true
+		for _, e := range descendants(root, entries) {
+			owned[e.pid] = true
+		}
+	}
+
+	var orphans []Orphan
+	for _, e := range entries {
+		marker, ok := markers[e.pid]
+		if !ok || marker.supervisor != supervisorID || owned[e.pid] || isZombie(e.pid) {
+			continue
+		}
+		orphans = append(orphans, Orphan{PID: e.pid, PPID: e.ppid, Process: marker.process, Command: e.command})
+	}
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].PID < orphans[j].PID })
+	return orphans, nil
+}
+
+// KillOrphans kills every orphan and returns the ones that were killed
+func (m *Manager) KillOrphans() ([]Orphan, error) {
+	orphans, err := m.Orphans()
+	if err != nil {
+		return nil, err
+	}
+
+	var killed []Orphan
+	var failed []string
+	for _, orphan := range orphans {
+		proc, err := os.FindProcess(orphan.PID)
+		if err == nil {
+			err = proc.Kill()
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%d (%v)", orphan.PID, err))
+			continue
+		}
+		killed = append(killed, orphan)
+		m.logger.WithFields(logrus.Fields{
+			"process": orphan.Process,
+			"pid":     orphan.PID,
+			"command": orphan.Command,
+		}).Warn("Killed orphaned process")
+	}
+
+	if len(failed) > 0 {
+		return killed, fmt.Errorf("failed to kill %s", strings.Join(failed, ", "))
+	}
+	return killed, nil
+}
+
+// reapOrphans kills leftovers after processes were stopped; it is best effort
+func (m *Manager) reapOrphans() []Orphan {
+	killed, err := m.KillOrphans()
+	if err != nil && !errors.Is(err, errUsageUnsupported) {
+		m.logger.WithError(err).Warn("Failed to reap orphaned processes")
+	}
+	return killed
+}
@@ -0,0 +1,57 @@
+package process
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+// maxOutputLine bounds a buffered partial line; longer lines are split
+const maxOutputLine = 64 * 1024
+
+// OutputHook receives each line a process writes to stdout or stderr, with
+// the time its end was read
+type OutputHook func(name, stream, line string, at time.Time)
+
+// lineWriter turns a process output stream into lines
+type lineWriter struct {
+	mu   sync.Mutex
+	buf  []byte
+	emit func(line string, at time.Time)
+}
+
+func newLineWriter(emit func(line string, at time.Time)) *lineWriter {
+	return &lineWriter{emit: emit}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	at := time.Now()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(string(bytes.TrimRight(w.buf[:i], "\r")), at)
+		w.buf = w.buf[i+1:]
+	}
+	if len(w.buf) >= maxOutputLine {
+		w.emit(string(w.buf), at)
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// Flush emits a trailing line that was not terminated by a newline
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) > 0 {
+		w.emit(string(w.buf), time.Now())
+		w.buf = nil
+	}
+}
@@ -18,6 +18,27 @@ func getPlatformTermSignal() os.Signal {
 	return syscall.SIGTERM
 }
 
+// trackPlatformProcess does nothing; the process group set up at start holds the tree
+func trackPlatformProcess(pid int) error {
+	return nil
+}
+
+// releasePlatformProcess does nothing on Unix systems
+func releasePlatformProcess(pid int) {}
+
+// activateSocket passes socket to cmd as fd 3 with the systemd variables. The
+// command runs through sh so LISTEN_PID can be set to its PID, which exec keeps.
+func activateSocket(cmd *exec.Cmd, socket *os.File, name string) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	cmd.ExtraFiles = []*os.File{socket}
+	cmd.Env = append(cmd.Env, listenEnv(name)...)
+	cmd.Args = append([]string{"/bin/sh", "-c", `LISTEN_PID=$$; export LISTEN_PID; exec "$0" "$@"`, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
 // killPlatformProcess kills a process on Unix systems
 func killPlatformProcess(process *os.Process, pid int) {
 	// Try to kill the entire process group first
@@ -27,4 +48,39 @@ func killPlatformProcess(process *os.Process, pid int) {
 		// Fallback to killing just the main process
 		process.Kill()
 	}
-}
\ No newline at end of file
+}
+
+// signalPlatformTree sends sig to the process group led by pid, which holds the
+// process and the children it forked; just the process if it leads no group
+func signalPlatformTree(process *os.Process, pid int, sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		if pgid, err := syscall.Getpgid(pid); err == nil && pgid == pid {
+			return syscall.Kill(-pgid, s)
+		}
+	}
+	return process.Signal(sig)
+}
+
+// killPlatformGroup kills what is left of the process group led by an exited
+// process and reports whether anything was left
+func killPlatformGroup(pid int) bool {
+	return pid > 0 && syscall.Kill(-pid, syscall.SIGKILL) == nil
+}
+
+// platformAlive reports whether a process is still running; an exited child
+// waiting to be reaped by init does not count
+func platformAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return (err == nil || err == syscall.EPERM) && !isZombie(pid)
+}
+
+// platformShell returns the command line that runs a shell snippet
+func platformShell(command string) (string, []string) {
+	return "/bin/sh", []string{"-c", command}
+}
+
+// platformCoreDumped reports whether an exited process wrote a core dump
+func platformCoreDumped(state *os.ProcessState) bool {
+	status, ok := state.Sys().(syscall.WaitStatus)
+	return ok && status.CoreDump()
+}
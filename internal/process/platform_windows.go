@@ -3,14 +3,40 @@
 package process
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"strconv"
+	"sync"
 	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// processJobs holds the Job Object of each started process by PID. Everything the
+// process spawns joins its job, so the whole tree can be terminated at once
+// even after intermediate processes have exited.
+var (
+	processJobsMu sync.Mutex
+	processJobs   = make(map[int]windows.Handle)
 )
 
+// jobAccounting mirrors JOBOBJECT_BASIC_ACCOUNTING_INFORMATION
+type jobAccounting struct {
+	TotalUserTime             int64
+	TotalKernelTime           int64
+	ThisPeriodTotalUserTime   int64
+	ThisPeriodTotalKernelTime int64
+	TotalPageFaultCount       uint32
+	TotalProcesses            uint32
+	ActiveProcesses           uint32
+	TotalTerminatedProcesses  uint32
+}
+
 // setPlatformProcAttributes sets Windows-specific process attributes
 func setPlatformProcAttributes(cmd *exec.Cmd) {
-	// On Windows, create a new process group
+	// On Windows, create a new process group; it receives CTRL_BREAK_EVENT on stop
 	cmd.SysProcAttr.CreationFlags = syscall.CREATE_NEW_PROCESS_GROUP
 }
 
@@ -19,9 +45,135 @@ func getPlatformTermSignal() os.Signal {
 	return os.Interrupt
 }
 
-// killPlatformProcess kills a process on Windows
+// trackPlatformProcess puts a started process in a Job Object of its own.
+// Children it spawned before being assigned escape the job; taskkill /T still
+// finds those while their parent is alive.
+//
+// The job does not kill its processes when guvnor exits, so they can be
+// adopted by the next guvnor as on other platforms.
+func trackPlatformProcess(pid int) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create job object: %w", err)
+	}
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("failed to open process %d: %w", pid, err)
+	}
+	defer windows.CloseHandle(process)
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return fmt.Errorf("failed to assign process %d to job object: %w", pid, err)
+	}
+
+	processJobsMu.Lock()
+	processJobs[pid] = job
+	processJobsMu.Unlock()
+	return nil
+}
+
+// releasePlatformProcess closes the Job Object of an exited process
+func releasePlatformProcess(pid int) {
+	processJobsMu.Lock()
+	job, exists := processJobs[pid]
+	delete(processJobs, pid)
+	processJobsMu.Unlock()
+	if exists {
+		windows.CloseHandle(job)
+	}
+}
+
+// terminateJob terminates every process in the Job Object of pid and reports
+// whether the process has one
+func terminateJob(pid int) bool {
+	processJobsMu.Lock()
+	job, exists := processJobs[pid]
+	processJobsMu.Unlock()
+	return exists && windows.TerminateJobObject(job, 1) == nil
+}
+
+// activateSocket fails; Windows processes cannot inherit listening sockets as descriptors
+func activateSocket(cmd *exec.Cmd, socket *os.File, name string) error {
+	return fmt.Errorf("socket_activation is not supported on Windows")
+}
+
+// killPlatformProcess kills a process and its descendants on Windows
 func killPlatformProcess(process *os.Process, pid int) {
-	// On Windows, just kill the process directly
-	// Process groups work differently, so we use the simpler approach
-	process.Kill()
-}
\ No newline at end of file
+	terminated := terminateJob(pid)
+	// Children that escaped the job are still found through their parent
+	if err := exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(pid)).Run(); err != nil && !terminated {
+		process.Kill()
+	}
+}
+
+// signalPlatformTree asks the process tree to stop. Windows has no signals:
+// os.Kill terminates the tree, anything else sends CTRL_BREAK_EVENT to the
+// console process group the process leads. Without a shared console (as when
+// guvnor runs as a service) the tree is asked to close with taskkill /T
+// instead, which console programs may refuse; the caller then kills the tree.
+func signalPlatformTree(process *os.Process, pid int, sig os.Signal) error {
+	if sig == os.Kill {
+		killPlatformProcess(process, pid)
+		return nil
+	}
+	if err := windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(pid)); err == nil {
+		return nil
+	}
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(pid)).Run()
+}
+
+// killPlatformGroup kills what is left of the Job Object of an exited process
+// and reports whether anything was left
+func killPlatformGroup(pid int) bool {
+	processJobsMu.Lock()
+	job, exists := processJobs[pid]
+	processJobsMu.Unlock()
+	if !exists {
+		return false
+	}
+
+	var info jobAccounting
+	err := windows.QueryInformationJobObject(job, windows.JobObjectBasicAccountingInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil)
+	if err != nil || info.ActiveProcesses == 0 {
+		return false
+	}
+	return windows.TerminateJobObject(job, 1) == nil
+}
+
+// platformAlive reports whether a process exists
+func platformAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
+
+// processExecutable returns the image a process runs
+func processExecutable(pid int) (string, error) {
+	handle, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return "", err
+	}
+	defer windows.CloseHandle(handle)
+
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(handle, 0, &buf[0], &size); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(buf[:size]), nil
+}
+
+// platformShell returns the command line that runs a shell snippet
+func platformShell(command string) (string, []string) {
+	return "cmd", []string{"/C", command}
+}
+
+// platformCoreDumped always reports false; Windows has no core dumps
+func platformCoreDumped(state *os.ProcessState) bool {
+	return false
+}
@@ -0,0 +1,144 @@
+//go:build windows
+
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ctrlBreakHelperEnv makes TestCtrlBreakHelper act as a process that exits
+// cleanly on CTRL_BREAK
+const ctrlBreakHelperEnv = "GUVNOR_CTRL_BREAK_HELPER"
+
+func TestCtrlBreakHelper(t *testing.T) {
+	if os.Getenv(ctrlBreakHelperEnv) != "1" {
+		return
+	}
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	fmt.Println("ready")
+	select {
+	case <-interrupts:
+		os.Exit(0)
+	case <-time.After(30 * time.Second):
+		os.Exit(2)
+	}
+}
+
+// activeInJob returns how many processes the Job Object of pid holds
+func activeInJob(t *testing.T, pid int) uint32 {
+	t.Helper()
+	processJobsMu.Lock()
+	job, exists := processJobs[pid]
+	processJobsMu.Unlock()
+	if !exists {
+		t.Fatalf("Expected process %d to have a job object", pid)
+	}
+	var info jobAccounting
+	err := windows.QueryInformationJobObject(job, windows.JobObjectBasicAccountingInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil)
+	if err != nil {
+		t.Fatalf("Failed to query job object: %v", err)
+	}
+	return info.ActiveProcesses
+}
+
+// waitExit waits for cmd to exit, killing it when it does not in time
+func waitExit(t *testing.T, cmd *exec.Cmd, timeout time.Duration) bool {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		<-done
+		return false
+	}
+}
+
+func TestTrackPlatformProcess(t *testing.T) {
+	cmd := exec.Command("ping", "-n", "30", "127.0.0.1")
+	setProcAttributes(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	if err := trackProcess(pid); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("trackProcess: %v", err)
+	}
+
+	if active := activeInJob(t, pid); active != 1 {
+		t.Errorf("Expected the process in its job object, %d active", active)
+	}
+	if !killPlatformGroup(pid) {
+		t.Error("Expected the running job to be terminated")
+	}
+	if !waitExit(t, cmd, 10*time.Second) {
+		t.Fatal("Expected terminating the job to stop the process")
+	}
+	if killPlatformGroup(pid) {
+		t.Error("Expected nothing left in the job once the process exited")
+	}
+
+	releaseProcess(pid)
+	processJobsMu.Lock()
+	_, exists := processJobs[pid]
+	processJobsMu.Unlock()
+	if exists {
+		t.Error("Expected the job object to be released")
+	}
+}
+
+func TestSignalPlatformTreeCtrlBreak(t *testing.T) {
+	// CTRL_BREAK only reaches processes sharing the console of guvnor
+	if window, _, _ := windows.NewLazySystemDLL("kernel32.dll").NewProc("GetConsoleWindow").Call(); window == 0 {
+		t.Skip("no console to send CTRL_BREAK through")
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCtrlBreakHelper$")
+	cmd.Env = append(os.Environ(), ctrlBreakHelperEnv+"=1")
+	setProcAttributes(cmd)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	pid := cmd.Process.Pid
+	if err := trackProcess(pid); err != nil {
+		t.Errorf("trackProcess: %v", err)
+	}
+	defer releaseProcess(pid)
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line == "" {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Fatalf("Helper did not start: %v", err)
+	}
+
+	if err := signalTree(cmd.Process, pid, getTermSignal()); err != nil {
+		t.Fatalf("signalTree: %v", err)
+	}
+	if !waitExit(t, cmd, 10*time.Second) {
+		t.Fatal("Expected the process to stop on CTRL_BREAK")
+	}
+	if code := cmd.ProcessState.ExitCode(); code != 0 {
+		t.Errorf("Expected a graceful exit, got exit code %d", code)
+	}
+}
@@ -0,0 +1,36 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// applyPriority sets the configured CPU and I/O priority and OOM score of a
+// started process. Like limits, they are applied right after start: nice and
+// ionice cover every thread of the process group, children forked before that
+// keep the old oom_score_adj.
+func applyPriority(pid int, app config.AppConfig) error {
+	var errs []error
+	if app.Nice != 0 {
+		if err := setPlatformNice(pid, app.Nice); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set nice: %w", err))
+		}
+	}
+	if app.IONice != "" {
+		class, level, err := config.ParseIONice(app.IONice)
+		if err == nil {
+			err = setPlatformIONice(pid, class, level)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set ionice: %w", err))
+		}
+	}
+	if app.OOMScoreAdj != 0 {
+		if err := setPlatformOOMScoreAdj(pid, app.OOMScoreAdj); err != nil {
+			errs = append(errs, fmt.Errorf("failed to set oom_score_adj: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
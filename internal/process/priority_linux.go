@@ -0,0 +1,51 @@
+//go:build linux
+
+package process
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// ioprio_set(2) constants, not exported by x/sys/unix
+const (
+	ioprioWhoPgrp    = 2
+	ioprioClassRT    = 1
+	ioprioClassBE    = 2
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// setPlatformNice sets the nice value of the process group led by pid. Unlike
+// PRIO_PROCESS, which only changes one thread, PRIO_PGRP covers all threads.
+// Raising the priority (a lower nice value) requires CAP_SYS_NICE.
+func setPlatformNice(pid int, nice int) error {
+	return unix.Setpriority(unix.PRIO_PGRP, pid, nice)
+}
+
+// setPlatformIONice sets the I/O scheduling class and level of the process
+// group led by pid. The realtime class requires CAP_SYS_ADMIN.
+func setPlatformIONice(pid int, class string, level int) error {
+	ioClass := ioprioClassBE
+	switch class {
+	case config.IONiceRealtime:
+		ioClass = ioprioClassRT
+	case config.IONiceIdle:
+		ioClass, level = ioprioClassIdle, 0
+	}
+	prio := ioClass<<ioprioClassShift | level
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoPgrp, uintptr(pid), uintptr(prio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setPlatformOOMScoreAdj sets how likely the kernel's OOM killer picks the
+// process. Values below the current one require CAP_SYS_RESOURCE.
+func setPlatformOOMScoreAdj(pid int, adj int) error {
+	return os.WriteFile("/proc/"+strconv.Itoa(pid)+"/oom_score_adj", []byte(strconv.Itoa(adj)), 0)
+}
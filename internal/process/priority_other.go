@@ -0,0 +1,23 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// setPlatformNice is only supported on Linux, where it covers all threads
+func setPlatformNice(pid int, nice int) error {
+	return fmt.Errorf("nice is not supported on %s", runtime.GOOS)
+}
+
+// setPlatformIONice is not supported: I/O classes are a Linux feature
+func setPlatformIONice(pid int, class string, level int) error {
+	return fmt.Errorf("ionice is not supported on %s", runtime.GOOS)
+}
+
+// setPlatformOOMScoreAdj is not supported: the OOM killer is a Linux feature
+func setPlatformOOMScoreAdj(pid int, adj int) error {
+	return fmt.Errorf("oom_score_adj is not supported on %s", runtime.GOOS)
+}
@@ -2,6 +2,16 @@ package process
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -51,4 +61,1183 @@ func TestManager_StopAll(t *testing.T) {
 	if err != nil {
 		t.Logf("StopAll error: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+func TestInstanceNames(t *testing.T) {
+	if name := InstanceName("web", 1); name != "web" {
+		t.Errorf("Expected web, got %s", name)
+	}
+	if name := InstanceName("web", 3); name != "web.3" {
+		t.Errorf("Expected web.3, got %s", name)
+	}
+
+	app, instance := parseInstanceName("web.3")
+	if app != "web" || instance != 3 {
+		t.Errorf("Expected web/3, got %s/%d", app, instance)
+	}
+	app, instance = parseInstanceName("api.v2")
+	if app != "api.v2" || instance != 1 {
+		t.Errorf("Expected api.v2/1, got %s/%d", app, instance)
+	}
+
+	if arg := replacePort("--port=8080", "8080", "8081"); arg != "--port=8081" {
+		t.Errorf("Unexpected port rewrite: %s", arg)
+	}
+	if arg := replacePort("80801", "8080", "8081"); arg != "80801" {
+		t.Errorf("Unexpected port rewrite: %s", arg)
+	}
+}
+
+func TestManager_ScaleToZero(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	ctx := context.Background()
+	defer manager.StopAll(ctx)
+
+	appConfig := config.AppConfig{Name: "worker", Command: "sleep", Args: []string{"30"}}
+	if err := manager.Scale(ctx, appConfig, 2); err != nil {
+		t.Fatalf("Failed to scale up: %v", err)
+	}
+	if err := manager.Scale(ctx, appConfig, 0); err != nil {
+		t.Fatalf("Failed to scale to 0: %v", err)
+	}
+
+	// The base instance stays known, stopped; the others are forgotten
+	instances := manager.GetInstances("worker")
+	if len(instances) != 1 || instances[0].Config.Name != "worker" || instances[0].IsRunning() {
+		t.Fatalf("Expected only the stopped base instance to be kept, got %d instances", len(instances))
+	}
+	if err := manager.Scale(ctx, appConfig, 1); err != nil || manager.InstanceCount("worker") != 1 {
+		t.Errorf("Expected the base instance to start again, got %d running (%v)", manager.InstanceCount("worker"), err)
+	}
+}
+
+func TestManager_Replace(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	ctx := context.Background()
+	appConfig := config.AppConfig{Name: "test-sleep", Command: "sleep", Args: []string{"30"}}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+
+	old, _ := manager.GetProcess("test-sleep")
+
+	// A replacement that never becomes ready leaves the old process in place
+	err := manager.Replace(ctx, "test-sleep", func(ctx context.Context, proc *Process) error {
+		return context.DeadlineExceeded
+	})
+	if err == nil {
+		t.Fatal("Expected error when replacement is not ready")
+	}
+	if current, _ := manager.GetProcess("test-sleep"); current != old || !old.IsRunning() {
+		t.Fatal("Expected old process to keep running")
+	}
+
+	if err := manager.Replace(ctx, "test-sleep", func(ctx context.Context, proc *Process) error { return nil }); err != nil {
+		t.Fatalf("Failed to replace process: %v", err)
+	}
+	current, _ := manager.GetProcess("test-sleep")
+	if current == old || !current.IsRunning() {
+		t.Error("Expected replacement to be running under the same name")
+	}
+	if old.IsRunning() {
+		t.Error("Expected old process to be stopped")
+	}
+}
+
+func TestProcess_StopSignal(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	ctx := context.Background()
+	appConfig := config.AppConfig{
+		Name:         "test-signal",
+		Command:      "sleep",
+		Args:         []string{"30"},
+		StopSignal:   "SIGINT",
+		StopTimeout:  2 * time.Second,
+		ReloadSignal: "SIGWINCH", // Ignored by sleep, so the process survives the reload
+	}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+
+	if err := manager.Reload(ctx, "test-signal"); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	proc, _ := manager.GetProcess("test-signal")
+	if !proc.IsRunning() {
+		t.Fatal("Expected process to survive reload")
+	}
+
+	start := time.Now()
+	if err := manager.Stop(ctx, "test-signal"); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if time.Since(start) >= appConfig.StopTimeout {
+		t.Error("Expected process to stop on SIGINT before the timeout")
+	}
+
+	if _, err := parseSignal("SIGBOGUS"); err == nil {
+		t.Error("Expected error for unknown signal")
+	}
+}
+
+func TestManager_SampleUsage(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	ctx := context.Background()
+	if err := manager.Start(ctx, config.AppConfig{Name: "test-usage", Command: "sleep", Args: []string{"30"}}); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+
+	proc, _ := manager.GetProcess("test-usage")
+	if _, ok := proc.GetUsage(); ok {
+		t.Fatal("Expected no usage before sampling")
+	}
+
+	if _, err := readUsage(proc.GetPID()); err == errUsageUnsupported {
+		t.Skip("Usage sampling not supported on this platform")
+	}
+	// A sample taken before the child has exec'd can report no RSS yet
+	var usage Usage
+	var ok bool
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		manager.SampleUsage()
+		if usage, ok = proc.GetUsage(); ok && usage.RSS > 0 {
+			break
+		}
+	}
+	if !ok || usage.RSS == 0 {
+		t.Errorf("Expected a usage sample with RSS, got %+v", usage)
+	}
+	if usage.CPUPercent < 0 {
+		t.Errorf("Expected non-negative CPU percentage, got %f", usage.CPUPercent)
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	policy := config.RestartPolicy{Backoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	for recent, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second} {
+		if got := restartDelay(policy, recent, 0.5); got != want {
+			t.Errorf("restartDelay(recent=%d) = %s, want %s", recent, got, want)
+		}
+	}
+
+	// Without max_backoff the delay stays fixed
+	if got := restartDelay(config.RestartPolicy{Backoff: time.Second}, 5, 0.5); got != time.Second {
+		t.Errorf("Expected fixed backoff, got %s", got)
+	}
+
+	policy.Jitter = 0.5
+	if low, high := restartDelay(policy, 0, 0), restartDelay(policy, 0, 1); low != 500*time.Millisecond || high != 1500*time.Millisecond {
+		t.Errorf("Expected jitter to span 500ms-1.5s, got %s-%s", low, high)
+	}
+}
+
+func TestProcess_CrashLoop(t *testing.T) {
+	logger := logrus.New()
+	proc := &Process{
+		Config: config.AppConfig{RestartPolicy: config.RestartPolicy{
+			Enabled:    true,
+			MaxRetries: -1,
+			Backoff:    time.Second,
+			CrashLoop:  config.CrashLoopConfig{MaxRestarts: 3, Window: time.Minute},
+		}},
+		logger: logger.WithField("test", true),
+	}
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, ok := proc.nextRestart(now); !ok {
+			t.Fatalf("Expected restart %d to be allowed", i+1)
+		}
+	}
+	if _, ok := proc.nextRestart(now); ok || proc.GetStatus() != StatusCrashLoop {
+		t.Fatalf("Expected crash loop after 3 restarts, status %s", proc.GetStatus())
+	}
+
+	// Restarts age out of the window
+	if _, ok := proc.nextRestart(now.Add(2 * time.Minute)); !ok {
+		t.Error("Expected restart to be allowed once the window has passed")
+	}
+
+	proc.ResetRestarts()
+	if proc.GetRestartCount() != 0 || len(proc.restartTimes) != 0 {
+		t.Error("Expected reset to clear restart history")
+	}
+}
+
+func TestEnhancedManager_RunJob(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewEnhancedManager(logger, 100)
+
+	ctx := context.Background()
+	job := config.AppConfig{
+		Name:          "migrate",
+		Type:          config.AppTypeOneshot,
+		Command:       "sh",
+		Args:          []string{"-c", "echo migrated; echo warning >&2; printf done"},
+		RestartPolicy: config.RestartPolicy{Enabled: true, MaxRetries: 3},
+	}
+	if exitCode, err := manager.RunJob(ctx, job); err != nil || exitCode != 0 {
+		t.Fatalf("Expected job to succeed, got exit code %d: %v", exitCode, err)
+	}
+
+	proc, _ := manager.GetProcess("migrate")
+	if proc.GetStatus() != StatusCompleted {
+		t.Errorf("Expected status %s, got %s", StatusCompleted, proc.GetStatus())
+	}
+
+	captured := make(map[string]string)
+	for _, entry := range manager.GetLogManager().GetProcessLogs("migrate", 100) {
+		captured[entry.Message] = entry.Level + "/" + entry.Stream
+	}
+	for line, level := range map[string]string{"migrated": "info/stdout", "warning": "warn/stderr", "done": "info/stdout"} {
+		if captured[line] != level {
+			t.Errorf("Expected output %q logged as %s, got %q", line, level, captured[line])
+		}
+	}
+
+	job.Args = []string{"-c", "exit 3"}
+	if exitCode, err := manager.RunJob(ctx, job); err == nil || exitCode != 3 {
+		t.Fatalf("Expected exit code 3 and an error, got %d: %v", exitCode, err)
+	}
+	proc, _ = manager.GetProcess("migrate")
+	if proc.GetStatus() != StatusFailed || proc.GetRestartCount() != 0 {
+		t.Errorf("Expected failed job without restarts, got %s after %d restarts", proc.GetStatus(), proc.GetRestartCount())
+	}
+}
+
+func TestProcess_LifecycleHooks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	manager := NewManager(logger)
+
+	dir := t.TempDir()
+	trace := filepath.Join(dir, "trace")
+	record := func(name string) config.HookConfig {
+		return config.HookConfig{Command: "echo " + name + " $GUVNOR_HOOK >> " + trace}
+	}
+
+	ctx := context.Background()
+	appConfig := config.AppConfig{
+		Name:    "test-hooks",
+		Command: "sleep",
+		Args:    []string{"30"},
+		Hooks: config.HooksConfig{
+			PreStart:  record("pre"),
+			PostStart: record("post"),
+			PreStop:   record("pre"),
+			PostStop:  record("post"),
+		},
+	}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	if err := manager.Stop(ctx, "test-hooks"); err != nil {
+		t.Fatalf("Failed to stop process: %v", err)
+	}
+
+	data, _ := os.ReadFile(trace)
+	expected := "pre pre_start\npost post_start\npre pre_stop\npost post_stop\n"
+	if string(data) != expected {
+		t.Errorf("Expected hooks in order %q, got %q", expected, data)
+	}
+
+	// A failing pre_start hook that aborts keeps the process from starting
+	appConfig.Hooks = config.HooksConfig{PreStart: config.HookConfig{Command: "exit 1", AbortOnFailure: true}}
+	if err := manager.Start(ctx, appConfig); err == nil || !strings.Contains(err.Error(), "pre_start") {
+		t.Fatalf("Expected pre_start hook error, got %v", err)
+	}
+	proc, _ := manager.GetProcess("test-hooks")
+	if proc.IsRunning() || proc.GetStatus() != StatusFailed {
+		t.Errorf("Expected process not to start, got status %s", proc.GetStatus())
+	}
+
+	// A failing pre_stop hook that aborts keeps the process running
+	appConfig.Hooks = config.HooksConfig{PreStop: config.HookConfig{Command: "sleep 5", Timeout: 50 * time.Millisecond, AbortOnFailure: true}}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+	proc, _ = manager.GetProcess("test-hooks")
+	if err := proc.Stop(ctx); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected pre_stop hook timeout, got %v", err)
+	}
+	if !proc.IsRunning() {
+		t.Error("Expected process to keep running after an aborted stop")
+	}
+	proc.halt(ctx)
+}
+
+func TestExpandCorePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		usesPID bool
+		want    string
+	}{
+		{"core", false, "core"},
+		{"core", true, "core.42"},
+		{"/var/crash/core.%e.%p.%t", true, "/var/crash/core.a-very-long-com.42.*"},
+		{"core-%h-%%", false, "core-box-%"},
+	}
+	for _, tt := range tests {
+		if got := expandCorePattern(tt.pattern, 42, "a-very-long-command", "box", tt.usesPID); got != tt.want {
+			t.Errorf("expandCorePattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestProcess_CoreDump(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only applied on Linux")
+	}
+	if pattern, _ := corePattern(); strings.HasPrefix(pattern, "|") {
+		t.Skip("core dumps are handed to a crash handler")
+	}
+
+	dir := t.TempDir()
+	coreDir := filepath.Join(dir, "cores")
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	// Give guvnor time to raise the core limit before the shell aborts itself
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:       "crasher",
+		Command:    "/bin/sh",
+		Args:       []string{"-c", "sleep 0.3; kill -ABRT $$"},
+		WorkingDir: dir,
+		Limits:     config.LimitsConfig{Core: "unlimited", CoreDir: coreDir},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("crasher")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for proc.CoreDump() == "" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	core := proc.CoreDump()
+	if core == "" {
+		t.Skip("no core dump was written in this environment")
+	}
+	if filepath.Dir(core) != coreDir {
+		t.Errorf("Expected core in %s, got %s", coreDir, core)
+	}
+	if _, err := os.Stat(core); err != nil {
+		t.Errorf("Core dump missing: %v", err)
+	}
+}
+
+func TestDockerClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/containers/abc/wait":
+			w.Write([]byte(`{"StatusCode":137}`))
+		case "/containers/abc/logs":
+			frame := func(stream byte, payload string) []byte {
+				header := []byte{stream, 0, 0, 0, 0, 0, 0, byte(len(payload))}
+				return append(header, payload...)
+			}
+			w.Write(append(frame(1, "out\n"), frame(2, "err\n")...))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"no such container"}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("DOCKER_HOST", "tcp://"+srv.Listener.Addr().String())
+
+	docker, err := newDockerClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	ctx := context.Background()
+
+	if code, err := docker.waitContainer(ctx, "abc"); err != nil || code != 137 {
+		t.Errorf("Expected exit code 137, got %d (%v)", code, err)
+	}
+
+	var stdout, stderr strings.Builder
+	if err := docker.followLogs(ctx, "abc", &stdout, &stderr); err != nil {
+		t.Fatalf("Failed to read logs: %v", err)
+	}
+	if stdout.String() != "out\n" || stderr.String() != "err\n" {
+		t.Errorf("Unexpected demuxed logs %q / %q", stdout.String(), stderr.String())
+	}
+
+	if err := docker.startContainer(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "no such container") {
+		t.Errorf("Expected API error message, got %v", err)
+	}
+}
+
+func TestProcess_ContainerSpec(t *testing.T) {
+	proc := &Process{Config: config.AppConfig{
+		Name:       "web",
+		Command:    "bundle",
+		Args:       []string{"exec", "puma"},
+		Port:       3000,
+		WorkingDir: "/srv/web",
+		Limits:     config.LimitsConfig{NoFile: "4096"},
+		Container: config.ContainerConfig{
+			Image:      "ruby:3.3",
+			Volumes:    []string{"./data:/data", "cache:/cache:ro"},
+			Network:    "backend",
+			HostConfig: map[string]interface{}{"NetworkMode": "host", "Memory": 512},
+		},
+	}}
+
+	spec := proc.containerSpec("ruby:3.3")
+	if strings.Join(spec.Cmd, " ") != "bundle exec puma" {
+		t.Errorf("Unexpected command %v", spec.Cmd)
+	}
+	binds, _ := spec.HostConfig["Binds"].([]string)
+	if len(binds) != 2 || binds[0] != "/srv/web/data:/data" || binds[1] != "cache:/cache:ro" {
+		t.Errorf("Unexpected binds %v", binds)
+	}
+	if spec.HostConfig["NetworkMode"] != "host" || spec.HostConfig["Memory"] != 512 {
+		t.Errorf("Expected host_config to override, got %v", spec.HostConfig)
+	}
+	if _, ok := spec.ExposedPorts["3000/tcp"]; !ok {
+		t.Error("Expected port 3000 to be exposed")
+	}
+	if spec.HostConfig["Ulimits"] == nil {
+		t.Error("Expected nofile ulimit")
+	}
+}
+
+func TestNerdctlCreateArgs(t *testing.T) {
+	proc := &Process{Config: config.AppConfig{
+		Name:       "web",
+		Command:    "bundle",
+		Args:       []string{"exec", "puma"},
+		Port:       3000,
+		Limits:     config.LimitsConfig{NoFile: "4096"},
+		Container: config.ContainerConfig{
+			Image:   "ruby:3.3",
+			Volumes: []string{"cache:/cache:ro"},
+		},
+	}}
+
+	args, err := nerdctlCreateArgs("guvnor-web", proc.containerSpec("ruby:3.3"))
+	if err != nil {
+		t.Fatalf("Failed to translate spec: %v", err)
+	}
+	got := strings.Join(args, " ")
+	for _, want := range []string{"--name guvnor-web", "--publish 3000:3000/tcp", "--volume cache:/cache:ro", "--ulimit nofile=4096:4096", "ruby:3.3 bundle exec puma"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in %q", want, got)
+		}
+	}
+
+	proc.Config.Container.HostConfig = map[string]interface{}{"SecurityOpt": []interface{}{"seccomp=unconfined"}}
+	if _, err := nerdctlCreateArgs("guvnor-web", proc.containerSpec("ruby:3.3")); err == nil {
+		t.Error("Expected unsupported host_config to be refused")
+	}
+}
+
+func TestProcess_Tree(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("process trees are only listed on Linux and macOS")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	// The background child ignores SIGTERM, so it outlives the shell on stop
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:        "tree",
+		Command:     "/bin/sh",
+		Args:        []string{"-c", "(trap '' TERM; sleep 60) & wait"},
+		StopTimeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	proc, _ := manager.GetProcess("tree")
+
+	var children []int
+	for deadline := time.Now().Add(2 * time.Second); len(children) == 0 && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		children = treePIDs(proc.GetPID())
+	}
+	if len(children) == 0 {
+		t.Fatal("Expected the shell to have children")
+	}
+
+	manager.SampleUsage()
+	usage, ok := proc.GetUsage()
+	if !ok || len(usage.Children) == 0 || usage.TreeRSS < usage.RSS {
+		t.Errorf("Expected child usage in sample, got %+v", usage)
+	}
+
+	if err := manager.Stop(context.Background(), "tree"); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+
+	// SIGKILL is delivered asynchronously
+	for _, pid := range children {
+		for deadline := time.Now().Add(time.Second); platformAlive(pid) && time.Now().Before(deadline); {
+			time.Sleep(20 * time.Millisecond)
+		}
+		if platformAlive(pid) {
+			t.Errorf("Child %d survived stop", pid)
+		}
+	}
+}
+
+func TestManager_RecoverState(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sleep")
+	}
+	t.Setenv("TMPDIR", t.TempDir())
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	ctx := context.Background()
+	appConfig := config.AppConfig{
+		Name:        "sleeper",
+		Command:     "sleep",
+		Args:        []string{"30"},
+		Port:        9123,
+		Environment: map[string]string{"MODE": "test"},
+		StopTimeout: time.Second,
+	}
+
+	first := NewManager(logger)
+	if err := first.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	original, _ := first.GetProcess("sleeper")
+
+	// A new manager, as after a guvnor crash, takes the process over with its config
+	second := NewManager(logger)
+	recovered, ok := second.GetProcess("sleeper")
+	if !ok || !recovered.IsRunning() || recovered.GetPID() != original.GetPID() {
+		t.Fatalf("Expected running process %d to be recovered", original.GetPID())
+	}
+	if recovered.Config.Port != 9123 || recovered.Config.Environment["MODE"] != "test" {
+		t.Errorf("Expected full config to be recovered, got %+v", recovered.Config)
+	}
+
+	// Starting with the same config adopts it instead of failing as already running
+	if err := second.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Expected recovered process to be adopted: %v", err)
+	}
+	if proc, _ := second.GetProcess("sleeper"); proc.GetPID() != original.GetPID() {
+		t.Error("Expected the adopted process to be kept")
+	}
+
+	// A changed command replaces it
+	second.mu.Lock()
+	second.processes["sleeper"].adopted = true
+	second.mu.Unlock()
+	appConfig.Args = []string{"31"}
+	if err := second.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to replace recovered process: %v", err)
+	}
+	replaced, _ := second.GetProcess("sleeper")
+	if replaced.GetPID() == original.GetPID() || !replaced.IsRunning() {
+		t.Error("Expected the recovered process to be replaced")
+	}
+
+	second.StopAll(ctx)
+}
+
+func TestManager_Orphans(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil || runtime.GOOS != "linux" {
+		t.Skip("needs setsid on Linux")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	// The shell exits once sleep has moved to a session of its own, out of reach
+	// of the process group cleanup, leaving it reparented away from guvnor
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:    "forker",
+		Command: "/bin/sh",
+		Args:    []string{"-c", "setsid sleep 60 & sleep 0.5"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	var orphans []Orphan
+	for deadline := time.Now().Add(5 * time.Second); len(orphans) == 0 && time.Now().Before(deadline); {
+		time.Sleep(50 * time.Millisecond)
+		if orphans, err = manager.Orphans(); err != nil {
+			t.Fatalf("Failed to list orphans: %v", err)
+		}
+	}
+	if len(orphans) != 1 || orphans[0].Process != "forker" || !strings.Contains(orphans[0].Command, "sleep") {
+		t.Fatalf("Expected the sleep to be an orphan of forker, got %+v", orphans)
+	}
+
+	killed, err := manager.KillOrphans()
+	if err != nil || len(killed) != 1 {
+		t.Fatalf("Expected one orphan killed, got %+v (%v)", killed, err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); platformAlive(killed[0].PID) && !isZombie(killed[0].PID); {
+		if time.Now().After(deadline) {
+			t.Fatal("Orphan still alive after kill")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestManager_WorkingDirDotEnv(t *testing.T) {
+	dir := t.TempDir()
+	dotEnv := "GUVNOR_TEST_GREETING=hello\nGUVNOR_TEST_OVERRIDE=dotenv\n"
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte(dotEnv), 0644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:        "other-service",
+		Command:     "/bin/sh",
+		Args:        []string{"-c", `echo "$GUVNOR_TEST_GREETING $GUVNOR_TEST_OVERRIDE" > out.txt`},
+		WorkingDir:  dir,
+		Environment: map[string]string{"GUVNOR_TEST_OVERRIDE": "config"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("other-service")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	// .env values apply, the app's environment wins over them
+	if got := strings.TrimSpace(string(out)); got != "hello config" {
+		t.Errorf("Expected %q, got %q", "hello config", got)
+	}
+}
+
+func TestManager_EnvFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("GUVNOR_TEST_A=dotenv\nGUVNOR_TEST_B=dotenv\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	envFile := filepath.Join(dir, "staging.env")
+	if err := os.WriteFile(envFile, []byte("GUVNOR_TEST_B=staging\nGUVNOR_TEST_C=staging\n"), 0644); err != nil {
+		t.Fatalf("Failed to write env_file: %v", err)
+	}
+	// .env files never override guvnor's environment, env_file entries do
+	t.Setenv("GUVNOR_TEST_A", "os")
+	t.Setenv("GUVNOR_TEST_C", "os")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:       "env-file",
+		Command:    "/bin/sh",
+		Args:       []string{"-c", `echo "$GUVNOR_TEST_A $GUVNOR_TEST_B $GUVNOR_TEST_C" > out.txt`},
+		WorkingDir: dir,
+		EnvFile:    config.StringList{envFile},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("env-file")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "os staging staging" {
+		t.Errorf("Expected %q, got %q", "os staging staging", got)
+	}
+
+	err = manager.Start(context.Background(), config.AppConfig{
+		Name:    "env-file-missing",
+		Command: "/bin/true",
+		EnvFile: config.StringList{filepath.Join(dir, "missing.env")},
+	})
+	if err == nil {
+		t.Error("Expected a missing env_file to fail the start")
+	}
+}
+
+func TestManager_Shell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+	dir := t.TempDir()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:       "piped",
+		Command:    "GREETING=hello sh -c 'echo $GREETING world' | tr a-z A-Z",
+		Args:       []string{"> out.txt"},
+		Shell:      true,
+		WorkingDir: dir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("piped")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "HELLO WORLD" {
+		t.Errorf("Expected %q, got %q", "HELLO WORLD", got)
+	}
+}
+
+func TestManager_EnvironmentReferences(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("DB_USER=app\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .env: %v", err)
+	}
+	secretFile := filepath.Join(dir, "db_password")
+	if err := os.WriteFile(secretFile, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+	t.Setenv("GUVNOR_TEST_DB_HOST", "db.internal")
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	appConfig := config.AppConfig{
+		Name:    "env-refs",
+		Command: "/bin/sh",
+		Args:    []string{"-c", `echo "$DATABASE_URL $DB_PASSWORD $PRICE" > out.txt`},
+		Environment: map[string]string{
+			"DATABASE_URL": "postgres://${DB_USER}@${GUVNOR_TEST_DB_HOST}/${DB_NAME:-app_dev}",
+			"DB_PASSWORD":  "secret://file" + secretFile,
+			"PRICE":        "$5 $${literal}",
+		},
+		WorkingDir: dir,
+	}
+	if err := manager.Start(context.Background(), appConfig); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("env-refs")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	out, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	want := "postgres://app@db.internal/app_dev s3cret $5 ${literal}"
+	if got := strings.TrimSpace(string(out)); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	appConfig.Name = "env-missing"
+	appConfig.Environment = map[string]string{"API_KEY": "${GUVNOR_TEST_UNSET}"}
+	if err := manager.Start(context.Background(), appConfig); err == nil || !strings.Contains(err.Error(), "GUVNOR_TEST_UNSET") {
+		t.Errorf("Expected an unset variable to fail the start, got %v", err)
+	}
+}
+
+func TestManager_SocketActivation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket activation is not supported on Windows")
+	}
+
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	port := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	dir := t.TempDir()
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	err = manager.Start(context.Background(), config.AppConfig{
+		Name:             "activated",
+		Command:          "/bin/sh",
+		Args:             []string{"-c", `[ -S /dev/fd/3 ] && echo "$LISTEN_FDS $LISTEN_FDNAMES $(( LISTEN_PID == $$ ))" > out.txt; exec sleep 30`},
+		WorkingDir:       dir,
+		Port:             port,
+		SocketActivation: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	proc, _ := manager.GetProcess("activated")
+	defer manager.StopAll(context.Background())
+
+	var out []byte
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if out, _ = os.ReadFile(filepath.Join(dir, "out.txt")); len(out) > 0 {
+			break
+		}
+	}
+	if got := strings.TrimSpace(string(out)); got != "1 activated 1" {
+		t.Fatalf("Expected the socket as fd 3 with LISTEN_PID set to the app, got %q", got)
+	}
+
+	// The socket stays bound across a restart, connections wait in the backlog
+	socket := proc.socket
+	if err := proc.Restart(context.Background()); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	if proc.socket != socket {
+		t.Error("Expected the restarted process to get the same socket")
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), time.Second)
+	if err != nil {
+		t.Fatalf("Expected the port to accept connections while held by guvnor: %v", err)
+	}
+	conn.Close()
+
+	// Stopping the app releases the port
+	if err := proc.Stop(context.Background()); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if !portAvailable(port) {
+		t.Error("Expected the port to be released after stopping")
+	}
+}
+
+func TestManager_LifecycleEvents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Uses sh")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	events, unsubscribe := manager.Subscribe()
+	defer unsubscribe()
+
+	ctx := context.Background()
+	appConfig := config.AppConfig{
+		Name:          "events-crasher",
+		Command:       "sh",
+		Args:          []string{"-c", "exit 3"},
+		RestartPolicy: config.RestartPolicy{Enabled: true, MaxRetries: 1, Backoff: 50 * time.Millisecond},
+	}
+	if err := manager.Start(ctx, appConfig); err != nil {
+		t.Fatalf("Failed to start process: %v", err)
+	}
+	defer manager.StopAll(ctx)
+
+	seen := make(map[string]Event)
+	var order []string
+	deadline := time.After(5 * time.Second)
+	for seen[EventFailed].Type == "" {
+		select {
+		case e := <-events:
+			if e.Name != appConfig.Name {
+				continue
+			}
+			order = append(order, e.Type)
+			seen[e.Type] = e
+		case <-deadline:
+			t.Fatalf("Timed out waiting for the process to give up, got %v", order)
+		}
+	}
+
+	if len(order) < 3 || order[0] != EventAdded || order[1] != EventStarted || order[2] != EventCrashed {
+		t.Errorf("Expected added, started and crashed first, got %v", order)
+	}
+	if code := seen[EventCrashed].Fields["exit_code"]; code != "3" {
+		t.Errorf("Expected the crash to carry exit code 3, got %q", code)
+	}
+	if _, restarted := seen[EventRestarted]; !restarted {
+		t.Errorf("Expected a restart before giving up, got %v", order)
+	}
+	if restarts := seen[EventFailed].Fields["restarts"]; restarts != "1" {
+		t.Errorf("Expected to give up after 1 restart, got %q", restarts)
+	}
+}
+
+func TestManager_Priority(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("scheduling priorities are only applied on Linux")
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	defer manager.StopAll(context.Background())
+
+	// Lowering the priority and raising the OOM score need no privileges
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:        "background",
+		Command:     "sleep",
+		Args:        []string{"10"},
+		Nice:        15,
+		IONice:      "idle",
+		OOMScoreAdj: 500,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("background")
+	pid := proc.GetPID()
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		t.Fatalf("Failed to read stat: %v", err)
+	}
+	// Fields after the command name, which may contain spaces; nice is field 19
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+2:]))
+	if fields[16] != "15" {
+		t.Errorf("Expected nice 15, got %s", fields[16])
+	}
+
+	adj, err := os.ReadFile(fmt.Sprintf("/proc/%d/oom_score_adj", pid))
+	if err != nil {
+		t.Fatalf("Failed to read oom_score_adj: %v", err)
+	}
+	if got := strings.TrimSpace(string(adj)); got != "500" {
+		t.Errorf("Expected oom_score_adj 500, got %s", got)
+	}
+}
+
+func TestManager_Sandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is only supported on Linux")
+	}
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+
+	sandbox := config.SandboxConfig{NoNewPrivileges: true, Seccomp: config.SeccompDefault}
+	script := `grep -E '^(NoNewPrivs|Seccomp|CapEff):' /proc/self/status > data/status; unshare -m true 2> /dev/null && echo unshared >> data/status`
+	root := os.Geteuid() == 0
+	if root {
+		sandbox.ReadOnly = true
+		sandbox.Writable = []string{"data"}
+		sandbox.DropCapabilities = true
+		sandbox.Capabilities = []string{"NET_BIND_SERVICE"}
+		script += `; touch blocked 2> /dev/null && echo writable >> data/status`
+	}
+
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:       "jailed",
+		Command:    "/bin/sh",
+		Args:       []string{"-c", script},
+		WorkingDir: dir,
+		Sandbox:    sandbox,
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+
+	proc, _ := manager.GetProcess("jailed")
+	select {
+	case <-proc.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Process did not exit")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "data", "status"))
+	if err != nil {
+		if root {
+			t.Skipf("mounts are not available in this environment: %v", err)
+		}
+		t.Fatalf("Failed to read status: %v", err)
+	}
+	status := string(data)
+	for _, want := range []string{"NoNewPrivs:\t1", "Seccomp:\t2"} {
+		if !strings.Contains(status, want) {
+			t.Errorf("Expected %q in status:\n%s", want, status)
+		}
+	}
+	if strings.Contains(status, "unshared") {
+		t.Error("Expected unshare to be blocked by seccomp")
+	}
+	if root {
+		// Only CAP_NET_BIND_SERVICE (bit 10) is left
+		if !strings.Contains(status, "CapEff:\t0000000000000400") {
+			t.Errorf("Expected capabilities to be dropped:\n%s", status)
+		}
+		if strings.Contains(status, "writable") {
+			t.Error("Expected working_dir to be read-only")
+		}
+	}
+}
+
+func TestManager_DeployMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses POSIX shell syntax")
+	}
+	dir := t.TempDir()
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	manager := NewManager(logger)
+	defer manager.StopAll(context.Background())
+
+	err := manager.Start(context.Background(), config.AppConfig{
+		Name:          "flaky",
+		Command:       "/bin/sh",
+		Args:          []string{"-c", "echo run >> runs; sleep 0.2; exit 1"},
+		WorkingDir:    dir,
+		RestartPolicy: config.RestartPolicy{Enabled: true, MaxRetries: -1, Backoff: 10 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	if _, err := manager.BeginDeploy("flaky", time.Minute, "testing"); err != nil {
+		t.Fatalf("Failed to begin deploy mode: %v", err)
+	}
+	if _, err := manager.BeginDeploy("missing", time.Minute, ""); err == nil {
+		t.Error("Expected deploy mode of an unknown app to fail")
+	}
+
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "runs"))
+		return strings.Count(string(data), "run")
+	}
+
+	// The crash is not restarted while in deploy mode
+	time.Sleep(time.Second)
+	if n := runs(); n != 1 {
+		t.Fatalf("Expected 1 run during deploy mode, got %d", n)
+	}
+	if deploys := manager.Deploys(); len(deploys) != 1 || deploys[0].Reason != "testing" {
+		t.Errorf("Expected flaky in deploy mode, got %+v", deploys)
+	}
+
+	// Ending it restarts the crashed process
+	if _, ended := manager.EndDeploy("flaky"); !ended {
+		t.Fatal("Expected deploy mode to end")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runs() < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := runs(); n < 2 {
+		t.Errorf("Expected a restart after deploy mode ended, got %d runs", n)
+	}
+	if manager.InDeploy("flaky") {
+		t.Error("Expected deploy mode to be over")
+	}
+}
+
+func TestCommand_Environment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("HOST=db\nMODE=dotenv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := config.AppConfig{
+		Name:        "web",
+		WorkingDir:  dir,
+		Environment: map[string]string{"MODE": "app", "DATABASE_URL": "postgres://${HOST}/x"},
+	}
+	cmd, err := Command(context.Background(), app, nil, []string{"sh", "-c", `echo "$MODE $DATABASE_URL $(pwd)"`})
+	if err != nil {
+		t.Fatalf("Command failed: %v", err)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Command did not run: %v", err)
+	}
+	wd, _ := filepath.EvalSymlinks(dir)
+	if got, want := strings.TrimSpace(string(out)), "app postgres://db/x "+wd; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("HOST=db\nMODE=dotenv\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	app := config.AppConfig{
+		Name:       "web",
+		WorkingDir: dir,
+		Environment: map[string]string{
+			"MODE":         "app",
+			"DATABASE_URL": "postgres://${HOST}/x",
+			"API_KEY":      "secret://env/UNSET_API_KEY",
+		},
+	}
+	env, err := Environment(app)
+	if err != nil {
+		t.Fatalf("Environment failed: %v", err)
+	}
+	want := map[string]string{
+		"HOST":         "db",
+		"MODE":         "app",
+		"DATABASE_URL": "postgres://db/x",
+		"API_KEY":      "secret://env/UNSET_API_KEY", // Not looked up
+	}
+	if !reflect.DeepEqual(env, want) {
+		t.Errorf("Expected %v, got %v", want, env)
+	}
+}
@@ -0,0 +1,73 @@
+package process
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReadyFunc blocks until a freshly started replacement is ready for traffic
+type ReadyFunc func(ctx context.Context, proc *Process) error
+
+// Replace performs a zero-downtime restart of a single process: a replacement is
+// started on a fresh port, and only once ready does it take over the process name
+// (and therefore proxy routing) before the old process is stopped.
+func (m *Manager) Replace(ctx context.Context, name string, ready ReadyFunc) error {
+	m.mu.RLock()
+	old, exists := m.processes[name]
+	m.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("process %s not found", name)
+	}
+
+	cfg := old.Config
+	if cfg.Port > 0 {
+		port, err := m.allocatePort(cfg.Port)
+		if err != nil {
+			return fmt.Errorf("failed to allocate port for %s: %w", name, err)
+		}
+		cfg = withPort(cfg, cfg.Port, port)
+	}
+
+	// The replacement stays out of the process table (and out of routing) until ready
+	next := m.newProcess(cfg)
+	next.app, next.instance = old.AppName(), old.Instance()
+	next.pidFile = ""
+
+	logger := m.logger.WithField("app", name)
+	logger.WithField("port", cfg.Port).Info("Starting replacement process")
+
+	if err := next.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start replacement for %s: %w", name, err)
+	}
+
+	if err := ready(ctx, next); err != nil {
+		logger.WithError(err).Warn("Replacement did not become ready, keeping old process")
+		next.Stop(context.Background())
+		return fmt.Errorf("replacement for %s not ready: %w", name, err)
+	}
+
+	// Switch routing to the replacement, then retire the old process
+	m.mu.Lock()
+	m.processes[name] = next
+	m.mu.Unlock()
+	m.publish(EventAdded, next, nil)
+
+	logger.WithField("port", cfg.Port).Info("Switched traffic to replacement process")
+
+	if err := old.Stop(ctx); err != nil {
+		logger.WithError(err).Warn("Failed to stop old process after rolling restart")
+	}
+
+	// The old process removed the shared PID file on exit
+	next.mu.Lock()
+	next.pidFile = old.pidFile
+	next.mu.Unlock()
+	if err := next.writePidFile(); err != nil {
+		logger.WithError(err).Warn("Failed to write PID file")
+	}
+
+	next.notifyRestart()
+	next.emit(EventRestarted, map[string]string{"rolling": "true"})
+	return nil
+}
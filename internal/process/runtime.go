@@ -0,0 +1,103 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// containerRuntime runs the containers of container-mode apps
+type containerRuntime interface {
+	runtimeName() string
+	ping(ctx context.Context) error
+	imageExists(ctx context.Context, image string) (bool, error)
+	pullImage(ctx context.Context, image string, progress func(string)) error
+	buildImage(ctx context.Context, contextDir, dockerfile, tag string, progress func(string)) error
+	// createContainer creates a stopped container and returns its ID
+	createContainer(ctx context.Context, name string, spec containerSpec) (string, error)
+	startContainer(ctx context.Context, id string) error
+	// waitContainer blocks until the container exits and returns its exit code
+	waitContainer(ctx context.Context, id string) (int, error)
+	// stopContainer sends signal (the image's stop signal if empty) and kills after timeout
+	stopContainer(ctx context.Context, id, signal string, timeout time.Duration) error
+	killContainer(ctx context.Context, id, signal string) error
+	// removeContainer force-removes a container; a missing container is not an error
+	removeContainer(ctx context.Context, id string) error
+	// containerPID returns the host PID of the container's main process
+	containerPID(ctx context.Context, id string) (int, error)
+	// followLogs copies the container's stdout and stderr until it exits
+	followLogs(ctx context.Context, id string, stdout, stderr io.Writer) error
+	// execCommand returns a command running argv inside a running container,
+	// with a terminal allocated when tty is set
+	execCommand(id string, tty bool, argv []string) (*exec.Cmd, error)
+}
+
+// execArgs are the exec arguments shared by the docker, podman and nerdctl CLIs
+func execArgs(id string, tty bool) []string {
+	args := []string{"exec", "--interactive"}
+	if tty {
+		args = append(args, "--tty")
+	}
+	return append(args, id)
+}
+
+// newContainerRuntime creates the client of one runtime without checking it responds
+func newContainerRuntime(cfg config.ExecutionConfig, name string) (containerRuntime, error) {
+	switch name {
+	case config.RuntimeDocker:
+		if cfg.Socket != "" {
+			return newAPIClient(name, cfg.Socket)
+		}
+		return newDockerClient()
+	case config.RuntimePodman:
+		if cfg.Socket != "" {
+			return newAPIClient(name, cfg.Socket)
+		}
+		return newPodmanClient()
+	case config.RuntimeContainerd:
+		return newNerdctlClient(cfg.Socket, cfg.Namespace)
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q", name)
+	}
+}
+
+// DetectContainerRuntime returns the name of the runtime container apps run
+// on, or why none responds
+func DetectContainerRuntime(ctx context.Context, cfg config.ExecutionConfig) (string, error) {
+	runtime, err := detectContainerRuntime(ctx, cfg)
+	if err != nil {
+		return "", err
+	}
+	return runtime.runtimeName(), nil
+}
+
+// detectContainerRuntime returns the configured runtime, or with auto the
+// first of docker, podman and containerd that responds
+func detectContainerRuntime(ctx context.Context, cfg config.ExecutionConfig) (containerRuntime, error) {
+	candidates := []string{cfg.Runtime}
+	if cfg.Runtime == "" || cfg.Runtime == config.RuntimeAuto {
+		candidates = []string{config.RuntimeDocker, config.RuntimePodman, config.RuntimeContainerd}
+	}
+
+	var errs []error
+	for _, name := range candidates {
+		runtime, err := newContainerRuntime(cfg, name)
+		if err == nil {
+			pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			err = runtime.ping(pingCtx)
+			cancel()
+		}
+		if err == nil {
+			return runtime, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", name, err))
+	}
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("no container runtime available: %v", errs)
+}
@@ -0,0 +1,95 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// sandboxEnv passes the sandbox of a process to the copy of guvnor that sets
+// it up and then replaces itself with the app (see sandbox_linux.go)
+const sandboxEnv = "GUVNOR_SANDBOX"
+
+// sandboxSpec is the sandbox the helper applies before running the app
+type sandboxSpec struct {
+	Chroot           string   `json:"chroot,omitempty"`
+	Dir              string   `json:"dir,omitempty"`       // Working directory inside the chroot
+	ReadOnly         string   `json:"read_only,omitempty"` // Directory mounted read-only
+	Writable         []string `json:"writable,omitempty"`  // Absolute paths kept writable under ReadOnly
+	NoNewPrivileges  bool     `json:"no_new_privileges,omitempty"`
+	Seccomp          bool     `json:"seccomp,omitempty"`
+	DropCapabilities bool     `json:"drop_capabilities,omitempty"`
+	Capabilities     []int    `json:"capabilities,omitempty"`
+}
+
+// newSandboxSpec translates the sandbox options of app
+func newSandboxSpec(app config.AppConfig) (sandboxSpec, error) {
+	s := app.Sandbox
+	spec := sandboxSpec{
+		Chroot:           s.Chroot,
+		NoNewPrivileges:  s.NoNewPrivileges,
+		Seccomp:          s.Seccomp != "",
+		DropCapabilities: s.DropCapabilities,
+	}
+
+	if s.Chroot != "" {
+		// The working directory is kept when it lies inside the jail
+		spec.Dir = "/"
+		if rel, err := filepath.Rel(s.Chroot, app.WorkingDir); err == nil && app.WorkingDir != "" && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			spec.Dir = filepath.Join("/", rel)
+		}
+	}
+	if s.ReadOnly {
+		spec.ReadOnly = app.WorkingDir
+		for _, path := range s.Writable {
+			spec.Writable = append(spec.Writable, filepath.Join(app.WorkingDir, path))
+		}
+	}
+	for _, name := range s.Capabilities {
+		capability, err := config.ParseCapability(name)
+		if err != nil {
+			return sandboxSpec{}, err
+		}
+		spec.Capabilities = append(spec.Capabilities, capability)
+	}
+	return spec, nil
+}
+
+// sandbox makes cmd start through the sandbox helper when the app has sandbox
+// options. The helper is guvnor itself: it sets up the sandbox and then execs
+// the original command, which keeps the PID guvnor tracks.
+func sandbox(cmd *exec.Cmd, app config.AppConfig) error {
+	if !app.Sandbox.Enabled() {
+		return nil
+	}
+	// Inside a chroot the command is looked up in the jail instead
+	if cmd.Err != nil && app.Sandbox.Chroot == "" {
+		return cmd.Err
+	}
+
+	spec, err := newSandboxSpec(app)
+	if err != nil {
+		return err
+	}
+	if err := checkPlatformSandbox(spec); err != nil {
+		return err
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the guvnor executable: %w", err)
+	}
+
+	cmd.Env = append(cmd.Env, sandboxEnv+"="+string(data))
+	cmd.Path = exe
+	cmd.Err = nil
+	return nil
+}
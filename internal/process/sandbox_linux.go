@@ -0,0 +1,181 @@
+//go:build linux
+
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// A process started with sandboxEnv set is the sandbox helper: it applies the
+// sandbox and execs the app before main runs. Most of these settings only
+// affect the calling thread, so the thread is locked up to the exec.
+func init() {
+	data := os.Getenv(sandboxEnv)
+	if data == "" {
+		return
+	}
+	runtime.LockOSThread()
+	err := runSandboxed(data)
+	fmt.Fprintf(os.Stderr, "guvnor sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// runSandboxed applies the sandbox in data and replaces the helper with the
+// command in os.Args. It only returns on failure.
+func runSandboxed(data string) error {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		return fmt.Errorf("invalid sandbox: %w", err)
+	}
+	os.Unsetenv(sandboxEnv)
+
+	// Mounting and chroot need the capabilities dropped after them, and the
+	// seccomp filter blocks mount, so it goes last
+	if err := spec.mount(); err != nil {
+		return err
+	}
+	if spec.Chroot != "" {
+		if err := unix.Chroot(spec.Chroot); err != nil {
+			return fmt.Errorf("failed to chroot to %s: %w", spec.Chroot, err)
+		}
+		if err := unix.Chdir(spec.Dir); err != nil {
+			return fmt.Errorf("failed to change to %s in %s: %w", spec.Dir, spec.Chroot, err)
+		}
+	}
+	if err := spec.dropCapabilities(); err != nil {
+		return err
+	}
+	// Seccomp filters can only be installed without CAP_SYS_ADMIN with no_new_privs
+	if spec.NoNewPrivileges || spec.Seccomp {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to set no_new_privs: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(os.Args[0])
+	if err != nil {
+		return err
+	}
+	if spec.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return err
+		}
+	}
+	return syscall.Exec(path, os.Args, os.Environ())
+}
+
+// mount makes the read-only directory read-only in a mount namespace of the
+// app, with its writable paths mounted writable on top
+func (s sandboxSpec) mount() error {
+	if s.ReadOnly == "" {
+		return nil
+	}
+	if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+		return fmt.Errorf("failed to create a mount namespace: %w", err)
+	}
+	// Keep the mounts below from propagating to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %w", err)
+	}
+	if err := bindMount(s.ReadOnly, true); err != nil {
+		return err
+	}
+	for _, path := range s.Writable {
+		if err := bindMount(path, false); err != nil {
+			return err
+		}
+	}
+	// The working directory still refers to the mount below
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return unix.Chdir(wd)
+}
+
+// bindMount mounts path on itself, read-only or writable; a bind mount starts
+// with the flags of its source, so writable paths under a read-only one are
+// remounted too
+func bindMount(path string, readOnly bool) error {
+	if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind mount %s: %w", path, err)
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT)
+	if readOnly {
+		flags |= unix.MS_RDONLY
+	}
+	if err := unix.Mount("", path, "", flags, ""); err != nil {
+		return fmt.Errorf("failed to remount %s: %w", path, err)
+	}
+	return nil
+}
+
+// dropCapabilities removes every capability but the kept ones from the
+// bounding set, so root does not get them back at exec, and from the sets of
+// the helper. Processes not running as root have none to drop.
+func (s sandboxSpec) dropCapabilities() error {
+	if !s.DropCapabilities || os.Geteuid() != 0 {
+		return nil
+	}
+
+	var keep uint64
+	for _, capability := range s.Capabilities {
+		keep |= 1 << capability
+	}
+	for capability := 0; capability <= lastCapability(); capability++ {
+		if keep&(1<<capability) != 0 {
+			continue
+		}
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to drop capability %d: %w", capability, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to clear ambient capabilities: %w", err)
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("failed to read capabilities: %w", err)
+	}
+	for i := range data {
+		mask := data[i].Permitted & uint32(keep>>(32*i))
+		data[i] = unix.CapUserData{Effective: mask, Permitted: mask, Inheritable: mask}
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("failed to drop capabilities: %w", err)
+	}
+	return nil
+}
+
+// lastCapability returns the highest capability the kernel knows
+func lastCapability() int {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return last
+}
+
+// checkPlatformSandbox fails early for options that need root, instead of
+// letting the helper fail at every restart
+func checkPlatformSandbox(spec sandboxSpec) error {
+	if (spec.Chroot != "" || spec.ReadOnly != "") && os.Geteuid() != 0 {
+		return fmt.Errorf("sandbox chroot and read_only require running guvnor as root")
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package process
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// checkPlatformSandbox refuses to start sandboxed apps rather than run them
+// without the isolation they asked for
+func checkPlatformSandbox(spec sandboxSpec) error {
+	return fmt.Errorf("sandbox is not supported on %s", runtime.GOOS)
+}
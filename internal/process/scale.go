@@ -0,0 +1,246 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// InstanceName returns the process name for the n-th instance of an app.
+// The first instance keeps the app name, others are named "<app>.<n>".
+func InstanceName(app string, instance int) string {
+	if instance <= 1 {
+		return app
+	}
+	return fmt.Sprintf("%s.%d", app, instance)
+}
+
+// parseInstanceName splits "web.2" into ("web", 2); other names are instance 1
+func parseInstanceName(name string) (string, int) {
+	if idx := strings.LastIndex(name, "."); idx > 0 {
+		if n, err := strconv.Atoi(name[idx+1:]); err == nil && n > 1 {
+			return name[:idx], n
+		}
+	}
+	return name, 1
+}
+
+// AppOfInstance returns the app an instance name such as "web.2" belongs to
+func AppOfInstance(name string) string {
+	app, _ := parseInstanceName(name)
+	return app
+}
+
+// AppName returns the name of the app this process is an instance of
+func (p *Process) AppName() string {
+	if p.app == "" {
+		return p.Config.Name
+	}
+	return p.app
+}
+
+// Instance returns the 1-based instance number of the process within its app
+func (p *Process) Instance() int {
+	if p.instance == 0 {
+		return 1
+	}
+	return p.instance
+}
+
+// GetInstances returns all processes belonging to an app ordered by instance number
+func (m *Manager) GetInstances(app string) []*Process {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.instancesLocked(app)
+}
+
+// instancesLocked returns the instances of an app (must be called with lock held)
+func (m *Manager) instancesLocked(app string) []*Process {
+	var instances []*Process
+	for _, proc := range m.processes {
+		if proc.AppName() == app {
+			instances = append(instances, proc)
+		}
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Instance() < instances[j].Instance()
+	})
+	return instances
+}
+
+// InstanceCount returns the number of running instances of an app
+func (m *Manager) InstanceCount(app string) int {
+	count := 0
+	for _, proc := range m.GetInstances(app) {
+		if proc.IsRunning() {
+			count++
+		}
+	}
+	return count
+}
+
+// Scale adjusts the number of running instances of an app. New instances get
+// automatically assigned ports; surplus instances are stopped highest number
+// first. Scaling to 0 stops the base instance but keeps it, so the app can
+// still be started and listed.
+func (m *Manager) Scale(ctx context.Context, appConfig config.AppConfig, instances int) error {
+	if instances < 0 {
+		return fmt.Errorf("invalid instance count %d for %s", instances, appConfig.Name)
+	}
+
+	m.logger.WithField("app", appConfig.Name).Infof("Scaling to %d instances", instances)
+
+	// Scale up: make sure instances 1..n are running
+	for i := 1; i <= instances; i++ {
+		name := InstanceName(appConfig.Name, i)
+		if proc, exists := m.GetProcess(name); exists && proc.IsRunning() {
+			continue
+		}
+
+		instanceConfig, err := m.instanceConfig(appConfig, i)
+		if err != nil {
+			return err
+		}
+		if err := m.Start(ctx, instanceConfig); err != nil {
+			return fmt.Errorf("failed to start %s: %w", name, err)
+		}
+	}
+
+	// Scale down: stop instances above n and forget all but the base one
+	var errors []error
+	for _, proc := range m.GetInstances(appConfig.Name) {
+		if proc.Instance() <= instances {
+			continue
+		}
+		if err := proc.Stop(ctx); err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		if proc.Instance() <= 1 {
+			continue
+		}
+		m.mu.Lock()
+		delete(m.processes, proc.Config.Name)
+		m.mu.Unlock()
+		m.publish(EventRemoved, proc, nil)
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("failed to stop some instances of %s: %v", appConfig.Name, errors)
+	}
+
+	return nil
+}
+
+// Forget drops the instances of an app that are no longer running from the
+// process table and returns their names
+func (m *Manager) Forget(app string) []string {
+	var forgotten []string
+	for _, proc := range m.GetInstances(app) {
+		if proc.IsRunning() {
+			continue
+		}
+		m.mu.Lock()
+		delete(m.processes, proc.Config.Name)
+		m.mu.Unlock()
+		m.publish(EventRemoved, proc, nil)
+		forgotten = append(forgotten, proc.Config.Name)
+	}
+	return forgotten
+}
+
+// instanceConfig derives the configuration of the n-th instance of an app
+func (m *Manager) instanceConfig(appConfig config.AppConfig, instance int) (config.AppConfig, error) {
+	if instance <= 1 {
+		return appConfig, nil
+	}
+
+	cfg := appConfig
+	cfg.Name = InstanceName(appConfig.Name, instance)
+
+	if appConfig.Port > 0 {
+		port, err := m.allocatePort(appConfig.Port)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to allocate port for %s: %w", cfg.Name, err)
+		}
+		cfg = withPort(cfg, appConfig.Port, port)
+	}
+
+	return cfg, nil
+}
+
+// withPort moves an app configuration to a new port, rewriting the port in args and
+// environment so the process listens where the proxy expects it
+func withPort(appConfig config.AppConfig, oldPort, newPort int) config.AppConfig {
+	cfg := appConfig
+	cfg.Port = newPort
+
+	basePort := strconv.Itoa(oldPort)
+	port := strconv.Itoa(newPort)
+	cfg.Args = make([]string, len(appConfig.Args))
+	for i, arg := range appConfig.Args {
+		cfg.Args[i] = replacePort(arg, basePort, port)
+	}
+
+	cfg.Environment = make(map[string]string, len(appConfig.Environment)+1)
+	for key, value := range appConfig.Environment {
+		cfg.Environment[key] = replacePort(value, basePort, port)
+	}
+	cfg.Environment["PORT"] = port
+
+	return cfg
+}
+
+// replacePort replaces $PORT and standalone occurrences of the base port number
+func replacePort(value, basePort, newPort string) string {
+	value = strings.ReplaceAll(value, "${PORT}", newPort)
+	value = strings.ReplaceAll(value, "$PORT", newPort)
+
+	if value == basePort {
+		return newPort
+	}
+	for _, sep := range []string{":", "="} {
+		if strings.HasSuffix(value, sep+basePort) {
+			return strings.TrimSuffix(value, basePort) + newPort
+		}
+	}
+	return value
+}
+
+// allocatePort finds a free port above the base port not used by any managed process
+func (m *Manager) allocatePort(base int) (int, error) {
+	m.mu.RLock()
+	used := make(map[int]bool, len(m.processes))
+	for _, proc := range m.processes {
+		used[proc.Config.Port] = true
+	}
+	m.mu.RUnlock()
+
+	for port := base + 1; port <= 65535; port++ {
+		if used[port] {
+			continue
+		}
+		if portAvailable(port) {
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no free port above %d", base)
+}
+
+// portAvailable reports whether a TCP port can be bound on localhost
+func portAvailable(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
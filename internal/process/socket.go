@@ -0,0 +1,51 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+)
+
+// passSocket hands the app's listening socket to cmd, binding it on first use.
+// The socket outlives the process, so a restarted app never races its previous
+// instance for the port and connections arriving in between wait in the backlog.
+func (p *Process) passSocket(cmd *exec.Cmd) error {
+	if p.socket == nil {
+		address := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.Config.Port))
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			return fmt.Errorf("failed to bind %s for socket activation: %w", address, err)
+		}
+		// File returns a duplicate, the listener itself is not needed
+		socket, err := listener.(*net.TCPListener).File()
+		listener.Close()
+		if err != nil {
+			return fmt.Errorf("failed to get socket of %s: %w", address, err)
+		}
+		p.socket = socket
+		p.logger.WithField("address", address).Info("Bound socket for activation")
+	}
+
+	return activateSocket(cmd, p.socket, p.Config.Name)
+}
+
+// closeSocket releases the app's listening socket once it is stopped for good
+func (p *Process) closeSocket() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.socket != nil {
+		p.socket.Close()
+		p.socket = nil
+	}
+}
+
+// listenEnv returns the systemd socket activation variables except LISTEN_PID,
+// which is only known once the process exists
+func listenEnv(name string) []string {
+	return []string{
+		"LISTEN_FDS=1",
+		"LISTEN_FDNAMES=" + name,
+	}
+}
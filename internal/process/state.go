@@ -0,0 +1,264 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// adoptPollInterval is how often an adopted process is checked for exit
+const adoptPollInterval = time.Second
+
+// processState is what is kept next to the PID file so a restarted guvnor can
+// take a process over with its full configuration
+type processState struct {
+	Name        string           `json:"name"`
+	PID         int              `json:"pid"`
+	Port        int              `json:"port,omitempty"`
+	Mode        ExecutionMode    `json:"mode"`
+	ContainerID string           `json:"container_id,omitempty"`
+	StartedAt   time.Time        `json:"started_at"`
+	Restarts    int              `json:"restarts"`
+	Config      config.AppConfig `json:"config"`
+}
+
+// Alive reports whether the process with the given PID is running
+func Alive(pid int) bool {
+	return pid > 0 && platformAlive(pid)
+}
+
+// Executable returns the path of the executable the process with the given
+// PID runs, an error wrapping errors.ErrUnsupported where it cannot be read
+func Executable(pid int) (string, error) {
+	return processExecutable(pid)
+}
+
+// statePath is the state file belonging to the PID file
+func (p *Process) statePath() string {
+	return strings.TrimSuffix(p.pidFile, ".pid") + ".json"
+}
+
+// writeState records the running process; the caller holds p.mu
+func (p *Process) writeState() error {
+	if p.pidFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(processState{
+		Name:        p.Config.Name,
+		PID:         p.pid,
+		Port:        p.Config.Port,
+		Mode:        p.executionMode,
+		ContainerID: p.containerID,
+		StartedAt:   p.lastStart,
+		Restarts:    p.restarts,
+		Config:      p.Config,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p.statePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.statePath())
+}
+
+// loadState takes over processes left running by a previous guvnor. Processes
+// with a state file get back their configuration, start time and restart count
+// and are watched for exit; dead ones are forgotten so they are started afresh.
+func (m *Manager) loadState() {
+	if m.pidDir == "" {
+		return
+	}
+
+	files, err := filepath.Glob(filepath.Join(m.pidDir, "*.pid"))
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to scan PID directory")
+		return
+	}
+
+	entries, _ := listProcesses()
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".pid")
+		statePath := strings.TrimSuffix(file, ".pid") + ".json"
+
+		pid, state := readState(file, statePath)
+		if pid <= 0 || !platformAlive(pid) || (state != nil && !sameCommand(state.Config, pid, entries)) {
+			// Dead, or the PID now belongs to something else
+			os.Remove(file)
+			os.Remove(statePath)
+			continue
+		}
+
+		if state != nil && state.Mode == ModeContainer {
+			// Containers are recreated by the next start rather than re-attached
+			m.logger.WithField("process", name).Info("Container from a previous run will be replaced on start")
+			os.Remove(file)
+			os.Remove(statePath)
+			continue
+		}
+
+		cfg := config.AppConfig{Name: name}
+		if state != nil {
+			cfg = state.Config
+		}
+		proc := m.newProcess(cfg)
+
+		process, err := os.FindProcess(pid)
+		if err != nil {
+			continue
+		}
+		proc.process = process
+		proc.pid = pid
+		proc.status = StatusRunning
+		proc.adopted = true
+		if state != nil {
+			proc.lastStart = state.StartedAt
+			proc.restarts = state.Restarts
+		}
+		proc.exited = make(chan struct{})
+		go proc.watchAdopted(proc.exited)
+
+		m.processes[name] = proc
+		m.logger.WithFields(logrus.Fields{
+			"process":  name,
+			"pid":      pid,
+			"restarts": proc.restarts,
+			"config":   state != nil,
+		}).Info("Recovered running process")
+	}
+}
+
+// readState reads a PID file and its state file, if there is one
+func readState(pidFile, statePath string) (int, *processState) {
+	if data, err := os.ReadFile(statePath); err == nil {
+		var state processState
+		if json.Unmarshal(data, &state) == nil && state.PID > 0 {
+			return state.PID, &state
+		}
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		return 0, nil
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid, nil
+}
+
+// sameCommand guards against PID reuse: the process must still run the
+// configured command. Without a process table the PID is trusted.
+func sameCommand(cfg config.AppConfig, pid int, entries []procEntry) bool {
+	if cfg.Command == "" || entries == nil {
+		return true
+	}
+	for _, e := range entries {
+		if e.pid == pid {
+			return strings.Contains(e.command, filepath.Base(cfg.Command))
+		}
+	}
+	return false
+}
+
+// watchAdopted waits for a process guvnor did not start itself, which it
+// cannot wait on, and applies the restart policy when it exits
+func (p *Process) watchAdopted(exited chan struct{}) {
+	pid := p.GetPID()
+	for platformAlive(pid) {
+		time.Sleep(adoptPollInterval)
+	}
+	close(exited)
+
+	p.mu.Lock()
+	wasRunning := p.status == StatusRunning && p.pid == pid
+	if wasRunning {
+		p.status = StatusStopped
+		p.process = nil
+		p.pid = 0
+	}
+	p.mu.Unlock()
+	if !wasRunning {
+		return
+	}
+
+	// The exit code of a process that is not our child is unknown, so any exit counts as a crash
+	p.cleanupPidFile()
+	p.logger.WithField("pid", pid).Warn("Recovered process exited")
+	p.emit(EventCrashed, map[string]string{"pid": strconv.Itoa(pid)})
+	if !p.Config.RestartPolicy.Enabled || p.Config.Command == "" {
+		return
+	}
+
+	delay, ok := p.nextRestart(time.Now())
+	if !ok {
+		p.logGaveUp()
+		return
+	}
+	p.notifyRestart()
+	time.Sleep(delay)
+
+	if err := p.Start(context.Background()); err != nil {
+		p.logger.WithError(err).Error("Failed to restart process")
+	} else {
+		p.emit(EventRestarted, map[string]string{"restarts": strconv.Itoa(p.GetRestartCount())})
+	}
+}
+
+// isAdopted reports whether the process was recovered and not yet claimed by a start
+func (p *Process) isAdopted() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.adopted
+}
+
+// readopt gives a recovered process the configuration it is started with now.
+// It reports false, leaving the process alone, when cfg would launch it differently.
+func (p *Process) readopt(cfg config.AppConfig) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !sameLaunch(p.Config, cfg) {
+		return false
+	}
+	p.Config = cfg
+	p.adopted = false
+	if err := p.writeState(); err != nil {
+		p.logger.WithError(err).Warn("Failed to update process state")
+	}
+	p.logger.WithField("pid", p.pid).Info("Adopted process left running by a previous guvnor")
+	return true
+}
+
+// sameLaunch reports whether a recovered process was started the way cfg would start it
+func sameLaunch(recovered, cfg config.AppConfig) bool {
+	if recovered.Command == "" {
+		// Recovered from a bare PID file: nothing to compare
+		return true
+	}
+
+	// The recovered config went through JSON, so cfg does too before comparing
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return false
+	}
+	var current config.AppConfig
+	if err := json.Unmarshal(data, &current); err != nil {
+		return false
+	}
+
+	launch := func(c config.AppConfig) []interface{} {
+		return []interface{}{c.Command, c.Args, c.WorkingDir, c.Port, c.Environment, c.Container, c.Limits, c.Nice, c.IONice, c.OOMScoreAdj, c.Sandbox}
+	}
+	return reflect.DeepEqual(launch(recovered), launch(current))
+}
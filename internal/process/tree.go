@@ -0,0 +1,124 @@
+package process
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+// procEntry is one process in the system process table
+type procEntry struct {
+	pid     int
+	ppid    int
+	pgid    int
+	command string
+}
+
+// ChildUsage is a resource usage sample of a descendant of a managed process
+type ChildUsage struct {
+	PID        int     `json:"pid"`
+	Command    string  `json:"command"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        uint64  `json:"rss_bytes"`
+}
+
+// descendants returns every process forked from root, plus members of root's
+// process group that were reparented after their parent exited
+func descendants(root int, entries []procEntry) []procEntry {
+	children := make(map[int][]procEntry)
+	for _, e := range entries {
+		children[e.ppid] = append(children[e.ppid], e)
+	}
+
+	seen := map[int]bool{root: true}
+	var tree []procEntry
+	queue := []int{root}
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		for _, child := range children[pid] {
+			if !seen[child.pid] {
+				seen[child.pid] = true
+				tree = append(tree, child)
+				queue = append(queue, child.pid)
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if e.pgid == root && !seen[e.pid] {
+			seen[e.pid] = true
+			tree = append(tree, e)
+		}
+	}
+
+	sort.Slice(tree, func(i, j int) bool { return tree[i].pid < tree[j].pid })
+	return tree
+}
+
+// treePIDs returns the PIDs of the descendants of pid, or nil if the platform
+// cannot list processes
+func treePIDs(pid int) []int {
+	if pid <= 0 {
+		return nil
+	}
+	entries, err := listProcesses()
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+	for _, e := range descendants(pid, entries) {
+		pids = append(pids, e.pid)
+	}
+	return pids
+}
+
+// killLeftovers waits until deadline for descendants of a stopped process to
+// exit and kills the rest. Their parent is gone, so guvnor does not reap them.
+func (p *Process) killLeftovers(pids []int, deadline time.Time) {
+	for len(pids) > 0 {
+		alive := pids[:0]
+		for _, pid := range pids {
+			if platformAlive(pid) {
+				alive = append(alive, pid)
+			}
+		}
+		pids = alive
+		if len(pids) == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for _, pid := range pids {
+		if proc, err := os.FindProcess(pid); err == nil && proc.Kill() == nil {
+			p.logger.WithField("pid", pid).Warn("Killed leftover child process")
+		}
+	}
+}
+
+// sampleChildren samples the descendants of pid and returns their usage. CPU
+// percentages need a previous sample of the same child, like the main process.
+func (p *Process) sampleChildren(pid int, entries []procEntry, now time.Time) []ChildUsage {
+	var children []ChildUsage
+	cpu := make(map[int]time.Duration)
+
+	for _, e := range descendants(pid, entries) {
+		raw, err := readUsage(e.pid)
+		if err != nil {
+			continue // Exited since the process table was read
+		}
+		child := ChildUsage{PID: e.pid, Command: e.command, RSS: raw.rss}
+		if prev, ok := p.usageChildCPU[e.pid]; ok && !p.usageAt.IsZero() {
+			if elapsed := now.Sub(p.usageAt); elapsed > 0 && raw.cpu >= prev {
+				child.CPUPercent = float64(raw.cpu-prev) * 100 / float64(elapsed)
+			}
+		}
+		cpu[e.pid] = raw.cpu
+		children = append(children, child)
+	}
+
+	p.usageChildCPU = cpu
+	return children
+}
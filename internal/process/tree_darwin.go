@@ -0,0 +1,76 @@
+//go:build darwin
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// listProcesses reads the parent and process group of every process through ps(1)
+func listProcesses() ([]procEntry, error) {
+	out, err := exec.Command("ps", "-A", "-o", "pid=,ppid=,pgid=,comm=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to run ps: %w", err)
+	}
+
+	var entries []procEntry
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pid, err1 := strconv.Atoi(fields[0])
+		ppid, err2 := strconv.Atoi(fields[1])
+		pgid, err3 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		command := filepath.Base(strings.Join(fields[3:], " "))
+		entries = append(entries, procEntry{pid: pid, ppid: ppid, pgid: pgid, command: command})
+	}
+	return entries, nil
+}
+
+// processExecutable reads the executable of a process through ps(1), which
+// shows its full path as the command name
+func processExecutable(pid int) (string, error) {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run ps: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isZombie reports whether a process has exited but was not reaped yet
+func isZombie(pid int) bool {
+	out, err := exec.Command("ps", "-o", "stat=", "-p", strconv.Itoa(pid)).Output()
+	return err == nil && strings.HasPrefix(strings.TrimSpace(string(out)), "Z")
+}
+
+// processMarkers reads the guvnor marker variables through ps(1), which appends
+// the environment to the command line
+func processMarkers(entries []procEntry) map[int]processMarker {
+	markers := make(map[int]processMarker)
+	out, err := exec.Command("ps", "-axEww", "-o", "pid=,command=").Output()
+	if err != nil {
+		return markers
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if marker, ok := parseMarker(fields[1:]); ok {
+			markers[pid] = marker
+		}
+	}
+	return markers
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listProcesses reads the parent and process group of every process from /proc
+func listProcesses() ([]procEntry, error) {
+	dirs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read /proc: %w", err)
+	}
+
+	var entries []procEntry
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if err != nil {
+			continue // Exited meanwhile
+		}
+
+		// Fields after the command name: state, ppid, pgrp
+		start := strings.IndexByte(string(stat), '(')
+		end := strings.LastIndexByte(string(stat), ')')
+		if start < 0 || end < start {
+			continue
+		}
+		fields := strings.Fields(string(stat[end+1:]))
+		if len(fields) < 3 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		pgid, _ := strconv.Atoi(fields[2])
+		entries = append(entries, procEntry{pid: pid, ppid: ppid, pgid: pgid, command: string(stat[start+1 : end])})
+	}
+	return entries, nil
+}
+
+// processExecutable reads the executable of a process from /proc; a binary
+// replaced since the process started ends in " (deleted)"
+func processExecutable(pid int) (string, error) {
+	return os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+}
+
+// isZombie reports whether a process has exited but was not reaped yet
+func isZombie(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	end := strings.LastIndexByte(string(stat), ')')
+	return end >= 0 && strings.HasPrefix(strings.TrimSpace(string(stat[end+1:])), "Z")
+}
+
+// processMarkers reads the guvnor marker variables from each process's
+// environment; processes of other users cannot be read and are skipped
+func processMarkers(entries []procEntry) map[int]processMarker {
+	markers := make(map[int]processMarker)
+	for _, e := range entries {
+		data, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", e.pid))
+		if err != nil {
+			continue
+		}
+		if marker, ok := parseMarker(strings.Split(string(data), "\x00")); ok {
+			markers[e.pid] = marker
+		}
+	}
+	return markers
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+
+package process
+
+// listProcesses is not implemented on this platform
+func listProcesses() ([]procEntry, error) {
+	return nil, errUsageUnsupported
+}
+
+// isZombie cannot tell on this platform
+func isZombie(pid int) bool {
+	return false
+}
+
+// processMarkers cannot read other processes' environment on this platform
+func processMarkers(entries []procEntry) map[int]processMarker {
+	return nil
+}
@@ -0,0 +1,133 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultUsageInterval is how often the manager samples process resource usage
+const DefaultUsageInterval = 5 * time.Second
+
+// errUsageUnsupported is returned by readUsage on platforms without an implementation
+var errUsageUnsupported = errors.New("process usage sampling is not supported on this platform")
+
+// Usage is a resource usage sample of a running process
+type Usage struct {
+	CPUPercent float64   `json:"cpu_percent"` // Share of one core since the previous sample; may exceed 100 on multiple cores
+	RSS        uint64    `json:"rss_bytes"`
+	OpenFDs    int       `json:"open_fds"` // -1 when the platform does not report it
+	SampledAt  time.Time `json:"sampled_at"`
+	// Descendants such as forked workers, and totals including them
+	Children       []ChildUsage `json:"children,omitempty"`
+	TreeCPUPercent float64      `json:"tree_cpu_percent"`
+	TreeRSS        uint64       `json:"tree_rss_bytes"`
+}
+
+// rawUsage is what the platform reports for a process at one point in time
+type rawUsage struct {
+	cpu time.Duration // Total user and system CPU time consumed
+	rss uint64
+	fds int
+}
+
+// GetUsage returns the latest resource usage sample of the process.
+// The second return value is false until the process has been sampled.
+func (p *Process) GetUsage() (Usage, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.usage, !p.usage.SampledAt.IsZero()
+}
+
+// sampleUsage reads the process's current resource usage, and that of its
+// descendants when entries lists the system's processes. CPU percentage is
+// computed from the CPU time consumed since the previous sample.
+func (p *Process) sampleUsage(now time.Time, entries []procEntry) error {
+	pid := p.GetPID()
+	if pid <= 0 {
+		return nil
+	}
+
+	raw, err := readUsage(pid)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	usage := Usage{RSS: raw.rss, OpenFDs: raw.fds, SampledAt: now}
+	if p.usagePID == pid && !p.usageAt.IsZero() {
+		if elapsed := now.Sub(p.usageAt); elapsed > 0 && raw.cpu >= p.usageCPU {
+			usage.CPUPercent = float64(raw.cpu-p.usageCPU) * 100 / float64(elapsed)
+		}
+	}
+
+	usage.TreeCPUPercent, usage.TreeRSS = usage.CPUPercent, usage.RSS
+	if entries != nil {
+		usage.Children = p.sampleChildren(pid, entries, now)
+		for _, child := range usage.Children {
+			usage.TreeCPUPercent += child.CPUPercent
+			usage.TreeRSS += child.RSS
+		}
+	}
+
+	p.usage = usage
+	p.usageCPU = raw.cpu
+	p.usageAt = now
+	p.usagePID = pid
+	return nil
+}
+
+// SampleUsage records a resource usage sample for every running process.
+// Container-mode processes are skipped since their PID belongs to the docker client.
+func (m *Manager) SampleUsage() {
+	m.mu.RLock()
+	processes := make([]*Process, 0, len(m.processes))
+	for _, proc := range m.processes {
+		processes = append(processes, proc)
+	}
+	m.mu.RUnlock()
+
+	// One snapshot of the process table serves every process tree
+	entries, err := listProcesses()
+	if err != nil {
+		entries = nil
+	}
+
+	now := time.Now()
+	for _, proc := range processes {
+		if !proc.IsRunning() || proc.containerID != "" {
+			continue
+		}
+		if err := proc.sampleUsage(now, entries); err != nil {
+			if errors.Is(err, errUsageUnsupported) {
+				return
+			}
+			m.logger.WithError(err).WithField("process", proc.Config.Name).Debug("Failed to sample process usage")
+		}
+	}
+}
+
+// StartUsageSampler samples resource usage of all processes at the given interval until ctx is done
+func (m *Manager) StartUsageSampler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultUsageInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		m.SampleUsage()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.SampleUsage()
+			}
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+//go:build darwin
+
+package process
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readUsage reads CPU time and RSS through ps(1), which queries the kernel with
+// proc_pidinfo. Reading another process's task info directly needs cgo, and
+// kinfo_proc from sysctl does not carry CPU ticks or RSS on macOS. Open file
+// descriptors are not reported.
+func readUsage(pid int) (rawUsage, error) {
+	out, err := exec.Command("ps", "-o", "rss=,time=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("failed to run ps: %w", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return rawUsage{}, fmt.Errorf("unexpected ps output %q", strings.TrimSpace(string(out)))
+	}
+
+	rssKB, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("invalid rss %q: %w", fields[0], err)
+	}
+	cpu, err := parseCPUTime(fields[1])
+	if err != nil {
+		return rawUsage{}, err
+	}
+
+	return rawUsage{cpu: cpu, rss: rssKB * 1024, fds: -1}, nil
+}
+
+// parseCPUTime parses ps time output such as "1:02.35", "01:02:03" or "2-01:02:03"
+func parseCPUTime(value string) (time.Duration, error) {
+	var days int
+	if i := strings.IndexByte(value, '-'); i >= 0 {
+		d, err := strconv.Atoi(value[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpu time %q", value)
+		}
+		days = d
+		value = value[i+1:]
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid cpu time %q", value)
+		}
+		seconds = seconds*60 + n
+	}
+
+	return time.Duration(days)*24*time.Hour + time.Duration(seconds*float64(time.Second)), nil
+}
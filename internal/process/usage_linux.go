@@ -0,0 +1,62 @@
+//go:build linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of CPU times in /proc/<pid>/stat. It is 100 on
+// every Linux architecture Go supports.
+const clockTicks = 100
+
+// readUsage reads CPU time, RSS and open file descriptors from /proc
+func readUsage(pid int) (rawUsage, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("failed to read process stat: %w", err)
+	}
+
+	// The command name may contain spaces, so parse the fields after its closing parenthesis
+	end := strings.LastIndexByte(string(stat), ')')
+	if end < 0 {
+		return rawUsage{}, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 22 {
+		return rawUsage{}, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+
+	// fields[0] is the state (field 3), so utime (14) and stime (15) are at 11 and 12,
+	// and rss in pages (24) is at 21
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("invalid utime in /proc/%d/stat: %w", pid, err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("invalid stime in /proc/%d/stat: %w", pid, err)
+	}
+	rssPages, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return rawUsage{}, fmt.Errorf("invalid rss in /proc/%d/stat: %w", pid, err)
+	}
+
+	usage := rawUsage{
+		cpu: time.Duration(utime+stime) * time.Second / clockTicks,
+		fds: -1,
+	}
+	if rssPages > 0 {
+		usage.rss = uint64(rssPages) * uint64(os.Getpagesize())
+	}
+
+	if entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+		usage.fds = len(entries)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package process
+
+// readUsage is not implemented on this platform
+func readUsage(pid int) (rawUsage, error) {
+	return rawUsage{}, errUsageUnsupported
+}
@@ -0,0 +1,130 @@
+package procfile
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shellOperators are characters that only mean something to a shell when
+// they appear outside quotes: pipes, lists, redirects, subshells and globs
+const shellOperators = "|&;<>()`*?"
+
+// SplitCommand splits a command line into words the way a POSIX shell does:
+// whitespace separates words, single quotes keep text literal, double quotes
+// keep whitespace and backslashes escape the next character. It also reports
+// whether the line uses features only a shell provides, such as pipes, &&,
+// redirects, globs, $VARIABLES, ~ or VAR=value prefixes, in which case the
+// words are not what the shell would run.
+func SplitCommand(line string) (words []string, shell bool, err error) {
+	var word strings.Builder
+	inWord := false
+	// assigning is true while the words so far are all VAR=value prefixes
+	assigning := true
+
+	endWord := func() {
+		if !inWord {
+			return
+		}
+		w := word.String()
+		if assigning && isAssignment(w) {
+			shell = true
+		} else {
+			assigning = false
+		}
+		words = append(words, w)
+		word.Reset()
+		inWord = false
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			endWord()
+		case r == '\'':
+			end := indexRune(runes, i+1, '\'')
+			if end < 0 {
+				return nil, false, fmt.Errorf("unterminated single quote in %q", line)
+			}
+			word.WriteString(string(runes[i+1 : end]))
+			inWord = true
+			i = end
+		case r == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(runes); i++ {
+				c := runes[i]
+				if c == '"' {
+					closed = true
+					break
+				}
+				if c == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`", runes[i+1]) {
+					i++
+					c = runes[i]
+				} else if c == '$' || c == '`' {
+					shell = true
+				}
+				word.WriteRune(c)
+			}
+			if !closed {
+				return nil, false, fmt.Errorf("unterminated double quote in %q", line)
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, false, fmt.Errorf("trailing backslash in %q", line)
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		default:
+			if strings.ContainsRune(shellOperators, r) || r == '$' || (r == '~' || r == '#') && !inWord {
+				shell = true
+			}
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endWord()
+
+	return words, shell, nil
+}
+
+// AppCommand returns how an app runs a Procfile command line: as a program
+// with arguments, or as the whole line through the shell when it needs one
+func AppCommand(line string) (command string, args []string, shell bool, err error) {
+	words, shell, err := SplitCommand(line)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if shell {
+		return strings.TrimSpace(line), nil, true, nil
+	}
+	if len(words) == 0 {
+		return "", nil, false, nil
+	}
+	return words[0], words[1:], false, nil
+}
+
+// isAssignment reports whether word is a VAR=value environment prefix
+func isAssignment(word string) bool {
+	name, _, found := strings.Cut(word, "=")
+	if !found || name == "" {
+		return false
+	}
+	for i, r := range name {
+		if r != '_' && (r < 'A' || r > 'Z') && (r < 'a' || r > 'z') && (i == 0 || r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func indexRune(runes []rune, from int, r rune) int {
+	for i := from; i < len(runes); i++ {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
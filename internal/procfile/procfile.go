@@ -228,15 +228,15 @@ func (pf *Procfile) ConvertToDiscoveryApps(basePath string) ([]*discovery.App, e
 	var apps []*discovery.App
 
 	for _, process := range pf.Processes {
-		// Parse command into command and args
-		cmdParts := strings.Fields(process.Command)
-		if len(cmdParts) == 0 {
+		// Parse command into command and args, or run it through the shell
+		command, args, shell, err := AppCommand(process.Command)
+		if err != nil {
+			return nil, fmt.Errorf("process %s: %w", process.Name, err)
+		}
+		if command == "" {
 			continue
 		}
 
-		command := cmdParts[0]
-		args := cmdParts[1:]
-
 		// Create discovery app
 		app := &discovery.App{
 			Name:        process.Name,
@@ -245,6 +245,7 @@ func (pf *Procfile) ConvertToDiscoveryApps(basePath string) ([]*discovery.App, e
 			Port:        process.Port,
 			Command:     command,
 			Args:        args,
+			Shell:       shell,
 			Env:         make(map[string]string),
 			HealthCheck: getHealthCheckForProcessType(process.Name),
 		}
@@ -0,0 +1,111 @@
+package procfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	pf := &Procfile{Processes: []Process{
+		{Name: "web", Command: "gunicorn app:app --bind :$PORT", Port: 8000},
+		{Name: "worker", Command: "python worker.py"},
+	}}
+	config := []byte(`server:
+  http_port: 8080 # proxy port
+apps:
+  - name: web
+    command: gunicorn
+    args: ["app:app", "--workers", "4"]
+  - name: old
+    command: ./old
+`)
+
+	changes := func(got []SyncChange) map[string]string {
+		kinds := make(map[string]string)
+		for _, c := range got {
+			kinds[c.Name] = c.Kind
+		}
+		return kinds
+	}
+
+	out, got, err := Sync(pf, config, false)
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	kinds := changes(got)
+	if kinds["web"] != SyncOverridden || kinds["worker"] != SyncAdded || kinds["old"] != SyncRemoved {
+		t.Fatalf("unexpected changes: %v", got)
+	}
+	text := string(out)
+	for _, want := range []string{"# proxy port", `"--workers"`, "name: worker", "name: old"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("synced config missing %q:\n%s", want, text)
+		}
+	}
+
+	out, _, err = Sync(pf, config, true)
+	if err != nil {
+		t.Fatalf("Sync with prune: %v", err)
+	}
+	if strings.Contains(string(out), "name: old") {
+		t.Errorf("pruned config still has removed app:\n%s", out)
+	}
+
+	// A second sync has nothing left to add
+	again, got, err := Sync(pf, out, true)
+	if err != nil {
+		t.Fatalf("second Sync: %v", err)
+	}
+	if kinds := changes(got); len(kinds) != 1 || kinds["web"] != SyncOverridden {
+		t.Errorf("second sync changes = %v, want only the web override", got)
+	}
+	if string(again) != string(out) {
+		t.Errorf("second sync rewrote the config:\n%s", again)
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		line  string
+		words []string
+		shell bool
+	}{
+		{`node server.js --port 3000`, []string{"node", "server.js", "--port", "3000"}, false},
+		{`python -c "print('hi there')"`, []string{"python", "-c", "print('hi there')"}, false},
+		{`echo 'a  b' "c \"d\" \\e" f\ g ""`, []string{"echo", "a  b", `c "d" \e`, "f g", ""}, false},
+		{`gunicorn --bind=0.0.0.0:8000 app:wsgi`, []string{"gunicorn", "--bind=0.0.0.0:8000", "app:wsgi"}, false},
+		{`npm run build && npm start`, nil, true},
+		{`bundle exec puma | tee puma.log`, nil, true},
+		{`RAILS_ENV=production bundle exec rails s`, nil, true},
+		{`echo "$HOME"`, nil, true},
+		{`echo '$HOME'`, []string{"echo", "$HOME"}, false},
+		{`./worker > worker.log 2>&1`, nil, true},
+		{`~/bin/app`, nil, true},
+	}
+
+	for _, tt := range tests {
+		words, shell, err := SplitCommand(tt.line)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.line, err)
+			continue
+		}
+		if shell != tt.shell {
+			t.Errorf("%s: expected shell=%v", tt.line, tt.shell)
+		}
+		if !tt.shell && !reflect.DeepEqual(words, tt.words) {
+			t.Errorf("%s: expected %q, got %q", tt.line, tt.words, words)
+		}
+	}
+
+	for _, line := range []string{`echo "unterminated`, `echo 'unterminated`, `echo \`} {
+		if _, _, err := SplitCommand(line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+
+	command, args, shell, _ := AppCommand(`  npm run build && npm start  `)
+	if command != "npm run build && npm start" || args != nil || !shell {
+		t.Errorf("Expected the whole line run by the shell, got %q %q %v", command, args, shell)
+	}
+}
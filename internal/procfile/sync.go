@@ -0,0 +1,180 @@
+package procfile
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of difference between the Procfile and guvnor.yaml
+const (
+	SyncAdded      = "added"      // In the Procfile, missing from guvnor.yaml
+	SyncRemoved    = "removed"    // In guvnor.yaml, no longer in the Procfile
+	SyncOverridden = "overridden" // In both, guvnor.yaml runs a different command
+)
+
+// SyncChange is one difference found by Sync
+type SyncChange struct {
+	Name   string
+	Kind   string
+	Detail string
+}
+
+// syncApp is the guvnor.yaml entry written for a process missing from it
+type syncApp struct {
+	Name        string            `yaml:"name"`
+	Port        int               `yaml:"port,omitempty"`
+	Command     string            `yaml:"command"`
+	Args        []string          `yaml:"args,omitempty"`
+	Shell       bool              `yaml:"shell,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+}
+
+// Sync reconciles the apps of a guvnor.yaml document with the Procfile.
+// Processes missing from apps are added; apps in both are left untouched so
+// their overrides survive; apps no longer in the Procfile are reported, and
+// removed only with prune. The document is edited in place, so comments and
+// other settings are kept. It returns the new document and the differences.
+func Sync(pf *Procfile, configYAML []byte, prune bool) ([]byte, []SyncChange, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(configYAML, &doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("config is not a YAML mapping")
+	}
+
+	apps := mappingValue(root, "apps")
+	if apps == nil {
+		apps = &yaml.Node{Kind: yaml.SequenceNode}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "apps"}, apps)
+	}
+	if apps.Kind != yaml.SequenceNode {
+		return nil, nil, fmt.Errorf("apps is not a list")
+	}
+
+	inProcfile := make(map[string]bool)
+	configured := make(map[string]*yaml.Node)
+	for _, app := range apps.Content {
+		if name := mappingValue(app, "name"); name != nil {
+			configured[name.Value] = app
+		}
+	}
+
+	var changes []SyncChange
+	modified := false
+	for _, process := range pf.Processes {
+		inProcfile[process.Name] = true
+
+		app, exists := configured[process.Name]
+		if !exists {
+			entry := syncEntry(process)
+			var node yaml.Node
+			if err := node.Encode(entry); err != nil {
+				return nil, nil, fmt.Errorf("failed to encode app %s: %w", process.Name, err)
+			}
+			apps.Content = append(apps.Content, &node)
+			changes = append(changes, SyncChange{Name: process.Name, Kind: SyncAdded, Detail: commandLine(entry.Command, entry.Args)})
+			modified = true
+			continue
+		}
+
+		// $PORT is compared with the port guvnor.yaml assigns, not the Procfile default
+		if port := mappingValue(app, "port"); port != nil {
+			if n, err := strconv.Atoi(port.Value); err == nil {
+				process.Port = n
+			}
+		}
+		entry := syncEntry(process)
+		if current := configuredCommand(app); current != commandLine(entry.Command, entry.Args) {
+			changes = append(changes, SyncChange{
+				Name:   process.Name,
+				Kind:   SyncOverridden,
+				Detail: fmt.Sprintf("guvnor.yaml runs %q, Procfile runs %q", current, commandLine(entry.Command, entry.Args)),
+			})
+		}
+	}
+
+	kept := apps.Content[:0]
+	for _, app := range apps.Content {
+		name := mappingValue(app, "name")
+		if name == nil || inProcfile[name.Value] {
+			kept = append(kept, app)
+			continue
+		}
+		changes = append(changes, SyncChange{Name: name.Value, Kind: SyncRemoved, Detail: "not in the Procfile"})
+		if prune {
+			modified = true
+			continue
+		}
+		kept = append(kept, app)
+	}
+	apps.Content = kept
+
+	if !modified {
+		return configYAML, changes, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, nil, fmt.Errorf("failed to encode config: %w", err)
+	}
+	encoder.Close()
+	return buf.Bytes(), changes, nil
+}
+
+// syncEntry converts a Procfile process the way guvnor init does, with $PORT
+// replaced by the assigned port
+func syncEntry(process Process) syncApp {
+	command := process.Command
+	if process.Port > 0 {
+		port := strconv.Itoa(process.Port)
+		command = strings.ReplaceAll(strings.ReplaceAll(command, "${PORT}", port), "$PORT", port)
+	}
+	entry := syncApp{Name: process.Name, Port: process.Port}
+	if executable, args, shell, err := AppCommand(command); err == nil {
+		entry.Command, entry.Args, entry.Shell = executable, args, shell
+	} else {
+		// The shell reports the quoting mistake when the app starts
+		entry.Command, entry.Shell = strings.TrimSpace(command), true
+	}
+	if process.Port > 0 {
+		entry.Environment = map[string]string{"PORT": strconv.Itoa(process.Port)}
+	}
+	return entry
+}
+
+// configuredCommand returns the command line of a guvnor.yaml app
+func configuredCommand(app *yaml.Node) string {
+	var entry syncApp
+	if err := app.Decode(&entry); err != nil {
+		return ""
+	}
+	return commandLine(entry.Command, entry.Args)
+}
+
+func commandLine(command string, args []string) string {
+	return strings.TrimSpace(command + " " + strings.Join(args, " "))
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accessLogEntry is an access log line in the json access log format
+type accessLogEntry struct {
+	Time       time.Time `json:"time"`
+	ClientIP   string    `json:"client_ip"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int       `json:"bytes"`
+	DurationMS float64   `json:"duration_ms"`
+	App        string    `json:"app"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Tracking   string    `json:"tracking,omitempty"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// accessLogJSON formats a request as a JSON access log line for jq or log
+// pipelines such as ELK
+func (s *Server) accessLogJSON(r *http.Request, rw *responseWriter, statusCode int, duration time.Duration, app string) string {
+	entry := accessLogEntry{
+		Time:       time.Now().Add(-duration),
+		ClientIP:   s.getClientIP(r),
+		Method:     r.Method,
+		Host:       stripPort(r.Host),
+		Path:       r.URL.Path,
+		Query:      r.URL.RawQuery,
+		Proto:      r.Proto,
+		Status:     statusCode,
+		Bytes:      rw.size,
+		DurationMS: float64(duration.Microseconds()) / 1000,
+		App:        app,
+		RequestID:  requestIDFrom(r),
+		Referer:    r.Header.Get("Referer"),
+		UserAgent:  r.Header.Get("User-Agent"),
+	}
+	if trackingInfo := s.getTrackingInfo(r); trackingInfo != nil {
+		if chain, ok := trackingInfo["tracking_chain"].(string); ok {
+			entry.Tracking = chain
+		}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		// Every field marshals; keep the request visible regardless
+		return strings.Join([]string{entry.Method, entry.Host, entry.Path}, " ")
+	}
+	return string(data)
+}
+
+// accessLogCLF formats a request in the common log format, or with combined
+// set in the combined log format, leaving out guvnor's own fields so log
+// analyzers such as GoAccess or AWStats read the lines as they are
+func (s *Server) accessLogCLF(r *http.Request, rw *responseWriter, statusCode int, duration time.Duration, combined bool) string {
+	size := "-"
+	if rw.size > 0 {
+		size = strconv.Itoa(rw.size)
+	}
+	line := fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %s`,
+		s.getClientIP(r),
+		time.Now().Add(-duration).Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.RequestURI, r.Proto,
+		statusCode,
+		size,
+	)
+	if !combined {
+		return line
+	}
+	return fmt.Sprintf(`%s %s %s`, line, quoteHeader(r.Header.Get("Referer")), quoteHeader(r.Header.Get("User-Agent")))
+}
+
+// quoteHeader quotes a header value for a log line, "-" when it is empty
+func quoteHeader(value string) string {
+	if value == "" {
+		value = "-"
+	}
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
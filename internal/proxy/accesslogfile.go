@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/logs"
+)
+
+// setupAccessLog opens the dedicated access log file, if one is configured
+func (s *Server) setupAccessLog() error {
+	cfg := s.config.Server.AccessLog
+	if cfg.Path == "" {
+		return nil
+	}
+	maxSizeMB := cfg.MaxSizeMB
+	if maxSizeMB == 0 {
+		maxSizeMB = config.DefaultAccessLogMaxSizeMB
+	}
+	maxBackups := cfg.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = config.DefaultAccessLogMaxBackups
+	}
+
+	file, err := logs.OpenRotatingFile(cfg.Path, int64(maxSizeMB)<<20, cfg.RotateEvery, maxBackups)
+	if err != nil {
+		return fmt.Errorf("access log %s: %w", cfg.Path, err)
+	}
+	s.accessLog = file
+	return nil
+}
+
+// accessLogFormat returns the format of access log lines: that of the
+// access log file when there is one, else the server access_log_format
+func (s *Server) accessLogFormat() string {
+	if s.accessLog != nil {
+		if s.config.Server.AccessLog.Format == "" {
+			return config.AccessLogCombined
+		}
+		return s.config.Server.AccessLog.Format
+	}
+	if s.config.Server.AccessLogFormat == "" {
+		return config.AccessLogApache
+	}
+	return s.config.Server.AccessLogFormat
+}
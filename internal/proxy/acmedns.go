@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+
+	"github.com/gleicon/guvnor/internal/acmedns"
+	"github.com/gleicon/guvnor/internal/cert"
+)
+
+// setupACMEDNS creates the built-in DNS responder and the DNS-01 issuer that uses it
+func (s *Server) setupACMEDNS() error {
+	cfg := s.config.TLS.ACMEDNS
+
+	s.acmeDNS = acmedns.New(cfg.Zone, cfg.Nameserver, cfg.Address, s.logger.Logger)
+	issuer, err := cert.NewDNSIssuer(cfg.Domains, s.config.TLS.Email, s.config.TLS.CertDir, s.acme, s.acmeDNS, s.logger.Logger)
+	if err != nil {
+		return err
+	}
+	issuer.SetIssuedHook(s.certIssued)
+	s.dnsIssuer = issuer
+	return nil
+}
+
+// startACMEDNS starts answering DNS-01 challenges and issuing certificates
+func (s *Server) startACMEDNS(ctx context.Context) {
+	listen := s.config.TLS.ACMEDNS.Listen
+	if err := s.acmeDNS.Start(listen); err != nil {
+		s.logger.WithError(err).Error("Failed to start ACME DNS server")
+		s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Failed to start ACME DNS server: %v", err))
+		return
+	}
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("ACME DNS server for %s listening on %s", s.config.TLS.ACMEDNS.Zone, listen))
+	s.dnsIssuer.Start(ctx)
+}
+
+// withDNSCertificates serves the DNS-01 certificate for the names it covers
+// and falls back to next for everything else
+func (s *Server) withDNSCertificates(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert, ok := s.dnsIssuer.GetCertificate(hello); ok {
+			return cert, nil
+		}
+		return next(hello)
+	}
+}
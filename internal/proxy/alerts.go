@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/alert"
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/metrics"
+	"github.com/gleicon/guvnor/internal/notify"
+)
+
+// setupMetrics creates the metrics recorder, retaining samples long enough for the widest alert window
+func (s *Server) setupMetrics() {
+	retention := time.Hour
+	for _, rule := range s.alertConfigs() {
+		if cond, err := alert.ParseCondition(rule.When); err == nil && cond.Window > retention {
+			retention = cond.Window
+		}
+	}
+
+	s.metrics = metrics.NewRecorder(retention)
+	s.processManager.SetRestartHook(s.metrics.RecordRestart)
+}
+
+// setupNotifications creates the configured notification sinks
+func (s *Server) setupNotifications() error {
+	s.sinks = make(map[string]notify.Sink)
+
+	for name, sinkConfig := range s.config.Notifications {
+		sink, err := notify.New(name, notify.Config{
+			Type:     sinkConfig.Type,
+			URL:      sinkConfig.URL,
+			Headers:  sinkConfig.Headers,
+			Timeout:  sinkConfig.Timeout,
+			Method:   sinkConfig.Method,
+			Template: sinkConfig.Template,
+			From:     sinkConfig.From,
+			To:       sinkConfig.To,
+		})
+		if err != nil {
+			return err
+		}
+		s.sinks[name] = sink
+	}
+
+	return nil
+}
+
+// alertConfigs returns the alert rules of every app, with the top-level rules
+// without an app repeated for each app
+func (s *Server) alertConfigs() []config.AlertConfig {
+	var rules []config.AlertConfig
+	for _, app := range s.config.Apps {
+		for _, rule := range app.Alerts {
+			rule.App = app.Name
+			rules = append(rules, rule)
+		}
+	}
+	for _, rule := range s.config.Alerts {
+		if rule.App != "" {
+			rules = append(rules, rule)
+			continue
+		}
+		for _, app := range s.config.Apps {
+			rule.App = app.Name
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// setupAlertEngine builds the alert rules engine from the per-app and top-level alert configuration
+func (s *Server) setupAlertEngine(logger *logrus.Logger) error {
+	var rules []alert.Rule
+	for _, ruleConfig := range s.alertConfigs() {
+		cond, err := alert.ParseCondition(ruleConfig.When)
+		if err != nil {
+			return fmt.Errorf("app %s: %w", ruleConfig.App, err)
+		}
+		rules = append(rules, alert.Rule{
+			Name:      ruleConfig.Name,
+			App:       ruleConfig.App,
+			Condition: cond,
+			Notify:    ruleConfig.NotifyTargets(),
+		})
+	}
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	engine, err := alert.NewEngine(rules, s.sinks, alertSource{s.metrics, s}, logger)
+	if err != nil {
+		return err
+	}
+
+	s.alertEngine = engine
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Alert engine configured with %d rules", len(rules)))
+	return nil
+}
+
+// alertSource measures alert conditions: requests and restarts from the
+// metrics recorder, certificate expiry from the served certificates
+type alertSource struct {
+	*metrics.Recorder
+	server *Server
+}
+
+// CertExpiry returns the time until the first certificate served for the app expires
+func (a alertSource) CertExpiry(app string) (time.Duration, bool) {
+	var first time.Time
+	for _, host := range a.server.certHealth() {
+		if host.App == app && !host.NotAfter.IsZero() && (first.IsZero() || host.NotAfter.Before(first)) {
+			first = host.NotAfter
+		}
+	}
+	if first.IsZero() {
+		return 0, false
+	}
+	return time.Until(first), true
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// apps returns the configured apps. Registering and removing apps replace the
+// slice rather than changing it, so callers may keep what they got.
+func (s *Server) apps() []config.AppConfig {
+	s.appsMu.RLock()
+	defer s.appsMu.RUnlock()
+	return s.config.Apps
+}
+
+// runtimeApp checks that an app can be added or changed while guvnor runs:
+// job schedules, certificates and autoscale schedules are set up at startup
+func runtimeApp(app config.AppConfig) error {
+	if app.IsJob() {
+		return fmt.Errorf("app %s is a job", app.Name)
+	}
+	if app.TLS.Enabled || len(app.Autoscale.Schedule) > 0 {
+		return fmt.Errorf("app %s uses tls or an autoscale schedule", app.Name)
+	}
+	return nil
+}
+
+// RegisterApp adds an app to the running server and saves it as a drop-in, so
+// it is configured again the next time guvnor starts. It is routed as soon as
+// it is started.
+func (s *Server) RegisterApp(app config.AppConfig) (config.AppConfig, error) {
+	if err := runtimeApp(app); err != nil {
+		return config.AppConfig{}, fmt.Errorf("%w, add it to the configuration and restart guvnor", err)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.appsMu.Lock()
+	defer s.appsMu.Unlock()
+
+	prepared, err := s.config.PrepareApp(app)
+	if err != nil {
+		return config.AppConfig{}, err
+	}
+	if prepared, err = s.config.WriteDropIn(prepared); err != nil {
+		return config.AppConfig{}, err
+	}
+	s.config.Apps = append(append([]config.AppConfig{}, s.config.Apps...), prepared)
+
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Registered %s, saved to %s", app.Name, prepared.Source))
+	return prepared, nil
+}
+
+// RemoveApp stops every instance of an app and removes it from the server, so
+// its hostname is no longer routed. Apps of the configuration file are back the
+// next time guvnor starts; registered apps lose their drop-in.
+func (s *Server) RemoveApp(ctx context.Context, name string) ([]process.StopResult, error) {
+	app := s.appConfig(name)
+	if app == nil {
+		return nil, fmt.Errorf("app %s not found", name)
+	}
+	if app.IsJob() {
+		return nil, fmt.Errorf("app %s is a job, remove it from the configuration to stop its schedule", name)
+	}
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	var results []process.StopResult
+	if len(s.processManager.GetInstances(name)) > 0 {
+		var err error
+		if results, err = s.processManager.StopWithResults(ctx, name); err != nil {
+			return results, err
+		}
+	}
+	s.processManager.Forget(name)
+
+	s.appsMu.Lock()
+	apps := make([]config.AppConfig, 0, len(s.config.Apps))
+	for _, configured := range s.config.Apps {
+		if configured.Name != name {
+			apps = append(apps, configured)
+		}
+	}
+	s.config.Apps = apps
+	s.appsMu.Unlock()
+
+	if app.Source != "" {
+		if err := os.Remove(app.Source); err != nil && !os.IsNotExist(err) {
+			return results, fmt.Errorf("removed %s, but not its drop-in: %w", name, err)
+		}
+	}
+
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Removed %s", name))
+	return results, nil
+}
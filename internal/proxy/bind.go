@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// BindError reports a listener that could not be opened, with a hint on how to fix it
+type BindError struct {
+	Listener string // "HTTP" or "HTTPS"
+	Port     int
+	Err      error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("cannot listen for %s on port %d: %v", e.Listener, e.Port, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// Privileged reports whether the port needs privileges this process lacks
+func (e *BindError) Privileged() bool {
+	return e.Port < 1024 && errors.Is(e.Err, os.ErrPermission)
+}
+
+// InUse reports whether another process is listening on the port
+func (e *BindError) InUse() bool {
+	return errors.Is(e.Err, syscall.EADDRINUSE)
+}
+
+// Hint suggests how to make the port available
+func (e *BindError) Hint() string {
+	switch {
+	case e.Privileged():
+		hint := fmt.Sprintf("Port %d is privileged. Either:\n", e.Port)
+		if runtime.GOOS == "linux" {
+			binary, err := os.Executable()
+			if err != nil {
+				binary = "$(which guvnor)"
+			}
+			hint += fmt.Sprintf("  - allow guvnor to bind low ports: sudo setcap 'cap_net_bind_service=+ep' %s\n", binary)
+		}
+		hint += "  - run guvnor with sudo\n"
+		hint += "  - use unprivileged ports in guvnor.yaml: server.http_port: 8080 and server.https_port: 8443"
+		return hint
+	case e.InUse():
+		return fmt.Sprintf("Another process is listening on port %d. Find it with: lsof -i :%d\n"+
+			"or choose another port in guvnor.yaml (server.http_port / server.https_port)", e.Port, e.Port)
+	default:
+		return ""
+	}
+}
+
+// listen opens a listener for one of the proxy ports
+func listen(name string, port int) (net.Listener, error) {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, &BindError{Listener: name, Port: port, Err: err}
+	}
+	return listener, nil
+}
@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// catchAllApp returns the app serving hostnames no other app matches, if the
+// catch-all action is app
+func (s *Server) catchAllApp() *config.AppConfig {
+	if s.config.Server.CatchAll.Action != config.CatchAllApp {
+		return nil
+	}
+	return s.appConfig(s.config.Server.CatchAll.App)
+}
+
+// handleCatchAll answers a request for a hostname no app serves with the
+// configured catch-all action: a 404, a redirect, or no response at all
+func (s *Server) handleCatchAll(rw *responseWriter, r *http.Request, startTime time.Time) {
+	catchAll := s.config.Server.CatchAll
+	switch catchAll.Action {
+	case config.CatchAllDrop:
+		s.logApacheFormat(r, rw, 444, time.Since(startTime), "-")
+		s.logger.WithField("host", r.Host).Debug("Dropped request for unknown domain")
+		// Aborting the handler closes the connection, or resets the HTTP/2
+		// stream, without writing a response
+		panic(http.ErrAbortHandler)
+	case config.CatchAllRedirect:
+		http.Redirect(rw, r, catchAll.URL, http.StatusFound)
+		s.logApacheFormat(r, rw, http.StatusFound, time.Since(startTime), "-")
+	default:
+		s.logApacheFormat(r, rw, 404, time.Since(startTime), "-")
+		s.logger.Warn("No application found for domain", "host", r.Host)
+		s.processManager.GetLogManager().Log("proxy-server", "warn", fmt.Sprintf("No application found for domain: %s", r.Host))
+		http.Error(rw, "Domain not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/events"
+)
+
+// certHealth reports the certificate served for each TLS hostname: where it
+// comes from, how many days it has left and whether that is within the alert
+// window. Passthrough apps terminate TLS themselves and are left out.
+func (s *Server) certHealth() []cert.HostCertificate {
+	now := time.Now()
+	alertBefore := s.config.TLS.Renewal.AlertBefore
+
+	var acmeCerts []cert.CertInfo
+	if s.config.TLS.AutoCert {
+		var err error
+		if acmeCerts, err = cert.ScanCertificates(s.config.TLS.CertDir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logger.WithError(err).Warn("Failed to scan certificates")
+		}
+	}
+	issuanceErrors := make(map[string]string)
+	if s.advancedCertMgr != nil {
+		for _, status := range s.advancedCertMgr.IssuanceStatus() {
+			issuanceErrors[status.Hostname] = status.LastError
+		}
+	}
+
+	var hosts []cert.HostCertificate
+	for _, app := range s.apps() {
+		hostname := strings.ToLower(app.Hostname)
+		if hostname == "" {
+			hostname = strings.ToLower(app.Domain) // Backward compatibility
+		}
+		if !app.TLS.Enabled || app.TLS.Passthrough || hostname == "" {
+			continue
+		}
+
+		var source string
+		var notAfter time.Time
+		switch {
+		case app.TLS.CertFile != "" && s.certStore != nil:
+			source = cert.SourceFile
+			if served, ok := s.certStore.GetCertificate(&tls.ClientHelloInfo{ServerName: hostname}); ok {
+				notAfter = served.Leaf.NotAfter
+			}
+		case s.localCA != nil && (cert.IsLocalHostname(hostname) || !s.config.TLS.AutoCert):
+			source = cert.SourceLocalCA
+			if served, err := s.localCA.GetCertificate(&tls.ClientHelloInfo{ServerName: hostname}); err == nil && served.Leaf != nil {
+				notAfter = served.Leaf.NotAfter
+			}
+		case s.config.TLS.AutoCert:
+			source = cert.SourceACME
+			if info, ok := cert.FindCertificate(acmeCerts, hostname); ok {
+				notAfter = info.NotAfter
+			}
+		default:
+			continue // Served with the default certificate, if any
+		}
+
+		host := cert.NewHostCertificate(hostname, app.Name, source, notAfter, alertBefore, now)
+		host.LastError = issuanceErrors[hostname]
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// watchCertExpiry publishes a cert_expiring event for every served certificate
+// within the alert window or past its expiry, at startup and then at each
+// renewal check interval until ctx is done
+func (s *Server) watchCertExpiry(ctx context.Context) {
+	interval := s.config.TLS.Renewal.CheckInterval
+	if interval <= 0 {
+		interval = cert.DefaultCheckInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, host := range s.certHealth() {
+				if host.Status == cert.HealthExpiring || host.Status == cert.HealthExpired {
+					s.publishCertExpiring(host)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// publishCertExpiring publishes the certificate of a hostname running out
+func (s *Server) publishCertExpiring(host cert.HostCertificate) {
+	message := fmt.Sprintf("Certificate for %s expires in %d days, at %s", host.Hostname, host.DaysRemaining, host.NotAfter.Format(time.RFC3339))
+	if host.Status == cert.HealthExpired {
+		message = fmt.Sprintf("Certificate for %s expired at %s", host.Hostname, host.NotAfter.Format(time.RFC3339))
+	}
+	if host.LastError != "" {
+		message += ": " + host.LastError
+	}
+	s.events.Publish(events.Event{
+		Type:    events.CertExpiring,
+		App:     host.App,
+		Message: message,
+		Fields: map[string]string{
+			"hostname":       host.Hostname,
+			"source":         host.Source,
+			"status":         host.Status,
+			"not_after":      host.NotAfter.Format(time.RFC3339),
+			"days_remaining": strconv.Itoa(host.DaysRemaining),
+		},
+	})
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+
+	"github.com/gleicon/guvnor/internal/cert"
+)
+
+// setupCertStore loads the certificate of every app with a cert_file, and the
+// default certificate
+func (s *Server) setupCertStore() error {
+	store := cert.NewStore(s.logger.Logger)
+	if s.config.TLS.DefaultCertFile != "" {
+		if err := store.SetDefault(s.config.TLS.DefaultCertFile, s.config.TLS.DefaultKeyFile); err != nil {
+			return fmt.Errorf("tls default certificate: %w", err)
+		}
+	}
+	for _, app := range s.config.Apps {
+		if app.TLS.CertFile == "" {
+			continue
+		}
+		hostname := app.Hostname
+		if hostname == "" {
+			hostname = app.Domain // Backward compatibility
+		}
+		if err := store.Add([]string{hostname}, app.TLS.CertFile, app.TLS.KeyFile); err != nil {
+			return fmt.Errorf("app %s: %w", app.Name, err)
+		}
+	}
+	if !store.Empty() {
+		s.certStore = store
+	}
+	return nil
+}
+
+// withStoredCertificates serves the certificates loaded from files for their
+// hostnames and falls back to next, if any, for everything else
+func (s *Server) withStoredCertificates(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if cert, ok := s.certStore.GetCertificate(hello); ok {
+			return cert, nil
+		}
+		if next == nil {
+			return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+		}
+		return next(hello)
+	}
+}
+
+// withDefaultCertificate serves the default certificate when next has none for
+// the hostname, such as for unknown hostnames or clients that send no SNI,
+// instead of failing the handshake
+func (s *Server) withDefaultCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := next(hello)
+		if err == nil && cert != nil {
+			return cert, nil
+		}
+		if fallback, ok := s.certStore.Default(); ok {
+			s.logger.WithField("server_name", hello.ServerName).WithError(err).Debug("Serving default certificate")
+			return fallback, nil
+		}
+		return cert, err
+	}
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIPResolver determines the real client address, honoring forwarding
+// headers only when they were added by a trusted proxy hop
+type clientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// newClientIPResolver parses trusted proxy CIDRs or bare IP addresses
+func newClientIPResolver(trustedProxies []string) (*clientIPResolver, error) {
+	resolver := &clientIPResolver{}
+
+	for _, entry := range trustedProxies {
+		network, err := parseCIDROrIP(entry)
+		if err != nil {
+			return nil, err
+		}
+		resolver.trusted = append(resolver.trusted, network)
+	}
+
+	return resolver, nil
+}
+
+// parseCIDROrIP parses "10.0.0.0/8" or "10.0.0.1" into a network
+func parseCIDROrIP(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		return network, nil
+	}
+
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+	}
+	bits := 32
+	if ip.To4() == nil {
+		bits = 128
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// isTrusted reports whether the address belongs to a trusted proxy
+func (c *clientIPResolver) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range c.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP of the directly connected peer
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// fromTrustedProxy reports whether the request arrived through a trusted hop
+func (c *clientIPResolver) fromTrustedProxy(r *http.Request) bool {
+	return c.isTrusted(remoteIP(r))
+}
+
+// ClientIP returns the client address for the request. Forwarded, X-Forwarded-For
+// and X-Real-IP are only consulted when the peer is a trusted proxy, and the chain is
+// walked right to left so entries appended by untrusted clients cannot be spoofed.
+func (c *clientIPResolver) ClientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !c.isTrusted(peer) {
+		return peer
+	}
+
+	chain := forwardedChain(r)
+	if len(chain) == 0 {
+		if xr := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(xr) != nil {
+			return xr
+		}
+		return peer
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !c.isTrusted(chain[i]) {
+			return chain[i]
+		}
+	}
+
+	// Every hop is trusted, the leftmost is the original client
+	return chain[0]
+}
+
+// forwardedChain returns client addresses from the Forwarded header (RFC 7239),
+// falling back to X-Forwarded-For. Unparseable or obfuscated entries are skipped.
+func forwardedChain(r *http.Request) []string {
+	var chain []string
+
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range splitHeaderList(values) {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				if ip := parseForwardedNode(value); ip != "" {
+					chain = append(chain, ip)
+				}
+			}
+		}
+		return chain
+	}
+
+	for _, entry := range splitHeaderList(r.Header.Values("X-Forwarded-For")) {
+		if ip := parseForwardedNode(entry); ip != "" {
+			chain = append(chain, ip)
+		}
+	}
+	return chain
+}
+
+// splitHeaderList splits comma separated header values
+func splitHeaderList(values []string) []string {
+	var items []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// parseForwardedNode extracts the IP from a node such as `"[2001:db8::1]:4711"` or `192.0.2.43:80`
+func parseForwardedNode(node string) string {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			node = node[1:end]
+		}
+	} else if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+
+	if net.ParseIP(node) == nil {
+		return "" // "unknown" or obfuscated identifiers
+	}
+	return node
+}
+
+// forwardedElement builds an RFC 7239 Forwarded element for the current hop
+func forwardedElement(clientIP, host, proto string) string {
+	forValue := clientIP
+	if ip := net.ParseIP(clientIP); ip != nil && ip.To4() == nil {
+		forValue = fmt.Sprintf(`"[%s]"`, clientIP)
+	}
+
+	element := "for=" + forValue
+	if host != "" {
+		element += fmt.Sprintf(`;host="%s"`, host)
+	}
+	return element + ";proto=" + proto
+}
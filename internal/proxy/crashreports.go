@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"strconv"
+
+	"github.com/gleicon/guvnor/internal/crash"
+	"github.com/gleicon/guvnor/internal/events"
+)
+
+// setupCrashReports saves a diagnostic bundle whenever an instance is given up
+// on: it failed, crash-looped, or crashed without a restart policy
+func (s *Server) setupCrashReports() {
+	settings := s.config.Server.CrashReports
+	if settings.Disabled {
+		return
+	}
+	store := crash.NewStore(s.config.Server.CrashDir(), settings.Kept())
+	logger := s.logger.WithField("component", "crash")
+
+	// The handler runs on one goroutine, so these need no lock
+	pids := make(map[string]string)
+	crashes := make(map[string]map[string]string)
+	s.events.Subscribe(func(e events.Event) {
+		switch e.Type {
+		case events.Started:
+			pids[e.Instance] = e.Fields["pid"]
+			delete(crashes, e.Instance)
+			return
+		case events.Crashed:
+			crashes[e.Instance] = e.Fields
+			if proc, exists := s.processManager.GetProcess(e.Instance); !exists || proc.Config.RestartPolicy.Enabled {
+				return // The restart policy decides
+			}
+		}
+
+		report := s.crashReport(e, pids[e.Instance], crashes[e.Instance])
+		entries := s.processManager.GetLogManager().GetProcessLogs(e.Instance, settings.Lines())
+		if err := store.Save(report, entries); err != nil {
+			logger.WithError(err).WithField("instance", e.Instance).Error("Failed to save crash report")
+			return
+		}
+		logger.WithField("instance", e.Instance).WithField("report", report.ID).Warn("Saved crash report (see: guvnor crashes)")
+	}, events.Started, events.Crashed, events.Failed, events.CrashLoop)
+}
+
+// crashReport describes the failure of an instance from its last crash and
+// what its process still knows
+func (s *Server) crashReport(e events.Event, pid string, crashed map[string]string) *crash.Report {
+	report := &crash.Report{
+		App:      e.App,
+		Instance: e.Instance,
+		Time:     e.Time,
+		Reason:   e.Type,
+		Message:  e.Message,
+		ExitCode: -1,
+		Error:    crashed["error"],
+		Signal:   crash.SignalOf(crashed["error"]),
+		CoreDump: crashed["core_dump"],
+		System:   crash.ReadSystem(),
+	}
+	if e.Type == events.Crashed {
+		report.Reason = events.Failed
+	}
+	if code, err := strconv.Atoi(crashed["exit_code"]); err == nil {
+		report.ExitCode = code
+	}
+	if crashed["pid"] != "" {
+		pid = crashed["pid"]
+	}
+	report.PID, _ = strconv.Atoi(pid)
+
+	proc, exists := s.processManager.GetProcess(e.Instance)
+	if !exists {
+		return report
+	}
+	report.Command = proc.Config.CommandLine()
+	report.WorkingDir = proc.Config.WorkingDir
+	report.Restarts = proc.GetRestartCount()
+	report.RestartHistory = proc.RestartHistory()
+	report.Environment = crash.Redact(proc.Environment(), proc.Config.Environment)
+	if usage, sampled := proc.GetUsage(); sampled {
+		report.Usage = &usage
+	}
+	return report
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// debugPath is the built-in route that echoes how guvnor handles the current request
+const debugPath = "/_guvnor/debug"
+
+// debugInfo describes how a request is routed and rewritten
+type debugInfo struct {
+	App       string            `json:"app"`
+	Match     debugMatch        `json:"match"`
+	Instances []debugInstance   `json:"instances"`
+	Client    debugClient       `json:"client"`
+	Injected  map[string]string `json:"injected_headers"`
+	Removed   []string          `json:"removed_headers,omitempty"`
+	TLS       *debugTLS         `json:"tls,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+type debugMatch struct {
+	Host      string `json:"host"`
+	MatchedBy string `json:"matched_by"` // "hostname" or "domain"
+	Value     string `json:"value"`
+}
+
+type debugInstance struct {
+	Name    string `json:"name"`
+	Port    int    `json:"port"`
+	Running bool   `json:"running"`
+}
+
+type debugClient struct {
+	RemoteAddr     string `json:"remote_addr"`
+	TrustedProxy   bool   `json:"trusted_proxy"`
+	ForwardedFor   string `json:"x_forwarded_for,omitempty"`
+	Forwarded      string `json:"forwarded,omitempty"`
+	ResolvedIP     string `json:"resolved_ip"`
+	ResolutionRule string `json:"resolution"`
+}
+
+type debugTLS struct {
+	Version     string   `json:"version"`
+	CipherSuite string   `json:"cipher_suite"`
+	ServerName  string   `json:"server_name,omitempty"`
+	ALPN        string   `json:"alpn,omitempty"`
+	PeerCerts   []string `json:"peer_certificates,omitempty"`
+}
+
+// handleDebug serves the debug route for apps that opted in. It reports false when
+// the request is not a debug request and should be proxied normally.
+func (s *Server) handleDebug(rw *responseWriter, r *http.Request, app *config.AppConfig) bool {
+	if !app.Debug.Enabled || r.URL.Path != debugPath {
+		return false
+	}
+
+	if !debugAuthorized(r, app.Debug.Token) {
+		rw.Header().Set("WWW-Authenticate", `Bearer realm="guvnor-debug"`)
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return true
+	}
+
+	info := debugInfo{
+		App:       app.Name,
+		Match:     debugMatch{Host: r.Host, MatchedBy: "hostname", Value: app.Hostname},
+		Injected:  make(map[string]string),
+		RequestID: requestIDFrom(r),
+	}
+	if app.Hostname == "" {
+		info.Match.MatchedBy = "domain"
+		info.Match.Value = app.Domain
+	}
+
+	for _, proc := range s.processManager.GetInstances(app.Name) {
+		info.Instances = append(info.Instances, debugInstance{
+			Name:    proc.Config.Name,
+			Port:    proc.Config.Port,
+			Running: proc.IsRunning(),
+		})
+	}
+
+	trusted := s.clientIPs.fromTrustedProxy(r)
+	info.Client = debugClient{
+		RemoteAddr:     r.RemoteAddr,
+		TrustedProxy:   trusted,
+		ForwardedFor:   r.Header.Get("X-Forwarded-For"),
+		Forwarded:      r.Header.Get("Forwarded"),
+		ResolvedIP:     s.getClientIP(r),
+		ResolutionRule: "peer address (forwarding headers ignored from untrusted peers)",
+	}
+	if trusted {
+		info.Client.ResolutionRule = "first untrusted hop in Forwarded/X-Forwarded-For"
+	}
+
+	// Run the same header rewrite used for proxying on a copy of the request
+	upstream := r.Clone(r.Context())
+	s.rewriteUpstreamHeaders(upstream, r, app)
+	for name, values := range upstream.Header {
+		value := strings.Join(values, ", ")
+		if strings.Join(r.Header.Values(name), ", ") != value {
+			info.Injected[name] = value
+		}
+	}
+	for name := range r.Header {
+		if _, exists := upstream.Header[name]; !exists {
+			info.Removed = append(info.Removed, name)
+		}
+	}
+
+	if r.TLS != nil {
+		info.TLS = &debugTLS{
+			Version:     tls.VersionName(r.TLS.Version),
+			CipherSuite: tls.CipherSuiteName(r.TLS.CipherSuite),
+			ServerName:  r.TLS.ServerName,
+			ALPN:        r.TLS.NegotiatedProtocol,
+		}
+		for _, cert := range r.TLS.PeerCertificates {
+			info.TLS.PeerCerts = append(info.TLS.PeerCerts, cert.Subject.String())
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(rw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		s.logger.WithError(err).Error("Failed to encode debug response")
+	}
+	return true
+}
+
+// debugAuthorized checks the bearer token (or X-Guvnor-Debug-Token header) in constant time
+func debugAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	provided := r.Header.Get("X-Guvnor-Debug-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		provided = strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
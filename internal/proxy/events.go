@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/notify"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// eventSeverity is the notification severity of each event type; health events
+// are critical or resolved depending on the new status
+var eventSeverity = map[string]string{
+	events.Started:           "info",
+	events.Stopped:           "info",
+	events.Crashed:           "warning",
+	events.Restarted:         "info",
+	events.CrashLoop:         "critical",
+	events.Failed:            "critical",
+	events.CertRenewed:       "info",
+	events.CertRenewalFailed: "critical",
+	events.CertExpiring:      "warning",
+}
+
+// setupEvents creates the event bus, feeds it health transitions and sends the
+// events selected in the config to notification sinks. Certificate managers
+// publish renewals themselves, and process events are forwarded once started.
+func (s *Server) setupEvents() {
+	s.events = events.NewBus(s.logger.Logger)
+
+	s.healthChecker.SetTransitionHook(func(name string, previous, current health.Result) {
+		app, port := name, 0
+		if proc, exists := s.processManager.GetProcess(name); exists {
+			app, port = proc.AppName(), proc.Config.Port
+		}
+		hostname := ""
+		if appConfig := s.appConfig(app); appConfig != nil {
+			hostname = appConfig.Hostname
+		}
+		s.events.Publish(events.Event{
+			Type:     events.Health,
+			App:      app,
+			Instance: name,
+			Message:  fmt.Sprintf("Health check for %s changed from %s to %s", name, previous.Status, current.Status),
+			Time:     current.Timestamp,
+			Fields: map[string]string{
+				"hostname":        hostname,
+				"port":            strconv.Itoa(port),
+				"status":          string(current.Status),
+				"previous_status": string(previous.Status),
+				"status_code":     strconv.Itoa(current.StatusCode),
+				"error":           current.Error,
+			},
+		})
+	})
+
+	for _, rule := range s.config.Events {
+		apps := make(map[string]bool)
+		for _, app := range rule.Apps {
+			apps[app] = true
+		}
+		targets := rule.Notify
+		s.events.Subscribe(func(e events.Event) {
+			if len(apps) > 0 && !apps[e.App] {
+				return
+			}
+			n := eventNotification(e)
+			for _, target := range targets {
+				s.deliver(s.sinks[target], n)
+			}
+		}, rule.Types...)
+	}
+}
+
+// certIssued publishes the renewal of a certificate
+func (s *Server) certIssued(domains []string, notAfter time.Time) {
+	if s.certRenewer != nil {
+		s.certRenewer.Refresh()
+	}
+	s.events.Publish(events.Event{
+		Type:    events.CertRenewed,
+		Message: fmt.Sprintf("Certificate for %s issued, valid until %s", strings.Join(domains, ", "), notAfter.Format(time.RFC3339)),
+		Fields: map[string]string{
+			"domains":   strings.Join(domains, ","),
+			"not_after": notAfter.Format(time.RFC3339),
+		},
+	})
+}
+
+// forwardProcessEvents publishes the lifecycle events of processes until ctx is done
+func (s *Server) forwardProcessEvents(ctx context.Context) {
+	processEvents, unsubscribe := s.processManager.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-processEvents:
+				if e.Type == process.EventAdded || e.Type == process.EventRemoved {
+					continue
+				}
+				s.events.Publish(events.Event{
+					Type:     e.Type,
+					App:      e.Process.AppName(),
+					Instance: e.Name,
+					Message:  processEventMessage(e),
+					Fields:   e.Fields,
+				})
+			}
+		}
+	}()
+}
+
+// processEventMessage describes a process lifecycle event
+func processEventMessage(e process.Event) string {
+	switch e.Type {
+	case process.EventStarted:
+		return fmt.Sprintf("%s started with pid %s", e.Name, e.Fields["pid"])
+	case process.EventStopped:
+		return fmt.Sprintf("%s was stopped", e.Name)
+	case process.EventCrashed:
+		if code, ok := e.Fields["exit_code"]; ok {
+			return fmt.Sprintf("%s exited with code %s", e.Name, code)
+		}
+		return fmt.Sprintf("%s exited unexpectedly", e.Name)
+	case process.EventRestarted:
+		if e.Fields["rolling"] == "true" {
+			return fmt.Sprintf("%s was replaced by a rolling restart", e.Name)
+		}
+		return fmt.Sprintf("%s was restarted", e.Name)
+	case process.EventCrashLoop:
+		return fmt.Sprintf("%s crashed %s times within %s and is no longer restarted (clear with: guvnor reset %s)",
+			e.Name, e.Fields["max_restarts"], e.Fields["window"], e.Process.AppName())
+	case process.EventFailed:
+		return fmt.Sprintf("%s crashed after %s restarts and is no longer restarted (clear with: guvnor reset %s)",
+			e.Name, e.Fields["restarts"], e.Process.AppName())
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Type)
+}
+
+// eventNotification turns an event into a notification
+func eventNotification(e events.Event) notify.Notification {
+	subject := e.Instance
+	if subject == "" {
+		subject = e.App
+	}
+
+	title := fmt.Sprintf("%s %s", subject, e.Type)
+	severity := eventSeverity[e.Type]
+	switch e.Type {
+	case events.Health:
+		title = fmt.Sprintf("%s is %s", subject, e.Fields["status"])
+		severity = "resolved"
+		if e.Fields["status"] == string(health.StatusUnhealthy) {
+			severity = "critical"
+		}
+	case events.CrashLoop:
+		title = fmt.Sprintf("%s is crash-looping", subject)
+	case events.CertRenewed:
+		title = fmt.Sprintf("Certificate renewed for %s", e.Fields["domains"])
+	case events.CertRenewalFailed:
+		title = fmt.Sprintf("Certificate renewal failed for %s", e.Fields["domains"])
+	case events.CertExpiring:
+		title = fmt.Sprintf("Certificate for %s expires in %s days", e.Fields["hostname"], e.Fields["days_remaining"])
+		if e.Fields["status"] == cert.HealthExpired {
+			title = fmt.Sprintf("Certificate for %s has expired", e.Fields["hostname"])
+			severity = "critical"
+		}
+	}
+
+	fields := map[string]string{"event": e.Type}
+	if e.Instance != "" {
+		fields["instance"] = e.Instance
+	}
+	for key, value := range e.Fields {
+		fields[key] = value
+	}
+
+	return notify.Notification{
+		Title:     title,
+		Message:   e.Message,
+		App:       e.App,
+		Severity:  severity,
+		Timestamp: e.Time,
+		Fields:    fields,
+	}
+}
+
+// deliver sends a notification, logging failures
+func (s *Server) deliver(sink notify.Sink, n notify.Notification) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := sink.Send(ctx, n); err != nil {
+		s.logger.WithError(err).WithField("app", n.App).WithField("sink", sink.Name()).Error("Failed to deliver notification")
+	}
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// flagsPath is the built-in route backends read their app's feature flags from
+const flagsPath = "/_guvnor/flags"
+
+// handleFlags serves the app's feature flags to clients on this host. It reports
+// false when the request is not a flags request and should be proxied normally.
+func (s *Server) handleFlags(rw *responseWriter, r *http.Request, app *config.AppConfig) bool {
+	if s.flags == nil || r.URL.Path != flagsPath {
+		return false
+	}
+
+	// Backends run on this host; forwarding headers are not trusted here
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return true
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("Cache-Control", "no-store")
+	response := map[string]interface{}{"app": app.Name, "flags": s.flags.Get(app.Name)}
+	if err := json.NewEncoder(rw).Encode(response); err != nil {
+		s.logger.WithError(err).Error("Failed to encode flags response")
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// responseHeaders returns the default response headers for an app: the server-wide
+// defaults overridden by the app's own. An empty app value removes a server default.
+// A nil app yields the server defaults, used for responses no app handles. Responses
+// sent over TLS also get the HSTS header of the TLS policy.
+func (s *Server) responseHeaders(app *config.AppConfig, secure bool) map[string]string {
+	hsts := ""
+	if secure {
+		hsts = s.config.TLS.HSTS.Header()
+	}
+	if hsts == "" && (app == nil || len(app.ResponseHeaders) == 0) {
+		return s.config.Server.DefaultResponseHeaders
+	}
+
+	merged := make(map[string]string, len(s.config.Server.DefaultResponseHeaders)+2)
+	if hsts != "" {
+		merged["Strict-Transport-Security"] = hsts
+	}
+	for name, value := range s.config.Server.DefaultResponseHeaders {
+		merged[http.CanonicalHeaderKey(name)] = value
+	}
+	if app == nil {
+		return merged
+	}
+	for name, value := range app.ResponseHeaders {
+		if value == "" {
+			delete(merged, http.CanonicalHeaderKey(name))
+			continue
+		}
+		merged[http.CanonicalHeaderKey(name)] = value
+	}
+	return merged
+}
+
+// applyDefaultHeaders sets every default header the response does not already carry
+func applyDefaultHeaders(header http.Header, defaults map[string]string) {
+	for name, value := range defaults {
+		if value == "" || header.Get(name) != "" {
+			continue
+		}
+		header.Set(name, value)
+	}
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/notify"
+)
+
+// setupHealthWebhooks posts health transitions to the webhook configured per app
+func (s *Server) setupHealthWebhooks() error {
+	hooks := make(map[string]notify.Sink)
+
+	for _, app := range s.config.Apps {
+		if app.HealthCheck.Webhook == "" {
+			continue
+		}
+		sink, err := notify.New(app.Name+"-health", notify.Config{Type: "webhook", URL: app.HealthCheck.Webhook})
+		if err != nil {
+			return err
+		}
+		hooks[app.Name] = sink
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	// Health events are published per instance; webhooks are configured per app
+	s.events.Subscribe(func(e events.Event) {
+		if sink, exists := hooks[e.App]; exists {
+			s.deliver(sink, eventNotification(e))
+		}
+	}, events.Health)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// roundRobin hands out a rotating counter per app
+type roundRobin struct {
+	counters map[string]*uint64
+	mu       sync.Mutex
+}
+
+func newRoundRobin() *roundRobin {
+	return &roundRobin{counters: make(map[string]*uint64)}
+}
+
+// next returns the next counter value for an app
+func (rr *roundRobin) next(app string) uint64 {
+	rr.mu.Lock()
+	counter, exists := rr.counters[app]
+	if !exists {
+		counter = new(uint64)
+		rr.counters[app] = counter
+	}
+	rr.mu.Unlock()
+
+	return atomic.AddUint64(counter, 1) - 1
+}
+
+// selectInstance picks a running instance of the app in round-robin order, skipping
+// instances that are not ready. warming is true when instances are running but
+// none of them accepts traffic yet.
+func (s *Server) selectInstance(app *config.AppConfig) (proc *process.Process, warming bool) {
+	var running []*process.Process
+	for _, instance := range s.processManager.GetInstances(app.Name) {
+		if instance.IsRunning() {
+			running = append(running, instance)
+		}
+	}
+	if len(running) == 0 {
+		return nil, false
+	}
+	return s.pickInstance(app, running, s.balancer.next(app.Name))
+}
+
+// pickInstance picks one of the running instances, starting at start. Slow
+// start shifts traffic away from instances early in their ramp towards the
+// others, but never sheds it: a ramping instance takes the request when no
+// other ready instance does.
+func (s *Server) pickInstance(app *config.AppConfig, running []*process.Process, start uint64) (proc *process.Process, warming bool) {
+	var ramping *process.Process
+	for i := range running {
+		candidate := running[(start+uint64(i))%uint64(len(running))]
+		if !s.healthChecker.Ready(candidate) {
+			continue
+		}
+		ready, weight := s.warmupWeight(app, candidate)
+		if !ready {
+			continue
+		}
+		if weight >= 1 || rand.Float64() < weight {
+			return candidate, false
+		}
+		if ramping == nil {
+			ramping = candidate
+		}
+	}
+	if ramping != nil {
+		return ramping, false
+	}
+	return nil, true
+}
+
+// selectFallback picks another instance to retry a request that could not reach
+// failed. Instances that are not ready, still warming up or whose last health
+// check failed are skipped; nil means there is no alternative.
+func (s *Server) selectFallback(app *config.AppConfig, failed *process.Process) *process.Process {
+	instances := s.processManager.GetInstances(app.Name)
+	if len(instances) < 2 {
+		return nil
+	}
+
+	start := s.balancer.next(app.Name)
+	for i := range instances {
+		candidate := instances[(start+uint64(i))%uint64(len(instances))]
+		if candidate == failed || !candidate.IsRunning() || !s.healthChecker.Ready(candidate) || s.warmingUp(app, candidate) {
+			continue
+		}
+		if result, ok := s.healthChecker.GetResult(candidate.Config.Name); ok && result.Status == health.StatusUnhealthy {
+			continue
+		}
+		return candidate
+	}
+
+	return nil
+}
+
+// readinessCheck returns the health check deciding whether an instance can take
+// traffic: the readiness probe when configured, the plain health check otherwise
+func readinessCheck(app *config.AppConfig) config.HealthCheckConfig {
+	if probe, ok := app.HealthCheck.Probe(config.ProbeReadiness); ok {
+		return app.HealthCheck.Request(probe)
+	}
+	return app.HealthCheck
+}
+
+// canHedge reports whether a request is safe to send to a second instance:
+// GET and HEAD requests without a body
+func canHedge(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return r.ContentLength == 0 && len(r.TransferEncoding) == 0
+}
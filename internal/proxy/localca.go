@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"crypto/tls"
+
+	"github.com/gleicon/guvnor/internal/cert"
+)
+
+// setupLocalCA loads or generates the CA issuing certificates for development hostnames
+func (s *Server) setupLocalCA() error {
+	dir := s.config.TLS.LocalCA.Dir
+	if dir == "" {
+		var err error
+		if dir, err = cert.DefaultLocalCADir(); err != nil {
+			return err
+		}
+	}
+	ca, err := cert.LoadLocalCA(dir, s.logger.Logger)
+	if err != nil {
+		return err
+	}
+	s.localCA = ca
+	s.logger.WithField("ca_file", ca.CertFile()).Info("Serving development hostnames with certificates from the local CA")
+	return nil
+}
+
+// withLocalCertificates serves local hostnames such as myapp.localhost from
+// the local CA and falls back to next for the others. Without next, as when
+// auto_cert is disabled, every hostname is served from the local CA.
+func (s *Server) withLocalCertificates(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if next == nil || cert.IsLocalHostname(hello.ServerName) {
+			return s.localCA.GetCertificate(hello)
+		}
+		return next(hello)
+	}
+}
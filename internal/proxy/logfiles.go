@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// pruneInterval is how often the log directory is checked against the retention limits
+const pruneInterval = time.Minute
+
+// maxLogBackups bounds the rotated files of an app without a size limit
+const maxLogBackups = 1000
+
+// logFiles writes the log entries of each app, instances included, to a
+// rotating file of its own in the log directory
+type logFiles struct {
+	dir       string
+	fileSize  int64
+	retention logs.Retention
+
+	mu    sync.Mutex
+	files map[string]*logs.RotatingFile
+}
+
+// write appends an entry to the file of its app, opening it on first use
+func (l *logFiles) write(entry logs.LogEntry) error {
+	app := process.AppOfInstance(entry.Process)
+
+	l.mu.Lock()
+	if l.files == nil {
+		l.mu.Unlock()
+		return nil // Closed at shutdown
+	}
+	file, exists := l.files[app]
+	if !exists {
+		// Rotation keeps about as many files as the app may take, pruning does the rest
+		limit, set := l.retention.Apps[app]
+		if !set {
+			limit = l.retention.MaxApp
+		}
+		backups := maxLogBackups
+		if limit > 0 {
+			backups = int(limit/l.fileSize) + 1
+		}
+		var err error
+		if file, err = logs.OpenRotatingFile(filepath.Join(l.dir, app+".log"), l.fileSize, 0, backups); err != nil {
+			l.mu.Unlock()
+			return err
+		}
+		l.files[app] = file
+	}
+	l.mu.Unlock()
+
+	_, err := file.Write([]byte(logs.Format(entry, false) + "\n"))
+	return err
+}
+
+// close closes every open file; later entries are not written
+func (l *logFiles) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, file := range l.files {
+		file.Close()
+	}
+	l.files = nil
+}
+
+// setupLogFiles writes every log entry to the file of its app when logs.dir is set
+func (s *Server) setupLogFiles() error {
+	dir := s.config.Logs.Dir
+	if dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create log directory %s: %w", dir, err)
+	}
+
+	s.logFiles = &logFiles{
+		dir:       dir,
+		fileSize:  s.config.Logs.Retention.FileSize(),
+		retention: s.config.Logs.Retention.Policy(),
+		files:     make(map[string]*logs.RotatingFile),
+	}
+	var failing sync.Once
+	s.processManager.GetLogManager().AddHook(func(entry logs.LogEntry) {
+		if err := s.logFiles.write(entry); err != nil {
+			// Logging the failure would come back here
+			failing.Do(func() { s.logger.WithError(err).Error("Failed to write log file") })
+		}
+	})
+	return nil
+}
+
+// pruneLogFiles removes the oldest rotated log files beyond the retention
+// limits now and every pruneInterval until ctx is done
+func (s *Server) pruneLogFiles(ctx context.Context) {
+	if s.logFiles == nil {
+		return
+	}
+	prune := func() {
+		pruned, err := logs.Prune(s.logFiles.dir, s.logFiles.retention, time.Now(), false)
+		if err != nil {
+			s.logger.WithError(err).Warn("Failed to prune log files")
+		}
+		for _, file := range pruned {
+			s.logger.WithField("file", file.Path).WithField("reason", file.Reason).Info("Pruned log file")
+		}
+	}
+
+	prune()
+	go func() {
+		ticker := time.NewTicker(pruneInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				prune()
+			}
+		}
+	}()
+}
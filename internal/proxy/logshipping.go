@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/logship"
+)
+
+// setupLogShipping creates a shipper for every configured log sink and
+// forwards each entry of the log buffer to them
+func (s *Server) setupLogShipping(logger *logrus.Logger) error {
+	for name, sinkConfig := range s.config.Logs.Sinks {
+		sink, err := logship.New(name, logship.Config{
+			Type:     sinkConfig.Type,
+			Address:  sinkConfig.Address,
+			URL:      sinkConfig.URL,
+			Facility: sinkConfig.Facility,
+			Tag:      sinkConfig.Tag,
+			Labels:   sinkConfig.Labels,
+			Headers:  sinkConfig.Headers,
+			Timeout:  sinkConfig.Timeout,
+		})
+		if err != nil {
+			return err
+		}
+		s.logShippers = append(s.logShippers, logship.NewShipper(sink, sinkConfig.Buffer, sinkConfig.Timeout, logger))
+	}
+
+	if len(s.logShippers) == 0 {
+		return nil
+	}
+	shippers := s.logShippers
+	s.processManager.GetLogManager().AddHook(func(entry logs.LogEntry) {
+		for _, shipper := range shippers {
+			shipper.Ship(entry)
+		}
+	})
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Shipping logs to %d sinks", len(shippers)))
+	return nil
+}
+
+// stopLogShipping sends what the shippers still hold, waiting until ctx is done
+func (s *Server) stopLogShipping(ctx context.Context) {
+	for _, shipper := range s.logShippers {
+		shipper.Stop(ctx)
+	}
+}
@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// clientCertHeaders are set from the verified client certificate of apps with
+// client_auth; values sent by clients are always dropped
+var clientCertHeaders = []string{
+	"X-Client-Cert-Verified",
+	"X-Client-Cert-CN",
+	"X-Client-Cert-Subject",
+	"X-Client-Cert-Issuer",
+	"X-Client-Cert-Serial",
+	"X-Client-Cert-Not-After",
+}
+
+// clientAuth is how the client certificates of a hostname are verified
+type clientAuth struct {
+	mode tls.ClientAuthType
+	cas  *x509.CertPool
+}
+
+// setupClientAuth loads the CA bundles of the apps verifying client
+// certificates, keyed by hostname
+func (s *Server) setupClientAuth() error {
+	for _, app := range s.config.Apps {
+		if !app.TLS.ClientAuth.Enabled() {
+			continue
+		}
+		data, err := os.ReadFile(app.TLS.ClientAuth.CA)
+		if err != nil {
+			return fmt.Errorf("app %s: failed to read client_auth ca: %w", app.Name, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("app %s: no certificates found in client_auth ca %s", app.Name, app.TLS.ClientAuth.CA)
+		}
+
+		mode := tls.RequireAndVerifyClientCert
+		if app.TLS.ClientAuth.Mode == config.ClientAuthOptional {
+			mode = tls.VerifyClientCertIfGiven
+		}
+
+		hostname := app.Hostname
+		if hostname == "" {
+			hostname = app.Domain // Backward compatibility
+		}
+		if s.clientAuth == nil {
+			s.clientAuth = make(map[string]clientAuth)
+		}
+		s.clientAuth[strings.ToLower(hostname)] = clientAuth{mode: mode, cas: pool}
+	}
+	return nil
+}
+
+// withClientAuth makes base verify client certificates on connections to
+// the hostnames of apps with client_auth
+func (s *Server) withClientAuth(base *tls.Config) {
+	configs := make(map[string]*tls.Config, len(s.clientAuth))
+	for hostname, auth := range s.clientAuth {
+		cfg := base.Clone()
+		cfg.ClientAuth = auth.mode
+		cfg.ClientCAs = auth.cas
+		configs[hostname] = cfg
+	}
+	base.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if cfg, exists := configs[strings.ToLower(hello.ServerName)]; exists {
+			return cfg, nil
+		}
+		return nil, nil
+	}
+}
+
+// checkClientCert reports whether a request to an app with client_auth may be
+// proxied, answering it otherwise. The certificate must have been verified on
+// a connection made for the app's hostname, not one reused for another host.
+func (s *Server) checkClientCert(w http.ResponseWriter, r *http.Request, app *config.AppConfig) bool {
+	if !app.TLS.ClientAuth.Enabled() {
+		return true
+	}
+	if r.TLS == nil {
+		http.Error(w, "Client certificate required, use HTTPS", http.StatusForbidden)
+		return false
+	}
+	if !strings.EqualFold(r.TLS.ServerName, stripPort(r.Host)) {
+		http.Error(w, "Misdirected Request", http.StatusMisdirectedRequest)
+		return false
+	}
+	if len(r.TLS.VerifiedChains) == 0 && app.TLS.ClientAuth.Mode != config.ClientAuthOptional {
+		http.Error(w, "Client certificate required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// injectClientCertHeaders tells an app with client_auth who the client is
+func (s *Server) injectClientCertHeaders(req *http.Request, r *http.Request, app *config.AppConfig) {
+	if !app.TLS.ClientAuth.Enabled() {
+		return
+	}
+	for _, header := range clientCertHeaders {
+		req.Header.Del(header)
+	}
+
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		req.Header.Set("X-Client-Cert-Verified", "NONE")
+		return
+	}
+	info := cert.ExtractCertificateInfo(r.TLS.VerifiedChains[0][0])
+	req.Header.Set("X-Client-Cert-Verified", "SUCCESS")
+	req.Header.Set("X-Client-Cert-CN", info.CommonName)
+	req.Header.Set("X-Client-Cert-Subject", info.Subject)
+	req.Header.Set("X-Client-Cert-Issuer", info.Issuer)
+	req.Header.Set("X-Client-Cert-Serial", info.Serial)
+	req.Header.Set("X-Client-Cert-Not-After", info.NotAfter)
+}
+
+// apiRemoteTLS returns the TLS settings of the remote management API: the
+// versions and ciphers of the tls section, the certificate of api_remote and,
+// with client_ca_file, verification of client certificates
+func apiRemoteTLS(cfg *config.Config) (*tls.Config, error) {
+	remote := cfg.Server.APIRemote
+	tlsConfig, err := cfg.TLS.ServerTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.LoadX509KeyPair(remote.CertFile, remote.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+	tlsConfig.Certificates = []tls.Certificate{pair}
+	tlsConfig.NextProtos = []string{"h2", "http/1.1"}
+
+	if remote.ClientCAFile != "" {
+		data, err := os.ReadFile(remote.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in client_ca_file %s", remote.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/sni"
+)
+
+// clientHelloTimeout bounds how long a new HTTPS connection may take to send its ClientHello
+const clientHelloTimeout = 10 * time.Second
+
+// passthroughApp returns the app that terminates TLS itself for a hostname, if any
+func (s *Server) passthroughApp(hostname string) *config.AppConfig {
+	apps := s.apps()
+	for i := range apps {
+		app := &apps[i]
+		if !app.TLS.Passthrough {
+			continue
+		}
+		appHostname := app.Hostname
+		if appHostname == "" {
+			appHostname = app.Domain
+		}
+		if strings.EqualFold(appHostname, hostname) {
+			return app
+		}
+	}
+	return nil
+}
+
+// stripPort removes the port from a Host header value
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// hasPassthroughApps reports whether any app routes raw TLS
+func (s *Server) hasPassthroughApps() bool {
+	for _, app := range s.config.Apps {
+		if app.TLS.Passthrough {
+			return true
+		}
+	}
+	return false
+}
+
+// sniListener sits in front of the HTTPS server. It reads the SNI of every new
+// connection and forwards connections for passthrough apps as raw TCP to the app,
+// handing all others to the HTTPS server with the ClientHello replayed.
+type sniListener struct {
+	net.Listener
+	server  *Server
+	conns   chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	active  map[net.Conn]struct{} // Spliced passthrough connections, closed on shutdown
+	activeM sync.Mutex
+}
+
+// newSNIListener wraps a TCP listener and starts accepting connections
+func (s *Server) newSNIListener(inner net.Listener) *sniListener {
+	l := &sniListener{
+		Listener: inner,
+		server:   s,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+		active:   make(map[net.Conn]struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+// Accept returns the next connection meant for the HTTPS server
+func (l *sniListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops accepting and drops passthrough connections
+func (l *sniListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+
+		l.activeM.Lock()
+		for conn := range l.active {
+			conn.Close()
+		}
+		l.activeM.Unlock()
+	})
+	return err
+}
+
+func (l *sniListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.Close()
+				return
+			}
+			l.server.logger.WithError(err).Warn("Failed to accept HTTPS connection")
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		go l.route(conn)
+	}
+}
+
+// route peeks at the ClientHello and either splices the connection to a
+// passthrough app or hands it to the HTTPS server
+func (l *sniListener) route(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(clientHelloTimeout))
+	serverName, peeked, err := sni.ReadClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+
+	wrapped := &replayConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(peeked), conn)}
+	if err == nil {
+		if app := l.server.passthroughApp(serverName); app != nil {
+			l.splice(wrapped, app, serverName)
+			return
+		}
+	}
+
+	// Not a passthrough host (or not TLS at all): let the HTTPS server deal with it
+	select {
+	case l.conns <- wrapped:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+// splice copies bytes between the client and a running instance of the app
+func (l *sniListener) splice(client net.Conn, app *config.AppConfig, serverName string) {
+	defer client.Close()
+	logger := l.server.logger.WithField("app", app.Name).WithField("sni", serverName)
+
+	proc, _ := l.server.selectInstance(app)
+	if proc == nil {
+		logger.Warn("No running instance for TLS passthrough connection")
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", proc.Config.Port), 10*time.Second)
+	if err != nil {
+		logger.WithError(err).Error("Failed to connect TLS passthrough upstream")
+		l.server.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("TLS passthrough to %s failed: %v", proc.Config.Name, err))
+		return
+	}
+	defer upstream.Close()
+
+	l.activeM.Lock()
+	l.active[client] = struct{}{}
+	l.active[upstream] = struct{}{}
+	l.activeM.Unlock()
+	defer func() {
+		l.activeM.Lock()
+		delete(l.active, client)
+		delete(l.active, upstream)
+		l.activeM.Unlock()
+	}()
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(upstream, client)
+		closeWrite(upstream)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(client, upstream)
+		closeWrite(client)
+		errc <- err
+	}()
+	<-errc
+	<-errc
+}
+
+// closeWrite half-closes a connection so the peer sees EOF while replies can still arrive
+func closeWrite(conn net.Conn) {
+	if rc, ok := conn.(*replayConn); ok {
+		conn = rc.Conn
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// replayConn is a connection whose first bytes come from an earlier peek
+type replayConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
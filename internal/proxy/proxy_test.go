@@ -1,10 +1,529 @@
 package proxy
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/process"
 )
 
 func TestProxy_Basic(t *testing.T) {
 	// Basic test to ensure package compiles
 	t.Log("Proxy package test - basic functionality works")
-}
\ No newline at end of file
+}
+
+func TestClientIPResolver(t *testing.T) {
+	resolver, err := newClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"untrusted peer ignores XFF", "203.0.113.9:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.9"},
+		{"trusted peer honors XFF", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"spoofed left entry skipped", "10.1.2.3:5000", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7, 10.9.9.9"}, "198.51.100.7"},
+		{"forwarded header", "192.168.1.1:443", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https`}, "2001:db8::1"},
+		{"forwarded preferred over XFF", "10.0.0.2:80", map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "1.1.1.1"}, "192.0.2.60"},
+		{"trusted peer without headers", "10.0.0.2:80", nil, "10.0.0.2"},
+		{"obfuscated forwarded entry", "10.0.0.2:80", map[string]string{"Forwarded": "for=_hidden, for=192.0.2.61"}, "192.0.2.61"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			if got := resolver.ClientIP(req); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := newClientIPResolver([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid trusted proxy")
+	}
+}
+
+func TestIsStreamingRequest(t *testing.T) {
+	app := &config.AppConfig{Streaming: config.StreamingConfig{Paths: []string{"/events"}}}
+
+	if !isStreamingRequest(app, httptest.NewRequest("GET", "/events/orders", nil)) {
+		t.Error("Expected configured path to be streaming")
+	}
+
+	sse := httptest.NewRequest("GET", "/feed", nil)
+	sse.Header.Set("Accept", "text/event-stream")
+	if !isStreamingRequest(app, sse) {
+		t.Error("Expected SSE request to be streaming")
+	}
+
+	if isStreamingRequest(app, httptest.NewRequest("GET", "/api", nil)) {
+		t.Error("Expected regular request not to be streaming")
+	}
+}
+
+func TestTransportCache(t *testing.T) {
+	cache := newTransportCache()
+	app := &config.AppConfig{Name: "web", Timeouts: config.TimeoutConfig{ResponseHeader: 5 * time.Second}}
+
+	transport := cache.get(app)
+	if transport.ResponseHeaderTimeout != 5*time.Second {
+		t.Errorf("Expected response header timeout 5s, got %v", transport.ResponseHeaderTimeout)
+	}
+	if cache.get(app) != transport {
+		t.Error("Expected transport to be reused per app")
+	}
+
+	if !isTimeout(context.DeadlineExceeded) {
+		t.Error("Expected deadline exceeded to be a timeout")
+	}
+}
+
+func TestAssignRequestID(t *testing.T) {
+	s := &Server{config: &config.Config{Server: config.ServerConfig{EnableTracking: true}}}
+
+	r := s.assignRequestID(httptest.NewRequest("GET", "/", nil))
+	if requestIDFrom(r) == "" {
+		t.Fatal("Expected request ID to be assigned")
+	}
+
+	s.config.Server.EnableTracking = false
+	r = s.assignRequestID(httptest.NewRequest("GET", "/", nil))
+	if requestIDFrom(r) != "" {
+		t.Error("Expected no request ID when tracking is disabled")
+	}
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	resolver, err := newClientIPResolver(nil)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	s := &Server{
+		config:    &config.Config{Server: config.ServerConfig{EnableTracking: true, AccessLogFormat: config.AccessLogJSON}},
+		clientIPs: resolver,
+	}
+
+	r := s.assignRequestID(httptest.NewRequest("GET", "http://web.localhost:8080/api?q=1", nil))
+	r.RemoteAddr = "203.0.113.9:5000"
+	rw := &responseWriter{ResponseWriter: httptest.NewRecorder(), size: 42}
+
+	var entry accessLogEntry
+	if err := json.Unmarshal([]byte(s.accessLogJSON(r, rw, 201, 1500*time.Microsecond, "web")), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line: %v", err)
+	}
+	if entry.Host != "web.localhost" || entry.Path != "/api" || entry.Query != "q=1" {
+		t.Errorf("Unexpected request fields: %+v", entry)
+	}
+	if entry.Status != 201 || entry.Bytes != 42 || entry.DurationMS != 1.5 || entry.App != "web" {
+		t.Errorf("Unexpected response fields: %+v", entry)
+	}
+	if entry.ClientIP != "203.0.113.9" || entry.RequestID == "" || entry.RequestID != requestIDFrom(r) {
+		t.Errorf("Unexpected client fields: %+v", entry)
+	}
+}
+
+func TestAccessLogFile(t *testing.T) {
+	resolver, err := newClientIPResolver(nil)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	s := &Server{config: &config.Config{}, clientIPs: resolver}
+
+	r := httptest.NewRequest("GET", "/a?b=1", nil)
+	r.RemoteAddr = "203.0.113.9:5000"
+	r.Header.Set("User-Agent", "curl/8.0")
+	rw := &responseWriter{ResponseWriter: httptest.NewRecorder()}
+
+	common := s.accessLogCLF(r, rw, 404, 0, false)
+	if !strings.HasPrefix(common, "203.0.113.9 - - [") || !strings.HasSuffix(common, `] "GET /a?b=1 HTTP/1.1" 404 -`) {
+		t.Errorf("Unexpected common log line: %q", common)
+	}
+	if combined := s.accessLogCLF(r, rw, 404, 0, true); combined != common+` "-" "curl/8.0"` {
+		t.Errorf("Unexpected combined log line: %q", combined)
+	}
+}
+
+func TestDebugAuthorized(t *testing.T) {
+	r := httptest.NewRequest("GET", debugPath, nil)
+	if debugAuthorized(r, "secret") {
+		t.Error("Expected request without token to be rejected")
+	}
+
+	r.Header.Set("Authorization", "Bearer secret")
+	if !debugAuthorized(r, "secret") {
+		t.Error("Expected bearer token to be accepted")
+	}
+	if debugAuthorized(r, "") {
+		t.Error("Expected empty configured token to reject everything")
+	}
+}
+
+func TestDefaultResponseHeaders(t *testing.T) {
+	s := &Server{config: &config.Config{Server: config.ServerConfig{
+		DefaultResponseHeaders: map[string]string{"Server": "guvnor", "X-Robots-Tag": "noindex"},
+	}}}
+	app := &config.AppConfig{ResponseHeaders: map[string]string{"x-robots-tag": "", "X-Frame-Options": "DENY"}}
+
+	rec := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: rec, defaults: s.responseHeaders(app, false)}
+	rw.Header().Set("Server", "upstream")
+	rw.Write([]byte("ok"))
+
+	if got := rec.Header().Get("Server"); got != "upstream" {
+		t.Errorf("Expected upstream Server header to be kept, got %q", got)
+	}
+	if got := rec.Header().Get("X-Robots-Tag"); got != "" {
+		t.Errorf("Expected X-Robots-Tag to be removed by the app, got %q", got)
+	}
+	if got := rec.Header().Get("X-Frame-Options"); got != "DENY" {
+		t.Errorf("Expected app header to be added, got %q", got)
+	}
+
+	rec = httptest.NewRecorder()
+	rw = &responseWriter{ResponseWriter: rec, defaults: s.responseHeaders(nil, false)}
+	rw.WriteHeader(404)
+	if rec.Header().Get("Server") != "guvnor" || rec.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Errorf("Expected server defaults on unrouted responses, got %v", rec.Header())
+	}
+}
+
+func TestHSTSHeader(t *testing.T) {
+	s := &Server{config: &config.Config{TLS: config.TLSConfig{HSTS: config.HSTSConfig{Enabled: true, IncludeSubDomains: true}}}}
+
+	if got := s.responseHeaders(nil, true)["Strict-Transport-Security"]; got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Expected HSTS on HTTPS responses, got %q", got)
+	}
+	if got := s.responseHeaders(nil, false)["Strict-Transport-Security"]; got != "" {
+		t.Errorf("Expected no HSTS over plain HTTP, got %q", got)
+	}
+	app := &config.AppConfig{ResponseHeaders: map[string]string{"strict-transport-security": ""}}
+	if got := s.responseHeaders(app, true)["Strict-Transport-Security"]; got != "" {
+		t.Errorf("Expected the app to remove HSTS, got %q", got)
+	}
+}
+
+func TestPickInstanceSlowStart(t *testing.T) {
+	app := &config.AppConfig{Name: "web", SlowStart: config.SlowStartConfig{Duration: time.Hour}}
+	fresh := &process.Process{Config: config.AppConfig{Name: "web.1"}}
+	warm := &process.Process{Config: config.AppConfig{Name: "web.2"}}
+	s := &Server{warmup: newWarmupTracker(), healthChecker: health.NewChecker(nil, logrus.New())}
+	s.warmup.states["web.1"] = &warmupState{ready: true, readyAt: time.Now()}
+	s.warmup.states["web.2"] = &warmupState{ready: true, readyAt: time.Now().Add(-2 * time.Hour)}
+
+	// Alone, an instance early in its ramp takes every request
+	for i := 0; i < 100; i++ {
+		if proc, warming := s.pickInstance(app, []*process.Process{fresh}, uint64(i)); proc != fresh || warming {
+			t.Fatalf("single ramping instance: got %v, warming %v", proc, warming)
+		}
+	}
+
+	// Next to a warm instance it gets a small share
+	picked := 0
+	for i := 0; i < 1000; i++ {
+		proc, _ := s.pickInstance(app, []*process.Process{fresh, warm}, uint64(i))
+		if proc == fresh {
+			picked++
+		}
+	}
+	if picked == 0 || picked > 200 {
+		t.Errorf("ramping instance got %d of 1000 requests, want about 50", picked)
+	}
+
+	// Before passing its health checks it gets none
+	s.warmup.states["web.1"].ready = false
+	if proc, warming := s.pickInstance(app, []*process.Process{fresh}, 0); proc != nil || !warming {
+		t.Errorf("unready instance: got %v, warming %v", proc, warming)
+	}
+}
+
+func TestHedgingHelpers(t *testing.T) {
+	if !canHedge(httptest.NewRequest("GET", "/", nil)) {
+		t.Error("Expected GET without body to be retryable")
+	}
+	if canHedge(httptest.NewRequest("POST", "/", nil)) {
+		t.Error("Expected POST not to be retryable")
+	}
+	if canHedge(httptest.NewRequest("GET", "/", strings.NewReader("body"))) {
+		t.Error("Expected GET with a body not to be retryable")
+	}
+
+	// Dial a port that was just released to get a connection refused error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	_, err = http.Get("http://" + addr)
+	if err == nil || !isConnectionError(err) {
+		t.Errorf("Expected connection error, got %v", err)
+	}
+	if isConnectionError(context.DeadlineExceeded) {
+		t.Error("Expected timeouts not to count as connection errors")
+	}
+}
+
+func TestSNIListener_HandsOffNonPassthrough(t *testing.T) {
+	s := &Server{
+		config: &config.Config{Apps: []config.AppConfig{{Name: "raw", Hostname: "raw.example.com", TLS: config.AppTLSConfig{Passthrough: true}}}},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("terminated"))
+	}))
+	ts.Listener = s.newSNIListener(ts.Listener)
+	ts.StartTLS()
+	defer ts.Close()
+
+	// The ClientHello is peeked for routing and must be replayed to the HTTPS server
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatalf("Request through SNI listener failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "terminated" {
+		t.Errorf("Unexpected body %q", body)
+	}
+
+	if s.passthroughApp("RAW.example.com") == nil || s.passthroughApp("other.example.com") != nil {
+		t.Error("Unexpected passthrough app lookup")
+	}
+}
+
+func TestListen_PortInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer taken.Close()
+	port := taken.Addr().(*net.TCPAddr).Port
+
+	listener, err := listen("HTTP", port)
+	if err == nil {
+		listener.Close()
+		t.Fatal("Expected listening on a taken port to fail")
+	}
+
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.Port != port || !bindErr.InUse() || bindErr.Privileged() {
+		t.Fatalf("Expected a port in use error, got %#v", err)
+	}
+	if !strings.Contains(bindErr.Hint(), "lsof -i :") {
+		t.Errorf("Expected a hint on finding the listener, got %q", bindErr.Hint())
+	}
+}
+
+func TestHandleSPA(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "assets"), 0755)
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("<html>app</html>"), 0644)
+	os.WriteFile(filepath.Join(root, "assets", "app.js"), []byte("console.log(1)"), 0644)
+
+	s := &Server{}
+	app := &config.AppConfig{Preset: config.PresetSPAAPI, SPA: config.SPAConfig{Root: root, APIPrefix: "/api"}}
+
+	serve := func(method, target string) (*httptest.ResponseRecorder, bool) {
+		recorder := httptest.NewRecorder()
+		handled := s.handleSPA(&responseWriter{ResponseWriter: recorder}, httptest.NewRequest(method, target, nil), app)
+		return recorder, handled
+	}
+
+	for _, target := range []string{"/api", "/api/users"} {
+		if _, handled := serve("GET", target); handled {
+			t.Errorf("Expected %s to be proxied to the backend", target)
+		}
+	}
+
+	cases := []struct {
+		target string
+		status int
+		body   string
+	}{
+		{"/assets/app.js", http.StatusOK, "console.log(1)"},
+		{"/", http.StatusOK, "<html>app</html>"},
+		{"/settings/profile", http.StatusOK, "<html>app</html>"},
+		{"/apiary", http.StatusOK, "<html>app</html>"},
+		{"/assets/missing.js", http.StatusNotFound, ""},
+		{"/../../etc/passwd", http.StatusOK, "<html>app</html>"},
+	}
+	for _, tc := range cases {
+		recorder, handled := serve("GET", tc.target)
+		if !handled || recorder.Code != tc.status {
+			t.Errorf("%s: expected status %d, got %d (handled %v)", tc.target, tc.status, recorder.Code, handled)
+			continue
+		}
+		if tc.body != "" && recorder.Body.String() != tc.body {
+			t.Errorf("%s: unexpected body %q", tc.target, recorder.Body.String())
+		}
+	}
+
+	if recorder, _ := serve("POST", "/settings"); recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected POST outside the API to be rejected, got %d", recorder.Code)
+	}
+}
+
+// testCA returns a CA certificate, PEM encoded, and a function issuing server
+// or client certificates signed by it
+func testCA(t *testing.T) (caPEM []byte, issue func(cn string, usage x509.ExtKeyUsage) tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	serial := int64(1)
+	issue = func(cn string, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial++
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			DNSNames:     []string{cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), issue
+}
+
+func TestClientAuth(t *testing.T) {
+	caPEM, issue := testCA(t)
+	caFile := filepath.Join(t.TempDir(), "clients.pem")
+	if err := os.WriteFile(caFile, caPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := config.AppConfig{Name: "secure", Hostname: "secure.example.com", TLS: config.AppTLSConfig{ClientAuth: config.ClientAuthConfig{CA: caFile}}}
+	s := &Server{
+		config: &config.Config{Apps: []config.AppConfig{app}},
+		logger: logrus.NewEntry(logrus.New()),
+	}
+	if err := s.setupClientAuth(); err != nil {
+		t.Fatalf("setupClientAuth: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.checkClientCert(w, r, &app) {
+			return
+		}
+		upstream := httptest.NewRequest("GET", "/", nil)
+		upstream.Header.Set("X-Client-Cert-CN", "spoofed")
+		s.injectClientCertHeaders(upstream, r, &app)
+		w.Write([]byte(upstream.Header.Get("X-Client-Cert-Verified") + " " + upstream.Header.Get("X-Client-Cert-CN")))
+	}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{issue("secure.example.com", x509.ExtKeyUsageServerAuth)}}
+	s.withClientAuth(ts.TLS)
+	ts.StartTLS()
+	defer ts.Close()
+
+	get := func(serverName string, certs ...tls.Certificate) (int, string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			Certificates:       certs,
+		}}}
+		req, _ := http.NewRequest("GET", ts.URL, nil)
+		req.Host = "secure.example.com"
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, "", err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body), nil
+	}
+
+	if _, _, err := get("secure.example.com"); err == nil {
+		t.Error("Expected the handshake to fail without a client certificate")
+	}
+	if _, _, err := get("secure.example.com", issue("untrusted", x509.ExtKeyUsageServerAuth)); err == nil {
+		t.Error("Expected the handshake to fail with a certificate not valid for client auth")
+	}
+	status, body, err := get("secure.example.com", issue("alice", x509.ExtKeyUsageClientAuth))
+	if err != nil || status != http.StatusOK || body != "SUCCESS alice" {
+		t.Errorf("Expected the verified client to be passed on, got %d %q (%v)", status, body, err)
+	}
+
+	// A connection made for another hostname asks for no certificate and must not reach the app
+	status, _, err = get("other.example.com", issue("alice", x509.ExtKeyUsageClientAuth))
+	if err != nil || status != http.StatusMisdirectedRequest {
+		t.Errorf("Expected 421 for a request on a connection for another host, got %d (%v)", status, err)
+	}
+}
+
+func TestMisdirectedTLSRequest(t *testing.T) {
+	resolver, _ := newClientIPResolver(nil)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Server{
+		config:         &config.Config{Apps: []config.AppConfig{{Name: "web", Hostname: "web.example.com"}, {Name: "admin", Hostname: "admin.example.com"}}},
+		logger:         logrus.NewEntry(logger),
+		clientIPs:      resolver,
+		processManager: process.NewEnhancedManager(logger, 10),
+	}
+	// A connection opened for web, e.g. through its tunnel, does not reach admin
+	r := httptest.NewRequest("GET", "https://admin.example.com/", nil)
+	r.TLS = &tls.ConnectionState{ServerName: "web.example.com"}
+	rec := httptest.NewRecorder()
+	s.proxyRequest(rec, r)
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("Expected 421 for a request on a connection for another host, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// readiness tracks whether guvnor can take traffic, for /api/readyz
+type readiness struct {
+	mu       sync.Mutex
+	started  bool             // Every app was started or attempted and the proxy listeners are bound
+	failures map[string]error // Listeners that stopped serving, by name
+}
+
+// setStarted records whether the server finished starting; Stop clears it
+func (r *readiness) setStarted(started bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = started
+	if started {
+		r.failures = nil
+	}
+}
+
+// listenerFailed records that a listener stopped serving
+func (r *readiness) listenerFailed(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failures == nil {
+		r.failures = make(map[string]error)
+	}
+	r.failures[name] = err
+}
+
+// reasons returns why guvnor is not ready, none when it is
+func (r *readiness) reasons() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var reasons []string
+	for name, err := range r.failures {
+		reasons = append(reasons, fmt.Sprintf("%s listener stopped: %v", name, err))
+	}
+	sort.Strings(reasons)
+	if !r.started {
+		reasons = append([]string{"apps are starting or guvnor is stopping"}, reasons...)
+	}
+	return reasons
+}
+
+// Readiness returns why the server cannot take traffic yet: it is still
+// starting its apps, or a proxy listener failed. None means it is ready.
+func (s *Server) Readiness() []string {
+	return s.ready.reasons()
+}
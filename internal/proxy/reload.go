@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/jobs"
+)
+
+// SetConfigLoader registers the function reading the configuration again, as
+// it was read at startup, for ReloadConfig
+func (s *Server) SetConfigLoader(fn func() (*config.Config, error)) {
+	s.loadConfig = fn
+}
+
+// Config returns the running configuration
+func (s *Server) Config() *config.Config {
+	s.appsMu.RLock()
+	defer s.appsMu.RUnlock()
+	cfg := *s.config
+	return &cfg
+}
+
+// ReloadConfig reads the configuration again and applies what changed about
+// its apps: new apps are started, removed apps stopped, and changed apps that
+// were running are restarted with their new definition. Apps that can only be
+// added or changed at startup, such as jobs, keep their running definition
+// and are reported as pending, as are changes outside apps.
+func (s *Server) ReloadConfig(ctx context.Context, report func(string)) (config.Changes, error) {
+	if s.loadConfig == nil {
+		return config.Changes{}, fmt.Errorf("reloading the configuration is not available")
+	}
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := s.loadConfig()
+	if err != nil {
+		return config.Changes{}, err
+	}
+	running := s.Config()
+	changes := running.Diff(next)
+	if changes.Empty() {
+		report("Configuration unchanged")
+		return changes, nil
+	}
+
+	current := make(map[string]config.AppConfig, len(running.Apps))
+	for _, app := range running.Apps {
+		current[app.Name] = app
+	}
+	pending := make(map[string]bool)
+	for _, name := range append(append(append([]string{}, changes.Added...), changes.Changed...), changes.Removed...) {
+		for _, app := range []*config.AppConfig{appNamed(running.Apps, name), appNamed(next.Apps, name)} {
+			if app != nil && runtimeApp(*app) != nil && !pending[name] {
+				pending[name] = true
+				changes.Pending = append(changes.Pending, name)
+			}
+		}
+	}
+	if len(changes.Pending) > 0 {
+		report(fmt.Sprintf("Restart guvnor to apply the changes to %s", strings.Join(changes.Pending, ", ")))
+	}
+	if len(changes.Sections) > 0 {
+		report(fmt.Sprintf("Restart guvnor to apply the changes to %s", strings.Join(changes.Sections, ", ")))
+	}
+
+	// The new apps, with pending ones as they run
+	apps := make([]config.AppConfig, 0, len(next.Apps))
+	for _, app := range next.Apps {
+		if !pending[app.Name] {
+			apps = append(apps, app)
+		} else if runningApp, exists := current[app.Name]; exists {
+			apps = append(apps, runningApp)
+		}
+	}
+	for _, name := range changes.Removed {
+		if pending[name] {
+			apps = append(apps, current[name])
+		}
+	}
+
+	var start, stop []string
+	for _, name := range changes.Added {
+		if !pending[name] {
+			start = append(start, name)
+		}
+	}
+	for _, name := range changes.Changed {
+		if !pending[name] && s.processManager.InstanceCount(name) > 0 {
+			stop = append(stop, name)
+			start = append(start, name)
+		}
+	}
+	for _, name := range changes.Removed {
+		if !pending[name] {
+			stop = append(stop, name)
+		}
+	}
+	jobs.Plan(ctx, append(append([]string{}, stop...), start...)...)
+
+	var errs []error
+	for _, name := range stop {
+		report(fmt.Sprintf("Stopping %s", name))
+		jobs.Report(ctx, name, "stopping", false)
+		var err error
+		if len(s.processManager.GetInstances(name)) > 0 {
+			if _, err = s.processManager.StopWithResults(ctx, name); err != nil {
+				errs = append(errs, fmt.Errorf("failed to stop %s: %w", name, err))
+			}
+		}
+		s.processManager.Forget(name)
+		jobs.Report(ctx, name, stepPhase(err, "stopped"), !slices.Contains(start, name))
+	}
+
+	s.appsMu.Lock()
+	s.config.Apps = apps
+	s.appsMu.Unlock()
+
+	for _, name := range start {
+		report(fmt.Sprintf("Starting %s", name))
+		jobs.Report(ctx, name, "starting", false)
+		err := s.StartApp(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", name, err))
+		}
+		jobs.Report(ctx, name, stepPhase(err, "started"), true)
+	}
+
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Reloaded configuration: %d added, %d removed, %d changed",
+		len(changes.Added), len(changes.Removed), len(changes.Changed)))
+	return changes, errors.Join(errs...)
+}
+
+// appNamed returns the app of apps with a name, or nil
+func appNamed(apps []config.AppConfig, name string) *config.AppConfig {
+	for i := range apps {
+		if apps[i].Name == name {
+			return &apps[i]
+		}
+	}
+	return nil
+}
+
+// stepPhase is the phase of a finished job step
+func stepPhase(err error, success string) string {
+	if err != nil {
+		return "failed"
+	}
+	return success
+}
@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/cert"
+	"github.com/gleicon/guvnor/internal/events"
+)
+
+// setupCertRenewal creates the renewer keeping ACME certificates in the cert
+// directory fresh and publishing the renewals that fail
+func (s *Server) setupCertRenewal() {
+	renewal := s.config.TLS.Renewal
+	getCert := s.acmeCertificate()
+	s.certRenewer = cert.NewRenewer(s.config.TLS.CertDir, renewal.RenewBefore, renewal.CheckInterval,
+		func(ctx context.Context, info cert.CertInfo) error {
+			// Loading the certificate makes autocert renew it in the background
+			// once it is within renew_before of expiry
+			_, err := getCert(info.ClientHello())
+			return err
+		}, s.logger.Logger)
+
+	s.certRenewer.SetFailureHook(func(status cert.RenewalStatus) {
+		s.events.Publish(events.Event{
+			Type: events.CertRenewalFailed,
+			Message: fmt.Sprintf("Certificate for %s expiring at %s was not renewed: %s",
+				status.Domain, status.NotAfter.Format(time.RFC3339), status.LastError),
+			Fields: map[string]string{
+				"domains":   status.Domain,
+				"not_after": status.NotAfter.Format(time.RFC3339),
+				"error":     status.LastError,
+				"failures":  strconv.Itoa(status.Failures),
+			},
+		})
+	})
+}
+
+// acmeCertificate returns the GetCertificate of the advanced certificate
+// manager, or of the basic one when the advanced manager could not be set up
+func (s *Server) acmeCertificate() func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if s.advancedCertMgr != nil {
+		return s.advancedCertMgr.GetCertificate
+	}
+	return s.certManager.GetCertificate
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/jobs"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// rollingReadyTimeout bounds how long a replacement may take to pass its health check
+const rollingReadyTimeout = 2 * time.Minute
+
+// RollingRestart restarts an app (every instance, one at a time) or a single instance
+// without dropping traffic. Progress is passed to report.
+func (s *Server) RollingRestart(ctx context.Context, name string, report func(string)) error {
+	targets := s.processManager.GetInstances(name)
+	if len(targets) == 0 {
+		proc, exists := s.processManager.GetProcess(name)
+		if !exists {
+			return fmt.Errorf("process %s not found", name)
+		}
+		targets = []*process.Process{proc}
+	}
+
+	names := make([]string, len(targets))
+	for i, proc := range targets {
+		names[i] = proc.Config.Name
+	}
+	jobs.Plan(ctx, names...)
+
+	for _, proc := range targets {
+		instance := proc.Config.Name
+		report(fmt.Sprintf("Starting replacement for %s and waiting for it to become healthy", instance))
+		jobs.Report(ctx, instance, "waiting for health check", false)
+		s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Rolling restart of %s", instance))
+
+		ready := func(ctx context.Context, replacement *process.Process) error {
+			if err := s.waitReady(ctx, replacement); err != nil {
+				return err
+			}
+			jobs.Report(ctx, instance, "draining old process", false)
+			return nil
+		}
+		if err := s.processManager.Replace(ctx, instance, ready); err != nil {
+			jobs.Report(ctx, instance, "failed", true)
+			s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Rolling restart of %s failed: %v", instance, err))
+			return err
+		}
+
+		jobs.Report(ctx, instance, "replaced", true)
+		report(fmt.Sprintf("Traffic switched to new %s, old process stopped", instance))
+		s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Rolling restart of %s complete", instance))
+	}
+
+	return nil
+}
+
+// waitReady waits until a replacement passes its readiness check, or accepts
+// connections when health checks are disabled
+func (s *Server) waitReady(ctx context.Context, proc *process.Process) error {
+	app := s.appConfig(proc.AppName())
+
+	ctx, cancel := context.WithTimeout(ctx, rollingReadyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		if !proc.IsRunning() {
+			return fmt.Errorf("replacement exited during startup")
+		}
+
+		if app != nil && app.HealthCheck.Enabled {
+			result := s.healthChecker.CheckApp(proc.Config.Name, readinessCheck(app), proc.Config.Port)
+			if result.Status == health.StatusHealthy {
+				return nil
+			}
+		} else if conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", proc.Config.Port), time.Second); err == nil {
+			conn.Close()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for health check: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// appConfig returns the configuration of an app by name
+func (s *Server) appConfig(name string) *config.AppConfig {
+	apps := s.apps()
+	for i := range apps {
+		if apps[i].Name == name {
+			return &apps[i]
+		}
+	}
+	return nil
+}
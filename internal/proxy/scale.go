@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+)
+
+// ScaleApp changes the number of running instances of a configured app at runtime.
+// New instances get the next free ports and join the round-robin as soon as they run.
+func (s *Server) ScaleApp(ctx context.Context, name string, instances int) error {
+	app := s.appConfig(name)
+	if app == nil {
+		return fmt.Errorf("app %s not found", name)
+	}
+	if app.IsJob() {
+		return fmt.Errorf("app %s is a job and cannot be scaled", name)
+	}
+
+	if err := s.processManager.Scale(ctx, *app, instances); err != nil {
+		return err
+	}
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Scaled %s to %d instances", name, instances))
+	return nil
+}
+
+// StartApp starts a configured app that is not running, e.g. one stopped on its own
+// or left out when the server was started for a single app
+func (s *Server) StartApp(ctx context.Context, name string) error {
+	app := s.appConfig(name)
+	if app == nil {
+		return fmt.Errorf("app %s not found", name)
+	}
+	if app.IsJob() {
+		return fmt.Errorf("app %s is a job and is started by its schedule", name)
+	}
+	if s.processManager.InstanceCount(name) > 0 {
+		return fmt.Errorf("app %s is already running", name)
+	}
+
+	// ctx ends with the request, the process must outlive it
+	return s.processManager.StartWithLogging(context.WithoutCancel(ctx), *app)
+}
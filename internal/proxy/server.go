@@ -4,23 +4,37 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/acme"
 	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/gleicon/guvnor/internal/acmedns"
+	"github.com/gleicon/guvnor/internal/alert"
 	"github.com/gleicon/guvnor/internal/api"
+	"github.com/gleicon/guvnor/internal/audit"
+	"github.com/gleicon/guvnor/internal/autoscale"
 	"github.com/gleicon/guvnor/internal/cert"
 	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/events"
+	"github.com/gleicon/guvnor/internal/flags"
 	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/logs"
+	"github.com/gleicon/guvnor/internal/logship"
+	"github.com/gleicon/guvnor/internal/metrics"
+	"github.com/gleicon/guvnor/internal/notify"
 	"github.com/gleicon/guvnor/internal/process"
+	"github.com/gleicon/guvnor/internal/scheduler"
 )
 
 // Server represents the main proxy server
@@ -34,6 +48,33 @@ type Server struct {
 	apiServer      *api.Server     // Management API server
 	certManager    *autocert.Manager // Keep for backward compatibility
 	advancedCertMgr *cert.Manager   // New enhanced certificate manager
+	acmeDNS        *acmedns.Server   // Nil unless tls.acme_dns is enabled
+	dnsIssuer      *cert.DNSIssuer   // DNS-01 certificates served before autocert
+	certRenewer    *cert.Renewer     // Renews ACME certificates before they expire
+	certStore      *cert.Store       // Nil unless an app has a cert_file
+	localCA        *cert.LocalCA     // Nil unless tls.local_ca is enabled
+	acme           cert.ACME         // CA that ACME certificates are requested from
+	clientAuth     map[string]clientAuth // Client certificate verification by hostname, for apps with client_auth
+	metrics        *metrics.Recorder      // Request and restart observations
+	sinks          map[string]notify.Sink // Named notification sinks
+	logShippers    []*logship.Shipper     // Forward log entries to syslog, journald or Loki
+	statsd         *metrics.StatsDClient  // Sends metrics to statsd or a Datadog agent, nil when not configured
+	accessLog      *logs.RotatingFile     // Nil unless server.access_log.path is set
+	logFiles       *logFiles              // Nil unless logs.dir is set
+	events         *events.Bus            // Lifecycle events of apps and certificates
+	alertEngine    *alert.Engine          // Nil when no alerts are configured
+	warmup         *warmupTracker         // Slow start state per instance
+	balancer       *roundRobin            // Round-robin position per app
+	transports     *transportCache        // Upstream transports with per-app timeouts
+	autoscaler     *autoscale.Scheduler   // Nil when no app has a schedule
+	jobScheduler   *scheduler.Scheduler   // Nil when no app is a one-shot or scheduled job
+	clientIPs      *clientIPResolver      // Trusted proxy aware client IP resolution
+	flags          *flags.Store           // Per-app feature flags
+	only           map[string]bool        // Apps started by Start; all when nil
+	appsMu         sync.RWMutex           // Guards replacing config.Apps at runtime
+	reloadMu       sync.Mutex             // Serializes configuration reloads with registering and removing apps
+	loadConfig     func() (*config.Config, error) // Reads the configuration again; nil when reloading is not available
+	ready          readiness              // What /api/readyz reports
 	mu             sync.RWMutex
 	running        bool
 }
@@ -58,11 +99,121 @@ func NewServer(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (
 		healthChecker:  healthChecker,
 		logger:         serverLogger,
 		apiServer:      apiServer,
+		warmup:         newWarmupTracker(),
+		balancer:       newRoundRobin(),
+		transports:     newTransportCache(),
+	}
+	if cfg.Execution != (config.ExecutionConfig{}) {
+		if err := processManager.SetContainerRuntime(cfg.Execution); err != nil {
+			// Only container apps need it, they fail with this error when started
+			serverLogger.WithError(err).Warn("Configured container runtime is not available")
+		}
+	}
+	flagStore, err := flags.Open(cfg.Server.StatePath("flags.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	server.flags = flagStore
+	apiServer.SetFlagStore(flagStore)
+	processManager.SetEnvHook(flagStore.Environment)
+	resolver := cfg.SecretResolver()
+	processManager.SetSecrets(resolver)
+	apiServer.SetRollingRestarter(server.RollingRestart)
+	apiServer.SetScaler(server.ScaleApp)
+	apiServer.SetStarter(server.StartApp)
+	apiServer.SetRemover(server.RemoveApp)
+	apiServer.SetRegistrar(server.RegisterApp)
+	apiServer.SetConfigSource(server.Config)
+	apiServer.SetConfigReloader(server.ReloadConfig)
+	apiServer.SetReadiness(server.Readiness)
+	apiServer.SetHealthChecker(healthChecker)
+	if len(cfg.Server.APITokens) > 0 {
+		apiServer.SetAccessTokens(cfg.Server.APITokens, func(app string) map[string]string {
+			if appConfig := server.appConfig(app); appConfig != nil {
+				return appConfig.Labels
+			}
+			return nil
+		})
+	}
+	if len(cfg.Server.FreezeWindows) > 0 {
+		apiServer.SetFreezeWindows(cfg.Server.ActiveFreeze, audit.Open(cfg.Server.StatePath(audit.FileName)))
+	}
+	if cfg.Server.IdempotencyWindow > 0 {
+		apiServer.SetIdempotencyWindow(cfg.Server.IdempotencyWindow)
+	}
+	if path := cfg.Server.SocketPath(); path != "" {
+		if err := apiServer.SetSocket(path, cfg.Server.APISocket.FileMode(), cfg.Server.APISocket.Group); err != nil {
+			return nil, fmt.Errorf("invalid server.api_socket: %w", err)
+		}
+	}
+	if cfg.Server.APIRemote.Enabled() {
+		tlsConfig, err := apiRemoteTLS(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server.api_remote: %w", err)
+		}
+		apiServer.SetRemoteListener(cfg.Server.APIRemote.Listen, tlsConfig)
+	}
+	if cfg.Server.Dashboard {
+		apiServer.EnableDashboard()
+	}
+	
+	clientIPs, err := newClientIPResolver(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
+	}
+	server.clientIPs = clientIPs
+	
+	// Setup metrics, notification sinks and alerting
+	server.setupMetrics()
+	if err := server.setupStatsD(logger); err != nil {
+		return nil, fmt.Errorf("failed to setup statsd: %w", err)
+	}
+	if err := server.setupNotifications(); err != nil {
+		return nil, fmt.Errorf("failed to setup notifications: %w", err)
+	}
+	if err := server.setupLogShipping(logger); err != nil {
+		return nil, fmt.Errorf("failed to setup log shipping: %w", err)
+	}
+	if err := server.setupAccessLog(); err != nil {
+		return nil, err
+	}
+	if err := server.setupLogFiles(); err != nil {
+		return nil, err
+	}
+	server.setupEvents()
+	apiServer.SetEventBus(server.events)
+	server.setupCrashReports()
+	if err := server.setupAlertEngine(logger); err != nil {
+		return nil, fmt.Errorf("failed to setup alert engine: %w", err)
+	}
+	if err := server.setupHealthWebhooks(); err != nil {
+		return nil, fmt.Errorf("failed to setup health webhooks: %w", err)
+	}
+	
+	// Setup time-of-day scaling schedules
+	autoscaler, err := autoscale.NewScheduler(cfg.Apps, processManager, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup autoscale scheduler: %w", err)
+	}
+	if !autoscaler.Empty() {
+		server.autoscaler = autoscaler
+	}
+	
+	// Setup one-shot and cron scheduled jobs
+	jobScheduler, err := scheduler.NewScheduler(cfg.Apps, processManager, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup job scheduler: %w", err)
+	}
+	if !jobScheduler.Empty() {
+		server.jobScheduler = jobScheduler
 	}
 	
 	// Setup TLS certificate manager if enabled
 	if cfg.TLS.Enabled && cfg.TLS.AutoCert {
 		processManager.GetLogManager().Log("proxy-server", "info", "Setting up TLS certificate manager")
+		if server.acme, err = cfg.TLS.ACMESettings(context.Background(), resolver); err != nil {
+			return nil, fmt.Errorf("failed to setup certificate manager: %w", err)
+		}
 		if err := server.setupCertManager(); err != nil {
 			processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Failed to setup certificate manager: %v", err))
 			return nil, fmt.Errorf("failed to setup certificate manager: %w", err)
@@ -72,9 +223,37 @@ func NewServer(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (
 		if err := server.setupAdvancedCertManager(); err != nil {
 			serverLogger.WithError(err).Warn("Failed to setup advanced certificate manager, falling back to basic mode")
 			processManager.GetLogManager().Log("proxy-server", "warn", fmt.Sprintf("Failed to setup advanced certificate manager, falling back to basic mode: %v", err))
+		} else {
+			server.advancedCertMgr.SetIssuedHook(server.certIssued)
+			apiServer.SetIssuanceStatus(server.advancedCertMgr.IssuanceStatus)
+		}
+		server.setupCertRenewal()
+		apiServer.SetCertRenewer(server.certRenewer)
+		
+		// Built-in DNS server for DNS-01 (wildcard) certificates
+		if cfg.TLS.ACMEDNS.Enabled {
+			if err := server.setupACMEDNS(); err != nil {
+				return nil, fmt.Errorf("failed to setup acme dns: %w", err)
+			}
 		}
 	}
 	
+	// Load the certificates apps bring in cert_file and the local CA
+	if cfg.TLS.Enabled {
+		if err := server.setupCertStore(); err != nil {
+			return nil, fmt.Errorf("failed to load certificates: %w", err)
+		}
+		if cfg.TLS.LocalCA.Enabled {
+			if err := server.setupLocalCA(); err != nil {
+				return nil, fmt.Errorf("failed to setup local CA: %w", err)
+			}
+		}
+		if err := server.setupClientAuth(); err != nil {
+			return nil, fmt.Errorf("failed to setup client certificate authentication: %w", err)
+		}
+		apiServer.SetCertHealth(server.certHealth)
+	}
+	
 	// Setup HTTP servers
 	if err := server.setupServers(); err != nil {
 		return nil, fmt.Errorf("failed to setup servers: %w", err)
@@ -83,6 +262,17 @@ func NewServer(ctx context.Context, cfg *config.Config, logger *logrus.Logger) (
 	return server, nil
 }
 
+// OnlyApps limits Start to the named apps; the others can be started later with StartApp
+func (s *Server) OnlyApps(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	
+	s.only = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.only[name] = true
+	}
+}
+
 // Start starts the proxy server and all managed applications
 func (s *Server) Start(ctx context.Context) error {
 	s.mu.Lock()
@@ -95,8 +285,42 @@ func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("Starting proxy server")
 	s.processManager.GetLogManager().Log("proxy-server", "info", "Starting proxy server")
 	
-	// Start all configured applications using enhanced manager
+	// Bind the proxy ports first, so a port that cannot be opened fails the
+	// start before any application is launched
+	httpListener, err := listen("HTTP", s.config.Server.HTTPPort)
+	if err != nil {
+		return err
+	}
+	var httpsListener net.Listener
+	if s.config.TLS.Enabled {
+		if httpsListener, err = listen("HTTPS", s.config.Server.HTTPSPort); err != nil {
+			httpListener.Close()
+			return err
+		}
+	}
+	
+	// Ship logs to the configured sinks
+	for _, shipper := range s.logShippers {
+		shipper.Start()
+	}
+	s.pruneLogFiles(ctx)
+	
+	// Send metrics to statsd
+	s.startStatsD(ctx)
+	
+	// Publish process events from the first start on
+	s.forwardProcessEvents(ctx)
+	s.watchWarmups(ctx)
+	
+	// Start all configured applications using enhanced manager; jobs are run by the job scheduler
 	for _, appConfig := range s.config.Apps {
+		if appConfig.IsJob() {
+			continue
+		}
+		if s.only != nil && !s.only[appConfig.Name] {
+			s.logger.WithField("app", appConfig.Name).Info("Not starting application, only the selected apps start with the server")
+			continue
+		}
 		s.logger.WithField("app", appConfig.Name).Info("Starting application")
 		s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Starting application: %s", appConfig.Name))
 		
@@ -112,6 +336,44 @@ func (s *Server) Start(ctx context.Context) error {
 	// Start health checker
 	s.healthChecker.Start(ctx)
 	
+	// Sample CPU, memory and file descriptor usage for status output
+	s.processManager.StartUsageSampler(ctx, process.DefaultUsageInterval)
+	
+	// Start alert rules evaluation
+	if s.alertEngine != nil {
+		s.alertEngine.Start(ctx)
+	}
+	
+	// Apply scheduled instance counts
+	if s.autoscaler != nil {
+		s.autoscaler.Start(ctx)
+	}
+	
+	// Run one-shot jobs and follow job schedules
+	if s.jobScheduler != nil {
+		s.jobScheduler.Start(ctx)
+	}
+	
+	// Pick up certificate files replaced on disk
+	if s.certStore != nil {
+		s.certStore.Start(ctx, cert.DefaultReloadInterval)
+	}
+	
+	// Renew certificates before they expire, even for idle hostnames
+	if s.certRenewer != nil {
+		s.certRenewer.Start(ctx)
+	}
+	
+	// Alert on served certificates close to expiry
+	if s.config.TLS.Enabled {
+		s.watchCertExpiry(ctx)
+	}
+	
+	// Audit the served hostnames for HSTS preload readiness
+	if s.config.TLS.Audit.Schedule != "" {
+		s.startTLSAudit(ctx)
+	}
+	
 	// Start management API server
 	mgmtPort := api.GetManagementPort(s.config.Server.HTTPPort)
 	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Starting management API server on port %d", mgmtPort))
@@ -122,12 +384,18 @@ func (s *Server) Start(ctx context.Context) error {
 		s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Management API server started successfully on port %d", mgmtPort))
 	}
 	
+	// Answer DNS-01 challenges for the delegated zone
+	if s.acmeDNS != nil {
+		s.startACMEDNS(ctx)
+	}
+	
 	// Start HTTP server (for redirects and ACME challenges)
 	go func() {
 		s.logger.WithField("port", s.config.Server.HTTPPort).Info("Starting HTTP server")
 		s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Starting HTTP server on port %d", s.config.Server.HTTPPort))
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := s.httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
 			s.logger.WithError(err).Error("HTTP server error")
+			s.ready.listenerFailed("HTTP", err)
 			s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("HTTP server error: %v", err))
 		}
 	}()
@@ -137,14 +405,21 @@ func (s *Server) Start(ctx context.Context) error {
 		go func() {
 			s.logger.WithField("port", s.config.Server.HTTPSPort).Info("Starting HTTPS server")
 			s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Starting HTTPS server on port %d", s.config.Server.HTTPSPort))
-			if err := s.httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			listener := httpsListener
+			// Apps with TLS passthrough are routed by SNI before TLS is terminated
+			if s.hasPassthroughApps() {
+				listener = s.newSNIListener(listener)
+			}
+			if err := s.httpsServer.ServeTLS(listener, "", ""); err != nil && err != http.ErrServerClosed {
 				s.logger.WithError(err).Error("HTTPS server error")
+				s.ready.listenerFailed("HTTPS", err)
 				s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("HTTPS server error: %v", err))
 			}
 		}()
 	}
 	
 	s.running = true
+	s.ready.setStarted(true)
 	s.logger.Info("Proxy server started successfully")
 	s.processManager.GetLogManager().Log("proxy-server", "info", "Proxy server started successfully")
 	
@@ -161,10 +436,31 @@ func (s *Server) Stop(ctx context.Context) error {
 	}
 	
 	s.logger.Info("Stopping proxy server")
+	s.ready.setStarted(false)
 	
 	// Stop health checker
 	s.healthChecker.Stop()
 	
+	// Stop alert engine
+	if s.alertEngine != nil {
+		s.alertEngine.Stop()
+	}
+	
+	// Stop autoscale scheduler
+	if s.autoscaler != nil {
+		s.autoscaler.Stop()
+	}
+	
+	// Stop firing scheduled jobs
+	if s.jobScheduler != nil {
+		s.jobScheduler.Stop()
+	}
+	
+	// Stop answering DNS-01 challenges
+	if s.acmeDNS != nil {
+		s.acmeDNS.Stop()
+	}
+	
 	// Stop management API server
 	if s.apiServer != nil {
 		shutdownCtx, cancel := context.WithTimeout(ctx, s.config.Server.ShutdownTimeout)
@@ -193,11 +489,27 @@ func (s *Server) Stop(ctx context.Context) error {
 		}
 	}
 	
+	// Drop idle upstream connections
+	s.transports.closeIdle()
+	
 	// Stop all applications
 	if err := s.processManager.StopAll(ctx); err != nil {
 		s.logger.WithError(err).Error("Error stopping applications")
 	}
 	
+	// Ship the last entries, including those of stopping applications, even
+	// when ctx was cancelled to request the shutdown
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.config.Server.ShutdownTimeout)
+	s.stopLogShipping(shutdownCtx)
+	s.stopStatsD(shutdownCtx)
+	cancel()
+	if s.accessLog != nil {
+		s.accessLog.Close()
+	}
+	if s.logFiles != nil {
+		s.logFiles.close()
+	}
+	
 	s.running = false
 	s.logger.Info("Proxy server stopped")
 	
@@ -211,40 +523,37 @@ func (s *Server) setupCertManager() error {
 		return fmt.Errorf("failed to create cert directory: %w", err)
 	}
 	
-	// Collect domains from apps with TLS enabled
-	domains := s.config.TLS.Domains
-	for _, app := range s.config.Apps {
-		// Only add domains for apps that have TLS enabled
-		if app.TLS.Enabled {
-			hostname := app.Hostname
-			if hostname == "" {
-				hostname = app.Domain // Backward compatibility
-			}
-			if hostname != "" {
-				domains = append(domains, hostname)
-			}
-		}
+	// The basic manager requests every certificate with the global account
+	domains, accounts := s.acmeDomains()
+	for _, accountDomains := range accounts {
+		domains = append(domains, accountDomains...)
+	}
+	
+	client, err := s.acme.Client()
+	if err != nil {
+		return err
+	}
+	eab, err := s.acme.ExternalAccountBinding()
+	if err != nil {
+		return err
 	}
 	
 	// Create autocert manager
 	s.certManager = &autocert.Manager{
-		Cache:      autocert.DirCache(s.config.TLS.CertDir),
+		Cache:      cert.NotifyingCache(autocert.DirCache(s.config.TLS.CertDir), s.certIssued),
 		Prompt:     autocert.AcceptTOS,
 		Email:      s.config.TLS.Email,
 		HostPolicy: autocert.HostWhitelist(domains...),
-	}
-	
-	// Use staging environment if configured
-	if s.config.TLS.Staging {
-		// For staging, we can set the directory URL via the Manager's Client field
-		// This is a simplified approach - in production you might want more control
-		s.logger.Info("Using Let's Encrypt staging environment")
+		RenewBefore: s.config.TLS.Renewal.RenewBefore,
+		Client:     client,
+		ExternalAccountBinding: eab,
 	}
 	
 	s.logger.WithFields(logrus.Fields{
-		"domains":  domains,
-		"cert_dir": s.config.TLS.CertDir,
-		"staging":  s.config.TLS.Staging,
+		"domains":   domains,
+		"cert_dir":  s.config.TLS.CertDir,
+		"staging":   s.config.TLS.Staging,
+		"directory": client.DirectoryURL,
 	}).Info("Certificate manager configured")
 	
 	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Certificate manager configured for domains: %v (cert_dir: %s, staging: %v)", domains, s.config.TLS.CertDir, s.config.TLS.Staging))
@@ -252,22 +561,37 @@ func (s *Server) setupCertManager() error {
 	return nil
 }
 
-// setupAdvancedCertManager sets up the enhanced certificate manager
-func (s *Server) setupAdvancedCertManager() error {
-	// Collect domains from apps with TLS enabled
-	domains := s.config.TLS.Domains
+// acmeDomains collects the domains of apps with TLS enabled that get their
+// certificates from ACME: those requested with the global account, and by
+// email those of apps with an account of their own
+func (s *Server) acmeDomains() (domains []string, accounts map[string][]string) {
+	domains = append(domains, s.config.TLS.Domains...)
+	accounts = make(map[string][]string)
 	for _, app := range s.config.Apps {
-		// Only add domains for apps that have TLS enabled
-		if app.TLS.Enabled {
-			hostname := app.Hostname
-			if hostname == "" {
-				hostname = app.Domain // Backward compatibility
-			}
-			if hostname != "" {
-				domains = append(domains, hostname)
-			}
+		// Only add domains for apps that have TLS enabled, do not terminate it themselves and bring no certificate
+		if !app.TLS.Enabled || app.TLS.Passthrough || app.TLS.CertFile != "" {
+			continue
+		}
+		hostname := app.Hostname
+		if hostname == "" {
+			hostname = app.Domain // Backward compatibility
+		}
+		// Local development hostnames are served by the local CA
+		if hostname == "" || s.config.TLS.LocalCA.Enabled && cert.IsLocalHostname(hostname) {
+			continue
+		}
+		if email := app.TLS.Email; email != "" && email != s.config.TLS.Email {
+			accounts[email] = append(accounts[email], hostname)
+		} else {
+			domains = append(domains, hostname)
 		}
 	}
+	return domains, accounts
+}
+
+// setupAdvancedCertManager sets up the enhanced certificate manager
+func (s *Server) setupAdvancedCertManager() error {
+	domains, accounts := s.acmeDomains()
 	
 	// Create certificate configuration
 	certConfig := &cert.Config{
@@ -278,6 +602,11 @@ func (s *Server) setupAdvancedCertManager() error {
 		Domains:    domains,
 		Staging:    s.config.TLS.Staging,
 		ForceHTTPS: s.config.TLS.ForceHTTPS,
+		RenewBefore: s.config.TLS.Renewal.RenewBefore,
+		ACME:       s.acme,
+		Accounts:   accounts,
+		Concurrency: s.config.TLS.Issuance.Concurrency,
+		MaxOrders:  s.config.TLS.Issuance.MaxOrders,
 	}
 	
 	// Create enhanced certificate manager
@@ -333,24 +662,48 @@ func (s *Server) setupServers() error {
 			WriteTimeout: s.config.Server.WriteTimeout,
 		}
 		
+		var getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
 		if s.config.TLS.AutoCert {
 			// Use advanced certificate manager if available, otherwise fallback to basic
-			var getCert func(*tls.ClientHelloInfo) (*tls.Certificate, error)
+			getCert = s.acmeCertificate()
 			
 			if s.advancedCertMgr != nil {
-				getCert = s.advancedCertMgr.GetCertificate
 				s.logger.Info("Using advanced certificate manager for HTTPS")
 				s.processManager.GetLogManager().Log("proxy-server", "info", "Using advanced certificate manager for HTTPS")
 			} else {
-				getCert = s.certManager.GetCertificate
 				s.logger.Info("Using basic certificate manager for HTTPS")
 				s.processManager.GetLogManager().Log("proxy-server", "info", "Using basic certificate manager for HTTPS")
 			}
 			
-			s.httpsServer.TLSConfig = &tls.Config{
-				GetCertificate: getCert,
-				NextProtos:     []string{"h2", "http/1.1"},
-				MinVersion:     tls.VersionTLS12, // Security best practice
+			if s.dnsIssuer != nil {
+				getCert = s.withDNSCertificates(getCert)
+			}
+		}
+		
+		// Development hostnames get certificates from the local CA
+		if s.localCA != nil {
+			getCert = s.withLocalCertificates(getCert)
+		}
+		
+		// Certificates from files take precedence over ACME for their hostnames
+		if s.certStore != nil {
+			getCert = s.withStoredCertificates(getCert)
+			getCert = s.withDefaultCertificate(getCert)
+		}
+		
+		if getCert != nil {
+			tlsConfig, err := s.config.TLS.ServerTLSConfig()
+			if err != nil {
+				return fmt.Errorf("invalid tls policy: %w", err)
+			}
+			tlsConfig.GetCertificate = getCert
+			// TLS-ALPN-01 challenges are answered on the HTTPS port
+			if s.config.TLS.AutoCert && !slices.Contains(tlsConfig.NextProtos, acme.ALPNProto) {
+				tlsConfig.NextProtos = append(tlsConfig.NextProtos, acme.ALPNProto)
+			}
+			s.httpsServer.TLSConfig = tlsConfig
+			if len(s.clientAuth) > 0 {
+				s.withClientAuth(s.httpsServer.TLSConfig)
 			}
 		}
 	}
@@ -360,8 +713,9 @@ func (s *Server) setupServers() error {
 
 // handleHTTPRequest handles HTTP requests
 func (s *Server) handleHTTPRequest(w http.ResponseWriter, r *http.Request) {
-	// If TLS is enabled and force HTTPS is on, redirect to HTTPS
-	if s.config.TLS.Enabled && s.config.TLS.ForceHTTPS {
+	// If TLS is enabled and force HTTPS is on, redirect to HTTPS. Passthrough apps
+	// only speak TLS, so their plain HTTP requests are always redirected.
+	if s.config.TLS.Enabled && (s.config.TLS.ForceHTTPS || s.passthroughApp(stripPort(r.Host)) != nil) {
 		httpsURL := &url.URL{
 			Scheme: "https",
 			Host:   r.Host,
@@ -391,15 +745,20 @@ type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	size       int
+	defaults   map[string]string // Default response headers added before the header is written
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
+	if rw.statusCode == 0 {
+		applyDefaultHeaders(rw.Header(), rw.defaults)
+	}
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
 	if rw.statusCode == 0 {
+		applyDefaultHeaders(rw.Header(), rw.defaults)
 		rw.statusCode = 200
 	}
 	size, err := rw.ResponseWriter.Write(b)
@@ -407,12 +766,34 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Flush sends buffered data to the client so streaming responses are not held back
+func (rw *responseWriter) Flush() {
+	if rw.statusCode == 0 {
+		applyDefaultHeaders(rw.Header(), rw.defaults)
+		rw.statusCode = 200
+	}
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // proxyRequest proxies the request to the appropriate backend
 func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
 	
 	// Wrap response writer to capture status code and size
-	rw := &responseWriter{ResponseWriter: w, statusCode: 0, size: 0}
+	rw := &responseWriter{ResponseWriter: w, statusCode: 0, size: 0, defaults: s.responseHeaders(nil, r.TLS != nil)}
+	
+	// Assign a request ID shared by the upstream header, the response and the access log
+	r = s.assignRequestID(r)
+	if requestID := requestIDFrom(r); requestID != "" {
+		rw.Header().Set(s.trackingHeaderName(), requestID)
+	}
 	
 	// Find the app for this hostname
 	hostname := r.Host
@@ -421,8 +802,16 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 		hostname = hostname[:colonPos]
 	}
 	
+	// A TLS connection only serves the hostname it was opened for, so one reaching
+	// an app, e.g. through a tunnel, cannot be reused for the other apps
+	if r.TLS != nil && r.TLS.ServerName != "" && !strings.EqualFold(r.TLS.ServerName, hostname) {
+		s.logApacheFormat(r, rw, 421, time.Since(startTime), "-")
+		http.Error(rw, "Misdirected Request", http.StatusMisdirectedRequest)
+		return
+	}
+	
 	var targetApp *config.AppConfig
-	for _, app := range s.config.Apps {
+	for _, app := range s.apps() {
 		// Check both hostname and domain (backward compatibility)
 		appHostname := app.Hostname
 		if appHostname == "" {
@@ -435,17 +824,44 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	
+	// Hostnames no app serves get the catch-all response
+	if targetApp == nil {
+		targetApp = s.catchAllApp()
+	}
 	if targetApp == nil {
-		s.logApacheFormat(r, rw, 404, time.Since(startTime), "-")
-		s.logger.Warn("No application found for domain", "host", r.Host)
-		s.processManager.GetLogManager().Log("proxy-server", "warn", fmt.Sprintf("No application found for domain: %s", r.Host))
-		http.Error(rw, "Domain not found", http.StatusNotFound)
+		s.handleCatchAll(rw, r, startTime)
 		return
 	}
 	
-	// Check if the target process is running
-	proc, exists := s.processManager.GetProcess(targetApp.Name)
-	if !exists || !proc.IsRunning() {
+	// Passthrough apps are reached by SNI only; this request arrived without a matching SNI
+	if targetApp.TLS.Passthrough {
+		s.logApacheFormat(r, rw, 421, time.Since(startTime), targetApp.Name)
+		http.Error(rw, "Misdirected Request", http.StatusMisdirectedRequest)
+		return
+	}
+	rw.defaults = s.responseHeaders(targetApp, r.TLS != nil)
+	
+	// Apps with client_auth only serve clients whose certificate was verified
+	if !s.checkClientCert(rw, r, targetApp) {
+		s.logApacheFormat(r, rw, rw.statusCode, time.Since(startTime), targetApp.Name)
+		return
+	}
+	
+	// Serve the opt-in debug route, the flags route and SPA files instead of proxying
+	if s.handleDebug(rw, r, targetApp) || s.handleFlags(rw, r, targetApp) || s.handleSPA(rw, r, targetApp) {
+		s.logApacheFormat(r, rw, rw.statusCode, time.Since(startTime), targetApp.Name)
+		return
+	}
+	
+	// Pick a running instance, holding back traffic from instances that are still warming up
+	proc, warming := s.selectInstance(targetApp)
+	if warming {
+		rw.Header().Set("Retry-After", "1")
+		s.logApacheFormat(r, rw, 503, time.Since(startTime), targetApp.Name)
+		http.Error(rw, "Service Warming Up", http.StatusServiceUnavailable)
+		return
+	}
+	if proc == nil {
 		s.logApacheFormat(r, rw, 503, time.Since(startTime), targetApp.Name)
 		s.logger.Error("Target application is not running", "app", targetApp.Name)
 		s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Target application %s is not running", targetApp.Name))
@@ -453,55 +869,137 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Create reverse proxy
+	streaming := isStreamingRequest(targetApp, r)
+	
+	// Streaming routes flush every write and are exempt from the server write timeout
+	if streaming {
+		if err := http.NewResponseController(rw).SetWriteDeadline(time.Time{}); err != nil {
+			s.logger.WithError(err).WithField("app", targetApp.Name).Debug("Could not clear write deadline for streaming request")
+		}
+	} else if targetApp.Timeouts.Total > 0 {
+		// Bound the whole upstream exchange; the deadline travels with the request context
+		ctx, cancel := context.WithTimeout(r.Context(), targetApp.Timeouts.Total)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	
+	// Proxy the request. Idempotent requests that cannot reach the instance are
+	// retried once on another healthy instance before answering 502.
+	if err := s.forward(rw, r, targetApp, proc, streaming, canHedge(r), startTime); err != nil {
+		fallback := s.selectFallback(targetApp, proc)
+		if fallback == nil {
+			s.upstreamError(rw, r, targetApp, err, startTime)
+		} else {
+			s.logger.WithFields(logrus.Fields{
+				"app":      targetApp.Name,
+				"failed":   proc.Config.Name,
+				"fallback": fallback.Config.Name,
+				"error":    err,
+			}).Warn("Upstream connection failed, retrying on another instance")
+			if err := s.forward(rw, r, targetApp, fallback, streaming, false, startTime); err != nil {
+				s.upstreamError(rw, r, targetApp, err, startTime)
+			}
+		}
+	}
+	
+	// Log in Apache Combined Log Format
+	duration := time.Since(startTime)
+	statusCode := rw.statusCode
+	if statusCode == 0 {
+		statusCode = 200
+	}
+	
+	s.metrics.RecordRequest(targetApp.Name, statusCode, duration)
+	s.logApacheFormat(r, rw, statusCode, duration, targetApp.Name)
+}
+
+// forward proxies the request to one instance. With hedge set, connection errors
+// that happen before anything was written are returned instead of answered so the
+// caller can retry elsewhere; every other error is answered here.
+func (s *Server) forward(rw *responseWriter, r *http.Request, targetApp *config.AppConfig, proc *process.Process, streaming, hedge bool, startTime time.Time) error {
 	targetURL := &url.URL{
 		Scheme: "http",
-		Host:   fmt.Sprintf("localhost:%d", targetApp.Port),
+		Host:   fmt.Sprintf("localhost:%d", proc.Config.Port),
 	}
 	
 	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	proxy.Transport = s.transports.get(targetApp)
+	proxy.FlushInterval = targetApp.Streaming.FlushInterval
+	if streaming {
+		proxy.FlushInterval = -1
+	}
 	
 	// Customize the proxy director to modify the request
 	originalDirector := proxy.Director
 	proxy.Director = func(req *http.Request) {
 		originalDirector(req)
-		req.Header.Set("X-Forwarded-For", getClientIP(r))
-		if r.TLS != nil {
-			req.Header.Set("X-Forwarded-Proto", "https")
-		} else {
-			req.Header.Set("X-Forwarded-Proto", "http")
-		}
-		req.Header.Set("X-Forwarded-Host", r.Host)
-		
-		// Inject request tracking header (UUID4 chain)
-		s.injectTrackingHeader(req, r)
-		
-		// Inject certificate headers (valve-inspired)
-		s.injectCertificateHeaders(req, r, targetApp)
+		s.rewriteUpstreamHeaders(req, r, targetApp)
 	}
 	
 	// Handle proxy errors
+	var hedgeErr error
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		s.logApacheFormat(r, rw, 502, time.Since(startTime), targetApp.Name)
-		s.logger.Error("Proxy error", "app", targetApp.Name, "error", err)
-		s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Proxy error for app %s: %v", targetApp.Name, err))
-		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		if hedge && rw.statusCode == 0 && isConnectionError(err) {
+			hedgeErr = err
+			return
+		}
+		s.upstreamError(rw, r, targetApp, err, startTime)
 	}
 	
-	// Proxy the request
 	proxy.ServeHTTP(rw, r)
+	return hedgeErr
+}
+
+// upstreamError answers a failed upstream request with 504 on timeouts and 502 otherwise
+func (s *Server) upstreamError(rw *responseWriter, r *http.Request, targetApp *config.AppConfig, err error, startTime time.Time) {
+	if isTimeout(err) {
+		s.logApacheFormat(r, rw, 504, time.Since(startTime), targetApp.Name)
+		s.logger.Error("Upstream timeout", "app", targetApp.Name, "error", err)
+		s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Upstream timeout for app %s: %v", targetApp.Name, err))
+		http.Error(rw, "Gateway Timeout", http.StatusGatewayTimeout)
+		return
+	}
+	s.logApacheFormat(r, rw, 502, time.Since(startTime), targetApp.Name)
+	s.logger.Error("Proxy error", "app", targetApp.Name, "error", err)
+	s.processManager.GetLogManager().Log("proxy-server", "error", fmt.Sprintf("Proxy error for app %s: %v", targetApp.Name, err))
+	http.Error(rw, "Bad Gateway", http.StatusBadGateway)
+}
+
+// rewriteUpstreamHeaders sets the forwarding, tracking and certificate headers sent to the app
+func (s *Server) rewriteUpstreamHeaders(req *http.Request, r *http.Request, targetApp *config.AppConfig) {
+	// Drop forwarding headers a client could have spoofed unless the peer is a trusted proxy.
+	// ReverseProxy appends the peer address to X-Forwarded-For after the director runs.
+	if !s.clientIPs.fromTrustedProxy(r) {
+		req.Header.Del("X-Forwarded-For")
+		req.Header.Del("Forwarded")
+	}
 	
-	// Log in Apache Combined Log Format
-	duration := time.Since(startTime)
-	statusCode := rw.statusCode
-	if statusCode == 0 {
-		statusCode = 200
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	clientIP := s.getClientIP(r)
+	req.Header.Set("X-Real-IP", clientIP)
+	req.Header.Set("X-Forwarded-Proto", proto)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	
+	forwarded := forwardedElement(remoteIP(r), r.Host, proto)
+	if existing := req.Header.Get("Forwarded"); existing != "" {
+		forwarded = existing + ", " + forwarded
 	}
+	req.Header.Set("Forwarded", forwarded)
 	
-	s.logApacheFormat(r, rw, statusCode, duration, targetApp.Name)
+	// Inject request tracking header (UUID4 chain)
+	s.injectTrackingHeader(req, r)
+	
+	// Inject certificate headers (valve-inspired)
+	s.injectCertificateHeaders(req, r, targetApp)
+	s.injectClientCertHeaders(req, r, targetApp)
 }
 
-// logApacheFormat logs HTTP requests in Apache Combined Log Format
+// logApacheFormat logs HTTP requests in Apache Combined Log Format, or in the
+// format of access_log_format or of the access log file. Lines go to the
+// access log file when one is configured, else to the server log.
 func (s *Server) logApacheFormat(r *http.Request, rw *responseWriter, statusCode int, duration time.Duration, app string) {
 	// Apache Combined Log Format:
 	// "%h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\""
@@ -515,82 +1013,77 @@ func (s *Server) logApacheFormat(r *http.Request, rw *responseWriter, statusCode
 	// %{Referer}i - Referer header
 	// %{User-Agent}i - User-Agent header
 	
-	clientIP := getClientIP(r)
-	timestamp := time.Now().Add(-duration).Format("02/Jan/2006:15:04:05 -0700")
-	requestLine := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
-	size := rw.size
-	if size == 0 {
-		size = 0
-	}
-	referer := r.Header.Get("Referer")
-	if referer == "" {
-		referer = "-"
-	}
-	userAgent := r.Header.Get("User-Agent")
-	if userAgent == "" {
-		userAgent = "-"
-	}
-	
-	// Get tracking information for logging
-	trackingInfo := s.getTrackingInfo(r)
-	trackingStr := ""
-	if trackingInfo != nil {
-		trackingStr = fmt.Sprintf(" track=%s", trackingInfo["tracking_chain"])
-	}
-	
-	// Log entry format: clientIP - - [timestamp] "requestLine" statusCode size "referer" "userAgent" app responseTime tracking
-	logEntry := fmt.Sprintf(`%s - - [%s] "%s" %d %d "%s" "%s" app=%s rt=%dms%s`,
-		clientIP,
-		timestamp,
-		requestLine,
-		statusCode,
-		size,
-		referer,
-		userAgent,
-		app,
-		duration.Milliseconds(),
-		trackingStr,
-	)
+	var logEntry string
+	switch format := s.accessLogFormat(); format {
+	case config.AccessLogJSON:
+		logEntry = s.accessLogJSON(r, rw, statusCode, duration, app)
+	case config.AccessLogCommon, config.AccessLogCombined:
+		logEntry = s.accessLogCLF(r, rw, statusCode, duration, format == config.AccessLogCombined)
+	default:
+		clientIP := s.getClientIP(r)
+		timestamp := time.Now().Add(-duration).Format("02/Jan/2006:15:04:05 -0700")
+		requestLine := fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto)
+		size := rw.size
+		if size == 0 {
+			size = 0
+		}
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			referer = "-"
+		}
+		userAgent := r.Header.Get("User-Agent")
+		if userAgent == "" {
+			userAgent = "-"
+		}
+		
+		// Get tracking information for logging
+		trackingInfo := s.getTrackingInfo(r)
+		trackingStr := ""
+		if requestID := requestIDFrom(r); requestID != "" {
+			trackingStr = fmt.Sprintf(" rid=%s", requestID)
+		}
+		if trackingInfo != nil {
+			trackingStr += fmt.Sprintf(" track=%s", trackingInfo["tracking_chain"])
+		}
+		
+		// Log entry format: clientIP - - [timestamp] "requestLine" statusCode size "referer" "userAgent" app responseTime requestID tracking
+		logEntry = fmt.Sprintf(`%s - - [%s] "%s" %d %d "%s" "%s" app=%s rt=%dms%s`,
+			clientIP,
+			timestamp,
+			requestLine,
+			statusCode,
+			size,
+			referer,
+			userAgent,
+			app,
+			duration.Milliseconds(),
+			trackingStr,
+		)
+	}
 	
 	// Determine log level based on status code
-	var level string
+	level, logrusLevel := "info", logrus.InfoLevel
 	if statusCode >= 500 {
-		level = "error"
-		s.logger.Error(logEntry)
+		level, logrusLevel = "error", logrus.ErrorLevel
 	} else if statusCode >= 400 {
-		level = "warn"
-		s.logger.Warn(logEntry)
+		level, logrusLevel = "warn", logrus.WarnLevel
+	}
+	
+	if s.accessLog != nil {
+		if _, err := s.accessLog.Write([]byte(logEntry + "\n")); err != nil {
+			s.logger.WithError(err).Warn("Failed to write access log")
+		}
 	} else {
-		level = "info"
-		s.logger.Info(logEntry)
+		s.logger.Log(logrusLevel, logEntry)
 	}
 	
 	// Also log directly to circular buffer for guvnor logs command
 	s.processManager.GetLogManager().Log("proxy-server", level, logEntry)
 }
 
-// getClientIP extracts the real client IP from request headers
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header first (most common)
-	if xf := r.Header.Get("X-Forwarded-For"); xf != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		if idx := strings.Index(xf, ","); idx > 0 {
-			return strings.TrimSpace(xf[:idx])
-		}
-		return strings.TrimSpace(xf)
-	}
-	
-	// Check X-Real-IP header
-	if xr := r.Header.Get("X-Real-IP"); xr != "" {
-		return strings.TrimSpace(xr)
-	}
-	
-	// Fallback to remote address
-	if idx := strings.LastIndex(r.RemoteAddr, ":"); idx > 0 {
-		return r.RemoteAddr[:idx]
-	}
-	
-	return r.RemoteAddr
+// getClientIP returns the client IP, honoring forwarding headers only from trusted proxies
+func (s *Server) getClientIP(r *http.Request) string {
+	return s.clientIPs.ClientIP(r)
 }
 
 // injectCertificateHeaders injects certificate information as headers (valve-inspired)
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// spaIndex is served for client-side routes of a single-page app
+const spaIndex = "index.html"
+
+// handleSPA serves the built single-page app of spa-api apps. It reports false
+// for API requests, which are proxied to the app as usual.
+func (s *Server) handleSPA(rw *responseWriter, r *http.Request, app *config.AppConfig) bool {
+	if app.Preset != config.PresetSPAAPI || app.SPA.IsAPI(r.URL.Path) {
+		return false
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return true
+	}
+
+	serveSPA(rw, r, app.SPA.Root)
+	return true
+}
+
+// serveSPA serves a file from the SPA root. Paths without a file fall back to
+// index.html so the app's router can handle them; missing assets (paths with an
+// extension) are answered 404 instead of with HTML.
+func serveSPA(w http.ResponseWriter, r *http.Request, root string) {
+	name := path.Clean("/" + r.URL.Path)
+	if name != "/" && serveSPAFile(w, r, filepath.Join(root, filepath.FromSlash(name))) {
+		return
+	}
+	if name != "/" && path.Ext(name) != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The index names the current build's assets, so it is always revalidated
+	w.Header().Set("Cache-Control", "no-cache")
+	if !serveSPAFile(w, r, filepath.Join(root, spaIndex)) {
+		w.Header().Del("Cache-Control")
+		http.Error(w, "SPA index.html not found, build the frontend first", http.StatusNotFound)
+	}
+}
+
+// serveSPAFile serves a regular file and reports whether there was one
+func serveSPAFile(w http.ResponseWriter, r *http.Request, file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return true
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/metrics"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// setupStatsD creates the statsd client of metrics.statsd and forwards the
+// request and restart observations of the recorder to it
+func (s *Server) setupStatsD(logger *logrus.Logger) error {
+	cfg := s.config.Metrics.StatsD
+	if cfg.Address == "" {
+		return nil
+	}
+	client, err := metrics.NewStatsD(metrics.StatsDConfig{
+		Address: cfg.Address,
+		Prefix:  cfg.Prefix,
+		Flavor:  cfg.Flavor,
+		Tags:    cfg.Tags,
+	}, logger)
+	if err != nil {
+		return err
+	}
+	s.statsd = client
+	s.metrics.AddSink(client)
+	s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("Sending metrics to statsd at %s", cfg.Address))
+	return nil
+}
+
+// startStatsD starts sending metrics, and the health and instance gauges
+// every interval until ctx is done
+func (s *Server) startStatsD(ctx context.Context) {
+	if s.statsd == nil {
+		return
+	}
+	s.statsd.Start()
+
+	interval := s.config.Metrics.StatsD.Interval
+	if interval <= 0 {
+		interval = config.DefaultStatsDInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.sendGauges()
+			}
+		}
+	}()
+}
+
+// sendGauges sends the running instances of every app and the liveness of
+// every instance
+func (s *Server) sendGauges() {
+	running := make(map[string]int)
+	for _, app := range s.apps() {
+		running[app.Name] = 0
+	}
+	instances := make(map[string]string) // Process name to app
+	for _, info := range s.processManager.GetRunningProcessInfo() {
+		app := info.App
+		if app == "" {
+			app = info.Name
+		}
+		instances[info.Name] = app
+		if info.Status == string(process.StatusRunning) {
+			running[app]++
+		}
+	}
+	for app, count := range running {
+		s.statsd.Gauge("instances", float64(count), "app", app)
+	}
+
+	for name, result := range s.healthChecker.GetAllResults() {
+		app, exists := instances[name]
+		if !exists {
+			continue
+		}
+		healthy := 0.0
+		if result.Status == health.StatusHealthy {
+			healthy = 1
+		}
+		s.statsd.Gauge("health.healthy", healthy, "app", app, "instance", name)
+		s.statsd.Gauge("health.consecutive_failures", float64(result.ConsecutiveFailures), "app", app, "instance", name)
+	}
+}
+
+// stopStatsD sends the metrics still queued, waiting until ctx is done
+func (s *Server) stopStatsD(ctx context.Context) {
+	if s.statsd != nil {
+		s.statsd.Stop(ctx)
+	}
+}
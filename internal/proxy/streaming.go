@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// isStreamingRequest reports whether a request targets a streaming route: one of the
+// app's configured streaming paths, or any request asking for Server-Sent Events.
+func isStreamingRequest(app *config.AppConfig, r *http.Request) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return true
+	}
+
+	for _, prefix := range app.Streaming.Paths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/cron"
+	"github.com/gleicon/guvnor/internal/notify"
+	"github.com/gleicon/guvnor/internal/tlsaudit"
+)
+
+// startTLSAudit audits the served hostnames on the tls.audit schedule, logging
+// every result and notifying the configured sinks about hostnames that fail
+func (s *Server) startTLSAudit(ctx context.Context) {
+	audit := s.config.TLS.Audit
+	schedule, err := cron.Parse(audit.Schedule)
+	if err != nil {
+		// Rejected by config validation already
+		s.logger.WithError(err).Error("Invalid tls audit schedule")
+		return
+	}
+	hosts := tlsaudit.Hostnames(s.config)
+	if len(hosts) == 0 {
+		s.logger.Warn("TLS audit is scheduled but no public hostnames are configured")
+		return
+	}
+
+	auditor := &tlsaudit.Auditor{Resolver: audit.Resolver}
+	s.logger.WithFields(logrus.Fields{"schedule": schedule.String(), "hosts": len(hosts)}).Info("Scheduled TLS audit")
+
+	go func() {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			for _, report := range auditor.AuditAll(ctx, hosts) {
+				s.reportTLSAudit(report)
+			}
+		}
+	}()
+}
+
+// reportTLSAudit logs one hostname's audit and notifies about failures
+func (s *Server) reportTLSAudit(report tlsaudit.Report) {
+	logger := s.logger.WithField("host", report.Host)
+	problems := report.Problems()
+	if len(problems) == 0 {
+		logger.Info("TLS audit passed, ready for HSTS preload")
+		return
+	}
+
+	fields := make(map[string]string, len(problems))
+	details := make([]string, 0, len(problems))
+	for _, check := range problems {
+		fields[check.Name] = fmt.Sprintf("%s: %s", check.Status, check.Detail)
+		details = append(details, fmt.Sprintf("%s (%s)", check.Name, check.Status))
+		logger.WithFields(logrus.Fields{"check": check.Name, "status": check.Status}).Warn(check.Detail)
+	}
+	if !report.Failed() {
+		// Warnings only block preload, they are not worth paging anyone about
+		return
+	}
+
+	n := notify.Notification{
+		Title:     fmt.Sprintf("TLS audit failed for %s", report.Host),
+		Message:   fmt.Sprintf("Checks not passing for %s: %s", report.Host, strings.Join(details, ", ")),
+		Severity:  "warning",
+		Timestamp: report.CheckedAt,
+		Fields:    fields,
+	}
+	for _, name := range s.config.TLS.Audit.Notify {
+		sink, exists := s.sinks[name]
+		if !exists {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		if err := sink.Send(ctx, n); err != nil {
+			logger.WithError(err).WithField("sink", name).Error("Failed to deliver TLS audit notification")
+		}
+		cancel()
+	}
+}
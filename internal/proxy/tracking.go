@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"net/http"
@@ -26,6 +27,31 @@ func generateUUID4() string {
 		b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
+// requestIDKey is the context key holding the request ID assigned by the proxy
+type requestIDKey struct{}
+
+// trackingHeaderName returns the configured tracking header name
+func (s *Server) trackingHeaderName() string {
+	if s.config.Server.TrackingHeader == "" {
+		return "X-GUVNOR-TRACKING"
+	}
+	return s.config.Server.TrackingHeader
+}
+
+// assignRequestID attaches a new request ID to the request context when tracking is enabled
+func (s *Server) assignRequestID(r *http.Request) *http.Request {
+	if !s.config.Server.EnableTracking {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, generateUUID4()))
+}
+
+// requestIDFrom returns the request ID assigned by the proxy, if any
+func requestIDFrom(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDKey{}).(string)
+	return requestID
+}
+
 // injectTrackingHeader manages the request tracking header
 // This creates a chain of UUIDs separated by semicolons to trace requests across services
 func (s *Server) injectTrackingHeader(req *http.Request, r *http.Request) {
@@ -33,13 +59,13 @@ func (s *Server) injectTrackingHeader(req *http.Request, r *http.Request) {
 		return
 	}
 	
-	headerName := s.config.Server.TrackingHeader
-	if headerName == "" {
-		headerName = "X-GUVNOR-TRACKING"
-	}
+	headerName := s.trackingHeaderName()
 	
-	// Generate a new UUID for this hop
-	newUUID := generateUUID4()
+	// Use the request ID assigned for this hop, generating one if none was assigned
+	newUUID := requestIDFrom(r)
+	if newUUID == "" {
+		newUUID = generateUUID4()
+	}
 	
 	// Check if tracking header already exists
 	existingHeader := r.Header.Get(headerName)
@@ -94,10 +120,7 @@ func (s *Server) getTrackingInfo(r *http.Request) map[string]interface{} {
 		return nil
 	}
 	
-	headerName := s.config.Server.TrackingHeader
-	if headerName == "" {
-		headerName = "X-GUVNOR-TRACKING"
-	}
+	headerName := s.trackingHeaderName()
 	
 	chain := extractTrackingChain(r, headerName)
 	if len(chain) == 0 {
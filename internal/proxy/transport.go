@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// transportCache keeps one upstream transport per app so per-app timeouts apply
+// without losing connection reuse
+type transportCache struct {
+	transports map[string]*http.Transport
+	mu         sync.Mutex
+}
+
+func newTransportCache() *transportCache {
+	return &transportCache{transports: make(map[string]*http.Transport)}
+}
+
+// get returns the transport for an app, creating it from the app's timeouts
+func (c *transportCache) get(app *config.AppConfig) *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if transport, exists := c.transports[app.Name]; exists {
+		return transport
+	}
+
+	connectTimeout := app.Timeouts.Connect
+	if connectTimeout == 0 {
+		connectTimeout = 30 * time.Second
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.ResponseHeaderTimeout = app.Timeouts.ResponseHeader
+
+	c.transports[app.Name] = transport
+	return transport
+}
+
+// closeIdle closes idle upstream connections of every app
+func (c *transportCache) closeIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, transport := range c.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// isTimeout reports whether an upstream error was caused by a deadline or timeout
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// isConnectionError reports whether an upstream error means the instance could not be
+// reached or dropped the connection, as opposed to a slow or bad response
+func isConnectionError(err error) bool {
+	if isTimeout(err) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/health"
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// minWarmupWeight is the share of traffic an instance gets at the beginning of its ramp
+const minWarmupWeight = 0.1
+
+// warmupState tracks slow start progress for one process instance
+type warmupState struct {
+	startedAt time.Time // Start time of the instance this state refers to
+	ready     bool
+	readyAt   time.Time
+	streak    int
+}
+
+// warmupTracker gates traffic to freshly started processes
+type warmupTracker struct {
+	states map[string]*warmupState
+	mu     sync.Mutex
+}
+
+func newWarmupTracker() *warmupTracker {
+	return &warmupTracker{states: make(map[string]*warmupState)}
+}
+
+// watchWarmups starts slow start for every instance of an app with slow_start
+// as soon as it starts, until ctx is done
+func (s *Server) watchWarmups(ctx context.Context) {
+	processEvents, unsubscribe := s.processManager.Subscribe()
+	go func() {
+		defer unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-processEvents:
+				if e.Type != process.EventStarted {
+					continue
+				}
+				if app := s.appConfig(e.Process.AppName()); app != nil && app.SlowStart.Enabled() {
+					s.warmup.mu.Lock()
+					s.beginWarmup(app, e.Process)
+					s.warmup.mu.Unlock()
+				}
+			}
+		}
+	}()
+}
+
+// beginWarmup returns the slow start state of an instance, resetting it and
+// starting the health probes when the instance is new. Callers hold s.warmup.mu.
+func (s *Server) beginWarmup(app *config.AppConfig, proc *process.Process) *warmupState {
+	startedAt := proc.GetStartTime()
+	state, exists := s.warmup.states[proc.Config.Name]
+	if exists && state.startedAt.Equal(startedAt) {
+		return state
+	}
+
+	state = &warmupState{startedAt: startedAt}
+	s.warmup.states[proc.Config.Name] = state
+	if app.SlowStart.HealthyChecks > 0 {
+		go s.probeWarmup(*app, proc, startedAt)
+	} else {
+		state.ready = true
+		state.readyAt = startedAt
+	}
+	return state
+}
+
+// warmupWeight returns whether an instance passed its slow start health checks
+// and the share of traffic it should get while its ramp lasts, from
+// minWarmupWeight to 1
+func (s *Server) warmupWeight(app *config.AppConfig, proc *process.Process) (ready bool, weight float64) {
+	if !app.SlowStart.Enabled() {
+		return true, 1
+	}
+
+	// Instances started before the server watched them, e.g. adopted ones, begin here
+	s.warmup.mu.Lock()
+	state := s.beginWarmup(app, proc)
+	ready, readyAt := state.ready, state.readyAt
+	s.warmup.mu.Unlock()
+
+	if !ready {
+		return false, 0
+	}
+	if app.SlowStart.Duration <= 0 {
+		return true, 1
+	}
+	elapsed := time.Since(readyAt)
+	if elapsed >= app.SlowStart.Duration {
+		return true, 1
+	}
+	return true, max(float64(elapsed)/float64(app.SlowStart.Duration), minWarmupWeight)
+}
+
+// warmingUp reports whether slow start still holds back an instance. Unlike
+// warmupWeight it never starts probing.
+func (s *Server) warmingUp(app *config.AppConfig, proc *process.Process) bool {
+	if !app.SlowStart.Enabled() {
+		return false
+	}
+
+	s.warmup.mu.Lock()
+	defer s.warmup.mu.Unlock()
+
+	state, exists := s.warmup.states[proc.Config.Name]
+	if !exists || !state.startedAt.Equal(proc.GetStartTime()) {
+		return true
+	}
+	return !state.ready
+}
+
+// probeWarmup runs health checks until the instance passes enough consecutive checks
+func (s *Server) probeWarmup(app config.AppConfig, proc *process.Process, startedAt time.Time) {
+	ticker := time.NewTicker(app.SlowStart.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// Stop probing if the instance was replaced or stopped
+		if !proc.IsRunning() || !proc.GetStartTime().Equal(startedAt) {
+			return
+		}
+
+		result := s.healthChecker.CheckApp(proc.Config.Name, readinessCheck(&app), proc.Config.Port)
+
+		s.warmup.mu.Lock()
+		state, exists := s.warmup.states[proc.Config.Name]
+		if !exists || !state.startedAt.Equal(startedAt) {
+			s.warmup.mu.Unlock()
+			return
+		}
+		if result.Status == health.StatusHealthy {
+			state.streak++
+		} else {
+			state.streak = 0
+		}
+		if state.streak >= app.SlowStart.HealthyChecks {
+			state.ready = true
+			state.readyAt = time.Now()
+		}
+		ready := state.ready
+		s.warmup.mu.Unlock()
+
+		if ready {
+			s.processManager.GetLogManager().Log("proxy-server", "info", fmt.Sprintf("App %s warmed up after %d healthy checks, routing traffic", proc.Config.Name, app.SlowStart.HealthyChecks))
+			return
+		}
+	}
+}
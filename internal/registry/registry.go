@@ -0,0 +1,124 @@
+// Package registry records the guvnor servers running for a user, so clients
+// find them whatever ports they use. Each server writes a runtime info file
+// named after its PID to a well-known directory while it runs.
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/process"
+)
+
+// Entry is the runtime info of one server
+type Entry struct {
+	PID       int       `json:"pid"`
+	HTTPPort  int       `json:"http_port"`
+	APIPort   int       `json:"api_port"`
+	Socket    string    `json:"socket,omitempty"` // Management API socket, "" without one
+	Config    string    `json:"config,omitempty"` // Absolute path of the config file, "" without one
+	Dir       string    `json:"dir"`              // Working directory of the server
+	StartedAt time.Time `json:"started_at"`
+	Version   string    `json:"version"`
+}
+
+// DirEnv overrides the registry directory
+const DirEnv = "GUVNOR_REGISTRY_DIR"
+
+// Dir returns the registry directory: $GUVNOR_REGISTRY_DIR, or
+// $XDG_RUNTIME_DIR/guvnor, /var/run/guvnor for root, and ~/.guvnor/run
+// otherwise
+func Dir() string {
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "guvnor")
+	}
+	if os.Geteuid() == 0 {
+		return filepath.Join("/var/run", "guvnor")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".guvnor", "run")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("guvnor-%d", os.Getuid()))
+}
+
+// Register writes the entry of a running server to dir and returns the path
+// of its file, to be removed with Unregister when the server stops
+func Register(dir string, entry Entry) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create server registry %s: %w", dir, err)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	// Written aside and renamed so readers never see a partial entry
+	path := filepath.Join(dir, strconv.Itoa(entry.PID)+".json")
+	tmp, err := os.CreateTemp(dir, ".entry-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to register server: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to register server: %w", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to register server: %w", err)
+	}
+	return path, nil
+}
+
+// Unregister removes the file of a stopped server
+func Unregister(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns the entries of the servers in dir, newest first. Entries left
+// by servers that are no longer running are removed.
+func List(dir string) ([]Entry, error) {
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server registry: %w", err)
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil || !process.Alive(entry.PID) {
+			os.Remove(path)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StartedAt.After(entries[j].StartedAt)
+	})
+	return entries, nil
+}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Now()
+
+	path, err := Register(dir, Entry{PID: os.Getpid(), HTTPPort: 8080, APIPort: 9080, Dir: "/srv/web", StartedAt: started, Version: "dev"})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if path != filepath.Join(dir, strconv.Itoa(os.Getpid())+".json") {
+		t.Errorf("Unexpected entry path %s", path)
+	}
+	// A server that died without unregistering, with a PID no process has
+	dead, err := Register(dir, Entry{PID: 1 << 30, HTTPPort: 8090, StartedAt: started.Add(time.Second)})
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	entries, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].HTTPPort != 8080 || entries[0].Dir != "/srv/web" || !entries[0].StartedAt.Equal(started) {
+		t.Fatalf("Unexpected entries %+v", entries)
+	}
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale entry to be removed, got %v", err)
+	}
+
+	if err := Unregister(path); err != nil {
+		t.Fatalf("Unregister failed: %v", err)
+	}
+	if entries, _ := List(dir); len(entries) != 0 {
+		t.Errorf("Expected no entries after unregistering, got %+v", entries)
+	}
+	if entries, err := List(filepath.Join(dir, "missing")); err != nil || len(entries) != 0 {
+		t.Errorf("Expected a missing registry to be empty, got %v: %v", entries, err)
+	}
+}
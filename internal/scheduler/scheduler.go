@@ -0,0 +1,157 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+	"github.com/gleicon/guvnor/internal/cron"
+)
+
+// Runner runs an app to completion
+type Runner interface {
+	RunJob(ctx context.Context, appConfig config.AppConfig) (int, error)
+}
+
+// job is a one-shot or scheduled app
+type job struct {
+	app      config.AppConfig
+	schedule *cron.Schedule // Nil for one-shot jobs
+	next     time.Time      // Next scheduled run
+	running  bool
+}
+
+// Scheduler runs one-shot apps once at start and scheduled apps on their cron schedule.
+// A scheduled run is skipped while the previous run of the same app is still going.
+type Scheduler struct {
+	jobs     []*job
+	runner   Runner
+	logger   *logrus.Entry
+	mu       sync.Mutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewScheduler creates a scheduler for every app that runs as a job
+func NewScheduler(apps []config.AppConfig, runner Runner, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		runner: runner,
+		logger: logger.WithField("component", "scheduler"),
+		stopCh: make(chan struct{}),
+	}
+
+	for _, app := range apps {
+		if !app.IsJob() {
+			continue
+		}
+
+		j := &job{app: app}
+		if app.Schedule != "" {
+			schedule, err := cron.Parse(app.Schedule)
+			if err != nil {
+				return nil, err
+			}
+			j.schedule = schedule
+		}
+		s.jobs = append(s.jobs, j)
+	}
+
+	return s, nil
+}
+
+// Empty reports whether no app runs as a job
+func (s *Scheduler) Empty() bool {
+	return len(s.jobs) == 0
+}
+
+// Start runs one-shot jobs and keeps firing scheduled jobs until stopped
+func (s *Scheduler) Start(ctx context.Context) {
+	s.logger.WithField("jobs", len(s.jobs)).Info("Starting job scheduler")
+
+	now := time.Now()
+	s.mu.Lock()
+	for _, j := range s.jobs {
+		if j.schedule == nil {
+			s.launch(ctx, j)
+			continue
+		}
+		j.next = j.schedule.Next(now)
+		s.logger.WithFields(logrus.Fields{"app": j.app.Name, "next_run": j.next}).Info("Scheduled job")
+	}
+	s.mu.Unlock()
+
+	go func() {
+		for {
+			timer := time.NewTimer(time.Until(s.Tick(ctx, time.Now())))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-s.stopCh:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// Stop stops firing scheduled jobs; runs in progress end when their processes are stopped
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() {
+		s.logger.Info("Stopping job scheduler")
+		close(s.stopCh)
+	})
+}
+
+// Tick launches every scheduled job that is due at now and returns
+// when the next one is due
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wake := now.Add(time.Hour)
+	for _, j := range s.jobs {
+		if j.schedule == nil || j.next.IsZero() {
+			continue
+		}
+		if !j.next.After(now) {
+			if j.running {
+				s.logger.WithField("app", j.app.Name).Warn("Previous run still in progress, skipping scheduled run")
+			} else {
+				s.launch(ctx, j)
+			}
+			j.next = j.schedule.Next(now)
+			if j.next.IsZero() {
+				continue
+			}
+		}
+		if j.next.Before(wake) {
+			wake = j.next
+		}
+	}
+
+	return wake
+}
+
+// launch runs a job in the background; the caller holds s.mu
+func (s *Scheduler) launch(ctx context.Context, j *job) {
+	j.running = true
+
+	go func() {
+		logger := s.logger.WithField("app", j.app.Name)
+		logger.Info("Running job")
+		if exitCode, err := s.runner.RunJob(ctx, j.app); err != nil {
+			logger.WithError(err).WithField("exit_code", exitCode).Error("Job failed")
+		} else {
+			logger.Info("Job completed")
+		}
+
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+	}()
+}
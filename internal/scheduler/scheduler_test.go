@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+type fakeRunner struct {
+	mu      sync.Mutex
+	runs    []string
+	release chan struct{}
+}
+
+func (f *fakeRunner) RunJob(ctx context.Context, appConfig config.AppConfig) (int, error) {
+	f.mu.Lock()
+	f.runs = append(f.runs, appConfig.Name)
+	f.mu.Unlock()
+	<-f.release
+	return 0, nil
+}
+
+func (f *fakeRunner) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.runs)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for condition")
+}
+
+func TestScheduler_Tick(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	apps := []config.AppConfig{
+		{Name: "web", Command: "web"},
+		{Name: "cleanup", Command: "cleanup", Schedule: "*/5 * * * *"},
+	}
+	runner := &fakeRunner{release: make(chan struct{})}
+	s, err := NewScheduler(apps, runner, logger)
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	if s.Empty() {
+		t.Fatal("Expected the scheduled app to be picked up")
+	}
+
+	ctx := context.Background()
+	start := time.Date(2024, 1, 10, 9, 2, 0, 0, time.UTC)
+	s.jobs[0].next = s.jobs[0].schedule.Next(start)
+
+	if next := s.Tick(ctx, start); !next.Equal(time.Date(2024, 1, 10, 9, 5, 0, 0, time.UTC)) {
+		t.Errorf("Expected next run at 09:05, got %v", next)
+	}
+	if runner.count() != 0 {
+		t.Fatal("Expected no run before the schedule fires")
+	}
+
+	next := s.Tick(ctx, time.Date(2024, 1, 10, 9, 5, 0, 0, time.UTC))
+	waitFor(t, func() bool { return runner.count() == 1 })
+	if !next.Equal(time.Date(2024, 1, 10, 9, 10, 0, 0, time.UTC)) {
+		t.Errorf("Expected next run at 09:10, got %v", next)
+	}
+
+	// The first run is still going, so the next slot is skipped
+	s.Tick(ctx, time.Date(2024, 1, 10, 9, 10, 0, 0, time.UTC))
+	time.Sleep(20 * time.Millisecond)
+	if runner.count() != 1 {
+		t.Fatalf("Expected overlapping run to be skipped, got %d runs", runner.count())
+	}
+
+	runner.release <- struct{}{}
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.jobs[0].running
+	})
+	s.Tick(ctx, time.Date(2024, 1, 10, 9, 15, 0, 0, time.UTC))
+	waitFor(t, func() bool { return runner.count() == 2 })
+	close(runner.release)
+}
@@ -0,0 +1,150 @@
+// Package secrets resolves secret:// references in app environments when the
+// app starts, so guvnor.yaml can be committed without literal credentials.
+// A reference names a provider and a path, e.g. secret://file/run/secrets/db
+// reads /run/secrets/db; other providers run a command printing the secret.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheme prefixes every secret reference
+const Scheme = "secret://"
+
+// File is the built-in provider reading secrets from files, such as Docker
+// or Kubernetes secrets mounted under /run/secrets
+const File = "file"
+
+// DefaultTimeout bounds a command provider that sets no timeout
+const DefaultTimeout = 10 * time.Second
+
+// Provider looks up the secret at path
+type Provider interface {
+	Lookup(ctx context.Context, path string) (string, error)
+}
+
+// IsReference reports whether value is a secret reference
+func IsReference(value string) bool {
+	return strings.HasPrefix(value, Scheme)
+}
+
+// Parse splits a secret reference into its provider and path
+func Parse(ref string) (provider, path string, err error) {
+	if !IsReference(ref) {
+		return "", "", fmt.Errorf("%q is not a %s reference", ref, Scheme)
+	}
+	provider, path, _ = strings.Cut(strings.TrimPrefix(ref, Scheme), "/")
+	if provider == "" || path == "" {
+		return "", "", fmt.Errorf("invalid secret reference %q, expected %s<provider>/<path>", ref, Scheme)
+	}
+	return provider, path, nil
+}
+
+// Resolver looks up secret references with its providers
+type Resolver struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+// NewResolver creates a resolver with the built-in file provider
+func NewResolver() *Resolver {
+	return &Resolver{providers: map[string]Provider{File: fileProvider{}}}
+}
+
+// Register adds or replaces a provider
+func (r *Resolver) Register(name string, provider Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = provider
+}
+
+// Resolve returns the secret a reference points to
+func (r *Resolver) Resolve(ctx context.Context, ref string) (string, error) {
+	name, path, err := Parse(ref)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.RLock()
+	provider, exists := r.providers[name]
+	r.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("unknown secret provider %q in %s", name, ref)
+	}
+
+	secret, err := provider.Lookup(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up %s: %w", ref, err)
+	}
+	return secret, nil
+}
+
+// fileProvider reads the file at the absolute path of the reference
+type fileProvider struct{}
+
+func (fileProvider) Lookup(ctx context.Context, path string) (string, error) {
+	file := "/" + path
+	if filepath.VolumeName(path) != "" {
+		file = path // secret://file/C:/secrets/db on Windows
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Command returns a provider running args and using what it prints as the
+// secret. {path} in args is replaced by the path of the reference; without
+// it, the path is passed as the last argument.
+func Command(args []string, timeout time.Duration) Provider {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return commandProvider{args: args, timeout: timeout}
+}
+
+type commandProvider struct {
+	args    []string
+	timeout time.Duration
+}
+
+func (c commandProvider) Lookup(ctx context.Context, path string) (string, error) {
+	if len(c.args) == 0 {
+		return "", fmt.Errorf("no command configured")
+	}
+	args := make([]string, 0, len(c.args)+1)
+	substituted := false
+	for _, arg := range c.args {
+		if strings.Contains(arg, "{path}") {
+			arg = strings.ReplaceAll(arg, "{path}", path)
+			substituted = true
+		}
+		args = append(args, arg)
+	}
+	if !substituted {
+		args = append(args, path)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "db_password")
+	if err := os.WriteFile(file, []byte("hunter2\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret: %v", err)
+	}
+
+	r := NewResolver()
+	ctx := context.Background()
+
+	secret, err := r.Resolve(ctx, Scheme+File+"/"+strings.TrimPrefix(filepath.ToSlash(file), "/"))
+	if err != nil || secret != "hunter2" {
+		t.Errorf("Expected the file's secret without its newline, got %q (%v)", secret, err)
+	}
+
+	if runtime.GOOS != "windows" {
+		r.Register("echo", Command([]string{"echo", "value-of-{path}"}, 0))
+		if secret, err := r.Resolve(ctx, "secret://echo/prod/api-key"); err != nil || secret != "value-of-prod/api-key" {
+			t.Errorf("Expected the command's output, got %q (%v)", secret, err)
+		}
+		r.Register("fails", Command([]string{"sh", "-c", "echo denied >&2; exit 3", "sh"}, 0))
+		if _, err := r.Resolve(ctx, "secret://fails/x"); err == nil || !strings.Contains(err.Error(), "denied") {
+			t.Errorf("Expected the command's error output, got %v", err)
+		}
+	}
+
+	for _, ref := range []string{"secret://vault/db", "secret://file", "secret:///path", "file:///etc/passwd"} {
+		if _, err := r.Resolve(ctx, ref); err == nil {
+			t.Errorf("%s: expected an error", ref)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/gleicon/guvnor/internal/api"
+)
+
+// Listener is an address the server or one of its apps listens on
+type Listener struct {
+	Name    string `json:"name"`    // What listens, e.g. "HTTP proxy" or "app web"
+	Network string `json:"network"` // tcp or udp
+	Address string `json:"address"` // host:port, without a host for all interfaces
+}
+
+// Listeners returns the addresses the server and its apps listen on once started
+func (s *Server) Listeners() ([]Listener, error) {
+	apps, err := s.Apps()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := s.config
+	listeners := []Listener{{"HTTP proxy", "tcp", ":" + strconv.Itoa(cfg.Server.HTTPPort)}}
+	if cfg.TLS.Enabled {
+		listeners = append(listeners, Listener{"HTTPS proxy", "tcp", ":" + strconv.Itoa(cfg.Server.HTTPSPort)})
+	}
+	listeners = append(listeners, Listener{"management API", "tcp", fmt.Sprintf("127.0.0.1:%d", api.GetManagementPort(cfg.Server.HTTPPort))})
+	if cfg.Server.APIRemote.Enabled() {
+		listeners = append(listeners, Listener{"remote management API", "tcp", cfg.Server.APIRemote.Listen})
+	}
+	if cfg.TLS.ACMEDNS.Enabled {
+		listeners = append(listeners,
+			Listener{"ACME DNS server", "udp", cfg.TLS.ACMEDNS.Listen},
+			Listener{"ACME DNS server", "tcp", cfg.TLS.ACMEDNS.Listen})
+	}
+	for _, app := range apps {
+		if app.Port > 0 {
+			listeners = append(listeners, Listener{"app " + app.Name, "tcp", ":" + strconv.Itoa(app.Port)})
+		}
+	}
+	return listeners, nil
+}
+
+// Overlaps reports whether two listeners cannot both listen: the same port
+// and network, on the same host or one of them on all interfaces
+func (l Listener) Overlaps(other Listener) bool {
+	if l.Network != other.Network {
+		return false
+	}
+	host, port, err := net.SplitHostPort(l.Address)
+	if err != nil {
+		return false
+	}
+	otherHost, otherPort, err := net.SplitHostPort(other.Address)
+	if err != nil || port != otherPort {
+		return false
+	}
+	return host == otherHost || anyHost(host) || anyHost(otherHost)
+}
+
+func anyHost(host string) bool {
+	return host == "" || host == "0.0.0.0" || host == "::"
+}
+
+// Check listens on the address and closes it again, reporting why the
+// listener could not be opened
+func (l Listener) Check() error {
+	if l.Network == "udp" {
+		conn, err := net.ListenPacket(l.Network, l.Address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	listener, err := net.Listen(l.Network, l.Address)
+	if err != nil {
+		return err
+	}
+	return listener.Close()
+}
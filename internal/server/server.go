@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 
 	"github.com/sirupsen/logrus"
 
@@ -19,6 +20,8 @@ type Server struct {
 	procfile    *procfile.Procfile
 	proxyServer *proxy.Server
 	logger      *logrus.Logger
+	only        []string // Apps started with the server; all when empty
+	prepared    bool     // The Procfile has been converted to apps
 }
 
 // New creates a new Guv'nor server from configuration and procfile
@@ -30,15 +33,18 @@ func New(cfg *config.Config, pf *procfile.Procfile, logger *logrus.Logger) *Serv
 	}
 }
 
+// OnlyApps limits the apps started with the server to the named ones. The
+// others stay configured and can be started later through the management API.
+func (s *Server) OnlyApps(names ...string) {
+	s.only = names
+}
+
 // Start starts the server and all processes from the Procfile
 func (s *Server) Start(ctx context.Context) error {
 	s.logger.Info("Starting Guv'nor server")
 
-	// Convert Procfile processes to config apps if config doesn't have apps defined
-	if len(s.config.Apps) == 0 {
-		if err := s.convertProcfileToConfig(); err != nil {
-			return fmt.Errorf("failed to convert Procfile to config: %w", err)
-		}
+	if err := s.prepare(); err != nil {
+		return err
 	}
 
 	// Create and start proxy server
@@ -48,6 +54,10 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	s.proxyServer = proxyServer
+	s.proxyServer.SetConfigLoader(s.loadConfig)
+	if len(s.only) > 0 {
+		s.proxyServer.OnlyApps(s.only...)
+	}
 
 	// Start the proxy server (which will start all processes)
 	if err := s.proxyServer.Start(ctx); err != nil {
@@ -57,6 +67,52 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// Apps returns the apps the server runs, from the config file or converted
+// from the Procfile, without starting anything
+func (s *Server) Apps() ([]config.AppConfig, error) {
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	if len(s.only) == 0 {
+		return s.config.Apps, nil
+	}
+	var apps []config.AppConfig
+	for _, app := range s.config.Apps {
+		if slices.Contains(s.only, app.Name) {
+			apps = append(apps, app)
+		}
+	}
+	return apps, nil
+}
+
+// prepare converts Procfile processes to config apps if the config file
+// defines none; apps registered as drop-ins run besides them
+func (s *Server) prepare() error {
+	if !s.prepared && s.config.FileApps() == 0 {
+		if err := s.convertProcfileToConfig(s.config, s.procfile); err != nil {
+			return fmt.Errorf("failed to convert Procfile to config: %w", err)
+		}
+	}
+	s.prepared = true
+
+	for _, name := range s.only {
+		if !s.hasApp(name) {
+			return fmt.Errorf("app %s not found in configuration", name)
+		}
+	}
+	return nil
+}
+
+// hasApp reports whether an app is configured
+func (s *Server) hasApp(name string) bool {
+	for _, app := range s.config.Apps {
+		if app.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Stop stops the server and all processes
 func (s *Server) Stop(ctx context.Context) error {
 	s.logger.Info("Stopping Guv'nor server")
@@ -68,22 +124,47 @@ func (s *Server) Stop(ctx context.Context) error {
 	return nil
 }
 
+// loadConfig reads the configuration file and the Procfile again, as they
+// were read when the server started
+func (s *Server) loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(s.config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.FileApps() > 0 {
+		return cfg, nil
+	}
+
+	procfilePath, err := procfile.FindProcfile(".")
+	if err != nil {
+		return nil, err
+	}
+	pf, err := procfile.ParseProcfile(procfilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Procfile: %w", err)
+	}
+	if err := s.convertProcfileToConfig(cfg, pf); err != nil {
+		return nil, fmt.Errorf("failed to convert Procfile to config: %w", err)
+	}
+	return cfg, nil
+}
+
 // convertProcfileToConfig converts Procfile processes to config.AppConfig entries
-func (s *Server) convertProcfileToConfig() error {
+func (s *Server) convertProcfileToConfig(cfg *config.Config, pf *procfile.Procfile) error {
 	s.logger.Info("Converting Procfile processes to configuration")
 
-	for _, process := range s.procfile.Processes {
+	for _, process := range pf.Processes {
 		// Use the process command substitution from Procfile
-		command := s.procfile.SubstituteCommand(&process)
+		command := pf.SubstituteCommand(&process)
 		
-		// Parse command into command and args
-		cmdParts, err := parseCommand(command)
+		// Parse command into command and args, or run it through the shell
+		executable, args, shell, err := procfile.AppCommand(command)
 		if err != nil {
 			s.logger.WithError(err).WithField("process", process.Name).Warn("Failed to parse process command")
 			continue
 		}
 
-		if len(cmdParts) == 0 {
+		if executable == "" {
 			s.logger.WithField("process", process.Name).Warn("Empty command after parsing")
 			continue
 		}
@@ -91,12 +172,13 @@ func (s *Server) convertProcfileToConfig() error {
 		// Create app config from process
 		appConfig := config.AppConfig{
 			Name:       process.Name,
-			Domain:     generateDomainForProcess(process.Name, s.config.Server.HTTPPort),
+			Domain:     generateDomainForProcess(process.Name, cfg.Server.HTTPPort),
 			Port:       process.Port,
-			Command:    cmdParts[0],
-			Args:       cmdParts[1:],
+			Command:    executable,
+			Args:       args,
+			Shell:      shell,
 			WorkingDir: getCurrentWorkingDir(),
-			Environment: mergeEnvironments(s.procfile.GetProcessEnvironment(&process), process.Env),
+			Environment: mergeEnvironments(process.Env),
 			HealthCheck: config.HealthCheckConfig{
 				Enabled:  needsHealthCheck(process.Name),
 				Path:     "/health",
@@ -111,56 +193,24 @@ func (s *Server) convertProcfileToConfig() error {
 			},
 		}
 
-		s.config.Apps = append(s.config.Apps, appConfig)
+		cfg.Apps = append(cfg.Apps, appConfig)
 		
 		s.logger.WithFields(logrus.Fields{
 			"process": process.Name,
 			"command": appConfig.Command,
 			"args":    appConfig.Args,
+			"shell":   appConfig.Shell,
 			"port":    appConfig.Port,
 			"domain":  appConfig.Domain,
 		}).Info("Added process to configuration")
 	}
 
-	s.logger.WithField("total_apps", len(s.config.Apps)).Info("Procfile conversion complete")
+	s.logger.WithField("total_apps", len(cfg.Apps)).Info("Procfile conversion complete")
 	return nil
 }
 
 // Helper functions
 
-func parseCommand(command string) ([]string, error) {
-	// Simple shell-style parsing - split on spaces but respect quotes
-	// This is a simplified version - for production you might want a proper shell parser
-	var parts []string
-	var current string
-	inQuotes := false
-	
-	for i, char := range command {
-		switch char {
-		case '"':
-			inQuotes = !inQuotes
-		case ' ':
-			if inQuotes {
-				current += string(char)
-			} else {
-				if current != "" {
-					parts = append(parts, current)
-					current = ""
-				}
-			}
-		default:
-			current += string(char)
-		}
-		
-		// Add the last part if we're at the end
-		if i == len(command)-1 && current != "" {
-			parts = append(parts, current)
-		}
-	}
-	
-	return parts, nil
-}
-
 func generateDomainForProcess(processName string, httpPort int) string {
 	// For local development, use localhost with process name
 	if httpPort != 80 && httpPort != 443 {
@@ -176,7 +226,7 @@ func getCurrentWorkingDir() string {
 	return "."
 }
 
-func mergeEnvironments(procfileEnv []string, processEnv map[string]string) map[string]string {
+func mergeEnvironments(processEnv map[string]string) map[string]string {
 	env := make(map[string]string)
 	
 	// Add process-specific environment variables
@@ -184,9 +234,8 @@ func mergeEnvironments(procfileEnv []string, processEnv map[string]string) map[s
 		env[k] = v
 	}
 	
-	// Note: procfileEnv is already merged with system environment
-	// We could parse it here if needed, but the process manager
-	// will use the full environment from GetProcessEnvironment()
+	// The process manager applies the .env files of the working directory
+	// over the system environment at every start
 	
 	return env
 }
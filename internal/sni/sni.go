@@ -0,0 +1,50 @@
+// Package sni reads the server name a TLS connection asks for before anything
+// handles it, so the connection can be routed by hostname and then replayed.
+package sni
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// errHelloRead aborts the handshake once the ClientHello has been captured
+var errHelloRead = errors.New("client hello read")
+
+// ReadClientHello reads a TLS ClientHello from conn and returns its SNI together
+// with every byte consumed, so the connection can be replayed to its real handler
+func ReadClientHello(conn net.Conn) (string, []byte, error) {
+	var peeked bytes.Buffer
+	var serverName string
+	var gotHello bool
+
+	err := tls.Server(&readOnlyConn{reader: io.TeeReader(conn, &peeked)}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName = hello.ServerName
+			gotHello = true
+			return nil, errHelloRead
+		},
+	}).Handshake()
+
+	if !gotHello {
+		return "", peeked.Bytes(), err
+	}
+	return serverName, peeked.Bytes(), nil
+}
+
+// readOnlyConn feeds recorded bytes to the TLS stack and discards its replies
+type readOnlyConn struct {
+	reader io.Reader
+}
+
+func (c *readOnlyConn) Read(p []byte) (int, error)         { return c.reader.Read(p) }
+func (c *readOnlyConn) Write(p []byte) (int, error)        { return 0, io.ErrClosedPipe }
+func (c *readOnlyConn) Close() error                       { return nil }
+func (c *readOnlyConn) LocalAddr() net.Addr                { return nil }
+func (c *readOnlyConn) RemoteAddr() net.Addr               { return nil }
+func (c *readOnlyConn) SetDeadline(t time.Time) error      { return nil }
+func (c *readOnlyConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *readOnlyConn) SetWriteDeadline(t time.Time) error { return nil }
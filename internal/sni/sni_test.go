@@ -0,0 +1,23 @@
+package sni
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+func TestReadClientHello(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go tls.Client(clientConn, &tls.Config{ServerName: "raw.example.com"}).Handshake()
+
+	serverName, peeked, err := ReadClientHello(serverConn)
+	if err != nil {
+		t.Fatalf("Failed to read ClientHello: %v", err)
+	}
+	if serverName != "raw.example.com" || len(peeked) == 0 {
+		t.Errorf("Unexpected SNI %q (%d bytes peeked)", serverName, len(peeked))
+	}
+}
@@ -0,0 +1,83 @@
+// Package systemd integrates guvnor with systemd: readiness and watchdog
+// notifications for a server run as a Type=notify service, and the unit
+// files that run it.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states understood by systemd
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notifier sends state notifications to the service manager that started
+// guvnor
+type Notifier struct {
+	socket   string
+	watchdog time.Duration
+}
+
+// FromEnv returns a notifier for the service manager in NOTIFY_SOCKET, or nil
+// when guvnor was not started by one. It unsets the notification variables,
+// so the apps guvnor starts do not notify systemd in its place.
+func FromEnv() *Notifier {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	usec := os.Getenv("WATCHDOG_USEC")
+	watchdogPID := os.Getenv("WATCHDOG_PID")
+	for _, name := range []string{"NOTIFY_SOCKET", "WATCHDOG_USEC", "WATCHDOG_PID"} {
+		os.Unsetenv(name)
+	}
+	if socket == "" {
+		return nil
+	}
+
+	n := &Notifier{socket: socket}
+	// The watchdog is meant for this process only when WATCHDOG_PID names it
+	if watchdogPID == "" || watchdogPID == strconv.Itoa(os.Getpid()) {
+		if value, err := strconv.ParseInt(usec, 10, 64); err == nil && value > 0 {
+			n.watchdog = time.Duration(value) * time.Microsecond
+		}
+	}
+	return n
+}
+
+// Notify sends states, e.g. Ready and "STATUS=...", in one message. A nil
+// notifier sends nothing.
+func (n *Notifier) Notify(states ...string) error {
+	if n == nil {
+		return nil
+	}
+	// A leading @ is a socket in the abstract namespace
+	name := n.socket
+	if strings.HasPrefix(name, "@") {
+		name = "\x00" + name[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager at %s: %w", n.socket, err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return fmt.Errorf("failed to notify the service manager: %w", err)
+	}
+	return nil
+}
+
+// WatchdogInterval returns the watchdog timeout of the service, zero when it
+// has none. Watchdog notifications are due within it; sending them at half
+// the interval leaves room for delays.
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if n == nil {
+		return 0
+	}
+	return n.watchdog
+}
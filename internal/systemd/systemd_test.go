@@ -0,0 +1,102 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	n := FromEnv()
+	if n == nil {
+		t.Fatal("Expected a notifier with NOTIFY_SOCKET set")
+	}
+	if _, set := os.LookupEnv("NOTIFY_SOCKET"); set {
+		t.Error("Expected NOTIFY_SOCKET to be unset for the apps")
+	}
+	if got := n.WatchdogInterval(); got != 30*time.Second {
+		t.Errorf("Expected a 30s watchdog, got %s", got)
+	}
+
+	if err := n.Notify(Ready, "STATUS=Serving 2 apps"); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	buf := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	size, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := string(buf[:size]); got != "READY=1\nSTATUS=Serving 2 apps" {
+		t.Errorf("Unexpected notification %q", got)
+	}
+
+	// The watchdog of another process, and no service manager at all
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	t.Setenv("WATCHDOG_PID", "1")
+	if got := FromEnv().WatchdogInterval(); got != 0 {
+		t.Errorf("Expected no watchdog for another PID, got %s", got)
+	}
+	var none *Notifier
+	if none.Notify(Ready) != nil || none.WatchdogInterval() != 0 {
+		t.Error("Expected a nil notifier to do nothing")
+	}
+}
+
+func TestServerUnit(t *testing.T) {
+	opts := UnitOptions{
+		Name:         "guvnor",
+		Executable:   "/usr/local/bin/guvnor",
+		WorkingDir:   "/srv/my app",
+		ConfigPath:   "/srv/my app/guvnor.yaml",
+		User:         "deploy",
+		BindLowPorts: true,
+		Watchdog:     DefaultWatchdog,
+	}
+	unit, err := ServerUnit(opts)
+	if err != nil {
+		t.Fatalf("ServerUnit failed: %v", err)
+	}
+	for _, line := range []string{
+		"Type=notify",
+		"WorkingDirectory=/srv/my app",
+		`ExecStart=/usr/local/bin/guvnor --config "/srv/my app/guvnor.yaml" start`,
+		"WatchdogSec=30s",
+		"User=deploy",
+		"AmbientCapabilities=CAP_NET_BIND_SERVICE",
+		"WantedBy=multi-user.target",
+	} {
+		if !strings.Contains(unit, line+"\n") {
+			t.Errorf("Expected %q in the unit:\n%s", line, unit)
+		}
+	}
+
+	app, err := AppUnit(opts)
+	if err != nil {
+		t.Fatalf("AppUnit failed: %v", err)
+	}
+	if !strings.Contains(app, `ExecStart=/usr/local/bin/guvnor --config "/srv/my app/guvnor.yaml" start %i`+"\n") ||
+		!strings.Contains(app, "PartOf=guvnor.service\n") || opts.AppUnitName() != "guvnor-app@.service" {
+		t.Errorf("Unexpected app unit:\n%s", app)
+	}
+
+	opts.UserUnit = true
+	if _, err := ServerUnit(opts); err == nil {
+		t.Error("Expected an error for User= in a user unit")
+	}
+}
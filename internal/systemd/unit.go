@@ -0,0 +1,143 @@
+package systemd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultWatchdog is the WatchdogSec of generated units
+const DefaultWatchdog = 30 * time.Second
+
+// UnitOptions describes the service running a guvnor server
+type UnitOptions struct {
+	Name         string        // Unit name without .service, e.g. guvnor
+	Executable   string        // Absolute path of the guvnor binary
+	WorkingDir   string        // Project directory
+	ConfigPath   string        // Absolute config path, empty for guvnor.yaml in WorkingDir
+	User         string        // Account a system unit runs as, empty for root
+	UserUnit     bool          // A unit of the user's service manager (systemctl --user)
+	BindLowPorts bool          // Let a non-root User bind ports below 1024
+	Watchdog     time.Duration // WatchdogSec, zero disables the watchdog
+}
+
+// ServerUnitName is the file name of the server unit
+func (o UnitOptions) ServerUnitName() string {
+	return o.Name + ".service"
+}
+
+// AppUnitName is the file name of the app template unit; an instance such as
+// guvnor-app@web.service controls the app web on the server
+func (o UnitOptions) AppUnitName() string {
+	return o.Name + "-app@.service"
+}
+
+// unitFuncs are available in the unit templates
+var unitFuncs = template.FuncMap{"path": escapeSpecifiers}
+
+var serverUnit = template.Must(template.New("server").Funcs(unitFuncs).Parse(`# Generated by guvnor systemd install
+[Unit]
+Description=Guv'nor process manager for {{.WorkingDir | path}}
+Documentation=https://github.com/gleicon/guvnor
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+WorkingDirectory={{.WorkingDir | path}}
+ExecStart={{.Command "start"}}
+ExecReload={{.Command "reload"}}
+# guvnor stops its apps on SIGTERM; what is left at the timeout is killed
+KillMode=mixed
+TimeoutStopSec=90
+Restart=on-failure
+RestartSec=5
+{{- if .Watchdog}}
+WatchdogSec={{.Watchdog}}
+{{- end}}
+{{- if .User}}
+User={{.User}}
+{{- if .BindLowPorts}}
+AmbientCapabilities=CAP_NET_BIND_SERVICE
+{{- end}}
+{{- end}}
+
+[Install]
+WantedBy={{if .UserUnit}}default.target{{else}}multi-user.target{{end}}
+`))
+
+var appUnit = template.Must(template.New("app").Funcs(unitFuncs).Parse(`# Generated by guvnor systemd install
+[Unit]
+Description=Guv'nor app %i for {{.WorkingDir | path}}
+Requires={{.ServerUnitName}}
+After={{.ServerUnitName}}
+PartOf={{.ServerUnitName}}
+
+[Service]
+# The app runs under the server; this unit starts and stops it there
+Type=oneshot
+RemainAfterExit=yes
+WorkingDirectory={{.WorkingDir | path}}
+ExecStart={{.Command "start" "%i"}}
+ExecStop={{.Command "stop" "%i"}}
+ExecReload={{.Command "restart" "%i"}}
+{{- if .User}}
+User={{.User}}
+{{- end}}
+
+[Install]
+WantedBy={{.ServerUnitName}}
+`))
+
+// Command returns the command line running guvnor with args for the unit;
+// args may use specifiers such as %i
+func (o UnitOptions) Command(args ...string) string {
+	words := []string{quote(escapeSpecifiers(o.Executable))}
+	if o.ConfigPath != "" {
+		words = append(words, "--config", quote(escapeSpecifiers(o.ConfigPath)))
+	}
+	for _, arg := range args {
+		words = append(words, quote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// ServerUnit returns the unit file running the guvnor server
+func ServerUnit(o UnitOptions) (string, error) {
+	return render(serverUnit, o)
+}
+
+// AppUnit returns the template unit controlling the apps of the server
+func AppUnit(o UnitOptions) (string, error) {
+	return render(appUnit, o)
+}
+
+func render(t *template.Template, o UnitOptions) (string, error) {
+	if o.Name == "" || o.Executable == "" || o.WorkingDir == "" {
+		return "", fmt.Errorf("unit needs a name, the guvnor binary and the project directory")
+	}
+	if o.UserUnit && o.User != "" {
+		return "", fmt.Errorf("user units run as their user, User= cannot be set")
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, o); err != nil {
+		return "", fmt.Errorf("failed to render %s unit: %w", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// escapeSpecifiers escapes the % of a path, which would start a specifier
+func escapeSpecifiers(path string) string {
+	return strings.ReplaceAll(path, "%", "%%")
+}
+
+// quote quotes a word of a unit command line when it needs it
+func quote(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t\"'\\") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
@@ -0,0 +1,439 @@
+package tlsaudit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+const (
+	// DefaultResolver is the public DNS server hostnames are resolved through
+	DefaultResolver = "1.1.1.1:53"
+
+	// PreloadMaxAge is the smallest HSTS max-age accepted for preload submission (one year)
+	PreloadMaxAge = 365 * 24 * time.Hour
+
+	// expiryWarning is how close to expiry a certificate is reported
+	expiryWarning = 14 * 24 * time.Hour
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn" // Works, but blocks preload submission or needs attention soon
+	StatusFail Status = "fail"
+)
+
+// Check is one verified property of a hostname
+type Check struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Report is the audit result of one hostname
+type Report struct {
+	Host      string    `json:"host"`
+	Addresses []string  `json:"addresses,omitempty"`
+	Checks    []Check   `json:"checks"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Failed reports whether any check failed
+func (r Report) Failed() bool {
+	return r.count(StatusFail) > 0
+}
+
+// PreloadReady reports whether every check passed, which is what preload submission requires
+func (r Report) PreloadReady() bool {
+	return len(r.Checks) > 0 && r.count(StatusPass) == len(r.Checks)
+}
+
+// Problems lists the checks that did not pass
+func (r Report) Problems() []Check {
+	var problems []Check
+	for _, check := range r.Checks {
+		if check.Status != StatusPass {
+			problems = append(problems, check)
+		}
+	}
+	return problems
+}
+
+func (r Report) count(status Status) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Auditor checks hostnames from the outside: names are resolved through public
+// DNS and requests go to the addresses found there, like a visitor's would
+type Auditor struct {
+	Resolver string        // DNS server, host:port (default: DefaultResolver)
+	Timeout  time.Duration // Per request (default: 10s)
+
+	// Overridable in tests
+	lookup    func(ctx context.Context, host string) ([]string, error)
+	roots     *x509.CertPool
+	httpPort  int
+	httpsPort int
+}
+
+// Audit runs every check against host
+func (a *Auditor) Audit(ctx context.Context, host string) Report {
+	report := Report{Host: host, CheckedAt: time.Now()}
+
+	addrs, err := a.resolve(ctx, host)
+	if err != nil {
+		report.Checks = append(report.Checks, Check{Name: "dns", Status: StatusFail, Detail: err.Error()})
+		return report
+	}
+	report.Addresses = addrs
+	report.Checks = append(report.Checks, Check{Name: "dns", Status: StatusPass, Detail: strings.Join(addrs, ", ")})
+
+	report.Checks = append(report.Checks,
+		a.checkCertificate(ctx, host, addrs),
+		a.checkProtocols(ctx, host, addrs),
+		a.checkRedirect(ctx, host, addrs),
+		a.checkHSTS(ctx, host, addrs),
+	)
+	return report
+}
+
+// AuditAll audits hosts one after another
+func (a *Auditor) AuditAll(ctx context.Context, hosts []string) []Report {
+	reports := make([]Report, 0, len(hosts))
+	for _, host := range hosts {
+		reports = append(reports, a.Audit(ctx, host))
+	}
+	return reports
+}
+
+// Hostnames returns the public hostnames served over TLS by cfg. Local names,
+// wildcards and IP addresses cannot be audited from the outside and are left out.
+func Hostnames(cfg *config.Config) []string {
+	if !cfg.TLS.Enabled {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, app := range cfg.Apps {
+		host := strings.ToLower(app.Hostname)
+		if host == "" {
+			host = strings.ToLower(app.Domain)
+		}
+		if host == "" || seen[host] || !public(host) {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// public reports whether host can be looked up in public DNS
+func public(host string) bool {
+	if net.ParseIP(host) != nil || strings.HasPrefix(host, "*.") || !strings.Contains(host, ".") {
+		return false
+	}
+	for _, suffix := range []string{".localhost", ".local", ".internal", ".test", ".example", ".invalid"} {
+		if strings.HasSuffix(host, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkCertificate verifies the chain against the system roots and the hostname
+func (a *Auditor) checkCertificate(ctx context.Context, host string, addrs []string) Check {
+	check := Check{Name: "certificate"}
+
+	state, err := a.handshake(ctx, host, addrs, &tls.Config{RootCAs: a.roots})
+	if err != nil {
+		check.Status = StatusFail
+		check.Detail = err.Error()
+		return check
+	}
+
+	leaf := state.PeerCertificates[0]
+	remaining := time.Until(leaf.NotAfter)
+	check.Status = StatusPass
+	check.Detail = fmt.Sprintf("issued by %s, %d certificates in chain, expires %s (%d days)",
+		issuer(leaf), len(state.PeerCertificates), leaf.NotAfter.Format("2006-01-02"), int(remaining.Hours()/24))
+	if remaining < expiryWarning {
+		check.Status = StatusWarn
+	}
+	return check
+}
+
+// checkProtocols requires TLS 1.2 or later and reports legacy versions still accepted
+func (a *Auditor) checkProtocols(ctx context.Context, host string, addrs []string) Check {
+	check := Check{Name: "protocols"}
+
+	versions := []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+	var accepted, legacy []string
+	for _, version := range versions {
+		cfg := &tls.Config{
+			MinVersion: version,
+			MaxVersion: version,
+			// Only the protocol is probed here, the chain is verified separately
+			InsecureSkipVerify: true,
+		}
+		if _, err := a.handshake(ctx, host, addrs, cfg); err != nil {
+			continue
+		}
+		accepted = append(accepted, tls.VersionName(version))
+		if version < tls.VersionTLS12 {
+			legacy = append(legacy, tls.VersionName(version))
+		}
+	}
+
+	switch {
+	case len(accepted) == 0:
+		check.Status = StatusFail
+		check.Detail = "no TLS version accepted"
+	case len(accepted) == len(legacy):
+		check.Status = StatusFail
+		check.Detail = fmt.Sprintf("only legacy versions accepted: %s", strings.Join(legacy, ", "))
+	case len(legacy) > 0:
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("accepts %s; disable %s", strings.Join(accepted, ", "), strings.Join(legacy, ", "))
+	default:
+		check.Status = StatusPass
+		check.Detail = "accepts " + strings.Join(accepted, ", ")
+	}
+	return check
+}
+
+// checkRedirect requires plain HTTP to redirect to HTTPS on the same host first,
+// so the HSTS header is seen before moving to another name
+func (a *Auditor) checkRedirect(ctx context.Context, host string, addrs []string) Check {
+	check := Check{Name: "redirect"}
+
+	resp, err := a.get(ctx, "http", host, addrs)
+	if err != nil {
+		check.Status = StatusFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp.Body.Close()
+
+	location, _ := url.Parse(resp.Header.Get("Location"))
+	switch {
+	case resp.StatusCode < 300 || resp.StatusCode > 399:
+		check.Status = StatusFail
+		check.Detail = fmt.Sprintf("http://%s/ answered %d instead of redirecting to HTTPS", host, resp.StatusCode)
+	case location == nil || location.Scheme != "https":
+		check.Status = StatusFail
+		check.Detail = fmt.Sprintf("http://%s/ redirects to %q, not HTTPS", host, resp.Header.Get("Location"))
+	case !strings.EqualFold(location.Hostname(), host):
+		check.Status = StatusFail
+		check.Detail = fmt.Sprintf("http://%s/ redirects to another host (%s); redirect to https://%s/ first", host, location.Host, host)
+	default:
+		check.Status = StatusPass
+		check.Detail = fmt.Sprintf("%d to %s", resp.StatusCode, location)
+	}
+	return check
+}
+
+// checkHSTS requires the header on the HTTPS root and reports what preload still needs
+func (a *Auditor) checkHSTS(ctx context.Context, host string, addrs []string) Check {
+	check := Check{Name: "hsts"}
+
+	resp, err := a.get(ctx, "https", host, addrs)
+	if err != nil {
+		check.Status = StatusFail
+		check.Detail = err.Error()
+		return check
+	}
+	resp.Body.Close()
+
+	header := resp.Header.Get("Strict-Transport-Security")
+	if header == "" {
+		check.Status = StatusFail
+		check.Detail = "no Strict-Transport-Security header on https://" + host + "/"
+		return check
+	}
+
+	policy := ParseHSTS(header)
+	var missing []string
+	if policy.MaxAge < PreloadMaxAge {
+		missing = append(missing, fmt.Sprintf("max-age of at least %d", int(PreloadMaxAge.Seconds())))
+	}
+	if !policy.IncludeSubDomains {
+		missing = append(missing, "includeSubDomains")
+	}
+	if !policy.Preload {
+		missing = append(missing, "preload")
+	}
+
+	check.Detail = header
+	check.Status = StatusPass
+	if len(missing) > 0 {
+		check.Status = StatusWarn
+		check.Detail = fmt.Sprintf("%s; preload needs %s", header, strings.Join(missing, ", "))
+	}
+	return check
+}
+
+// HSTSPolicy is a parsed Strict-Transport-Security header
+type HSTSPolicy struct {
+	MaxAge            time.Duration
+	IncludeSubDomains bool
+	Preload           bool
+}
+
+// ParseHSTS parses a Strict-Transport-Security header value
+func ParseHSTS(header string) HSTSPolicy {
+	var policy HSTSPolicy
+	for _, directive := range strings.Split(header, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "max-age":
+			if seconds, err := strconv.ParseInt(strings.Trim(strings.TrimSpace(value), `"`), 10, 64); err == nil {
+				policy.MaxAge = time.Duration(seconds) * time.Second
+			}
+		case "includesubdomains":
+			policy.IncludeSubDomains = true
+		case "preload":
+			policy.Preload = true
+		}
+	}
+	return policy
+}
+
+// resolve looks host up through the public resolver
+func (a *Auditor) resolve(ctx context.Context, host string) ([]string, error) {
+	if a.lookup != nil {
+		return a.lookup(ctx, host)
+	}
+
+	server := a.Resolver
+	if server == "" {
+		server = DefaultResolver
+	}
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.timeout())
+	defer cancel()
+	addrs, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s through %s: %w", host, server, err)
+	}
+	return addrs, nil
+}
+
+// dial connects to the first reachable address of the host
+func (a *Auditor) dial(ctx context.Context, addrs []string, port int) (net.Conn, error) {
+	d := net.Dialer{Timeout: a.timeout()}
+	var errs []error
+	for _, addr := range addrs {
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// handshake performs a TLS handshake with host at one of its addresses
+func (a *Auditor) handshake(ctx context.Context, host string, addrs []string, cfg *tls.Config) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout())
+	defer cancel()
+
+	conn, err := a.dial(ctx, addrs, a.port("https"))
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+
+	cfg.ServerName = host
+	client := tls.Client(conn, cfg)
+	if err := client.HandshakeContext(ctx); err != nil {
+		return tls.ConnectionState{}, err
+	}
+	return client.ConnectionState(), nil
+}
+
+// get requests the root of host without following redirects
+func (a *Auditor) get(ctx context.Context, scheme, host string, addrs []string) (*http.Response, error) {
+	port := a.port(scheme)
+	client := &http.Client{
+		Timeout: a.timeout(),
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return a.dial(ctx, addrs, port)
+			},
+			TLSClientConfig:   &tls.Config{RootCAs: a.roots},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, scheme+"://"+host+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "guvnor-tls-audit")
+	return client.Do(req)
+}
+
+func (a *Auditor) port(scheme string) int {
+	if scheme == "http" {
+		if a.httpPort != 0 {
+			return a.httpPort
+		}
+		return 80
+	}
+	if a.httpsPort != 0 {
+		return a.httpsPort
+	}
+	return 443
+}
+
+func (a *Auditor) timeout() time.Duration {
+	if a.Timeout > 0 {
+		return a.Timeout
+	}
+	return 10 * time.Second
+}
+
+// issuer names the certificate's issuer by organization, falling back to its common name
+func issuer(cert *x509.Certificate) string {
+	if len(cert.Issuer.Organization) > 0 {
+		name := cert.Issuer.Organization[0]
+		if cert.Issuer.CommonName != "" {
+			name += " " + cert.Issuer.CommonName
+		}
+		return name
+	}
+	return cert.Issuer.CommonName
+}
@@ -0,0 +1,115 @@
+package tlsaudit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gleicon/guvnor/internal/config"
+)
+
+// testAuditor points an auditor at local servers; httptest certificates are valid for example.com
+func testAuditor(t *testing.T, tlsServer, plainServer *httptest.Server) *Auditor {
+	t.Helper()
+
+	port := func(s *httptest.Server) int {
+		_, p, _ := net.SplitHostPort(s.Listener.Addr().String())
+		n, _ := strconv.Atoi(p)
+		return n
+	}
+	roots := tlsServer.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	return &Auditor{
+		Timeout: 2 * time.Second,
+		lookup: func(ctx context.Context, host string) ([]string, error) {
+			return []string{"127.0.0.1"}, nil
+		},
+		roots:     roots,
+		httpPort:  port(plainServer),
+		httpsPort: port(tlsServer),
+	}
+}
+
+func TestAudit(t *testing.T) {
+	hsts := "max-age=63072000; includeSubDomains; preload"
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", hsts)
+	}))
+	defer secure.Close()
+
+	location := "https://example.com/"
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, location, http.StatusMovedPermanently)
+	}))
+	defer plain.Close()
+
+	auditor := testAuditor(t, secure, plain)
+
+	report := auditor.Audit(context.Background(), "example.com")
+	if !report.PreloadReady() {
+		t.Fatalf("Expected example.com to be preload ready, got %+v", report.Checks)
+	}
+
+	// Redirecting elsewhere first and a short max-age block preload
+	location = "https://www.example.com/"
+	hsts = "max-age=300"
+	report = auditor.Audit(context.Background(), "example.com")
+	if report.PreloadReady() || !report.Failed() {
+		t.Fatalf("Expected the audit to fail, got %+v", report.Checks)
+	}
+	statuses := make(map[string]Status)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	if statuses["redirect"] != StatusFail || statuses["hsts"] != StatusWarn || statuses["certificate"] != StatusPass {
+		t.Errorf("Unexpected check results: %+v", report.Checks)
+	}
+
+	// The certificate is not valid for other names
+	report = auditor.Audit(context.Background(), "other.org")
+	for _, check := range report.Checks {
+		if check.Name == "certificate" && check.Status != StatusFail {
+			t.Errorf("Expected a hostname mismatch to fail, got %+v", check)
+		}
+	}
+}
+
+func TestParseHSTS(t *testing.T) {
+	policy := ParseHSTS(`max-age="31536000"; includeSubDomains ;PRELOAD`)
+	if policy.MaxAge != PreloadMaxAge || !policy.IncludeSubDomains || !policy.Preload {
+		t.Errorf("Unexpected policy: %+v", policy)
+	}
+
+	if policy := ParseHSTS("max-age=abc"); policy.MaxAge != 0 || policy.Preload {
+		t.Errorf("Expected an empty policy, got %+v", policy)
+	}
+}
+
+func TestHostnames(t *testing.T) {
+	cfg := &config.Config{
+		TLS: config.TLSConfig{Enabled: true},
+		Apps: []config.AppConfig{
+			{Name: "web", Hostname: "Example.com"},
+			{Name: "api", Hostname: "api.example.com"},
+			{Name: "dup", Hostname: "example.com"},
+			{Name: "local", Hostname: "web.localhost"},
+			{Name: "wild", Hostname: "*.example.com"},
+			{Name: "ip", Hostname: "10.0.0.1"},
+			{Name: "bare", Hostname: "localhost"},
+		},
+	}
+
+	hosts := Hostnames(cfg)
+	if len(hosts) != 2 || hosts[0] != "api.example.com" || hosts[1] != "example.com" {
+		t.Errorf("Unexpected hostnames: %v", hosts)
+	}
+
+	cfg.TLS.Enabled = false
+	if hosts := Hostnames(cfg); len(hosts) != 0 {
+		t.Errorf("Expected no hostnames without TLS, got %v", hosts)
+	}
+}
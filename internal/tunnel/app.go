@@ -0,0 +1,142 @@
+package tunnel
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/sni"
+)
+
+// App connects the public connections of a tunnel to the guvnor proxy for one
+// app. guvnor serves all its apps on the same ports, so each HTTP request is
+// checked for the app's hostname before it is proxied, and each TLS connection
+// for its SNI: a tunnel exposes the app it was opened for and nothing else.
+type App struct {
+	Hostname  string // Public hostname of the app
+	HTTPAddr  string // guvnor's HTTP proxy
+	HTTPSAddr string // guvnor's HTTPS proxy; TLS connections are refused when empty
+	Logger    *logrus.Logger
+}
+
+// ServeHTTP proxies the requests of the HTTP connections accepted on l
+func (a *App) ServeHTTP(l net.Listener) error {
+	server := &http.Server{Handler: a.handler(), ReadHeaderTimeout: peekTimeout}
+	err := server.Serve(l)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// ServeTLS forwards the TLS connections accepted on l
+func (a *App) ServeTLS(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go a.forwardTLS(conn)
+	}
+}
+
+// handler proxies requests for the app's hostname to guvnor and answers the
+// others with 421, including those sent on a connection opened for the app
+func (a *App) handler() http.Handler {
+	hostname := normalizeHost(a.Hostname)
+	upstream := httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: a.HTTPAddr})
+	upstream.FlushInterval = -1 // Streams and server-sent events pass through as they come
+	upstream.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		a.Logger.WithError(err).Error("Failed to connect tunnel to the guvnor proxy")
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if normalizeHost(r.Host) != hostname {
+			a.Logger.WithField("hostname", r.Host).Warn("Refused request for another hostname through the tunnel")
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Misdirected Request", http.StatusMisdirectedRequest)
+			return
+		}
+		upstream.ServeHTTP(w, r)
+	})
+}
+
+// forwardTLS connects a TLS connection for the app's hostname to guvnor's
+// HTTPS proxy, which terminates it with the app's TLS config
+func (a *App) forwardTLS(conn net.Conn) {
+	if a.HTTPSAddr == "" {
+		a.Logger.Warn("HTTPS connection through the tunnel, but TLS is not enabled in guvnor")
+		conn.Close()
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(peekTimeout))
+	serverName, peeked, err := sni.ReadClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || normalizeHost(serverName) != normalizeHost(a.Hostname) {
+		if err == nil {
+			a.Logger.WithField("hostname", serverName).Warn("Refused TLS connection for another hostname through the tunnel")
+		}
+		conn.Close()
+		return
+	}
+
+	local, err := net.DialTimeout("tcp", a.HTTPSAddr, 10*time.Second)
+	if err != nil {
+		a.Logger.WithError(err).Error("Failed to connect tunnel to the guvnor proxy")
+		conn.Close()
+		return
+	}
+	splice(&peekedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(peeked), conn)}, local)
+}
+
+// connListener hands connections the tunnel client received from the relay
+// to an http.Server, as if it had accepted them
+type connListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newConnListener() *connListener {
+	return &connListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+// push hands over conn, closing it when the listener is closed
+func (l *connListener) push(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.closed:
+		conn.Close()
+	}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
@@ -0,0 +1,186 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Client keeps idle connections to a relay for one hostname and connects
+// the public connections the relay routes over them to the local guvnor
+// proxy, passing on only requests for that hostname (see App)
+type Client struct {
+	Relay     string // host:port of the relay's tunnel port
+	Token     string // The relay's token
+	Hostname  string // Public hostname routed through the tunnel
+	HTTPAddr  string // guvnor's HTTP proxy
+	HTTPSAddr string // guvnor's HTTPS proxy; public HTTPS is not forwarded when empty
+	Pool      int    // Idle connections to keep open, DefaultPool when zero
+	Logger    *logrus.Logger
+
+	app  *App
+	http *connListener // Public HTTP connections, served by the app
+}
+
+// Run keeps the tunnel open until ctx is done. It returns an error wrapping
+// ErrRefused when the relay refuses the token or hostname, and reconnects on
+// any other failure.
+func (c *Client) Run(ctx context.Context) error {
+	// The first connection tells whether the relay accepts the tunnel at all
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return err
+	}
+	c.Logger.WithField("relay", c.Relay).WithField("hostname", c.Hostname).Info("Tunnel open")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c.app = &App{Hostname: c.Hostname, HTTPAddr: c.HTTPAddr, HTTPSAddr: c.HTTPSAddr, Logger: c.Logger}
+	c.http = newConnListener()
+	defer c.http.Close()
+	go c.app.ServeHTTP(c.http)
+
+	size := c.Pool
+	if size <= 0 {
+		size = DefaultPool
+	}
+	errc := make(chan error, size)
+	var wg sync.WaitGroup
+	for i := 0; i < size; i++ {
+		var first net.Conn
+		if i == 0 {
+			first = conn
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.worker(ctx, first, errc)
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-errc:
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// worker keeps one idle connection to the relay, opening the next as soon
+// as the relay hands it a public connection
+func (c *Client) worker(ctx context.Context, conn net.Conn, errc chan<- error) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		if conn == nil {
+			var err error
+			if conn, err = c.connect(ctx); err != nil {
+				if errors.Is(err, ErrRefused) {
+					errc <- err
+					return
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				c.Logger.WithError(err).Warnf("Failed to connect to relay, retrying in %s", backoff)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff = min(backoff*2, time.Minute)
+				continue
+			}
+			backoff = time.Second
+		}
+
+		kind, err := c.wait(ctx, conn)
+		if err != nil {
+			// The relay went away or restarted: reconnect
+			conn.Close()
+			conn = nil
+			continue
+		}
+		go c.forward(conn, kind)
+		conn = nil
+	}
+	if conn != nil {
+		conn.Close()
+	}
+}
+
+// connect opens a connection to the relay and proves the client knows its token
+func (c *Client) connect(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: handshakeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Relay)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	line, err := readLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read relay greeting: %w", err)
+	}
+	challenge, ok := strings.CutPrefix(line, greeting+" ")
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("%s is not a guvnor tunnel relay", c.Relay)
+	}
+	if _, err := fmt.Fprintf(conn, "%s %s\n", sign(c.Token, challenge), c.Hostname); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reply, err := readLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read relay reply: %w", err)
+	}
+	if reason, refused := strings.CutPrefix(reply, "ERR "); refused {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s", ErrRefused, reason)
+	}
+	if reply != "OK" {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected relay reply %q", reply)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// wait reads pings until the relay claims the connection for a public one
+func (c *Client) wait(ctx context.Context, conn net.Conn) (byte, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	b := make([]byte, 1)
+	for {
+		conn.SetReadDeadline(time.Now().Add(3 * pingInterval))
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return 0, err
+		}
+		if b[0] != kindPing {
+			conn.SetReadDeadline(time.Time{})
+			return b[0], nil
+		}
+	}
+}
+
+// forward connects a public connection to the guvnor proxy through the app
+func (c *Client) forward(conn net.Conn, kind byte) {
+	if kind == kindTLS {
+		c.app.forwardTLS(conn)
+		return
+	}
+	c.http.push(conn)
+}
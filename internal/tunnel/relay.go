@@ -0,0 +1,282 @@
+package tunnel
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/gleicon/guvnor/internal/sni"
+)
+
+// maxIdle bounds the idle connections kept for one hostname
+const maxIdle = 64
+
+// Relay accepts tunnel clients and routes public connections to them
+type Relay struct {
+	token   string
+	domains []string
+	logger  *logrus.Logger
+
+	mu    sync.Mutex
+	pools map[string]chan *idleConn // Idle connections by hostname
+}
+
+// NewRelay returns a relay for clients that know token. Clients may claim
+// hostnames under domains, or any hostname when domains is empty.
+func NewRelay(token string, domains []string, logger *logrus.Logger) *Relay {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		if domain = normalizeHost(domain); domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return &Relay{
+		token:   token,
+		domains: normalized,
+		logger:  logger,
+		pools:   make(map[string]chan *idleConn),
+	}
+}
+
+// ServeTunnels accepts tunnel clients on l until it is closed
+func (r *Relay) ServeTunnels(l net.Listener) error {
+	return r.serve(l, r.handshake)
+}
+
+// ServeHTTP accepts public HTTP connections on l until it is closed, routing
+// them by Host header
+func (r *Relay) ServeHTTP(l net.Listener) error {
+	return r.serve(l, r.routeHTTP)
+}
+
+// ServeTLS accepts public TLS connections on l until it is closed, routing
+// them by SNI; the handshake is left to the guvnor server behind the tunnel
+func (r *Relay) ServeTLS(l net.Listener) error {
+	return r.serve(l, r.routeTLS)
+}
+
+func (r *Relay) serve(l net.Listener, handle func(net.Conn)) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			r.logger.WithError(err).Warn("Failed to accept relay connection")
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+// handshake authenticates a tunnel client and keeps its connection idle until
+// a public connection for its hostname arrives
+func (r *Relay) handshake(conn net.Conn) {
+	logger := r.logger.WithField("client", conn.RemoteAddr().String())
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	challenge := hex.EncodeToString(nonce)
+	if _, err := fmt.Fprintf(conn, "%s %s\n", greeting, challenge); err != nil {
+		conn.Close()
+		return
+	}
+	line, err := readLine(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	proof, hostname, _ := strings.Cut(line, " ")
+	hostname = normalizeHost(hostname)
+
+	if !hmac.Equal([]byte(proof), []byte(sign(r.token, challenge))) {
+		logger.Warn("Tunnel client sent an invalid token")
+		refuse(conn, "invalid token")
+		return
+	}
+	if !r.allowed(hostname) {
+		logger.WithField("hostname", hostname).Warn("Tunnel client claimed a hostname this relay does not serve")
+		refuse(conn, fmt.Sprintf("hostname %q is not served by this relay", hostname))
+		return
+	}
+	// Public connections arriving from now on wait for the connection
+	pool := r.pool(hostname)
+	if _, err := io.WriteString(conn, "OK\n"); err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	idle := &idleConn{conn: conn}
+	select {
+	case pool <- idle:
+		logger.WithField("hostname", hostname).Debug("Tunnel connection ready")
+		go idle.keepAlive()
+	default:
+		logger.WithField("hostname", hostname).Warn("Too many idle tunnel connections, closing one")
+		conn.Close()
+	}
+}
+
+func refuse(conn net.Conn, reason string) {
+	fmt.Fprintf(conn, "ERR %s\n", reason)
+	conn.Close()
+}
+
+// allowed reports whether clients may claim hostname
+func (r *Relay) allowed(hostname string) bool {
+	if hostname == "" || strings.ContainsAny(hostname, " /") {
+		return false
+	}
+	if len(r.domains) == 0 {
+		return true
+	}
+	for _, domain := range r.domains {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// pool returns the idle connections of a hostname, creating the pool
+func (r *Relay) pool(hostname string) chan *idleConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pool, ok := r.pools[hostname]
+	if !ok {
+		pool = make(chan *idleConn, maxIdle)
+		r.pools[hostname] = pool
+	}
+	return pool
+}
+
+// take claims an idle connection of hostname for a public connection of the
+// given kind, waiting a while for the client to open one
+func (r *Relay) take(hostname string, kind byte) net.Conn {
+	r.mu.Lock()
+	pool, ok := r.pools[hostname]
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	timeout := time.NewTimer(waitForTunnel)
+	defer timeout.Stop()
+	for {
+		select {
+		case idle := <-pool:
+			if idle.claim(kind) {
+				return idle.conn
+			}
+		case <-timeout.C:
+			return nil
+		}
+	}
+}
+
+// routeHTTP reads the request head for its Host header and replays it to the tunnel
+func (r *Relay) routeHTTP(conn net.Conn) {
+	var peeked bytes.Buffer
+	conn.SetReadDeadline(time.Now().Add(peekTimeout))
+	req, err := http.ReadRequest(bufio.NewReader(io.TeeReader(conn, &peeked)))
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	hostname := normalizeHost(req.Host)
+	tunnel := r.take(hostname, kindHTTP)
+	if tunnel == nil {
+		r.logger.WithField("hostname", hostname).Debug("No tunnel for HTTP request")
+		body := fmt.Sprintf("No tunnel is open for %s\n", hostname)
+		fmt.Fprintf(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+		conn.Close()
+		return
+	}
+	splice(&peekedConn{Conn: conn, reader: io.MultiReader(&peeked, conn)}, tunnel)
+}
+
+// routeTLS reads the ClientHello for its SNI and replays it to the tunnel
+func (r *Relay) routeTLS(conn net.Conn) {
+	conn.SetReadDeadline(time.Now().Add(peekTimeout))
+	serverName, peeked, err := sni.ReadClientHello(conn)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil || serverName == "" {
+		conn.Close()
+		return
+	}
+
+	hostname := normalizeHost(serverName)
+	tunnel := r.take(hostname, kindTLS)
+	if tunnel == nil {
+		r.logger.WithField("hostname", hostname).Debug("No tunnel for TLS connection")
+		conn.Close()
+		return
+	}
+	splice(&peekedConn{Conn: conn, reader: io.MultiReader(bytes.NewReader(peeked), conn)}, tunnel)
+}
+
+// idleConn is a tunnel connection waiting for a public connection
+type idleConn struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	claimed bool // Handed to a public connection, or dead
+}
+
+// claim tells the client what kind of connection follows; false when the
+// connection was claimed or went away
+func (c *idleConn) claim(kind byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.claimed {
+		return false
+	}
+	c.claimed = true
+	return c.send(kind)
+}
+
+// keepAlive pings the client until the connection is claimed, so idle
+// connections survive NAT timeouts and dead clients are noticed
+func (c *idleConn) keepAlive() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		if c.claimed {
+			c.mu.Unlock()
+			return
+		}
+		if !c.send(kindPing) {
+			c.claimed = true
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *idleConn) send(b byte) bool {
+	c.conn.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+	if _, err := c.conn.Write([]byte{b}); err != nil {
+		c.conn.Close()
+		return false
+	}
+	c.conn.SetWriteDeadline(time.Time{})
+	return true
+}
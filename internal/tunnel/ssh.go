@@ -0,0 +1,22 @@
+package tunnel
+
+import "fmt"
+
+// SSHArgs returns the arguments of an ssh command that forwards ports of the
+// target host to local ports, those an App serves: remoteHTTP to httpPort
+// and, when both are set, remoteHTTPS to httpsPort. The remote ports listen
+// on all interfaces only when the sshd of the target allows it with
+// GatewayPorts.
+func SSHArgs(target string, remoteHTTP, httpPort, remoteHTTPS, httpsPort int) []string {
+	args := []string{
+		"-N",
+		"-o", "ExitOnForwardFailure=yes",
+		"-o", "ServerAliveInterval=30",
+		"-o", "ServerAliveCountMax=3",
+		"-R", fmt.Sprintf("*:%d:127.0.0.1:%d", remoteHTTP, httpPort),
+	}
+	if remoteHTTPS > 0 && httpsPort > 0 {
+		args = append(args, "-R", fmt.Sprintf("*:%d:127.0.0.1:%d", remoteHTTPS, httpsPort))
+	}
+	return append(args, target)
+}
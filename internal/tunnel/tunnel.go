@@ -0,0 +1,119 @@
+// Package tunnel exposes apps of a guvnor server that cannot be reached from
+// the internet, such as one on a laptop, through a relay on a machine that can.
+//
+// The tunnel client opens connections to the relay ahead of time and keeps
+// them idle. The relay accepts public HTTP and HTTPS connections, picks the
+// tunnel by Host header or SNI, and splices each to an idle connection; the
+// client passes the requests for its hostname on to the local guvnor proxy
+// and refuses any other (see App). TLS is terminated by guvnor with the app's
+// TLS config, so the relay only sees ciphertext of HTTPS requests and needs
+// no certificates.
+package tunnel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPort = 7835 // Port relays accept tunnel clients on
+	DefaultPool = 4    // Idle connections a client keeps open to the relay
+
+	// TokenEnv names the environment variable holding the relay token
+	TokenEnv = "GUVNOR_RELAY_TOKEN"
+
+	greeting = "GUVNOR-TUNNEL/1"
+
+	kindHTTP = 'H' // A public connection to the relay's HTTP port follows
+	kindTLS  = 'S' // A public connection to the relay's HTTPS port follows
+	kindPing = '.' // Keeps an idle connection open through NAT and firewalls
+
+	pingInterval     = 30 * time.Second
+	handshakeTimeout = 10 * time.Second
+	peekTimeout      = 10 * time.Second
+	waitForTunnel    = 10 * time.Second // How long a public connection waits for an idle tunnel connection
+)
+
+// ErrRefused is returned by clients the relay does not accept, for a wrong
+// token or a hostname it does not serve
+var ErrRefused = errors.New("relay refused the tunnel")
+
+// sign returns the proof that a client knows the relay's token
+func sign(token, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readLine reads a handshake line, without buffering past it: the connection
+// carries raw bytes afterwards
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) < 512 {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return strings.TrimSpace(string(line)), nil
+		}
+		line = append(line, b[0])
+	}
+	return "", errors.New("handshake line too long")
+}
+
+// normalizeHost lowercases a hostname and strips the port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// splice copies bytes between two connections until both directions are done
+func splice(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(a, b)
+		closeWrite(a)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(b, a)
+		closeWrite(b)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+// closeWrite half-closes a connection so the peer sees EOF while replies can still arrive
+func closeWrite(conn net.Conn) {
+	if pc, ok := conn.(*peekedConn); ok {
+		conn = pc.Conn
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// peekedConn is a connection whose first bytes were read to route it
+type peekedConn struct {
+	net.Conn
+	reader io.Reader
+}
+
+func (c *peekedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
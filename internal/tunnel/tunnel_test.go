@@ -0,0 +1,222 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testRelay starts a relay and returns it with the addresses of its tunnel,
+// HTTP and TLS listeners
+func testRelay(t *testing.T, token string, domains ...string) (relay *Relay, tunnels, public, publicTLS string) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	relay = NewRelay(token, domains, logger)
+
+	var addrs []string
+	for _, serve := range []func(net.Listener) error{relay.ServeTunnels, relay.ServeHTTP, relay.ServeTLS} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go serve(l)
+		addrs = append(addrs, l.Addr().String())
+	}
+	return relay, addrs[0], addrs[1], addrs[2]
+}
+
+func testClient(relay, token, hostname string) *Client {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &Client{Relay: relay, Token: token, Hostname: hostname, Pool: 2, Logger: logger}
+}
+
+// runClient runs a client until the test ends, once its connections are idle at the relay
+func runClient(t *testing.T, relay *Relay, client *Client) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- client.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+
+	pool := relay.pool(normalizeHost(client.Hostname))
+	for deadline := time.Now().Add(5 * time.Second); len(pool) < client.Pool; {
+		if time.Now().After(deadline) {
+			t.Fatal("tunnel did not open")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTunnelHTTP(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.Host, r.URL.Path, body)
+	}))
+	defer local.Close()
+
+	relay, tunnels, public, _ := testRelay(t, "secret")
+	client := testClient(tunnels, "secret", "Demo.Example.com")
+	client.HTTPAddr = local.Listener.Addr().String()
+	runClient(t, relay, client)
+
+	// More requests than idle connections: the client opens new ones as they are used
+	httpClient := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}, Timeout: 10 * time.Second}
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("POST", "http://"+public+"/hook", strings.NewReader(fmt.Sprintf("event %d", i)))
+		req.Host = "demo.example.com"
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := fmt.Sprintf("POST demo.example.com /hook event %d", i); string(body) != want {
+			t.Errorf("request %d: got %q, want %q", i, body, want)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "http://"+public+"/", nil)
+	req.Host = "other.example.com"
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("unknown hostname: got status %d, want 502", resp.StatusCode)
+	}
+}
+
+func TestTunnelOtherHostname(t *testing.T) {
+	local := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Host, r.URL.Path)
+	}))
+	defer local.Close()
+
+	relay, tunnels, public, _ := testRelay(t, "secret")
+	client := testClient(tunnels, "secret", "demo.example.com")
+	client.HTTPAddr = local.Listener.Addr().String()
+	runClient(t, relay, client)
+
+	// The relay routes the connection by its first request; the ones after it
+	// must not reach the other apps guvnor serves
+	conn, err := net.DialTimeout("tcp", public, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	reader := bufio.NewReader(conn)
+	for _, tt := range []struct {
+		host   string
+		status int
+		body   string
+	}{
+		{"demo.example.com", http.StatusOK, "demo.example.com /hook"},
+		{"admin.example.com", http.StatusMisdirectedRequest, "Misdirected Request\n"},
+	} {
+		fmt.Fprintf(conn, "GET /hook HTTP/1.1\r\nHost: %s\r\n\r\n", tt.host)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.host, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || string(body) != tt.body {
+			t.Errorf("%s: got %d %q, want %d %q", tt.host, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+}
+
+func TestTunnelTLS(t *testing.T) {
+	local := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s via %s", r.TLS.ServerName, r.Host)
+	}))
+	defer local.Close()
+
+	relay, tunnels, _, publicTLS := testRelay(t, "secret", "example.com")
+	client := testClient(tunnels, "secret", "demo.example.com")
+	client.HTTPSAddr = local.Listener.Addr().String()
+	runClient(t, relay, client)
+
+	// The certificate is the one of the server behind the tunnel
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{ServerName: "demo.example.com", InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, publicTLS)
+			},
+		},
+	}
+	resp, err := httpClient.Get("https://demo.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if want := "demo.example.com via demo.example.com"; string(body) != want {
+		t.Errorf("got %q, want %q", body, want)
+	}
+	if got, want := resp.TLS.PeerCertificates[0].Raw, local.Certificate().Raw; string(got) != string(want) {
+		t.Error("TLS was not terminated by the server behind the tunnel")
+	}
+}
+
+func TestTunnelRefused(t *testing.T) {
+	_, tunnels, _, _ := testRelay(t, "secret", "example.com")
+
+	tests := []struct {
+		name     string
+		token    string
+		hostname string
+		reason   string
+	}{
+		{"wrong token", "guess", "demo.example.com", "invalid token"},
+		{"other domain", "secret", "demo.example.org", "not served by this relay"},
+		{"lookalike domain", "secret", "demoexample.com", "not served by this relay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			err := testClient(tunnels, tt.token, tt.hostname).Run(ctx)
+			if !errors.Is(err, ErrRefused) || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("got %v, want refused with %q", err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	got := strings.Join(SSHArgs("demo@relay.example.com", 80, 8080, 443, 8443), " ")
+	want := "-N -o ExitOnForwardFailure=yes -o ServerAliveInterval=30 -o ServerAliveCountMax=3 -R *:80:127.0.0.1:8080 -R *:443:127.0.0.1:8443 demo@relay.example.com"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Without TLS only HTTP is forwarded
+	got = strings.Join(SSHArgs("relay", 8000, 8080, 443, 0), " ")
+	if strings.Contains(got, ":443:") || !strings.HasSuffix(got, "-R *:8000:127.0.0.1:8080 relay") {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,66 @@
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gleicon/guvnor/guvnortest"
+)
+
+func TestRouting_RestartsCrashedApp(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	h := guvnortest.New(t)
+	web := h.AddFakeApp("web", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	h.Start()
+	h.WaitRunning("web", 0)
+
+	pid := h.Kill("web")
+	h.WaitRunning("web", pid)
+
+	if status, body := h.Get(web.Hostname, "/"); status != http.StatusOK || body != "ok" {
+		t.Errorf("Expected web to be routed again after its restart, got %d %q", status, body)
+	}
+}
+
+func TestHealth_UnhealthyAppIsRestarted(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	h := guvnortest.New(t)
+	web := h.AddFakeApp("web", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.Start()
+	h.WaitHealthy("web")
+	pid := h.Processes("web")[0].PID
+
+	// Three failed checks in a row restart the app
+	web.SetHealthy(false)
+	h.WaitUnhealthy("web")
+	h.WaitRunning("web", pid)
+
+	web.SetHealthy(true)
+	h.WaitHealthy("web")
+}
+
+func TestRouting_ManagementAPIRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration tests in short mode")
+	}
+
+	h := guvnortest.New(t)
+	h.AddFakeApp("web", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.Start()
+	h.WaitRunning("web", 0)
+	pid := h.Processes("web")[0].PID
+
+	if job := h.RunJob("/api/restart?app=web"); job.Status != "succeeded" {
+		t.Fatalf("Expected the restart job to succeed, got %s: %s", job.Status, job.Error)
+	}
+	h.WaitRunning("web", pid)
+}